@@ -14,6 +14,7 @@ import (
 
 	"github.com/MDLlife/teller/src/exchange"
 	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/dbutil"
 )
 
 const usage = `dbfix <dbfile>
@@ -76,9 +77,24 @@ func fixAddress(a string) (string, error) {
 	return fixedAddr, nil
 }
 
+// encodeLike encodes obj to JSON, compressed if old, the value it replaces, was compressed.
+// The records may have been saved compressed, see exchange.Store.EnableCompression
+func encodeLike(old []byte, obj interface{}) ([]byte, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbutil.IsCompressed(old) {
+		return dbutil.CompressValue(b)
+	}
+
+	return b, nil
+}
+
 func fixBindAddressBkt(db *bolt.DB) error {
 	// Check BindAddressBkt
-	// It maps a btc address to a mdl address, so check the value
+	// It maps a btc address to its BoundAddress, so check the BoundAddress's mdl address
 
 	var invalidBtcAddrs [][]byte
 	if err := db.View(func(tx *bolt.Tx) error {
@@ -88,9 +104,13 @@ func fixBindAddressBkt(db *bolt.DB) error {
 		}
 
 		return bkt.ForEach(func(k, v []byte) error {
-			mdlAddr := string(v)
-			if _, err := cipher.DecodeBase58Address(mdlAddr); err != nil {
-				fmt.Printf("Found invalid mdl address \"%s\" in BindAddressBkt: %v\n", mdlAddr, err)
+			var boundAddr exchange.BoundAddress
+			if err := dbutil.UnmarshalValue(v, &boundAddr); err != nil {
+				return err
+			}
+
+			if _, err := cipher.DecodeBase58Address(boundAddr.MDLAddress); err != nil {
+				fmt.Printf("Found invalid mdl address \"%s\" in BindAddressBkt: %v\n", boundAddr.MDLAddress, err)
 				invalidBtcAddrs = append(invalidBtcAddrs, k)
 			}
 
@@ -109,13 +129,24 @@ func fixBindAddressBkt(db *bolt.DB) error {
 				return fmt.Errorf("value expectedly missing for key \"%s\"", string(a))
 			}
 
-			mdlAddr := string(v)
-			fixedAddr, err := fixAddress(mdlAddr)
+			var boundAddr exchange.BoundAddress
+			if err := dbutil.UnmarshalValue(v, &boundAddr); err != nil {
+				return err
+			}
+
+			fixedAddr, err := fixAddress(boundAddr.MDLAddress)
+			if err != nil {
+				return err
+			}
+
+			boundAddr.MDLAddress = fixedAddr
+
+			b, err := encodeLike(v, &boundAddr)
 			if err != nil {
 				return err
 			}
 
-			if err := bkt.Put(a, []byte(fixedAddr)); err != nil {
+			if err := bkt.Put(a, b); err != nil {
 				return err
 			}
 		}
@@ -138,7 +169,7 @@ func fixDepositInfoBkt(db *bolt.DB) error {
 
 		return bkt.ForEach(func(k, v []byte) error {
 			var dpi exchange.DepositInfo
-			if err := json.Unmarshal(v, &dpi); err != nil {
+			if err := dbutil.UnmarshalValue(v, &dpi); err != nil {
 				return err
 			}
 
@@ -163,7 +194,7 @@ func fixDepositInfoBkt(db *bolt.DB) error {
 			}
 
 			var dpi exchange.DepositInfo
-			if err := json.Unmarshal(v, &dpi); err != nil {
+			if err := dbutil.UnmarshalValue(v, &dpi); err != nil {
 				return err
 			}
 
@@ -174,7 +205,7 @@ func fixDepositInfoBkt(db *bolt.DB) error {
 
 			dpi.MDLAddress = fixedAddr
 
-			b, err := json.Marshal(&dpi)
+			b, err := encodeLike(v, &dpi)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/MDLlife/teller/src/addrs"
+	"github.com/MDLlife/teller/src/exchange"
+	"github.com/MDLlife/teller/src/scanner"
+)
+
+// runCommand runs the export or import subcommand
+func runCommand(log logrus.FieldLogger, db *bolt.DB, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("Usage: teller %s <file>", args[0])
+	}
+
+	switch args[0] {
+	case "export":
+		return exportBackup(log, db, args[1])
+	case "import":
+		return importBackup(log, db, args[1])
+	default:
+		return fmt.Errorf("Unknown command %q, expected export or import", args[0])
+	}
+}
+
+// exportBackup writes all address bindings and deposit records in the db to a JSON file
+func exportBackup(log logrus.FieldLogger, db *bolt.DB, filename string) error {
+	store, err := exchange.NewStore(log, db)
+	if err != nil {
+		log.WithError(err).Error("exchange.NewStore failed")
+		return err
+	}
+
+	b, err := store.Export()
+	if err != nil {
+		log.WithError(err).Error("store.Export failed")
+		return err
+	}
+
+	data, err := json.MarshalIndent(b, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		log.WithError(err).Error("Write backup file failed")
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"file":              filename,
+		"boundAddressesLen": len(b.BoundAddresses),
+		"depositsLen":       len(b.Deposits),
+	}).Info("Exported bindings and deposits")
+
+	return nil
+}
+
+// importBackup restores address bindings and deposit records from a JSON file written by exportBackup.
+// The deposit addresses are also marked as used in the address pools and added to the scanners,
+// so that they are not handed out again and deposits to them continue to be detected.
+// Records that already exist are skipped, so the same file can be imported more than once.
+func importBackup(log logrus.FieldLogger, db *bolt.DB, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.WithError(err).Error("Read backup file failed")
+		return err
+	}
+
+	var b exchange.Backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		log.WithError(err).Error("Decode backup file failed")
+		return err
+	}
+
+	store, err := exchange.NewStore(log, db)
+	if err != nil {
+		log.WithError(err).Error("exchange.NewStore failed")
+		return err
+	}
+
+	res, err := store.Import(b)
+	if err != nil {
+		log.WithError(err).Error("store.Import failed")
+		return err
+	}
+
+	scanStore, err := scanner.NewStore(log, db)
+	if err != nil {
+		log.WithError(err).Error("scanner.NewStore failed")
+		return err
+	}
+
+	usedStores := make(map[string]*addrs.Store)
+	for _, ba := range b.BoundAddresses {
+		bktName, err := addrs.UsedAddressBkt(ba.CoinType)
+		if err != nil {
+			return err
+		}
+
+		used, ok := usedStores[bktName]
+		if !ok {
+			used, err = addrs.NewStore(db, bktName)
+			if err != nil {
+				return err
+			}
+			usedStores[bktName] = used
+		}
+
+		if err := used.Put(ba.Address); err != nil {
+			return err
+		}
+
+		if err := scanStore.AddSupportedCoin(ba.CoinType); err != nil {
+			return err
+		}
+
+		if err := scanStore.AddScanAddress(ba.Address, ba.CoinType); err != nil {
+			switch err.(type) {
+			case scanner.DuplicateDepositAddressErr:
+			default:
+				log.WithError(err).Error("scanStore.AddScanAddress failed")
+				return err
+			}
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"file":                   filename,
+		"boundAddressesImported": res.BoundAddressesImported,
+		"boundAddressesSkipped":  res.BoundAddressesSkipped,
+		"depositsImported":       res.DepositsImported,
+		"depositsSkipped":        res.DepositsSkipped,
+	}).Info("Imported bindings and deposits")
+
+	return nil
+}
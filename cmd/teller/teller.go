@@ -4,7 +4,7 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -22,10 +22,12 @@ import (
 
 	"github.com/MDLlife/teller/src/addrs"
 	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/events"
 	"github.com/MDLlife/teller/src/exchange"
 	"github.com/MDLlife/teller/src/monitor"
 	"github.com/MDLlife/teller/src/scanner"
 	"github.com/MDLlife/teller/src/sender"
+	"github.com/MDLlife/teller/src/sweep"
 	"github.com/MDLlife/teller/src/teller"
 	"github.com/MDLlife/teller/src/util"
 	"github.com/MDLlife/teller/src/util/logger"
@@ -42,9 +44,9 @@ func main() {
 
 func createBtcScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.BTCScanner, error) {
 	// create btc rpc client
-	certs, err := ioutil.ReadFile(cfg.BtcRPC.Cert)
+	certs, err := cfg.BtcRPC.Certificates()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to read cfg.BtcRPC.Cert %s: %v", cfg.BtcRPC.Cert, err)
+		return nil, err
 	}
 
 	log.Info("Connecting to btcd")
@@ -55,6 +57,7 @@ func createBtcScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 		User:         cfg.BtcRPC.User,
 		Pass:         cfg.BtcRPC.Pass,
 		Certificates: certs,
+		DisableTLS:   cfg.BtcRPC.DisableTLS,
 	}, nil)
 	if err != nil {
 		log.WithError(err).Error("Connect btcd failed")
@@ -70,9 +73,17 @@ func createBtcScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 	}
 
 	btcScanner, err := scanner.NewBTCScanner(log, scanStore, btcrpc, scanner.Config{
-		ScanPeriod:            cfg.BtcScanner.ScanPeriod,
-		ConfirmationsRequired: cfg.BtcScanner.ConfirmationsRequired,
-		InitialScanHeight:     cfg.BtcScanner.InitialScanHeight,
+		ScanPeriod:                cfg.BtcScanner.ScanPeriod,
+		ConfirmationsRequired:     cfg.BtcScanner.ConfirmationsRequired,
+		InitialScanHeight:         cfg.BtcScanner.InitialScanHeight,
+		StallTimeout:              cfg.BtcScanner.StallTimeout,
+		LargeDepositValue:         cfg.BtcScanner.LargeDepositValue,
+		LargeDepositConfirmations: cfg.BtcScanner.LargeDepositConfirmations,
+		DustValue:                 cfg.BtcScanner.DustValue,
+		MaxBlockLookback:          cfg.BtcScanner.MaxBlockLookback,
+		ConfirmationsUSDPerBlock:  cfg.BtcScanner.ConfirmationsUSDPerBlock,
+		MaxConfirmations:          cfg.BtcScanner.MaxConfirmations,
+		USDRate:                   cfg.MDLExchanger.MDLBtcExchangeRateUSD,
 	})
 	if err != nil {
 		log.WithError(err).Error("Open btcScanner service failed")
@@ -81,23 +92,85 @@ func createBtcScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 	return btcScanner, nil
 }
 
-func createEthScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.ETHScanner, error) {
-	ethrpc, err := scanner.NewEthClient(cfg.EthRPC.Server, cfg.EthRPC.Port)
+func createBtcSweeper(log logrus.FieldLogger, cfg config.Config, addrs sweep.AddressGetter) (*sweep.BtcSweeper, *btcrpcclient.Client, error) {
+	certs, err := cfg.BtcRPC.Certificates()
 	if err != nil {
-		log.WithError(err).Error("Connect geth failed")
-		return nil, err
+		return nil, nil, err
+	}
+
+	log.Info("Connecting to btcwallet")
+
+	// btcwallet only serves the wallet RPCs over a websocket connection
+	walletrpc, err := btcrpcclient.New(&btcrpcclient.ConnConfig{
+		Endpoint:     "ws",
+		Host:         cfg.BtcSweep.WalletServer,
+		User:         cfg.BtcRPC.User,
+		Pass:         cfg.BtcRPC.Pass,
+		Certificates: certs,
+		DisableTLS:   cfg.BtcRPC.DisableTLS,
+	}, nil)
+	if err != nil {
+		log.WithError(err).Error("Connect btcwallet failed")
+		return nil, nil, err
 	}
 
-	err = scanStore.AddSupportedCoin(scanner.CoinTypeETH)
+	log.Info("Connect to btcwallet succeeded")
+
+	sweeper, err := sweep.NewBtcSweeper(log, walletrpc, addrs, sweep.BtcConfig{
+		ColdAddress:      cfg.BtcSweep.ColdAddress,
+		MinConfirmations: int(cfg.BtcSweep.MinConfirmations),
+		FeePerByte:       cfg.BtcSweep.FeePerByte,
+	})
+	if err != nil {
+		walletrpc.Shutdown()
+		return nil, nil, err
+	}
+
+	return sweeper, walletrpc, nil
+}
+
+// transportConfig converts the transport options of an RPC config section to a scanner.TransportConfig
+func transportConfig(t config.HTTPTransport) scanner.TransportConfig {
+	return scanner.TransportConfig{
+		MaxIdleConns:        t.MaxIdleConns,
+		MaxIdleConnsPerHost: t.MaxIdleConnsPerHost,
+		IdleConnTimeout:     t.IdleConnTimeout,
+		KeepAlive:           t.KeepAlive,
+	}
+}
+
+func createEthScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.ETHScanner, error) {
+	var ethrpc scanner.EthRPCClient
+	if cfg.EthRPC.ExplorerURL != "" {
+		log.WithField("explorerURL", cfg.EthRPC.ExplorerURL).Info("Scanning ETH with a block explorer API")
+		ethrpc = scanner.NewEthExplorerClient(cfg.EthRPC.ExplorerURL, cfg.EthRPC.ExplorerAPIKey, transportConfig(cfg.EthRPC.HTTPTransport))
+	} else {
+		ethClient, err := scanner.NewEthClient(cfg.EthRPC.Server, cfg.EthRPC.Port)
+		if err != nil {
+			log.WithError(err).Error("Connect geth failed")
+			return nil, err
+		}
+		ethrpc = ethClient
+	}
+
+	err := scanStore.AddSupportedCoin(scanner.CoinTypeETH)
 	if err != nil {
 		log.WithError(err).Error("scanStore.AddSupportedCoin(scanner.CoinTypeETH) failed")
 		return nil, err
 	}
 
 	ethScanner, err := scanner.NewETHScanner(log, scanStore, ethrpc, scanner.Config{
-		ScanPeriod:            cfg.EthScanner.ScanPeriod,
-		ConfirmationsRequired: cfg.EthScanner.ConfirmationsRequired,
-		InitialScanHeight:     cfg.EthScanner.InitialScanHeight,
+		ScanPeriod:                cfg.EthScanner.ScanPeriod,
+		ConfirmationsRequired:     cfg.EthScanner.ConfirmationsRequired,
+		InitialScanHeight:         cfg.EthScanner.InitialScanHeight,
+		StallTimeout:              cfg.EthScanner.StallTimeout,
+		LargeDepositValue:         cfg.EthScanner.LargeDepositValue,
+		LargeDepositConfirmations: cfg.EthScanner.LargeDepositConfirmations,
+		DustValue:                 cfg.EthScanner.DustValue,
+		MaxBlockLookback:          cfg.EthScanner.MaxBlockLookback,
+		ConfirmationsUSDPerBlock:  cfg.EthScanner.ConfirmationsUSDPerBlock,
+		MaxConfirmations:          cfg.EthScanner.MaxConfirmations,
+		USDRate:                   cfg.MDLExchanger.MDLEthExchangeRateUSD,
 	})
 	if err != nil {
 		log.WithError(err).Error("Open ethScanner service failed")
@@ -107,7 +180,7 @@ func createEthScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 }
 
 func createSkyScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.SKYScanner, error) {
-	skyrpc := scanner.NewSkyClient(cfg.SkyRPC.Server, cfg.SkyRPC.Port)
+	skyrpc := scanner.NewSkyClient(cfg.SkyRPC.Server, cfg.SkyRPC.Port, transportConfig(cfg.SkyRPC.HTTPTransport))
 
 	err := scanStore.AddSupportedCoin(scanner.CoinTypeSKY)
 	if err != nil {
@@ -116,9 +189,19 @@ func createSkyScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 	}
 
 	skyScanner, err := scanner.NewSkycoinScanner(log, scanStore, skyrpc, scanner.Config{
-		ScanPeriod:            cfg.SkyScanner.ScanPeriod,
-		ConfirmationsRequired: cfg.SkyScanner.ConfirmationsRequired,
-		InitialScanHeight:     cfg.SkyScanner.InitialScanHeight,
+		ScanPeriod:                cfg.SkyScanner.ScanPeriod,
+		ConfirmationsRequired:     cfg.SkyScanner.ConfirmationsRequired,
+		InitialScanHeight:         cfg.SkyScanner.InitialScanHeight,
+		StallTimeout:              cfg.SkyScanner.StallTimeout,
+		LargeDepositValue:         cfg.SkyScanner.LargeDepositValue,
+		LargeDepositConfirmations: cfg.SkyScanner.LargeDepositConfirmations,
+		DustValue:                 cfg.SkyScanner.DustValue,
+		MaxBlockLookback:          cfg.SkyScanner.MaxBlockLookback,
+		ConfirmationsUSDPerBlock:  cfg.SkyScanner.ConfirmationsUSDPerBlock,
+		MaxConfirmations:          cfg.SkyScanner.MaxConfirmations,
+		USDRate:                   cfg.MDLExchanger.MDLSkyExchangeRateUSD,
+		BlockWindow:               cfg.SkyScanner.BlockWindow,
+		ConfirmByTxStatus:         cfg.SkyScanner.ConfirmByTxStatus,
 	})
 	if err != nil {
 		log.WithError(err).Error("Open skyScanner service failed")
@@ -128,9 +211,8 @@ func createSkyScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scan
 }
 
 func createWAVESScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.WAVESScanner, error) {
-	url := fmt.Sprintf("%s://%s:%s", cfg.WavesRPC.Protocol, cfg.WavesRPC.Server, cfg.WavesRPC.Port)
-	log.Debug("createWAVESScanner URL, ", url)
-	wavesrpc := scanner.NewWavesClient(url)
+	wavesrpc, protocol := scanner.NewWavesClientWithFallback(log, cfg.WavesRPC.Server, cfg.WavesRPC.Port, cfg.WavesRPC.Protocol, transportConfig(cfg.WavesRPC.HTTPTransport))
+	log.WithField("protocol", protocol).Debug("createWAVESScanner URL, ", wavesrpc.MainNET)
 
 	err := scanStore.AddSupportedCoin(scanner.CoinTypeWAVES)
 	if err != nil {
@@ -139,9 +221,17 @@ func createWAVESScanner(log logrus.FieldLogger, cfg config.Config, scanStore *sc
 	}
 
 	wavesScanner, err := scanner.NewWavescoinScanner(log, scanStore, wavesrpc, scanner.Config{
-		ScanPeriod:            cfg.WavesScanner.ScanPeriod,
-		ConfirmationsRequired: cfg.WavesScanner.ConfirmationsRequired,
-		InitialScanHeight:     cfg.WavesScanner.InitialScanHeight,
+		ScanPeriod:                cfg.WavesScanner.ScanPeriod,
+		ConfirmationsRequired:     cfg.WavesScanner.ConfirmationsRequired,
+		InitialScanHeight:         cfg.WavesScanner.InitialScanHeight,
+		StallTimeout:              cfg.WavesScanner.StallTimeout,
+		LargeDepositValue:         cfg.WavesScanner.LargeDepositValue,
+		LargeDepositConfirmations: cfg.WavesScanner.LargeDepositConfirmations,
+		DustValue:                 cfg.WavesScanner.DustValue,
+		MaxBlockLookback:          cfg.WavesScanner.MaxBlockLookback,
+		ConfirmationsUSDPerBlock:  cfg.WavesScanner.ConfirmationsUSDPerBlock,
+		MaxConfirmations:          cfg.WavesScanner.MaxConfirmations,
+		USDRate:                   cfg.MDLExchanger.MDLWavesExchangeRateUSD,
 	})
 	if err != nil {
 		log.WithError(err).Error("Open wavesScanner service failed")
@@ -151,9 +241,8 @@ func createWAVESScanner(log logrus.FieldLogger, cfg config.Config, scanStore *sc
 }
 
 func createWAVESMDLScanner(log logrus.FieldLogger, cfg config.Config, scanStore *scanner.Store) (*scanner.WAVESMDLScanner, error) {
-	url := fmt.Sprintf("%s://%s:%s", cfg.WavesMDLRPC.Protocol, cfg.WavesMDLRPC.Server, cfg.WavesMDLRPC.Port)
-	log.Debug("createWAVESMDLScanner URL, ", url)
-	wavesrpc := scanner.NewWavesClient(url)
+	wavesrpc, protocol := scanner.NewWavesClientWithFallback(log, cfg.WavesMDLRPC.Server, cfg.WavesMDLRPC.Port, cfg.WavesMDLRPC.Protocol, transportConfig(cfg.WavesMDLRPC.HTTPTransport))
+	log.WithField("protocol", protocol).Debug("createWAVESMDLScanner URL, ", wavesrpc.MainNET)
 
 	err := scanStore.AddSupportedCoin(scanner.CoinTypeWAVESMDL)
 	if err != nil {
@@ -162,9 +251,17 @@ func createWAVESMDLScanner(log logrus.FieldLogger, cfg config.Config, scanStore
 	}
 
 	wavesMDLScanner, err := scanner.NewWavesMDLcoinScanner(log, scanStore, wavesrpc, scanner.Config{
-		ScanPeriod:            cfg.WavesMDLScanner.ScanPeriod,
-		ConfirmationsRequired: cfg.WavesMDLScanner.ConfirmationsRequired,
-		InitialScanHeight:     cfg.WavesMDLScanner.InitialScanHeight,
+		ScanPeriod:                cfg.WavesMDLScanner.ScanPeriod,
+		ConfirmationsRequired:     cfg.WavesMDLScanner.ConfirmationsRequired,
+		InitialScanHeight:         cfg.WavesMDLScanner.InitialScanHeight,
+		StallTimeout:              cfg.WavesMDLScanner.StallTimeout,
+		LargeDepositValue:         cfg.WavesMDLScanner.LargeDepositValue,
+		LargeDepositConfirmations: cfg.WavesMDLScanner.LargeDepositConfirmations,
+		DustValue:                 cfg.WavesMDLScanner.DustValue,
+		MaxBlockLookback:          cfg.WavesMDLScanner.MaxBlockLookback,
+		ConfirmationsUSDPerBlock:  cfg.WavesMDLScanner.ConfirmationsUSDPerBlock,
+		MaxConfirmations:          cfg.WavesMDLScanner.MaxConfirmations,
+		USDRate:                   cfg.MDLExchanger.MDLWavesMDLExchangeRateUSD,
 	})
 	if err != nil {
 		log.WithError(err).Error("Open wavesMDLScanner service failed")
@@ -196,7 +293,7 @@ func run() error {
 	}
 
 	// Init logger
-	rusloggger, err := logger.NewLogger(cfg.LogFilename, cfg.Debug)
+	rusloggger, err := logger.NewLogger(cfg.LogFilename, cfg.Debug, cfg.LogFormat)
 	if err != nil {
 		fmt.Println("Failed to create Logrus logger:", err)
 		return err
@@ -206,6 +303,24 @@ func run() error {
 
 	log.WithField("config", cfg.Redacted()).Info("Loaded teller config")
 
+	if err := scanner.ValidateCoinTypeAliases(cfg.Teller.CoinTypeAliases); err != nil {
+		log.WithError(err).Error("Invalid teller.coin_type_aliases")
+		return err
+	}
+
+	// Config keys are case-insensitive, key the per-coin limits by the canonical coin types
+	maxBoundAddrsPerCoin := make(map[string]int, len(cfg.Teller.MaxBoundAddressesPerCoin))
+	for ct, n := range cfg.Teller.MaxBoundAddressesPerCoin {
+		coinType, err := scanner.NormalizeCoinType(ct, nil)
+		if err != nil {
+			err = fmt.Errorf("teller.max_bound_addrs_per_coin has unsupported coin type %q", ct)
+			log.WithError(err).Error("Invalid teller.max_bound_addrs_per_coin")
+			return err
+		}
+		maxBoundAddrsPerCoin[coinType] = n
+	}
+	cfg.Teller.MaxBoundAddressesPerCoin = maxBoundAddrsPerCoin
+
 	if cfg.Profile {
 		// Start gops agent, for profiling
 		if err := agent.Listen(&agent.Options{
@@ -222,13 +337,30 @@ func run() error {
 	// Open db
 	dbPath := filepath.Join(*appDirOpt, cfg.DBFilename)
 	db, err := bolt.Open(dbPath, 0700, &bolt.Options{
-		Timeout: 1 * time.Second,
+		Timeout:  1 * time.Second,
+		ReadOnly: cfg.ReadOnly,
 	})
 	if err != nil {
 		log.WithError(err).Error("Open db failed")
 		return err
 	}
 
+	// Subcommands, e.g. "teller export backup.json"
+	if pflag.NArg() > 0 {
+		return runCommand(log, db, pflag.Args())
+	}
+
+	if cfg.ReadOnly {
+		return runReadOnly(log, cfg, db, quit)
+	}
+
+	if err := verifyAddressFilesDisjoint(cfg); err != nil {
+		log.WithError(err).Error("Deposit address files overlap")
+		return err
+	}
+
+	logMinDepositsForPayout(log, cfg.MDLExchanger)
+
 	errC := make(chan error, 20)
 	var wg sync.WaitGroup
 
@@ -270,6 +402,7 @@ func run() error {
 
 	// create multiplexer to manage scanner
 	multiplexer := scanner.NewMultiplexer(log)
+	multiplexer.DiscardUnknownCoinTypes = cfg.DiscardUnknownCoinTypes
 
 	dummyMux := http.NewServeMux()
 
@@ -287,6 +420,11 @@ func run() error {
 		// TODO -- refactor dummy scanning to support multiple coin types
 		// scanEthService = scanner.NewDummyScanner(log)
 		scanService.(*scanner.DummyScanner).BindHandlers(dummyMux)
+
+		if err := multiplexer.AddScanner(scanService, scanner.CoinTypeBTC); err != nil {
+			log.WithError(err).Error("multiplexer.AddScanner of dummy scanner failed")
+			return err
+		}
 	} else {
 		// enable btc scanner
 		if cfg.BtcRPC.Enabled {
@@ -381,17 +519,39 @@ func run() error {
 
 	background("multiplex.Run", errC, multiplexer.Multiplex)
 
+	var balanceReconciler *scanner.BalanceReconciler
+	if cfg.BalanceReconcileInterval > 0 {
+		balanceReconciler = scanner.NewBalanceReconciler(log, scanStore, multiplexer, cfg.BalanceReconcileInterval)
+		background("balanceReconciler.Run", errC, balanceReconciler.Run)
+	}
+
 	if cfg.Dummy.Sender {
 		log.Info("mdld disabled, running dummy sender")
 		sendRPC = sender.NewDummySender(log)
 		sendRPC.(*sender.DummySender).BindHandlers(dummyMux)
 	} else {
-		mdlClient, err := sender.NewAPI(cfg.MDLExchanger.Wallet, cfg.MDLRPC.Address)
+		// The password was checked against the wallet by config validation
+		walletPassword, err := cfg.MDLExchanger.WalletPassword()
+		if err != nil {
+			log.WithError(err).Error("Read hot wallet password failed")
+			return err
+		}
+
+		mdlClient, err := sender.NewAPI(cfg.MDLExchanger.Wallet, cfg.MDLRPC.Address, walletPassword)
 		if err != nil {
 			log.WithError(err).Error("sender.NewAPI failed")
 			return err
 		}
 
+		if cfg.MDLRPC.MinNodeVersion != "" {
+			if err := sender.CheckNodeVersion(mdlClient, cfg.MDLRPC.MinNodeVersion); err != nil {
+				log.WithError(err).Error("sender.CheckNodeVersion failed, set mdl_rpc.min_node_version = \"\" to skip the check")
+				return err
+			}
+		} else {
+			log.Warn("mdl_rpc.min_node_version is empty, the mdl node version is not checked")
+		}
+
 		sendService = sender.NewService(log, mdlClient)
 
 		background("sendService.Run", errC, sendService.Run)
@@ -399,6 +559,10 @@ func run() error {
 		sendRPC = sender.NewRetrySender(sendService)
 	}
 
+	if cfg.MDLRPC.BreakerThreshold > 0 {
+		sendRPC = sender.NewCircuitBreaker(log, sendRPC, cfg.MDLRPC.BreakerThreshold, cfg.MDLRPC.BreakerCooldown)
+	}
+
 	if cfg.Dummy.Scanner || cfg.Dummy.Sender {
 		log.Infof("Starting dummy admin interface listener on http://%s", cfg.Dummy.HTTPAddr)
 		go func() {
@@ -415,6 +579,13 @@ func run() error {
 		return err
 	}
 
+	if cfg.CompressRecords {
+		if err := exchangeStore.EnableCompression(); err != nil {
+			log.WithError(err).Error("exchangeStore.EnableCompression failed")
+			return err
+		}
+	}
+
 	var exchangeClient *exchange.Exchange
 
 	switch cfg.MDLExchanger.BuyMethod {
@@ -437,8 +608,67 @@ func run() error {
 		return config.ErrInvalidBuyMethod
 	}
 
+	if ds, ok := scanService.(*scanner.DummyScanner); ok {
+		ds.EnableTestDeposits(cfg.Dummy.Token, exchangeClient.GetDepositAddress)
+	}
+
+	var publishers events.MultiPublisher
+
+	var eventPublisher *events.AsyncPublisher
+	if cfg.Events.Enabled {
+		natsPublisher, err := events.NewNATSPublisher(cfg.Events.BrokerURL, cfg.Events.Subject)
+		if err != nil {
+			log.WithError(err).Error("events.NewNATSPublisher failed")
+			return err
+		}
+		defer natsPublisher.Close()
+
+		eventPublisher = events.NewAsyncPublisher(log, natsPublisher, cfg.Events.QueueSize)
+		publishers = append(publishers, eventPublisher)
+
+		background("eventPublisher.Run", errC, eventPublisher.Run)
+	}
+
+	var emailPublisher *events.AsyncPublisher
+	if cfg.Email.Enabled {
+		emailPublisher = events.NewAsyncPublisher(log, events.NewEmailPublisher(events.EmailConfig{
+			Host:     cfg.Email.Host,
+			Port:     cfg.Email.Port,
+			Username: cfg.Email.Username,
+			Password: cfg.Email.Password,
+			From:     cfg.Email.From,
+			To:       cfg.Email.To,
+
+			NotifyUsers: cfg.Email.UserNotifications,
+			OptOutURL:   cfg.Email.OptOutURL,
+		}), cfg.Email.QueueSize)
+		publishers = append(publishers, emailPublisher)
+
+		background("emailPublisher.Run", errC, emailPublisher.Run)
+	}
+
+	// The /api/events streams subscribe to the deposit events
+	var eventBroker *events.Broker
+	if cfg.Web.EventStreamEnabled {
+		eventBroker = events.NewBroker()
+		publishers = append(publishers, eventBroker)
+	}
+
+	if len(publishers) > 0 {
+		if err := exchangeClient.SetPublisher(publishers); err != nil {
+			log.WithError(err).Error("exchangeClient.SetPublisher failed")
+			return err
+		}
+	}
+
 	background("exchangeClient.Run", errC, exchangeClient.Run)
 
+	addrFormats, err := addrs.NewFormats(cfg.Teller.AddressFormats)
+	if err != nil {
+		log.WithError(err).Error("Invalid teller.address_formats")
+		return err
+	}
+
 	// create AddrManager
 	addrManager := addrs.NewAddrManager()
 
@@ -450,7 +680,7 @@ func run() error {
 			return err
 		}
 
-		btcAddrMgr, err = addrs.NewBTCAddrs(log, db, r)
+		btcAddrMgr, err = addrs.NewBTCAddrs(log, db, r, addrFormats[scanner.CoinTypeBTC])
 		if err != nil {
 			log.WithError(err).Error("Create bitcoin deposit address manager failed")
 			return err
@@ -469,7 +699,7 @@ func run() error {
 			return err
 		}
 
-		ethAddrMgr, err = addrs.NewETHAddrs(log, db, r)
+		ethAddrMgr, err = addrs.NewETHAddrs(log, db, r, addrFormats[scanner.CoinTypeETH])
 		if err != nil {
 			log.WithError(err).Error("Create ethcoin deposit address manager failed")
 			return err
@@ -488,7 +718,7 @@ func run() error {
 			return err
 		}
 
-		skyAddrMgr, err = addrs.NewSKYAddrs(log, db, r)
+		skyAddrMgr, err = addrs.NewSKYAddrs(log, db, r, addrFormats[scanner.CoinTypeSKY])
 		if err != nil {
 			log.WithError(err).Error("Create skycoin deposit address manager failed")
 			return err
@@ -507,7 +737,7 @@ func run() error {
 			return err
 		}
 
-		wavesAddrMgr, err = addrs.NewWAVESAddrs(log, db, r)
+		wavesAddrMgr, err = addrs.NewWAVESAddrs(log, db, r, addrFormats[scanner.CoinTypeWAVES])
 		if err != nil {
 			log.WithError(err).Error("Create waves deposit address manager failed")
 			return err
@@ -526,7 +756,7 @@ func run() error {
 			return err
 		}
 
-		wavesMDLAddrMgr, err = addrs.NewWAVESAddrs(log, db, r)
+		wavesMDLAddrMgr, err = addrs.NewWAVESAddrs(log, db, r, addrFormats[scanner.CoinTypeWAVESMDL])
 		if err != nil {
 			log.WithError(err).Error("Create wavesMDL deposit address manager failed")
 			return err
@@ -537,7 +767,14 @@ func run() error {
 		}
 	}
 
-	tellerServer := teller.New(log, exchangeClient, addrManager, cfg)
+	tellerServer := teller.New(log, exchangeClient, addrManager, multiplexer, cfg)
+	tellerServer.SetNetworkFees(multiplexer)
+	tellerServer.SetAddressBalances(multiplexer)
+	tellerServer.SetRunningScanners(multiplexer)
+	tellerServer.SetAddressFormats(addrFormats)
+	if eventBroker != nil {
+		tellerServer.SetDepositEvents(eventBroker)
+	}
 
 	// Run the service
 	background("tellerServer.Run", errC, tellerServer.Run)
@@ -552,8 +789,18 @@ func run() error {
 		log.Error("Can't convert fix_usd_value: '" + cfg.AdminPanel.FixUsdValue + "' to decimal")
 	}
 
+	var allowedIPs []*net.IPNet
+	for _, cidr := range cfg.AdminPanel.AllowedIPs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.WithError(err).Error("Invalid admin_panel.allowed_ips")
+			return err
+		}
+		allowedIPs = append(allowedIPs, n)
+	}
+
 	monitorCfg := monitor.Config{
-		Addr:             cfg.AdminPanel.Host,
+		Addrs:            cfg.AdminPanel.Addrs(),
 		FixBtcValue:      cfg.AdminPanel.FixBtcValue,
 		FixEthValue:      cfg.AdminPanel.FixEthValue,
 		FixSkyValue:      cfg.AdminPanel.FixSkyValue,
@@ -562,9 +809,62 @@ func run() error {
 		FixMdlValue:      cfg.AdminPanel.FixMdlValue,
 		FixUsdValue:      fixUsdValue,
 		FixTxValue:       cfg.AdminPanel.FixTxValue,
+		AllowedIPs:       allowedIPs,
+		BehindProxy:      cfg.AdminPanel.BehindProxy,
+		AuthToken:        cfg.AdminPanel.AuthToken,
 	}
 	monitorService := monitor.New(log, monitorCfg, btcAddrMgr, ethAddrMgr, skyAddrMgr, wavesAddrMgr, wavesMDLAddrMgr, exchangeClient, btcScanner)
 
+	var btcWalletRPC *btcrpcclient.Client
+	if btcScanner != nil && cfg.BtcSweep.ColdAddress != "" {
+		var btcSweeper *sweep.BtcSweeper
+		btcSweeper, btcWalletRPC, err = createBtcSweeper(rusloggger, cfg, btcScanner)
+		if err != nil {
+			log.WithError(err).Error("create btc sweeper failed")
+			return err
+		}
+
+		monitorService.Sweepers = map[string]monitor.Sweeper{
+			scanner.CoinTypeBTC: btcSweeper,
+		}
+	}
+
+	monitorService.Sends = exchangeClient
+	monitorService.Deprecations = exchangeClient
+	monitorService.Imports = exchangeClient
+	if balanceReconciler != nil {
+		monitorService.Balances = balanceReconciler
+	}
+
+	monitorService.Scanners = make(map[string]monitor.ScanController)
+	monitorService.BlockReplayers = make(map[string]monitor.BlockReplayer)
+	monitorService.Pending = make(map[string]monitor.PendingDepositLister)
+	if btcScanner != nil {
+		monitorService.Scanners[scanner.CoinTypeBTC] = btcScanner.Base
+		monitorService.BlockReplayers[scanner.CoinTypeBTC] = btcScanner
+		monitorService.Pending[scanner.CoinTypeBTC] = btcScanner.Base
+	}
+	if ethScanner != nil {
+		monitorService.Scanners[scanner.CoinTypeETH] = ethScanner.Base
+		monitorService.BlockReplayers[scanner.CoinTypeETH] = ethScanner
+		monitorService.Pending[scanner.CoinTypeETH] = ethScanner.Base
+	}
+	if skyScanner != nil {
+		monitorService.Scanners[scanner.CoinTypeSKY] = skyScanner.Base
+		monitorService.BlockReplayers[scanner.CoinTypeSKY] = skyScanner
+		monitorService.Pending[scanner.CoinTypeSKY] = skyScanner.Base
+	}
+	if wavesScanner != nil {
+		monitorService.Scanners[scanner.CoinTypeWAVES] = wavesScanner.Base
+		monitorService.BlockReplayers[scanner.CoinTypeWAVES] = wavesScanner
+		monitorService.Pending[scanner.CoinTypeWAVES] = wavesScanner.Base
+	}
+	if wavesMDLScanner != nil {
+		monitorService.Scanners[scanner.CoinTypeWAVESMDL] = wavesMDLScanner.Base
+		monitorService.BlockReplayers[scanner.CoinTypeWAVESMDL] = wavesMDLScanner
+		monitorService.Pending[scanner.CoinTypeWAVESMDL] = wavesMDLScanner.Base
+	}
+
 	background("monitorService.Run", errC, monitorService.Run)
 
 	var finalErr error
@@ -583,12 +883,23 @@ func run() error {
 		monitorService.Shutdown()
 	}
 
+	if btcWalletRPC != nil {
+		log.Info("Shutting down btcwallet client")
+		btcWalletRPC.Shutdown()
+	}
+
 	// close the teller service
 	log.Info("Shutting down tellerServer")
 	tellerServer.Shutdown()
 
-	log.Info("Shutting down the multiplexer")
-	multiplexer.Shutdown()
+	if balanceReconciler != nil {
+		log.Info("Shutting down balanceReconciler")
+		balanceReconciler.Shutdown()
+	}
+
+	// Shutdown order matters so that deposits buffered in the pipeline are recorded:
+	// the scanners drain their scanned deposits through the multiplexer into the
+	// exchange, then the multiplexer stops, then the exchange.
 
 	// close the scan service
 	if btcScanner != nil {
@@ -619,10 +930,23 @@ func run() error {
 		wavesMDLScanner.Shutdown()
 	}
 
+	log.Info("Shutting down the multiplexer")
+	multiplexer.Shutdown()
+
 	// close exchange service
 	log.Info("Shutting down exchangeClient")
 	exchangeClient.Shutdown()
 
+	if eventPublisher != nil {
+		log.Info("Shutting down eventPublisher")
+		eventPublisher.Shutdown()
+	}
+
+	if emailPublisher != nil {
+		log.Info("Shutting down emailPublisher")
+		emailPublisher.Shutdown()
+	}
+
 	// close the mdl send service
 	if sendService != nil {
 		log.Info("Shutting down MDL sendService")
@@ -638,6 +962,140 @@ func run() error {
 	return finalErr
 }
 
+// runReadOnly serves the HTTP API from a read-only db. No scanners, sender or address managers
+// are started, so deposits are neither detected nor paid out and no addresses can be bound
+func runReadOnly(log logrus.FieldLogger, cfg config.Config, db *bolt.DB, quit <-chan struct{}) error {
+	log.Info("Running in read-only mode, scanning, sending and binding are disabled")
+
+	exchangeStore, err := exchange.NewStore(log, db)
+	if err != nil {
+		log.WithError(err).Error("exchange.NewStore failed")
+		return err
+	}
+
+	exchangeClient, err := exchange.NewReadOnlyExchange(log, cfg.MDLExchanger, exchangeStore)
+	if err != nil {
+		log.WithError(err).Error("exchange.NewReadOnlyExchange failed")
+		return err
+	}
+
+	tellerServer := teller.New(log, exchangeClient, addrs.NewAddrManager(), nil, cfg)
+
+	errC := make(chan error, 2)
+	var wg sync.WaitGroup
+
+	background := func(name string, f func() error) {
+		log.Infof("Backgrounding task %s", name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f(); err != nil {
+				log.WithError(err).Errorf("Backgrounded task %s failed", name)
+				errC <- fmt.Errorf("Backgrounded task %s failed: %v", name, err)
+			} else {
+				log.Infof("Backgrounded task %s shutdown", name)
+			}
+		}()
+	}
+
+	background("exchangeClient.Run", exchangeClient.Run)
+	background("tellerServer.Run", tellerServer.Run)
+
+	var finalErr error
+	select {
+	case <-quit:
+	case finalErr = <-errC:
+		log.WithError(finalErr).Error("Goroutine error")
+	}
+
+	log.Info("Shutting down...")
+
+	log.Info("Shutting down tellerServer")
+	tellerServer.Shutdown()
+
+	log.Info("Shutting down exchangeClient")
+	exchangeClient.Shutdown()
+
+	log.Info("Waiting for goroutines to exit")
+
+	wg.Wait()
+
+	log.Info("Shutdown complete")
+
+	return finalErr
+}
+
+// verifyAddressFilesDisjoint returns an error if an address appears in the deposit address files of more than one enabled coin
+func verifyAddressFilesDisjoint(cfg config.Config) error {
+	files := make(map[string]string)
+	if cfg.BtcRPC.Enabled {
+		files[scanner.CoinTypeBTC] = cfg.BtcAddresses
+	}
+	if cfg.EthRPC.Enabled {
+		files[scanner.CoinTypeETH] = cfg.EthAddresses
+	}
+	if cfg.SkyRPC.Enabled {
+		files[scanner.CoinTypeSKY] = cfg.SkyAddresses
+	}
+	if cfg.WavesRPC.Enabled {
+		files[scanner.CoinTypeWAVES] = cfg.WavesAddresses
+	}
+	if cfg.WavesMDLRPC.Enabled {
+		files[scanner.CoinTypeWAVESMDL] = cfg.WavesMDLAddresses
+	}
+
+	coinAddrs := make(map[string][]string, len(files))
+	for coinType, path := range files {
+		r, err := util.LoadFileToReader(path)
+		if err != nil {
+			return err
+		}
+
+		coinAddrs[coinType], _, err = addrs.ReadAddresses(r)
+		if err != nil {
+			return fmt.Errorf("Decode %s address file failed: %v", coinType, err)
+		}
+	}
+
+	return addrs.VerifyDisjointAddresses(coinAddrs)
+}
+
+// logMinDepositsForPayout logs the smallest deposit of each coin that is paid out.
+// Smaller deposits are given 0 MDL once truncated to mdl_exchanger.max_decimals and net of the deducted network fee, so if a whole coin
+// or more is needed, the rate and max_decimals are likely misconfigured and a warning is logged
+func logMinDepositsForPayout(log logrus.FieldLogger, cfg config.MDLExchanger) {
+	minDeposits, err := exchange.MinDepositsForPayout(cfg)
+	if err != nil {
+		log.WithError(err).Warn("Failed to calculate the minimum deposits that are paid out")
+		return
+	}
+
+	for _, coinType := range scanner.GetCoinTypes() {
+		minDeposit, ok := minDeposits[coinType]
+		if !ok {
+			continue
+		}
+
+		amount, err := exchange.DepositValueToDecimal(coinType, minDeposit)
+		if err != nil {
+			log.WithError(err).Warn("exchange.DepositValueToDecimal failed")
+			continue
+		}
+
+		log := log.WithFields(logrus.Fields{
+			"coinType":    coinType,
+			"minDeposit":  amount.String(),
+			"maxDecimals": cfg.MaxDecimals,
+		})
+
+		if amount.GreaterThanOrEqual(decimal.New(1, 0)) {
+			log.Warn("Deposits smaller than the minimum deposit are not paid out, check the exchange rate and max_decimals")
+		} else {
+			log.Info("Deposits smaller than the minimum deposit are not paid out")
+		}
+	}
+}
+
 func createFolderIfNotExist(path string) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		// create the dir
@@ -4,10 +4,13 @@ package addrs
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/boltdb/bolt"
 	"github.com/sirupsen/logrus"
+
+	"github.com/MDLlife/teller/src/scanner"
 )
 
 var (
@@ -26,8 +29,9 @@ type AddrGenerator interface {
 type Addrs struct {
 	sync.RWMutex
 	log       logrus.FieldLogger
-	used      *Store   // all used addresses
-	addresses []string // address pool for deposit
+	used      *Store            // all used addresses
+	addresses []string          // address pool for deposit
+	labels    map[string]string // address of each label in the address file
 }
 
 // AddrManager control all AddrGenerator according to coinType
@@ -70,73 +74,262 @@ func (am *AddrManager) NewAddress(coinType string) (string, error) {
 	return depositAddr, nil
 }
 
-// NewAddrs creates Addrs instance, will load and verify the addresses
+// NewLabeledAddress returns the deposit address of coinType labeled label, or the next deposit address
+// if that address was issued already or there is none. AddrGenerators that don't support labels return the next address
+func (am *AddrManager) NewLabeledAddress(coinType, label string) (string, error) {
+	if label == "" {
+		return am.NewAddress(coinType)
+	}
+
+	am.Mutex.Lock()
+	defer am.Mutex.Unlock()
+	ag, ok := am.AGHolder[coinType]
+	if !ok {
+		return "", ErrCoinTypeNotExists
+	}
+
+	if lg, ok := ag.(LabeledAddrGenerator); ok {
+		return lg.NewLabeledAddress(label)
+	}
+
+	return ag.NewAddress()
+}
+
+// Available returns false if the AddrGenerator of coinType has no deposit addresses left.
+// AddrGenerators that don't report their remaining addresses are assumed to have some
+func (am *AddrManager) Available(coinType string) (bool, error) {
+	am.Mutex.RLock()
+	defer am.Mutex.RUnlock()
+	ag, ok := am.AGHolder[coinType]
+	if !ok {
+		return false, ErrCoinTypeNotExists
+	}
+	if r, ok := ag.(interface {
+		Remaining() uint64
+	}); ok {
+		return r.Remaining() > 0, nil
+	}
+	return true, nil
+}
+
+// UsedAddressBkt returns the name of the bucket that records the used deposit addresses of a coin type
+func UsedAddressBkt(coinType string) (string, error) {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		return btcBucketKey, nil
+	case scanner.CoinTypeETH:
+		return ethBucketKey, nil
+	case scanner.CoinTypeSKY:
+		return skyBucketKey, nil
+	case scanner.CoinTypeWAVES, scanner.CoinTypeWAVESMDL:
+		return wavesBucketKey, nil
+	default:
+		return "", ErrCoinTypeNotExists
+	}
+}
+
+// VerifyAddress returns an error if addr is not a valid deposit address of a coin type
+func VerifyAddress(coinType, addr string) error {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		return verifyBTCAddresses([]string{addr})
+	case scanner.CoinTypeETH:
+		return verifyETHAddresses([]string{addr})
+	case scanner.CoinTypeSKY:
+		return verifySKYAddresses([]string{addr})
+	case scanner.CoinTypeWAVES, scanner.CoinTypeWAVESMDL:
+		if addr == "" {
+			return errors.New("Empty deposit address")
+		}
+		return verifyWAVESAddresses([]string{addr})
+	default:
+		return ErrCoinTypeNotExists
+	}
+}
+
+// VerifyDisjointAddresses returns an error if an address is listed under more than one coin type.
+// coinAddrs maps each coin type to its deposit addresses. A shared address would make
+// deposits to it ambiguous, since every coin's scanner would watch it.
+func VerifyDisjointAddresses(coinAddrs map[string][]string) error {
+	coinTypes := make([]string, 0, len(coinAddrs))
+	for coinType := range coinAddrs {
+		coinTypes = append(coinTypes, coinType)
+	}
+	sort.Strings(coinTypes)
+
+	seen := make(map[string]string)
+	for _, coinType := range coinTypes {
+		for _, addr := range coinAddrs[coinType] {
+			if other, ok := seen[addr]; ok && other != coinType {
+				return fmt.Errorf("Deposit address `%s` is listed for both %s and %s", addr, other, coinType)
+			}
+			seen[addr] = coinType
+		}
+	}
+
+	return nil
+}
+
+// NewAddrs creates Addrs instance, will load and verify the addresses.
+// The addresses are reconciled against the addresses already issued from the bucket, which may have been
+// issued from a different version of the address file: issued addresses are never issued again,
+// and issued addresses missing from the file are logged, since they are still bound and scanned
 func NewAddrs(log logrus.FieldLogger, db *bolt.DB, addresses []string, bucketKey string) (*Addrs, error) {
+	log = log.WithField("prefix", "addrs")
+
 	used, err := NewStore(db, bucketKey)
 	if err != nil {
 		return nil, err
 	}
 
-	addresses, err = removeUsedAddresses(used, addresses)
+	addresses, err = reconcileUsedAddresses(log.WithField("bucket", bucketKey), used, addresses)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Addrs{
-		log:       log.WithField("prefix", "addrs"),
+		log:       log,
 		used:      used,
 		addresses: addresses,
 	}, nil
 }
 
-func removeUsedAddresses(s *Store, addrs []string) ([]string, error) {
-	var newAddrs []string
+// newLabeledAddrs creates an Addrs whose addresses can also be issued by label, see NewLabeledAddress.
+// labels maps each label to its address
+func newLabeledAddrs(log logrus.FieldLogger, db *bolt.DB, addresses []string, labels map[string]string, bucketKey string) (*Addrs, error) {
+	a, err := NewAddrs(log, db, addresses, bucketKey)
+	if err != nil {
+		return nil, err
+	}
+
+	a.labels = labels
+	return a, nil
+}
+
+// reconcileUsedAddresses returns the addresses that have not been issued yet, without duplicates, in file order
+func reconcileUsedAddresses(log logrus.FieldLogger, s *Store, addrs []string) ([]string, error) {
+	usedAddrs, err := s.GetAll()
+	if err != nil {
+		return nil, err
+	}
 
+	used := make(map[string]struct{}, len(usedAddrs))
+	for _, addr := range usedAddrs {
+		used[addr] = struct{}{}
+	}
+
+	inFile := make(map[string]struct{}, len(addrs))
+	var newAddrs []string
 	for _, addr := range addrs {
-		if used, err := s.IsUsed(addr); err != nil {
-			return nil, err
-		} else if !used {
+		if _, ok := inFile[addr]; ok {
+			continue
+		}
+		inFile[addr] = struct{}{}
+
+		if _, ok := used[addr]; !ok {
 			newAddrs = append(newAddrs, addr)
 		}
 	}
 
+	var removed []string
+	for _, addr := range usedAddrs {
+		if _, ok := inFile[addr]; !ok {
+			removed = append(removed, addr)
+		}
+	}
+
+	if len(removed) > 0 {
+		log.WithFields(logrus.Fields{
+			"removedAddrs":    removed,
+			"removedAddrsLen": len(removed),
+		}).Warn("Issued deposit addresses are missing from the address file. They remain bound and scanned, and are never issued again")
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"fileAddrsLen":      len(inFile),
+		"usedAddrsLen":      len(inFile) - len(newAddrs),
+		"remainingAddrsLen": len(newAddrs),
+	})
+	if len(newAddrs) == 0 {
+		log.Warn("Every deposit address in the address file has been issued")
+	} else {
+		log.Info("Loaded deposit addresses")
+	}
+
 	return newAddrs, nil
 }
 
-// NewAddress return a new deposit address
+// NewAddress return a new deposit address.
+// The address is claimed in the used pool transactionally, so an address is never issued twice,
+// even by several Addrs sharing the same bucket
 func (a *Addrs) NewAddress() (string, error) {
 	a.Lock()
 	defer a.Unlock()
 
-	if len(a.addresses) == 0 {
-		return "", ErrDepositAddressEmpty
+	return a.newAddress()
+}
+
+// NewLabeledAddress returns the deposit address labeled label in the address file. If there is no such label,
+// or its address was issued already, the next deposit address is returned like NewAddress
+func (a *Addrs) NewLabeledAddress(label string) (string, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	log := a.log.WithField("label", label)
+
+	labeledAddr, ok := a.labels[label]
+	if !ok {
+		log.Info("Unknown deposit address label, issuing the next address")
+		return a.newAddress()
 	}
 
-	var chosenAddr string
-	var pt int
 	for i, addr := range a.addresses {
-		if used, err := a.used.IsUsed(addr); err != nil {
-			return "", err
-		} else if used {
+		if addr != labeledAddr {
 			continue
 		}
 
-		pt = i
-		chosenAddr = addr
+		claimed, err := a.used.Claim(addr)
+		if err != nil {
+			return "", fmt.Errorf("Put address in used pool failed: %v", err)
+		}
+
+		// remove used addr
+		a.addresses = append(a.addresses[:i:i], a.addresses[i+1:]...)
+
+		if claimed {
+			return addr, nil
+		}
+
+		log.WithField("addr", addr).Warn("Deposit address was already issued from the same bucket, skipping it")
 		break
 	}
 
-	if chosenAddr == "" {
-		return "", ErrDepositAddressEmpty
-	}
+	log.WithField("addr", labeledAddr).Info("Labeled deposit address was issued already, issuing the next address")
+	return a.newAddress()
+}
+
+// newAddress issues the next deposit address, the lock must be held
+func (a *Addrs) newAddress() (string, error) {
+	for i, addr := range a.addresses {
+		claimed, err := a.used.Claim(addr)
+		if err != nil {
+			// Drop the addresses found used so far, keep the rest
+			a.addresses = a.addresses[i:]
+			return "", fmt.Errorf("Put address in used pool failed: %v", err)
+		}
+
+		if !claimed {
+			a.log.WithField("addr", addr).Warn("Deposit address was already issued from the same bucket, skipping it")
+			continue
+		}
 
-	if err := a.used.Put(chosenAddr); err != nil {
-		return "", fmt.Errorf("Put address in used pool failed: %v", err)
+		// remove used addr
+		a.addresses = a.addresses[i+1:]
+		return addr, nil
 	}
 
-	// remove used addr
-	a.addresses = a.addresses[pt+1:]
-	return chosenAddr, nil
+	a.addresses = nil
+	return "", ErrDepositAddressEmpty
 }
 
 // Remaining returns the rest btc address number
@@ -1,12 +1,16 @@
 package addrs
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/boltdb/bolt"
 	"github.com/sirupsen/logrus"
+	logrus_test "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 
+	"github.com/MDLlife/teller/src/scanner"
 	"github.com/MDLlife/teller/src/util/testutil"
 )
 
@@ -240,6 +244,109 @@ func TestNewEthAddress(t *testing.T) {
 	require.Equal(t, ErrDepositAddressEmpty, err)
 }
 
+// removedAddrsLogged returns the issued addresses logged as missing from the address file
+func removedAddrsLogged(hook *logrus_test.Hook) []string {
+	for _, e := range hook.AllEntries() {
+		if addrs, ok := e.Data["removedAddrs"].([]string); ok && e.Level == logrus.WarnLevel {
+			return addrs
+		}
+	}
+	return nil
+}
+
+func TestNewAddrsFileRemovesIssuedAddress(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	addresses := []string{
+		"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj",
+		"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+		"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap",
+	}
+
+	log, hook := testutil.NewLogger(t)
+	btca, err := NewAddrs(log, db, addresses, "test_bucket")
+	require.NoError(t, err)
+	require.Nil(t, removedAddrsLogged(hook))
+
+	issued, err := btca.NewAddress()
+	require.NoError(t, err)
+	require.Equal(t, addresses[0], issued)
+
+	// The issued address is removed from the file, and an unissued address is listed twice
+	log, hook = testutil.NewLogger(t)
+	btca, err = NewAddrs(log, db, []string{
+		"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+		"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap",
+		"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+	}, "test_bucket")
+	require.NoError(t, err)
+	require.Equal(t, []string{issued}, removedAddrsLogged(hook))
+	require.Equal(t, uint64(2), btca.Remaining())
+
+	// The issued address is still marked as used
+	used, err := btca.used.IsUsed(issued)
+	require.NoError(t, err)
+	require.True(t, used)
+
+	// The issued address is added back to the file, it is not issued again
+	log, hook = testutil.NewLogger(t)
+	btca, err = NewAddrs(log, db, addresses, "test_bucket")
+	require.NoError(t, err)
+	require.Nil(t, removedAddrsLogged(hook))
+	require.Equal(t, uint64(2), btca.Remaining())
+
+	for i := 1; i < len(addresses); i++ {
+		addr, err := btca.NewAddress()
+		require.NoError(t, err)
+		require.Equal(t, addresses[i], addr)
+	}
+
+	_, err = btca.NewAddress()
+	require.Equal(t, ErrDepositAddressEmpty, err)
+}
+
+func TestNewAddrsFileAddsAddresses(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	addresses := []string{
+		"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj",
+		"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+	}
+
+	log, _ := testutil.NewLogger(t)
+	btca, err := NewAddrs(log, db, addresses, "test_bucket")
+	require.NoError(t, err)
+
+	for range addresses {
+		_, err := btca.NewAddress()
+		require.NoError(t, err)
+	}
+
+	_, err = btca.NewAddress()
+	require.Equal(t, ErrDepositAddressEmpty, err)
+
+	// New addresses are appended to the file
+	addresses = append(addresses, "1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap", "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp")
+
+	log, hook := testutil.NewLogger(t)
+	btca, err = NewAddrs(log, db, addresses, "test_bucket")
+	require.NoError(t, err)
+	require.Nil(t, removedAddrsLogged(hook))
+	require.Equal(t, uint64(2), btca.Remaining())
+
+	// Only the new addresses are issued
+	for _, expected := range addresses[2:] {
+		addr, err := btca.NewAddress()
+		require.NoError(t, err)
+		require.Equal(t, expected, addr)
+	}
+
+	_, err = btca.NewAddress()
+	require.Equal(t, ErrDepositAddressEmpty, err)
+}
+
 func TestAddrManager(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
@@ -275,6 +382,10 @@ func TestAddrManager(t *testing.T) {
 	for _, a := range btcAddresses {
 		addrMap[a] = struct{}{}
 	}
+	available, err := addrManager.Available(typeB)
+	require.NoError(t, err)
+	require.True(t, available)
+
 	// run out all addresses of typeB
 	for i := 0; i < len(btcAddresses); i++ {
 		addr, err := addrManager.NewAddress(typeB)
@@ -286,6 +397,9 @@ func TestAddrManager(t *testing.T) {
 	//the address pool of typeB is empty
 	_, err = addrManager.NewAddress(typeB)
 	require.Equal(t, ErrDepositAddressEmpty, err)
+	available, err = addrManager.Available(typeB)
+	require.NoError(t, err)
+	require.False(t, available)
 
 	//set typeE address into map
 	addrMap = make(map[string]struct{})
@@ -358,4 +472,121 @@ func TestAddrManager(t *testing.T) {
 	//check not exists cointype
 	_, err = addrManager.NewAddress("OTHERTYPE")
 	require.Equal(t, ErrCoinTypeNotExists, err)
+	_, err = addrManager.Available("OTHERTYPE")
+	require.Equal(t, ErrCoinTypeNotExists, err)
+}
+
+func TestVerifyDisjointAddresses(t *testing.T) {
+	tt := []struct {
+		name      string
+		coinAddrs map[string][]string
+		err       string
+	}{
+		{
+			"disjoint",
+			map[string][]string{
+				scanner.CoinTypeBTC: {"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy"},
+				scanner.CoinTypeETH: {"0x12bc2e62a27f8940c373ef1edef7b615aeb045f3"},
+				scanner.CoinTypeSKY: {"2d755DQCskeFg7xKqpryCHiS78K91qD1syQ"},
+			},
+			"",
+		},
+		{
+			"no addresses",
+			nil,
+			"",
+		},
+		{
+			"overlapping",
+			map[string][]string{
+				scanner.CoinTypeBTC: {"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", "2d755DQCskeFg7xKqpryCHiS78K91qD1syQ"},
+				scanner.CoinTypeETH: {"0x12bc2e62a27f8940c373ef1edef7b615aeb045f3"},
+				scanner.CoinTypeSKY: {"2d755DQCskeFg7xKqpryCHiS78K91qD1syQ"},
+			},
+			"Deposit address `2d755DQCskeFg7xKqpryCHiS78K91qD1syQ` is listed for both BTC and SKY",
+		},
+		{
+			"overlapping waves",
+			map[string][]string{
+				scanner.CoinTypeWAVES:    {"3PAbb6EFQrgt9NhzQYPKAmtc2BoAyZbjcKv"},
+				scanner.CoinTypeWAVESMDL: {"3PAbb6EFQrgt9NhzQYPKAmtc2BoAyZbjcKv"},
+			},
+			"Deposit address `3PAbb6EFQrgt9NhzQYPKAmtc2BoAyZbjcKv` is listed for both MDL.life and WAVES",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifyDisjointAddresses(tc.coinAddrs)
+			if tc.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestNewAddressConcurrent(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	var addresses []string
+	for i := 0; i < 20; i++ {
+		addresses = append(addresses, fmt.Sprintf("addr-%d", i))
+	}
+
+	log, _ := testutil.NewLogger(t)
+
+	// Two Addrs drawing from the same bucket and address file, like the WAVES and WAVESMDL address managers
+	a1, err := NewAddrs(log, db, addresses, "test_bucket")
+	require.NoError(t, err)
+	a2, err := NewAddrs(log, db, addresses, "test_bucket")
+	require.NoError(t, err)
+
+	const nBinds = 50
+
+	var wg sync.WaitGroup
+	issued := make(chan string, nBinds)
+	errs := make(chan error, nBinds)
+	for i := 0; i < nBinds; i++ {
+		a := a1
+		if i%2 == 1 {
+			a = a2
+		}
+
+		wg.Add(1)
+		go func(a *Addrs) {
+			defer wg.Done()
+			addr, err := a.NewAddress()
+			if err != nil {
+				errs <- err
+				return
+			}
+			issued <- addr
+		}(a)
+	}
+	wg.Wait()
+	close(issued)
+	close(errs)
+
+	seen := make(map[string]struct{})
+	for addr := range issued {
+		_, ok := seen[addr]
+		require.False(t, ok, "address %s issued twice", addr)
+		seen[addr] = struct{}{}
+	}
+	require.Len(t, seen, len(addresses))
+
+	// The binds beyond the pool size fail cleanly
+	nErrs := 0
+	for err := range errs {
+		require.Equal(t, ErrDepositAddressEmpty, err)
+		nErrs++
+	}
+	require.Equal(t, nBinds-len(addresses), nErrs)
+
+	used, err := a1.used.GetAll()
+	require.NoError(t, err)
+	require.Len(t, used, len(addresses))
 }
@@ -4,37 +4,44 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
 
 	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
 	"github.com/sirupsen/logrus"
 
 	"github.com/MDLlife/MDL/src/cipher"
-	"github.com/MDLlife/teller/src/util"
 )
 
 const btcBucketKey = "used_btc_address"
 
-// NewBTCAddrs returns an Addrs loaded with BTC addresses
-func NewBTCAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader) (*Addrs, error) {
-	loader, err := loadBTCAddresses(addrsReader)
+// NewBTCAddrs returns an Addrs loaded with BTC addresses.
+// Addresses that don't match format are rejected before being decoded, a nil format disables the check
+func NewBTCAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader, format *regexp.Regexp) (*Addrs, error) {
+	loader, labels, err := loadBTCAddresses(addrsReader, format)
 	if err != nil {
 		log.WithError(err).Error("Load deposit bitcoin address list failed")
 		return nil, err
 	}
-	return NewAddrs(log, db, loader, btcBucketKey)
+	return newLabeledAddrs(log, db, loader, labels, btcBucketKey)
 }
 
-func loadBTCAddresses(addrsReader io.Reader) (addrs []string, err error) {
-	addrs, err = util.ReadLines(addrsReader)
+func loadBTCAddresses(addrsReader io.Reader, format *regexp.Regexp) (addrs []string, labels map[string]string, err error) {
+	addrs, labels, err = ReadAddresses(addrsReader)
 	if err != nil {
-		return nil, fmt.Errorf("Decode loaded address failed: %v", err)
+		return nil, nil, fmt.Errorf("Decode loaded address failed: %v", err)
+	}
+
+	if err := checkFormat(format, addrs); err != nil {
+		return nil, nil, err
 	}
 
 	if err := verifyBTCAddresses(addrs); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return addrs, nil
+	return addrs, labels, nil
 }
 
 func verifyBTCAddresses(addrs []string) error {
@@ -53,8 +60,27 @@ func verifyBTCAddresses(addrs []string) error {
 			return fmt.Errorf("Invalid deposit address `%s`: %v", addr, err)
 		}
 
+		// A SKY or MDL address is valid base58 too, but its checksum is not a bitcoin checksum
+		if err := verifyBTCAddress(addr); err != nil {
+			return fmt.Errorf("Deposit address `%s` is not a BTC address: %v", addr, err)
+		}
+
 		addrMap[addr] = struct{}{}
 	}
 
 	return nil
 }
+
+// verifyBTCAddress returns an error if addr is not a bitcoin mainnet address
+func verifyBTCAddress(addr string) error {
+	a, err := btcutil.DecodeAddress(addr, &chaincfg.MainNetParams)
+	if err != nil {
+		return err
+	}
+
+	if !a.IsForNet(&chaincfg.MainNetParams) {
+		return errors.New("not a mainnet address")
+	}
+
+	return nil
+}
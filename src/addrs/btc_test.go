@@ -23,7 +23,7 @@ func TestNewBTCAddrsAllValid(t *testing.T) {
 		1NvBwUKqUuH3HbPjHq417XhQ551RHhogso
 		1Kar4VK9HLkcQ99iWbs4LuCGEyDdTab5PC`
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Nil(t, err)
 	require.NotNil(t, btcAddrMgr)
@@ -43,7 +43,7 @@ func TestNewBtcAddrsContainsInvalid(t *testing.T) {
 
 	expectedErr := errors.New("Invalid deposit address `bad`: Invalid address length")
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -64,7 +64,7 @@ func TestNewBtcAddrsContainsDuplicated(t *testing.T) {
 
 	expectedErr := errors.New("Duplicate deposit address `14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj`")
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -81,9 +81,47 @@ func TestNewBTCAddrsContainsNull(t *testing.T) {
 
 	expectedErr := errors.New("No BTC addresses")
 
-	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
 	require.Nil(t, btcAddrMgr)
 }
+
+func TestNewBTCAddrsWrongCoinType(t *testing.T) {
+	tt := []struct {
+		name string
+		addr string
+		err  string
+	}{
+		{
+			name: "ETH address",
+			addr: "0xc0a51efd9c319dd60d93105ab317eb362017ecb9",
+			err:  "Invalid deposit address `0xc0a51efd9c319dd60d93105ab317eb362017ecb9`",
+		},
+		{
+			name: "SKY address",
+			addr: "2Dc7kXtwBLr8GL4TSZKFCJM3xqEwnqH6m67",
+			err:  "Deposit address `2Dc7kXtwBLr8GL4TSZKFCJM3xqEwnqH6m67` is not a BTC address",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+
+			addresses := `
+		1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB
+		` + tc.addr
+
+			btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
+
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+			require.Nil(t, btcAddrMgr)
+		})
+	}
+}
@@ -4,36 +4,42 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
 
-	"github.com/MDLlife/teller/src/util"
 	"github.com/boltdb/bolt"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/sirupsen/logrus"
 )
 
 const ethBucketKey = "used_eth_address"
 
-// NewETHAddrs returns an Addrs loaded with ETH addresses
-func NewETHAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader) (*Addrs, error) {
-	loader, err := loadETHAddresses(addrsReader)
+// NewETHAddrs returns an Addrs loaded with ETH addresses.
+// Addresses that don't match format are rejected before being decoded, a nil format disables the check
+func NewETHAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader, format *regexp.Regexp) (*Addrs, error) {
+	loader, labels, err := loadETHAddresses(addrsReader, format)
 	if err != nil {
 		log.WithError(err).Error("Load deposit ethereum address list failed")
 		return nil, err
 	}
-	return NewAddrs(log, db, loader, ethBucketKey)
+	return newLabeledAddrs(log, db, loader, labels, ethBucketKey)
 }
 
-func loadETHAddresses(addrsReader io.Reader) (addrs []string, err error) {
-	addrs, err = util.ReadLines(addrsReader)
+func loadETHAddresses(addrsReader io.Reader, format *regexp.Regexp) (addrs []string, labels map[string]string, err error) {
+	addrs, labels, err = ReadAddresses(addrsReader)
 	if err != nil {
-		return nil, fmt.Errorf("Decode loaded address failed: %v", err)
+		return nil, nil, fmt.Errorf("Decode loaded address failed: %v", err)
+	}
+
+	if err := checkFormat(format, addrs); err != nil {
+		return nil, nil, err
 	}
 
 	if err := verifyETHAddresses(addrs); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return addrs, nil
+	return addrs, labels, nil
 }
 
 // https://github.com/ethereum/go-ethereum/blob/2db97986460c57ba74a563d97a704a45a270df7d/common/icap.go
@@ -41,10 +47,13 @@ func validCheckSum(s string) error {
 	if len(s) != 42 {
 		return errors.New("Invalid address length")
 	}
-	if strings.HasPrefix(s, "0x") {
-		return nil
+	if !strings.HasPrefix(s, "0x") {
+		return errors.New("invalid address")
 	}
-	return errors.New("invalid address")
+	if !common.IsHexAddress(s) {
+		return errors.New("Invalid hex address")
+	}
+	return nil
 }
 
 func verifyETHAddresses(addrs []string) error {
@@ -22,7 +22,7 @@ func TestNewETHAddrsAllValid(t *testing.T) {
 		0x5405f65a71342609249bb347505a4029c85ee88b
 		0x01db29b6d512902aa82571267609f14187aa8aa8`
 
-	ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Nil(t, err)
 	require.NotNil(t, ethAddrMgr)
@@ -43,7 +43,7 @@ func TestNewEthAddrsContainsInvalid(t *testing.T) {
 
 	expectedErr := errors.New("Invalid deposit address `bad`: Invalid address length")
 
-	ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -64,7 +64,7 @@ func TestNewEthAddrsContainsDuplicated(t *testing.T) {
 
 	expectedErr := errors.New("Duplicate deposit address `0xc0a51efd9c319dd60d93105ab317eb362017ecb9`")
 
-	ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -81,9 +81,47 @@ func TestNewETHAddrsContainsNull(t *testing.T) {
 
 	expectedErr := errors.New("No ETH addresses")
 
-	ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
 	require.Nil(t, ethAddrMgr)
 }
+
+func TestNewETHAddrsWrongCoinType(t *testing.T) {
+	tt := []struct {
+		name string
+		addr string
+		err  string
+	}{
+		{
+			name: "BTC address",
+			addr: "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB",
+			err:  "Invalid deposit address `1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB`: Invalid address length",
+		},
+		{
+			name: "not hex",
+			addr: "0xSKYaddrSKYaddrSKYaddrSKYaddrSKYaddrSKYad",
+			err:  "Invalid deposit address `0xSKYaddrSKYaddrSKYaddrSKYaddrSKYaddrSKYad`: Invalid hex address",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+
+			addresses := `
+		0xc0a51efd9c319dd60d93105ab317eb362017ecb9
+		` + tc.addr
+
+			ethAddrMgr, err := NewETHAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
+
+			require.Error(t, err)
+			require.Equal(t, errors.New(tc.err), err)
+			require.Nil(t, ethAddrMgr)
+		})
+	}
+}
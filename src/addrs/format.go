@@ -0,0 +1,76 @@
+package addrs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/MDLlife/teller/src/scanner"
+)
+
+// FormatMDL is the key of the MDL address format in Formats
+const FormatMDL = "MDL"
+
+// ErrAddressFormat is returned when an address doesn't match the format of its coin type
+var ErrAddressFormat = errors.New("address does not match the expected format")
+
+// Formats maps a coin type, or FormatMDL, to the regex its addresses must match.
+// They are a cheap pre-filter rejecting malformed addresses before they are decoded,
+// an address that matches is still fully verified
+type Formats map[string]*regexp.Regexp
+
+// NewFormats compiles the regexes of teller.address_formats, keyed by coin type or FormatMDL.
+// A regex must match the whole address
+func NewFormats(formats map[string]string) (Formats, error) {
+	f := make(Formats, len(formats))
+
+	for key, expr := range formats {
+		if key != FormatMDL && !isCoinType(key) {
+			return nil, fmt.Errorf("Address format of unknown coin type %s", key)
+		}
+
+		re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", expr))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid address format of %s: %v", key, err)
+		}
+
+		f[key] = re
+	}
+
+	return f, nil
+}
+
+// Check returns ErrAddressFormat if addr doesn't match the format of key, a coin type or FormatMDL.
+// Any address passes if key has no format
+func (f Formats) Check(key, addr string) error {
+	re, ok := f[key]
+	if !ok || re.MatchString(addr) {
+		return nil
+	}
+
+	return ErrAddressFormat
+}
+
+// checkFormat returns an error for the first of addrs that doesn't match format. A nil format disables the check
+func checkFormat(format *regexp.Regexp, addrs []string) error {
+	if format == nil {
+		return nil
+	}
+
+	for _, addr := range addrs {
+		if !format.MatchString(addr) {
+			return fmt.Errorf("Invalid deposit address `%s`: %v", addr, ErrAddressFormat)
+		}
+	}
+
+	return nil
+}
+
+func isCoinType(coinType string) bool {
+	for _, ct := range scanner.GetCoinTypes() {
+		if ct == coinType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package addrs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+func TestNewFormats(t *testing.T) {
+	f, err := NewFormats(map[string]string{
+		FormatMDL:           "[1-9A-HJ-NP-Za-km-z]{25,35}",
+		scanner.CoinTypeETH: "0x[0-9a-fA-F]{40}",
+	})
+	require.NoError(t, err)
+	require.Len(t, f, 2)
+
+	_, err = NewFormats(map[string]string{
+		"FOO": ".*",
+	})
+	require.Error(t, err)
+	require.Equal(t, "Address format of unknown coin type FOO", err.Error())
+
+	_, err = NewFormats(map[string]string{
+		scanner.CoinTypeBTC: "[",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid address format of BTC")
+
+	// No formats
+	f, err = NewFormats(nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Check(FormatMDL, "garbage"))
+}
+
+func TestFormatsCheck(t *testing.T) {
+	f, err := NewFormats(map[string]string{
+		FormatMDL:           "[1-9A-HJ-NP-Za-km-z]{25,35}",
+		scanner.CoinTypeETH: "0x[0-9a-fA-F]{40}",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, f.Check(FormatMDL, "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW"))
+	require.Equal(t, ErrAddressFormat, f.Check(FormatMDL, "not an address!"))
+	require.Equal(t, ErrAddressFormat, f.Check(FormatMDL, ""))
+
+	// The format must match the whole address
+	require.Equal(t, ErrAddressFormat, f.Check(FormatMDL, "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW "))
+	require.Equal(t, ErrAddressFormat, f.Check(scanner.CoinTypeETH, "0xc0a51efd9c319dd60d93105ab317eb362017ecb9ff"))
+	require.NoError(t, f.Check(scanner.CoinTypeETH, "0xc0a51efd9c319dd60d93105ab317eb362017ecb9"))
+
+	// Coin types without a format are not checked
+	require.NoError(t, f.Check(scanner.CoinTypeBTC, "garbage"))
+}
+
+func TestNewBTCAddrsFormat(t *testing.T) {
+	f, err := NewFormats(map[string]string{
+		scanner.CoinTypeBTC: "[13][1-9A-HJ-NP-Za-km-z]{25,34}",
+	})
+	require.NoError(t, err)
+
+	tt := []struct {
+		name        string
+		addresses   string
+		err         string
+		formatError bool
+	}{
+		{
+			name: "valid",
+			addresses: `
+		1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB
+		14FG8vQnmK6B7YbLSr6uC5wfGY78JFNCYg`,
+		},
+		{
+			name: "garbage rejected by the format",
+			addresses: `
+		1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB
+		0xc0a51efd9c319dd60d93105ab317eb362017ecb9`,
+			err:         "Invalid deposit address `0xc0a51efd9c319dd60d93105ab317eb362017ecb9`",
+			formatError: true,
+		},
+		{
+			name: "matching the format but not a BTC address",
+			addresses: `
+		1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB
+		1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLC`,
+			err: "Invalid deposit address `1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLC`",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+
+			btcAddrMgr, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(tc.addresses)), f[scanner.CoinTypeBTC])
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.NotNil(t, btcAddrMgr)
+				return
+			}
+
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+			require.Nil(t, btcAddrMgr)
+
+			// An address matching the format is fully decoded
+			if tc.formatError {
+				require.Contains(t, err.Error(), ErrAddressFormat.Error())
+			} else {
+				require.NotContains(t, err.Error(), ErrAddressFormat.Error())
+			}
+		})
+	}
+}
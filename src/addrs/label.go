@@ -0,0 +1,46 @@
+package addrs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/MDLlife/teller/src/util"
+)
+
+// LabeledAddrGenerator is an AddrGenerator that can issue a deposit address by its label
+type LabeledAddrGenerator interface {
+	AddrGenerator
+	NewLabeledAddress(label string) (string, error)
+}
+
+// ReadAddresses reads a deposit address file, one address per line. An address can be followed by a label,
+// separated by whitespace, e.g. "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB acct-42".
+// Returns the addresses in file order, and the address of each label
+func ReadAddresses(r io.Reader) ([]string, map[string]string, error) {
+	lines, err := util.ReadLines(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addrs := make([]string, 0, len(lines))
+	labels := make(map[string]string)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 1:
+		case 2:
+			label := fields[1]
+			if addr, ok := labels[label]; ok && addr != fields[0] {
+				return nil, nil, fmt.Errorf("Label `%s` is used by both `%s` and `%s`", label, addr, fields[0])
+			}
+			labels[label] = fields[0]
+		default:
+			return nil, nil, fmt.Errorf("Invalid line `%s`, expected a deposit address and an optional label", line)
+		}
+
+		addrs = append(addrs, fields[0])
+	}
+
+	return addrs, labels, nil
+}
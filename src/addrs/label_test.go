@@ -0,0 +1,76 @@
+package addrs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+func TestReadAddresses(t *testing.T) {
+	addrs, labels, err := ReadAddresses(strings.NewReader(`
+	14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj
+	1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy   acct-42
+	1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap	acct-43`))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj",
+		"1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+		"1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap",
+	}, addrs)
+	require.Equal(t, map[string]string{
+		"acct-42": "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy",
+		"acct-43": "1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap",
+	}, labels)
+
+	_, _, err = ReadAddresses(strings.NewReader("14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj acct 42"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected a deposit address and an optional label")
+
+	_, _, err = ReadAddresses(strings.NewReader(`
+	14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj acct-42
+	1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy acct-42`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Label `acct-42` is used by both")
+}
+
+func TestNewLabeledAddress(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	btca, err := NewBTCAddrs(log, db, bytes.NewReader([]byte(`
+	14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj
+	1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy acct-42
+	1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap acct-43`)), nil)
+	require.NoError(t, err)
+
+	am := NewAddrManager()
+	require.NoError(t, am.PushGenerator(btca, scanner.CoinTypeBTC))
+
+	// The labeled address is issued out of order
+	addr, err := am.NewLabeledAddress(scanner.CoinTypeBTC, "acct-43")
+	require.NoError(t, err)
+	require.Equal(t, "1JrzSx8a9FVHHCkUFLB2CHULpbz4dTz5Ap", addr)
+
+	// An unknown label falls back to the next available address
+	addr, err = am.NewLabeledAddress(scanner.CoinTypeBTC, "acct-99")
+	require.NoError(t, err)
+	require.Equal(t, "14JwrdSxYXPxSi6crLKVwR4k2dbjfVZ3xj", addr)
+
+	// A label whose address was issued already falls back too
+	addr, err = am.NewLabeledAddress(scanner.CoinTypeBTC, "acct-43")
+	require.NoError(t, err)
+	require.Equal(t, "1JNonvXRyZvZ4ZJ9PE8voyo67UQN1TpoGy", addr)
+
+	_, err = am.NewLabeledAddress(scanner.CoinTypeBTC, "acct-42")
+	require.Equal(t, ErrDepositAddressEmpty, err)
+
+	_, err = am.NewLabeledAddress(scanner.CoinTypeETH, "acct-42")
+	require.Equal(t, ErrCoinTypeNotExists, err)
+}
@@ -3,10 +3,10 @@ package addrs
 import (
 	"fmt"
 	"io"
+	"regexp"
 
 	"errors"
 
-	"github.com/MDLlife/teller/src/util"
 	"github.com/boltdb/bolt"
 	"github.com/sirupsen/logrus"
 	"github.com/skycoin/skycoin/src/cipher"
@@ -14,27 +14,32 @@ import (
 
 const skyBucketKey = "used_sky_address"
 
-// NewSKYAddrs returns an Addrs loaded with SKY addresses
-func NewSKYAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader) (*Addrs, error) {
-	loader, err := loadSKYAddresses(addrsReader)
+// NewSKYAddrs returns an Addrs loaded with SKY addresses.
+// Addresses that don't match format are rejected before being decoded, a nil format disables the check
+func NewSKYAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader, format *regexp.Regexp) (*Addrs, error) {
+	loader, labels, err := loadSKYAddresses(addrsReader, format)
 	if err != nil {
 		log.WithError(err).Error("Load deposit skycoin address list failed")
 		return nil, err
 	}
-	return NewAddrs(log, db, loader, skyBucketKey)
+	return newLabeledAddrs(log, db, loader, labels, skyBucketKey)
 }
 
-func loadSKYAddresses(addrsReader io.Reader) (addrs []string, err error) {
-	addrs, err = util.ReadLines(addrsReader)
+func loadSKYAddresses(addrsReader io.Reader, format *regexp.Regexp) (addrs []string, labels map[string]string, err error) {
+	addrs, labels, err = ReadAddresses(addrsReader)
 	if err != nil {
-		return nil, fmt.Errorf("Decode loaded address failed: %v", err)
+		return nil, nil, fmt.Errorf("Decode loaded address failed: %v", err)
+	}
+
+	if err := checkFormat(format, addrs); err != nil {
+		return nil, nil, err
 	}
 
 	if err := verifySKYAddresses(addrs); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return addrs, nil
+	return addrs, labels, nil
 }
 
 // func validSKYCheckSum(s string) error {
@@ -66,6 +71,11 @@ func verifySKYAddresses(addrs []string) error {
 			return fmt.Errorf("Invalid deposit address `%s`: %v", addr, err)
 		}
 
+		// Both are base58, a misplaced BTC address would be scanned on the wrong chain
+		if verifyBTCAddress(addr) == nil {
+			return fmt.Errorf("Deposit address `%s` is a BTC address, not a SKY address", addr)
+		}
+
 		addrMap[addr] = struct{}{}
 	}
 
@@ -21,7 +21,7 @@ func TestNewSKYAddrsAllValid(t *testing.T) {
 		fyqX5YuwXMUs4GEUE3LjLyhrqvNztFHQ4B
 		2Dc7kXtwBLr8GL4TSZKFCJM3xqEwnqH6m67`
 
-	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Nil(t, err)
 	require.NotNil(t, skyAddrMgr)
@@ -39,7 +39,7 @@ func TestNewSKYAddrsContainsInvalid(t *testing.T) {
 
 	expectedErr := errors.New("Invalid deposit address `bad`: Invalid address length")
 
-	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -60,7 +60,7 @@ func TestNewSKYAddrsContainsDuplicated(t *testing.T) {
 
 	expectedErr := errors.New("Duplicate deposit address `cBnu9sUvv12dovBmjQKTtfE4rbjMmf3fzW`")
 
-	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -77,9 +77,26 @@ func TestNewSKYAddrsContainsNull(t *testing.T) {
 
 	expectedErr := errors.New("No SKY addresses")
 
-	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
 	require.Nil(t, skyAddrMgr)
 }
+
+func TestNewSKYAddrsContainsBTCAddress(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	addresses := `
+		CDLrMvPcmpdido8cbSFNNgzQXdC97TsgEQ
+		1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB`
+
+	skyAddrMgr, err := NewSKYAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1PZ63K3G4gZP6A6E2TTbBwxT5bFQGL2TLB")
+	require.Nil(t, skyAddrMgr)
+}
@@ -41,6 +41,25 @@ func (s *Store) Put(addr string) error {
 	})
 }
 
+// Claim marks an address as used, unless it is already used, in a single transaction.
+// Returns false if the address was already used, e.g. issued by another Addrs sharing the bucket
+func (s *Store) Claim(addr string) (bool, error) {
+	claimed := false
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		used, err := dbutil.BucketHasKey(tx, s.BucketKey, addr)
+		if err != nil || used {
+			return err
+		}
+
+		claimed = true
+		return tx.Bucket(s.BucketKey).Put([]byte(addr), []byte(""))
+	}); err != nil {
+		return false, err
+	}
+
+	return claimed, nil
+}
+
 // IsUsed checks if address is mark as used
 func (s *Store) IsUsed(addr string) (bool, error) {
 	exists := false
@@ -54,3 +73,18 @@ func (s *Store) IsUsed(addr string) (bool, error) {
 
 	return exists, nil
 }
+
+// GetAll returns all addresses marked as used
+func (s *Store) GetAll() ([]string, error) {
+	var addrs []string
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, s.BucketKey, func(k, v []byte) error {
+			addrs = append(addrs, string(k))
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return addrs, nil
+}
@@ -52,6 +52,32 @@ func TestStorePut(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestStoreClaim(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db, "test_bucket")
+	require.NoError(t, err)
+
+	claimed, err := s.Claim("a1")
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	used, err := s.IsUsed("a1")
+	require.NoError(t, err)
+	require.True(t, used)
+
+	// An address can only be claimed once
+	claimed, err = s.Claim("a1")
+	require.NoError(t, err)
+	require.False(t, claimed)
+
+	require.NoError(t, s.Put("a2"))
+	claimed, err = s.Claim("a2")
+	require.NoError(t, err)
+	require.False(t, claimed)
+}
+
 func TestStoreGet(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
@@ -84,3 +110,22 @@ func TestStoreGet(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, used)
 }
+
+func TestStoreGetAll(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(db, "test_bucket")
+	require.NoError(t, err)
+
+	addrs, err := s.GetAll()
+	require.NoError(t, err)
+	require.Empty(t, addrs)
+
+	require.Nil(t, s.Put("a2"))
+	require.Nil(t, s.Put("a1"))
+
+	addrs, err = s.GetAll()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a1", "a2"}, addrs)
+}
@@ -3,10 +3,10 @@ package addrs
 import (
 	"fmt"
 	"io"
+	"regexp"
 
 	"errors"
 
-	"github.com/MDLlife/teller/src/util"
 	"github.com/boltdb/bolt"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/sirupsen/logrus"
@@ -17,26 +17,33 @@ import (
 
 const wavesBucketKey = "used_waves_address"
 
-// NewWAVESAddrs returns an Addrs loaded with WAVES addresses
-func NewWAVESAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader) (*Addrs, error) {
-	loader, err := loadWAVESAddresses(addrsReader)
+// NewWAVESAddrs returns an Addrs loaded with WAVES addresses.
+// WAVES and MDL.life deposit addresses share the used address bucket, so the issued addresses
+// of one are logged as missing from the address file of the other.
+// Addresses that don't match format are rejected before being decoded, a nil format disables the check
+func NewWAVESAddrs(log logrus.FieldLogger, db *bolt.DB, addrsReader io.Reader, format *regexp.Regexp) (*Addrs, error) {
+	loader, labels, err := loadWAVESAddresses(addrsReader, format)
 	if err != nil {
 		return nil, err
 	}
-	return NewAddrs(log, db, loader, wavesBucketKey)
+	return newLabeledAddrs(log, db, loader, labels, wavesBucketKey)
 }
 
-func loadWAVESAddresses(addrsReader io.Reader) (addrs []string, err error) {
-	addrs, err = util.ReadLines(addrsReader)
+func loadWAVESAddresses(addrsReader io.Reader, format *regexp.Regexp) (addrs []string, labels map[string]string, err error) {
+	addrs, labels, err = ReadAddresses(addrsReader)
 	if err != nil {
-		return nil, fmt.Errorf("Decode loaded address failed: %v", err)
+		return nil, nil, fmt.Errorf("Decode loaded address failed: %v", err)
+	}
+
+	if err := checkFormat(format, addrs); err != nil {
+		return nil, nil, err
 	}
 
 	if err := verifyWAVESAddresses(addrs); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return addrs, nil
+	return addrs, labels, nil
 }
 
 // func validWAVESCheckSum(s string) error {
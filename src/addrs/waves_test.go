@@ -21,7 +21,7 @@ func TestNewWAVESAddrsAllValid(t *testing.T) {
 		3PFTGLDvE7rQfWtgSzBt7NS4NXXMQ1gUufs
 		3P9dUze9nHRdfoKhFrZYKdsSpwW9JoE6Mzf`
 
-	wavesAddrMgr, err := NewWAVESAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	wavesAddrMgr, err := NewWAVESAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Nil(t, err)
 	require.NotNil(t, wavesAddrMgr)
@@ -39,7 +39,7 @@ func TestNewWAVESAddrsContainsInvalid(t *testing.T) {
 
 	expectedErr := errors.New("Invalid deposit address `bad`: Invalid address length")
 
-	wavesAddrMgr, err := NewWAVESAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	wavesAddrMgr, err := NewWAVESAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -60,7 +60,7 @@ func TestNewWAVESAddrsContainsDuplicated(t *testing.T) {
 
 	expectedErr := errors.New("Duplicate deposit address `3P5DKriHBPkeUN1GJXsq5S2tPwXqxw2f1Nr`")
 
-	wavesAddrMgr, err := NewWAVESAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	wavesAddrMgr, err := NewWAVESAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -77,7 +77,7 @@ func TestNewWAVESAddrsContainsNull(t *testing.T) {
 
 	expectedErr := errors.New("No WAVES addresses")
 
-	wavesAddrMgr, err := NewWAVESAddrs(log, db, bytes.NewReader([]byte(addresses)))
+	wavesAddrMgr, err := NewWAVESAddrs(log, db, bytes.NewReader([]byte(addresses)), nil)
 
 	require.Error(t, err)
 	require.Equal(t, expectedErr, err)
@@ -2,17 +2,28 @@
 package config
 
 import (
+	"compress/gzip"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
+	"net/mail"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/spf13/viper"
 
+	"github.com/MDLlife/MDL/src/util/droplet"
 	"github.com/MDLlife/MDL/src/wallet"
+	"github.com/MDLlife/teller/src/util/httputil"
+	"github.com/MDLlife/teller/src/util/logger"
 	"github.com/MDLlife/teller/src/util/mathutil"
 	"github.com/MDLlife/MDL/src/params"
 )
@@ -24,9 +35,34 @@ const (
 	BuyMethodPassthrough = "passthrough"
 )
 
+const (
+	// RateFormatFixed renders MDL amounts with fixed precision, e.g. "100.000000"
+	RateFormatFixed = "fixed"
+	// RateFormatTrim renders MDL amounts with trailing zeros trimmed, e.g. "100"
+	RateFormatTrim = "trim"
+)
+
+const (
+	// BindBalanceCheckWarn logs the deposit addresses that already hold funds when they are bound
+	BindBalanceCheckWarn = "warn"
+	// BindBalanceCheckReject skips the deposit addresses that already hold funds, another address is bound instead
+	BindBalanceCheckReject = "reject"
+)
+
+const (
+	// CoinTypePlaceholder is replaced with the coin type in Teller.CoinDisabledMessage and Teller.NoScannerMessage
+	CoinTypePlaceholder = "{coin_type}"
+	// DefaultCoinDisabledMessage is returned by the bind API for a coin type that is not enabled
+	DefaultCoinDisabledMessage = "Oops, there seems to be an issue. The selected coin type " + CoinTypePlaceholder + " is not enabled. We are working on a fix, please try again in a couple of hours"
+	// DefaultNoScannerMessage is returned by the bind API for an enabled coin type whose scanner is not running
+	DefaultNoScannerMessage = "Deposits of " + CoinTypePlaceholder + " can't be processed at the moment. We are working on a fix, please try again in a couple of hours"
+)
+
 var (
 	// ErrInvalidBuyMethod is returned if BindAddress is called with an invalid buy method
 	ErrInvalidBuyMethod = errors.New("Invalid buy method")
+	// ErrInvalidRateFormat is returned for an unknown rate display format
+	ErrInvalidRateFormat = errors.New("Invalid rate format")
 )
 
 // ValidateBuyMethod returns an error if a buy method string is invalid
@@ -39,6 +75,17 @@ func ValidateBuyMethod(m string) error {
 	}
 }
 
+// ValidateRateFormat returns an error if a rate format string is invalid.
+// An empty string is treated as RateFormatFixed
+func ValidateRateFormat(f string) error {
+	switch f {
+	case "", RateFormatFixed, RateFormatTrim:
+		return nil
+	default:
+		return ErrInvalidRateFormat
+	}
+}
+
 // Config represents the configuration root
 type Config struct {
 	// Enable debug logging
@@ -47,8 +94,22 @@ type Config struct {
 	Profile bool `mapstructure:"profile"`
 	// Where log is saved
 	LogFilename string `mapstructure:"logfile"`
+	// Log line format, "text" or "json"
+	LogFormat string `mapstructure:"log_format"`
 	// Where database is saved, inside the ~/.teller-mdl data directory
 	DBFilename string `mapstructure:"dbfile"`
+	// Save deposit records and bindings gzipped in the database. Records saved uncompressed before are compressed at startup
+	CompressRecords bool `mapstructure:"compress_records"`
+	// Serve status and config queries only. Scanning, sending and binding are disabled,
+	// and the database is opened read-only, e.g. a replica of another teller's database
+	ReadOnly bool `mapstructure:"read_only"`
+	// How often the scanners try to scan for blocks, unless their own scan_period is set
+	ScanPeriod time.Duration `mapstructure:"scan_period"`
+	// Mark the deposits whose coin type doesn't match the scanner that sent them as processed when dropping them.
+	// Otherwise they stay unprocessed and are sent again when teller restarts
+	DiscardUnknownCoinTypes bool `mapstructure:"discard_unknown_coin_types"`
+	// How often to compare the balances of the deposit addresses on the blockchain to their recorded deposits. 0 disables
+	BalanceReconcileInterval time.Duration `mapstructure:"balance_reconcile_interval"`
 
 	// Path of BTC addresses JSON file
 	BtcAddresses string `mapstructure:"btc_addresses"`
@@ -76,12 +137,18 @@ type Config struct {
 	WavesScanner    WavesScanner `mapstructure:"waves_scanner"`
 	WavesMDLScanner WavesScanner `mapstructure:"waves_mdl_scanner"`
 
+	BtcSweep BtcSweep `mapstructure:"btc_sweep"`
+
 	MDLExchanger MDLExchanger `mapstructure:"mdl_exchanger"`
 
 	Web Web `mapstructure:"web"`
 
 	AdminPanel AdminPanel `mapstructure:"admin_panel"`
 
+	Events Events `mapstructure:"events"`
+
+	Email Email `mapstructure:"email"`
+
 	Dummy Dummy `mapstructure:"dummy"`
 }
 
@@ -92,30 +159,214 @@ type SupportedCrypto struct {
 	Enabled         bool   `json:"enabled"`
 	ExchangeRateUSD string `json:"exchange_rate_usd"`
 	ExchangeRate    string `json:"exchange_rate"`
+
+	// ExchangeRate normalized to a decimal string, e.g. "0.5" for "1/2" or "50%". Empty if the rate is not set
+	ExchangeRateDecimal string `json:"exchange_rate_decimal"`
+
+	// The USD rate feed has no rate for the coin newer than mdl_exchanger.usd_rate_max_age.
+	// ExchangeRateUSD is the configured fallback rate, or empty if there is none
+	RateStale bool `json:"rate_stale"`
+
+	Featured bool `json:"featured"` // listed first, see MDLExchanger.Featured
+
+	// Better rates for larger deposits, in increasing order of min amount
+	RateTiers []RateTier `json:"rate_tiers,omitempty"`
 }
 
 // Teller config for teller
 type Teller struct {
 	// Max number of btc addresses a mdl address can bind
 	MaxBoundAddresses int `mapstructure:"max_bound_addrs"`
+	// Max number of addresses of a coin type a mdl address can bind, keyed by coin type.
+	// Overrides MaxBoundAddresses for the coin types it lists, 0 is unlimited
+	MaxBoundAddressesPerCoin map[string]int `mapstructure:"max_bound_addrs_per_coin"`
 	// Allow address binding
 	BindEnabled bool `mapstructure:"bind_enabled"`
 	// Currently supported purchase methods
 	AndroidEnabled bool `mapstructure:"android_enabled"`
+	// Allow address binding while mdl_exchanger.send_enabled is false
+	AllowPrebind bool `mapstructure:"allow_prebind"`
+	// Alternative coin_type names accepted by the bind API, e.g. "bitcoin" = "BTC"
+	CoinTypeAliases map[string]string `mapstructure:"coin_type_aliases"`
+	// Regexes that the deposit addresses of a coin type, or MDL addresses under the key "MDL", must match entirely.
+	// A cheap pre-filter rejecting malformed addresses before they are decoded
+	AddressFormats map[string]string `mapstructure:"address_formats"`
+	// Error message returned by the bind API for a coin type that is not enabled.
+	// CoinTypePlaceholder is replaced with the coin type
+	CoinDisabledMessage string `mapstructure:"coin_disabled_message"`
+	// Error message returned by the bind API for an enabled coin type whose scanner is not running,
+	// e.g. because it failed to start. CoinTypePlaceholder is replaced with the coin type
+	NoScannerMessage string `mapstructure:"no_scanner_message"`
+	// File of mdl addresses that are not allowed to bind, one per line. Takes precedence over MDLAddressAllowlist
+	MDLAddressBlocklist string `mapstructure:"mdl_address_blocklist"`
+	// File of the only mdl addresses that are allowed to bind, one per line
+	MDLAddressAllowlist string `mapstructure:"mdl_address_allowlist"`
+	// How many times a bind is retried with a new deposit address if the issued address turns out to be bound already
+	BindRetries int `mapstructure:"bind_retries"`
+	// Binds are refused while the confirmed balance of the MDL hot wallet is below this, as a decimal string. Empty disables
+	MinBindBalance string `mapstructure:"min_bind_balance"`
+	// Check that an ETH deposit address holds no funds before binding it, to detect reused addresses.
+	// BindBalanceCheckWarn or BindBalanceCheckReject, empty disables
+	EthBindBalanceCheck string `mapstructure:"eth_bind_balance_check"`
+	// Minimum time between two binds of the same mdl address, 0 disables
+	BindCooldown time.Duration `mapstructure:"bind_cooldown"`
+}
+
+// MinBindBalanceDroplets returns MinBindBalance in droplets, or 0 if MinBindBalance is empty
+func (t Teller) MinBindBalanceDroplets() (uint64, error) {
+	if t.MinBindBalance == "" {
+		return 0, nil
+	}
+
+	return droplet.FromString(t.MinBindBalance)
+}
+
+// FormatCoinDisabledMessage returns the CoinDisabledMessage for a coin type,
+// or DefaultCoinDisabledMessage if CoinDisabledMessage is not set
+func (t Teller) FormatCoinDisabledMessage(coinType string) string {
+	msg := t.CoinDisabledMessage
+	if msg == "" {
+		msg = DefaultCoinDisabledMessage
+	}
+
+	return strings.Replace(msg, CoinTypePlaceholder, coinType, -1)
+}
+
+// FormatNoScannerMessage returns the NoScannerMessage for a coin type,
+// or DefaultNoScannerMessage if NoScannerMessage is not set
+func (t Teller) FormatNoScannerMessage(coinType string) string {
+	msg := t.NoScannerMessage
+	if msg == "" {
+		msg = DefaultNoScannerMessage
+	}
+
+	return strings.Replace(msg, CoinTypePlaceholder, coinType, -1)
 }
 
 // MDLRPC config for MDL daemon node RPC
 type MDLRPC struct {
 	Address string `mapstructure:"address"`
+	// Number of consecutive failed payouts that opens the circuit breaker. 0 disables the circuit breaker
+	BreakerThreshold int `mapstructure:"breaker_threshold"`
+	// How long the circuit breaker stays open before a payout is attempted again
+	BreakerCooldown time.Duration `mapstructure:"breaker_cooldown"`
+	// Teller refuses to start if the mdl node is older than this version. Empty skips the check
+	MinNodeVersion string `mapstructure:"min_node_version"`
 }
 
 // BtcRPC config for btcrpc
 type BtcRPC struct {
-	Server  string `mapstructure:"server"`
-	User    string `mapstructure:"user"`
-	Pass    string `mapstructure:"pass"`
-	Cert    string `mapstructure:"cert"`
-	Enabled bool   `mapstructure:"enabled"`
+	Server string `mapstructure:"server"`
+	User   string `mapstructure:"user"`
+	Pass   string `mapstructure:"pass"`
+	// Path of the btcd RPC certificate file
+	Cert string `mapstructure:"cert"`
+	// PEM encoded btcd RPC certificate, an alternative to cert
+	CertPEM string `mapstructure:"cert_pem"`
+	// Connect to btcd without TLS, cert and cert_pem must be empty
+	DisableTLS bool `mapstructure:"disable_tls"`
+	Enabled    bool `mapstructure:"enabled"`
+}
+
+// Validate validates the BtcRPC config
+func (c BtcRPC) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Server == "" {
+		return errors.New("btc_rpc.server missing")
+	}
+	if c.User == "" {
+		return errors.New("btc_rpc.user missing")
+	}
+	if c.Pass == "" {
+		return errors.New("btc_rpc.pass missing")
+	}
+
+	if c.DisableTLS {
+		if c.Cert != "" || c.CertPEM != "" {
+			return errors.New("btc_rpc.cert and btc_rpc.cert_pem must be empty when btc_rpc.disable_tls is true")
+		}
+		return nil
+	}
+
+	switch {
+	case c.Cert == "" && c.CertPEM == "":
+		return errors.New("btc_rpc.cert or btc_rpc.cert_pem is required unless btc_rpc.disable_tls is true")
+	case c.Cert != "" && c.CertPEM != "":
+		return errors.New("only one of btc_rpc.cert and btc_rpc.cert_pem may be set")
+	case c.Cert != "":
+		if _, err := os.Stat(c.Cert); os.IsNotExist(err) {
+			return errors.New("btc_rpc.cert file does not exist")
+		}
+	default:
+		if block, _ := pem.Decode([]byte(c.CertPEM)); block == nil {
+			return errors.New("btc_rpc.cert_pem is not a PEM encoded certificate")
+		}
+	}
+
+	return nil
+}
+
+// Certificates returns the PEM encoded btcd RPC certificate, read from the cert file or else taken from cert_pem.
+// Returns nil if disable_tls is true
+func (c BtcRPC) Certificates() ([]byte, error) {
+	switch {
+	case c.DisableTLS:
+		return nil, nil
+	case c.CertPEM != "":
+		return []byte(c.CertPEM), nil
+	default:
+		certs, err := ioutil.ReadFile(c.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read btc_rpc.cert %s: %v", c.Cert, err)
+		}
+		return certs, nil
+	}
+}
+
+// BtcSweep config for sweeping BTC deposits to a cold wallet, triggered from the admin panel
+type BtcSweep struct {
+	// Address that confirmed deposits are swept to. Sweeping is disabled if empty
+	ColdAddress string `mapstructure:"cold_address"`
+	// Host:port of the btcwallet RPC that holds the deposit address keys, connected to with the btc_rpc user, pass and cert
+	WalletServer string `mapstructure:"wallet_server"`
+	// Only deposits with at least this many confirmations are swept
+	MinConfirmations int64 `mapstructure:"min_confirmations"`
+	// Fee of the sweep transaction, in satoshis per byte
+	FeePerByte int64 `mapstructure:"fee_per_byte"`
+}
+
+// HTTPTransport tunes the connections of an HTTP RPC client to its node. Zero values keep Go's defaults
+type HTTPTransport struct {
+	// Maximum number of idle connections kept open, in total and to each host
+	MaxIdleConns        int `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int `mapstructure:"max_idle_conns_per_host"`
+	// How long an idle connection is kept open before it is closed
+	IdleConnTimeout time.Duration `mapstructure:"idle_conn_timeout"`
+	// Period of the TCP keep-alive probes of the connections. Negative disables them
+	KeepAlive time.Duration `mapstructure:"keep_alive"`
+}
+
+// IsZero returns true if no transport option is set
+func (t HTTPTransport) IsZero() bool {
+	return t == HTTPTransport{}
+}
+
+// validate returns the errors of the transport options of the config section key
+func (t HTTPTransport) validate(key string) []string {
+	var errs []string
+	if t.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Sprintf("%s.max_idle_conns can't be negative", key))
+	}
+	if t.MaxIdleConnsPerHost < 0 {
+		errs = append(errs, fmt.Sprintf("%s.max_idle_conns_per_host can't be negative", key))
+	}
+	if t.IdleConnTimeout < 0 {
+		errs = append(errs, fmt.Sprintf("%s.idle_conn_timeout can't be negative", key))
+	}
+	return errs
 }
 
 // EthRPC config for ethrpc
@@ -123,6 +374,12 @@ type EthRPC struct {
 	Server  string `mapstructure:"server"`
 	Port    string `mapstructure:"port"`
 	Enabled bool   `mapstructure:"enabled"`
+
+	// URL of an etherscan-like block explorer API to scan instead of a geth node, server and port are not used if set
+	ExplorerURL    string `mapstructure:"explorer_url"`
+	ExplorerAPIKey string `mapstructure:"explorer_api_key"`
+
+	HTTPTransport `mapstructure:",squash"`
 }
 
 // SkyRPC config for skyrpc
@@ -130,6 +387,8 @@ type SkyRPC struct {
 	Server  string `mapstructure:"server"`
 	Port    string `mapstructure:"port"`
 	Enabled bool   `mapstructure:"enabled"`
+
+	HTTPTransport `mapstructure:",squash"`
 }
 
 // WavesRPC config for wavesrpc
@@ -138,6 +397,8 @@ type WavesRPC struct {
 	Port     string `mapstructure:"port"`
 	Enabled  bool   `mapstructure:"enabled"`
 	Protocol string `mapstructure:"protocol"`
+
+	HTTPTransport `mapstructure:",squash"`
 }
 
 // WavesMDLRPC config for wavesmdlrpc
@@ -153,6 +414,18 @@ type BtcScanner struct {
 	ScanPeriod            time.Duration `mapstructure:"scan_period"`
 	InitialScanHeight     int64         `mapstructure:"initial_scan_height"`
 	ConfirmationsRequired int64         `mapstructure:"confirmations_required"`
+	// Mark the scanner unhealthy if no new block is seen within this duration, 0 disables
+	StallTimeout time.Duration `mapstructure:"stall_timeout"`
+	// Deposits of at least this value, in the coin's smallest unit, wait for large_deposit_confirmations. 0 disables
+	LargeDepositValue         int64 `mapstructure:"large_deposit_value"`
+	LargeDepositConfirmations int64 `mapstructure:"large_deposit_confirmations"`
+	// Deposits wait for one more confirmation per this USD value, rounded up, up to max_confirmations. Empty disables
+	ConfirmationsUSDPerBlock string `mapstructure:"confirmations_usd_per_block"`
+	MaxConfirmations         int64  `mapstructure:"max_confirmations"`
+	// Deposits below this value, in the coin's smallest unit, are ignored by the scanner. 0 disables
+	DustValue int64 `mapstructure:"dust_value"`
+	// Stop scanning this many blocks ahead of the oldest deposit the exchange has not recorded yet. 0 disables
+	MaxBlockLookback int64 `mapstructure:"max_block_lookback"`
 }
 
 // EthScanner config for ETH scanner
@@ -161,6 +434,18 @@ type EthScanner struct {
 	ScanPeriod            time.Duration `mapstructure:"scan_period"`
 	InitialScanHeight     int64         `mapstructure:"initial_scan_height"`
 	ConfirmationsRequired int64         `mapstructure:"confirmations_required"`
+	// Mark the scanner unhealthy if no new block is seen within this duration, 0 disables
+	StallTimeout time.Duration `mapstructure:"stall_timeout"`
+	// Deposits of at least this value, in the coin's smallest unit, wait for large_deposit_confirmations. 0 disables
+	LargeDepositValue         int64 `mapstructure:"large_deposit_value"`
+	LargeDepositConfirmations int64 `mapstructure:"large_deposit_confirmations"`
+	// Deposits wait for one more confirmation per this USD value, rounded up, up to max_confirmations. Empty disables
+	ConfirmationsUSDPerBlock string `mapstructure:"confirmations_usd_per_block"`
+	MaxConfirmations         int64  `mapstructure:"max_confirmations"`
+	// Deposits below this value, in the coin's smallest unit, are ignored by the scanner. 0 disables
+	DustValue int64 `mapstructure:"dust_value"`
+	// Stop scanning this many blocks ahead of the oldest deposit the exchange has not recorded yet. 0 disables
+	MaxBlockLookback int64 `mapstructure:"max_block_lookback"`
 }
 
 // SkyScanner config for SKY scanner
@@ -169,6 +454,23 @@ type SkyScanner struct {
 	ScanPeriod            time.Duration `mapstructure:"scan_period"`
 	InitialScanHeight     int64         `mapstructure:"initial_scan_height"`
 	ConfirmationsRequired int64         `mapstructure:"confirmations_required"`
+	// Mark the scanner unhealthy if no new block is seen within this duration, 0 disables
+	StallTimeout time.Duration `mapstructure:"stall_timeout"`
+	// Number of confirmed blocks to fetch concurrently while catching up, 0 or 1 fetches one at a time
+	BlockWindow int `mapstructure:"block_window"`
+	// Deposits of at least this value, in the coin's smallest unit, wait for large_deposit_confirmations. 0 disables
+	LargeDepositValue         int64 `mapstructure:"large_deposit_value"`
+	LargeDepositConfirmations int64 `mapstructure:"large_deposit_confirmations"`
+	// Deposits wait for one more confirmation per this USD value, rounded up, up to max_confirmations. Empty disables
+	ConfirmationsUSDPerBlock string `mapstructure:"confirmations_usd_per_block"`
+	MaxConfirmations         int64  `mapstructure:"max_confirmations"`
+	// Deposits below this value, in the coin's smallest unit, are ignored by the scanner. 0 disables
+	DustValue int64 `mapstructure:"dust_value"`
+	// Stop scanning this many blocks ahead of the oldest deposit the exchange has not recorded yet. 0 disables
+	MaxBlockLookback int64 `mapstructure:"max_block_lookback"`
+	// Confirm deposits by the confirmed status of their transaction, instead of confirmations_required blocks.
+	// The status is confirmed once the transaction is in a block, so this waits no longer than confirmations_required = 0
+	ConfirmByTxStatus bool `mapstructure:"confirm_by_tx_status"`
 }
 
 // WavesScanner config for WAVES scanner
@@ -177,6 +479,18 @@ type WavesScanner struct {
 	ScanPeriod            time.Duration `mapstructure:"scan_period"`
 	InitialScanHeight     int64         `mapstructure:"initial_scan_height"`
 	ConfirmationsRequired int64         `mapstructure:"confirmations_required"`
+	// Mark the scanner unhealthy if no new block is seen within this duration, 0 disables
+	StallTimeout time.Duration `mapstructure:"stall_timeout"`
+	// Deposits of at least this value, in the coin's smallest unit, wait for large_deposit_confirmations. 0 disables
+	LargeDepositValue         int64 `mapstructure:"large_deposit_value"`
+	LargeDepositConfirmations int64 `mapstructure:"large_deposit_confirmations"`
+	// Deposits wait for one more confirmation per this USD value, rounded up, up to max_confirmations. Empty disables
+	ConfirmationsUSDPerBlock string `mapstructure:"confirmations_usd_per_block"`
+	MaxConfirmations         int64  `mapstructure:"max_confirmations"`
+	// Deposits below this value, in the coin's smallest unit, are ignored by the scanner. 0 disables
+	DustValue int64 `mapstructure:"dust_value"`
+	// Stop scanning this many blocks ahead of the oldest deposit the exchange has not recorded yet. 0 disables
+	MaxBlockLookback int64 `mapstructure:"max_block_lookback"`
 }
 
 // WavesMDLScanner config for WAVES MDL scanner
@@ -185,51 +499,157 @@ type WavesMDLScanner struct {
 	ScanPeriod            time.Duration `mapstructure:"scan_period"`
 	InitialScanHeight     int64         `mapstructure:"initial_scan_height"`
 	ConfirmationsRequired int64         `mapstructure:"confirmations_required"`
+	// Mark the scanner unhealthy if no new block is seen within this duration, 0 disables
+	StallTimeout time.Duration `mapstructure:"stall_timeout"`
+	// Deposits of at least this value, in the coin's smallest unit, wait for large_deposit_confirmations. 0 disables
+	LargeDepositValue         int64 `mapstructure:"large_deposit_value"`
+	LargeDepositConfirmations int64 `mapstructure:"large_deposit_confirmations"`
+	// Deposits wait for one more confirmation per this USD value, rounded up, up to max_confirmations. Empty disables
+	ConfirmationsUSDPerBlock string `mapstructure:"confirmations_usd_per_block"`
+	MaxConfirmations         int64  `mapstructure:"max_confirmations"`
+	// Deposits below this value, in the coin's smallest unit, are ignored by the scanner. 0 disables
+	DustValue int64 `mapstructure:"dust_value"`
+	// Stop scanning this many blocks ahead of the oldest deposit the exchange has not recorded yet. 0 disables
+	MaxBlockLookback int64 `mapstructure:"max_block_lookback"`
+}
+
+// RateTier is a volume tier of a coin's exchange rate. Deposits of at least MinAmount are exchanged at Rate.
+// A deposit is exchanged at the rate of the tier with the largest MinAmount it reaches,
+// or at the coin's mdl_*_exchange_rate if it reaches none
+type RateTier struct {
+	// Amount of the coin, as a decimal string
+	MinAmount string `mapstructure:"min_amount" json:"min_amount"`
+	// Exchange rate, in the same format as mdl_*_exchange_rate
+	Rate string `mapstructure:"rate" json:"rate"`
 }
 
 // MDLExchanger config for mdl sender, disabling enabling coin on exchange, message and rates
 type MDLExchanger struct {
-	// exchange rate. Can be an int, float or rational fraction string
-	MDLBtcExchangeName    string `mapstructure:"mdl_btc_exchange_name"`
-	MDLBtcExchangeRate    string `mapstructure:"mdl_btc_exchange_rate"`
-	MDLBtcExchangeRateUSD string `mapstructure:"mdl_btc_exchange_rate_usd"`
-	MDLBtcExchangeLabel   string `mapstructure:"mdl_btc_exchange_label"`
-	MDLBtcExchangeEnabled bool   `mapstructure:"mdl_btc_exchange_enabled"`
-
-	MDLEthExchangeName    string `mapstructure:"mdl_eth_exchange_name"`
-	MDLEthExchangeRate    string `mapstructure:"mdl_eth_exchange_rate"`
-	MDLEthExchangeRateUSD string `mapstructure:"mdl_eth_exchange_rate_usd"`
-	MDLEthExchangeLabel   string `mapstructure:"mdl_eth_exchange_label"`
-	MDLEthExchangeEnabled bool   `mapstructure:"mdl_eth_exchange_enabled"`
-
-	MDLSkyExchangeName    string `mapstructure:"mdl_sky_exchange_name"`
-	MDLSkyExchangeRate    string `mapstructure:"mdl_sky_exchange_rate"`
-	MDLSkyExchangeRateUSD string `mapstructure:"mdl_sky_exchange_rate_usd"`
-	MDLSkyExchangeLabel   string `mapstructure:"mdl_sky_exchange_label"`
-	MDLSkyExchangeEnabled bool   `mapstructure:"mdl_sky_exchange_enabled"`
-
-	MDLWavesExchangeName    string `mapstructure:"mdl_waves_exchange_name"`
-	MDLWavesExchangeRate    string `mapstructure:"mdl_waves_exchange_rate"`
-	MDLWavesExchangeRateUSD string `mapstructure:"mdl_waves_exchange_rate_usd"`
-	MDLWavesExchangeLabel   string `mapstructure:"mdl_waves_exchange_label"`
-	MDLWavesExchangeEnabled bool   `mapstructure:"mdl_waves_exchange_enabled"`
-
-	MDLWavesMDLExchangeName    string `mapstructure:"mdl_waves_mdl_exchange_name"`
-	MDLWavesMDLExchangeRate    string `mapstructure:"mdl_waves_mdl_exchange_rate"`
-	MDLWavesMDLExchangeRateUSD string `mapstructure:"mdl_waves_mdl_exchange_rate_usd"`
-	MDLWavesMDLExchangeLabel   string `mapstructure:"mdl_waves_mdl_exchange_label"`
-	MDLWavesMDLExchangeEnabled bool   `mapstructure:"mdl_waves_mdl_exchange_enabled"`
+	// exchange rate. Can be an int, float or rational fraction string.
+	// spread is a percent taken off the exchange rate, e.g. "2" pays out 2% less MDL. Empty means no spread
+	MDLBtcExchangeName      string     `mapstructure:"mdl_btc_exchange_name"`
+	MDLBtcExchangeRate      string     `mapstructure:"mdl_btc_exchange_rate"`
+	MDLBtcExchangeRateUSD   string     `mapstructure:"mdl_btc_exchange_rate_usd"`
+	MDLBtcExchangeLabel     string     `mapstructure:"mdl_btc_exchange_label"`
+	MDLBtcExchangeEnabled   bool       `mapstructure:"mdl_btc_exchange_enabled"`
+	MDLBtcExchangeRateTiers []RateTier `mapstructure:"mdl_btc_exchange_rate_tiers"`
+	MDLBtcSpread            string     `mapstructure:"mdl_btc_spread"`
+
+	MDLEthExchangeName      string     `mapstructure:"mdl_eth_exchange_name"`
+	MDLEthExchangeRate      string     `mapstructure:"mdl_eth_exchange_rate"`
+	MDLEthExchangeRateUSD   string     `mapstructure:"mdl_eth_exchange_rate_usd"`
+	MDLEthExchangeLabel     string     `mapstructure:"mdl_eth_exchange_label"`
+	MDLEthExchangeEnabled   bool       `mapstructure:"mdl_eth_exchange_enabled"`
+	MDLEthExchangeRateTiers []RateTier `mapstructure:"mdl_eth_exchange_rate_tiers"`
+	MDLEthSpread            string     `mapstructure:"mdl_eth_spread"`
+
+	MDLSkyExchangeName      string     `mapstructure:"mdl_sky_exchange_name"`
+	MDLSkyExchangeRate      string     `mapstructure:"mdl_sky_exchange_rate"`
+	MDLSkyExchangeRateUSD   string     `mapstructure:"mdl_sky_exchange_rate_usd"`
+	MDLSkyExchangeLabel     string     `mapstructure:"mdl_sky_exchange_label"`
+	MDLSkyExchangeEnabled   bool       `mapstructure:"mdl_sky_exchange_enabled"`
+	MDLSkyExchangeRateTiers []RateTier `mapstructure:"mdl_sky_exchange_rate_tiers"`
+	MDLSkySpread            string     `mapstructure:"mdl_sky_spread"`
+
+	MDLWavesExchangeName      string     `mapstructure:"mdl_waves_exchange_name"`
+	MDLWavesExchangeRate      string     `mapstructure:"mdl_waves_exchange_rate"`
+	MDLWavesExchangeRateUSD   string     `mapstructure:"mdl_waves_exchange_rate_usd"`
+	MDLWavesExchangeLabel     string     `mapstructure:"mdl_waves_exchange_label"`
+	MDLWavesExchangeEnabled   bool       `mapstructure:"mdl_waves_exchange_enabled"`
+	MDLWavesExchangeRateTiers []RateTier `mapstructure:"mdl_waves_exchange_rate_tiers"`
+	MDLWavesSpread            string     `mapstructure:"mdl_waves_spread"`
+
+	MDLWavesMDLExchangeName      string     `mapstructure:"mdl_waves_mdl_exchange_name"`
+	MDLWavesMDLExchangeRate      string     `mapstructure:"mdl_waves_mdl_exchange_rate"`
+	MDLWavesMDLExchangeRateUSD   string     `mapstructure:"mdl_waves_mdl_exchange_rate_usd"`
+	MDLWavesMDLExchangeLabel     string     `mapstructure:"mdl_waves_mdl_exchange_label"`
+	MDLWavesMDLExchangeEnabled   bool       `mapstructure:"mdl_waves_mdl_exchange_enabled"`
+	MDLWavesMDLExchangeRateTiers []RateTier `mapstructure:"mdl_waves_mdl_exchange_rate_tiers"`
+	MDLWavesMDLSpread            string     `mapstructure:"mdl_waves_mdl_spread"`
+
+	// Names of the coins to list first in the supported coins, in this order. Other coins follow in the default order
+	Featured []string `mapstructure:"featured"`
+
+	// USD rates older than this are stale, and the mdl_*_exchange_rate_usd fallback is shown instead. 0 disables.
+	// Only applies if a USD rate feed is attached
+	USDRateMaxAge time.Duration `mapstructure:"usd_rate_max_age"`
 
 	// Number of decimal places to truncate MDL to
 	MaxDecimals int `mapstructure:"max_decimals"`
+	// Upper bound of max_decimals per coin type, e.g. {"ETH" = 2}. max_decimals can't exceed the bound of any coin type
+	MaxDecimalsPolicy map[string]int `mapstructure:"max_decimals_policy"`
 	// How long to wait before rechecking transaction confirmations
 	TxConfirmationCheckWait time.Duration `mapstructure:"tx_confirmation_check_wait"`
 	// Path of hot MDL wallet file on disk
 	Wallet string `mapstructure:"wallet"`
+	// Name of the environment variable holding the password of an encrypted hot wallet
+	WalletPasswordEnv string `mapstructure:"wallet_password_env"`
+	// Path of a file holding the password of an encrypted hot wallet, used if wallet_password_env is not set
+	WalletPasswordFile string `mapstructure:"wallet_password_file"`
 	// Allow sending of coins (deposits will still be received and recorded)
 	SendEnabled bool `mapstructure:"send_enabled"`
 	// Method of purchasing coins ("direct buy" or "passthrough"
 	BuyMethod string `mapstructure:"buy_method"`
+	// Deposits to a bound address beyond this number are held for manual review instead of being processed. 0 disables
+	MaxDepositsPerBinding int `mapstructure:"max_deposits_per_binding"`
+	// Deposits that would raise the MDL owed for the deposits not paid yet above this amount are held for manual review
+	// instead of being processed. An MDL amount as a decimal string, empty disables
+	MaxOutstanding string `mapstructure:"max_outstanding"`
+	// Deposits to an address bound with an expected amount that differ from it by more than this fraction of it
+	// are held for manual review. A decimal string, e.g. "0.01" or "1%", empty requires an exact match
+	ExpectedAmountTolerance string `mapstructure:"expected_amount_tolerance"`
+	// How long the deposits of a deprecated coin are still scanned and processed, before its scanner is stopped
+	CoinDeprecationWindow time.Duration `mapstructure:"coin_deprecation_window"`
+	// For this long after a coin's exchange rate or rate tiers are changed, deposits the scanner saw before the change
+	// get the previous rate. 0 disables
+	RatePhaseIn time.Duration `mapstructure:"rate_phase_in"`
+	// Coin hours kept in the hot wallet. Payouts that would spend them are queued until the wallet has more hours. 0 disables
+	MinReservedHours uint64 `mapstructure:"min_reserved_hours"`
+	// Deduct network_fee from the MDL paid for each deposit, to cover the cost of sweeping the deposit later
+	DeductNetworkFee bool `mapstructure:"deduct_network_fee"`
+	// MDL equivalent of the network fee deducted from each payout if deduct_network_fee is enabled, as a decimal string
+	NetworkFee string `mapstructure:"network_fee"`
+	// Deposits in a non-terminal status that were not updated for this long are re-driven through processing. 0 disables
+	StaleDepositThreshold time.Duration `mapstructure:"stale_deposit_threshold"`
+	// How often to look for stale deposits if stale_deposit_threshold is set
+	StaleDepositCheckInterval time.Duration `mapstructure:"stale_deposit_check_interval"`
+}
+
+// MaxOutstandingDroplets returns MaxOutstanding in droplets, or 0 if MaxOutstanding is empty
+func (c MDLExchanger) MaxOutstandingDroplets() (uint64, error) {
+	if c.MaxOutstanding == "" {
+		return 0, nil
+	}
+
+	return droplet.FromString(c.MaxOutstanding)
+}
+
+// ExpectedAmountToleranceDecimal returns ExpectedAmountTolerance as a fraction, or 0 if ExpectedAmountTolerance is empty
+func (c MDLExchanger) ExpectedAmountToleranceDecimal() (decimal.Decimal, error) {
+	if c.ExpectedAmountTolerance == "" {
+		return decimal.New(0, 0), nil
+	}
+
+	return mathutil.DecimalFromString(c.ExpectedAmountTolerance)
+}
+
+// SpreadDecimal parses a mdl_*_spread percent, returning 0 if spread is empty.
+// The spread is already a percent, so it must be a plain decimal number, without a "%" suffix
+func SpreadDecimal(spread string) (decimal.Decimal, error) {
+	if spread == "" {
+		return decimal.New(0, 0), nil
+	}
+
+	return decimal.NewFromString(spread)
+}
+
+// NetworkFeeDroplets returns NetworkFee in droplets, or 0 if NetworkFee is empty
+func (c MDLExchanger) NetworkFeeDroplets() (uint64, error) {
+	if c.NetworkFee == "" {
+		return 0, nil
+	}
+
+	return droplet.FromString(c.NetworkFee)
 }
 
 // Validate validates the MDLExchanger config
@@ -248,38 +668,192 @@ func (c MDLExchanger) Validate() error {
 func (c MDLExchanger) validate() []error {
 	var errs []error
 
-	if _, err := mathutil.ParseRate(c.MDLBtcExchangeRate); err != nil {
-		errs = append(errs, fmt.Errorf("mdl_exchanger.mdl_btc_exchange_rate invalid: %v", err))
+	// The rate of a coin whose exchange is disabled may be left empty
+	rates := []struct {
+		key     string
+		rate    string
+		enabled bool
+	}{
+		{"mdl_btc_exchange_rate", c.MDLBtcExchangeRate, c.MDLBtcExchangeEnabled},
+		{"mdl_eth_exchange_rate", c.MDLEthExchangeRate, c.MDLEthExchangeEnabled},
+		{"mdl_sky_exchange_rate", c.MDLSkyExchangeRate, c.MDLSkyExchangeEnabled},
+		{"mdl_waves_exchange_rate", c.MDLWavesExchangeRate, c.MDLWavesExchangeEnabled},
+		{"mdl_waves_mdl_exchange_rate", c.MDLWavesMDLExchangeRate, c.MDLWavesMDLExchangeEnabled},
 	}
-
-	if _, err := mathutil.ParseRate(c.MDLEthExchangeRate); err != nil {
-		errs = append(errs, fmt.Errorf("mdl_exchanger.mdl_eth_exchange_rate invalid: %v", err))
+	for _, r := range rates {
+		if r.rate == "" && !r.enabled {
+			continue
+		}
+		if _, err := mathutil.ParseRate(r.rate); err != nil {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.%s invalid: %v", r.key, err))
+		}
 	}
 
-	if _, err := mathutil.ParseRate(c.MDLSkyExchangeRate); err != nil {
-		errs = append(errs, fmt.Errorf("mdl_exchanger.mdl_sky_exchange_rate invalid: %v", err))
+	tiers := []struct {
+		key   string
+		tiers []RateTier
+	}{
+		{"mdl_btc_exchange_rate_tiers", c.MDLBtcExchangeRateTiers},
+		{"mdl_eth_exchange_rate_tiers", c.MDLEthExchangeRateTiers},
+		{"mdl_sky_exchange_rate_tiers", c.MDLSkyExchangeRateTiers},
+		{"mdl_waves_exchange_rate_tiers", c.MDLWavesExchangeRateTiers},
+		{"mdl_waves_mdl_exchange_rate_tiers", c.MDLWavesMDLExchangeRateTiers},
 	}
-
-	if _, err := mathutil.ParseRate(c.MDLWavesExchangeRate); err != nil {
-		errs = append(errs, fmt.Errorf("mdl_exchanger.mdl_waves_exchange_rate invalid: %v", err))
+	for _, t := range tiers {
+		errs = append(errs, validateRateTiers(t.key, t.tiers)...)
 	}
 
-	if _, err := mathutil.ParseRate(c.MDLWavesMDLExchangeRate); err != nil {
-		errs = append(errs, fmt.Errorf("mdl_exchanger.mdl_waves_mdl_exchange_rate invalid: %v", err))
+	spreads := []struct {
+		key    string
+		spread string
+	}{
+		{"mdl_btc_spread", c.MDLBtcSpread},
+		{"mdl_eth_spread", c.MDLEthSpread},
+		{"mdl_sky_spread", c.MDLSkySpread},
+		{"mdl_waves_spread", c.MDLWavesSpread},
+		{"mdl_waves_mdl_spread", c.MDLWavesMDLSpread},
+	}
+	for _, s := range spreads {
+		spread, err := SpreadDecimal(s.spread)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.%s invalid: %v", s.key, err))
+		} else if spread.Sign() < 0 || spread.Cmp(decimal.New(100, 0)) >= 0 {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.%s must be a percent of at least 0 and less than 100", s.key))
+		}
 	}
 
 	if c.MaxDecimals < 0 {
 		errs = append(errs, errors.New("mdl_exchanger.max_decimals can't be negative"))
 	}
 
+	if c.USDRateMaxAge < 0 {
+		errs = append(errs, errors.New("mdl_exchanger.usd_rate_max_age can't be negative"))
+	}
+
+	if c.MaxDepositsPerBinding < 0 {
+		errs = append(errs, errors.New("mdl_exchanger.max_deposits_per_binding can't be negative"))
+	}
+
+	if c.CoinDeprecationWindow < 0 {
+		errs = append(errs, errors.New("mdl_exchanger.coin_deprecation_window can't be negative"))
+	}
+
+	if c.RatePhaseIn < 0 {
+		errs = append(errs, errors.New("mdl_exchanger.rate_phase_in can't be negative"))
+	}
+
+	if c.StaleDepositThreshold < 0 {
+		errs = append(errs, errors.New("mdl_exchanger.stale_deposit_threshold can't be negative"))
+	}
+
+	if c.StaleDepositThreshold > 0 && c.StaleDepositCheckInterval <= 0 {
+		errs = append(errs, errors.New("mdl_exchanger.stale_deposit_check_interval must be positive if mdl_exchanger.stale_deposit_threshold is set"))
+	}
+
+	if maxOutstanding, err := c.MaxOutstandingDroplets(); err != nil {
+		errs = append(errs, fmt.Errorf("mdl_exchanger.max_outstanding invalid: %v", err))
+	} else if c.MaxOutstanding != "" && maxOutstanding == 0 {
+		errs = append(errs, errors.New("mdl_exchanger.max_outstanding must be positive, or empty to disable it"))
+	}
+
+	if tolerance, err := c.ExpectedAmountToleranceDecimal(); err != nil {
+		errs = append(errs, fmt.Errorf("mdl_exchanger.expected_amount_tolerance invalid: %v", err))
+	} else if tolerance.Sign() < 0 {
+		errs = append(errs, errors.New("mdl_exchanger.expected_amount_tolerance can't be negative"))
+	}
+
+	if _, err := c.NetworkFeeDroplets(); err != nil {
+		errs = append(errs, fmt.Errorf("mdl_exchanger.network_fee invalid: %v", err))
+	} else if c.DeductNetworkFee && c.NetworkFee == "" {
+		errs = append(errs, errors.New("mdl_exchanger.network_fee is required if mdl_exchanger.deduct_network_fee is enabled"))
+	} else if fee, err := decimal.NewFromString(c.NetworkFee); c.DeductNetworkFee && err == nil && c.MaxDecimals >= 0 && !fee.Equal(fee.Truncate(int32(c.MaxDecimals))) {
+		// The fee is deducted from the payout after it is truncated to max_decimals,
+		// the net payout would have more decimal places than the MDL node accepts
+		errs = append(errs, fmt.Errorf("mdl_exchanger.network_fee can't have more decimal places than mdl_exchanger.max_decimals=%d", c.MaxDecimals))
+	}
+
 	if uint8(c.MaxDecimals) > params.UserVerifyTxn.MaxDropletPrecision {
 		errs = append(errs, fmt.Errorf("mdl_exchanger.max_decimals is larger than MaxDropletPrecision=%d", params.UserVerifyTxn.MaxDropletPrecision))
 	}
 
+	policyCoinTypes := make([]string, 0, len(c.MaxDecimalsPolicy))
+	for coinType := range c.MaxDecimalsPolicy {
+		policyCoinTypes = append(policyCoinTypes, coinType)
+	}
+	sort.Strings(policyCoinTypes)
+
+	for _, coinType := range policyCoinTypes {
+		maxDecimals := c.MaxDecimalsPolicy[coinType]
+		switch {
+		case maxDecimals < 0:
+			errs = append(errs, fmt.Errorf("mdl_exchanger.max_decimals_policy %s can't be negative", coinType))
+		case c.MaxDecimals > maxDecimals:
+			errs = append(errs, fmt.Errorf("mdl_exchanger.max_decimals=%d exceeds the mdl_exchanger.max_decimals_policy of %s=%d", c.MaxDecimals, coinType, maxDecimals))
+		}
+	}
+
 	if err := ValidateBuyMethod(c.BuyMethod); err != nil {
 		errs = append(errs, fmt.Errorf("mdl_exchanger.buy_method must be \"%s\" or \"%s\"", BuyMethodDirect, BuyMethodPassthrough))
 	}
 
+	names := []string{
+		c.MDLBtcExchangeName,
+		c.MDLEthExchangeName,
+		c.MDLSkyExchangeName,
+		c.MDLWavesExchangeName,
+		c.MDLWavesMDLExchangeName,
+	}
+	featured := make(map[string]struct{}, len(c.Featured))
+	for _, name := range c.Featured {
+		if _, ok := featured[name]; ok {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.featured lists %s more than once", name))
+			continue
+		}
+		featured[name] = struct{}{}
+
+		found := false
+		for _, n := range names {
+			if n != "" && n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.featured %s does not match any mdl_exchanger.mdl_*_exchange_name", name))
+		}
+	}
+
+	return errs
+}
+
+// validateRateTiers checks that the tiers have valid rates and positive min amounts, in increasing order
+func validateRateTiers(key string, tiers []RateTier) []error {
+	var errs []error
+
+	var prevMinAmount decimal.Decimal
+	for i, t := range tiers {
+		if _, err := mathutil.ParseRate(t.Rate); err != nil {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.%s[%d].rate invalid: %v", key, i, err))
+		}
+
+		minAmount, err := decimal.NewFromString(t.MinAmount)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.%s[%d].min_amount invalid: %v", key, i, err))
+			continue
+		}
+
+		if minAmount.Sign() <= 0 {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.%s[%d].min_amount must be positive", key, i))
+			continue
+		}
+
+		if i > 0 && minAmount.LessThanOrEqual(prevMinAmount) {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.%s[%d].min_amount must be larger than the min_amount of the previous tier", key, i))
+		}
+
+		prevMinAmount = minAmount
+	}
+
 	return errs
 }
 
@@ -297,24 +871,152 @@ func (c MDLExchanger) validateWallet() []error {
 	w, err := wallet.Load(c.Wallet)
 	if err != nil {
 		errs = append(errs, fmt.Errorf("mdl_exchanger.wallet file %s failed to load: %v", c.Wallet, err))
-	} else if err := w.Validate(); err != nil {
+		return errs
+	}
+
+	if err := w.Validate(); err != nil {
 		errs = append(errs, fmt.Errorf("mdl_exchanger.wallet file %s is invalid: %v", c.Wallet, err))
+		return errs
+	}
+
+	// Sends from an encrypted wallet fail unless the node is given its password,
+	// so check that the password is configured and unlocks the wallet before sending starts
+	if w.IsEncrypted() && c.SendEnabled {
+		password, err := c.WalletPassword()
+		if err != nil {
+			errs = append(errs, err)
+		} else if password == "" {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.wallet file %s is encrypted, mdl_exchanger.wallet_password_env or mdl_exchanger.wallet_password_file is required to send", c.Wallet))
+		} else if _, err := w.Unlock([]byte(password)); err != nil {
+			errs = append(errs, fmt.Errorf("mdl_exchanger.wallet file %s can't be unlocked with the configured password: %v", c.Wallet, err))
+		}
 	}
 
 	return errs
 }
 
+// WalletPassword returns the password of the hot wallet, read from the wallet_password_env environment variable,
+// or else from wallet_password_file. Returns an empty string if neither is configured
+func (c MDLExchanger) WalletPassword() (string, error) {
+	if c.WalletPasswordEnv != "" {
+		password := os.Getenv(c.WalletPasswordEnv)
+		if password == "" {
+			return "", fmt.Errorf("mdl_exchanger.wallet_password_env environment variable %s is not set", c.WalletPasswordEnv)
+		}
+		return password, nil
+	}
+
+	if c.WalletPasswordFile != "" {
+		b, err := ioutil.ReadFile(c.WalletPasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("mdl_exchanger.wallet_password_file read failed: %v", err)
+		}
+
+		password := strings.TrimRight(string(b), "\r\n")
+		if password == "" {
+			return "", fmt.Errorf("mdl_exchanger.wallet_password_file %s is empty", c.WalletPasswordFile)
+		}
+		return password, nil
+	}
+
+	return "", nil
+}
+
 // Web config for the teller HTTP interface
 type Web struct {
 	HTTPAddr         string        `mapstructure:"http_addr"`
 	HTTPSAddr        string        `mapstructure:"https_addr"`
-	StaticDir        string        `mapstructure:"static_dir"`
+	StaticDir        string        `mapstructure:"static_dir"` // Directory of the static files, the embedded frontend build is served if empty
 	AutoTLSHost      string        `mapstructure:"auto_tls_host"`
 	TLSCert          string        `mapstructure:"tls_cert"`
 	TLSKey           string        `mapstructure:"tls_key"`
 	ThrottleMax      int64         `mapstructure:"throttle_max"` // Maximum number of requests per duration
 	ThrottleDuration time.Duration `mapstructure:"throttle_duration"`
 	BehindProxy      bool          `mapstructure:"behind_proxy"`
+	MaxRequestBytes  int64         `mapstructure:"max_request_bytes"` // Maximum size of a request body accepted by the API
+	RateFormat       string        `mapstructure:"rate_format"`       // Display format of exchange rates in /api/config, "fixed" or "trim"
+	HandlerTimeout   time.Duration `mapstructure:"handler_timeout"`   // Maximum time an API handler may run before responding with 503
+
+	MaxConcurrentPerIP int `mapstructure:"max_concurrent_per_ip"` // Maximum number of API requests from one IP handled at the same time, 0 disables
+
+	// Log 1 in this many successful API requests, failed requests are always logged. 0 or 1 logs every request
+	LogSampleRate int `mapstructure:"log_sample_rate"`
+
+	// Number of decimal places of the MDL amounts rendered by the API, at most the droplet precision of 6. 0 uses the droplet precision
+	DisplayPrecision int `mapstructure:"display_precision"`
+
+	// Timestamped API requests whose X-Request-Timestamp differs from the server time by more than this are rejected, 0 disables
+	MaxClockSkew time.Duration `mapstructure:"max_clock_skew"`
+
+	GzipLevel        int      `mapstructure:"gzip_level"`         // Compression level of static files, 1 (fastest) to 9 (best), 0 uses the default level
+	GzipContentTypes []string `mapstructure:"gzip_content_types"` // Content types of static files to gzip, all are gzipped if empty
+
+	// Render "available" in /api/config as a JSON number instead of a string, for clients that haven't migrated yet.
+	// Deprecated, will be removed
+	AvailableAsNumber bool `mapstructure:"available_as_number"`
+
+	// Render "available" in /api/config as null instead of 0 when the balance of the wallet can't be read
+	AvailableNullOnError bool `mapstructure:"available_null_on_error"`
+
+	// Return API errors with 200 OK and a {"ok":false,"error":...} body, for legacy clients
+	ErrorsAsOK bool `mapstructure:"errors_as_ok"`
+
+	// Headers set on every response, replacing the values set by teller. An empty value removes the header
+	ResponseHeaders map[string]string `mapstructure:"response_headers"`
+
+	// Strict-Transport-Security header sent over HTTPS: max-age in seconds, 0 disables, and its includeSubDomains and preload directives
+	STSSeconds           int64 `mapstructure:"sts_seconds"`
+	STSIncludeSubdomains bool  `mapstructure:"sts_include_subdomains"`
+	STSPreload           bool  `mapstructure:"sts_preload"`
+
+	// Serve /api/events, a Server-Sent Events stream of the deposit status changes of an MDL address
+	EventStreamEnabled bool `mapstructure:"event_stream_enabled"`
+
+	// Timeouts of the web.http_addr listener, 0 disables
+	HTTPReadTimeout  time.Duration `mapstructure:"http_read_timeout"`
+	HTTPWriteTimeout time.Duration `mapstructure:"http_write_timeout"`
+	HTTPIdleTimeout  time.Duration `mapstructure:"http_idle_timeout"`
+
+	// Timeouts of the web.https_addr listener, 0 disables
+	HTTPSReadTimeout  time.Duration `mapstructure:"https_read_timeout"`
+	HTTPSWriteTimeout time.Duration `mapstructure:"https_write_timeout"`
+	HTTPSIdleTimeout  time.Duration `mapstructure:"https_idle_timeout"`
+}
+
+// STSPreloadMinSeconds is the shortest Strict-Transport-Security max-age accepted by the browsers' HSTS preload list, one year
+const STSPreloadMinSeconds = 31536000
+
+// ListenerTimeouts are the read, write and idle timeouts of an http.Server
+type ListenerTimeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Idle  time.Duration
+}
+
+// HTTPTimeouts returns the timeouts of the web.http_addr listener
+func (c Web) HTTPTimeouts() ListenerTimeouts {
+	return ListenerTimeouts{
+		Read:  c.HTTPReadTimeout,
+		Write: c.HTTPWriteTimeout,
+		Idle:  c.HTTPIdleTimeout,
+	}
+}
+
+// HTTPSTimeouts returns the timeouts of the web.https_addr listener
+func (c Web) HTTPSTimeouts() ListenerTimeouts {
+	return ListenerTimeouts{
+		Read:  c.HTTPSReadTimeout,
+		Write: c.HTTPSWriteTimeout,
+		Idle:  c.HTTPSIdleTimeout,
+	}
+}
+
+// MDLDisplayPrecision returns the number of decimal places of the MDL amounts rendered by the API
+func (c Web) MDLDisplayPrecision() int {
+	if c.DisplayPrecision == 0 {
+		return mathutil.MDLDropletPrecision
+	}
+	return c.DisplayPrecision
 }
 
 // Validate validates Web config
@@ -339,12 +1041,79 @@ func (c Web) Validate() error {
 		return errors.New("web.auto_tls_host or web.tls_key or web.tls_cert is set but web.https_addr is not enabled")
 	}
 
+	if c.MaxRequestBytes < 0 {
+		return errors.New("web.max_request_bytes can't be negative")
+	}
+
+	if c.HandlerTimeout < 0 {
+		return errors.New("web.handler_timeout can't be negative")
+	}
+
+	if c.MaxConcurrentPerIP < 0 {
+		return errors.New("web.max_concurrent_per_ip can't be negative")
+	}
+
+	if c.MaxClockSkew < 0 {
+		return errors.New("web.max_clock_skew can't be negative")
+	}
+
+	if c.GzipLevel < 0 || c.GzipLevel > gzip.BestCompression {
+		return fmt.Errorf("web.gzip_level must be between 0 and %d", gzip.BestCompression)
+	}
+
+	if err := ValidateRateFormat(c.RateFormat); err != nil {
+		return fmt.Errorf("web.rate_format must be \"%s\" or \"%s\"", RateFormatFixed, RateFormatTrim)
+	}
+
+	if c.LogSampleRate < 0 {
+		return errors.New("web.log_sample_rate can't be negative")
+	}
+
+	if c.DisplayPrecision < 0 || c.DisplayPrecision > mathutil.MDLDropletPrecision {
+		return fmt.Errorf("web.display_precision must be between 0 and %d", mathutil.MDLDropletPrecision)
+	}
+
+	for _, t := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"http_read_timeout", c.HTTPReadTimeout},
+		{"http_write_timeout", c.HTTPWriteTimeout},
+		{"http_idle_timeout", c.HTTPIdleTimeout},
+		{"https_read_timeout", c.HTTPSReadTimeout},
+		{"https_write_timeout", c.HTTPSWriteTimeout},
+		{"https_idle_timeout", c.HTTPSIdleTimeout},
+	} {
+		if t.timeout < 0 {
+			return fmt.Errorf("web.%s can't be negative", t.name)
+		}
+	}
+
+	if c.STSSeconds < 0 {
+		return errors.New("web.sts_seconds can't be negative")
+	}
+
+	// https://hstspreload.org/#submission-requirements
+	if c.STSPreload && (!c.STSIncludeSubdomains || c.STSSeconds < STSPreloadMinSeconds) {
+		return fmt.Errorf("web.sts_preload requires web.sts_include_subdomains and a web.sts_seconds of at least %d", STSPreloadMinSeconds)
+	}
+
+	for name, value := range c.ResponseHeaders {
+		if !httputil.ValidHeaderName(name) {
+			return fmt.Errorf("web.response_headers has an invalid header name %q", name)
+		}
+
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("web.response_headers value of %q contains a line break", name)
+		}
+	}
+
 	return nil
 }
 
 // AdminPanel config for the admin panel AdminPanel
 type AdminPanel struct {
-	Host             string `mapstructure:"host"`
+	Host             string `mapstructure:"host"` // Empty to not listen on it, the admin panel is disabled if Hosts is empty too
 	FixBtcValue      int64  `mapstructure:"fix_btc_value"`
 	FixEthValue      int64  `mapstructure:"fix_eth_value"`
 	FixSkyValue      int64  `mapstructure:"fix_sky_value"`
@@ -353,6 +1122,143 @@ type AdminPanel struct {
 	FixMdlValue      int64  `mapstructure:"fix_mdl_value"`
 	FixUsdValue      string `mapstructure:"fix_usd_value"`
 	FixTxValue       int64  `mapstructure:"fix_tx_value"`
+	// Only requests from these CIDRs, e.g. "10.0.0.0/8", are allowed. All sources are allowed if empty
+	AllowedIPs []string `mapstructure:"allowed_ips"`
+	// Read the source IP from the X-Forwarded-For or X-Real-IP header, when the admin panel is behind a reverse proxy
+	BehindProxy bool `mapstructure:"behind_proxy"`
+	// Addresses the admin panel listens on in addition to Host
+	Hosts []string `mapstructure:"hosts"`
+	// Token required as a bearer token by the admin panel endpoints that change state. They are refused if it is empty
+	AuthToken string `mapstructure:"auth_token"`
+}
+
+// Addrs returns the addresses the admin panel listens on, Host followed by Hosts.
+// The admin panel is disabled if there are none
+func (c AdminPanel) Addrs() []string {
+	var addrs []string
+	if c.Host != "" {
+		addrs = append(addrs, c.Host)
+	}
+	return append(addrs, c.Hosts...)
+}
+
+// Validate validates the AdminPanel config
+func (c AdminPanel) Validate() error {
+	seen := make(map[string]struct{})
+	for _, addr := range c.Addrs() {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("admin_panel address %q is not a valid host:port: %v", addr, err)
+		}
+		if _, ok := seen[addr]; ok {
+			return fmt.Errorf("admin_panel address %q is listed more than once", addr)
+		}
+		seen[addr] = struct{}{}
+	}
+
+	for _, cidr := range c.AllowedIPs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("admin_panel.allowed_ips %q is not a valid CIDR: %v", cidr, err)
+		}
+	}
+
+	return nil
+}
+
+// Events config for publishing deposit events to a NATS message broker
+type Events struct {
+	Enabled bool `mapstructure:"enabled"`
+	// NATS server URL, e.g. nats://127.0.0.1:4222
+	BrokerURL string `mapstructure:"broker_url"`
+	// Subject the events are published to
+	Subject string `mapstructure:"subject"`
+	// Number of events buffered before new events are dropped
+	QueueSize int `mapstructure:"queue_size"`
+}
+
+// Validate validates Events config
+func (c Events) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.BrokerURL == "" {
+		return errors.New("events.broker_url missing")
+	}
+
+	if c.Subject == "" {
+		return errors.New("events.subject missing")
+	}
+
+	if c.QueueSize < 0 {
+		return errors.New("events.queue_size can't be negative")
+	}
+
+	return nil
+}
+
+// Email config for emailing a notification when the payout of a deposit is done
+type Email struct {
+	Enabled bool `mapstructure:"enabled"`
+	// SMTP server
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+	// SMTP credentials, no authentication if the username is empty
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// Sender and recipient addresses
+	From string   `mapstructure:"from"`
+	To   []string `mapstructure:"to"`
+	// Number of emails buffered before new emails are dropped
+	QueueSize int `mapstructure:"queue_size"`
+	// Also email the end user when the payout of their deposit is done, if they gave an email address when binding
+	UserNotifications bool `mapstructure:"user_notifications"`
+	// Optional page where end users can stop the notifications, linked in the emails sent to them
+	OptOutURL string `mapstructure:"opt_out_url"`
+}
+
+// Validate validates Email config
+func (c Email) Validate() error {
+	if c.UserNotifications && !c.Enabled {
+		return errors.New("email.user_notifications requires email.enabled")
+	}
+
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Host == "" {
+		return errors.New("email.host missing")
+	}
+
+	if c.Port <= 0 || c.Port > 65535 {
+		return errors.New("email.port must be between 1 and 65535")
+	}
+
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("email.from is not a valid email address: %v", err)
+	}
+
+	if len(c.To) == 0 {
+		return errors.New("email.to missing")
+	}
+
+	for _, to := range c.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("email.to %q is not a valid email address: %v", to, err)
+		}
+	}
+
+	if c.QueueSize < 0 {
+		return errors.New("email.queue_size can't be negative")
+	}
+
+	if c.OptOutURL != "" {
+		if u, err := url.Parse(c.OptOutURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("email.opt_out_url must be an absolute http or https URL")
+		}
+	}
+
+	return nil
 }
 
 // Dummy config for the fake sender and scanner
@@ -360,6 +1266,8 @@ type Dummy struct {
 	Scanner  bool   `mapstructure:"scanner"`
 	Sender   bool   `mapstructure:"sender"`
 	HTTPAddr string `mapstructure:"http_addr"`
+	// Token required as a bearer token by /dummy/scanner/test-deposit. Empty allows any request
+	Token string `mapstructure:"token"`
 }
 
 // Redacted returns a copy of the config with sensitive information redacted
@@ -372,6 +1280,18 @@ func (c Config) Redacted() Config {
 		c.BtcRPC.Pass = "<redacted>"
 	}
 
+	if c.EthRPC.ExplorerAPIKey != "" {
+		c.EthRPC.ExplorerAPIKey = "<redacted>"
+	}
+
+	if c.Dummy.Token != "" {
+		c.Dummy.Token = "<redacted>"
+	}
+
+	if c.AdminPanel.AuthToken != "" {
+		c.AdminPanel.AuthToken = "<redacted>"
+	}
+
 	return c
 }
 
@@ -382,42 +1302,104 @@ func (c Config) Validate() error {
 		errs = append(errs, err)
 	}
 
-	if c.BtcAddresses == "" {
-		oops("btc_addresses missing")
-	}
-	if _, err := os.Stat(c.BtcAddresses); os.IsNotExist(err) {
-		oops("btc_addresses file does not exist")
-	}
-	if c.EthAddresses == "" {
-		oops("eth_addresses missing")
+	if c.LogFormat != logger.FormatText && c.LogFormat != logger.FormatJSON {
+		oops(fmt.Sprintf("log_format must be %q or %q", logger.FormatText, logger.FormatJSON))
 	}
-	if _, err := os.Stat(c.EthAddresses); os.IsNotExist(err) {
-		oops("eth_addresses file does not exist")
+
+	// Deposit addresses are not handed out in read-only mode
+	if !c.ReadOnly {
+		if c.BtcAddresses == "" {
+			oops("btc_addresses missing")
+		}
+		if _, err := os.Stat(c.BtcAddresses); os.IsNotExist(err) {
+			oops("btc_addresses file does not exist")
+		}
+		if c.EthAddresses == "" {
+			oops("eth_addresses missing")
+		}
+		if _, err := os.Stat(c.EthAddresses); os.IsNotExist(err) {
+			oops("eth_addresses file does not exist")
+		}
+		if c.SkyAddresses == "" {
+			oops("sky_addresses missing")
+		}
+		if _, err := os.Stat(c.SkyAddresses); os.IsNotExist(err) {
+			oops("sky_addresses file does not exist")
+		}
+		if c.WavesAddresses == "" {
+			oops("waves_addresses missing")
+		}
+		if _, err := os.Stat(c.WavesAddresses); os.IsNotExist(err) {
+			oops("waves_addresses file does not exist")
+		}
+		if c.WavesMDLAddresses == "" {
+			oops("waves_mdl_addresses missing")
+		}
+		if _, err := os.Stat(c.WavesMDLAddresses); os.IsNotExist(err) {
+			oops("waves_mdl_addresses file does not exist")
+		}
+
+		if c.Teller.MDLAddressBlocklist != "" {
+			if _, err := os.Stat(c.Teller.MDLAddressBlocklist); os.IsNotExist(err) {
+				oops("teller.mdl_address_blocklist file does not exist")
+			}
+		}
+		if c.Teller.MDLAddressAllowlist != "" {
+			if _, err := os.Stat(c.Teller.MDLAddressAllowlist); os.IsNotExist(err) {
+				oops("teller.mdl_address_allowlist file does not exist")
+			}
+		}
 	}
-	if c.SkyAddresses == "" {
-		oops("sky_addresses missing")
+
+	if c.Teller.BindRetries < 0 {
+		oops("teller.bind_retries can't be negative")
 	}
-	if _, err := os.Stat(c.SkyAddresses); os.IsNotExist(err) {
-		oops("sky_addresses file does not exist")
+
+	if c.Teller.BindCooldown < 0 {
+		oops("teller.bind_cooldown can't be negative")
 	}
-	if c.WavesAddresses == "" {
-		oops("waves_addresses missing")
+
+	if minBindBalance, err := c.Teller.MinBindBalanceDroplets(); err != nil {
+		oops(fmt.Sprintf("teller.min_bind_balance invalid: %v", err))
+	} else if c.Teller.MinBindBalance != "" && minBindBalance == 0 {
+		oops("teller.min_bind_balance must be positive, or empty to disable it")
 	}
-	if _, err := os.Stat(c.WavesAddresses); os.IsNotExist(err) {
-		oops("waves_addresses file does not exist")
+
+	switch c.Teller.EthBindBalanceCheck {
+	case "":
+	case BindBalanceCheckWarn, BindBalanceCheckReject:
+		if !c.EthRPC.Enabled || c.EthRPC.ExplorerURL != "" {
+			oops("teller.eth_bind_balance_check requires eth_rpc enabled with a geth node, eth_rpc.explorer_url can't read balances")
+		}
+	default:
+		oops(fmt.Sprintf("teller.eth_bind_balance_check must be \"%s\" or \"%s\", or empty to disable it", BindBalanceCheckWarn, BindBalanceCheckReject))
 	}
-	if c.WavesMDLAddresses == "" {
-		oops("waves_mdl_addresses missing")
+
+	for key, expr := range c.Teller.AddressFormats {
+		if _, err := regexp.Compile(expr); err != nil {
+			oops(fmt.Sprintf("teller.address_formats %s is not a valid regex: %v", key, err))
+		}
 	}
-	if _, err := os.Stat(c.WavesMDLAddresses); os.IsNotExist(err) {
-		oops("waves_mdl_addresses file does not exist")
+
+	for coinType, n := range c.Teller.MaxBoundAddressesPerCoin {
+		if n < 0 {
+			oops(fmt.Sprintf("teller.max_bound_addrs_per_coin %s can't be negative", coinType))
+		}
 	}
 
-	if !c.Dummy.Sender {
+	if !c.Dummy.Sender && !c.ReadOnly {
 		if c.MDLRPC.Address == "" {
 			oops("mdl_rpc.address missing")
 		}
 
+		if c.MDLRPC.BreakerThreshold < 0 {
+			oops("mdl_rpc.breaker_threshold can't be negative")
+		}
+
+		if c.MDLRPC.BreakerThreshold > 0 && c.MDLRPC.BreakerCooldown <= 0 {
+			oops("mdl_rpc.breaker_cooldown must be positive when mdl_rpc.breaker_threshold is set")
+		}
+
 		// test if mdl node rpc service is reachable
 		conn, err := net.Dial("tcp", c.MDLRPC.Address)
 		if err != nil {
@@ -429,32 +1411,37 @@ func (c Config) Validate() error {
 		}
 	}
 
-	if !c.Dummy.Scanner {
-		if c.BtcRPC.Enabled {
-			if c.BtcRPC.Server == "" {
-				oops("btc_rpc.server missing")
-			}
+	if !c.Dummy.Scanner && !c.ReadOnly {
+		if err := c.BtcRPC.Validate(); err != nil {
+			oops(err.Error())
+		}
 
-			if c.BtcRPC.User == "" {
-				oops("btc_rpc.user missing")
+		if c.BtcSweep.ColdAddress != "" {
+			if !c.BtcRPC.Enabled {
+				oops("btc_sweep.cold_address requires btc_rpc to be enabled")
 			}
-			if c.BtcRPC.Pass == "" {
-				oops("btc_rpc.pass missing")
+			if c.BtcSweep.WalletServer == "" {
+				oops("btc_sweep.wallet_server missing")
 			}
-			if c.BtcRPC.Cert == "" {
-				oops("btc_rpc.cert missing")
+			if c.BtcSweep.MinConfirmations < 1 {
+				oops("btc_sweep.min_confirmations must be at least 1")
 			}
-
-			if _, err := os.Stat(c.BtcRPC.Cert); os.IsNotExist(err) {
-				oops("btc_rpc.cert file does not exist")
+			if c.BtcSweep.FeePerByte <= 0 {
+				oops("btc_sweep.fee_per_byte must be positive")
 			}
 		}
 		if c.EthRPC.Enabled {
-			if c.EthRPC.Server == "" {
-				oops("eth_rpc.server missing")
-			}
-			if c.EthRPC.Port == "" {
-				oops("eth_rpc.port missing")
+			if c.EthRPC.ExplorerURL != "" {
+				if u, err := url.Parse(c.EthRPC.ExplorerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					oops("eth_rpc.explorer_url must be an http or https URL")
+				}
+			} else {
+				if c.EthRPC.Server == "" {
+					oops("eth_rpc.server missing")
+				}
+				if c.EthRPC.Port == "" {
+					oops("eth_rpc.port missing")
+				}
 			}
 		}
 
@@ -474,8 +1461,8 @@ func (c Config) Validate() error {
 			if c.WavesRPC.Port == "" {
 				oops("waves_rpc.port missing")
 			}
-			if c.WavesRPC.Protocol == "" {
-				oops("waves_rpc.protocol missing")
+			if c.WavesRPC.Protocol != "" && c.WavesRPC.Protocol != "http" && c.WavesRPC.Protocol != "https" {
+				oops("waves_rpc.protocol must be \"http\" or \"https\"")
 			}
 		}
 
@@ -486,8 +1473,23 @@ func (c Config) Validate() error {
 			if c.WavesMDLRPC.Port == "" {
 				oops("waves_mdl_rpc.port missing")
 			}
-			if c.WavesMDLRPC.Protocol == "" {
-				oops("waves_mdl_rpc.protocol missing")
+			if c.WavesMDLRPC.Protocol != "" && c.WavesMDLRPC.Protocol != "http" && c.WavesMDLRPC.Protocol != "https" {
+				oops("waves_mdl_rpc.protocol must be \"http\" or \"https\"")
+			}
+		}
+
+		transports := []struct {
+			key       string
+			transport HTTPTransport
+		}{
+			{"eth_rpc", c.EthRPC.HTTPTransport},
+			{"sky_rpc", c.SkyRPC.HTTPTransport},
+			{"waves_rpc", c.WavesRPC.HTTPTransport},
+			{"waves_mdl_rpc", c.WavesMDLRPC.HTTPTransport},
+		}
+		for _, t := range transports {
+			for _, err := range t.transport.validate(t.key) {
+				oops(err)
 			}
 		}
 
@@ -527,12 +1529,176 @@ func (c Config) Validate() error {
 		oops("waves_mdl_scanner.initial_scan_height must be >= 0")
 	}
 
+	if c.ScanPeriod <= 0 {
+		oops("scan_period must be positive")
+	}
+	if c.BalanceReconcileInterval < 0 {
+		oops("balance_reconcile_interval must be >= 0")
+	}
+	if c.BtcScanner.ScanPeriod <= 0 {
+		oops("btc_scanner.scan_period must be positive")
+	}
+	if c.EthScanner.ScanPeriod <= 0 {
+		oops("eth_scanner.scan_period must be positive")
+	}
+	if c.SkyScanner.ScanPeriod <= 0 {
+		oops("sky_scanner.scan_period must be positive")
+	}
+	if c.WavesScanner.ScanPeriod <= 0 {
+		oops("waves_scanner.scan_period must be positive")
+	}
+	if c.WavesMDLScanner.ScanPeriod <= 0 {
+		oops("waves_mdl_scanner.scan_period must be positive")
+	}
+
+	if c.BtcScanner.StallTimeout < 0 {
+		oops("btc_scanner.stall_timeout must be >= 0")
+	}
+	if c.EthScanner.StallTimeout < 0 {
+		oops("eth_scanner.stall_timeout must be >= 0")
+	}
+	if c.SkyScanner.StallTimeout < 0 {
+		oops("sky_scanner.stall_timeout must be >= 0")
+	}
+	if c.SkyScanner.BlockWindow < 0 {
+		oops("sky_scanner.block_window must be >= 0")
+	}
+	if c.WavesScanner.StallTimeout < 0 {
+		oops("waves_scanner.stall_timeout must be >= 0")
+	}
+	if c.WavesMDLScanner.StallTimeout < 0 {
+		oops("waves_mdl_scanner.stall_timeout must be >= 0")
+	}
+
+	if c.BtcScanner.DustValue < 0 {
+		oops("btc_scanner.dust_value must be >= 0")
+	}
+	if c.BtcScanner.MaxBlockLookback < 0 {
+		oops("btc_scanner.max_block_lookback must be >= 0")
+	}
+
+	if c.BtcScanner.LargeDepositValue < 0 {
+		oops("btc_scanner.large_deposit_value must be >= 0")
+	}
+	if c.BtcScanner.LargeDepositValue > 0 && c.BtcScanner.LargeDepositConfirmations <= c.BtcScanner.ConfirmationsRequired {
+		oops("btc_scanner.large_deposit_confirmations must be greater than btc_scanner.confirmations_required")
+	}
+
+	if c.EthScanner.DustValue < 0 {
+		oops("eth_scanner.dust_value must be >= 0")
+	}
+	if c.EthScanner.MaxBlockLookback < 0 {
+		oops("eth_scanner.max_block_lookback must be >= 0")
+	}
+
+	if c.EthScanner.LargeDepositValue < 0 {
+		oops("eth_scanner.large_deposit_value must be >= 0")
+	}
+	if c.EthScanner.LargeDepositValue > 0 && c.EthScanner.LargeDepositConfirmations <= c.EthScanner.ConfirmationsRequired {
+		oops("eth_scanner.large_deposit_confirmations must be greater than eth_scanner.confirmations_required")
+	}
+
+	if c.SkyScanner.DustValue < 0 {
+		oops("sky_scanner.dust_value must be >= 0")
+	}
+	if c.SkyScanner.MaxBlockLookback < 0 {
+		oops("sky_scanner.max_block_lookback must be >= 0")
+	}
+
+	if c.SkyScanner.LargeDepositValue < 0 {
+		oops("sky_scanner.large_deposit_value must be >= 0")
+	}
+	if c.SkyScanner.LargeDepositValue > 0 && c.SkyScanner.LargeDepositConfirmations <= c.SkyScanner.ConfirmationsRequired {
+		oops("sky_scanner.large_deposit_confirmations must be greater than sky_scanner.confirmations_required")
+	}
+
+	if c.WavesScanner.DustValue < 0 {
+		oops("waves_scanner.dust_value must be >= 0")
+	}
+	if c.WavesScanner.MaxBlockLookback < 0 {
+		oops("waves_scanner.max_block_lookback must be >= 0")
+	}
+
+	if c.WavesScanner.LargeDepositValue < 0 {
+		oops("waves_scanner.large_deposit_value must be >= 0")
+	}
+	if c.WavesScanner.LargeDepositValue > 0 && c.WavesScanner.LargeDepositConfirmations <= c.WavesScanner.ConfirmationsRequired {
+		oops("waves_scanner.large_deposit_confirmations must be greater than waves_scanner.confirmations_required")
+	}
+
+	if c.WavesMDLScanner.DustValue < 0 {
+		oops("waves_mdl_scanner.dust_value must be >= 0")
+	}
+	if c.WavesMDLScanner.MaxBlockLookback < 0 {
+		oops("waves_mdl_scanner.max_block_lookback must be >= 0")
+	}
+
+	if c.WavesMDLScanner.LargeDepositValue < 0 {
+		oops("waves_mdl_scanner.large_deposit_value must be >= 0")
+	}
+	if c.WavesMDLScanner.LargeDepositValue > 0 && c.WavesMDLScanner.LargeDepositConfirmations <= c.WavesMDLScanner.ConfirmationsRequired {
+		oops("waves_mdl_scanner.large_deposit_confirmations must be greater than waves_mdl_scanner.confirmations_required")
+	}
+
+	weightedConfirmations := []struct {
+		scanner               string
+		usdPerBlock           string
+		maxConfirmations      int64
+		confirmationsRequired int64
+		usdRateKey            string
+		usdRate               string
+	}{
+		{"btc_scanner", c.BtcScanner.ConfirmationsUSDPerBlock, c.BtcScanner.MaxConfirmations, c.BtcScanner.ConfirmationsRequired,
+			"mdl_btc_exchange_rate_usd", c.MDLExchanger.MDLBtcExchangeRateUSD},
+		{"eth_scanner", c.EthScanner.ConfirmationsUSDPerBlock, c.EthScanner.MaxConfirmations, c.EthScanner.ConfirmationsRequired,
+			"mdl_eth_exchange_rate_usd", c.MDLExchanger.MDLEthExchangeRateUSD},
+		{"sky_scanner", c.SkyScanner.ConfirmationsUSDPerBlock, c.SkyScanner.MaxConfirmations, c.SkyScanner.ConfirmationsRequired,
+			"mdl_sky_exchange_rate_usd", c.MDLExchanger.MDLSkyExchangeRateUSD},
+		{"waves_scanner", c.WavesScanner.ConfirmationsUSDPerBlock, c.WavesScanner.MaxConfirmations, c.WavesScanner.ConfirmationsRequired,
+			"mdl_waves_exchange_rate_usd", c.MDLExchanger.MDLWavesExchangeRateUSD},
+		{"waves_mdl_scanner", c.WavesMDLScanner.ConfirmationsUSDPerBlock, c.WavesMDLScanner.MaxConfirmations, c.WavesMDLScanner.ConfirmationsRequired,
+			"mdl_waves_mdl_exchange_rate_usd", c.MDLExchanger.MDLWavesMDLExchangeRateUSD},
+	}
+	for _, w := range weightedConfirmations {
+		if w.usdPerBlock == "" {
+			continue
+		}
+
+		if d, err := decimal.NewFromString(w.usdPerBlock); err != nil || d.Sign() <= 0 {
+			oops(fmt.Sprintf("%s.confirmations_usd_per_block must be a positive decimal", w.scanner))
+		}
+		if w.maxConfirmations <= w.confirmationsRequired {
+			oops(fmt.Sprintf("%s.max_confirmations must be greater than %s.confirmations_required", w.scanner, w.scanner))
+		}
+		// The USD value of a deposit is computed from the coin's USD rate
+		if d, err := decimal.NewFromString(w.usdRate); err != nil || d.Sign() <= 0 {
+			oops(fmt.Sprintf("mdl_exchanger.%s must be a positive decimal if %s.confirmations_usd_per_block is set", w.usdRateKey, w.scanner))
+		}
+	}
+
 	exchangeErrs := c.MDLExchanger.validate()
 	for _, err := range exchangeErrs {
 		oops(err.Error())
 	}
 
-	if !c.Dummy.Sender {
+	// Deposits of a coin that is scanned need a rate, even if its exchange is disabled
+	if c.BtcRPC.Enabled && c.MDLExchanger.MDLBtcExchangeRate == "" {
+		oops("mdl_exchanger.mdl_btc_exchange_rate missing, it is required while btc_rpc is enabled")
+	}
+	if c.EthRPC.Enabled && c.MDLExchanger.MDLEthExchangeRate == "" {
+		oops("mdl_exchanger.mdl_eth_exchange_rate missing, it is required while eth_rpc is enabled")
+	}
+	if c.SkyRPC.Enabled && c.MDLExchanger.MDLSkyExchangeRate == "" {
+		oops("mdl_exchanger.mdl_sky_exchange_rate missing, it is required while sky_rpc is enabled")
+	}
+	if c.WavesRPC.Enabled && c.MDLExchanger.MDLWavesExchangeRate == "" {
+		oops("mdl_exchanger.mdl_waves_exchange_rate missing, it is required while waves_rpc is enabled")
+	}
+	if c.WavesMDLRPC.Enabled && c.MDLExchanger.MDLWavesMDLExchangeRate == "" {
+		oops("mdl_exchanger.mdl_waves_mdl_exchange_rate missing, it is required while waves_mdl_rpc is enabled")
+	}
+
+	if !c.Dummy.Sender && !c.ReadOnly {
 		exchangeErrs := c.MDLExchanger.validateWallet()
 		for _, err := range exchangeErrs {
 			oops(err.Error())
@@ -543,6 +1709,18 @@ func (c Config) Validate() error {
 		oops(err.Error())
 	}
 
+	if err := c.AdminPanel.Validate(); err != nil {
+		oops(err.Error())
+	}
+
+	if err := c.Events.Validate(); err != nil {
+		oops(err.Error())
+	}
+
+	if err := c.Email.Validate(); err != nil {
+		oops(err.Error())
+	}
+
 	if len(errs) == 0 {
 		return nil
 	}
@@ -555,17 +1733,29 @@ func setDefaults() {
 	viper.SetDefault("profile", false)
 	viper.SetDefault("debug", true)
 	viper.SetDefault("logfile", "./teller.log")
+	viper.SetDefault("log_format", logger.FormatText)
 	viper.SetDefault("dbfile", "teller.db")
+	viper.SetDefault("compress_records", false)
+	viper.SetDefault("read_only", false)
 
 	// Teller
 	viper.SetDefault("teller.max_bound_btc_addrs", 2)
+	viper.SetDefault("teller.allow_prebind", true)
+	viper.SetDefault("teller.bind_retries", 3)
+	viper.SetDefault("teller.bind_cooldown", time.Duration(0))
+	viper.SetDefault("teller.coin_disabled_message", DefaultCoinDisabledMessage)
+	viper.SetDefault("teller.no_scanner_message", DefaultNoScannerMessage)
 
 	// MDLRPC
 	viper.SetDefault("mdl_rpc.address", "127.0.0.1:6430")
+	viper.SetDefault("mdl_rpc.breaker_threshold", 0)
+	viper.SetDefault("mdl_rpc.breaker_cooldown", time.Minute)
+	viper.SetDefault("mdl_rpc.min_node_version", "0.25.0")
 
 	// BtcRPC
 	viper.SetDefault("btc_rpc.server", "127.0.0.1:8334")
 	viper.SetDefault("btc_rpc.enabled", true)
+	viper.SetDefault("btc_rpc.disable_tls", false)
 
 	// EthRPC
 	viper.SetDefault("eth_rpc.enabled", false)
@@ -579,15 +1769,44 @@ func setDefaults() {
 	// WavesMDLRPC
 	viper.SetDefault("waves_mdl_rpc.enabled", false)
 
+	// Scanners inherit scan_period unless they set their own, see resolveScanPeriods
+	viper.SetDefault("scan_period", time.Second*20)
+	viper.SetDefault("discard_unknown_coin_types", false)
+	viper.SetDefault("balance_reconcile_interval", time.Duration(0))
+
 	// BtcScanner
-	viper.SetDefault("btc_scanner.scan_period", time.Second*20)
 	viper.SetDefault("btc_scanner.initial_scan_height", int64(492478))
 	viper.SetDefault("btc_scanner.confirmations_required", int64(1))
+	viper.SetDefault("btc_scanner.stall_timeout", time.Hour)
+
+	// EthScanner
+	viper.SetDefault("eth_scanner.stall_timeout", time.Hour)
+
+	// SkyScanner
+	viper.SetDefault("sky_scanner.stall_timeout", time.Hour)
+
+	// WavesScanner
+	viper.SetDefault("waves_scanner.stall_timeout", time.Hour)
+
+	// WavesMDLScanner
+	viper.SetDefault("waves_mdl_scanner.stall_timeout", time.Hour)
+
+	// BtcSweep
+	viper.SetDefault("btc_sweep.min_confirmations", int64(6))
+	viper.SetDefault("btc_sweep.fee_per_byte", int64(20))
 
 	// MDLExchanger
 	viper.SetDefault("mdl_exchanger.tx_confirmation_check_wait", time.Second*5)
 	viper.SetDefault("mdl_exchanger.max_decimals", 3)
 	viper.SetDefault("mdl_exchanger.buy_method", BuyMethodDirect)
+	viper.SetDefault("mdl_exchanger.usd_rate_max_age", time.Minute*10)
+	viper.SetDefault("mdl_exchanger.max_deposits_per_binding", 0)
+	viper.SetDefault("mdl_exchanger.coin_deprecation_window", time.Hour*24*30)
+	viper.SetDefault("mdl_exchanger.rate_phase_in", time.Duration(0))
+	viper.SetDefault("mdl_exchanger.min_reserved_hours", 0)
+	viper.SetDefault("mdl_exchanger.deduct_network_fee", false)
+	viper.SetDefault("mdl_exchanger.stale_deposit_threshold", time.Duration(0))
+	viper.SetDefault("mdl_exchanger.stale_deposit_check_interval", time.Minute*10)
 
 	// MDLExchanger BTC
 	viper.SetDefault("mdl_exchanger.mdl_btc_exchange_enabled", false)
@@ -608,9 +1827,28 @@ func setDefaults() {
 	viper.SetDefault("web.bind_enabled", true)
 	viper.SetDefault("web.send_enabled", true)
 	viper.SetDefault("web.http_addr", "127.0.0.1:7071")
-	viper.SetDefault("web.static_dir", "./web/build")
+	viper.SetDefault("web.static_dir", "")
 	viper.SetDefault("web.throttle_max", int64(60))
 	viper.SetDefault("web.throttle_duration", time.Minute)
+	viper.SetDefault("web.max_request_bytes", int64(64*1024))
+	viper.SetDefault("web.rate_format", RateFormatFixed)
+	viper.SetDefault("web.display_precision", 0)
+	viper.SetDefault("web.log_sample_rate", 1)
+	viper.SetDefault("web.available_as_number", false)
+	viper.SetDefault("web.available_null_on_error", false)
+	viper.SetDefault("web.errors_as_ok", false)
+	viper.SetDefault("web.handler_timeout", time.Second*30)
+	viper.SetDefault("web.sts_seconds", int64(31536000))
+	viper.SetDefault("web.sts_include_subdomains", false)
+	viper.SetDefault("web.sts_preload", false)
+	viper.SetDefault("web.max_clock_skew", time.Minute*5)
+	viper.SetDefault("web.event_stream_enabled", false)
+	viper.SetDefault("web.http_read_timeout", time.Second*10)
+	viper.SetDefault("web.http_write_timeout", time.Second*60)
+	viper.SetDefault("web.http_idle_timeout", time.Second*120)
+	viper.SetDefault("web.https_read_timeout", time.Second*10)
+	viper.SetDefault("web.https_write_timeout", time.Second*60)
+	viper.SetDefault("web.https_idle_timeout", time.Second*120)
 
 	// AdminPanel
 	viper.SetDefault("admin_panel.host", "127.0.0.1:7711")
@@ -621,6 +1859,18 @@ func setDefaults() {
 	viper.SetDefault("admin_panel.fix_mdl_value", 0)
 	viper.SetDefault("admin_panel.fix_usd_value", "0")
 	viper.SetDefault("admin_panel.fix_tx_value", 0)
+	viper.SetDefault("admin_panel.behind_proxy", false)
+
+	// Events
+	viper.SetDefault("events.enabled", false)
+	viper.SetDefault("events.subject", "teller.deposits")
+	viper.SetDefault("events.queue_size", 100)
+
+	// Email
+	viper.SetDefault("email.enabled", false)
+	viper.SetDefault("email.port", 587)
+	viper.SetDefault("email.queue_size", 100)
+	viper.SetDefault("email.user_notifications", false)
 
 	// DummySender
 	viper.SetDefault("dummy.http_addr", "127.0.0.1:4121")
@@ -628,6 +1878,21 @@ func setDefaults() {
 	viper.SetDefault("dummy.sender", false)
 }
 
+// resolveScanPeriods sets the scan_period of the scanners that don't set their own to the global scan_period
+func (c *Config) resolveScanPeriods() {
+	for _, p := range []*time.Duration{
+		&c.BtcScanner.ScanPeriod,
+		&c.EthScanner.ScanPeriod,
+		&c.SkyScanner.ScanPeriod,
+		&c.WavesScanner.ScanPeriod,
+		&c.WavesMDLScanner.ScanPeriod,
+	} {
+		if *p == 0 {
+			*p = c.ScanPeriod
+		}
+	}
+}
+
 // Load loads the configuration from "./$configName.*" where "*" is a
 // JSON, toml or yaml file (toml preferred).
 func Load(configName, appDir string) (Config, error) {
@@ -652,6 +1917,8 @@ func Load(configName, appDir string) (Config, error) {
 		return cfg, err
 	}
 
+	cfg.resolveScanPeriods()
+
 	if err := cfg.Validate(); err != nil {
 		return cfg, err
 	}
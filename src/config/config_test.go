@@ -0,0 +1,1020 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/MDL/src/wallet"
+)
+
+func TestResolveScanPeriods(t *testing.T) {
+	c := Config{
+		ScanPeriod: time.Second * 20,
+		EthScanner: EthScanner{
+			ScanPeriod: time.Second * 5,
+		},
+		WavesMDLScanner: WavesScanner{
+			ScanPeriod: time.Minute,
+		},
+	}
+
+	c.resolveScanPeriods()
+
+	// Unspecified scan periods inherit the global scan period
+	require.Equal(t, time.Second*20, c.BtcScanner.ScanPeriod)
+	require.Equal(t, time.Second*20, c.SkyScanner.ScanPeriod)
+	require.Equal(t, time.Second*20, c.WavesScanner.ScanPeriod)
+
+	// Specified scan periods override it
+	require.Equal(t, time.Second*5, c.EthScanner.ScanPeriod)
+	require.Equal(t, time.Minute, c.WavesMDLScanner.ScanPeriod)
+}
+
+func TestValidateScanPeriods(t *testing.T) {
+	c := Config{
+		ScanPeriod: time.Second * 20,
+		SkyScanner: SkyScanner{
+			ScanPeriod: -time.Second,
+		},
+	}
+	c.resolveScanPeriods()
+
+	err := c.Validate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "btc_scanner.scan_period")
+	require.Contains(t, err.Error(), "sky_scanner.scan_period must be positive")
+
+	// Without a global scan period, unspecified scan periods are invalid
+	c = Config{
+		EthScanner: EthScanner{
+			ScanPeriod: time.Second * 5,
+		},
+	}
+	c.resolveScanPeriods()
+
+	err = c.Validate()
+	require.Error(t, err)
+	require.Regexp(t, "(?m)^scan_period must be positive$", err.Error())
+	require.Contains(t, err.Error(), "btc_scanner.scan_period must be positive")
+	require.NotContains(t, err.Error(), "eth_scanner.scan_period")
+}
+
+func TestValidateBalanceReconcileInterval(t *testing.T) {
+	c := Config{
+		BalanceReconcileInterval: -time.Hour,
+	}
+	err := c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "balance_reconcile_interval must be >= 0")
+
+	c.BalanceReconcileInterval = 0
+	err = c.Validate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "balance_reconcile_interval")
+}
+
+func TestValidateEthBindBalanceCheck(t *testing.T) {
+	c := Config{
+		Teller: Teller{
+			EthBindBalanceCheck: BindBalanceCheckReject,
+		},
+		EthRPC: EthRPC{
+			Enabled: true,
+			Server:  "127.0.0.1",
+			Port:    "8545",
+		},
+	}
+	err := c.Validate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "teller.eth_bind_balance_check")
+
+	// A block explorer can't read balances
+	c.EthRPC.ExplorerURL = "https://api.etherscan.io/api"
+	err = c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "teller.eth_bind_balance_check requires eth_rpc enabled with a geth node")
+
+	c.EthRPC = EthRPC{}
+	err = c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "teller.eth_bind_balance_check requires eth_rpc enabled with a geth node")
+
+	c.Teller.EthBindBalanceCheck = "foo"
+	err = c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `teller.eth_bind_balance_check must be "warn" or "reject", or empty to disable it`)
+}
+
+func TestValidateRPCTransport(t *testing.T) {
+	c := Config{
+		SkyRPC: SkyRPC{
+			Enabled: true,
+			Server:  "127.0.0.1",
+			Port:    "6420",
+			HTTPTransport: HTTPTransport{
+				MaxIdleConns:        10,
+				MaxIdleConnsPerHost: 5,
+				IdleConnTimeout:     time.Second * 30,
+				KeepAlive:           -time.Second,
+			},
+		},
+	}
+	err := c.Validate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "sky_rpc")
+
+	c.SkyRPC.MaxIdleConnsPerHost = -1
+	c.SkyRPC.IdleConnTimeout = -time.Second
+	err = c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "sky_rpc.max_idle_conns_per_host can't be negative")
+	require.Contains(t, err.Error(), "sky_rpc.idle_conn_timeout can't be negative")
+}
+
+func TestValidateBindCooldown(t *testing.T) {
+	c := Config{
+		Teller: Teller{
+			BindCooldown: time.Minute,
+		},
+	}
+	err := c.Validate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "teller.bind_cooldown")
+
+	c.Teller.BindCooldown = -time.Second
+	err = c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "teller.bind_cooldown can't be negative")
+}
+
+func TestValidateAddressFormats(t *testing.T) {
+	c := Config{
+		Teller: Teller{
+			AddressFormats: map[string]string{
+				"MDL": "[1-9A-HJ-NP-Za-km-z]{25,35}",
+				"ETH": "0x[0-9a-fA-F]{40}",
+			},
+		},
+	}
+	err := c.Validate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "teller.address_formats")
+
+	c.Teller.AddressFormats["ETH"] = "0x[0-9a-f"
+	err = c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "teller.address_formats ETH is not a valid regex")
+}
+
+func TestValidateWeightedConfirmations(t *testing.T) {
+	c := Config{
+		BtcScanner: BtcScanner{
+			ConfirmationsRequired:    1,
+			ConfirmationsUSDPerBlock: "foo",
+			MaxConfirmations:         1,
+		},
+		EthScanner: EthScanner{
+			ConfirmationsRequired:    12,
+			ConfirmationsUSDPerBlock: "-100",
+			MaxConfirmations:         30,
+		},
+		MDLExchanger: MDLExchanger{
+			MDLEthExchangeRateUSD: "500",
+		},
+	}
+
+	err := c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "btc_scanner.confirmations_usd_per_block must be a positive decimal")
+	require.Contains(t, err.Error(), "btc_scanner.max_confirmations must be greater than btc_scanner.confirmations_required")
+	require.Contains(t, err.Error(), "mdl_exchanger.mdl_btc_exchange_rate_usd must be a positive decimal if btc_scanner.confirmations_usd_per_block is set")
+	require.Contains(t, err.Error(), "eth_scanner.confirmations_usd_per_block must be a positive decimal")
+	require.NotContains(t, err.Error(), "eth_scanner.max_confirmations")
+	require.NotContains(t, err.Error(), "mdl_eth_exchange_rate_usd")
+
+	c.BtcScanner.ConfirmationsUSDPerBlock = "10000.5"
+	c.BtcScanner.MaxConfirmations = 6
+	c.MDLExchanger.MDLBtcExchangeRateUSD = "8000"
+	c.EthScanner.ConfirmationsUSDPerBlock = "1000"
+
+	err = c.Validate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "confirmations_usd_per_block")
+	require.NotContains(t, err.Error(), "max_confirmations")
+
+	// Not validated while disabled
+	c = Config{
+		SkyScanner: SkyScanner{
+			MaxConfirmations: 1,
+		},
+	}
+	err = c.Validate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "sky_scanner.max_confirmations")
+}
+
+func TestValidateExchangeRates(t *testing.T) {
+	validRates := MDLExchanger{
+		MDLBtcExchangeRate:      "100",
+		MDLEthExchangeRate:      "10",
+		MDLSkyExchangeRate:      "1",
+		MDLWavesExchangeRate:    "1",
+		MDLWavesMDLExchangeRate: "1",
+		MaxDecimals:             3,
+		BuyMethod:               BuyMethodDirect,
+	}
+
+	tt := []struct {
+		name   string
+		modify func(c *Config)
+		err    string
+	}{
+		{
+			name:   "all rates set",
+			modify: func(c *Config) {},
+		},
+		{
+			name: "disabled coin with an empty rate",
+			modify: func(c *Config) {
+				c.MDLExchanger.MDLBtcExchangeEnabled = false
+				c.MDLExchanger.MDLBtcExchangeRate = ""
+			},
+		},
+		{
+			name: "enabled coin with an empty rate",
+			modify: func(c *Config) {
+				c.MDLExchanger.MDLBtcExchangeEnabled = true
+				c.MDLExchanger.MDLBtcExchangeRate = ""
+			},
+			err: "mdl_exchanger.mdl_btc_exchange_rate invalid",
+		},
+		{
+			name: "disabled coin with an invalid rate",
+			modify: func(c *Config) {
+				c.MDLExchanger.MDLEthExchangeEnabled = false
+				c.MDLExchanger.MDLEthExchangeRate = "foo"
+			},
+			err: "mdl_exchanger.mdl_eth_exchange_rate invalid",
+		},
+		{
+			name: "scanned coin with an empty rate",
+			modify: func(c *Config) {
+				c.SkyRPC.Enabled = true
+				c.MDLExchanger.MDLSkyExchangeEnabled = false
+				c.MDLExchanger.MDLSkyExchangeRate = ""
+			},
+			err: "mdl_exchanger.mdl_sky_exchange_rate missing, it is required while sky_rpc is enabled",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Config{
+				MDLExchanger: validRates,
+			}
+			tc.modify(&c)
+
+			errs := c.MDLExchanger.validate()
+
+			// The rest of the config is incomplete, only the rate errors are checked
+			err := c.Validate()
+			require.Error(t, err)
+
+			if tc.err == "" {
+				require.Empty(t, errs)
+				require.NotContains(t, err.Error(), "_exchange_rate")
+				return
+			}
+
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestValidateMaxOutstanding(t *testing.T) {
+	c := MDLExchanger{
+		MDLBtcExchangeRate:      "100",
+		MDLEthExchangeRate:      "10",
+		MDLSkyExchangeRate:      "1",
+		MDLWavesExchangeRate:    "1",
+		MDLWavesMDLExchangeRate: "1",
+		BuyMethod:               BuyMethodDirect,
+	}
+
+	for _, v := range []string{"", "1", "100000", "0.5"} {
+		c.MaxOutstanding = v
+		require.Empty(t, c.validate(), v)
+	}
+
+	n, err := MDLExchanger{MaxOutstanding: "1.5"}.MaxOutstandingDroplets()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1500000), n)
+
+	n, err = MDLExchanger{}.MaxOutstandingDroplets()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), n)
+
+	for _, v := range []string{"0", "-1", "foo"} {
+		c.MaxOutstanding = v
+		errs := c.validate()
+		require.Len(t, errs, 1, v)
+		require.Contains(t, errs[0].Error(), "mdl_exchanger.max_outstanding", v)
+	}
+}
+
+func TestValidateExpectedAmountTolerance(t *testing.T) {
+	c := MDLExchanger{
+		MDLBtcExchangeRate:      "100",
+		MDLEthExchangeRate:      "10",
+		MDLSkyExchangeRate:      "1",
+		MDLWavesExchangeRate:    "1",
+		MDLWavesMDLExchangeRate: "1",
+		BuyMethod:               BuyMethodDirect,
+	}
+
+	for _, v := range []string{"", "0", "0.01", "1%", "50bps"} {
+		c.ExpectedAmountTolerance = v
+		require.Empty(t, c.validate(), v)
+	}
+
+	d, err := MDLExchanger{ExpectedAmountTolerance: "1%"}.ExpectedAmountToleranceDecimal()
+	require.NoError(t, err)
+	require.Equal(t, "0.01", d.String())
+
+	d, err = MDLExchanger{}.ExpectedAmountToleranceDecimal()
+	require.NoError(t, err)
+	require.True(t, d.IsZero())
+
+	for _, v := range []string{"-0.01", "foo"} {
+		c.ExpectedAmountTolerance = v
+		errs := c.validate()
+		require.Len(t, errs, 1, v)
+		require.Contains(t, errs[0].Error(), "mdl_exchanger.expected_amount_tolerance", v)
+	}
+}
+
+func TestValidateSpread(t *testing.T) {
+	c := MDLExchanger{
+		MDLBtcExchangeRate:      "100",
+		MDLEthExchangeRate:      "10",
+		MDLSkyExchangeRate:      "1",
+		MDLWavesExchangeRate:    "1",
+		MDLWavesMDLExchangeRate: "1",
+		BuyMethod:               BuyMethodDirect,
+	}
+
+	for _, v := range []string{"", "0", "2", "0.5", "99.99"} {
+		c.MDLEthSpread = v
+		require.Empty(t, c.validate(), v)
+	}
+
+	for _, v := range []string{"-1", "100", "150", "2%", "foo"} {
+		c.MDLEthSpread = v
+		errs := c.validate()
+		require.Len(t, errs, 1, v)
+		require.Contains(t, errs[0].Error(), "mdl_exchanger.mdl_eth_spread", v)
+	}
+}
+
+func TestValidateMaxDecimalsPolicy(t *testing.T) {
+	c := MDLExchanger{
+		MDLBtcExchangeRate:      "100",
+		MDLEthExchangeRate:      "10",
+		MDLSkyExchangeRate:      "1",
+		MDLWavesExchangeRate:    "1",
+		MDLWavesMDLExchangeRate: "1",
+		MaxDecimals:             2,
+		BuyMethod:               BuyMethodDirect,
+	}
+
+	// No policy
+	require.Empty(t, c.validate())
+
+	// Within the policy
+	c.MaxDecimalsPolicy = map[string]int{
+		"BTC": 3,
+		"ETH": 2,
+	}
+	require.Empty(t, c.validate())
+
+	// Violating the policy of one coin type
+	c.MaxDecimals = 3
+	errs := c.validate()
+	require.Len(t, errs, 1)
+	require.Equal(t, "mdl_exchanger.max_decimals=3 exceeds the mdl_exchanger.max_decimals_policy of ETH=2", errs[0].Error())
+
+	// Violating the policy of several coin types, reported in coin type order
+	c.MaxDecimalsPolicy["SKY"] = 0
+	errs = c.validate()
+	require.Len(t, errs, 2)
+	require.Equal(t, "mdl_exchanger.max_decimals=3 exceeds the mdl_exchanger.max_decimals_policy of ETH=2", errs[0].Error())
+	require.Equal(t, "mdl_exchanger.max_decimals=3 exceeds the mdl_exchanger.max_decimals_policy of SKY=0", errs[1].Error())
+
+	c.MaxDecimals = 0
+	c.MaxDecimalsPolicy = map[string]int{
+		"BTC": -1,
+	}
+	errs = c.validate()
+	require.Len(t, errs, 1)
+	require.Equal(t, "mdl_exchanger.max_decimals_policy BTC can't be negative", errs[0].Error())
+}
+
+func TestValidateNetworkFee(t *testing.T) {
+	c := MDLExchanger{
+		MDLBtcExchangeRate:      "100",
+		MDLEthExchangeRate:      "10",
+		MDLSkyExchangeRate:      "1",
+		MDLWavesExchangeRate:    "1",
+		MDLWavesMDLExchangeRate: "1",
+		BuyMethod:               BuyMethodDirect,
+	}
+
+	for _, v := range []string{"", "0", "1", "0.5"} {
+		c.NetworkFee = v
+		require.Empty(t, c.validate(), v)
+	}
+
+	n, err := MDLExchanger{NetworkFee: "1.5"}.NetworkFeeDroplets()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1500000), n)
+
+	for _, v := range []string{"-1", "foo"} {
+		c.NetworkFee = v
+		errs := c.validate()
+		require.Len(t, errs, 1, v)
+		require.Contains(t, errs[0].Error(), "mdl_exchanger.network_fee invalid", v)
+	}
+
+	// A fee is required if it is deducted
+	c.DeductNetworkFee = true
+	c.NetworkFee = ""
+	errs := c.validate()
+	require.Len(t, errs, 1)
+	require.Equal(t, "mdl_exchanger.network_fee is required if mdl_exchanger.deduct_network_fee is enabled", errs[0].Error())
+
+	c.NetworkFee = "0.5"
+	c.MaxDecimals = 3
+	require.Empty(t, c.validate())
+
+	// The net payout must not have more decimal places than max_decimals
+	for _, v := range []string{"0.0005", "1.2345"} {
+		c.NetworkFee = v
+		errs = c.validate()
+		require.Len(t, errs, 1, v)
+		require.Equal(t, "mdl_exchanger.network_fee can't have more decimal places than mdl_exchanger.max_decimals=3", errs[0].Error(), v)
+	}
+
+	c.NetworkFee = "0.500"
+	require.Empty(t, c.validate())
+
+	c.MaxDecimals = 0
+	c.NetworkFee = "0.5"
+	errs = c.validate()
+	require.Len(t, errs, 1)
+	require.Equal(t, "mdl_exchanger.network_fee can't have more decimal places than mdl_exchanger.max_decimals=0", errs[0].Error())
+}
+
+func TestMinBindBalanceDroplets(t *testing.T) {
+	n, err := Teller{MinBindBalance: "1000.5"}.MinBindBalanceDroplets()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000500000), n)
+
+	n, err = Teller{}.MinBindBalanceDroplets()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), n)
+
+	_, err = Teller{MinBindBalance: "foo"}.MinBindBalanceDroplets()
+	require.Error(t, err)
+}
+
+func TestValidateStaleDeposits(t *testing.T) {
+	c := MDLExchanger{
+		MDLBtcExchangeRate:      "100",
+		MDLEthExchangeRate:      "10",
+		MDLSkyExchangeRate:      "1",
+		MDLWavesExchangeRate:    "1",
+		MDLWavesMDLExchangeRate: "1",
+		BuyMethod:               BuyMethodDirect,
+	}
+
+	// Disabled
+	require.Empty(t, c.validate())
+
+	c.StaleDepositThreshold = time.Hour * 6
+	errs := c.validate()
+	require.Len(t, errs, 1)
+	require.Equal(t, "mdl_exchanger.stale_deposit_check_interval must be positive if mdl_exchanger.stale_deposit_threshold is set", errs[0].Error())
+
+	c.StaleDepositCheckInterval = time.Minute * 10
+	require.Empty(t, c.validate())
+
+	c.StaleDepositThreshold = -time.Hour
+	errs = c.validate()
+	require.Len(t, errs, 1)
+	require.Equal(t, "mdl_exchanger.stale_deposit_threshold can't be negative", errs[0].Error())
+}
+
+func TestValidateRatePhaseIn(t *testing.T) {
+	c := MDLExchanger{
+		MDLBtcExchangeRate:      "100",
+		MDLEthExchangeRate:      "10",
+		MDLSkyExchangeRate:      "1",
+		MDLWavesExchangeRate:    "1",
+		MDLWavesMDLExchangeRate: "1",
+		BuyMethod:               BuyMethodDirect,
+		RatePhaseIn:             time.Minute * 30,
+	}
+	require.Empty(t, c.validate())
+
+	c.RatePhaseIn = -time.Minute
+	errs := c.validate()
+	require.Len(t, errs, 1)
+	require.Equal(t, "mdl_exchanger.rate_phase_in can't be negative", errs[0].Error())
+}
+
+func TestValidateRateTiers(t *testing.T) {
+	tt := []struct {
+		name  string
+		tiers []RateTier
+		err   string
+	}{
+		{
+			name: "valid",
+			tiers: []RateTier{
+				{MinAmount: "0.5", Rate: "110"},
+				{MinAmount: "10", Rate: "1/100"},
+			},
+		},
+		{
+			name: "invalid rate",
+			tiers: []RateTier{
+				{MinAmount: "1", Rate: "foo"},
+			},
+			err: "mdl_exchanger.mdl_btc_exchange_rate_tiers[0].rate invalid",
+		},
+		{
+			name: "invalid min amount",
+			tiers: []RateTier{
+				{MinAmount: "1/2", Rate: "110"},
+			},
+			err: "mdl_exchanger.mdl_btc_exchange_rate_tiers[0].min_amount invalid",
+		},
+		{
+			name: "zero min amount",
+			tiers: []RateTier{
+				{MinAmount: "0", Rate: "110"},
+			},
+			err: "mdl_exchanger.mdl_btc_exchange_rate_tiers[0].min_amount must be positive",
+		},
+		{
+			name: "min amounts not increasing",
+			tiers: []RateTier{
+				{MinAmount: "10", Rate: "125"},
+				{MinAmount: "10", Rate: "110"},
+			},
+			err: "mdl_exchanger.mdl_btc_exchange_rate_tiers[1].min_amount must be larger than the min_amount of the previous tier",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := MDLExchanger{
+				MDLBtcExchangeRate:      "100",
+				MDLEthExchangeRate:      "10",
+				MDLSkyExchangeRate:      "1",
+				MDLWavesExchangeRate:    "1",
+				MDLWavesMDLExchangeRate: "1",
+				MDLBtcExchangeRateTiers: tc.tiers,
+				BuyMethod:               BuyMethodDirect,
+			}
+
+			errs := c.validate()
+			if tc.err == "" {
+				require.Empty(t, errs)
+				return
+			}
+
+			require.Len(t, errs, 1)
+			require.Contains(t, errs[0].Error(), tc.err)
+		})
+	}
+}
+
+func TestValidateEncryptedWallet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teller-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := wallet.NewWallet("encrypted.wlt", wallet.Options{
+		Label: "encrypted",
+		Seed:  "encrypted wallet test seed",
+	})
+	require.NoError(t, err)
+	_, err = w.GenerateAddresses(1)
+	require.NoError(t, err)
+	err = w.Lock([]byte("pass"), wallet.CryptoTypeSha256Xor)
+	require.NoError(t, err)
+	err = w.Save(dir)
+	require.NoError(t, err)
+
+	wltFile := filepath.Join(dir, "encrypted.wlt")
+
+	passwordFile := filepath.Join(dir, "password")
+	err = ioutil.WriteFile(passwordFile, []byte("pass\n"), 0600)
+	require.NoError(t, err)
+
+	wrongPasswordFile := filepath.Join(dir, "wrong-password")
+	err = ioutil.WriteFile(wrongPasswordFile, []byte("wrong"), 0600)
+	require.NoError(t, err)
+
+	os.Setenv("TELLER_TEST_WALLET_PASSWORD", "pass")
+	defer os.Unsetenv("TELLER_TEST_WALLET_PASSWORD")
+
+	tt := []struct {
+		name   string
+		modify func(c *MDLExchanger)
+		err    string
+	}{
+		{
+			name: "no password configured",
+			err:  "is encrypted, mdl_exchanger.wallet_password_env or mdl_exchanger.wallet_password_file is required to send",
+		},
+		{
+			name: "no password configured, sending disabled",
+			modify: func(c *MDLExchanger) {
+				c.SendEnabled = false
+			},
+		},
+		{
+			name: "password file",
+			modify: func(c *MDLExchanger) {
+				c.WalletPasswordFile = passwordFile
+			},
+		},
+		{
+			name: "wrong password file",
+			modify: func(c *MDLExchanger) {
+				c.WalletPasswordFile = wrongPasswordFile
+			},
+			err: "can't be unlocked with the configured password",
+		},
+		{
+			name: "missing password file",
+			modify: func(c *MDLExchanger) {
+				c.WalletPasswordFile = filepath.Join(dir, "missing")
+			},
+			err: "mdl_exchanger.wallet_password_file read failed",
+		},
+		{
+			name: "password env",
+			modify: func(c *MDLExchanger) {
+				c.WalletPasswordEnv = "TELLER_TEST_WALLET_PASSWORD"
+				c.WalletPasswordFile = wrongPasswordFile
+			},
+		},
+		{
+			name: "unset password env",
+			modify: func(c *MDLExchanger) {
+				c.WalletPasswordEnv = "TELLER_TEST_WALLET_PASSWORD_UNSET"
+			},
+			err: "environment variable TELLER_TEST_WALLET_PASSWORD_UNSET is not set",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := MDLExchanger{
+				Wallet:      wltFile,
+				SendEnabled: true,
+			}
+			if tc.modify != nil {
+				tc.modify(&c)
+			}
+
+			errs := c.validateWallet()
+			if tc.err == "" {
+				require.Empty(t, errs)
+				return
+			}
+
+			require.Len(t, errs, 1)
+			require.Contains(t, errs[0].Error(), tc.err)
+		})
+	}
+}
+
+func TestValidateWebResponseHeaders(t *testing.T) {
+	c := Web{
+		HTTPAddr: "127.0.0.1:7071",
+		ResponseHeaders: map[string]string{
+			"server":        "",
+			"Cache-Control": "no-store",
+			"X-Custom_1":    "a, b",
+		},
+	}
+	require.NoError(t, c.Validate())
+
+	for _, name := range []string{"", "X Custom", "X-Custom:", "Über", "X-(Custom)"} {
+		c.ResponseHeaders = map[string]string{
+			name: "1",
+		}
+		err := c.Validate()
+		require.Error(t, err, name)
+		require.Contains(t, err.Error(), "invalid header name")
+	}
+
+	c.ResponseHeaders = map[string]string{
+		"X-Custom": "1\r\nSet-Cookie: a=b",
+	}
+	err := c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line break")
+}
+
+func TestValidateWebMaxClockSkew(t *testing.T) {
+	c := Web{
+		HTTPAddr:     "127.0.0.1:7071",
+		MaxClockSkew: time.Minute * 5,
+	}
+	require.NoError(t, c.Validate())
+
+	// Disabled
+	c.MaxClockSkew = 0
+	require.NoError(t, c.Validate())
+
+	c.MaxClockSkew = -time.Minute
+	err := c.Validate()
+	require.Error(t, err)
+	require.Equal(t, "web.max_clock_skew can't be negative", err.Error())
+}
+
+func TestValidateWebDisplayPrecision(t *testing.T) {
+	c := Web{
+		HTTPAddr: "127.0.0.1:7071",
+	}
+	require.NoError(t, c.Validate())
+	require.Equal(t, 6, c.MDLDisplayPrecision())
+
+	c.DisplayPrecision = 2
+	require.NoError(t, c.Validate())
+	require.Equal(t, 2, c.MDLDisplayPrecision())
+
+	for _, p := range []int{-1, 7} {
+		c.DisplayPrecision = p
+		err := c.Validate()
+		require.Error(t, err)
+		require.Equal(t, "web.display_precision must be between 0 and 6", err.Error())
+	}
+}
+
+func TestValidateWebSTS(t *testing.T) {
+	c := Web{
+		HTTPAddr:   "127.0.0.1:7071",
+		STSSeconds: 31536000,
+	}
+	require.NoError(t, c.Validate())
+
+	// Disabled
+	c.STSSeconds = 0
+	require.NoError(t, c.Validate())
+
+	c.STSSeconds = -1
+	err := c.Validate()
+	require.Error(t, err)
+	require.Equal(t, "web.sts_seconds can't be negative", err.Error())
+
+	c.STSSeconds = 300
+	c.STSIncludeSubdomains = true
+	require.NoError(t, c.Validate())
+
+	// Preload needs includeSubDomains and a max-age of at least a year
+	c.STSPreload = true
+	err = c.Validate()
+	require.Error(t, err)
+	require.Equal(t, "web.sts_preload requires web.sts_include_subdomains and a web.sts_seconds of at least 31536000", err.Error())
+
+	c.STSSeconds = 31536000
+	require.NoError(t, c.Validate())
+
+	c.STSIncludeSubdomains = false
+	err = c.Validate()
+	require.Error(t, err)
+}
+
+func TestValidateWebLogSampleRate(t *testing.T) {
+	c := Web{
+		HTTPAddr:      "127.0.0.1:7071",
+		LogSampleRate: 100,
+	}
+	require.NoError(t, c.Validate())
+
+	c.LogSampleRate = 0
+	require.NoError(t, c.Validate())
+
+	c.LogSampleRate = -1
+	err := c.Validate()
+	require.Error(t, err)
+	require.Equal(t, "web.log_sample_rate can't be negative", err.Error())
+}
+
+func TestValidateWebListenerTimeouts(t *testing.T) {
+	c := Web{
+		HTTPAddr:          "127.0.0.1:7071",
+		HTTPReadTimeout:   time.Second * 5,
+		HTTPWriteTimeout:  time.Second * 30,
+		HTTPIdleTimeout:   time.Minute,
+		HTTPSReadTimeout:  time.Second * 10,
+		HTTPSWriteTimeout: time.Minute,
+		HTTPSIdleTimeout:  time.Minute * 2,
+	}
+	require.NoError(t, c.Validate())
+
+	require.Equal(t, ListenerTimeouts{
+		Read:  time.Second * 5,
+		Write: time.Second * 30,
+		Idle:  time.Minute,
+	}, c.HTTPTimeouts())
+	require.Equal(t, ListenerTimeouts{
+		Read:  time.Second * 10,
+		Write: time.Minute,
+		Idle:  time.Minute * 2,
+	}, c.HTTPSTimeouts())
+
+	// 0 disables a timeout
+	c.HTTPIdleTimeout = 0
+	require.NoError(t, c.Validate())
+
+	c.HTTPSWriteTimeout = -time.Second
+	err := c.Validate()
+	require.Error(t, err)
+	require.Equal(t, "web.https_write_timeout can't be negative", err.Error())
+}
+
+func TestValidateEmail(t *testing.T) {
+	c := Email{
+		Enabled: true,
+		Host:    "smtp.example.com",
+		Port:    587,
+		From:    "Teller <teller@example.com>",
+		To:      []string{"ops@example.com"},
+	}
+	require.NoError(t, c.Validate())
+
+	tt := []struct {
+		name   string
+		modify func(*Email)
+		err    string
+	}{
+		{"missing host", func(c *Email) { c.Host = "" }, "email.host missing"},
+		{"invalid port", func(c *Email) { c.Port = 0 }, "email.port must be between 1 and 65535"},
+		{"invalid from", func(c *Email) { c.From = "teller" }, "email.from is not a valid email address"},
+		{"missing to", func(c *Email) { c.To = nil }, "email.to missing"},
+		{"invalid to", func(c *Email) { c.To = []string{"ops@example.com", "ops"} }, "email.to \"ops\" is not a valid email address"},
+		{"negative queue size", func(c *Email) { c.QueueSize = -1 }, "email.queue_size can't be negative"},
+		{"relative opt out url", func(c *Email) { c.OptOutURL = "/unsubscribe" }, "email.opt_out_url must be an absolute http or https URL"},
+		{"user notifications while disabled", func(c *Email) { c.Enabled = false; c.UserNotifications = true }, "email.user_notifications requires email.enabled"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := c
+			tc.modify(&c)
+			err := c.Validate()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+
+	// Not validated while disabled
+	require.NoError(t, Email{}.Validate())
+
+	c.UserNotifications = true
+	c.OptOutURL = "https://example.com/unsubscribe"
+	require.NoError(t, c.Validate())
+}
+
+const testCertPEM = `-----BEGIN CERTIFICATE-----
+MIIBszCCAVmgAwIBAgIQb2y8dbq5
+-----END CERTIFICATE-----
+`
+
+func TestValidateBtcRPC(t *testing.T) {
+	f, err := ioutil.TempFile("", "btcd-rpc.cert")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(testCertPEM)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	base := BtcRPC{
+		Enabled: true,
+		Server:  "localhost:8334",
+		User:    "user",
+		Pass:    "pass",
+	}
+
+	// TLS with a cert file
+	c := base
+	c.Cert = f.Name()
+	require.NoError(t, c.Validate())
+	certs, err := c.Certificates()
+	require.NoError(t, err)
+	require.Equal(t, testCertPEM, string(certs))
+
+	// TLS with an inline cert
+	c = base
+	c.CertPEM = testCertPEM
+	require.NoError(t, c.Validate())
+	certs, err = c.Certificates()
+	require.NoError(t, err)
+	require.Equal(t, testCertPEM, string(certs))
+
+	// No TLS
+	c = base
+	c.DisableTLS = true
+	require.NoError(t, c.Validate())
+	certs, err = c.Certificates()
+	require.NoError(t, err)
+	require.Nil(t, certs)
+
+	tt := []struct {
+		name   string
+		modify func(*BtcRPC)
+		err    string
+	}{
+		{"missing server", func(c *BtcRPC) { c.Server = ""; c.Cert = f.Name() }, "btc_rpc.server missing"},
+		{"missing cert", func(c *BtcRPC) {}, "btc_rpc.cert or btc_rpc.cert_pem is required unless btc_rpc.disable_tls is true"},
+		{"cert file does not exist", func(c *BtcRPC) { c.Cert = f.Name() + ".missing" }, "btc_rpc.cert file does not exist"},
+		{"cert and cert_pem", func(c *BtcRPC) { c.Cert = f.Name(); c.CertPEM = testCertPEM }, "only one of btc_rpc.cert and btc_rpc.cert_pem may be set"},
+		{"invalid cert_pem", func(c *BtcRPC) { c.CertPEM = "not a cert" }, "btc_rpc.cert_pem is not a PEM encoded certificate"},
+		{"disable_tls with cert", func(c *BtcRPC) { c.DisableTLS = true; c.Cert = f.Name() }, "btc_rpc.cert and btc_rpc.cert_pem must be empty when btc_rpc.disable_tls is true"},
+		{"disable_tls with cert_pem", func(c *BtcRPC) { c.DisableTLS = true; c.CertPEM = testCertPEM }, "btc_rpc.cert and btc_rpc.cert_pem must be empty when btc_rpc.disable_tls is true"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := base
+			tc.modify(&c)
+			err := c.Validate()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+
+	// Not validated while disabled
+	require.NoError(t, BtcRPC{}.Validate())
+}
+
+func TestValidateAdminPanelHosts(t *testing.T) {
+	c := AdminPanel{
+		Host: "127.0.0.1:7711",
+	}
+	require.NoError(t, c.Validate())
+	require.Equal(t, []string{"127.0.0.1:7711"}, c.Addrs())
+
+	c.Hosts = []string{"10.0.0.1:7711", "[::1]:7711"}
+	require.NoError(t, c.Validate())
+	require.Equal(t, []string{"127.0.0.1:7711", "10.0.0.1:7711", "[::1]:7711"}, c.Addrs())
+
+	// An empty host disables the admin panel
+	c = AdminPanel{}
+	require.NoError(t, c.Validate())
+	require.Empty(t, c.Addrs())
+
+	// Hosts can be used without host
+	c.Hosts = []string{"10.0.0.1:7711"}
+	require.NoError(t, c.Validate())
+	require.Equal(t, []string{"10.0.0.1:7711"}, c.Addrs())
+
+	for _, addr := range []string{"", "10.0.0.1", "localhost"} {
+		c.Hosts = []string{"10.0.0.1:7711", addr}
+		err := c.Validate()
+		require.Error(t, err, addr)
+		require.Contains(t, err.Error(), "is not a valid host:port")
+	}
+
+	c.Host = "10.0.0.1:7711"
+	c.Hosts = []string{"10.0.0.1:7711"}
+	err := c.Validate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is listed more than once")
+}
+
+func TestValidateAdminPanelAllowedIPs(t *testing.T) {
+	c := AdminPanel{
+		AllowedIPs: []string{"127.0.0.1/32", "10.0.0.0/8", "::1/128"},
+	}
+	require.NoError(t, c.Validate())
+
+	for _, cidr := range []string{"", "10.0.0.1", "10.0.0.0/33", "localhost/32"} {
+		c.AllowedIPs = []string{"127.0.0.1/32", cidr}
+		err := c.Validate()
+		require.Error(t, err, cidr)
+		require.Contains(t, err.Error(), "is not a valid CIDR")
+	}
+}
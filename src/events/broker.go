@@ -0,0 +1,57 @@
+package events
+
+import "sync"
+
+const defaultSubscriberBufferSize = 10
+
+// Broker is a Publisher that fans events out to in-process subscribers, e.g. the /api/events streams.
+// Publish never blocks, a subscriber that isn't keeping up misses events
+type Broker struct {
+	sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// NewBroker creates a Broker
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends the event to every subscriber with room in its buffer
+func (b *Broker) Publish(e Event) error {
+	b.Lock()
+	defer b.Unlock()
+
+	for c := range b.subscribers {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns a channel receiving the events published from now on, and a function
+// that unsubscribes. The channel is not closed when unsubscribing
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	c := make(chan Event, defaultSubscriberBufferSize)
+
+	b.Lock()
+	b.subscribers[c] = struct{}{}
+	b.Unlock()
+
+	return c, func() {
+		b.Lock()
+		defer b.Unlock()
+		delete(b.subscribers, c)
+	}
+}
+
+// Subscribers returns the number of subscribers
+func (b *Broker) Subscribers() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.subscribers)
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+
+	// Publishing without subscribers is a no-op
+	require.NoError(t, b.Publish(Event{Type: DepositRecorded, DepositID: "foo"}))
+
+	c1, unsubscribe1 := b.Subscribe()
+	c2, unsubscribe2 := b.Subscribe()
+	require.Equal(t, 2, b.Subscribers())
+
+	require.NoError(t, b.Publish(Event{Type: DepositRecorded, DepositID: "bar"}))
+	require.Equal(t, "bar", (<-c1).DepositID)
+	require.Equal(t, "bar", (<-c2).DepositID)
+
+	unsubscribe1()
+	require.Equal(t, 1, b.Subscribers())
+
+	require.NoError(t, b.Publish(Event{Type: PayoutDone, DepositID: "bar"}))
+	require.Empty(t, c1)
+	require.Equal(t, PayoutDone, (<-c2).Type)
+
+	// A subscriber that isn't reading doesn't block Publish, the events that don't fit are dropped
+	for i := 0; i < defaultSubscriberBufferSize*2; i++ {
+		require.NoError(t, b.Publish(Event{Type: DepositRecorded}))
+	}
+	require.Len(t, c2, defaultSubscriberBufferSize)
+
+	unsubscribe2()
+	require.Equal(t, 0, b.Subscribers())
+}
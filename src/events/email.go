@@ -0,0 +1,162 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var emailSubjectTemplate = template.Must(template.New("subject").Parse(
+	"MDL payout sent for {{.CoinType}} deposit {{.DepositID}}"))
+
+var emailBodyTemplate = template.Must(template.New("body").Parse(`The MDL payout for a deposit is complete.
+
+Deposit ID:      {{.DepositID}}
+Coin type:       {{.CoinType}}
+Deposit address: {{.DepositAddress}}
+Deposit value:   {{.DepositValue}} (in the coin's smallest unit)
+MDL address:     {{.MDLAddress}}
+MDL sent:        {{.MDLSent}} droplets
+MDL txid:        {{.Txid}}
+Status:          {{.Status}}
+Time:            {{.Time.Format "2006-01-02 15:04:05 MST"}}
+`))
+
+var userEmailSubjectTemplate = template.Must(template.New("userSubject").Parse(
+	"Your {{.CoinType}} deposit has been exchanged for MDL"))
+
+var userEmailBodyTemplate = template.Must(template.New("userBody").Parse(`Your {{.CoinType}} deposit has been exchanged, and the MDL has been sent to your MDL address.
+
+Deposit address: {{.DepositAddress}}
+MDL address:     {{.MDLAddress}}
+MDL sent:        {{.MDLSent}} droplets
+MDL txid:        {{.Txid}}
+Time:            {{.Time.Format "2006-01-02 15:04:05 MST"}}
+
+You received this email because this address was given when requesting the deposit address.
+{{- if .OptOutURL}}
+To stop receiving these emails, visit {{.OptOutURL}}
+{{- end}}
+`))
+
+// sendMailFunc sends an email, see smtp.SendMail
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// EmailConfig configures an EmailPublisher
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string // no authentication if empty
+	Password string
+	From     string
+	To       []string
+
+	// Also email Event.ContactEmail, the end user, if it is set
+	NotifyUsers bool
+	// Linked in the emails sent to end users, if set
+	OptOutURL string
+}
+
+// EmailPublisher emails a notification when the payout of a deposit is done. Other events are ignored.
+// If NotifyUsers is set, the end user of the deposit is emailed too, if their email address is known.
+// Publish blocks until the SMTP server accepted the email; wrap it with AsyncPublisher.
+type EmailPublisher struct {
+	cfg      EmailConfig
+	auth     smtp.Auth
+	sendMail sendMailFunc
+}
+
+// NewEmailPublisher creates an EmailPublisher sending through the SMTP server of cfg
+func NewEmailPublisher(cfg EmailConfig) *EmailPublisher {
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	return &EmailPublisher{
+		cfg:      cfg,
+		auth:     auth,
+		sendMail: smtp.SendMail,
+	}
+}
+
+// Publish emails the details of a PayoutDone event to the configured recipients,
+// and a confirmation to the end user if NotifyUsers is set and the event has a ContactEmail
+func (p *EmailPublisher) Publish(e Event) error {
+	if e.Type != PayoutDone {
+		return nil
+	}
+
+	addr := net.JoinHostPort(p.cfg.Host, strconv.Itoa(p.cfg.Port))
+
+	msg, err := p.buildMessage(p.cfg.To, emailSubjectTemplate, emailBodyTemplate, e)
+	if err != nil {
+		return err
+	}
+
+	if err := p.sendMail(addr, p.auth, p.cfg.From, p.cfg.To, msg); err != nil {
+		return err
+	}
+
+	if !p.cfg.NotifyUsers || e.ContactEmail == "" {
+		return nil
+	}
+
+	to := []string{e.ContactEmail}
+	msg, err = p.buildMessage(to, userEmailSubjectTemplate, userEmailBodyTemplate, struct {
+		Event
+		OptOutURL string
+	}{
+		Event:     e,
+		OptOutURL: p.cfg.OptOutURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.sendMail(addr, p.auth, p.cfg.From, to, msg)
+}
+
+// buildMessage returns an email to the recipients rendered from the templates, with its headers
+func (p *EmailPublisher) buildMessage(to []string, subjectTemplate, bodyTemplate *template.Template, data interface{}) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := subjectTemplate.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("Render email subject failed: %v", err)
+	}
+	if err := bodyTemplate.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("Render email body failed: %v", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", p.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject.String())
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(body.String(), "\n", "\r\n", -1))
+
+	return msg.Bytes(), nil
+}
+
+// MultiPublisher publishes events to each of its publishers.
+// Every publisher is called, and the first error is returned
+type MultiPublisher []Publisher
+
+// Publish publishes the event to each publisher
+func (m MultiPublisher) Publish(e Event) error {
+	var firstErr error
+	for _, p := range m {
+		if err := p.Publish(e); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,270 @@
+package events
+
+import (
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+type sentMail struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	msg  string
+}
+
+// mockSendMail records the emails sent by an EmailPublisher
+type mockSendMail struct {
+	sent []sentMail
+	err  error
+}
+
+func (m *mockSendMail) sendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.sent = append(m.sent, sentMail{
+		addr: addr,
+		auth: a,
+		from: from,
+		to:   to,
+		msg:  string(msg),
+	})
+	return nil
+}
+
+func newTestEmailPublisher(m *mockSendMail) *EmailPublisher {
+	p := NewEmailPublisher(EmailConfig{
+		Host:     "smtp.example.com",
+		Port:     587,
+		Username: "teller",
+		Password: "secret",
+		From:     "teller@example.com",
+		To:       []string{"ops@example.com", "owner@example.com"},
+	})
+	p.sendMail = m.sendMail
+	return p
+}
+
+func TestEmailPublisherPayoutDone(t *testing.T) {
+	m := &mockSendMail{}
+	p := newTestEmailPublisher(m)
+
+	err := p.Publish(Event{
+		Type:           PayoutDone,
+		Time:           time.Date(2018, 3, 1, 12, 30, 0, 0, time.UTC),
+		DepositID:      "btc-tx:1",
+		CoinType:       "BTC",
+		DepositAddress: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		DepositValue:   1e8,
+		MDLAddress:     "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT",
+		MDLSent:        500e6,
+		Txid:           "mdl-tx",
+		Status:         "done",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, m.sent, 1)
+	sent := m.sent[0]
+	require.Equal(t, "smtp.example.com:587", sent.addr)
+	require.NotNil(t, sent.auth)
+	require.Equal(t, "teller@example.com", sent.from)
+	require.Equal(t, []string{"ops@example.com", "owner@example.com"}, sent.to)
+
+	parts := strings.SplitN(sent.msg, "\r\n\r\n", 2)
+	require.Len(t, parts, 2)
+	headers, body := parts[0], parts[1]
+
+	require.Contains(t, headers, "From: teller@example.com\r\n")
+	require.Contains(t, headers, "To: ops@example.com, owner@example.com\r\n")
+	require.Contains(t, headers, "Subject: MDL payout sent for BTC deposit btc-tx:1\r\n")
+	require.Contains(t, headers, "Content-Type: text/plain; charset=UTF-8")
+
+	for _, line := range []string{
+		"Deposit ID:      btc-tx:1\r\n",
+		"Coin type:       BTC\r\n",
+		"Deposit address: 1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2\r\n",
+		"Deposit value:   100000000 (in the coin's smallest unit)\r\n",
+		"MDL address:     2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT\r\n",
+		"MDL sent:        500000000 droplets\r\n",
+		"MDL txid:        mdl-tx\r\n",
+		"Status:          done\r\n",
+		"Time:            2018-03-01 12:30:00 UTC\r\n",
+	} {
+		require.Contains(t, body, line)
+	}
+
+	// Lines are terminated by CRLF only
+	require.NotContains(t, strings.Replace(sent.msg, "\r\n", "", -1), "\n")
+}
+
+func TestEmailPublisherIgnoresOtherEvents(t *testing.T) {
+	m := &mockSendMail{}
+	p := newTestEmailPublisher(m)
+
+	err := p.Publish(Event{
+		Type:      DepositRecorded,
+		DepositID: "btc-tx:1",
+	})
+	require.NoError(t, err)
+	require.Empty(t, m.sent)
+}
+
+func TestEmailPublisherNoAuth(t *testing.T) {
+	m := &mockSendMail{}
+	p := NewEmailPublisher(EmailConfig{
+		Host: "localhost",
+		Port: 25,
+		From: "teller@example.com",
+		To:   []string{"ops@example.com"},
+	})
+	p.sendMail = m.sendMail
+
+	err := p.Publish(Event{Type: PayoutDone})
+	require.NoError(t, err)
+
+	require.Len(t, m.sent, 1)
+	require.Equal(t, "localhost:25", m.sent[0].addr)
+	require.Nil(t, m.sent[0].auth)
+}
+
+func TestEmailPublisherSendErrorNotFatal(t *testing.T) {
+	log, hook := testutil.NewLogger(t)
+	m := &mockSendMail{
+		err: errors.New("connection refused"),
+	}
+
+	p := newTestEmailPublisher(m)
+	require.EqualError(t, p.Publish(Event{Type: PayoutDone}), "connection refused")
+
+	// Wrapped in an AsyncPublisher, the failure is logged and the event dropped
+	ap := NewAsyncPublisher(log, p, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, ap.Run())
+	}()
+
+	require.NoError(t, ap.Publish(Event{Type: PayoutDone, DepositID: "foo"}))
+
+	timeout := time.After(time.Second * 3)
+	for {
+		entry := hook.LastEntry()
+		if entry != nil && entry.Message == "Publish failed, event dropped" {
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("Waiting for the publish failure to be logged timed out")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	ap.Shutdown()
+	<-done
+}
+
+func TestMultiPublisher(t *testing.T) {
+	first := &mockPublisher{}
+	failing := &mockPublisher{
+		err: errors.New("broker unavailable"),
+	}
+	last := &mockPublisher{}
+
+	p := MultiPublisher{first, failing, last}
+
+	err := p.Publish(Event{Type: PayoutDone, DepositID: "foo"})
+	require.EqualError(t, err, "broker unavailable")
+
+	// Every publisher is called despite the failure
+	require.Len(t, first.Published(), 1)
+	require.Len(t, last.Published(), 1)
+}
+
+func TestEmailPublisherUserNotification(t *testing.T) {
+	e := Event{
+		Type:           PayoutDone,
+		Time:           time.Date(2018, 3, 1, 12, 30, 0, 0, time.UTC),
+		DepositID:      "btc-tx:1",
+		CoinType:       "BTC",
+		DepositAddress: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		DepositValue:   1e8,
+		MDLAddress:     "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT",
+		MDLSent:        500e6,
+		Txid:           "mdl-tx",
+		Status:         "done",
+		ContactEmail:   "user@example.com",
+	}
+
+	m := &mockSendMail{}
+	p := newTestEmailPublisher(m)
+	p.cfg.NotifyUsers = true
+	p.cfg.OptOutURL = "https://example.com/unsubscribe"
+
+	require.NoError(t, p.Publish(e))
+
+	// The operators and the user are emailed separately
+	require.Len(t, m.sent, 2)
+	require.Equal(t, []string{"ops@example.com", "owner@example.com"}, m.sent[0].to)
+	require.NotContains(t, m.sent[0].msg, "user@example.com")
+
+	sent := m.sent[1]
+	require.Equal(t, "teller@example.com", sent.from)
+	require.Equal(t, []string{"user@example.com"}, sent.to)
+
+	parts := strings.SplitN(sent.msg, "\r\n\r\n", 2)
+	require.Len(t, parts, 2)
+	headers, body := parts[0], parts[1]
+
+	require.Contains(t, headers, "To: user@example.com\r\n")
+	require.Contains(t, headers, "Subject: Your BTC deposit has been exchanged for MDL\r\n")
+
+	for _, line := range []string{
+		"Deposit address: 1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2\r\n",
+		"MDL address:     2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT\r\n",
+		"MDL sent:        500000000 droplets\r\n",
+		"MDL txid:        mdl-tx\r\n",
+		"To stop receiving these emails, visit https://example.com/unsubscribe\r\n",
+	} {
+		require.Contains(t, body, line)
+	}
+	require.NotContains(t, strings.Replace(sent.msg, "\r\n", "", -1), "\n")
+
+	// Without an opt-out URL, it is not mentioned
+	m = &mockSendMail{}
+	p = newTestEmailPublisher(m)
+	p.cfg.NotifyUsers = true
+
+	require.NoError(t, p.Publish(e))
+	require.Len(t, m.sent, 2)
+	require.NotContains(t, m.sent[1].msg, "To stop receiving")
+
+	// Without a contact email, only the operators are emailed
+	m = &mockSendMail{}
+	p = newTestEmailPublisher(m)
+	p.cfg.NotifyUsers = true
+
+	noContact := e
+	noContact.ContactEmail = ""
+	require.NoError(t, p.Publish(noContact))
+	require.Len(t, m.sent, 1)
+	require.Equal(t, []string{"ops@example.com", "owner@example.com"}, m.sent[0].to)
+
+	// Users are not emailed unless enabled
+	m = &mockSendMail{}
+	p = newTestEmailPublisher(m)
+
+	require.NoError(t, p.Publish(e))
+	require.Len(t, m.sent, 1)
+	require.Equal(t, []string{"ops@example.com", "owner@example.com"}, m.sent[0].to)
+}
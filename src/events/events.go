@@ -0,0 +1,153 @@
+// Package events publishes deposit lifecycle events to an external message broker
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DepositRecorded is published when a deposit is first saved by the exchange
+	DepositRecorded = "deposit_recorded"
+	// PayoutDone is published when the MDL payout for a deposit is complete
+	PayoutDone = "payout_done"
+
+	defaultQueueSize = 100
+	// How long Shutdown keeps publishing the events still queued
+	defaultDrainTimeout = time.Second * 10
+)
+
+var (
+	// ErrQueueFull is returned by AsyncPublisher.Publish when the event queue is full and the event was dropped
+	ErrQueueFull = errors.New("Event queue is full, event dropped")
+)
+
+// Event is a deposit lifecycle event
+type Event struct {
+	Type           string    `json:"type"`
+	Time           time.Time `json:"time"`
+	DepositID      string    `json:"deposit_id"`
+	CoinType       string    `json:"coin_type"`
+	DepositAddress string    `json:"deposit_address"`
+	DepositValue   int64     `json:"deposit_value"`
+	MDLAddress     string    `json:"mdl_address"`
+	MDLSent        uint64    `json:"mdl_sent"`
+	Txid           string    `json:"txid,omitempty"`
+	Status         string    `json:"status"`
+
+	// Email address of the end user to notify, if given when binding and not opted out.
+	// Not serialized, so that it is not published to the broker
+	ContactEmail string `json:"-"`
+}
+
+// Marshal serializes the event for the broker
+func (e Event) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Publisher publishes events
+type Publisher interface {
+	Publish(Event) error
+}
+
+// NopPublisher is a Publisher that discards all events
+type NopPublisher struct{}
+
+// Publish discards the event
+func (NopPublisher) Publish(Event) error {
+	return nil
+}
+
+// AsyncPublisher wraps a Publisher with a bounded queue so that callers never block on the broker.
+// Events are dropped and logged if the queue is full or the underlying publish fails.
+// On shutdown, the queued events are still published until the drain timeout elapses.
+type AsyncPublisher struct {
+	log          logrus.FieldLogger
+	publisher    Publisher
+	events       chan Event
+	drainTimeout time.Duration
+	quit         chan struct{}
+	done         chan struct{}
+}
+
+// NewAsyncPublisher creates an AsyncPublisher. If queueSize is <= 0 a default is used.
+func NewAsyncPublisher(log logrus.FieldLogger, publisher Publisher, queueSize int) *AsyncPublisher {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	return &AsyncPublisher{
+		log:          log.WithField("prefix", "teller.events"),
+		publisher:    publisher,
+		events:       make(chan Event, queueSize),
+		drainTimeout: defaultDrainTimeout,
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Publish queues an event for publishing. It never blocks.
+func (p *AsyncPublisher) Publish(e Event) error {
+	select {
+	case p.events <- e:
+		return nil
+	default:
+		p.log.WithField("event", e).WithError(ErrQueueFull).Warn("Dropping event")
+		return ErrQueueFull
+	}
+}
+
+// Run publishes queued events until Shutdown is called, then drains the queue
+func (p *AsyncPublisher) Run() error {
+	log := p.log
+	log.Info("Start event publisher...")
+	defer func() {
+		log.Info("Closed event publisher")
+		close(p.done)
+	}()
+
+	for {
+		select {
+		case <-p.quit:
+			p.drain()
+			return nil
+		case e := <-p.events:
+			p.publish(e)
+		}
+	}
+}
+
+// drain publishes the queued events until the queue is empty or the drain timeout elapsed.
+// The events still queued after the timeout are dropped
+func (p *AsyncPublisher) drain() {
+	deadline := time.Now().Add(p.drainTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case e := <-p.events:
+			p.publish(e)
+		default:
+			return
+		}
+	}
+
+	if n := len(p.events); n > 0 {
+		p.log.WithField("dropped", n).Error("Event queue not drained before the shutdown timeout, events dropped")
+	}
+}
+
+func (p *AsyncPublisher) publish(e Event) {
+	if err := p.publisher.Publish(e); err != nil {
+		p.log.WithField("event", e).WithError(err).Error("Publish failed, event dropped")
+	}
+}
+
+// Shutdown stops a previous call to Run, after it published the queued events or the drain timeout elapsed
+func (p *AsyncPublisher) Shutdown() {
+	p.log.Info("Shutting down event publisher")
+	close(p.quit)
+	<-p.done
+	p.log.Info("Shutdown complete")
+}
@@ -0,0 +1,180 @@
+package events
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+// mockPublisher records published events
+type mockPublisher struct {
+	sync.Mutex
+	events []Event
+	err    error
+}
+
+func (p *mockPublisher) Publish(e Event) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.events = append(p.events, e)
+	return nil
+}
+
+// Published returns a copy of the recorded events
+func (p *mockPublisher) Published() []Event {
+	p.Lock()
+	defer p.Unlock()
+
+	evs := make([]Event, len(p.events))
+	copy(evs, p.events)
+	return evs
+}
+
+func TestAsyncPublisherPublish(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	mock := &mockPublisher{}
+	p := NewAsyncPublisher(log, mock, 10)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, p.Run())
+	}()
+
+	require.NoError(t, p.Publish(Event{Type: DepositRecorded, DepositID: "foo"}))
+	require.NoError(t, p.Publish(Event{Type: PayoutDone, DepositID: "foo"}))
+
+	timeout := time.After(time.Second * 3)
+	for len(mock.Published()) < 2 {
+		select {
+		case <-timeout:
+			t.Fatal("Waiting for events timed out")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	evs := mock.Published()
+	require.Equal(t, DepositRecorded, evs[0].Type)
+	require.Equal(t, PayoutDone, evs[1].Type)
+
+	p.Shutdown()
+	<-done
+}
+
+func TestAsyncPublisherQueueFull(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	mock := &mockPublisher{}
+
+	// Run is not started, so nothing drains the queue
+	p := NewAsyncPublisher(log, mock, 1)
+
+	require.NoError(t, p.Publish(Event{Type: DepositRecorded}))
+	require.Equal(t, ErrQueueFull, p.Publish(Event{Type: DepositRecorded}))
+}
+
+func TestAsyncPublisherPublishError(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	mock := &mockPublisher{
+		err: errors.New("broker unavailable"),
+	}
+	p := NewAsyncPublisher(log, mock, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, p.Run())
+	}()
+
+	// Failed publishes are dropped and do not stall the queue
+	for i := 0; i < 5; i++ {
+		timeout := time.After(time.Second * 3)
+		for p.Publish(Event{Type: PayoutDone}) != nil {
+			select {
+			case <-timeout:
+				t.Fatal("Publish stalled")
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+
+	require.Empty(t, mock.Published())
+
+	p.Shutdown()
+	<-done
+}
+
+// blockingPublisher publishes an event once release is closed
+type blockingPublisher struct {
+	mockPublisher
+	release chan struct{}
+}
+
+func (p *blockingPublisher) Publish(e Event) error {
+	<-p.release
+	return p.mockPublisher.Publish(e)
+}
+
+func TestAsyncPublisherShutdownDrainsQueue(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	mock := &mockPublisher{}
+
+	// Run is started after the events are queued, so they are all still queued at shutdown
+	p := NewAsyncPublisher(log, mock, 10)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Publish(Event{Type: PayoutDone}))
+	}
+	close(p.quit)
+
+	require.NoError(t, p.Run())
+	require.Len(t, mock.Published(), 5)
+}
+
+func TestAsyncPublisherShutdownDrainTimeout(t *testing.T) {
+	log, hook := testutil.NewLogger(t)
+	mock := &blockingPublisher{
+		release: make(chan struct{}),
+	}
+
+	p := NewAsyncPublisher(log, mock, 10)
+	p.drainTimeout = time.Millisecond * 50
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Publish(Event{Type: PayoutDone}))
+	}
+	close(p.quit)
+
+	// The first event is published after the drain timeout, and the rest are dropped
+	go func() {
+		time.Sleep(p.drainTimeout * 2)
+		close(mock.release)
+	}()
+
+	require.NoError(t, p.Run())
+	require.Len(t, mock.Published(), 1)
+
+	var dropped interface{}
+	for _, entry := range hook.AllEntries() {
+		if n, ok := entry.Data["dropped"]; ok {
+			dropped = n
+		}
+	}
+	require.Equal(t, 4, dropped)
+}
+
+func TestEventMarshalOmitsContactEmail(t *testing.T) {
+	b, err := Event{
+		Type:         PayoutDone,
+		ContactEmail: "user@example.com",
+	}.Marshal()
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "user@example.com")
+}
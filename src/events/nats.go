@@ -0,0 +1,39 @@
+package events
+
+import (
+	nats "github.com/nats-io/go-nats"
+)
+
+// NATSPublisher publishes events to a NATS subject
+type NATSPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// NewNATSPublisher connects to the NATS server at url and returns a NATSPublisher for subject
+func NewNATSPublisher(url, subject string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATSPublisher{
+		conn:    conn,
+		subject: subject,
+	}, nil
+}
+
+// Publish publishes the event as JSON to the configured subject
+func (p *NATSPublisher) Publish(e Event) error {
+	b, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return p.conn.Publish(p.subject, b)
+}
+
+// Close closes the NATS connection
+func (p *NATSPublisher) Close() {
+	p.conn.Close()
+}
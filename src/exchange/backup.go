@@ -0,0 +1,239 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/MDLlife/MDL/src/cipher"
+
+	"github.com/MDLlife/teller/src/addrs"
+	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/util/dbutil"
+)
+
+// BackupVersion is the version of the Backup format written by Store.Export
+const BackupVersion = 1
+
+// ErrBackupVersion is returned when importing a Backup with an unsupported version
+var ErrBackupVersion = errors.New("Unsupported backup version")
+
+// Backup is a dump of all address bindings and deposit records in a Store,
+// used for backups and for migrating to a new database
+type Backup struct {
+	Version        int            `json:"version"`
+	BoundAddresses []BoundAddress `json:"bound_addresses"`
+	Deposits       []DepositInfo  `json:"deposits"`
+}
+
+// ImportResult counts the records written and skipped by Store.Import
+type ImportResult struct {
+	BoundAddressesImported int
+	BoundAddressesSkipped  int
+	DepositsImported       int
+	DepositsSkipped        int
+}
+
+// Validate checks the coin types and addresses of all records in the Backup
+func (b Backup) Validate() error {
+	if b.Version != BackupVersion {
+		return ErrBackupVersion
+	}
+
+	bound := make(map[string]BoundAddress, len(b.BoundAddresses))
+	for _, ba := range b.BoundAddresses {
+		if _, err := GetBindAddressBkt(ba.CoinType); err != nil {
+			return fmt.Errorf("Bound address %s has invalid coin type %q", ba.Address, ba.CoinType)
+		}
+		if err := addrs.VerifyAddress(ba.CoinType, ba.Address); err != nil {
+			return fmt.Errorf("Bound address %s is invalid: %v", ba.Address, err)
+		}
+		if _, err := cipher.DecodeBase58Address(ba.MDLAddress); err != nil {
+			return fmt.Errorf("Bound address %s has invalid mdl address %s: %v", ba.Address, ba.MDLAddress, err)
+		}
+		if err := config.ValidateBuyMethod(ba.BuyMethod); err != nil {
+			return fmt.Errorf("Bound address %s has invalid buy method %q", ba.Address, ba.BuyMethod)
+		}
+
+		key := ba.CoinType + ":" + ba.Address
+		if _, ok := bound[key]; ok {
+			return fmt.Errorf("Bound address %s is duplicated", ba.Address)
+		}
+		bound[key] = ba
+	}
+
+	deposits := make(map[string]struct{}, len(b.Deposits))
+	for _, di := range b.Deposits {
+		if di.DepositID == "" {
+			return errors.New("Deposit has no DepositID")
+		}
+		if _, ok := deposits[di.DepositID]; ok {
+			return fmt.Errorf("Deposit %s is duplicated", di.DepositID)
+		}
+		deposits[di.DepositID] = struct{}{}
+
+		if _, err := GetBindAddressBkt(di.CoinType); err != nil {
+			return fmt.Errorf("Deposit %s has invalid coin type %q", di.DepositID, di.CoinType)
+		}
+		if err := addrs.VerifyAddress(di.CoinType, di.DepositAddress); err != nil {
+			return fmt.Errorf("Deposit %s has invalid deposit address: %v", di.DepositID, err)
+		}
+		if _, err := cipher.DecodeBase58Address(di.MDLAddress); err != nil {
+			return fmt.Errorf("Deposit %s has invalid mdl address %s: %v", di.DepositID, di.MDLAddress, err)
+		}
+		if err := di.ValidateForStatus(); err != nil {
+			return fmt.Errorf("Deposit %s is invalid: %v", di.DepositID, err)
+		}
+	}
+
+	return nil
+}
+
+// Export returns all address bindings and deposit records in the Store
+func (s *Store) Export() (*Backup, error) {
+	b := &Backup{
+		Version: BackupVersion,
+	}
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		// Bindings are read from the mdl address index, which preserves
+		// the order in which each mdl address's bindings were made
+		if err := dbutil.ForEach(tx, MDLDepositSeqsIndexBkt, func(k, v []byte) error {
+			var boundAddrs []BoundAddress
+			if err := dbutil.UnmarshalValue(v, &boundAddrs); err != nil {
+				return err
+			}
+
+			b.BoundAddresses = append(b.BoundAddresses, boundAddrs...)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
+			var di DepositInfo
+			if err := dbutil.UnmarshalValue(v, &di); err != nil {
+				return err
+			}
+
+			b.Deposits = append(b.Deposits, di)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(b.Deposits, func(i, j int) bool {
+		return b.Deposits[i].Seq < b.Deposits[j].Seq
+	})
+
+	return b, nil
+}
+
+// Import writes the address bindings and deposit records of a Backup to the Store.
+// Records that already exist are skipped, so importing the same Backup again has no effect.
+// A binding that conflicts with an existing binding aborts the import, and nothing is written.
+// Deposit records are written as they are, keeping their status, Seq and Version.
+func (s *Store) Import(b Backup) (ImportResult, error) {
+	var res ImportResult
+
+	if err := b.Validate(); err != nil {
+		return res, err
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		var maxVersion uint64
+		for _, ba := range b.BoundAddresses {
+			existing, err := s.getBindAddressTx(tx, ba.Address, ba.CoinType)
+			if err != nil {
+				return err
+			}
+
+			if existing != nil {
+				if existing.MDLAddress != ba.MDLAddress {
+					return fmt.Errorf("Bound address %s is already bound to mdl address %s", ba.Address, existing.MDLAddress)
+				}
+				res.BoundAddressesSkipped++
+				continue
+			}
+
+			if err := s.putBindAddressTx(tx, ba); err != nil {
+				return err
+			}
+
+			if ba.Version > maxVersion {
+				maxVersion = ba.Version
+			}
+			res.BoundAddressesImported++
+		}
+
+		var maxSeq uint64
+		for _, di := range b.Deposits {
+			if hasKey, err := dbutil.BucketHasKey(tx, DepositInfoBkt, di.DepositID); err != nil {
+				return err
+			} else if hasKey {
+				res.DepositsSkipped++
+				continue
+			}
+
+			boundAddr, err := s.getBindAddressTx(tx, di.DepositAddress, di.CoinType)
+			if err != nil {
+				return err
+			}
+			if boundAddr == nil {
+				return fmt.Errorf("Deposit %s: %v", di.DepositID, ErrNoBoundAddress)
+			}
+			if boundAddr.MDLAddress != di.MDLAddress {
+				return fmt.Errorf("Deposit %s mdl address %s does not match bound mdl address %s", di.DepositID, di.MDLAddress, boundAddr.MDLAddress)
+			}
+
+			if err := s.putRecordTx(tx, DepositInfoBkt, di.DepositID, di); err != nil {
+				return err
+			}
+
+			var txs []string
+			if err := dbutil.GetBucketObject(tx, BtcTxsBkt, di.DepositAddress, &txs); err != nil {
+				switch err.(type) {
+				case dbutil.ObjectNotExistErr:
+				default:
+					return err
+				}
+			}
+
+			txs = append(txs, di.DepositID)
+			if err := dbutil.PutBucketValue(tx, BtcTxsBkt, di.DepositAddress, txs); err != nil {
+				return err
+			}
+
+			if di.Seq > maxSeq {
+				maxSeq = di.Seq
+			}
+			if di.Version > maxVersion {
+				maxVersion = di.Version
+			}
+			res.DepositsImported++
+		}
+
+		// Make sure that deposits recorded after the import do not reuse an imported Seq
+		bkt := tx.Bucket(DepositInfoBkt)
+		if maxSeq > bkt.Sequence() {
+			if err := bkt.SetSequence(maxSeq); err != nil {
+				return err
+			}
+		}
+
+		// Likewise for the versions, so that records saved after the import are seen as changed
+		metaBkt := tx.Bucket(ExchangeMetaBkt)
+		if maxVersion > metaBkt.Sequence() {
+			return metaBkt.SetSequence(maxVersion)
+		}
+
+		return nil
+	}); err != nil {
+		return ImportResult{}, err
+	}
+
+	return res, nil
+}
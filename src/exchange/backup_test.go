@@ -0,0 +1,315 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+const (
+	testBackupDepositAddr  = "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	testBackupDepositAddr2 = "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv"
+)
+
+// prepareBackupStore creates a store with bindings for two mdl addresses and
+// deposits in several statuses
+func prepareBackupStore(t *testing.T) (*Store, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	s, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	_, err = s.BindAddress(context.Background(), testMDLAddr, testBackupDepositAddr, scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{Reference: "order-1"})
+	require.NoError(t, err)
+	_, err = s.BindAddress(context.Background(), testMDLAddr, testMDLAddr2, scanner.CoinTypeSKY, config.BuyMethodDirect, BindOptions{})
+	require.NoError(t, err)
+	_, err = s.BindAddress(context.Background(), testMDLAddr2, testBackupDepositAddr2, scanner.CoinTypeBTC, config.BuyMethodPassthrough, BindOptions{})
+	require.NoError(t, err)
+
+	deposits := []scanner.Deposit{
+		{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  testBackupDepositAddr,
+			Value:    1e8,
+			Height:   10,
+			Tx:       "btc-tx-1",
+			N:        0,
+		},
+		{
+			CoinType: scanner.CoinTypeSKY,
+			Address:  testMDLAddr2,
+			Value:    2e6,
+			Height:   20,
+			Tx:       "sky-tx-1",
+			N:        1,
+		},
+		{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  testBackupDepositAddr2,
+			Value:    3e8,
+			Height:   11,
+			Tx:       "btc-tx-2",
+			N:        2,
+		},
+	}
+
+	for _, dv := range deposits {
+		_, _, err := s.GetOrCreateDepositInfo(dv, testMDLBtcRate)
+		require.NoError(t, err)
+	}
+
+	_, err = s.UpdateDepositInfo(deposits[0].ID(), func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Txid = "mdl-tx-1"
+		di.MDLSent = 100e6
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = s.UpdateDepositInfo(deposits[1].ID(), func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	return s, shutdown
+}
+
+func TestStoreExportImportRoundTrip(t *testing.T) {
+	s, shutdown := prepareBackupStore(t)
+	defer shutdown()
+
+	b, err := s.Export()
+	require.NoError(t, err)
+	require.Equal(t, BackupVersion, b.Version)
+	require.Len(t, b.BoundAddresses, 3)
+	require.Len(t, b.Deposits, 3)
+	for i, di := range b.Deposits {
+		require.Equal(t, uint64(i+1), di.Seq)
+	}
+
+	// Round trip through the JSON file format
+	data, err := json.Marshal(b)
+	require.NoError(t, err)
+	var restored Backup
+	err = json.Unmarshal(data, &restored)
+	require.NoError(t, err)
+
+	s2, shutdown2 := prepareEmptyStore(t)
+	defer shutdown2()
+
+	res, err := s2.Import(restored)
+	require.NoError(t, err)
+	require.Equal(t, ImportResult{
+		BoundAddressesImported: 3,
+		DepositsImported:       3,
+	}, res)
+
+	b2, err := s2.Export()
+	require.NoError(t, err)
+	require.Equal(t, b, b2)
+
+	// Bindings and deposits are queryable the same as in the original store
+	for _, ba := range b.BoundAddresses {
+		ba2, err := s2.GetBindAddress(ba.Address, ba.CoinType)
+		require.NoError(t, err)
+		require.Equal(t, ba, *ba2)
+	}
+
+	for _, mdlAddr := range []string{testMDLAddr, testMDLAddr2} {
+		dis, err := s.GetDepositInfoOfMDLAddress(mdlAddr)
+		require.NoError(t, err)
+		dis2, err := s2.GetDepositInfoOfMDLAddress(mdlAddr)
+		require.NoError(t, err)
+		require.Equal(t, dis, dis2)
+
+		bas, err := s.GetMDLBindAddresses(mdlAddr)
+		require.NoError(t, err)
+		bas2, err := s2.GetMDLBindAddresses(mdlAddr)
+		require.NoError(t, err)
+		require.Equal(t, bas, bas2)
+	}
+
+	stats, err := s.GetDepositStats()
+	require.NoError(t, err)
+	stats2, err := s2.GetDepositStats()
+	require.NoError(t, err)
+	require.Equal(t, stats, stats2)
+
+	// Importing again is a no-op
+	res, err = s2.Import(restored)
+	require.NoError(t, err)
+	require.Equal(t, ImportResult{
+		BoundAddressesSkipped: 3,
+		DepositsSkipped:       3,
+	}, res)
+
+	b3, err := s2.Export()
+	require.NoError(t, err)
+	require.Equal(t, b, b3)
+
+	// New deposits do not reuse an imported Seq
+	di, _, err := s2.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  testBackupDepositAddr,
+		Value:    4e8,
+		Height:   12,
+		Tx:       "btc-tx-3",
+		N:        0,
+	}, testMDLBtcRate)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), di.Seq)
+}
+
+// prepareEmptyStore creates an empty store to import into
+func prepareEmptyStore(t *testing.T) (*Store, func()) {
+	db, shutdown := testutil.PrepareDB(t)
+	log, _ := testutil.NewLogger(t)
+
+	s, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	return s, shutdown
+}
+
+func TestStoreImportInvalid(t *testing.T) {
+	src, shutdown := prepareBackupStore(t)
+	defer shutdown()
+
+	b, err := src.Export()
+	require.NoError(t, err)
+
+	tt := []struct {
+		name   string
+		modify func(b *Backup)
+	}{
+		{
+			"unsupported version",
+			func(b *Backup) {
+				b.Version = BackupVersion + 1
+			},
+		},
+		{
+			"invalid bound address coin type",
+			func(b *Backup) {
+				b.BoundAddresses[0].CoinType = "FOO"
+			},
+		},
+		{
+			"invalid bound deposit address",
+			func(b *Backup) {
+				b.BoundAddresses[0].Address = "bad-address"
+			},
+		},
+		{
+			"invalid bound mdl address",
+			func(b *Backup) {
+				b.BoundAddresses[0].MDLAddress = "bad-address"
+			},
+		},
+		{
+			"invalid buy method",
+			func(b *Backup) {
+				b.BoundAddresses[0].BuyMethod = "foo"
+			},
+		},
+		{
+			"duplicate bound address",
+			func(b *Backup) {
+				b.BoundAddresses = append(b.BoundAddresses, b.BoundAddresses[0])
+			},
+		},
+		{
+			"invalid deposit coin type",
+			func(b *Backup) {
+				b.Deposits[0].CoinType = "FOO"
+			},
+		},
+		{
+			"invalid deposit mdl address",
+			func(b *Backup) {
+				b.Deposits[0].MDLAddress = "bad-address"
+			},
+		},
+		{
+			"invalid deposit status",
+			func(b *Backup) {
+				b.Deposits[0].Status = StatusWaitDeposit
+			},
+		},
+		{
+			"duplicate deposit",
+			func(b *Backup) {
+				b.Deposits = append(b.Deposits, b.Deposits[0])
+			},
+		},
+		{
+			"deposit to unbound address",
+			func(b *Backup) {
+				b.BoundAddresses = b.BoundAddresses[1:]
+			},
+		},
+		{
+			"deposit mdl address does not match binding",
+			func(b *Backup) {
+				b.Deposits[0].MDLAddress = testMDLAddr2
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, shutdown := prepareEmptyStore(t)
+			defer shutdown()
+
+			// Copy the backup so that each case starts from the original
+			data, err := json.Marshal(b)
+			require.NoError(t, err)
+			var bb Backup
+			err = json.Unmarshal(data, &bb)
+			require.NoError(t, err)
+
+			tc.modify(&bb)
+
+			_, err = s.Import(bb)
+			require.Error(t, err)
+
+			// Nothing is written
+			b2, err := s.Export()
+			require.NoError(t, err)
+			require.Empty(t, b2.BoundAddresses)
+			require.Empty(t, b2.Deposits)
+		})
+	}
+}
+
+func TestStoreImportConflictingBinding(t *testing.T) {
+	src, shutdown := prepareBackupStore(t)
+	defer shutdown()
+
+	b, err := src.Export()
+	require.NoError(t, err)
+
+	s, shutdown2 := prepareEmptyStore(t)
+	defer shutdown2()
+
+	// The deposit address is already bound to a different mdl address
+	_, err = s.BindAddress(context.Background(), testMDLAddr2, testBackupDepositAddr, scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
+	require.NoError(t, err)
+
+	_, err = s.Import(*b)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is already bound to mdl address")
+
+	b2, err := s.Export()
+	require.NoError(t, err)
+	require.Len(t, b2.BoundAddresses, 1)
+	require.Empty(t, b2.Deposits)
+}
@@ -2,12 +2,16 @@ package exchange
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"math/big"
 
 	"github.com/shopspring/decimal"
 
 	"github.com/MDLlife/MDL/src/util/droplet"
 
+	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/scanner"
 	"github.com/MDLlife/teller/src/util/mathutil"
 )
 
@@ -18,8 +22,9 @@ const (
 	WeiPerETH int64 = 1e18
 	// DropletsPerSKY is the number of droplets per 1 SKY
 	DropletsPerSKY int64 = 1e6
-	// DropletsPerWAVES is the number of droplets per 1 WAVES
-	DropletsPerWAVES int64 = 1e6
+	// WaveletsPerWAVES is the number of wavelets per 1 WAVES.
+	// MDL.life tokens on Waves also have 8 decimals
+	WaveletsPerWAVES int64 = 1e8
 )
 
 // CalculateBtcMDLValue returns the amount of MDL (in droplets) to give for an
@@ -126,11 +131,11 @@ func CalculateSkyMDLValue(droplets int64, mdlPerSKY string, maxDecimals int) (ui
 }
 
 // CalculateWavesMDLValue returns the amount of MDL (in droplets) to give for an
-// amount of WAVES.
+// amount of WAVES (in wavelets), or of MDL.life tokens on Waves, which have the same precision.
 // Rate is measured in MDL per WAVES
-func CalculateWavesMDLValue(droplets int64, mdlPerWaves string, maxDecimals int) (uint64, error) {
-	if droplets < 0 {
-		return 0, errors.New("droplets must be greater than or equal to 0")
+func CalculateWavesMDLValue(wavelets int64, mdlPerWaves string, maxDecimals int) (uint64, error) {
+	if wavelets < 0 {
+		return 0, errors.New("wavelets must be greater than or equal to 0")
 	}
 	if maxDecimals < 0 {
 		return 0, errors.New("maxDecimals can't be negative")
@@ -141,17 +146,17 @@ func CalculateWavesMDLValue(droplets int64, mdlPerWaves string, maxDecimals int)
 		return 0, err
 	}
 
-	waves := decimal.New(droplets, 0)
-	wavesToSatoshi := decimal.New(1e7, 0)
-	waves = waves.DivRound(wavesToSatoshi, 8)
+	waves := decimal.New(wavelets, 0)
+	wavesToWavelets := decimal.New(WaveletsPerWAVES, 0)
+	waves = waves.DivRound(wavesToWavelets, 8)
 
 	mdl := waves.Mul(rate)
 	mdl = mdl.Truncate(int32(maxDecimals))
 
-	mdlToDroplets := decimal.New(1e5, 0)
-	dropletsMDL := mdl.Mul(mdlToDroplets)
+	mdlToDroplets := decimal.New(droplet.Multiplier, 0)
+	droplets := mdl.Mul(mdlToDroplets)
 
-	amt := dropletsMDL.IntPart()
+	amt := droplets.IntPart()
 	if amt < 0 {
 		// This should never occur, but double check before we convert to uint64,
 		// otherwise we would send all the coins due to integer wrapping.
@@ -160,3 +165,159 @@ func CalculateWavesMDLValue(droplets int64, mdlPerWaves string, maxDecimals int)
 
 	return uint64(amt), nil
 }
+
+// CalculateDepositMDLValue returns the amount of MDL (in droplets) to give for a deposit of coinType.
+// value is measured in the unit recorded by the coin's scanner, e.g. satoshis for BTC and gwei for ETH.
+// Rate is measured in MDL per coin
+func CalculateDepositMDLValue(coinType string, value int64, rate string, maxDecimals int) (uint64, error) {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		return CalculateBtcMDLValue(value, rate, maxDecimals)
+	case scanner.CoinTypeETH:
+		// Gwei convert to wei, because stored-value is Gwei in case overflow of uint64
+		return CalculateEthMDLValue(mathutil.Gwei2Wei(value), rate, maxDecimals)
+	case scanner.CoinTypeSKY:
+		return CalculateSkyMDLValue(value, rate, maxDecimals)
+	case scanner.CoinTypeWAVES, scanner.CoinTypeWAVESMDL:
+		return CalculateWavesMDLValue(value, rate, maxDecimals)
+	default:
+		return 0, scanner.ErrUnsupportedCoinType
+	}
+}
+
+// DepositValueToDecimal converts a deposit value of coinType, measured in the unit recorded by the coin's scanner,
+// to an amount of the coin
+func DepositValueToDecimal(coinType string, value int64) (decimal.Decimal, error) {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		return mathutil.IntToBTC(value), nil
+	case scanner.CoinTypeETH:
+		return mathutil.IntToETH(value), nil
+	case scanner.CoinTypeSKY:
+		return mathutil.IntToSKY(value), nil
+	case scanner.CoinTypeWAVES, scanner.CoinTypeWAVESMDL:
+		return mathutil.IntToWAV(value), nil
+	default:
+		return decimal.Decimal{}, scanner.ErrUnsupportedCoinType
+	}
+}
+
+// MinDepositForPayout returns the smallest deposit of coinType that is given more than 0 MDL at rate,
+// once the MDL is truncated to maxDecimals and fee, in droplets, is deducted. Smaller deposits are not paid out.
+// The deposit is measured in the unit recorded by the coin's scanner, the same as for CalculateDepositMDLValue
+func MinDepositForPayout(coinType, rate string, maxDecimals int, fee uint64) (int64, error) {
+	paid := func(value int64) (bool, error) {
+		amt, err := CalculateDepositMDLValue(coinType, value, rate, maxDecimals)
+		return DeductNetworkFee(amt, fee) > 0, err
+	}
+
+	// Find a deposit that is paid out by doubling, then narrow down to the smallest one.
+	// The MDL given only grows with the deposit, so the search is exact
+	var lo int64
+	hi := int64(1)
+	for {
+		ok, err := paid(hi)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			break
+		}
+
+		if hi > math.MaxInt64/2 {
+			return 0, errors.New("no deposit is paid out at this rate")
+		}
+		lo = hi
+		hi *= 2
+	}
+
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := paid(mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	return hi, nil
+}
+
+// ApplySpread returns rate reduced by spread, a percent. An empty or zero spread returns rate unchanged
+func ApplySpread(rate, spread string) (string, error) {
+	s, err := config.SpreadDecimal(spread)
+	if err != nil {
+		return "", err
+	}
+
+	if s.IsZero() {
+		return rate, nil
+	}
+
+	r, err := mathutil.ParseRate(rate)
+	if err != nil {
+		return "", err
+	}
+
+	hundred := decimal.New(100, 0)
+	return r.Mul(hundred.Sub(s)).Div(hundred).String(), nil
+}
+
+// EffectiveRate returns the exchange rate of coinType in cfg with its spread applied.
+// Returns ErrRateNotSet if the coin type's rate is empty
+func EffectiveRate(cfg config.MDLExchanger, coinType string) (string, error) {
+	rate, err := getRate(cfg, coinType)
+	if err != nil {
+		return "", err
+	}
+
+	return applyCoinSpread(cfg, coinType, rate)
+}
+
+// MinDepositsForPayout returns the MinDepositForPayout of each coin type that has an exchange rate in cfg,
+// at the rate with the coin type's spread applied, and net of the network fee if it is deducted
+func MinDepositsForPayout(cfg config.MDLExchanger) (map[string]int64, error) {
+	var fee uint64
+	if cfg.DeductNetworkFee {
+		var err error
+		fee, err = cfg.NetworkFeeDroplets()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	minDeposits := make(map[string]int64)
+	for _, coinType := range scanner.GetCoinTypes() {
+		rate, err := EffectiveRate(cfg, coinType)
+		switch err {
+		case nil:
+		case ErrRateNotSet:
+			continue
+		default:
+			return nil, err
+		}
+
+		minDeposit, err := MinDepositForPayout(coinType, rate, cfg.MaxDecimals, fee)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", coinType, err)
+		}
+
+		minDeposits[coinType] = minDeposit
+	}
+
+	return minDeposits, nil
+}
+
+// DeductNetworkFee returns the MDL payout net of a network fee, both in droplets.
+// The payout is floored at zero if the fee is larger than the gross MDL value
+func DeductNetworkFee(gross, fee uint64) uint64 {
+	if fee >= gross {
+		return 0
+	}
+	return gross - fee
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/MDLlife/MDL/src/util/droplet"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/scanner"
 )
 
 func TestCalculateMDLValue(t *testing.T) {
@@ -763,353 +766,527 @@ func TestCalculateSkyMDLValue(t *testing.T) {
 }
 
 func TestCalculateWavesMDLValue(t *testing.T) {
-	//The WAVES price is listed as 10^8. (1e8=1 WAVES)
+	// WAVES amounts are measured in wavelets, 1 WAVES = 1e8 wavelets.
+	// MDL amounts are measured in droplets, 1 MDL = 1e6 droplets.
+	// The MDL amount is truncated to maxDecimals before it is converted to droplets
 	cases := []struct {
 		maxDecimals int
-		droplets    int64
+		wavelets    int64
 		rate        string
 		result      uint64
 		err         error
 	}{
 		{
 			maxDecimals: 0,
-			droplets:    10000000, //0.1 WAVES
+			wavelets:    1e7, // 0.1 WAVES
 			rate:        "88",
-			result:      8800000, //8.8 MDL
+			result:      8e6, // 8.8 MDL, truncated to 8 MDL
 		},
 		{
-			maxDecimals: 0,
-			droplets:    2e7, //0.2 WAVES
+			maxDecimals: 1,
+			wavelets:    1e7, // 0.1 WAVES
 			rate:        "88",
-			result:      176e5, //17.6 MDL
+			result:      88e5, // 8.8 MDL
 		},
 		{
 			maxDecimals: 0,
-			droplets:    1297e7, // 129.7 WAVES
+			wavelets:    2e7, // 0.2 WAVES
 			rate:        "88",
-			result:      114136e5, // 11413.6 MDL
-		},
-		{
-			maxDecimals: 0,
-			droplets:    -1,
-			rate:        "1",
-			err:         errors.New("droplets must be greater than or equal to 0"),
+			result:      17e6, // 17.6 MDL, truncated to 17 MDL
 		},
 		{
-			maxDecimals: 0,
-			droplets:    1,
-			rate:        "-1",
-			err:         errors.New("rate must be greater than zero"),
-		},
-
-		{
-			maxDecimals: 0,
-			droplets:    1,
-			rate:        "0",
-			err:         errors.New("rate must be greater than zero"),
-		},
-
-		{
-			maxDecimals: 0,
-			droplets:    1,
-			rate:        "invalidrate",
-			err:         errors.New("can't convert invalidrate to decimal: exponent is not numeric"),
-		},
-		{
-			maxDecimals: 0,
-			droplets:    1,
-			rate:        "12k",
-			err:         errors.New("can't convert 12k to decimal"),
+			maxDecimals: 1,
+			wavelets:    2e7, // 0.2 WAVES
+			rate:        "88",
+			result:      176e5, // 17.6 MDL
 		},
 		{
-			maxDecimals: 0,
-			droplets:    1,
-			rate:        "1b",
-			err:         errors.New("can't convert 1b to decimal"),
+			maxDecimals: 1,
+			wavelets:    1297e7, // 129.7 WAVES
+			rate:        "88",
+			result:      114136e5, // 11413.6 MDL
 		},
 		{
 			maxDecimals: 0,
-			droplets:    1,
-			rate:        "",
-			err:         errors.New("can't convert  to decimal"),
+			wavelets:    0, // 0 WAVES
+			rate:        "1",
+			result:      0, // 0 MDL
 		},
-
 		{
 			maxDecimals: 0,
-			droplets:    0,
+			wavelets:    1, // 0.00000001 WAVES
 			rate:        "1",
-			result:      0,
+			result:      0, // 0 MDL
 		},
 		{
 			maxDecimals: 0,
-			droplets:    1e8, // 1 WAVES
+			wavelets:    1e8, // 1 WAVES
 			rate:        "1",
 			result:      1e6, // 1 MDL
 		},
-
 		{
 			maxDecimals: 0,
-			droplets:    1e8, // 1 WAVES
+			wavelets:    1e8, // 1 WAVES
 			rate:        "500",
 			result:      500e6, // 500 MDL
 		},
-
 		{
 			maxDecimals: 0,
-			droplets:    100e6, // 1 WAVES
+			wavelets:    2e7, // 0.2 WAVES
 			rate:        "500",
-			result:      500e6, // 500 MDL
+			result:      100e6, // 100 MDL
 		},
 		{
 			maxDecimals: 0,
-			droplets:    2e5,   // 0.2 WAVES
-			rate:        "500", // 500 MDL/WAVES = 1 MDL / 0.002 BTC
-			result:      1e6,   // 100 MDL
+			wavelets:    1e8, // 1 WAVES
+			rate:        "1/2",
+			result:      0, // 0.5 MDL, truncated to 0 MDL
 		},
-
 		{
-			maxDecimals: 0,
-			droplets:    1e8, // 1 WAVES
+			maxDecimals: 1,
+			wavelets:    1e8, // 1 WAVES
 			rate:        "1/2",
 			result:      5e5, // 0.5 MDL
 		},
 		{
 			maxDecimals: 0,
-			droplets:    1e12, // 10000 WAVES
+			wavelets:    1e12, // 10000 WAVES
 			rate:        "1/2",
-			result:      50000e5, // 5000 MDL
+			result:      5000e6, // 5000 MDL
 		},
-
 		{
 			maxDecimals: 0,
-			droplets:    12345e6, // 123.45 WAVES
+			wavelets:    12345e6, // 123.45 WAVES
 			rate:        "1/2",
-			result:      617e5, // 61.7 MDL
-		},
-		{
-			maxDecimals: 0,
-			droplets:    1e6, // 0.01 MDL
-			rate:        "0.0001",
-			result:      0, // 0 MDL
-		},
-		{
-			maxDecimals: 0,
-			droplets:    12345678, // 0.123456 WAVES
-			rate:        "512",
-			result:      632e5, // 63 MDL
+			result:      61e6, // 61.725 MDL, truncated to 61 MDL
 		},
 		{
-			maxDecimals: 0,
-			droplets:    123456789, // 1.234567 BTC
-			rate:        "10000",
-			result:      123456e5, // 12345.6 MDL
-		},
-		{
-			maxDecimals: 0,
-			droplets:    876543219e4, // 87654.3219 WAVES
-			rate:        "2/3",
-			result:      584362e5, // 58436.2 MDL
-		},
-		{
-			maxDecimals: 1,
-			droplets:    1e7, // 1 WAVES
+			maxDecimals: 2,
+			wavelets:    12345e6, // 123.45 WAVES
 			rate:        "1/2",
-			result:      5e4, // 0.5 MDL
+			result:      6172e4, // 61.725 MDL, truncated to 61.72 MDL
 		},
 		{
-			maxDecimals: 1,
-			droplets:    12345e8, // 12345 WAVES
+			maxDecimals: 3,
+			wavelets:    12345e6, // 123.45 WAVES
 			rate:        "1/2",
-			result:      61725e5, // 6172.5 MDL
+			result:      61725e3, // 61.725 MDL
 		},
 		{
-			maxDecimals: 1,
-			droplets:    1e3, // 0.000010 WAVES
+			maxDecimals: 3,
+			wavelets:    1e6, // 0.01 WAVES
 			rate:        "0.0001",
-			result:      0, // 0 MDL
+			result:      0, // 0.000001 MDL, truncated to 0 MDL
 		},
 		{
-			maxDecimals: 1,
-			droplets:    12345678, // 0.123456 WAVES
-			rate:        "512",
-			result:      632e5, // 63.2 MDL
+			maxDecimals: 3,
+			wavelets:    1e8, // 1 WAVES
+			rate:        "0.0001",
+			result:      0, // 0.0001 MDL, truncated to 0 MDL
 		},
 		{
-			maxDecimals: 1,
-			droplets:    123456789, // 1.234567 WAVES
-			rate:        "10000",
-			result:      1234567e4, // 12345.67 MDL
+			maxDecimals: 4,
+			wavelets:    1e8, // 1 WAVES
+			rate:        "0.0001",
+			result:      1e2, // 0.0001 MDL
 		},
 		{
-			maxDecimals: 1,
-			droplets:    876543219e4, // 87654.3219 WAVES
-			rate:        "2/3",
-			result:      5843621e4, // 58436.2 MDL
+			maxDecimals: 0,
+			wavelets:    12345678, // 0.12345678 WAVES
+			rate:        "512",
+			result:      63e6, // 63.20987136 MDL, truncated to 63 MDL
 		},
-
 		{
-			maxDecimals: 2,
-			droplets:    1e8, // 1 WAVES
-			rate:        "1/2",
-			result:      5e5, // 0.5 MDL
+			maxDecimals: 1,
+			wavelets:    12345678, // 0.12345678 WAVES
+			rate:        "512",
+			result:      632e5, // 63.2 MDL
 		},
 		{
-			maxDecimals: 2,
-			droplets:    12345e8, // 12345 WAVES
-			rate:        "1/2",
-			result:      61725e5, // 6172.5 MDL
+			maxDecimals: 3,
+			wavelets:    12345678, // 0.12345678 WAVES
+			rate:        "512",
+			result:      63209e3, // 63.209 MDL
 		},
 		{
-			maxDecimals: 2,
-			droplets:    1e8, // 1 WAVES
-			rate:        "0.0001",
-			result:      0, // 0 MDL
+			maxDecimals: 0,
+			wavelets:    123456789, // 1.23456789 WAVES
+			rate:        "10000",
+			result:      12345e6, // 12345.6789 MDL, truncated to 12345 MDL
 		},
 		{
-			maxDecimals: 2,
-			droplets:    12345678, // 0.123456 BTC
-			rate:        "512",
-			result:      63209e3, // 63.209 MDL
+			maxDecimals: 3,
+			wavelets:    123456789, // 1.23456789 WAVES
+			rate:        "10000",
+			result:      12345678e3, // 12345.678 MDL
 		},
 		{
-			maxDecimals: 2,
-			droplets:    1234567e2, // 1.234567 WAVES
-			rate:        "10000",
-			result:      1234567e4, // 12345.67 MDL
+			maxDecimals: 0,
+			wavelets:    876543219e4, // 87654.3219 WAVES
+			rate:        "2/3",
+			result:      58436e6, // 2/3 is parsed as 0.66666667, 58436.21462... MDL, truncated to 58436 MDL
 		},
 		{
-			maxDecimals: 2,
-			droplets:    876543219e4, // 87654.3219 WAVES
+			maxDecimals: 3,
+			wavelets:    876543219e4, // 87654.3219 WAVES
 			rate:        "2/3",
 			result:      58436214e3, // 58436.214 MDL
 		},
-
 		{
 			maxDecimals: 3,
-			droplets:    1e8, // 1 WAVES
-			rate:        "1/2",
-			result:      5e5, // 0.5 MDL
+			wavelets:    125e4, // 0.0125 WAVES
+			rate:        "1250",
+			result:      15625e3, // 15.625 MDL
 		},
 		{
-			maxDecimals: 3,
-			droplets:    12345e8, // 12345 WAVES
-			rate:        "1/2",
-			result:      61725e5, // 6172.5 MDL
+			maxDecimals: 0,
+			wavelets:    -1,
+			rate:        "1",
+			err:         errors.New("wavelets must be greater than or equal to 0"),
 		},
 		{
-			maxDecimals: 3,
-			droplets:    1e8, // 1 WAVES
-			rate:        "0.0001",
-			result:      1e2, // 0.0001 MDL
+			maxDecimals: 0,
+			wavelets:    1,
+			rate:        "-1",
+			err:         errors.New("rate must be greater than zero"),
 		},
 		{
-			maxDecimals: 3,
-			droplets:    12345678, // 0.123456 WAVES
-			rate:        "512",
-			result:      632098e2, // 63.2098 MDL
+			maxDecimals: 0,
+			wavelets:    1,
+			rate:        "0",
+			err:         errors.New("rate must be greater than zero"),
 		},
 		{
-			maxDecimals: 3,
-			droplets:    123456789, // 1.234567 WAVES
-			rate:        "10000",
-			result:      123456789e2, // 12345.678 MDL
+			maxDecimals: 0,
+			wavelets:    1,
+			rate:        "invalidrate",
+			err:         errors.New("can't convert invalidrate to decimal: exponent is not numeric"),
 		},
 		{
-			maxDecimals: 3,
-			droplets:    876543219e4, // 87654.3219 WAVES
-			rate:        "2/3",
-			result:      584362148e2, // 58436.2148 MDL
+			maxDecimals: 0,
+			wavelets:    1,
+			rate:        "12k",
+			err:         errors.New("can't convert 12k to decimal"),
 		},
-
 		{
-			maxDecimals: 4,
-			droplets:    1e8, // 0.0001 WAVES
-			rate:        "0.0001",
-			result:      1e2, // 0.0001 MDL
+			maxDecimals: 0,
+			wavelets:    1,
+			rate:        "1b",
+			err:         errors.New("can't convert 1b to decimal"),
 		},
-
 		{
-			maxDecimals: 3,
-			droplets:    125e4, // 0.0125 WAVES
-			rate:        "1250",
-			result:      15625e3, // 15.625 MDL
+			maxDecimals: 0,
+			wavelets:    1,
+			rate:        "",
+			err:         errors.New("can't convert  to decimal"),
+		},
+		{
+			maxDecimals: -1,
+			wavelets:    1,
+			rate:        "1",
+			err:         errors.New("maxDecimals can't be negative"),
 		},
 	}
 
 	for _, tc := range cases {
-		name := fmt.Sprintf("droplets=%d rate=%s maxDecimals=%d", tc.droplets, tc.rate, tc.maxDecimals)
+		name := fmt.Sprintf("wavelets=%d rate=%s maxDecimals=%d", tc.wavelets, tc.rate, tc.maxDecimals)
 		t.Run(name, func(t *testing.T) {
-			result, err := CalculateWavesMDLValue(tc.droplets, tc.rate, tc.maxDecimals)
-			if tc.err == nil {
-
-				expectedAmtCoins, err := droplet.ToString(result)
-				if err != nil {
-					t.Error("droplet.ToString failed")
-					return
-				}
-				expectedDecimal := decimal.New(int64(tc.result), -6)
-				expectedStr := expectedDecimal.StringFixed(6)
-
-				droptletsDecimal := decimal.New(int64(tc.droplets/100), -6)
-				dropletsAmtCoins := droptletsDecimal.StringFixed(6)
-
-				require.NoError(t, err)
-
-				require.Equal(t, expectedStr, expectedAmtCoins, "expected(%s) != actual(%s), coins(%s), rate(%s)", expectedStr, expectedAmtCoins, dropletsAmtCoins, tc.rate)
-				require.Equal(t, tc.result, result, "%d != %d")
-			} else {
+			result, err := CalculateWavesMDLValue(tc.wavelets, tc.rate, tc.maxDecimals)
+			if tc.err != nil {
 				require.Error(t, err)
 				require.Equal(t, tc.err, err)
 				require.Equal(t, uint64(0), result, "%d != 0", result)
+				return
 			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.result, result, "%d != %d", tc.result, result)
 		})
 	}
 }
 
+func TestCalculateWavesMDLValueOneWaves(t *testing.T) {
+	// One WAVES is worth exactly the rate, at any maxDecimals the rate fits in
+	for _, rate := range []string{"1", "88", "0.5", "1250.125"} {
+		result, err := CalculateWavesMDLValue(WaveletsPerWAVES, rate, 3)
+		require.NoError(t, err)
+
+		mdl, err := droplet.ToString(result)
+		require.NoError(t, err)
+
+		expected, err := decimal.NewFromString(rate)
+		require.NoError(t, err)
+		actual, err := decimal.NewFromString(mdl)
+		require.NoError(t, err)
+		require.True(t, expected.Equal(actual), "rate %s: %s != %s", rate, expected, actual)
+	}
+}
 
 func TestCalculateWaves_MDLLIFE_MDLValue(t *testing.T) {
-	//The WAVES price is listed as 10^8. (1e8=1 WAVES)
+	// MDL.life tokens on Waves have 8 decimals, like WAVES
 	cases := []struct {
 		maxDecimals int
-		droplets    int64
+		wavelets    int64
 		rate        string
 		result      uint64
-		err         error
 	}{
 		{
-			maxDecimals: 0,
-			droplets:    10000000, //0.1 MDL.life //http://node.wavesbi.com:6869/blocks/seq/959412/959419 http://wavesgo.com/transactions/38dwB49fQ2bY33z6V36exD2u2JBgUoSoauYThyiV8Lfi
+			maxDecimals: 1,
+			wavelets:    10000000, //0.1 MDL.life //http://node.wavesbi.com:6869/blocks/seq/959412/959419 http://wavesgo.com/transactions/38dwB49fQ2bY33z6V36exD2u2JBgUoSoauYThyiV8Lfi
 			rate:        "1",
 			result:      1e5, //0.1 MDL
 		},
+		{
+			maxDecimals: 0,
+			wavelets:    10000000, // 0.1 MDL.life
+			rate:        "1",
+			result:      0, // 0.1 MDL, truncated to 0 MDL
+		},
 	}
 
 	for _, tc := range cases {
-		name := fmt.Sprintf("droplets=%d rate=%s maxDecimals=%d", tc.droplets, tc.rate, tc.maxDecimals)
+		name := fmt.Sprintf("wavelets=%d rate=%s maxDecimals=%d", tc.wavelets, tc.rate, tc.maxDecimals)
 		t.Run(name, func(t *testing.T) {
-			result, err := CalculateWavesMDLValue(tc.droplets, tc.rate, tc.maxDecimals)
-			if tc.err == nil {
+			result, err := CalculateWavesMDLValue(tc.wavelets, tc.rate, tc.maxDecimals)
+			require.NoError(t, err)
+			require.Equal(t, tc.result, result, "%d != %d", tc.result, result)
+		})
+	}
+}
+
+func TestMinDepositForPayout(t *testing.T) {
+	cases := []struct {
+		coinType    string
+		rate        string
+		maxDecimals int
+		fee         uint64
+		minDeposit  int64
+		amount      string
+		err         string
+	}{
+		{
+			// A fractional rate with no decimals needs more than 3 BTC to pay out 1 MDL
+			coinType:    scanner.CoinTypeBTC,
+			rate:        "1/3",
+			maxDecimals: 0,
+			minDeposit:  300000004,
+			amount:      "3.00000004",
+		},
+		{
+			coinType:    scanner.CoinTypeBTC,
+			rate:        "100",
+			maxDecimals: 3,
+			minDeposit:  1000,
+			amount:      "0.00001",
+		},
+		{
+			coinType:    scanner.CoinTypeBTC,
+			rate:        "100",
+			maxDecimals: 0,
+			minDeposit:  1e6,
+			amount:      "0.01",
+		},
+		{
+			// The deposit must be given more than the network fee of 1 MDL
+			coinType:    scanner.CoinTypeBTC,
+			rate:        "100",
+			maxDecimals: 3,
+			fee:         1e6,
+			minDeposit:  1001,
+			amount:      "0.00001001",
+		},
+		{
+			coinType:    scanner.CoinTypeBTC,
+			rate:        "0.00000001",
+			maxDecimals: 0,
+			minDeposit:  1e16,
+			amount:      "100000000",
+		},
+		{
+			coinType:    scanner.CoinTypeETH,
+			rate:        "10",
+			maxDecimals: 6,
+			minDeposit:  100,
+			amount:      "0.0000001",
+		},
+		{
+			coinType:    scanner.CoinTypeSKY,
+			rate:        "1/3",
+			maxDecimals: 0,
+			minDeposit:  4,
+			amount:      "0.000004",
+		},
+		{
+			coinType:    scanner.CoinTypeSKY,
+			rate:        "2",
+			maxDecimals: 0,
+			minDeposit:  1,
+			amount:      "0.000001",
+		},
+		{
+			coinType:    scanner.CoinTypeWAVES,
+			rate:        "1",
+			maxDecimals: 2,
+			minDeposit:  1e6,
+			amount:      "0.01",
+		},
+		{
+			coinType:    scanner.CoinTypeWAVESMDL,
+			rate:        "1",
+			maxDecimals: 3,
+			minDeposit:  1e5,
+			amount:      "0.001",
+		},
+		{
+			coinType:    scanner.CoinTypeBTC,
+			rate:        "0.0000000000000001",
+			maxDecimals: 0,
+			err:         "no deposit is paid out at this rate",
+		},
+		{
+			coinType:    scanner.CoinTypeBTC,
+			rate:        "foo",
+			maxDecimals: 0,
+			err:         "can't convert foo to decimal",
+		},
+		{
+			coinType:    "FOO",
+			rate:        "1",
+			maxDecimals: 0,
+			err:         scanner.ErrUnsupportedCoinType.Error(),
+		},
+	}
 
-				expectedAmtCoins, err := droplet.ToString(result)
-				if err != nil {
-					t.Error("droplet.ToString failed")
-					return
-				}
-				expectedDecimal := decimal.New(int64(tc.result), -6)
-				expectedStr := expectedDecimal.StringFixed(6)
+	for _, tc := range cases {
+		name := fmt.Sprintf("coinType=%s rate=%s maxDecimals=%d fee=%d", tc.coinType, tc.rate, tc.maxDecimals, tc.fee)
+		t.Run(name, func(t *testing.T) {
+			minDeposit, err := MinDepositForPayout(tc.coinType, tc.rate, tc.maxDecimals, tc.fee)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
 
-				droptletsDecimal := decimal.New(int64(tc.droplets/100), -6)
-				dropletsAmtCoins := droptletsDecimal.StringFixed(6)
+			require.NoError(t, err)
+			require.Equal(t, tc.minDeposit, minDeposit)
 
-				require.NoError(t, err)
+			// The minimum deposit is paid out, a smaller deposit is not
+			amt, err := CalculateDepositMDLValue(tc.coinType, minDeposit, tc.rate, tc.maxDecimals)
+			require.NoError(t, err)
+			require.NotEqual(t, uint64(0), DeductNetworkFee(amt, tc.fee))
 
-				require.Equal(t, expectedStr, expectedAmtCoins, "expected(%s) != actual(%s), coins(%s), rate(%s)", expectedStr, expectedAmtCoins, dropletsAmtCoins, tc.rate)
-				require.Equal(t, tc.result, result, "%d != %d")
-			} else {
+			amt, err = CalculateDepositMDLValue(tc.coinType, minDeposit-1, tc.rate, tc.maxDecimals)
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), DeductNetworkFee(amt, tc.fee))
+
+			amount, err := DepositValueToDecimal(tc.coinType, minDeposit)
+			require.NoError(t, err)
+			require.Equal(t, tc.amount, amount.String())
+		})
+	}
+}
+
+func TestMinDepositsForPayout(t *testing.T) {
+	minDeposits, err := MinDepositsForPayout(config.MDLExchanger{
+		MDLBtcExchangeRate:   "100",
+		MDLSkyExchangeRate:   "2",
+		MDLWavesExchangeRate: "1",
+		MaxDecimals:          3,
+	})
+	require.NoError(t, err)
+
+	// Coins without a rate are left out
+	require.Equal(t, map[string]int64{
+		scanner.CoinTypeBTC:   1000,
+		scanner.CoinTypeSKY:   1,
+		scanner.CoinTypeWAVES: 1e4,
+	}, minDeposits)
+
+	_, err = MinDepositsForPayout(config.MDLExchanger{
+		MDLBtcExchangeRate: "0.0000000000000001",
+	})
+	require.Error(t, err)
+	require.Equal(t, "BTC: no deposit is paid out at this rate", err.Error())
+
+	// The spread raises the smallest deposit paid out
+	minDeposits, err = MinDepositsForPayout(config.MDLExchanger{
+		MDLBtcExchangeRate: "100",
+		MDLBtcSpread:       "50",
+		MaxDecimals:        3,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{
+		scanner.CoinTypeBTC: 2000,
+	}, minDeposits)
+
+	// The network fee raises the smallest deposit paid out, only if it is deducted
+	cfg := config.MDLExchanger{
+		MDLBtcExchangeRate: "100",
+		MaxDecimals:        3,
+		NetworkFee:         "1",
+	}
+	minDeposits, err = MinDepositsForPayout(cfg)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{
+		scanner.CoinTypeBTC: 1000,
+	}, minDeposits)
+
+	cfg.DeductNetworkFee = true
+	minDeposits, err = MinDepositsForPayout(cfg)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{
+		scanner.CoinTypeBTC: 1001,
+	}, minDeposits)
+}
+
+func TestApplySpread(t *testing.T) {
+	tt := []struct {
+		name   string
+		rate   string
+		spread string
+		out    string
+		err    bool
+	}{
+		{"no spread", "100", "", "100", false},
+		{"zero spread", "100", "0", "100", false},
+		{"2 percent", "100", "2", "98", false},
+		{"fractional spread", "100", "0.5", "99.5", false},
+		{"rational rate", "1/2", "10", "0.45", false},
+		{"invalid spread", "100", "x", "", true},
+		{"invalid rate", "0", "2", "", true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := ApplySpread(tc.rate, tc.spread)
+			if tc.err {
 				require.Error(t, err)
-				require.Equal(t, tc.err, err)
-				require.Equal(t, uint64(0), result, "%d != 0", result)
+				return
 			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.out, out)
+		})
+	}
+}
+
+func TestDeductNetworkFee(t *testing.T) {
+	tt := []struct {
+		name  string
+		gross uint64
+		fee   uint64
+		net   uint64
+	}{
+		{"no fee", 100e6, 0, 100e6},
+		{"fee deducted", 100e6, 1500000, 98500000},
+		{"fee equals gross", 100e6, 100e6, 0},
+		{"fee larger than gross, floored at zero", 1e6, 100e6, 0},
+		{"zero gross", 0, 1e6, 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.net, DeductNetworkFee(tc.gross, tc.fee))
 		})
 	}
 }
@@ -29,6 +29,10 @@ const (
 	StatusWaitDecide
 	// StatusWaitPassthrough wait to buy from 3rd party exchange
 	StatusWaitPassthrough
+	// StatusWaitReview deposit is held for manual review, it is not processed
+	StatusWaitReview
+	// StatusUnbound deposit to an address that is not bound to a mdl address, quarantined for manual handling
+	StatusUnbound
 
 	// PassthroughExchangeC2CX for deposits using passthrough to c2cx.com
 	PassthroughExchangeC2CX = "c2cx"
@@ -42,6 +46,8 @@ var statusString = []string{
 	StatusUnknown:         "unknown",
 	StatusWaitDecide:      "waiting_decide",
 	StatusWaitPassthrough: "waiting_passthrough",
+	StatusWaitReview:      "waiting_review",
+	StatusUnbound:         "unbound",
 }
 
 func (s Status) String() string {
@@ -63,6 +69,10 @@ func NewStatusFromStr(st string) Status {
 		return StatusWaitDecide
 	case statusString[StatusWaitPassthrough]:
 		return StatusWaitPassthrough
+	case statusString[StatusWaitReview]:
+		return StatusWaitReview
+	case statusString[StatusUnbound]:
+		return StatusUnbound
 	default:
 		return StatusUnknown
 	}
@@ -74,28 +84,100 @@ type BoundAddress struct {
 	Address    string
 	CoinType   string
 	BuyMethod  string
+	Reference  string // Optional reference supplied by the integrator when binding
+	Label      string // Optional deposit address label requested by the integrator when binding
+	CreatedAt  int64  // When the address was bound, as a unix timestamp. 0 for bindings made before it was recorded
+	Version    uint64 // Version of the binding when it was saved, see DepositInfo.Version
+
+	// Optional amount of the coin expected to be deposited, as a decimal string, for invoice-style binds.
+	// A deposit that doesn't match it within mdl_exchanger.expected_amount_tolerance is held for review
+	ExpectedAmount string
+
+	// Optional email address of the end user, notified when the payout of a deposit is done if email.user_notifications is enabled
+	ContactEmail string
+}
+
+// BindOptions are the optional values of a binding requested by the integrator, copied to the BoundAddress
+type BindOptions struct {
+	Reference      string // Copied to each deposit to the address and echoed back in the deposit statuses
+	Label          string // Label of the deposit address to bind, see addrs.AddrManager.NewLabeledAddress
+	ExpectedAmount string // Amount of the coin expected to be deposited, see BoundAddress.ExpectedAmount
+	ContactEmail   string // Email address of the end user, see BoundAddress.ContactEmail
 }
 
 // DepositInfo records the deposit info
 type DepositInfo struct {
 	Seq            uint64
 	UpdatedAt      int64
+	Version        uint64 // Increases every time a deposit record or binding is saved, across the db. 0 if last saved before it was recorded
 	Status         Status // TODO -- migrate to string statuses?
 	CoinType       string
 	MDLAddress     string
 	BuyMethod      string
+	Reference      string // Reference copied from the BoundAddress
+	Label          string // Label copied from the BoundAddress
+	ExpectedAmount string // ExpectedAmount copied from the BoundAddress
+	ContactEmail   string // ContactEmail copied from the BoundAddress
 	DepositAddress string
 	DepositID      string
 	Txid           string
 	ConversionRate string // MDL per other coin, as a decimal string (allows integers, floats, fractions)
 	DepositValue   int64  // Deposit amount. Should be measured in the smallest unit possible (e.g. satoshis for BTC)
 	MDLSent        uint64 // MDL sent, measured in droplets
+	MDLGross       uint64 // MDL value of the deposit before the network fee was deducted, in droplets. 0 unless mdl_exchanger.deduct_network_fee is enabled
+	MDLNet         uint64 // MDLGross less the network fee, floored at zero, in droplets. 0 unless mdl_exchanger.deduct_network_fee is enabled
 	Passthrough    PassthroughData
 	Error          string // An error that occurred during processing
+	Imported       bool   // Recorded by an admin with the admin panel's /api/deposit-import instead of by a scanner
 	// The original Deposit is saved for the records, in case there is a mistake.
 	// Do not use this data directly.  All necessary data is copied to the top level
 	// of DepositInfo (e.g. DepositID, DepositAddress, DepositValue, CoinType).
 	Deposit scanner.Deposit
+
+	// When the deposit reached each phase of processing
+	Timestamps DepositTimestamps
+}
+
+// DepositTimestamps records when a deposit reached each phase of processing, as unix timestamps.
+// A phase that has not been reached yet is 0.
+type DepositTimestamps struct {
+	BoundAt         int64 `json:"bound_at"`          // The deposit address was bound, copied from BoundAddress.CreatedAt
+	DetectedAt      int64 `json:"detected_at"`       // The deposit was received from the scanner
+	ConfirmedAt     int64 `json:"confirmed_at"`      // The deposit is ready to be paid, StatusWaitSend
+	SendStartedAt   int64 `json:"send_started_at"`   // The MDL transaction was broadcast, StatusWaitConfirm
+	SendCompletedAt int64 `json:"send_completed_at"` // The MDL transaction was confirmed, StatusDone
+}
+
+// startedAt returns when the deposit was detected, or when its address was bound if no deposit was seen yet.
+// Records saved before the timestamps were added fall back to UpdatedAt
+func (di DepositInfo) startedAt() int64 {
+	switch {
+	case di.Timestamps.DetectedAt != 0:
+		return di.Timestamps.DetectedAt
+	case di.Status == StatusWaitDeposit && di.Timestamps.BoundAt != 0:
+		return di.Timestamps.BoundAt
+	default:
+		return di.UpdatedAt
+	}
+}
+
+// stamp records t as the time the deposit reached status, unless a time was already recorded
+func (ts *DepositTimestamps) stamp(status Status, t int64) {
+	var phase *int64
+	switch status {
+	case StatusWaitSend:
+		phase = &ts.ConfirmedAt
+	case StatusWaitConfirm:
+		phase = &ts.SendStartedAt
+	case StatusDone:
+		phase = &ts.SendCompletedAt
+	default:
+		return
+	}
+
+	if *phase == 0 {
+		*phase = t
+	}
 }
 
 // PassthroughData encapsulates data used for OTC passthrough
@@ -185,9 +267,24 @@ func (di DepositInfo) ValidateForStatus() error {
 	case StatusWaitSend:
 		return checkWaitSend()
 
-	case StatusWaitDecide:
+	case StatusWaitDecide, StatusWaitReview:
 		return checkWaitSend()
 
+	case StatusUnbound:
+		if di.Seq == 0 {
+			return errors.New("Seq missing")
+		}
+		if di.MDLAddress != "" {
+			return errors.New("MDLAddress set")
+		}
+		if di.DepositAddress == "" {
+			return errors.New("DepositAddress missing")
+		}
+		if di.DepositID == "" {
+			return errors.New("DepositID missing")
+		}
+		return nil
+
 	case StatusWaitDeposit, StatusUnknown:
 		fallthrough
 	default:
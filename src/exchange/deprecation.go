@@ -0,0 +1,99 @@
+package exchange
+
+import (
+	"errors"
+	"time"
+
+	"github.com/MDLlife/teller/src/scanner"
+)
+
+// CoinStage is the stage of a coin type in the deprecation workflow
+type CoinStage string
+
+const (
+	// CoinStageActive is a coin type that is not deprecated
+	CoinStageActive CoinStage = "active"
+	// CoinStageDeprecated is a deprecated coin type. New deposit addresses can't be bound,
+	// the deposits to the bound addresses are still scanned and processed until the deprecation window passes
+	CoinStageDeprecated CoinStage = "deprecated"
+	// CoinStageRetired is a deprecated coin type whose deprecation window has passed. Its scanner is stopped
+	CoinStageRetired CoinStage = "retired"
+)
+
+// ErrCoinDeprecated is returned when binding a deposit address of a deprecated coin type
+var ErrCoinDeprecated = errors.New("This coin type is deprecated, new deposit addresses can't be bound")
+
+// CoinDeprecation is the deprecation state of a coin type
+type CoinDeprecation struct {
+	CoinType     string    `json:"coin_type"`
+	Stage        CoinStage `json:"stage"`
+	DeprecatedAt int64     `json:"deprecated_at"` // unix time the coin type was deprecated
+	RetiresAt    int64     `json:"retires_at"`    // unix time the coin type's scanner is stopped
+}
+
+// NewCoinDeprecation returns the deprecation state at now of a coin type deprecated at deprecatedAt,
+// whose deposits are processed for window after it was deprecated
+func NewCoinDeprecation(coinType string, deprecatedAt time.Time, window time.Duration, now time.Time) CoinDeprecation {
+	retiresAt := deprecatedAt.Add(window)
+
+	stage := CoinStageDeprecated
+	if !now.Before(retiresAt) {
+		stage = CoinStageRetired
+	}
+
+	return CoinDeprecation{
+		CoinType:     coinType,
+		Stage:        stage,
+		DeprecatedAt: deprecatedAt.Unix(),
+		RetiresAt:    retiresAt.Unix(),
+	}
+}
+
+// DeprecateCoin deprecates a coin type. New deposit addresses of the coin type can't be bound anymore,
+// and once mdl_exchanger.coin_deprecation_window has passed the coin type is retired.
+// Deprecating a coin type that is already deprecated leaves it unchanged
+func (e *Exchange) DeprecateCoin(coinType string) (*CoinDeprecation, error) {
+	if ct, err := scanner.NormalizeCoinType(coinType, nil); err != nil || ct != coinType {
+		return nil, scanner.ErrUnsupportedCoinType
+	}
+
+	deprecatedAt, err := e.store.DeprecateCoin(coinType, time.Now().UTC().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	d := NewCoinDeprecation(coinType, time.Unix(deprecatedAt, 0), e.cfg.CoinDeprecationWindow, time.Now())
+
+	e.log.WithField("coinDeprecation", d).Warn("Coin type deprecated")
+
+	return &d, nil
+}
+
+// RestoreCoin cancels the deprecation of a coin type, allowing binds again.
+// The scanner of a retired coin type is not resumed
+func (e *Exchange) RestoreCoin(coinType string) error {
+	if err := e.store.RestoreCoin(coinType); err != nil {
+		return err
+	}
+
+	e.log.WithField("coinType", coinType).Info("Coin type deprecation cancelled")
+
+	return nil
+}
+
+// GetCoinDeprecations returns the deprecation states of the deprecated coin types, keyed by coin type.
+// Coin types that are not included are active
+func (e *Exchange) GetCoinDeprecations() (map[string]CoinDeprecation, error) {
+	deprecatedAts, err := e.store.GetCoinDeprecations()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deprecations := make(map[string]CoinDeprecation, len(deprecatedAts))
+	for coinType, deprecatedAt := range deprecatedAts {
+		deprecations[coinType] = NewCoinDeprecation(coinType, time.Unix(deprecatedAt, 0), e.cfg.CoinDeprecationWindow, now)
+	}
+
+	return deprecations, nil
+}
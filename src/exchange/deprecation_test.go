@@ -0,0 +1,97 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+func TestNewCoinDeprecation(t *testing.T) {
+	deprecatedAt := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	window := time.Hour * 24
+
+	d := NewCoinDeprecation(scanner.CoinTypeBTC, deprecatedAt, window, deprecatedAt)
+	require.Equal(t, CoinDeprecation{
+		CoinType:     scanner.CoinTypeBTC,
+		Stage:        CoinStageDeprecated,
+		DeprecatedAt: deprecatedAt.Unix(),
+		RetiresAt:    deprecatedAt.Add(window).Unix(),
+	}, d)
+
+	d = NewCoinDeprecation(scanner.CoinTypeBTC, deprecatedAt, window, deprecatedAt.Add(window-time.Second))
+	require.Equal(t, CoinStageDeprecated, d.Stage)
+
+	d = NewCoinDeprecation(scanner.CoinTypeBTC, deprecatedAt, window, deprecatedAt.Add(window))
+	require.Equal(t, CoinStageRetired, d.Stage)
+
+	// Without a window, the coin type is retired as soon as it is deprecated
+	d = NewCoinDeprecation(scanner.CoinTypeBTC, deprecatedAt, 0, deprecatedAt)
+	require.Equal(t, CoinStageRetired, d.Stage)
+}
+
+func TestExchangeCoinDeprecation(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	multiplexer := scanner.NewMultiplexer(log)
+	err = multiplexer.AddScanner(newDummyScanner(), scanner.CoinTypeBTC)
+	require.NoError(t, err)
+
+	cfg := defaultCfg
+	cfg.CoinDeprecationWindow = time.Hour
+	e, err := NewDirectExchange(log, cfg, store, multiplexer, nil)
+	require.NoError(t, err)
+
+	// Active
+	deprecations, err := e.GetCoinDeprecations()
+	require.NoError(t, err)
+	require.Empty(t, deprecations)
+
+	_, err = e.DeprecateCoin("btc")
+	require.Equal(t, scanner.ErrUnsupportedCoinType, err)
+
+	// Deprecated
+	d, err := e.DeprecateCoin(scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, scanner.CoinTypeBTC, d.CoinType)
+	require.Equal(t, CoinStageDeprecated, d.Stage)
+	require.Equal(t, d.DeprecatedAt+3600, d.RetiresAt)
+
+	deprecations, err = e.GetCoinDeprecations()
+	require.NoError(t, err)
+	require.Equal(t, map[string]CoinDeprecation{
+		scanner.CoinTypeBTC: *d,
+	}, deprecations)
+
+	// Deprecating again keeps the time it was deprecated
+	deprecatedAt, err := store.DeprecateCoin(scanner.CoinTypeBTC, d.DeprecatedAt+100)
+	require.NoError(t, err)
+	require.Equal(t, d.DeprecatedAt, deprecatedAt)
+
+	// Retired, once the window has passed
+	err = store.RestoreCoin(scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	_, err = store.DeprecateCoin(scanner.CoinTypeBTC, time.Now().Add(-time.Hour*2).Unix())
+	require.NoError(t, err)
+
+	deprecations, err = e.GetCoinDeprecations()
+	require.NoError(t, err)
+	require.Len(t, deprecations, 1)
+	require.Equal(t, CoinStageRetired, deprecations[scanner.CoinTypeBTC].Stage)
+
+	// Restored
+	err = e.RestoreCoin(scanner.CoinTypeBTC)
+	require.NoError(t, err)
+
+	deprecations, err = e.GetCoinDeprecations()
+	require.NoError(t, err)
+	require.Empty(t, deprecations)
+}
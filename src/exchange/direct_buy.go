@@ -85,6 +85,12 @@ func (p *DirectBuy) runUpdateStatus() {
 				continue
 			}
 
+			// A stale copy of a deposit that was handled already
+			if updatedDeposit.Status != StatusWaitSend {
+				log.WithField("depositInfo", updatedDeposit).Warn("Deposit is not waiting for a decision anymore, skipping")
+				continue
+			}
+
 			p.deposits <- updatedDeposit
 		}
 	}
@@ -107,10 +113,13 @@ func (p *DirectBuy) Deposits() <-chan DepositInfo {
 // updateStatus sets the deposit's status to StatusWaitSend.
 // The deposit will be picked up by the Send component which will send the coins.
 // The fixed exchange rate is already set by the receiver when it creates the deposit, so no other action is needed.
+// A deposit whose saved status is not StatusWaitDecide anymore is left unchanged.
 // TODO -- set the rate here instead?
 func (p *DirectBuy) updateStatus(di DepositInfo) (DepositInfo, error) {
 	updatedDi, err := p.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
-		di.Status = StatusWaitSend
+		if di.Status == StatusWaitDecide {
+			di.Status = StatusWaitSend
+		}
 		return di
 	})
 	if err != nil {
@@ -1,7 +1,9 @@
 package exchange
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	//"github.com/MDLlife/MDL/src/cli"
 
 	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/events"
 	"github.com/MDLlife/teller/src/scanner"
 	"github.com/MDLlife/teller/src/sender"
 	"github.com/MDLlife/MDL/src/readable"
@@ -35,6 +38,22 @@ var (
 	ErrLowExchangeBalance = errors.New("Exchange has less coins than it should")
 	// ErrNoAsksAvailable is returned if there are no ask orders available on the exchange orderbook
 	ErrNoAsksAvailable = errors.New("No ask orders available")
+	// ErrReadOnly is returned by a read-only Exchange for operations that would bind, scan or send
+	ErrReadOnly = errors.New("Exchange is read-only")
+	// ErrRateNotSet is returned for a deposit of a coin type whose exchange rate is not configured
+	ErrRateNotSet = errors.New("Exchange rate of this coin type is not set")
+	// ErrMaxDepositsPerBinding is recorded on a deposit held for review because its binding has too many deposits
+	ErrMaxDepositsPerBinding = errors.New("Deposit address has reached the max number of deposits per binding, deposit held for manual review")
+	// ErrMaxOutstanding is recorded on a deposit held for review because it would raise the MDL owed for unpaid deposits above the max
+	ErrMaxOutstanding = errors.New("Deposit would raise the MDL owed for unpaid deposits above the max outstanding, deposit held for manual review")
+	// ErrExpectedAmountMismatch is recorded on a deposit held for review because it doesn't match the expected amount of its binding
+	ErrExpectedAmountMismatch = errors.New("Deposit amount does not match the expected amount, deposit held for manual review")
+	// ErrHoursReserve is returned if a payout would spend the coin hours reserved by mdl_exchanger.min_reserved_hours
+	ErrHoursReserve = errors.New("Payout would spend the reserved coin hours of the hot wallet, payouts are queued until the wallet has more coin hours")
+	// ErrDepositExists is returned when importing a deposit whose txid is already recorded
+	ErrDepositExists = errors.New("A deposit with this txid is already recorded")
+	// ErrDepositStatusChanged is returned if a deposit's saved status changed while it was being processed
+	ErrDepositStatusChanged = errors.New("Deposit status changed while it was being processed")
 )
 
 // DepositFilter filters deposits
@@ -48,13 +67,18 @@ type Runner interface {
 
 // Exchanger provides APIs to interact with the exchange service
 type Exchanger interface {
-	BindAddress(mdlAddr, depositAddr, coinType string) (*BoundAddress, error)
+	BindAddress(ctx context.Context, mdlAddr, depositAddr, coinType string, opts BindOptions) (*BoundAddress, error)
 	GetDepositStatuses(mdlAddr string) ([]DepositStatus, error)
 	GetDepositStatusDetail(flt DepositFilter) ([]DepositStatusDetail, error)
 	GetBindNum(mdlAddr string) (int, error)
+	GetCoinBindNum(mdlAddr, coinType string) (int, error)
+	GetLastBindTime(mdlAddr string) (int64, error)
+	GetCoinDeprecations() (map[string]CoinDeprecation, error)
 	GetDepositStats() (*DepositStats, error)
+	OptOutContactEmail(email string) error
 	Status() error
 	Balance() (*readable.BalancePair, error)
+	BreakerState() sender.BreakerState
 }
 
 // Exchange encompasses an entire coin<>mdl deposit-process-send flow
@@ -65,6 +89,10 @@ type Exchange struct {
 	quit  chan struct{}
 	done  chan struct{}
 
+	// readOnly is set for an Exchange created by NewReadOnlyExchange,
+	// which has no Receiver, Processor or Sender
+	readOnly bool
+
 	Receiver  ReceiveRunner
 	Processor ProcessRunner
 	Sender    SendRunner
@@ -145,6 +173,67 @@ func NewPassthroughExchange(log logrus.FieldLogger, cfg config.MDLExchanger, sto
 	}, nil
 }
 
+// NewReadOnlyExchange creates an Exchange that only serves queries from the store.
+// It does not scan for deposits or send coins, and BindAddress, Status and Balance return ErrReadOnly
+func NewReadOnlyExchange(log logrus.FieldLogger, cfg config.MDLExchanger, store Storer) (*Exchange, error) {
+	if store == nil {
+		return nil, errors.New("new read-only Exchange failed, store is nil")
+	}
+
+	return &Exchange{
+		log:      log.WithField("prefix", "teller.exchange.exchange"),
+		store:    store,
+		cfg:      cfg,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		readOnly: true,
+	}, nil
+}
+
+// ReadOnly returns true if the Exchange was created by NewReadOnlyExchange
+func (e *Exchange) ReadOnly() bool {
+	return e.readOnly
+}
+
+// SetPublisher sets the events.Publisher notified on deposit-recorded and payout-done transitions.
+// It must be called before Run. The publisher must not block; wrap it with events.AsyncPublisher.
+// Returns an error if the Receiver or Sender can't publish events, e.g. in read-only mode
+func (e *Exchange) SetPublisher(p events.Publisher) error {
+	r, ok := e.Receiver.(*Receive)
+	if !ok {
+		return fmt.Errorf("Receiver %T does not publish events", e.Receiver)
+	}
+
+	s, ok := e.Sender.(*Send)
+	if !ok {
+		return fmt.Errorf("Sender %T does not publish events", e.Sender)
+	}
+
+	r.publisher = p
+	s.publisher = p
+	return nil
+}
+
+// publishEvent publishes a deposit event. Failures are logged and otherwise ignored,
+// so that a broker outage never stalls deposit processing
+func publishEvent(log logrus.FieldLogger, p events.Publisher, eventType string, di DepositInfo) {
+	if err := p.Publish(events.Event{
+		Type:           eventType,
+		Time:           time.Now().UTC(),
+		DepositID:      di.DepositID,
+		CoinType:       di.CoinType,
+		DepositAddress: di.DepositAddress,
+		DepositValue:   di.DepositValue,
+		MDLAddress:     di.MDLAddress,
+		MDLSent:        di.MDLSent,
+		Txid:           di.Txid,
+		Status:         di.Status.String(),
+		ContactEmail:   di.ContactEmail,
+	}); err != nil {
+		log.WithError(err).WithField("eventType", eventType).Warn("Publish event failed")
+	}
+}
+
 // Run runs all components of the Exchange
 func (e *Exchange) Run() error {
 	e.log.Info("Start exchange service...")
@@ -153,6 +242,12 @@ func (e *Exchange) Run() error {
 		e.done <- struct{}{}
 	}()
 
+	if e.readOnly {
+		e.log.Info("Exchange is read-only, not processing deposits")
+		<-e.quit
+		return nil
+	}
+
 	// TODO: Alternative way of managing the subcomponents:
 	// Create channels for linking two components, initialize the components with the channels
 	// Close them to teardown
@@ -187,6 +282,14 @@ func (e *Exchange) Run() error {
 		}
 	}()
 
+	if e.cfg.StaleDepositThreshold > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.runReconciler()
+		}()
+	}
+
 	var err error
 	select {
 	case <-e.quit:
@@ -204,10 +307,12 @@ func (e *Exchange) Shutdown() {
 	e.log.Info("Shutting down Exchange")
 	close(e.quit)
 
-	e.log.Info("Shutting down Exchange subcomponents")
-	e.Receiver.Shutdown()
-	e.Processor.Shutdown()
-	e.Sender.Shutdown()
+	if !e.readOnly {
+		e.log.Info("Shutting down Exchange subcomponents")
+		e.Receiver.Shutdown()
+		e.Processor.Shutdown()
+		e.Sender.Shutdown()
+	}
 
 	e.log.Info("Waiting for run to finish")
 	<-e.done
@@ -218,8 +323,15 @@ func (e *Exchange) Shutdown() {
 type DepositStatus struct {
 	Seq       uint64 `json:"seq"`
 	UpdatedAt int64  `json:"updated_at"`
+	Version   uint64 `json:"version"`
 	Status    string `json:"status"`
 	CoinType  string `json:"coin_type"`
+	Reference string `json:"reference,omitempty"`
+	Label     string `json:"label,omitempty"`
+
+	ExpectedAmount string `json:"expected_amount,omitempty"`
+
+	Timestamps DepositTimestamps `json:"timestamps"`
 }
 
 // DepositStatusDetail deposit status detail info
@@ -245,8 +357,15 @@ func (e *Exchange) GetDepositStatuses(mdlAddr string) ([]DepositStatus, error) {
 		dss = append(dss, DepositStatus{
 			Seq:       di.Seq,
 			UpdatedAt: di.UpdatedAt,
+			Version:   di.Version,
 			Status:    di.Status.String(),
 			CoinType:  di.CoinType,
+			Reference: di.Reference,
+			Label:     di.Label,
+
+			ExpectedAmount: di.ExpectedAmount,
+
+			Timestamps: di.Timestamps,
 		})
 	}
 	return dss, nil
@@ -280,6 +399,81 @@ func (e *Exchange) GetBindNum(mdlAddr string) (int, error) {
 	return len(addrs), err
 }
 
+// GetLastBindTime returns when the given mdl address last bound an address, as a unix timestamp.
+// Returns 0 if it never bound an address, or only before the binding time was recorded
+func (e *Exchange) GetLastBindTime(mdlAddr string) (int64, error) {
+	addrs, err := e.store.GetMDLBindAddresses(mdlAddr)
+	if err != nil {
+		return 0, err
+	}
+
+	var last int64
+	for _, a := range addrs {
+		if a.CreatedAt > last {
+			last = a.CreatedAt
+		}
+	}
+
+	return last, nil
+}
+
+// GetCoinBindNum returns the number of addresses of a coin type the given mdl address bound
+func (e *Exchange) GetCoinBindNum(mdlAddr, coinType string) (int, error) {
+	addrs, err := e.store.GetMDLBindAddresses(mdlAddr)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, a := range addrs {
+		if a.CoinType == coinType {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// GetDepositAddress returns the deposit address of a coin type most recently bound to the given mdl address.
+// Returns ErrNoBoundAddress if it has no address of the coin type bound
+func (e *Exchange) GetDepositAddress(mdlAddr, coinType string) (string, error) {
+	addrs, err := e.store.GetMDLBindAddresses(mdlAddr)
+	if err != nil {
+		return "", err
+	}
+
+	var found *BoundAddress
+	for i, a := range addrs {
+		if a.CoinType != coinType {
+			continue
+		}
+		if found == nil || a.CreatedAt >= found.CreatedAt {
+			found = &addrs[i]
+		}
+	}
+
+	if found == nil {
+		return "", ErrNoBoundAddress
+	}
+
+	return found.Address, nil
+}
+
+// OptOutContactEmail stops the notifications to a contact email given when binding, for all its deposits
+func (e *Exchange) OptOutContactEmail(email string) error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+
+	if err := e.store.OptOutContactEmail(email, time.Now().UTC().Unix()); err != nil {
+		return err
+	}
+
+	e.log.Info("Contact email opted out of notifications")
+
+	return nil
+}
+
 // GetDepositStats returns deposit status
 func (e *Exchange) GetDepositStats() (*DepositStats, error) {
 	stats, err := e.store.GetDepositStats()
@@ -292,18 +486,72 @@ func (e *Exchange) GetDepositStats() (*DepositStats, error) {
 
 // Balance returns the number of coins left in the OTC wallet
 func (e *Exchange) Balance() (*readable.BalancePair, error) {
+	if e.readOnly {
+		return nil, ErrReadOnly
+	}
 	return e.Sender.Balance()
 }
 
 // Status returns the last return value of the processing state
 func (e *Exchange) Status() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
 	return e.Sender.Status()
 }
 
+// BreakerState returns the state of the mdl sender's circuit breaker,
+// or an empty string if it is disabled
+func (e *Exchange) BreakerState() sender.BreakerState {
+	if e.readOnly {
+		return ""
+	}
+	return e.Sender.BreakerState()
+}
+
+// SendsPaused returns true if sending coins is paused
+func (e *Exchange) SendsPaused() bool {
+	if e.readOnly {
+		return false
+	}
+	return e.Sender.SendsPaused()
+}
+
+// SetSendsPaused pauses or resumes sending coins for all coin types. The setting persists across restarts
+func (e *Exchange) SetSendsPaused(paused bool) error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	return e.Sender.SetSendsPaused(paused)
+}
+
 // BindAddress binds deposit address with mdl address, and
 // add the btc/eth address to scan service, when detect deposit coin
 // to the btc/eth address, will send specific mdl to the binded
 // mdl address
-func (e *Exchange) BindAddress(mdlAddr, depositAddr, coinType string) (*BoundAddress, error) {
-	return e.Receiver.BindAddress(mdlAddr, depositAddr, coinType, e.cfg.BuyMethod)
+func (e *Exchange) BindAddress(ctx context.Context, mdlAddr, depositAddr, coinType string, opts BindOptions) (*BoundAddress, error) {
+	if e.readOnly {
+		return nil, ErrReadOnly
+	}
+	return e.Receiver.BindAddress(ctx, mdlAddr, depositAddr, coinType, e.cfg.BuyMethod, opts)
+}
+
+// ImportDeposit records a deposit the scanner missed, so that it is paid like a scanned deposit.
+// The deposit address must be bound, and the deposit must be on the blockchain as described, see Receive.ImportDeposit.
+// Returns ErrDepositExists if a deposit with the same txid is already recorded
+func (e *Exchange) ImportDeposit(dv scanner.Deposit) (*DepositInfo, error) {
+	if e.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	if ct, err := scanner.NormalizeCoinType(dv.CoinType, nil); err != nil || ct != dv.CoinType {
+		return nil, scanner.ErrUnsupportedCoinType
+	}
+
+	di, err := e.Receiver.ImportDeposit(dv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &di, nil
 }
@@ -1,9 +1,14 @@
 package exchange
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"sync"
 	"testing"
@@ -16,11 +21,13 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
-	"github.com/MDLlife/MDL/src/cli"
+	"github.com/MDLlife/MDL/src/api"
 	"github.com/MDLlife/MDL/src/cipher"
 	"github.com/MDLlife/MDL/src/coin"
+	"github.com/MDLlife/MDL/src/readable"
 
 	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/events"
 	"github.com/MDLlife/teller/src/scanner"
 	"github.com/MDLlife/teller/src/sender"
 	"github.com/MDLlife/teller/src/util/testutil"
@@ -34,6 +41,7 @@ type dummySender struct {
 	txidConfirmMap          map[string]bool
 	changeAddr              string
 	changeCoins             uint64
+	hours                   uint64
 }
 
 func newDummySender() *dummySender {
@@ -41,6 +49,7 @@ func newDummySender() *dummySender {
 		txidConfirmMap: make(map[string]bool),
 		changeAddr:     "nYTKxHm6SZWAMdDVx6U9BqxKMuCjmSLp93",
 		changeCoins:    111e6,
+		hours:          100,
 	}
 }
 
@@ -120,16 +129,31 @@ func (s *dummySender) setTxConfirmed(txid string) {
 	s.txidConfirmMap[txid] = true
 }
 
-func (s *dummySender) Balance() (*cli.Balance, error) {
-	return &cli.Balance{
-		Coins: "1000.000000",
-		Hours: "100",
+func (s *dummySender) Balance() (*readable.BalancePair, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	bal := readable.Balance{
+		Coins: 1000e6,
+		Hours: s.hours,
+	}
+	return &readable.BalancePair{
+		Confirmed: bal,
+		Predicted: bal,
 	}, nil
 }
 
+func (s *dummySender) setHours(hours uint64) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.hours = hours
+}
+
 type dummyScanner struct {
 	dvC   chan scanner.DepositNote
 	addrs []string
+	chain []scanner.Deposit // deposits VerifyDeposit finds on the blockchain
 }
 
 func newDummyScanner() *dummyScanner {
@@ -151,6 +175,15 @@ func (scan *dummyScanner) GetScanAddresses() ([]string, error) {
 	return []string{}, nil
 }
 
+func (scan *dummyScanner) VerifyDeposit(dv scanner.Deposit) error {
+	for _, d := range scan.chain {
+		if d == dv {
+			return nil
+		}
+	}
+	return scanner.DepositMismatchError{Reason: "not found"}
+}
+
 func (scan *dummyScanner) addDeposit(d scanner.DepositNote) {
 	scan.dvC <- d
 }
@@ -260,6 +293,7 @@ func runExchange(t *testing.T) (*Exchange, func(), *logrus_test.Hook) {
 
 func runExchangeMockStore(t *testing.T) (*Exchange, func(), *logrus_test.Hook) {
 	store := &MockStore{}
+	store.On("GetSendsPaused").Return(false, nil)
 	log, hook := testutil.NewLogger(t)
 
 	bscr := newDummyScanner()
@@ -412,6 +446,8 @@ func TestExchangeRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		Status:         StatusWaitConfirm,
 		MDLAddress:     mdlAddr,
 		DepositAddress: dn.Deposit.Address,
@@ -426,6 +462,14 @@ func TestExchangeRunSend(t *testing.T) {
 
 	require.Equal(t, expectedDeposit, di)
 
+	// The deposit was detected, confirmed and sent, in that order
+	sentTimestamps := di.Timestamps
+	require.NotEmpty(t, sentTimestamps.DetectedAt)
+	require.True(t, sentTimestamps.ConfirmedAt >= sentTimestamps.DetectedAt)
+	require.True(t, sentTimestamps.SendStartedAt >= sentTimestamps.ConfirmedAt)
+	require.Equal(t, di.UpdatedAt, sentTimestamps.SendStartedAt)
+	require.Empty(t, sentTimestamps.SendCompletedAt)
+
 	// Mark the deposit as confirmed
 	e.Sender.(*Send).sender.(*dummySender).setTxConfirmed(txid)
 
@@ -455,26 +499,1244 @@ func TestExchangeRunSend(t *testing.T) {
 	di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
 	require.NoError(t, err)
 
-	require.NotEmpty(t, di.UpdatedAt)
+	require.NotEmpty(t, di.UpdatedAt)
+
+	expectedDeposit = DepositInfo{
+		Seq:            1,
+		CoinType:       scanner.CoinTypeBTC,
+		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
+		Status:         StatusDone,
+		MDLAddress:     mdlAddr,
+		DepositAddress: dn.Deposit.Address,
+		DepositID:      dn.Deposit.ID(),
+		Txid:           txid,
+		MDLSent:        100e6,
+		BuyMethod:      config.BuyMethodDirect,
+		ConversionRate: testMDLBtcRate,
+		DepositValue:   dn.Deposit.Value,
+		Deposit:        dn.Deposit,
+	}
+
+	require.Equal(t, expectedDeposit, di)
+
+	// The earlier timestamps are unchanged
+	require.True(t, di.Timestamps.SendCompletedAt >= sentTimestamps.SendStartedAt)
+	require.Equal(t, di.UpdatedAt, di.Timestamps.SendCompletedAt)
+	sentTimestamps.SendCompletedAt = di.Timestamps.SendCompletedAt
+	require.Equal(t, sentTimestamps, di.Timestamps)
+
+	// The timestamps are included in the deposit statuses
+	dss, err := e.GetDepositStatuses(mdlAddr)
+	require.NoError(t, err)
+	require.Len(t, dss, 1)
+	require.Equal(t, di.Timestamps, dss[0].Timestamps)
+
+	closeMultiplexer(e)
+}
+
+// mockPublisher records published events
+type mockPublisher struct {
+	sync.Mutex
+	events []events.Event
+	err    error
+}
+
+func (p *mockPublisher) Publish(e events.Event) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.events = append(p.events, e)
+	return nil
+}
+
+// Published returns a copy of the recorded events
+func (p *mockPublisher) Published() []events.Event {
+	p.Lock()
+	defer p.Unlock()
+
+	evs := make([]events.Event, len(p.events))
+	copy(evs, p.events)
+	return evs
+}
+
+func waitForEvents(t *testing.T, p *mockPublisher, n int) []events.Event {
+	timeout := time.After(dbScanTimeout)
+	for {
+		evs := p.Published()
+		if len(evs) >= n {
+			return evs
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("Waiting for %d events timed out, have %d", n, len(evs))
+		case <-time.After(statusCheckInterval):
+		}
+	}
+}
+
+func TestExchangePublishEvents(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+
+	e := newTestExchange(t, log, db)
+	publisher := &mockPublisher{}
+	err := e.SetPublisher(publisher)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, e.Run())
+	}()
+	defer func() {
+		shutdownDB()
+		<-done
+	}()
+	defer e.Shutdown()
+
+	mdlAddr := testMDLAddr
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, mdlAddr, btcAddr)
+
+	var value int64 = 1e8
+	mdlSent, err := CalculateBtcMDLValue(value, testMDLBtcRate, testMaxDecimals)
+	require.NoError(t, err)
+	txid := e.Sender.(*Send).sender.(*dummySender).predictTxid(t, mdlAddr, mdlSent)
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    value,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
+		},
+		ErrC: make(chan error, 1),
+	}
+	mp := e.Receiver.(*Receive).multiplexer
+	mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+	err = <-dn.ErrC
+	require.NoError(t, err)
+
+	// The deposit was recorded
+	evs := waitForEvents(t, publisher, 1)
+	require.Equal(t, events.DepositRecorded, evs[0].Type)
+	require.Equal(t, dn.Deposit.ID(), evs[0].DepositID)
+	require.Equal(t, scanner.CoinTypeBTC, evs[0].CoinType)
+	require.Equal(t, btcAddr, evs[0].DepositAddress)
+	require.Equal(t, mdlAddr, evs[0].MDLAddress)
+	require.Equal(t, value, evs[0].DepositValue)
+
+	// A deposit sent again by the scanner is not recorded again
+	dn.ErrC = make(chan error, 1)
+	mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+	err = <-dn.ErrC
+	require.NoError(t, err)
+
+	// No payout event is published until the transaction is confirmed
+	time.Sleep(dbCheckWaitTime)
+	require.Len(t, publisher.Published(), 1)
+
+	e.Sender.(*Send).sender.(*dummySender).setTxConfirmed(txid)
+
+	evs = waitForEvents(t, publisher, 2)
+	require.Len(t, evs, 2)
+	require.Equal(t, events.PayoutDone, evs[1].Type)
+	require.Equal(t, dn.Deposit.ID(), evs[1].DepositID)
+	require.Equal(t, txid, evs[1].Txid)
+	require.Equal(t, mdlSent, evs[1].MDLSent)
+	require.Equal(t, StatusDone.String(), evs[1].Status)
+
+	closeMultiplexer(e)
+}
+
+func TestExchangePublishEventsContactEmail(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+
+	e := newTestExchange(t, log, db)
+	publisher := &mockPublisher{}
+	err := e.SetPublisher(publisher)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, e.Run())
+	}()
+	defer func() {
+		shutdownDB()
+		<-done
+	}()
+	defer e.Shutdown()
+
+	mdlAddr := testMDLAddr
+
+	// Bound with an email, without an email, and with an email that opted out
+	_, err = e.BindAddress(context.Background(), mdlAddr, "btc-addr-email", scanner.CoinTypeBTC, BindOptions{ContactEmail: "user@example.com"})
+	require.NoError(t, err)
+	_, err = e.BindAddress(context.Background(), mdlAddr, "btc-addr-no-email", scanner.CoinTypeBTC, BindOptions{})
+	require.NoError(t, err)
+	_, err = e.BindAddress(context.Background(), mdlAddr, "btc-addr-opted-out", scanner.CoinTypeBTC, BindOptions{ContactEmail: "Other@example.com"})
+	require.NoError(t, err)
+
+	err = e.OptOutContactEmail("other@EXAMPLE.com")
+	require.NoError(t, err)
+
+	mp := e.Receiver.(*Receive).multiplexer
+	sender := e.Sender.(*Send).sender.(*dummySender)
+
+	var value int64 = 1e8
+	contactEmails := make(map[string]string)
+	for i, tc := range []struct {
+		btcAddr      string
+		contactEmail string
+	}{
+		{"btc-addr-email", "user@example.com"},
+		{"btc-addr-no-email", ""},
+		{"btc-addr-opted-out", ""},
+	} {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  tc.btcAddr,
+				Value:    value,
+				Height:   20,
+				Tx:       fmt.Sprintf("foo-tx-%d", i),
+				N:        2,
+			},
+			ErrC: make(chan error, 1),
+		}
+		mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+		err = <-dn.ErrC
+		require.NoError(t, err)
+
+		contactEmails[dn.Deposit.ID()] = tc.contactEmail
+
+		// Wait for the payout to be broadcast, then confirm it
+		var di DepositInfo
+		for start := time.Now(); time.Since(start) < dbScanTimeout; time.Sleep(statusCheckInterval) {
+			di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			require.NoError(t, err)
+			if di.Status == StatusWaitConfirm {
+				break
+			}
+		}
+		require.Equal(t, StatusWaitConfirm, di.Status)
+		require.Equal(t, tc.btcAddr != "btc-addr-no-email", di.ContactEmail != "")
+
+		sender.setTxConfirmed(di.Txid)
+	}
+
+	// 3 DepositRecorded and 3 PayoutDone events
+	evs := waitForEvents(t, publisher, 6)
+
+	var payouts int
+	for _, ev := range evs {
+		if ev.Type != events.PayoutDone {
+			continue
+		}
+
+		payouts++
+		expected, ok := contactEmails[ev.DepositID]
+		require.True(t, ok)
+		require.Equal(t, expected, ev.ContactEmail, ev.DepositID)
+	}
+	require.Equal(t, 3, payouts)
+
+	closeMultiplexer(e)
+}
+
+func TestExchangePublishFailureDoesNotBlock(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+
+	e := newTestExchange(t, log, db)
+	err := e.SetPublisher(&mockPublisher{
+		err: errors.New("broker unavailable"),
+	})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, e.Run())
+	}()
+	defer func() {
+		shutdownDB()
+		<-done
+	}()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        2,
+		},
+		ErrC: make(chan error, 1),
+	}
+	mp := e.Receiver.(*Receive).multiplexer
+	mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+	// The deposit is still saved when publishing fails
+	err = <-dn.ErrC
+	require.NoError(t, err)
+
+	closeMultiplexer(e)
+}
+
+func TestExchangeMaxDepositsPerBinding(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	e.Receiver.(*Receive).cfg.MaxDepositsPerBinding = 2
+	go run()
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	var dns []scanner.DepositNote
+	for i := 0; i < 3; i++ {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  btcAddr,
+				Value:    1e8,
+				Height:   20,
+				Tx:       "foo-tx",
+				N:        uint32(i),
+			},
+			ErrC: make(chan error, 1),
+		}
+		mp := e.Receiver.(*Receive).multiplexer
+		mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+		// Deposits held for review are still recorded
+		err := <-dn.ErrC
+		require.NoError(t, err)
+
+		dns = append(dns, dn)
+	}
+
+	// The first 2 deposits are sent
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range time.Tick(dbCheckWaitTime) {
+			sent := 0
+			for _, dn := range dns[:2] {
+				di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+				require.NoError(t, err)
+				if di.Status == StatusWaitConfirm {
+					sent++
+				}
+			}
+
+			if sent == 2 {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(dbScanTimeout):
+		t.Fatal("Waiting for sent deposits timed out")
+	}
+
+	for _, dn := range dns[:2] {
+		di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+		require.Empty(t, di.Error)
+		require.Equal(t, uint64(100e6), di.MDLSent)
+	}
+
+	// The 3rd deposit is held for review, nothing is sent for it
+	di, err := e.store.(*Store).getDepositInfo(dns[2].Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitReview, di.Status)
+	require.Equal(t, ErrMaxDepositsPerBinding.Error(), di.Error)
+	require.Empty(t, di.Txid)
+	require.Empty(t, di.MDLSent)
+
+	dss, err := e.GetDepositStatuses(testMDLAddr)
+	require.NoError(t, err)
+	require.Len(t, dss, 3)
+	require.Equal(t, StatusWaitReview.String(), dss[2].Status)
+
+	closeMultiplexer(e)
+}
+
+func TestGetDepositRate(t *testing.T) {
+	cfg := defaultCfg
+	cfg.MDLBtcExchangeRateTiers = []config.RateTier{
+		{MinAmount: "1", Rate: "110"},
+		{MinAmount: "10", Rate: "125"},
+	}
+	cfg.MDLEthExchangeRateTiers = []config.RateTier{
+		{MinAmount: "0.5", Rate: "12"},
+	}
+
+	tt := []struct {
+		name     string
+		coinType string
+		value    int64
+		rate     string
+	}{
+		{
+			name:     "btc below the first tier",
+			coinType: scanner.CoinTypeBTC,
+			value:    1e8 - 1,
+			rate:     testMDLBtcRate,
+		},
+		{
+			name:     "btc at the first tier",
+			coinType: scanner.CoinTypeBTC,
+			value:    1e8,
+			rate:     "110",
+		},
+		{
+			name:     "btc between the tiers",
+			coinType: scanner.CoinTypeBTC,
+			value:    5e8,
+			rate:     "110",
+		},
+		{
+			name:     "btc just below the second tier",
+			coinType: scanner.CoinTypeBTC,
+			value:    10e8 - 1,
+			rate:     "110",
+		},
+		{
+			name:     "btc at the second tier",
+			coinType: scanner.CoinTypeBTC,
+			value:    10e8,
+			rate:     "125",
+		},
+		{
+			name:     "btc above the last tier",
+			coinType: scanner.CoinTypeBTC,
+			value:    1000e8,
+			rate:     "125",
+		},
+		{
+			name:     "eth below its tier, in gwei",
+			coinType: scanner.CoinTypeETH,
+			value:    5e8 - 1,
+			rate:     testMDLEthRate,
+		},
+		{
+			name:     "eth at its tier, in gwei",
+			coinType: scanner.CoinTypeETH,
+			value:    5e8,
+			rate:     "12",
+		},
+		{
+			name:     "sky has no tiers",
+			coinType: scanner.CoinTypeSKY,
+			value:    1000e6,
+			rate:     testMDLSkyRate,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, err := getDepositRate(cfg, tc.coinType, tc.value)
+			require.NoError(t, err)
+			require.Equal(t, tc.rate, rate)
+		})
+	}
+
+	_, err := getDepositRate(cfg, "foo", 1)
+	require.Equal(t, scanner.ErrUnsupportedCoinType, err)
+}
+
+func TestExchangeRateTiers(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	e.Receiver.(*Receive).cfg.MDLBtcExchangeRateTiers = []config.RateTier{
+		{MinAmount: "2", Rate: "150"},
+	}
+
+	go run()
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	addDeposit := func(value int64, n uint32) DepositInfo {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  btcAddr,
+				Value:    value,
+				Height:   20,
+				Tx:       "foo-tx",
+				N:        n,
+			},
+			ErrC: make(chan error, 1),
+		}
+		mp := e.Receiver.(*Receive).multiplexer
+		mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+		err := <-dn.ErrC
+		require.NoError(t, err)
+
+		di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+		return di
+	}
+
+	// The deposit's tier rate is recorded with it, and used to calculate the MDL sent
+	di := addDeposit(1e8, 0)
+	require.Equal(t, testMDLBtcRate, di.ConversionRate)
+	amt, err := CalculateDepositMDLValue(di.CoinType, di.DepositValue, di.ConversionRate, testMaxDecimals)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), amt)
+
+	di = addDeposit(2e8, 1)
+	require.Equal(t, "150", di.ConversionRate)
+	amt, err = CalculateDepositMDLValue(di.CoinType, di.DepositValue, di.ConversionRate, testMaxDecimals)
+	require.NoError(t, err)
+	require.Equal(t, uint64(300e6), amt)
+}
+
+func TestExchangeSpread(t *testing.T) {
+	tt := []struct {
+		name   string
+		spread string
+		rate   string
+		mdl    uint64
+	}{
+		{"no spread", "", testMDLBtcRate, 100e6},
+		{"zero spread matches the base rate", "0", testMDLBtcRate, 100e6},
+		{"2 percent spread", "2", "98", 98e6},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+			e, run, shutdown := setupExchange(t, log)
+			e.Receiver.(*Receive).cfg.MDLBtcSpread = tc.spread
+
+			go run()
+			defer shutdown()
+			defer e.Shutdown()
+
+			btcAddr := "foo-btc-addr"
+			mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+			dn := scanner.DepositNote{
+				Deposit: scanner.Deposit{
+					CoinType: scanner.CoinTypeBTC,
+					Address:  btcAddr,
+					Value:    1e8,
+					Height:   20,
+					Tx:       "foo-tx",
+					N:        0,
+				},
+				ErrC: make(chan error, 1),
+			}
+			mp := e.Receiver.(*Receive).multiplexer
+			mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+			err := <-dn.ErrC
+			require.NoError(t, err)
+
+			// The rate with the spread taken off is recorded with the deposit, and used to calculate the MDL sent
+			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			require.NoError(t, err)
+			require.Equal(t, tc.rate, di.ConversionRate)
+
+			amt, err := CalculateDepositMDLValue(di.CoinType, di.DepositValue, di.ConversionRate, testMaxDecimals)
+			require.NoError(t, err)
+			require.Equal(t, tc.mdl, amt)
+		})
+	}
+}
+
+func TestExchangeDeductNetworkFee(t *testing.T) {
+	tt := []struct {
+		name  string
+		value int64
+		gross uint64
+		net   uint64
+	}{
+		{
+			name:  "fee deducted",
+			value: 1e8,
+			gross: 100e6,
+			net:   98e6,
+		},
+		{
+			name:  "fee consumes the payout",
+			value: 1e6,
+			gross: 1e6,
+			net:   0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+			e, run, shutdown := setupExchange(t, log)
+			e.Sender.(*Send).cfg.DeductNetworkFee = true
+			e.Sender.(*Send).cfg.NetworkFee = "2"
+
+			go run()
+			defer shutdown()
+			defer e.Shutdown()
+
+			btcAddr := "foo-btc-addr"
+			mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+			dn := scanner.DepositNote{
+				Deposit: scanner.Deposit{
+					CoinType: scanner.CoinTypeBTC,
+					Address:  btcAddr,
+					Value:    tc.value,
+					Height:   20,
+					Tx:       "foo-tx",
+					N:        0,
+				},
+				ErrC: make(chan error, 1),
+			}
+			mp := e.Receiver.(*Receive).multiplexer
+			mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+			err := <-dn.ErrC
+			require.NoError(t, err)
+
+			waitForStatus := func(status Status) DepositInfo {
+				timeout := time.After(dbScanTimeout)
+				for {
+					di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+					require.NoError(t, err)
+					if di.Status == status {
+						return di
+					}
+
+					select {
+					case <-timeout:
+						t.Fatalf("Waiting for deposit status %s timed out, have %s", status, di.Status)
+					case <-time.After(statusCheckInterval):
+					}
+				}
+			}
+
+			if tc.net != 0 {
+				di := waitForStatus(StatusWaitConfirm)
+				require.Equal(t, tc.net, di.MDLSent)
+				e.Sender.(*Send).sender.(*dummySender).setTxConfirmed(di.Txid)
+			}
+
+			// The gross and net MDL values are recorded on the deposit
+			di := waitForStatus(StatusDone)
+			require.Equal(t, tc.gross, di.MDLGross)
+			require.Equal(t, tc.net, di.MDLNet)
+			require.Equal(t, tc.net, di.MDLSent)
+
+			if tc.net == 0 {
+				require.Empty(t, di.Txid)
+				require.Equal(t, ErrEmptySendAmount.Error(), di.Error)
+			}
+
+			closeMultiplexer(e)
+		})
+	}
+}
+
+func TestExchangeMaxOutstanding(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	e.Receiver.(*Receive).cfg.MaxOutstanding = "250"
+
+	// Paused sends keep the deposits owed until they are resumed
+	err := e.store.SetSendsPaused(true)
+	require.NoError(t, err)
+
+	go run()
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	// Each deposit is worth 100 MDL
+	addDeposit := func(tx string, n uint32) scanner.DepositNote {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  btcAddr,
+				Value:    1e8,
+				Height:   20,
+				Tx:       tx,
+				N:        n,
+			},
+			ErrC: make(chan error, 1),
+		}
+		mp := e.Receiver.(*Receive).multiplexer
+		mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+		// Deposits held for review are still recorded
+		err := <-dn.ErrC
+		require.NoError(t, err)
+
+		return dn
+	}
+
+	var dns []scanner.DepositNote
+	for i := 0; i < 3; i++ {
+		dns = append(dns, addDeposit("foo-tx", uint32(i)))
+	}
+
+	// The first 2 deposits are owed, the 3rd would raise the MDL owed to 300 and is held for review
+	for _, dn := range dns[:2] {
+		di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+		require.NotEqual(t, StatusWaitReview, di.Status)
+		require.Empty(t, di.Error)
+	}
+
+	di, err := e.store.(*Store).getDepositInfo(dns[2].Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitReview, di.Status)
+	require.Equal(t, ErrMaxOutstanding.Error(), di.Error)
+
+	// Once the owed deposits are paid, new deposits are accepted again
+	err = e.SetSendsPaused(false)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range time.Tick(dbCheckWaitTime) {
+			sent := 0
+			for _, dn := range dns[:2] {
+				di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+				require.NoError(t, err)
+				if di.Status == StatusWaitConfirm {
+					sent++
+				}
+			}
+
+			if sent == 2 {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(dbScanTimeout):
+		t.Fatal("Waiting for sent deposits timed out")
+	}
+
+	dn := addDeposit("bar-tx", 0)
+	di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.NotEqual(t, StatusWaitReview, di.Status)
+	require.Empty(t, di.Error)
+
+	// The held deposit stays held
+	di, err = e.store.(*Store).getDepositInfo(dns[2].Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitReview, di.Status)
+
+	closeMultiplexer(e)
+}
+
+func TestExchangeMaxOutstandingNetworkFee(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	e.Receiver.(*Receive).cfg.MaxOutstanding = "250"
+	e.Receiver.(*Receive).cfg.DeductNetworkFee = true
+	e.Receiver.(*Receive).cfg.NetworkFee = "20"
+
+	err := e.store.SetSendsPaused(true)
+	require.NoError(t, err)
+
+	go run()
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	// Each deposit is worth 100 MDL, of which 80 MDL are owed after the network fee.
+	// The 3 deposits owe 240 MDL, below the max outstanding, although they are worth 300 MDL
+	for i := 0; i < 3; i++ {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  btcAddr,
+				Value:    1e8,
+				Height:   20,
+				Tx:       "foo-tx",
+				N:        uint32(i),
+			},
+			ErrC: make(chan error, 1),
+		}
+		e.Receiver.(*Receive).multiplexer.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+		require.NoError(t, <-dn.ErrC)
+
+		di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+		require.NotEqual(t, StatusWaitReview, di.Status)
+		require.Empty(t, di.Error)
+	}
+
+	closeMultiplexer(e)
+}
+
+func TestExchangeExpectedAmount(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	e.Receiver.(*Receive).cfg.ExpectedAmountTolerance = "1%"
+
+	// Paused sends keep the deposits that are not held in their initial status
+	err := e.store.SetSendsPaused(true)
+	require.NoError(t, err)
+
+	go run()
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	boundAddr, err := e.store.BindAddress(context.Background(), testMDLAddr, btcAddr, scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{ExpectedAmount: "1"})
+	require.NoError(t, err)
+	require.Equal(t, "1", boundAddr.ExpectedAmount)
+
+	addDeposit := func(value int64, n uint32) DepositInfo {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  btcAddr,
+				Value:    value,
+				Height:   20,
+				Tx:       "foo-tx",
+				N:        n,
+			},
+			ErrC: make(chan error, 1),
+		}
+		mp := e.Receiver.(*Receive).multiplexer
+		mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+		// Deposits held for review are still recorded
+		err := <-dn.ErrC
+		require.NoError(t, err)
+
+		di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+		require.Equal(t, "1", di.ExpectedAmount)
+		return di
+	}
+
+	// An exact match is processed
+	di := addDeposit(1e8, 0)
+	require.NotEqual(t, StatusWaitReview, di.Status)
+	require.Empty(t, di.Error)
+
+	// A deposit within the tolerance is processed
+	di = addDeposit(995e5, 1)
+	require.NotEqual(t, StatusWaitReview, di.Status)
+	require.Empty(t, di.Error)
+
+	di = addDeposit(101e6, 2)
+	require.NotEqual(t, StatusWaitReview, di.Status)
+	require.Empty(t, di.Error)
+
+	// A deposit out of the tolerance is held for review
+	di = addDeposit(98e6, 3)
+	require.Equal(t, StatusWaitReview, di.Status)
+	require.Equal(t, ErrExpectedAmountMismatch.Error(), di.Error)
+
+	di = addDeposit(2e8, 4)
+	require.Equal(t, StatusWaitReview, di.Status)
+	require.Equal(t, ErrExpectedAmountMismatch.Error(), di.Error)
+
+	// The expected amount is returned with the deposit statuses
+	dss, err := e.GetDepositStatuses(testMDLAddr)
+	require.NoError(t, err)
+	require.Len(t, dss, 5)
+	for _, ds := range dss {
+		require.Equal(t, "1", ds.ExpectedAmount)
+	}
+}
+
+func TestExchangeDummyScannerTestDeposit(t *testing.T) {
+	db, shutdownDB := testutil.PrepareDB(t)
+	defer shutdownDB()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	dummyScanner := scanner.NewDummyScanner(log)
+	dummyScanner.RegisterCoinType(scanner.CoinTypeBTC)
+
+	multiplexer := scanner.NewMultiplexer(log)
+	err = multiplexer.AddScanner(dummyScanner, scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	go testutil.CheckError(t, multiplexer.Multiplex)
+	defer multiplexer.Shutdown()
+
+	e, err := NewDirectExchange(log, defaultCfg, store, multiplexer, newDummySender())
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := e.Run()
+		require.NoError(t, err)
+	}()
+	defer func() {
+		e.Shutdown()
+		<-done
+	}()
+
+	mdlAddr := testMDLAddr
+	btcAddr := "foo-btc-addr"
+	_, err = e.BindAddress(context.Background(), mdlAddr, btcAddr, scanner.CoinTypeBTC, BindOptions{})
+	require.NoError(t, err)
+
+	dummyScanner.EnableTestDeposits("secret", e.GetDepositAddress)
+	mux := http.NewServeMux()
+	dummyScanner.BindHandlers(mux)
+
+	testDeposit := func(token string, v url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/dummy/scanner/test-deposit", strings.NewReader(v.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	v := url.Values{}
+	v.Set("mdladdr", mdlAddr)
+	v.Set("coin", scanner.CoinTypeBTC)
+	v.Set("amount", "0.5")
+
+	// Missing or wrong token
+	rr := testDeposit("", v)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = testDeposit("wrong", v)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// No address of the coin type bound
+	v.Set("mdladdr", testMDLAddr2)
+	rr = testDeposit("secret", v)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+	v.Set("mdladdr", mdlAddr)
+
+	// Amount finer than a satoshi
+	v.Set("amount", "0.000000001")
+	rr = testDeposit("secret", v)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	v.Set("amount", "0.5")
+
+	var value int64 = 5e7
+	mdlSent, err := CalculateBtcMDLValue(value, testMDLBtcRate, testMaxDecimals)
+	require.NoError(t, err)
+	txid := e.Sender.(*Send).sender.(*dummySender).predictTxid(t, mdlAddr, mdlSent)
+
+	rr = testDeposit("secret", v)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var rsp scanner.TestDepositResponse
+	err = json.NewDecoder(rr.Body).Decode(&rsp)
+	require.NoError(t, err)
+	require.Equal(t, btcAddr, rsp.DepositAddress)
+	require.Equal(t, scanner.CoinTypeBTC, rsp.CoinType)
+	require.Equal(t, value, rsp.Value)
+	require.NotEmpty(t, rsp.Tx)
+
+	depositID := scanner.Deposit{Tx: rsp.Tx, N: rsp.N}.ID()
+
+	// The deposit is sent through the dummy sender
+	var di DepositInfo
+	checkDone := make(chan struct{})
+	go func() {
+		defer close(checkDone)
+		for range time.Tick(dbCheckWaitTime) {
+			var err error
+			di, err = e.store.(*Store).getDepositInfo(depositID)
+			require.NoError(t, err)
+
+			if di.Status == StatusWaitConfirm || di.Status == StatusDone {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-checkDone:
+	case <-time.After(dbScanTimeout):
+		t.Fatal("Waiting for sent deposit timed out")
+	}
+
+	require.Equal(t, mdlAddr, di.MDLAddress)
+	require.Equal(t, btcAddr, di.DepositAddress)
+	require.Equal(t, value, di.DepositValue)
+	require.Equal(t, mdlSent, di.MDLSent)
+	require.Equal(t, txid, di.Txid)
+}
+
+func TestExchangeSendsPaused(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+
+	// Sends were paused before a restart
+	err := e.store.SetSendsPaused(true)
+	require.NoError(t, err)
+
+	go run()
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	var dns []scanner.DepositNote
+	for i := 0; i < 2; i++ {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  btcAddr,
+				Value:    1e8,
+				Height:   20,
+				Tx:       "foo-tx",
+				N:        uint32(i),
+			},
+			ErrC: make(chan error, 1),
+		}
+		mp := e.Receiver.(*Receive).multiplexer
+		mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+		err := <-dn.ErrC
+		require.NoError(t, err)
+
+		dns = append(dns, dn)
+	}
+
+	// waitForStatus waits until both deposits have the status
+	waitForStatus := func(status Status) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for range time.Tick(dbCheckWaitTime) {
+				n := 0
+				for _, dn := range dns {
+					di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+					require.NoError(t, err)
+					if di.Status == status {
+						n++
+					}
+				}
+
+				if n == len(dns) {
+					return
+				}
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(dbScanTimeout):
+			t.Fatalf("Waiting for deposits with status %s timed out", status)
+		}
+	}
+
+	// The confirmed deposits are queued, nothing is sent
+	waitForStatus(StatusWaitSend)
+	require.True(t, e.SendsPaused())
+
+	time.Sleep(dbCheckWaitTime * 2)
+	for _, dn := range dns {
+		di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+		require.NoError(t, err)
+		require.Equal(t, StatusWaitSend, di.Status)
+		require.Empty(t, di.Txid)
+	}
+
+	// Resuming sends the queued deposits.
+	// Both deposits are sent in identical transactions, confirm it in advance
+	txid := e.Sender.(*Send).sender.(*dummySender).predictTxid(t, testMDLAddr, 100e6)
+	e.Sender.(*Send).sender.(*dummySender).setTxConfirmed(txid)
+
+	err = e.SetSendsPaused(false)
+	require.NoError(t, err)
+	require.False(t, e.SendsPaused())
+
+	paused, err := e.store.GetSendsPaused()
+	require.NoError(t, err)
+	require.False(t, paused)
+
+	waitForStatus(StatusDone)
+
+	// Pausing again stops new sends
+	err = e.SetSendsPaused(true)
+	require.NoError(t, err)
+
+	paused, err = e.store.GetSendsPaused()
+	require.NoError(t, err)
+	require.True(t, paused)
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   21,
+			Tx:       "bar-tx",
+			N:        0,
+		},
+		ErrC: make(chan error, 1),
+	}
+	mp := e.Receiver.(*Receive).multiplexer
+	mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+	err = <-dn.ErrC
+	require.NoError(t, err)
+
+	time.Sleep(dbCheckWaitTime * 2)
+	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	closeMultiplexer(e)
+}
+
+func TestExchangeSendsPausedConfirm(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	e.cfg.StaleDepositThreshold = time.Hour
+	e.cfg.StaleDepositCheckInterval = time.Hour
+	go run()
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	addDeposit := func(n uint32) scanner.DepositNote {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  btcAddr,
+				Value:    1e8,
+				Height:   20,
+				Tx:       "foo-tx",
+				N:        n,
+			},
+			ErrC: make(chan error, 1),
+		}
+		mp := e.Receiver.(*Receive).multiplexer
+		mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+		err := <-dn.ErrC
+		require.NoError(t, err)
+
+		return dn
+	}
+
+	// waitForStatus waits until the deposit has the status
+	waitForStatus := func(dn scanner.DepositNote, status Status) DepositInfo {
+		timeout := time.After(dbScanTimeout)
+		for {
+			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			require.NoError(t, err)
+			if di.Status == status {
+				return di
+			}
+
+			select {
+			case <-timeout:
+				t.Fatalf("Waiting for deposit with status %s timed out, status is %s", status, di.Status)
+			case <-time.After(dbCheckWaitTime):
+			}
+		}
+	}
+
+	// Force sender to return a confirm error so that the first deposit is left at StatusWaitConfirm
+	e.Sender.(*Send).sender.(*dummySender).confirmErr = errors.New("fake confirm error")
+
+	sent := addDeposit(0)
+	sentDi := waitForStatus(sent, StatusWaitConfirm)
+
+	// While sends are paused, the next deposit is held at StatusWaitSend
+	err := e.SetSendsPaused(true)
+	require.NoError(t, err)
+
+	held := addDeposit(1)
+	waitForStatus(held, StatusWaitSend)
+
+	// Wait until only the held deposit is queued, so that only the first deposit is re-driven below
+	send := e.Sender.(*Send)
+	timeout := time.After(dbScanTimeout)
+	for {
+		send.queuedLock.Lock()
+		_, sentQueued := send.queued[sent.Deposit.ID()]
+		_, heldQueued := send.queued[held.Deposit.ID()]
+		send.queuedLock.Unlock()
+		if !sentQueued && heldQueued {
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("Waiting for the held deposit to be queued timed out")
+		case <-time.After(dbCheckWaitTime):
+		}
+	}
+
+	// The transaction that was already broadcast is still confirmed while sends are paused
+	send.sender.(*dummySender).confirmErr = nil
+	send.sender.(*dummySender).setTxConfirmed(sentDi.Txid)
+
+	redriven, err := e.reconcileStaleDeposits(time.Now().Add(time.Hour * 2))
+	require.NoError(t, err)
+	require.Len(t, redriven, 1)
+	require.Equal(t, sent.Deposit.ID(), redriven[0].DepositID)
+
+	waitForStatus(sent, StatusDone)
+
+	di, err := e.store.(*Store).getDepositInfo(held.Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.Empty(t, di.Txid)
 
-	expectedDeposit = DepositInfo{
-		Seq:            1,
-		CoinType:       scanner.CoinTypeBTC,
-		UpdatedAt:      di.UpdatedAt,
-		Status:         StatusDone,
-		MDLAddress:     mdlAddr,
-		DepositAddress: dn.Deposit.Address,
-		DepositID:      dn.Deposit.ID(),
-		Txid:           txid,
-		MDLSent:        100e6,
-		BuyMethod:      config.BuyMethodDirect,
-		ConversionRate: testMDLBtcRate,
-		DepositValue:   dn.Deposit.Value,
-		Deposit:        dn.Deposit,
-	}
+	// Resuming sends the held deposit, in a transaction identical to the confirmed one
+	err = e.SetSendsPaused(false)
+	require.NoError(t, err)
 
-	require.Equal(t, expectedDeposit, di)
-	closeMultiplexer(e)
+	di = waitForStatus(held, StatusDone)
+	require.Equal(t, sentDi.Txid, di.Txid)
+	require.Equal(t, uint64(100e6), di.MDLSent)
 }
 
 func TestExchangeSkyRunSend(t *testing.T) {
@@ -544,6 +1806,8 @@ func TestExchangeSkyRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeSKY,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		Status:         StatusWaitConfirm,
 		MDLAddress:     mdlAddr,
 		DepositAddress: dn.Deposit.Address,
@@ -593,6 +1857,8 @@ func TestExchangeSkyRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeSKY,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		Status:         StatusDone,
 		MDLAddress:     mdlAddr,
 		DepositAddress: dn.Deposit.Address,
@@ -676,6 +1942,8 @@ func TestExchangeWavesRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeWAVES,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		Status:         StatusWaitConfirm,
 		MDLAddress:     mdlAddr,
 		DepositAddress: dn.Deposit.Address,
@@ -725,6 +1993,8 @@ func TestExchangeWavesRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeWAVES,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		Status:         StatusDone,
 		MDLAddress:     mdlAddr,
 		DepositAddress: dn.Deposit.Address,
@@ -808,6 +2078,8 @@ func TestExchangeWavesMDLRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeWAVESMDL,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		Status:         StatusWaitConfirm,
 		MDLAddress:     mdlAddr,
 		DepositAddress: dn.Deposit.Address,
@@ -857,6 +2129,8 @@ func TestExchangeWavesMDLRunSend(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeWAVESMDL,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		Status:         StatusDone,
 		MDLAddress:     mdlAddr,
 		DepositAddress: dn.Deposit.Address,
@@ -922,6 +2196,8 @@ func TestExchangeUpdateBroadcastTxFailure(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		MDLAddress:     mdlAddr,
 		DepositAddress: btcAddr,
 		DepositID:      dn.Deposit.ID(),
@@ -980,6 +2256,8 @@ func TestExchangeCreateTxFailure(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		MDLAddress:     mdlAddr,
 		DepositAddress: btcAddr,
 		DepositID:      dn.Deposit.ID(),
@@ -1061,6 +2339,8 @@ func TestExchangeTxConfirmFailure(t *testing.T) {
 		Seq:            1,
 		CoinType:       scanner.CoinTypeBTC,
 		UpdatedAt:      di.UpdatedAt,
+		Timestamps:     di.Timestamps,
+		Version:        di.Version,
 		MDLAddress:     mdlAddr,
 		DepositAddress: btcAddr,
 		DepositID:      dn.Deposit.ID(),
@@ -1140,6 +2420,8 @@ func TestExchangeQuitBeforeConfirm(t *testing.T) {
 
 			ed := expectedDeposit
 			ed.UpdatedAt = di.UpdatedAt
+			ed.Timestamps = di.Timestamps
+			ed.Version = di.Version
 
 			require.Equal(t, ed, di)
 			return
@@ -1160,6 +2442,8 @@ func TestExchangeQuitBeforeConfirm(t *testing.T) {
 	require.NotEmpty(t, di.UpdatedAt)
 	ed := expectedDeposit
 	ed.UpdatedAt = di.UpdatedAt
+	ed.Timestamps = di.Timestamps
+	ed.Version = di.Version
 
 	require.Equal(t, ed, di)
 }
@@ -1230,6 +2514,8 @@ func TestExchangeSendZeroCoins(t *testing.T) {
 
 			ed := expectedDeposit
 			ed.UpdatedAt = di.UpdatedAt
+			ed.Timestamps = di.Timestamps
+			ed.Version = di.Version
 
 			require.Equal(t, ed, di)
 			return
@@ -1250,6 +2536,8 @@ func TestExchangeSendZeroCoins(t *testing.T) {
 	require.NotEmpty(t, di.UpdatedAt)
 	ed := expectedDeposit
 	ed.UpdatedAt = di.UpdatedAt
+	ed.Timestamps = di.Timestamps
+	ed.Version = di.Version
 
 	require.Equal(t, ed, di)
 
@@ -1341,6 +2629,9 @@ func testExchangeRunProcessDepositBacklog(t *testing.T, dis []DepositInfo, confi
 
 		require.NotEmpty(t, confirmed[i].UpdatedAt)
 		expectedDis[i].UpdatedAt = confirmed[i].UpdatedAt
+		require.Equal(t, confirmed[i].UpdatedAt, confirmed[i].Timestamps.SendCompletedAt)
+		expectedDis[i].Timestamps = confirmed[i].Timestamps
+		expectedDis[i].Version = confirmed[i].Version
 
 		require.Equal(t, expectedDis[i], confirmed[i])
 	}
@@ -1464,7 +2755,7 @@ func TestExchangeProcessWaitSendDeposits(t *testing.T) {
 	}
 
 	testExchangeRunProcessDepositBacklog(t, dis, func(e *Exchange, di DepositInfo) {
-		boundAddr, err := e.store.BindAddress(di.MDLAddress, di.DepositAddress, di.CoinType, di.BuyMethod)
+		boundAddr, err := e.store.BindAddress(context.Background(), di.MDLAddress, di.DepositAddress, di.CoinType, di.BuyMethod, BindOptions{})
 		require.NoError(t, err)
 		require.Equal(t, di.MDLAddress, boundAddr.MDLAddress)
 		require.Equal(t, di.DepositAddress, boundAddr.Address)
@@ -1536,7 +2827,7 @@ func TestExchangeProcessWaitDecideDeposits(t *testing.T) {
 	}
 
 	testExchangeRunProcessDepositBacklog(t, dis, func(e *Exchange, di DepositInfo) {
-		boundAddr, err := e.store.BindAddress(di.MDLAddress, di.DepositAddress, di.CoinType, di.BuyMethod)
+		boundAddr, err := e.store.BindAddress(context.Background(), di.MDLAddress, di.DepositAddress, di.CoinType, di.BuyMethod, BindOptions{})
 		require.NoError(t, err)
 		require.Equal(t, di.MDLAddress, boundAddr.MDLAddress)
 		require.Equal(t, di.DepositAddress, boundAddr.Address)
@@ -1587,7 +2878,7 @@ func TestExchangeSaveIncomingDepositCreateDepositFailed(t *testing.T) {
 
 	// Return error on GetOrCreateDepositInfo
 	createDepositErr := errors.New("GetOrCreateDepositInfo failed")
-	e.store.(*MockStore).On("GetOrCreateDepositInfo", dn.Deposit, testMDLBtcRate).Return(DepositInfo{}, createDepositErr)
+	e.store.(*MockStore).On("GetOrCreateDepositInfo", dn.Deposit, testMDLBtcRate).Return(DepositInfo{}, false, createDepositErr)
 
 	// First loop calls saveIncomingDeposit
 	// err is written to ErrC after this method finishes
@@ -1652,7 +2943,7 @@ func TestExchangeProcessWaitSendDepositFailed(t *testing.T) {
 		ConversionRate: testMDLBtcRate,
 		Deposit:        dn.Deposit,
 	}
-	e.store.(*MockStore).On("GetOrCreateDepositInfo", dn.Deposit, testMDLBtcRate).Return(di, nil)
+	e.store.(*MockStore).On("GetOrCreateDepositInfo", dn.Deposit, testMDLBtcRate).Return(di, true, nil)
 
 	// UpdateDepositInfo fails
 	updateDepositInfoErr := errors.New("UpdateDepositInfo error")
@@ -1702,38 +2993,147 @@ func TestExchangeProcessWaitSendDepositFailed(t *testing.T) {
 }
 
 func TestExchangeProcessWaitSendNoMDLAddrBound(t *testing.T) {
-	// Tests that we log a message and continue if processWaitSendDeposit fails
-	e, shutdown, hook := runExchange(t)
+	// Tests that a deposit to an address that is not bound is quarantined, and not sent
+	e, shutdown, _ := runExchange(t)
 	defer shutdown()
 	defer e.Shutdown()
 
 	btcAddr := "foo-btc-addr"
+	boundBtcAddr := "foo-bound-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, boundBtcAddr)
 
-	dn := scanner.DepositNote{
-		Deposit: scanner.Deposit{
-			CoinType: scanner.CoinTypeBTC,
-			Address:  btcAddr,
-			Value:    1e8,
-			Height:   20,
-			Tx:       "foo-tx",
-			N:        2,
-		},
-		ErrC: make(chan error, 1),
+	addDeposit := func(addr string, n uint32) scanner.DepositNote {
+		dn := scanner.DepositNote{
+			Deposit: scanner.Deposit{
+				CoinType: scanner.CoinTypeBTC,
+				Address:  addr,
+				Value:    1e8,
+				Height:   20,
+				Tx:       "foo-tx",
+				N:        n,
+			},
+			ErrC: make(chan error, 1),
+		}
+		mp := e.Receiver.(*Receive).multiplexer
+		mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+		// The quarantined deposit is recorded, the scanner doesn't resend it
+		err := <-dn.ErrC
+		require.NoError(t, err)
+
+		return dn
 	}
-	mp := e.Receiver.(*Receive).multiplexer
-	mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
 
-	// First loop calls saveIncomingDeposit
-	// nil is written to ErrC after this method finishes
-	err := <-dn.ErrC
-	require.Error(t, err)
-	require.Equal(t, err, ErrNoBoundAddress)
+	dn := addDeposit(btcAddr, 2)
+	unboundDepositID := dn.Deposit.ID()
 
-	// Check that we logged the failed save, so that we can recover it later
-	logEntry := hook.LastEntry()
-	require.Equal(t, logEntry.Message, "saveIncomingDeposit failed. This deposit will not be reprocessed until teller is restarted.")
-	loggedDeposit := logEntry.Data["deposit"].(scanner.Deposit)
-	require.Equal(t, dn.Deposit, loggedDeposit)
+	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusUnbound, di.Status)
+	require.Empty(t, di.MDLAddress)
+	require.Equal(t, btcAddr, di.DepositAddress)
+	require.Equal(t, int64(1e8), di.DepositValue)
+	require.Equal(t, ErrNoBoundAddress.Error(), di.Error)
+	require.Equal(t, dn.Deposit, di.Deposit)
+
+	// A deposit to a bound address is processed
+	dn = addDeposit(boundBtcAddr, 3)
+
+	di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.NotEqual(t, StatusUnbound, di.Status)
+	require.Equal(t, testMDLAddr, di.MDLAddress)
+	require.Empty(t, di.Error)
+
+	// The quarantined deposit is not sent
+	time.Sleep(dbCheckWaitTime * 3)
+	di, err = e.store.(*Store).getDepositInfo(unboundDepositID)
+	require.NoError(t, err)
+	require.Equal(t, StatusUnbound, di.Status)
+	require.Equal(t, uint64(0), di.MDLSent)
+}
+
+func TestExchangeImportDeposit(t *testing.T) {
+	e, shutdown, _ := runExchange(t)
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	dv := scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  btcAddr,
+		Value:    1e8,
+		Height:   20,
+		Tx:       "foo-tx",
+		N:        0,
+	}
+
+	dupe := dv
+	dupe.N = 1
+
+	unbound := dv
+	unbound.Tx = "bar-tx"
+	unbound.Address = "foo-unbound-btc-addr"
+
+	btcScanner := e.Receiver.(*Receive).multiplexer.GetScanner(scanner.CoinTypeBTC).(*dummyScanner)
+	btcScanner.chain = []scanner.Deposit{dv, dupe, unbound}
+
+	// The deposit must be on the blockchain as described
+	forged := dv
+	forged.Value = 1e9
+	_, err := e.ImportDeposit(forged)
+	require.IsType(t, scanner.DepositMismatchError{}, err)
+
+	di, err := e.ImportDeposit(dv)
+	require.NoError(t, err)
+	require.True(t, di.Imported)
+	require.Equal(t, testMDLAddr, di.MDLAddress)
+	require.Equal(t, dv.ID(), di.DepositID)
+	require.Equal(t, dv, di.Deposit)
+
+	// The imported deposit is paid like a scanned deposit
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range time.Tick(dbCheckWaitTime) {
+			di, err := e.store.(*Store).getDepositInfo(dv.ID())
+			require.NoError(t, err)
+			if di.Status == StatusWaitConfirm {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(dbScanTimeout):
+		t.Fatal("Waiting for the imported deposit to be sent timed out")
+	}
+
+	stored, err := e.store.(*Store).getDepositInfo(dv.ID())
+	require.NoError(t, err)
+	require.True(t, stored.Imported)
+	require.Equal(t, uint64(100e6), stored.MDLSent)
+
+	// A deposit with the same txid is rejected, whatever its output index
+	_, err = e.ImportDeposit(dv)
+	require.Equal(t, ErrDepositExists, err)
+
+	_, err = e.ImportDeposit(dupe)
+	require.Equal(t, ErrDepositExists, err)
+
+	// The address must be bound
+	_, err = e.ImportDeposit(unbound)
+	require.Equal(t, ErrNoBoundAddress, err)
+
+	// The coin type must be canonical
+	badCoin := dv
+	badCoin.Tx = "baz-tx"
+	badCoin.CoinType = "btc"
+	_, err = e.ImportDeposit(badCoin)
+	require.Equal(t, scanner.ErrUnsupportedCoinType, err)
 }
 
 func TestExchangeBindAddress(t *testing.T) {
@@ -1753,7 +3153,7 @@ func TestExchangeBindAddress(t *testing.T) {
 
 	require.Len(t, dummyScanner.addrs, 0)
 
-	boundAddr, err := s.BindAddress("a", "b", scanner.CoinTypeBTC)
+	boundAddr, err := s.BindAddress(context.Background(), "a", "b", scanner.CoinTypeBTC, BindOptions{})
 	require.NoError(t, err)
 	require.Equal(t, "a", boundAddr.MDLAddress)
 	require.Equal(t, "b", boundAddr.Address)
@@ -1770,6 +3170,8 @@ func TestExchangeBindAddress(t *testing.T) {
 		Address:    "b",
 		CoinType:   scanner.CoinTypeBTC,
 		BuyMethod:  config.BuyMethodDirect,
+		CreatedAt:  boundAddr.CreatedAt,
+		Version:    boundAddr.Version,
 	}, mdlAddr)
 }
 
@@ -1830,6 +3232,48 @@ func TestExchangeCreateTransaction(t *testing.T) {
 	require.Equal(t, uint64(100e6), txOut.Coins)
 }
 
+func TestSendCalculatePayoutDroplets(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	s := &Send{
+		log: log,
+		cfg: config.MDLExchanger{
+			NetworkFee: "1.5",
+		},
+	}
+
+	di := DepositInfo{
+		CoinType:       scanner.CoinTypeBTC,
+		DepositValue:   1e8,
+		ConversionRate: "100",
+	}
+
+	// The network fee is not deducted unless deduct_network_fee is enabled
+	gross, net, err := s.calculatePayoutDroplets(di)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), gross)
+	require.Equal(t, uint64(100e6), net)
+
+	s.cfg.DeductNetworkFee = true
+
+	gross, net, err = s.calculatePayoutDroplets(di)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), gross)
+	require.Equal(t, uint64(98500000), net)
+
+	// The payout is floored at zero
+	di.DepositValue = 1e6
+	gross, net, err = s.calculatePayoutDroplets(di)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1e6), gross)
+	require.Equal(t, uint64(0), net)
+
+	// Nothing is sent for a deposit whose MDL value is consumed by the fee
+	di.MDLAddress = testMDLAddr
+	s.sender = newDummySender()
+	_, err = s.createTransaction(di)
+	require.Equal(t, ErrEmptySendAmount, err)
+}
+
 func TestExchangeGetDepositStatuses(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
@@ -1850,12 +3294,12 @@ func TestExchangeGetDepositStatuses(t *testing.T) {
 
 	require.Len(t, dummyScanner.addrs, 0)
 
-	boundAddr, err := s.BindAddress("a", "b", scanner.CoinTypeBTC)
+	boundAddr, err := s.BindAddress(context.Background(), "a", "b", scanner.CoinTypeBTC, BindOptions{})
 	require.NoError(t, err)
 	require.Equal(t, "a", boundAddr.MDLAddress)
 	require.Equal(t, "b", boundAddr.Address)
 
-	boundAddr, err = s.BindAddress("a", "e", scanner.CoinTypeETH)
+	boundAddr, err = s.BindAddress(context.Background(), "a", "e", scanner.CoinTypeETH, BindOptions{})
 	require.NoError(t, err)
 	require.Equal(t, "a", boundAddr.MDLAddress)
 	require.Equal(t, "e", boundAddr.Address)
@@ -1883,6 +3327,147 @@ func TestExchangeGetDepositStatuses(t *testing.T) {
 	require.NotEmpty(t, depositInfo.UpdatedAt)
 }
 
+func TestExchangeGetDepositStatusesReference(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	dummyScanner := newDummyScanner()
+	multiplexer := scanner.NewMultiplexer(log)
+	err = multiplexer.AddScanner(dummyScanner, scanner.CoinTypeBTC)
+	require.NoError(t, err)
+
+	s, err := NewDirectExchange(log, defaultCfg, store, multiplexer, nil)
+	require.NoError(t, err)
+
+	boundAddr, err := s.BindAddress(context.Background(), "a", "b", scanner.CoinTypeBTC, BindOptions{Reference: "order-1", Label: "acct-42"})
+	require.NoError(t, err)
+	require.Equal(t, "order-1", boundAddr.Reference)
+	require.Equal(t, "acct-42", boundAddr.Label)
+
+	boundAddr, err = s.BindAddress(context.Background(), "a", "c", scanner.CoinTypeBTC, BindOptions{})
+	require.NoError(t, err)
+	require.Empty(t, boundAddr.Reference)
+
+	// The reference is returned before any deposit is seen
+	dss, err := s.GetDepositStatuses("a")
+	require.NoError(t, err)
+	require.Len(t, dss, 2)
+	references := []string{dss[0].Reference, dss[1].Reference}
+	require.Contains(t, references, "order-1")
+	require.Contains(t, references, "")
+
+	// The reference is copied to the deposit
+	dv := scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "b",
+		Value:    1e8,
+		Height:   20,
+		Tx:       "foo-tx",
+		N:        2,
+	}
+	di, _, err := store.GetOrCreateDepositInfo(dv, testMDLBtcRate)
+	require.NoError(t, err)
+	require.Equal(t, "order-1", di.Reference)
+	require.Equal(t, "acct-42", di.Label)
+
+	dss, err = s.GetDepositStatuses("a")
+	require.NoError(t, err)
+	require.Len(t, dss, 2)
+
+	var found bool
+	for _, ds := range dss {
+		if ds.Status == StatusWaitDecide.String() {
+			require.Equal(t, "order-1", ds.Reference)
+			require.Equal(t, "acct-42", ds.Label)
+			found = true
+		} else {
+			require.Equal(t, StatusWaitDeposit.String(), ds.Status)
+			require.Empty(t, ds.Reference)
+		}
+	}
+	require.True(t, found)
+}
+
+func TestReadOnlyExchange(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	// Populate the db as a read-write teller would
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	mustBindAddress(t, store, "a", "b")
+	_, _, err = store.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "b",
+		Value:    1e8,
+		Height:   20,
+		Tx:       "foo-tx",
+		N:        2,
+	}, testMDLBtcRate)
+	require.NoError(t, err)
+
+	dbPath := db.Path()
+	err = db.Close()
+	require.NoError(t, err)
+
+	// Reopen the db read-only
+	db, err = bolt.Open(dbPath, 0700, &bolt.Options{
+		ReadOnly: true,
+	})
+	require.NoError(t, err)
+	defer testutil.CheckError(t, db.Close)
+
+	store, err = NewStore(log, db)
+	require.NoError(t, err)
+
+	e, err := NewReadOnlyExchange(log, defaultCfg, store)
+	require.NoError(t, err)
+	require.True(t, e.ReadOnly())
+
+	// No scanning, processing or sending components are created
+	require.Nil(t, e.Receiver)
+	require.Nil(t, e.Processor)
+	require.Nil(t, e.Sender)
+
+	// There is no Receiver or Sender to publish events
+	err = e.SetPublisher(&mockPublisher{})
+	require.Error(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := e.Run()
+		require.NoError(t, err)
+	}()
+
+	dss, err := e.GetDepositStatuses("a")
+	require.NoError(t, err)
+	require.Len(t, dss, 1)
+	require.Equal(t, StatusWaitDecide.String(), dss[0].Status)
+	require.Equal(t, scanner.CoinTypeBTC, dss[0].CoinType)
+
+	num, err := e.GetBindNum("a")
+	require.NoError(t, err)
+	require.Equal(t, 1, num)
+
+	_, err = e.BindAddress(context.Background(), "a", "c", scanner.CoinTypeBTC, BindOptions{})
+	require.Equal(t, ErrReadOnly, err)
+
+	err = e.Status()
+	require.Equal(t, ErrReadOnly, err)
+
+	_, err = e.Balance()
+	require.Equal(t, ErrReadOnly, err)
+
+	e.Shutdown()
+	<-done
+}
+
 func TestExchangeGetDepositStatusDetail(t *testing.T) {
 	// TODO
 }
@@ -1913,3 +3498,133 @@ func TestExchangeGetBindNum(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, num, 1)
 }
+
+func TestExchangeGetCoinBindNum(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	bscr := newDummyScanner()
+	multiplexer := scanner.NewMultiplexer(log)
+	err = multiplexer.AddScanner(bscr, scanner.CoinTypeBTC)
+	require.NoError(t, err)
+
+	s, err := NewDirectExchange(log, defaultCfg, store, multiplexer, nil)
+	require.NoError(t, err)
+
+	mustBindAddress(t, store, "a", "b1")
+	mustBindAddress(t, store, "a", "b2")
+	mustBindAddressSky(t, store, "a", "s1")
+
+	num, err := s.GetCoinBindNum("a", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, 2, num)
+
+	num, err = s.GetCoinBindNum("a", scanner.CoinTypeSKY)
+	require.NoError(t, err)
+	require.Equal(t, 1, num)
+
+	num, err = s.GetCoinBindNum("a", scanner.CoinTypeETH)
+	require.NoError(t, err)
+	require.Equal(t, 0, num)
+}
+
+func TestExchangeGetDepositAddress(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	bscr := newDummyScanner()
+	multiplexer := scanner.NewMultiplexer(log)
+	err = multiplexer.AddScanner(bscr, scanner.CoinTypeBTC)
+	require.NoError(t, err)
+
+	s, err := NewDirectExchange(log, defaultCfg, store, multiplexer, nil)
+	require.NoError(t, err)
+
+	_, err = s.GetDepositAddress("a", scanner.CoinTypeBTC)
+	require.Equal(t, ErrNoBoundAddress, err)
+
+	mustBindAddress(t, store, "a", "b1")
+	mustBindAddressSky(t, store, "a", "s1")
+
+	addr, err := s.GetDepositAddress("a", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, "b1", addr)
+
+	addr, err = s.GetDepositAddress("a", scanner.CoinTypeSKY)
+	require.NoError(t, err)
+	require.Equal(t, "s1", addr)
+
+	_, err = s.GetDepositAddress("a", scanner.CoinTypeETH)
+	require.Equal(t, ErrNoBoundAddress, err)
+}
+
+func TestCreatedTxHoursSpent(t *testing.T) {
+	tx := &api.CreateTransactionResponse{}
+	tx.Transaction.Fee = "50"
+	tx.Transaction.Out = []api.CreatedTransactionOutput{
+		{
+			Address: testMDLAddr,
+			Coins:   "1.000000",
+			Hours:   "5",
+		},
+		{
+			// The change output stays in the wallet
+			Address: "nYTKxHm6SZWAMdDVx6U9BqxKMuCjmSLp93",
+			Coins:   "111.000000",
+			Hours:   "45",
+		},
+	}
+
+	hours, err := createdTxHoursSpent(tx, testMDLAddr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(55), hours)
+
+	tx.Transaction.Out[0].Hours = "foo"
+	_, err = createdTxHoursSpent(tx, testMDLAddr)
+	require.Error(t, err)
+}
+
+func TestSendHoursReserve(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	ds := newDummySender()
+	s := &Send{
+		log:    log,
+		sender: ds,
+	}
+	tx := &TransactionInfo{
+		txId:  "foo-tx",
+		hours: 30,
+	}
+
+	// Disabled by default
+	ds.setHours(10)
+	require.NoError(t, s.checkHoursReserve(tx))
+
+	s.cfg.MinReservedHours = 50
+
+	tt := []struct {
+		hours uint64
+		err   error
+	}{
+		{100, nil},
+		{80, nil},
+		{79, ErrHoursReserve},
+		{30, ErrHoursReserve},
+		{10, ErrHoursReserve},
+	}
+
+	for _, tc := range tt {
+		t.Run(fmt.Sprint(tc.hours), func(t *testing.T) {
+			ds.setHours(tc.hours)
+			require.Equal(t, tc.err, s.checkHoursReserve(tx))
+		})
+	}
+}
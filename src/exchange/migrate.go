@@ -0,0 +1,79 @@
+package exchange
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/MDLlife/teller/src/util/dbutil"
+)
+
+// schemaComponent names the exchange buckets in dbutil.SchemaVersionsBkt
+const schemaComponent = "exchange"
+
+// migrations upgrade the exchange buckets of an older db, see dbutil.Migrate.
+// Append new migrations to the end, never reorder or remove them
+var migrations = []dbutil.Migration{
+	{
+		Name:    "backfill deposit binding fields",
+		Migrate: backfillDepositBindingFields,
+	},
+}
+
+// backfillDepositBindingFields copies BoundAddress.Reference and BoundAddress.CreatedAt
+// to the deposits recorded before DepositInfo.Reference and DepositInfo.Timestamps were added.
+// Migrations run before the Store knows if compression is enabled, so each record is saved compressed only if it was
+func backfillDepositBindingFields(tx *bolt.Tx) error {
+	var dis []DepositInfo
+	compressed := make(map[string]bool)
+	if err := dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
+		var di DepositInfo
+		if err := dbutil.UnmarshalValue(v, &di); err != nil {
+			return fmt.Errorf("decode deposit info %q failed: %v", k, err)
+		}
+
+		if di.Reference == "" || di.Timestamps.BoundAt == 0 {
+			dis = append(dis, di)
+			compressed[di.DepositID] = dbutil.IsCompressed(v)
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, di := range dis {
+		bindBkt, err := GetBindAddressBkt(di.CoinType)
+		if err != nil {
+			return err
+		}
+
+		var boundAddr BoundAddress
+		if err := dbutil.GetBucketObject(tx, bindBkt, di.DepositAddress, &boundAddr); err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				continue
+			default:
+				return err
+			}
+		}
+
+		if di.Reference == "" {
+			di.Reference = boundAddr.Reference
+		}
+		if di.Timestamps.BoundAt == 0 {
+			di.Timestamps.BoundAt = boundAddr.CreatedAt
+		}
+
+		if compressed[di.DepositID] {
+			err = dbutil.PutBucketCompressedValue(tx, DepositInfoBkt, di.DepositID, di)
+		} else {
+			err = dbutil.PutBucketValue(tx, DepositInfoBkt, di.DepositID, di)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package exchange
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/scanner"
+)
+
+// RateChange records the rate, rate tiers and spread configured for a coin type, and the ones they replaced
+type RateChange struct {
+	Rate           string            `json:"rate"`
+	Tiers          []config.RateTier `json:"tiers"`
+	Spread         string            `json:"spread"`
+	PreviousRate   string            `json:"previous_rate"` // Empty if no previous rate was recorded
+	PreviousTiers  []config.RateTier `json:"previous_tiers"`
+	PreviousSpread string            `json:"previous_spread"`
+	ChangedAt      int64             `json:"changed_at"` // Unix time the rate was first recorded, 0 if no previous rate was recorded
+}
+
+// phasingIn returns true if a deposit the scanner first saw at firstSeen, a unix time, gets the previous rate at now.
+// That is the case if it was seen before the rate changed and now is within phaseIn of the change
+func (rc RateChange) phasingIn(firstSeen int64, phaseIn time.Duration, now time.Time) bool {
+	if rc.PreviousRate == "" || firstSeen == 0 || firstSeen >= rc.ChangedAt {
+		return false
+	}
+
+	return now.Before(time.Unix(rc.ChangedAt, 0).Add(phaseIn))
+}
+
+// rateTiersEqual returns true if a and b have the same tiers, in the same order
+func rateTiersEqual(a, b []config.RateTier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// recordRates records the configured rates of the coin types with a rate set, see Store.RecordRate.
+// Returns the RateChange of each of them
+func recordRates(store Storer, cfg config.MDLExchanger, recordedAt int64) (map[string]RateChange, error) {
+	changes := make(map[string]RateChange)
+
+	for _, ct := range scanner.GetCoinTypes() {
+		rate, err := getRate(cfg, ct)
+		switch err {
+		case nil:
+		case ErrRateNotSet:
+			continue
+		default:
+			return nil, err
+		}
+
+		tiers, err := getRateTiers(cfg, ct)
+		if err != nil {
+			return nil, err
+		}
+
+		spread, err := getSpread(cfg, ct)
+		if err != nil {
+			return nil, err
+		}
+
+		rc, err := store.RecordRate(ct, rate, tiers, spread, recordedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		changes[ct] = rc
+	}
+
+	return changes, nil
+}
+
+// depositRate returns the conversion rate of a deposit at now, with the coin type's spread applied.
+// For mdl_exchanger.rate_phase_in after the rate of the deposit's coin type changed,
+// a deposit the scanner saw before the change gets the previous rate, with the previous spread applied
+func (r *Receive) depositRate(dv scanner.Deposit, now time.Time) (string, error) {
+	rc, ok := r.rateChanges[dv.CoinType]
+	if !ok || !rc.phasingIn(dv.FirstSeen, r.cfg.RatePhaseIn, now) {
+		rate, err := getDepositRate(r.cfg, dv.CoinType, dv.Value)
+		if err != nil {
+			return "", err
+		}
+
+		return applyCoinSpread(r.cfg, dv.CoinType, rate)
+	}
+
+	rate, err := getTieredRate(dv.CoinType, dv.Value, rc.PreviousRate, rc.PreviousTiers)
+	if err != nil {
+		return "", err
+	}
+
+	r.log.WithFields(logrus.Fields{
+		"deposit":        dv,
+		"previousRate":   rate,
+		"previousSpread": rc.PreviousSpread,
+		"rateChangedAt":  rc.ChangedAt,
+	}).Info("Deposit seen before the rate changed, using the previous rate")
+
+	return ApplySpread(rate, rc.PreviousSpread)
+}
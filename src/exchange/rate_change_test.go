@@ -0,0 +1,220 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+func TestStoreRecordRate(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	tiers := []config.RateTier{{MinAmount: "1", Rate: "110"}}
+
+	// The first record has no previous rate
+	rc, err := s.RecordRate(scanner.CoinTypeBTC, "100", tiers, "", 1000)
+	require.NoError(t, err)
+	require.Equal(t, RateChange{
+		Rate:  "100",
+		Tiers: tiers,
+	}, rc)
+
+	// Recording the same rate keeps the record
+	rc, err = s.RecordRate(scanner.CoinTypeBTC, "100", tiers, "", 2000)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), rc.ChangedAt)
+
+	// Changing the tiers changes the rate
+	rc, err = s.RecordRate(scanner.CoinTypeBTC, "100", nil, "", 3000)
+	require.NoError(t, err)
+	require.Equal(t, RateChange{
+		Rate:          "100",
+		PreviousRate:  "100",
+		PreviousTiers: tiers,
+		ChangedAt:     3000,
+	}, rc)
+
+	rc, err = s.RecordRate(scanner.CoinTypeBTC, "200", nil, "", 4000)
+	require.NoError(t, err)
+	require.Equal(t, "200", rc.Rate)
+	require.Equal(t, "100", rc.PreviousRate)
+	require.Empty(t, rc.PreviousTiers)
+	require.Equal(t, int64(4000), rc.ChangedAt)
+
+	// The rates of the coin types are recorded separately
+	rc, err = s.RecordRate(scanner.CoinTypeETH, "10", nil, "", 5000)
+	require.NoError(t, err)
+	require.Equal(t, RateChange{Rate: "10"}, rc)
+
+	rc, err = s.RecordRate(scanner.CoinTypeBTC, "200", nil, "", 6000)
+	require.NoError(t, err)
+	require.Equal(t, int64(4000), rc.ChangedAt)
+
+	// Changing the spread changes the rate
+	rc, err = s.RecordRate(scanner.CoinTypeBTC, "200", nil, "2", 7000)
+	require.NoError(t, err)
+	require.Equal(t, RateChange{
+		Rate:         "200",
+		Spread:       "2",
+		PreviousRate: "200",
+		ChangedAt:    7000,
+	}, rc)
+
+	rc, err = s.RecordRate(scanner.CoinTypeBTC, "200", nil, "3", 8000)
+	require.NoError(t, err)
+	require.Equal(t, "2", rc.PreviousSpread)
+	require.Equal(t, int64(8000), rc.ChangedAt)
+}
+
+func TestReceiveRatePhaseIn(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	store, shutdown := newTestStore(t)
+	defer shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, store, testMDLAddr, btcAddr)
+
+	cfg := defaultCfg
+	cfg.RatePhaseIn = time.Hour
+
+	newReceive := func(cfg config.MDLExchanger) *Receive {
+		r, err := NewReceive(log, cfg, store, scanner.NewMultiplexer(log))
+		require.NoError(t, err)
+		return r
+	}
+
+	dv := scanner.Deposit{
+		CoinType:  scanner.CoinTypeBTC,
+		Address:   btcAddr,
+		Value:     1e8,
+		Height:    20,
+		Tx:        "foo-tx",
+		FirstSeen: time.Now().Add(-time.Minute).Unix(),
+	}
+
+	// There is no previous rate on the first run
+	r := newReceive(cfg)
+	rate, err := r.depositRate(dv, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, testMDLBtcRate, rate)
+
+	// The BTC rate changes, the deposit seen before the change gets the old rate within the phase-in
+	cfg.MDLBtcExchangeRate = "200"
+	r = newReceive(cfg)
+
+	rate, err = r.depositRate(dv, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, testMDLBtcRate, rate)
+
+	di, err := r.saveIncomingDeposit(dv)
+	require.NoError(t, err)
+	require.Equal(t, testMDLBtcRate, di.ConversionRate)
+
+	// Once the phase-in has passed, it gets the new rate
+	rate, err = r.depositRate(dv, time.Now().Add(time.Hour*2))
+	require.NoError(t, err)
+	require.Equal(t, "200", rate)
+
+	// A deposit seen after the change gets the new rate
+	seenAfter := dv
+	seenAfter.FirstSeen = time.Now().Add(time.Minute).Unix()
+	rate, err = r.depositRate(seenAfter, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "200", rate)
+
+	// A deposit with no first-seen time, e.g. saved by an older version, gets the new rate
+	unknown := dv
+	unknown.FirstSeen = 0
+	rate, err = r.depositRate(unknown, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "200", rate)
+
+	// The rates of the other coin types didn't change
+	ethDv := dv
+	ethDv.CoinType = scanner.CoinTypeETH
+	ethDv.Value = 1e9
+	rate, err = r.depositRate(ethDv, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, testMDLEthRate, rate)
+
+	// Restarting with the same rate keeps the time of the change
+	changedAt := r.rateChanges[scanner.CoinTypeBTC].ChangedAt
+	r = newReceive(cfg)
+	require.Equal(t, changedAt, r.rateChanges[scanner.CoinTypeBTC].ChangedAt)
+
+	rate, err = r.depositRate(dv, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, testMDLBtcRate, rate)
+
+	// Disabled, the configured rate is used
+	cfg.RatePhaseIn = 0
+	r = newReceive(cfg)
+	rate, err = r.depositRate(dv, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "200", rate)
+}
+
+func TestReceiveRatePhaseInSpread(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	store, shutdown := newTestStore(t)
+	defer shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, store, testMDLAddr, btcAddr)
+
+	cfg := defaultCfg
+	cfg.RatePhaseIn = time.Hour
+	cfg.MDLBtcSpread = "10"
+
+	newReceive := func(cfg config.MDLExchanger) *Receive {
+		r, err := NewReceive(log, cfg, store, scanner.NewMultiplexer(log))
+		require.NoError(t, err)
+		return r
+	}
+
+	dv := scanner.Deposit{
+		CoinType:  scanner.CoinTypeBTC,
+		Address:   btcAddr,
+		Value:     1e8,
+		Height:    20,
+		Tx:        "foo-tx",
+		FirstSeen: time.Now().Add(-time.Minute).Unix(),
+	}
+
+	r := newReceive(cfg)
+	rate, err := r.depositRate(dv, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "90", rate)
+
+	// The rate and spread change, the deposit seen before the change gets the old rate with the old spread
+	cfg.MDLBtcExchangeRate = "200"
+	cfg.MDLBtcSpread = "50"
+	r = newReceive(cfg)
+
+	rate, err = r.depositRate(dv, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "90", rate)
+
+	// Once the phase-in has passed, it gets the new rate with the new spread
+	rate, err = r.depositRate(dv, time.Now().Add(time.Hour*2))
+	require.NoError(t, err)
+	require.Equal(t, "100", rate)
+
+	// Changing only the spread phases it in too
+	cfg.MDLBtcSpread = "25"
+	r = newReceive(cfg)
+
+	rate, err = r.depositRate(dv, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "100", rate)
+
+	rate, err = r.depositRate(dv, time.Now().Add(time.Hour*2))
+	require.NoError(t, err)
+	require.Equal(t, "150", rate)
+}
@@ -1,17 +1,22 @@
 package exchange
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 
 	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/events"
 	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/mathutil"
 )
 
 func init() {
-	// Assert that getRate() handles all coin types
+	// Assert that getRate() and getRateTiers() handle all coin types
 	cfg := config.MDLExchanger{
 		MDLBtcExchangeRate:      "1",
 		MDLEthExchangeRate:      "2",
@@ -27,13 +32,17 @@ func init() {
 		if rate == "" {
 			panic(fmt.Sprintf("getRate(%s) did not find a rate", ct))
 		}
+		if _, err := getRateTiers(cfg, ct); err != nil {
+			panic(err)
+		}
 	}
 }
 
 // Receiver is a component that reads deposits from a scanner.Scanner and records them
 type Receiver interface {
 	Deposits() <-chan DepositInfo
-	BindAddress(mdlAddr, depositAddr, coinType, buyMethod string) (*BoundAddress, error)
+	BindAddress(ctx context.Context, mdlAddr, depositAddr, coinType, buyMethod string, opts BindOptions) (*BoundAddress, error)
+	ImportDeposit(dv scanner.Deposit) (DepositInfo, error)
 }
 
 // ReceiveRunner is a Receiver than can be run
@@ -49,6 +58,8 @@ type Receive struct {
 	cfg         config.MDLExchanger
 	multiplexer *scanner.Multiplexer
 	store       Storer
+	publisher   events.Publisher
+	rateChanges map[string]RateChange // Recorded if mdl_exchanger.rate_phase_in is set
 	deposits    chan DepositInfo
 	quit        chan struct{}
 	done        chan struct{}
@@ -62,11 +73,22 @@ func NewReceive(log logrus.FieldLogger, cfg config.MDLExchanger, store Storer, m
 		return nil, err
 	}
 
+	var rateChanges map[string]RateChange
+	if cfg.RatePhaseIn > 0 {
+		var err error
+		rateChanges, err = recordRates(store, cfg, time.Now().UTC().Unix())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Receive{
 		log:         log.WithField("prefix", "teller.exchange.Receive"),
 		cfg:         cfg,
 		store:       store,
 		multiplexer: multiplexer,
+		publisher:   events.NopPublisher{},
+		rateChanges: rateChanges,
 		deposits:    make(chan DepositInfo, 100),
 		quit:        make(chan struct{}),
 		done:        make(chan struct{}),
@@ -124,6 +146,7 @@ func (r *Receive) runReadMultiplexer() {
 		select {
 		case <-r.quit:
 			log.Info("quit")
+			r.drainMultiplexer(log)
 			return
 		case dv, ok = <-r.multiplexer.GetDeposit():
 			if !ok {
@@ -132,23 +155,59 @@ func (r *Receive) runReadMultiplexer() {
 			}
 
 		}
-		log := log.WithField("deposit", dv.Deposit)
 
-		// Save a new DepositInfo based upon the scanner.Deposit.
-		// If the save fails, report it to the scanner.
-		// The scanner will mark the deposit as "processed" if no error
-		// occurred.  Any unprocessed deposits held by the scanner
-		// will be resent to the exchange when teller is started.
-		if d, err := r.saveIncomingDeposit(dv.Deposit); err != nil {
-			log.WithError(err).Error("saveIncomingDeposit failed. This deposit will not be reprocessed until teller is restarted.")
-			dv.ErrC <- err
-		} else {
-			dv.ErrC <- nil
+		// Deposits held for review or to unbound addresses are not processed
+		if d, err := r.receiveDeposit(log, dv); err == nil && d.Status != StatusWaitReview && d.Status != StatusUnbound {
 			r.deposits <- d
 		}
 	}
 }
 
+// receiveDeposit saves a new DepositInfo based upon the scanner.Deposit.
+// If the save fails, report it to the scanner.
+// The scanner will mark the deposit as "processed" if no error
+// occurred.  Any unprocessed deposits held by the scanner
+// will be resent to the exchange when teller is started.
+func (r *Receive) receiveDeposit(log logrus.FieldLogger, dv scanner.DepositNote) (DepositInfo, error) {
+	log = log.WithField("deposit", dv.Deposit)
+
+	d, err := r.saveIncomingDeposit(dv.Deposit)
+	if err != nil {
+		log.WithError(err).Error("saveIncomingDeposit failed. This deposit will not be reprocessed until teller is restarted.")
+		dv.ErrC <- err
+		return DepositInfo{}, err
+	}
+
+	dv.ErrC <- nil
+	return d, nil
+}
+
+// drainMultiplexer records deposits still buffered in the multiplexer on shutdown.
+// The saved deposits are not queued for processing if the queue is full; they have
+// StatusWaitDecide and are reloaded by Run when teller is restarted.
+func (r *Receive) drainMultiplexer(log logrus.FieldLogger) {
+	for {
+		select {
+		case dv, ok := <-r.multiplexer.GetDeposit():
+			if !ok {
+				return
+			}
+
+			d, err := r.receiveDeposit(log, dv)
+			if err != nil || d.Status == StatusWaitReview || d.Status == StatusUnbound {
+				continue
+			}
+
+			select {
+			case r.deposits <- d:
+			default:
+			}
+		default:
+			return
+		}
+	}
+}
+
 // Shutdown stops a previous call to run
 func (r *Receive) Shutdown() {
 	r.log.Info("Shutting down Receive")
@@ -168,52 +227,404 @@ func (r *Receive) saveIncomingDeposit(dv scanner.Deposit) (DepositInfo, error) {
 	log := r.log.WithField("deposit", dv)
 
 	var rate string
-	rate, err := r.getRate(dv.CoinType)
+	rate, err := r.depositRate(dv, time.Now())
 	if err != nil {
 		log.WithError(err).Error("get conversion rate failed")
 		return DepositInfo{}, err
 	}
 
-	di, err := r.store.GetOrCreateDepositInfo(dv, rate)
-	if err != nil {
+	di, created, err := r.store.GetOrCreateDepositInfo(dv, rate)
+	switch err {
+	case nil:
+	case ErrNoBoundAddress:
+		// The address may have been bound once and recycled. Quarantine the deposit
+		// instead of crediting a stale mdl address
+		di, created, err = r.store.GetOrCreateUnboundDepositInfo(dv, rate)
+		if err != nil {
+			log.WithError(err).Error("GetOrCreateUnboundDepositInfo failed")
+			return DepositInfo{}, err
+		}
+
+		log.WithField("depositInfo", di).Warn("Deposit to an address that is not bound, deposit quarantined for manual handling")
+	default:
 		log.WithError(err).Error("GetOrCreateDepositInfo failed")
 		return DepositInfo{}, err
 	}
 
+	// A deposit sent again by the scanner was checked when it was created
+	if created {
+		di, err = r.holdDeposit(log, di)
+		if err != nil {
+			return DepositInfo{}, err
+		}
+	}
+
 	log = log.WithField("depositInfo", di)
 	log.Info("Saved DepositInfo")
 
+	// The scanner sends a deposit again until it is acknowledged, it is only recorded once
+	if created {
+		publishEvent(log, r.publisher, events.DepositRecorded, di)
+	}
+
 	return di, err
 }
 
-// getRate returns conversion rate according to coin type
-func (r *Receive) getRate(coinType string) (string, error) {
-	return getRate(r.cfg, coinType)
+// ImportDeposit records a deposit the scanner missed, e.g. one observed manually on a block explorer.
+// The deposit address must be bound. The deposit is then processed like a scanned deposit.
+// The deposit is checked against the coin's node first, and a scanner.DepositMismatchError is returned
+// if it is not on the blockchain as described, or scanner.ErrDepositUnconfirmed if its block doesn't have
+// the confirmations the scanner requires for it yet.
+// Returns ErrDepositExists if a deposit with the same txid is already recorded
+func (r *Receive) ImportDeposit(dv scanner.Deposit) (DepositInfo, error) {
+	log := r.log.WithField("deposit", dv)
+
+	if err := r.multiplexer.VerifyDeposit(dv); err != nil {
+		log.WithError(err).Error("VerifyDeposit failed")
+		return DepositInfo{}, err
+	}
+
+	rate, err := r.depositRate(dv, time.Now())
+	if err != nil {
+		log.WithError(err).Error("get conversion rate failed")
+		return DepositInfo{}, err
+	}
+
+	di, err := r.store.AddImportedDepositInfo(dv, rate)
+	if err != nil {
+		log.WithError(err).Error("AddImportedDepositInfo failed")
+		return DepositInfo{}, err
+	}
+
+	di, err = r.holdDeposit(log, di)
+	if err != nil {
+		return DepositInfo{}, err
+	}
+
+	log = log.WithField("depositInfo", di)
+	log.Warn("Saved imported DepositInfo")
+
+	publishEvent(log, r.publisher, events.DepositRecorded, di)
+
+	if di.Status != StatusWaitReview {
+		select {
+		case r.deposits <- di:
+		case <-r.quit:
+		}
+	}
+
+	return di, nil
+}
+
+// holdDeposit holds a new deposit for review if it breaks mdl_exchanger.max_deposits_per_binding
+// or mdl_exchanger.max_outstanding, or doesn't match the expected amount of its binding
+func (r *Receive) holdDeposit(log logrus.FieldLogger, di DepositInfo) (DepositInfo, error) {
+	var err error
+	if di.ExpectedAmount != "" && di.Status == StatusWaitDecide {
+		di, err = r.holdMismatchedDeposit(log, di)
+		if err != nil {
+			return DepositInfo{}, err
+		}
+	}
+
+	if r.cfg.MaxDepositsPerBinding > 0 && di.Status == StatusWaitDecide {
+		di, err = r.holdExcessDeposit(log, di)
+		if err != nil {
+			return DepositInfo{}, err
+		}
+	}
+
+	if r.cfg.MaxOutstanding != "" && di.Status == StatusWaitDecide {
+		di, err = r.holdOutstandingDeposit(log, di)
+		if err != nil {
+			return DepositInfo{}, err
+		}
+	}
+
+	return di, nil
 }
 
-// getRate returns conversion rate according to coin type
+// holdMismatchedDeposit sets the status of a deposit to StatusWaitReview if its amount differs from
+// the expected amount of its binding by more than mdl_exchanger.expected_amount_tolerance of the expected amount
+func (r *Receive) holdMismatchedDeposit(log logrus.FieldLogger, di DepositInfo) (DepositInfo, error) {
+	expected, err := mathutil.DecimalFromString(di.ExpectedAmount)
+	if err != nil {
+		log.WithError(err).Error("Invalid expected amount")
+		return DepositInfo{}, err
+	}
+
+	tolerance, err := r.cfg.ExpectedAmountToleranceDecimal()
+	if err != nil {
+		log.WithError(err).Error("ExpectedAmountToleranceDecimal failed")
+		return DepositInfo{}, err
+	}
+
+	amount, err := DepositValueToDecimal(di.CoinType, di.DepositValue)
+	if err != nil {
+		log.WithError(err).Error("DepositValueToDecimal failed")
+		return DepositInfo{}, err
+	}
+
+	if amount.Sub(expected).Abs().LessThanOrEqual(expected.Mul(tolerance)) {
+		return di, nil
+	}
+
+	di, err = r.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitReview
+		di.Error = ErrExpectedAmountMismatch.Error()
+		return di
+	})
+	if err != nil {
+		log.WithError(err).Error("UpdateDepositInfo set StatusWaitReview failed")
+		return DepositInfo{}, err
+	}
+
+	log.WithFields(logrus.Fields{
+		"amount":         amount.String(),
+		"expectedAmount": expected.String(),
+		"tolerance":      tolerance.String(),
+	}).Warn("Deposit amount does not match the expected amount of its binding, deposit held for manual review")
+
+	return di, nil
+}
+
+// holdExcessDeposit sets the status of a deposit to StatusWaitReview if more than
+// mdl_exchanger.max_deposits_per_binding deposits were made to its address before it
+func (r *Receive) holdExcessDeposit(log logrus.FieldLogger, di DepositInfo) (DepositInfo, error) {
+	dis, err := r.store.GetDepositInfoOfDepositAddress(di.DepositAddress, di.CoinType)
+	if err != nil {
+		log.WithError(err).Error("GetDepositInfoOfDepositAddress failed")
+		return DepositInfo{}, err
+	}
+
+	n := -1
+	for i, d := range dis {
+		if d.DepositID == di.DepositID {
+			n = i
+			break
+		}
+	}
+
+	if n < r.cfg.MaxDepositsPerBinding {
+		return di, nil
+	}
+
+	di, err = r.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitReview
+		di.Error = ErrMaxDepositsPerBinding.Error()
+		return di
+	})
+	if err != nil {
+		log.WithError(err).Error("UpdateDepositInfo set StatusWaitReview failed")
+		return DepositInfo{}, err
+	}
+
+	log.WithFields(logrus.Fields{
+		"depositNum":            n + 1,
+		"maxDepositsPerBinding": r.cfg.MaxDepositsPerBinding,
+	}).Warn("Deposit address has too many deposits, deposit held for manual review")
+
+	return di, nil
+}
+
+// holdOutstandingDeposit sets the status of a deposit to StatusWaitReview if the MDL owed for it,
+// added to the MDL owed for the other deposits not paid yet, is above mdl_exchanger.max_outstanding
+func (r *Receive) holdOutstandingDeposit(log logrus.FieldLogger, di DepositInfo) (DepositInfo, error) {
+	maxOutstanding, err := r.cfg.MaxOutstandingDroplets()
+	if err != nil {
+		log.WithError(err).Error("MaxOutstandingDroplets failed")
+		return DepositInfo{}, err
+	}
+
+	// Deposits held for review are not owed until an operator releases them
+	unpaid, err := r.store.GetDepositInfoArray(func(d DepositInfo) bool {
+		if d.DepositID == di.DepositID {
+			return false
+		}
+
+		switch d.Status {
+		case StatusWaitDecide, StatusWaitSend, StatusWaitPassthrough:
+			return true
+		default:
+			return false
+		}
+	})
+	if err != nil {
+		log.WithError(err).Error("GetDepositInfoArray failed")
+		return DepositInfo{}, err
+	}
+
+	// The MDL owed for a deposit is net of the network fee if it is deducted from the payout
+	var fee uint64
+	if r.cfg.DeductNetworkFee {
+		fee, err = r.cfg.NetworkFeeDroplets()
+		if err != nil {
+			log.WithError(err).Error("NetworkFeeDroplets failed")
+			return DepositInfo{}, err
+		}
+	}
+
+	var outstanding uint64
+	for _, d := range unpaid {
+		amt, err := CalculateDepositMDLValue(d.CoinType, d.DepositValue, d.ConversionRate, r.cfg.MaxDecimals)
+		if err != nil {
+			log.WithError(err).WithField("unpaidDepositInfo", d).Error("CalculateDepositMDLValue failed")
+			return DepositInfo{}, err
+		}
+		outstanding += DeductNetworkFee(amt, fee)
+	}
+
+	amt, err := CalculateDepositMDLValue(di.CoinType, di.DepositValue, di.ConversionRate, r.cfg.MaxDecimals)
+	if err != nil {
+		log.WithError(err).Error("CalculateDepositMDLValue failed")
+		return DepositInfo{}, err
+	}
+	amt = DeductNetworkFee(amt, fee)
+
+	if outstanding+amt <= maxOutstanding {
+		return di, nil
+	}
+
+	di, err = r.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitReview
+		di.Error = ErrMaxOutstanding.Error()
+		return di
+	})
+	if err != nil {
+		log.WithError(err).Error("UpdateDepositInfo set StatusWaitReview failed")
+		return DepositInfo{}, err
+	}
+
+	log.WithFields(logrus.Fields{
+		"outstanding":    outstanding,
+		"depositMDL":     amt,
+		"maxOutstanding": maxOutstanding,
+	}).Warn("Deposit would raise the MDL owed for unpaid deposits above the max outstanding, deposit held for manual review")
+
+	return di, nil
+}
+
+// getRate returns conversion rate according to coin type.
+// Returns ErrRateNotSet if the coin type's rate is empty, which is allowed while its exchange is disabled
 func getRate(cfg config.MDLExchanger, coinType string) (string, error) {
+	var rate string
 	switch coinType {
 	case scanner.CoinTypeBTC:
-		return cfg.MDLBtcExchangeRate, nil
+		rate = cfg.MDLBtcExchangeRate
 	case scanner.CoinTypeETH:
-		return cfg.MDLEthExchangeRate, nil
+		rate = cfg.MDLEthExchangeRate
 	case scanner.CoinTypeSKY:
-		return cfg.MDLSkyExchangeRate, nil
+		rate = cfg.MDLSkyExchangeRate
 	case scanner.CoinTypeWAVES:
-		return cfg.MDLWavesExchangeRate, nil
+		rate = cfg.MDLWavesExchangeRate
 	case scanner.CoinTypeWAVESMDL:
-		return cfg.MDLWavesMDLExchangeRate, nil
+		rate = cfg.MDLWavesMDLExchangeRate
 	default:
 		return "", scanner.ErrUnsupportedCoinType
 	}
+
+	if rate == "" {
+		return "", ErrRateNotSet
+	}
+
+	return rate, nil
+}
+
+// getSpread returns the mdl_*_spread percent of a coin type, empty if there is no spread
+func getSpread(cfg config.MDLExchanger, coinType string) (string, error) {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		return cfg.MDLBtcSpread, nil
+	case scanner.CoinTypeETH:
+		return cfg.MDLEthSpread, nil
+	case scanner.CoinTypeSKY:
+		return cfg.MDLSkySpread, nil
+	case scanner.CoinTypeWAVES:
+		return cfg.MDLWavesSpread, nil
+	case scanner.CoinTypeWAVESMDL:
+		return cfg.MDLWavesMDLSpread, nil
+	default:
+		return "", scanner.ErrUnsupportedCoinType
+	}
+}
+
+// applyCoinSpread returns rate with the spread of coinType applied, see ApplySpread
+func applyCoinSpread(cfg config.MDLExchanger, coinType, rate string) (string, error) {
+	spread, err := getSpread(cfg, coinType)
+	if err != nil {
+		return "", err
+	}
+
+	return ApplySpread(rate, spread)
+}
+
+// getRateTiers returns the rate tiers of a coin type
+func getRateTiers(cfg config.MDLExchanger, coinType string) ([]config.RateTier, error) {
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		return cfg.MDLBtcExchangeRateTiers, nil
+	case scanner.CoinTypeETH:
+		return cfg.MDLEthExchangeRateTiers, nil
+	case scanner.CoinTypeSKY:
+		return cfg.MDLSkyExchangeRateTiers, nil
+	case scanner.CoinTypeWAVES:
+		return cfg.MDLWavesExchangeRateTiers, nil
+	case scanner.CoinTypeWAVESMDL:
+		return cfg.MDLWavesMDLExchangeRateTiers, nil
+	default:
+		return nil, scanner.ErrUnsupportedCoinType
+	}
+}
+
+// getDepositRate returns the conversion rate of a deposit of value, measured in the unit recorded by the coin's scanner.
+// It is the rate of the rate tier with the largest min amount the deposit reaches, or the coin's rate if it reaches none
+func getDepositRate(cfg config.MDLExchanger, coinType string, value int64) (string, error) {
+	rate, err := getRate(cfg, coinType)
+	if err != nil {
+		return "", err
+	}
+
+	tiers, err := getRateTiers(cfg, coinType)
+	if err != nil {
+		return "", err
+	}
+
+	return getTieredRate(coinType, value, rate, tiers)
+}
+
+// getTieredRate returns the rate of the tier with the largest min amount a deposit of value reaches, or rate if it reaches none
+func getTieredRate(coinType string, value int64, rate string, tiers []config.RateTier) (string, error) {
+	if len(tiers) == 0 {
+		return rate, nil
+	}
+
+	amount, err := DepositValueToDecimal(coinType, value)
+	if err != nil {
+		return "", err
+	}
+
+	// The tiers are validated to be in increasing order of min amount
+	for _, t := range tiers {
+		minAmount, err := decimal.NewFromString(t.MinAmount)
+		if err != nil {
+			return "", err
+		}
+
+		if amount.LessThan(minAmount) {
+			break
+		}
+
+		rate = t.Rate
+	}
+
+	return rate, nil
 }
 
 // BindAddress binds deposit address with mdl address, and
 // add the btc/eth/sky address to scan service, when detect deposit coin
 // to the btc/eth/sky address, will send specific mdl to the binded
 // mdl address
-func (r *Receive) BindAddress(mdlAddr, depositAddr, coinType, buyMethod string) (*BoundAddress, error) {
+func (r *Receive) BindAddress(ctx context.Context, mdlAddr, depositAddr, coinType, buyMethod string, opts BindOptions) (*BoundAddress, error) {
 	if err := config.ValidateBuyMethod(buyMethod); err != nil {
 		return nil, err
 	}
@@ -222,7 +633,7 @@ func (r *Receive) BindAddress(mdlAddr, depositAddr, coinType, buyMethod string)
 		return nil, err
 	}
 
-	boundAddr, err := r.store.BindAddress(mdlAddr, depositAddr, coinType, buyMethod)
+	boundAddr, err := r.store.BindAddress(ctx, mdlAddr, depositAddr, coinType, buyMethod, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,103 @@
+package exchange
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runReconciler re-drives the stale deposits every mdl_exchanger.stale_deposit_check_interval until the Exchange is shut down
+func (e *Exchange) runReconciler() {
+	log := e.log.WithField("goroutine", "reconciler")
+
+	ticker := time.NewTicker(e.cfg.StaleDepositCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.quit:
+			log.Info("quit")
+			return
+		case <-ticker.C:
+			if _, err := e.reconcileStaleDeposits(time.Now()); err != nil {
+				log.WithError(err).Error("reconcileStaleDeposits failed")
+			}
+		}
+	}
+}
+
+// reconcileStaleDeposits re-drives the deposits left in a non-terminal status without an update
+// for longer than mdl_exchanger.stale_deposit_threshold, e.g. after a send failed. Deposits that are
+// already queued or being processed are skipped. StatusWaitPassthrough deposits are only logged,
+// since re-driving them could buy the coins twice. Returns the deposits that were re-driven
+func (e *Exchange) reconcileStaleDeposits(now time.Time) ([]DepositInfo, error) {
+	staleBefore := now.Add(-e.cfg.StaleDepositThreshold).UTC().Unix()
+
+	dis, err := e.store.GetDepositInfoArray(func(di DepositInfo) bool {
+		if di.UpdatedAt > staleBefore {
+			return false
+		}
+
+		switch di.Status {
+		case StatusWaitDecide, StatusWaitPassthrough, StatusWaitSend, StatusWaitConfirm:
+			return true
+		default:
+			return false
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var redriven []DepositInfo
+	for _, di := range dis {
+		log := e.log.WithFields(logrus.Fields{
+			"depositInfo": di,
+			"staleFor":    now.Sub(time.Unix(di.UpdatedAt, 0)),
+		})
+
+		if e.redriveStaleDeposit(log, di) {
+			log.Warn("Stale deposit re-driven")
+			redriven = append(redriven, di)
+		}
+	}
+
+	return redriven, nil
+}
+
+// redriveStaleDeposit queues a stale deposit where its status is processed. Returns false if it was not queued
+func (e *Exchange) redriveStaleDeposit(log logrus.FieldLogger, di DepositInfo) bool {
+	switch di.Status {
+	case StatusWaitDecide:
+		r, ok := e.Receiver.(*Receive)
+		if !ok {
+			return false
+		}
+
+		if _, ok := e.Processor.(*DirectBuy); !ok {
+			log.Warn("Stale deposit not re-driven, only the direct buy method can be re-driven")
+			return false
+		}
+
+		// The processor isn't keeping up if the queue is full, the deposit is retried at the next check
+		select {
+		case r.deposits <- di:
+			return true
+		default:
+			log.Warn("Stale deposit not re-driven, the processor's queue is full")
+			return false
+		}
+
+	case StatusWaitSend, StatusWaitConfirm:
+		s, ok := e.Sender.(*Send)
+		if !ok || !e.cfg.SendEnabled {
+			return false
+		}
+
+		return s.queueDeposit(di)
+
+	default:
+		log.Warn("Stale deposit can't be re-driven, it needs manual handling")
+		return false
+	}
+}
@@ -0,0 +1,198 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+func TestExchangeReconcileStaleDeposits(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	e := newTestExchange(t, log, db)
+	e.cfg.StaleDepositThreshold = time.Hour
+	e.cfg.StaleDepositCheckInterval = time.Minute
+	defer closeMultiplexer(e)
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	seed := func(n uint32, status Status) DepositInfo {
+		dv := scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        n,
+		}
+
+		_, _, err := e.store.GetOrCreateDepositInfo(dv, testMDLBtcRate)
+		require.NoError(t, err)
+
+		di, err := e.store.UpdateDepositInfo(dv.ID(), func(di DepositInfo) DepositInfo {
+			di.Status = status
+			return di
+		})
+		require.NoError(t, err)
+		return di
+	}
+
+	waitDecide := seed(0, StatusWaitDecide)
+	waitSend := seed(1, StatusWaitSend)
+	waitConfirm := seed(2, StatusWaitConfirm)
+	seed(3, StatusWaitPassthrough)
+	seed(4, StatusWaitReview)
+	seed(5, StatusDone)
+
+	// Nothing is stale yet
+	redriven, err := e.reconcileStaleDeposits(time.Now())
+	require.NoError(t, err)
+	require.Empty(t, redriven)
+
+	redriven, err = e.reconcileStaleDeposits(time.Now().Add(time.Hour * 2))
+	require.NoError(t, err)
+	require.Len(t, redriven, 3)
+
+	ids := make(map[string]struct{})
+	for _, di := range redriven {
+		ids[di.DepositID] = struct{}{}
+	}
+	require.Equal(t, map[string]struct{}{
+		waitDecide.DepositID:  {},
+		waitSend.DepositID:    {},
+		waitConfirm.DepositID: {},
+	}, ids)
+
+	// StatusWaitDecide deposits are queued for the processor, the others for the sender
+	require.Equal(t, waitDecide.DepositID, (<-e.Receiver.Deposits()).DepositID)
+	require.Len(t, e.Sender.(*Send).depositChan, 2)
+
+	// Deposits still queued for the sender are not queued again
+	redriven, err = e.reconcileStaleDeposits(time.Now().Add(time.Hour * 2))
+	require.NoError(t, err)
+	require.Len(t, redriven, 1)
+	require.Equal(t, waitDecide.DepositID, redriven[0].DepositID)
+	require.Len(t, e.Sender.(*Send).depositChan, 2)
+}
+
+func TestExchangeReconcileStuckSend(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	e, run, shutdown := setupExchange(t, log)
+	e.cfg.StaleDepositThreshold = time.Hour
+	e.cfg.StaleDepositCheckInterval = time.Hour
+	go run()
+	defer shutdown()
+	defer e.Shutdown()
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	// Force sender to return a create tx error so that the deposit is stuck at StatusWaitSend
+	createTransactionErr := errors.New("fake create transaction error")
+	e.Sender.(*Send).sender.(*dummySender).createTransactionErr = createTransactionErr
+
+	dn := scanner.DepositNote{
+		Deposit: scanner.Deposit{
+			CoinType: scanner.CoinTypeBTC,
+			Address:  btcAddr,
+			Value:    1e8,
+			Height:   20,
+			Tx:       "foo-tx",
+			N:        0,
+		},
+		ErrC: make(chan error, 1),
+	}
+	mp := e.Receiver.(*Receive).multiplexer
+	mp.GetScanner(scanner.CoinTypeBTC).(*dummyScanner).addDeposit(dn)
+
+	err := <-dn.ErrC
+	require.NoError(t, err)
+
+	checkExchangerStatus(t, e, createTransactionErr)
+
+	di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+
+	// Once the cause is fixed, the reconciler sends the stuck deposit
+	e.Sender.(*Send).sender.(*dummySender).createTransactionErr = nil
+
+	redriven, err := e.reconcileStaleDeposits(time.Now().Add(time.Hour * 2))
+	require.NoError(t, err)
+	require.Len(t, redriven, 1)
+	require.Equal(t, dn.Deposit.ID(), redriven[0].DepositID)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range time.Tick(dbCheckWaitTime) {
+			di, err := e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+			require.NoError(t, err)
+			if di.Status == StatusWaitConfirm {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(dbScanTimeout):
+		t.Fatal("Waiting for the stuck deposit to be sent timed out")
+	}
+
+	di, err = e.store.(*Store).getDepositInfo(dn.Deposit.ID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(100e6), di.MDLSent)
+}
+
+func TestSendSkipsChangedStatus(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	e := newTestExchange(t, log, db)
+	defer closeMultiplexer(e)
+
+	btcAddr := "foo-btc-addr"
+	mustBindAddress(t, e.store, testMDLAddr, btcAddr)
+
+	dv := scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  btcAddr,
+		Value:    1e8,
+		Height:   20,
+		Tx:       "foo-tx",
+	}
+	_, _, err := e.store.GetOrCreateDepositInfo(dv, testMDLBtcRate)
+	require.NoError(t, err)
+
+	stale, err := e.store.UpdateDepositInfo(dv.ID(), func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	// The deposit was sent since the stale copy was read
+	_, err = e.store.UpdateDepositInfo(dv.ID(), func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		di.Txid = "sent-txid"
+		return di
+	})
+	require.NoError(t, err)
+
+	_, err = e.Sender.(*Send).handleDepositInfoState(stale)
+	require.Equal(t, ErrDepositStatusChanged, err)
+
+	di, err := e.store.(*Store).getDepositInfo(dv.ID())
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, di.Status)
+	require.Equal(t, "sent-txid", di.Txid)
+}
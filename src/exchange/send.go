@@ -1,25 +1,33 @@
 package exchange
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/MDLlife/MDL/src/api"
 	"github.com/MDLlife/MDL/src/util/droplet"
 
 	"github.com/MDLlife/teller/src/config"
-	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/events"
 	"github.com/MDLlife/teller/src/sender"
-	"github.com/MDLlife/teller/src/util/mathutil"
 	"github.com/MDLlife/MDL/src/readable"
 )
 
+// errSendsPaused is returned by processWaitSendDeposit for a StatusWaitSend deposit while sends are paused
+var errSendsPaused = errors.New("Sends are paused")
+
 // Sender is a component for sending coins
 type Sender interface {
 	Status() error
 	Balance() (*readable.BalancePair, error)
+	BreakerState() sender.BreakerState
+	SendsPaused() bool
+	SetSendsPaused(bool) error
 }
 
 // SendRunner a Sender than can be run
@@ -35,11 +43,23 @@ type Send struct {
 	processor   Processor
 	sender      sender.Sender // sender provides APIs for sending mdl
 	store       Storer        // deposit info storage
+	publisher   events.Publisher
 	quit        chan struct{}
 	done        chan struct{}
 	depositChan chan DepositInfo
 	statusLock  sync.RWMutex
 	status      error
+
+	// While sends are paused, no new transactions are created and deposits stay queued.
+	// resumeC is closed when sends are resumed
+	pauseLock sync.Mutex
+	paused    bool
+	resumeC   chan struct{}
+
+	// IDs of the deposits queued on depositChan or being processed, so that a deposit
+	// re-driven by the stale deposit reconciler is not processed twice at once
+	queuedLock sync.Mutex
+	queued     map[string]struct{}
 }
 
 type TransactionInfo struct {
@@ -47,6 +67,10 @@ type TransactionInfo struct {
 	encodedTransaction string
 	amount uint64
 	address string
+	// coin hours spent by the transaction: its fee and the hours sent to address
+	hours uint64
+	// MDL value of the deposit before the network fee was deducted from amount
+	gross uint64
 }
 
 // NewSend creates exchange service
@@ -65,9 +89,11 @@ func NewSend(log logrus.FieldLogger, cfg config.MDLExchanger, store Storer, send
 		processor:   processor,
 		sender:      sender,
 		store:       store,
+		publisher:   events.NopPublisher{},
 		quit:        make(chan struct{}),
 		done:        make(chan struct{}, 1),
 		depositChan: make(chan DepositInfo, 100),
+		queued:      make(map[string]struct{}),
 	}, nil
 }
 
@@ -80,6 +106,18 @@ func (s *Send) Run() error {
 		s.done <- struct{}{}
 	}()
 
+	// Sends stay paused across restarts
+	paused, err := s.store.GetSendsPaused()
+	if err != nil {
+		err = fmt.Errorf("GetSendsPaused failed: %v", err)
+		log.WithError(err).Error(err)
+		return err
+	}
+	if paused {
+		s.setPaused(true)
+		log.Warn("Sends are paused, confirmed deposits are queued until sends are resumed")
+	}
+
 	var wg sync.WaitGroup
 
 	if s.cfg.SendEnabled {
@@ -113,12 +151,12 @@ func (s *Send) Run() error {
 
 		// Queue the saved StatusWaitConfirm deposits
 		for _, di := range waitConfirmDeposits {
-			s.depositChan <- di
+			s.queueDeposit(di)
 		}
 
 		// Queue the saved StatusWaitSend deposits
 		for _, di := range waitSendDeposits {
-			s.depositChan <- di
+			s.queueDeposit(di)
 		}
 	} else {
 		wg.Add(1)
@@ -145,16 +183,46 @@ func (s *Send) runSend() {
 	// Only one deposit is processed at a time; it will not send more coins
 	// until it receives confirmation of the previous send.
 	log := s.log.WithField("goroutine", "runSend")
+
+	// StatusWaitSend deposits that were not sent because sends are paused.
+	// They stay queued and are processed in order once sends are resumed,
+	// while the StatusWaitConfirm deposits are still confirmed in the meantime
+	var parked []DepositInfo
+
+	process := func(d DepositInfo) {
+		log := log.WithField("depositInfo", d)
+		switch err := s.processWaitSendDeposit(d); err {
+		case nil:
+		case errSendsPaused:
+			log.Info("Sends are paused, the deposit is sent once sends are resumed")
+			parked = append(parked, d)
+			return
+		default:
+			log.WithError(err).Error("processWaitSendDeposit failed. This deposit will not be reprocessed until teller is restarted.")
+		}
+		s.dequeueDeposit(d.DepositID)
+	}
+
 	for {
+		// resumeC is only waited on while deposits are parked
+		var resumeC chan struct{}
+		if len(parked) != 0 {
+			resumeC = s.sendsResumedC()
+		}
+
 		select {
 		case <-s.quit:
 			log.Info("quit")
 			return
-		case d := <-s.depositChan:
-			log := log.WithField("depositInfo", d)
-			if err := s.processWaitSendDeposit(d); err != nil {
-				log.WithError(err).Error("processWaitSendDeposit failed. This deposit will not be reprocessed until teller is restarted.")
+		case <-resumeC:
+			log.WithField("parked", len(parked)).Info("Sends resumed, processing the parked deposits")
+			ds := parked
+			parked = nil
+			for _, d := range ds {
+				process(d)
 			}
+		case d := <-s.depositChan:
+			process(d)
 		}
 	}
 }
@@ -170,6 +238,7 @@ func (s *Send) runNoSend() {
 		case d := <-s.depositChan:
 			log := log.WithField("depositInfo", d)
 			log.Warning("Received depositInfo, but sending is disabled")
+			s.dequeueDeposit(d.DepositID)
 		}
 	}
 }
@@ -187,11 +256,39 @@ func (s *Send) receiveDeposits() {
 			return
 		case d := <-s.processor.Deposits():
 			log.WithField("depositInfo", d).Info("Received deposit from processor")
-			s.depositChan <- d
+			if !s.queueDeposit(d) {
+				log.WithField("depositInfo", d).Warn("Deposit from processor is already queued")
+			}
 		}
 	}
 }
 
+// queueDeposit queues a deposit for processing. Returns false without queueing the deposit
+// if it is already queued or being processed
+func (s *Send) queueDeposit(di DepositInfo) bool {
+	s.queuedLock.Lock()
+	if _, ok := s.queued[di.DepositID]; ok {
+		s.queuedLock.Unlock()
+		return false
+	}
+	s.queued[di.DepositID] = struct{}{}
+	s.queuedLock.Unlock()
+
+	select {
+	case s.depositChan <- di:
+	case <-s.quit:
+	}
+
+	return true
+}
+
+// dequeueDeposit records that a deposit taken from depositChan is done processing
+func (s *Send) dequeueDeposit(depositID string) {
+	s.queuedLock.Lock()
+	defer s.queuedLock.Unlock()
+	delete(s.queued, depositID)
+}
+
 // Shutdown close the exchange service
 func (s *Send) Shutdown() {
 	close(s.quit)
@@ -204,6 +301,7 @@ func (s *Send) Shutdown() {
 // StatusWaitSend -> StatusWaitConfirm
 // StatusWaitConfirm -> StatusDone
 // StatusWaitDeposit is never saved to the database, so it does not transition
+// Returns errSendsPaused without creating a transaction for a StatusWaitSend deposit while sends are paused
 func (s *Send) processWaitSendDeposit(di DepositInfo) error {
 	log := s.log.WithField("depositInfo", di)
 	log.Info("Processing StatusWaitSend deposit")
@@ -215,6 +313,12 @@ func (s *Send) processWaitSendDeposit(di DepositInfo) error {
 		default:
 		}
 
+		// No new transaction is created while sends are paused.
+		// Transactions that were already broadcast are still confirmed
+		if di.Status == StatusWaitSend && s.SendsPaused() {
+			return errSendsPaused
+		}
+
 		//log.Info("handleDepositInfoState")
 
 		var err error
@@ -240,7 +344,7 @@ func (s *Send) processWaitSendDeposit(di DepositInfo) error {
 			switch err {
 			case nil:
 				break
-			case ErrNotConfirmed:
+			case ErrNotConfirmed, ErrHoursReserve:
 				select {
 				case <-time.After(s.cfg.TxConfirmationCheckWait):
 				case <-s.quit:
@@ -277,9 +381,20 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 			// If the send amount is empty, skip to StatusDone.
 			if err == ErrEmptySendAmount {
 				log.Info("Send amount is 0, skipping to StatusDone")
+
+				// The network fee may have consumed the whole MDL value of the deposit
+				gross, net, err := s.calculatePayoutDroplets(di)
+				if err != nil {
+					return di, err
+				}
+
 				di, err = s.store.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
 					di.Status = StatusDone
 					di.Error = ErrEmptySendAmount.Error()
+					if s.cfg.DeductNetworkFee {
+						di.MDLGross = gross
+						di.MDLNet = net
+					}
 					return di
 				})
 				if err != nil {
@@ -289,12 +404,20 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 
 				log.WithError(ErrEmptySendAmount).Info("DepositInfo set to StatusDone")
 
+				s.publishPayoutDone(log, di)
+
 				return di, nil
 			}
 
 			return di, err
 		}
 
+		// Don't broadcast a transaction that would spend the reserved coin hours,
+		// the deposit is retried once the wallet has more coin hours
+		if err := s.checkHoursReserve(mdlTx); err != nil {
+			return di, err
+		}
+
 		// Find the coins from the mdlTx
 		// The mdlTx contains one output sent to the destination address,
 		// so this check is safe.
@@ -316,12 +439,25 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 		// Within a bolt.DB transaction, update the db then send the coins
 		// If the send fails, the data is rolled back
 		// If the db save fails, no coins had been sent
+		var storedStatus Status
 		di, err = s.store.UpdateDepositInfoCallback(di.DepositID, func(di DepositInfo) DepositInfo {
+			storedStatus = di.Status
 			di.Status = StatusWaitConfirm
 			di.Txid = mdlTx.txId
 			di.MDLSent = mdlTx.amount
+			if s.cfg.DeductNetworkFee {
+				di.MDLGross = mdlTx.gross
+				di.MDLNet = mdlTx.amount
+			}
 			return di
 		}, func(di DepositInfo) error {
+			// The deposit was handled since it was read, e.g. it was sent from a stale copy.
+			// Rolling back leaves the saved deposit as is, and nothing is broadcast
+			if storedStatus != StatusWaitSend {
+				log.WithField("storedStatus", storedStatus).Error("Deposit status changed since it was read, not broadcasting")
+				return ErrDepositStatusChanged
+			}
+
 			// NOTE: broadcastTransaction retries indefinitely on error
 			// If the mdl node is not reachable, this will block,
 			// which will also block the database since it's in a transaction
@@ -381,6 +517,8 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 
 		log.Info("DepositInfo status set to StatusDone")
 
+		s.publishPayoutDone(log, di)
+
 		return di, nil
 
 	case StatusDone:
@@ -402,48 +540,35 @@ func (s *Send) handleDepositInfoState(di DepositInfo) (DepositInfo, error) {
 }
 
 func (s *Send) calculateMDLDroplets(di DepositInfo) (uint64, error) {
-	log := s.log
-	var err error
-	var mdlAmt uint64
-	switch di.CoinType {
-	case scanner.CoinTypeBTC:
-		mdlAmt, err = CalculateBtcMDLValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
-		if err != nil {
-			log.WithError(err).Error("CalculateBtcMDLValue failed")
-			return 0, err
-		}
-	case scanner.CoinTypeETH:
-		//Gwei convert to wei, because stored-value is Gwei in case overflow of uint64
-		mdlAmt, err = CalculateEthMDLValue(mathutil.Gwei2Wei(di.DepositValue), di.ConversionRate, s.cfg.MaxDecimals)
-		if err != nil {
-			log.WithError(err).Error("CalculateEthMDLValue failed")
-			return 0, err
-		}
-	case scanner.CoinTypeSKY:
-		mdlAmt, err = CalculateSkyMDLValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
-		if err != nil {
-			log.WithError(err).Error("CalculateSkyMDLValue failed")
-			return 0, err
-		}
-	case scanner.CoinTypeWAVES:
-		mdlAmt, err = CalculateWavesMDLValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
-		if err != nil {
-			log.WithError(err).Error("CalculateWavesMDLValue CoinTypeWAVES failed")
-			return 0, err
-		}
-	case scanner.CoinTypeWAVESMDL:
-		mdlAmt, err = CalculateWavesMDLValue(di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
-		if err != nil {
-			log.WithError(err).Error("CalculateWavesMDLValue CoinTypeWAVESMDL failed")
-			return 0, err
-		}
-	default:
-		log.WithError(scanner.ErrUnsupportedCoinType).Error()
-		return 0, scanner.ErrUnsupportedCoinType
+	mdlAmt, err := CalculateDepositMDLValue(di.CoinType, di.DepositValue, di.ConversionRate, s.cfg.MaxDecimals)
+	if err != nil {
+		s.log.WithError(err).WithField("coinType", di.CoinType).Error("CalculateDepositMDLValue failed")
+		return 0, err
 	}
 	return mdlAmt, nil
 }
 
+// calculatePayoutDroplets returns the MDL value of a deposit and the MDL to send for it, in droplets.
+// They differ if mdl_exchanger.deduct_network_fee is enabled, then the network fee is deducted from the MDL to send
+func (s *Send) calculatePayoutDroplets(di DepositInfo) (gross, net uint64, err error) {
+	gross, err = s.calculateMDLDroplets(di)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !s.cfg.DeductNetworkFee {
+		return gross, gross, nil
+	}
+
+	fee, err := s.cfg.NetworkFeeDroplets()
+	if err != nil {
+		s.log.WithError(err).Error("NetworkFeeDroplets failed")
+		return 0, 0, err
+	}
+
+	return gross, DeductNetworkFee(gross, fee), nil
+}
+
 func (s *Send) createTransaction(di DepositInfo) (*TransactionInfo, error) {
 	log := s.log.WithField("deposit", di)
 
@@ -459,11 +584,15 @@ func (s *Send) createTransaction(di DepositInfo) (*TransactionInfo, error) {
 	log = log.WithField("mdlRate", di.ConversionRate)
 	log = log.WithField("maxDecimals", s.cfg.MaxDecimals)
 
-	mdlAmt, err := s.calculateMDLDroplets(di)
+	grossAmt, mdlAmt, err := s.calculatePayoutDroplets(di)
 	if err != nil {
-		log.WithError(err).Error("calculateMDLDroplets failed")
+		log.WithError(err).Error("calculatePayoutDroplets failed")
 		return nil, err
 	}
+
+	if s.cfg.DeductNetworkFee {
+		log = log.WithField("grossAmtDroplets", grossAmt)
+	}
 	mdlAmtCoins, err := droplet.ToString(mdlAmt)
 	if err != nil {
 		log.WithError(err).Error("droplet.ToString failed")
@@ -494,15 +623,80 @@ func (s *Send) createTransaction(di DepositInfo) (*TransactionInfo, error) {
 	//	return nil, err
 	//}
 
+	hours, err := createdTxHoursSpent(tx, di.MDLAddress)
+	if err != nil {
+		log.WithError(err).Error("createdTxHoursSpent failed")
+		return nil, err
+	}
+
 	txInfo := &TransactionInfo{
 		txId: tx.Transaction.TxID,
 		encodedTransaction:tx.EncodedTransaction,
 		amount:mdlAmt,
 		address:di.MDLAddress,
+		hours:hours,
+		gross:grossAmt,
 	}
 	return txInfo, nil
 }
 
+// createdTxHoursSpent returns the coin hours a created transaction spends from the wallet:
+// its fee and the hours of the outputs to addr. The hours of the change outputs stay in the wallet
+func createdTxHoursSpent(tx *api.CreateTransactionResponse, addr string) (uint64, error) {
+	var hours uint64
+	if tx.Transaction.Fee != "" {
+		fee, err := strconv.ParseUint(tx.Transaction.Fee, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid transaction fee %q: %v", tx.Transaction.Fee, err)
+		}
+		hours = fee
+	}
+
+	for _, o := range tx.Transaction.Out {
+		if o.Address != addr {
+			continue
+		}
+
+		h, err := strconv.ParseUint(o.Hours, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid output hours %q: %v", o.Hours, err)
+		}
+		hours += h
+	}
+
+	return hours, nil
+}
+
+// checkHoursReserve returns ErrHoursReserve if broadcasting tx would leave the wallet
+// with fewer confirmed coin hours than cfg.MinReservedHours
+func (s *Send) checkHoursReserve(tx *TransactionInfo) error {
+	if s.cfg.MinReservedHours == 0 {
+		return nil
+	}
+
+	log := s.log.WithFields(logrus.Fields{
+		"txid":             tx.txId,
+		"hoursSpent":       tx.hours,
+		"minReservedHours": s.cfg.MinReservedHours,
+	})
+
+	bal, err := s.sender.Balance()
+	if err != nil {
+		log.WithError(err).Error("sender.Balance failed")
+		return err
+	}
+
+	log = log.WithField("hours", bal.Confirmed.Hours)
+
+	if bal.Confirmed.Hours < tx.hours || bal.Confirmed.Hours-tx.hours < s.cfg.MinReservedHours {
+		err := ErrHoursReserve
+		log.WithError(err).Warn(err)
+		return err
+	}
+
+	return nil
+}
+
 //func verifyCreatedTransaction(tx *coin.Transaction, di DepositInfo, mdlAmt uint64) error {
 //	// Check invariant assertions:
 //	// The transaction should contain one output to the destination address.
@@ -573,3 +767,71 @@ func (s *Send) Status() error {
 	s.statusLock.RLock()
 	return s.status
 }
+
+// BreakerState returns the state of the mdl sender's circuit breaker,
+// or an empty string if the sender has no circuit breaker
+func (s *Send) BreakerState() sender.BreakerState {
+	if b, ok := s.sender.(*sender.CircuitBreaker); ok {
+		return b.State()
+	}
+	return ""
+}
+
+// SendsPaused returns true if sends are paused
+func (s *Send) SendsPaused() bool {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	return s.paused
+}
+
+// SetSendsPaused pauses or resumes sending coins. The setting is saved, and restored when teller restarts.
+// While paused, confirmed deposits are queued. When resumed, the queued deposits are sent
+func (s *Send) SetSendsPaused(paused bool) error {
+	if err := s.store.SetSendsPaused(paused); err != nil {
+		return err
+	}
+
+	s.setPaused(paused)
+
+	return nil
+}
+
+func (s *Send) setPaused(paused bool) {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+
+	if paused == s.paused {
+		return
+	}
+
+	s.paused = paused
+	if paused {
+		s.resumeC = make(chan struct{})
+	} else {
+		close(s.resumeC)
+	}
+}
+
+// sendsResumedC returns a channel that is closed once sends are resumed, or nil if sends were never paused
+func (s *Send) sendsResumedC() chan struct{} {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	return s.resumeC
+}
+
+// publishPayoutDone publishes the PayoutDone event of a deposit, without its contact email if the email opted out
+// of notifications. If the opt-out can't be checked, the contact email is not notified
+func (s *Send) publishPayoutDone(log logrus.FieldLogger, di DepositInfo) {
+	if di.ContactEmail != "" {
+		optedOut, err := s.store.IsContactEmailOptedOut(di.ContactEmail)
+		if err != nil {
+			log.WithError(err).Error("IsContactEmailOptedOut failed, not notifying the contact email")
+		}
+
+		if err != nil || optedOut {
+			di.ContactEmail = ""
+		}
+	}
+
+	publishEvent(log, s.publisher, events.PayoutDone, di)
+}
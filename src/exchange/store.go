@@ -1,21 +1,24 @@
 package exchange
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/sirupsen/logrus"
 
+	"github.com/MDLlife/teller/src/config"
 	"github.com/MDLlife/teller/src/scanner"
 	"github.com/MDLlife/teller/src/util/dbutil"
 )
 
 var (
-	// ExchangeMetaBkt stores metadata about the exchange (unused)
+	// ExchangeMetaBkt stores metadata about the exchange.
+	// Its sequence is the version of the last saved deposit record or binding
 	ExchangeMetaBkt = []byte("exchange_meta")
 
 	// DepositInfoBkt maps a BTC transaction to a DepositInfo
@@ -33,6 +36,18 @@ var (
 
 const bindAddressBktPrefix = "bind_address"
 
+// sendsPausedKey records in ExchangeMetaBkt whether sends are paused
+const sendsPausedKey = "sends_paused"
+
+// coinDeprecationsKey records in ExchangeMetaBkt the unix time each deprecated coin type was deprecated
+const coinDeprecationsKey = "coin_deprecations"
+
+// rateChangesKey records in ExchangeMetaBkt the RateChange of each coin type
+const rateChangesKey = "rate_changes"
+
+// contactOptOutsKey records in ExchangeMetaBkt the unix time each contact email opted out of notifications
+const contactOptOutsKey = "contact_opt_outs"
+
 // GetBindAddressBkt returns the bind_address bucket name for a given coin type
 func GetBindAddressBkt(coinType string) ([]byte, error) {
 	var suffix string
@@ -79,20 +94,34 @@ func init() {
 // Storer interface for exchange storage
 type Storer interface {
 	GetBindAddress(depositAddr, coinType string) (*BoundAddress, error)
-	BindAddress(mdlAddr, depositAddr, coinType, buyMethod string) (*BoundAddress, error)
-	GetOrCreateDepositInfo(scanner.Deposit, string) (DepositInfo, error)
+	BindAddress(ctx context.Context, mdlAddr, depositAddr, coinType, buyMethod string, opts BindOptions) (*BoundAddress, error)
+	GetOrCreateDepositInfo(scanner.Deposit, string) (DepositInfo, bool, error)
+	GetOrCreateUnboundDepositInfo(scanner.Deposit, string) (DepositInfo, bool, error)
+	AddImportedDepositInfo(scanner.Deposit, string) (DepositInfo, error)
 	GetDepositInfoArray(DepositFilter) ([]DepositInfo, error)
 	GetDepositInfoOfMDLAddress(string) ([]DepositInfo, error)
+	GetDepositInfoOfDepositAddress(string, string) ([]DepositInfo, error)
 	UpdateDepositInfo(string, func(DepositInfo) DepositInfo) (DepositInfo, error)
 	UpdateDepositInfoCallback(string, func(DepositInfo) DepositInfo, func(DepositInfo) error) (DepositInfo, error)
 	GetMDLBindAddresses(string) ([]BoundAddress, error)
 	GetDepositStats() (*DepositStats, error)
+	GetSendsPaused() (bool, error)
+	SetSendsPaused(bool) error
+	GetCoinDeprecations() (map[string]int64, error)
+	DeprecateCoin(coinType string, deprecatedAt int64) (int64, error)
+	RestoreCoin(coinType string) error
+	RecordRate(coinType, rate string, tiers []config.RateTier, spread string, recordedAt int64) (RateChange, error)
+	OptOutContactEmail(email string, optedOutAt int64) error
+	IsContactEmailOptedOut(email string) (bool, error)
 }
 
 // Store storage for exchange
 type Store struct {
 	db  *bolt.DB
 	log logrus.FieldLogger
+
+	// compress saves deposit records and bindings gzipped, see EnableCompression
+	compress bool
 }
 
 // NewStore creates a Store instance
@@ -101,6 +130,18 @@ func NewStore(log logrus.FieldLogger, db *bolt.DB) (*Store, error) {
 		return nil, errors.New("new exchange Store failed, db is nil")
 	}
 
+	// A read-only db cannot create buckets or be migrated, they must already exist
+	if db.IsReadOnly() {
+		if err := dbutil.CheckSchemaVersion(db, schemaComponent, migrations); err != nil {
+			return nil, err
+		}
+
+		return &Store{
+			db:  db,
+			log: log.WithField("prefix", "exchange.Store"),
+		}, nil
+	}
+
 	if err := db.Update(func(tx *bolt.Tx) error {
 		// create exchange meta bucket if not exist
 		if _, err := tx.CreateBucketIfNotExists(ExchangeMetaBkt); err != nil {
@@ -133,12 +174,84 @@ func NewStore(log logrus.FieldLogger, db *bolt.DB) (*Store, error) {
 		return nil, err
 	}
 
+	log = log.WithField("prefix", "exchange.Store")
+
+	if err := dbutil.Migrate(log, db, schemaComponent, migrations); err != nil {
+		return nil, err
+	}
+
 	return &Store{
 		db:  db,
-		log: log.WithField("prefix", "exchange.Store"),
+		log: log,
 	}, nil
 }
 
+// EnableCompression saves deposit records and bindings gzipped from now on,
+// and compresses the records and bindings saved uncompressed before.
+// Compressed and uncompressed records are both read, so compression can be disabled again at any time.
+// Must be called before the Store is used
+func (s *Store) EnableCompression() error {
+	s.compress = true
+
+	if s.db.IsReadOnly() {
+		return nil
+	}
+
+	bkts := [][]byte{DepositInfoBkt, MDLDepositSeqsIndexBkt}
+	for _, ct := range scanner.GetCoinTypes() {
+		bkts = append(bkts, MustGetBindAddressBkt(ct))
+	}
+
+	var n int
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, bkt := range bkts {
+			var keys, values [][]byte
+			if err := dbutil.ForEach(tx, bkt, func(k, v []byte) error {
+				if !dbutil.IsCompressed(v) {
+					// k and v are only valid for the life of the transaction, and the bucket can't be modified while iterating
+					keys = append(keys, append([]byte(nil), k...))
+					values = append(values, append([]byte(nil), v...))
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for i, k := range keys {
+				cv, err := dbutil.CompressValue(values[i])
+				if err != nil {
+					return err
+				}
+
+				if err := dbutil.PutBucketValue(tx, bkt, string(k), cv); err != nil {
+					return err
+				}
+			}
+
+			n += len(keys)
+		}
+
+		return nil
+	}); err != nil {
+		s.log.WithError(err).Error("Compressing the uncompressed records failed")
+		return err
+	}
+
+	if n > 0 {
+		s.log.WithField("records", n).Info("Compressed the uncompressed records")
+	}
+
+	return nil
+}
+
+// putRecordTx saves a deposit record or binding, compressed if compression is enabled
+func (s *Store) putRecordTx(tx *bolt.Tx, bktName []byte, key string, obj interface{}) error {
+	if s.compress {
+		return dbutil.PutBucketCompressedValue(tx, bktName, key, obj)
+	}
+	return dbutil.PutBucketValue(tx, bktName, key, obj)
+}
+
 // GetBindAddress returns bound mdl address of given coin address.
 // If no mdl address is found, returns empty string and nil error.
 func (s *Store) GetBindAddress(depositAddr, coinType string) (*BoundAddress, error) {
@@ -174,15 +287,15 @@ func (s *Store) getBindAddressTx(tx *bolt.Tx, depositAddr, coinType string) (*Bo
 	}
 }
 
-// BindAddress binds a mdl address to a deposit address
-func (s *Store) BindAddress(mdlAddr, depositAddr, coinType, buyMethod string) (*BoundAddress, error) {
+// BindAddress binds a mdl address to a deposit address, with the optional values of opts.
+// Returns ctx.Err() without binding if ctx is done, e.g. the bind request timed out
+func (s *Store) BindAddress(ctx context.Context, mdlAddr, depositAddr, coinType, buyMethod string, opts BindOptions) (*BoundAddress, error) {
 	log := s.log.WithField("mdlAddr", mdlAddr)
 	log = log.WithField("depositAddr", depositAddr)
 	log = log.WithField("coinType", coinType)
 	log = log.WithField("buyMethod", buyMethod)
 
-	bindBktFullName, err := GetBindAddressBkt(coinType)
-	if err != nil {
+	if _, err := GetBindAddressBkt(coinType); err != nil {
 		return nil, err
 	}
 
@@ -191,9 +304,20 @@ func (s *Store) BindAddress(mdlAddr, depositAddr, coinType, buyMethod string) (*
 		Address:    depositAddr,
 		CoinType:   coinType,
 		BuyMethod:  buyMethod,
+		Reference:  opts.Reference,
+		Label:      opts.Label,
+		CreatedAt:  time.Now().UTC().Unix(),
+
+		ExpectedAmount: opts.ExpectedAmount,
+		ContactEmail:   opts.ContactEmail,
 	}
 
 	if err := s.db.Update(func(tx *bolt.Tx) error {
+		// The client of a done request never learns the deposit address, so it is not bound
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		existingMDLAddr, err := s.getBindAddressTx(tx, depositAddr, coinType)
 		if err != nil {
 			return err
@@ -205,23 +329,12 @@ func (s *Store) BindAddress(mdlAddr, depositAddr, coinType, buyMethod string) (*
 			return err
 		}
 
-		// Update index of mdl address and the deposit seq
-		var addrs []BoundAddress
-		if err := dbutil.GetBucketObject(tx, MDLDepositSeqsIndexBkt, mdlAddr, &addrs); err != nil {
-			switch err.(type) {
-			case dbutil.ObjectNotExistErr:
-			default:
-				return err
-			}
-		}
-
-		addrs = append(addrs, boundAddr)
-
-		if err := dbutil.PutBucketValue(tx, MDLDepositSeqsIndexBkt, mdlAddr, addrs); err != nil {
+		boundAddr.Version, err = nextVersionTx(tx)
+		if err != nil {
 			return err
 		}
 
-		return dbutil.PutBucketValue(tx, bindBktFullName, depositAddr, boundAddr)
+		return s.putBindAddressTx(tx, boundAddr)
 	}); err != nil {
 		return nil, err
 	}
@@ -229,13 +342,45 @@ func (s *Store) BindAddress(mdlAddr, depositAddr, coinType, buyMethod string) (*
 	return &boundAddr, nil
 }
 
+// nextVersionTx returns the version of a deposit record or binding about to be saved, see DepositInfo.Version
+func nextVersionTx(tx *bolt.Tx) (uint64, error) {
+	return dbutil.NextSequence(tx, ExchangeMetaBkt)
+}
+
+// putBindAddressTx saves a BoundAddress and adds it to the index of its mdl address
+func (s *Store) putBindAddressTx(tx *bolt.Tx, boundAddr BoundAddress) error {
+	bindBktFullName, err := GetBindAddressBkt(boundAddr.CoinType)
+	if err != nil {
+		return err
+	}
+
+	// Update index of mdl address and the deposit seq
+	var addrs []BoundAddress
+	if err := dbutil.GetBucketObject(tx, MDLDepositSeqsIndexBkt, boundAddr.MDLAddress, &addrs); err != nil {
+		switch err.(type) {
+		case dbutil.ObjectNotExistErr:
+		default:
+			return err
+		}
+	}
+
+	addrs = append(addrs, boundAddr)
+
+	if err := s.putRecordTx(tx, MDLDepositSeqsIndexBkt, boundAddr.MDLAddress, addrs); err != nil {
+		return err
+	}
+
+	return s.putRecordTx(tx, bindBktFullName, boundAddr.Address, boundAddr)
+}
+
 // GetOrCreateDepositInfo creates a DepositInfo unless one exists with the DepositInfo.DepositID key,
-// in which case it returns the existing DepositInfo.
-func (s *Store) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, error) {
+// in which case it returns the existing DepositInfo. Returns true if the DepositInfo was created
+func (s *Store) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, bool, error) {
 	log := s.log.WithField("deposit", dv)
 	log = log.WithField("rate", rate)
 
 	var finalDepositInfo DepositInfo
+	var created bool
 	if err := s.db.Update(func(tx *bolt.Tx) error {
 		di, err := s.getDepositInfoTx(tx, dv.ID())
 
@@ -246,70 +391,166 @@ func (s *Store) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (Deposit
 
 		case dbutil.ObjectNotExistErr:
 			log.Info("DepositInfo not found in DB, inserting")
-			boundAddr, err := s.getBindAddressTx(tx, dv.Address, dv.CoinType)
-			if err != nil {
-				err = fmt.Errorf("GetBindAddress failed: %v", err)
-				log.WithError(err).Error(err)
-				return err
-			}
+			finalDepositInfo, err = s.createDepositInfoTx(tx, log, dv, rate, false)
+			created = err == nil
+			return err
 
-			if boundAddr == nil {
-				err = ErrNoBoundAddress
-				log.WithError(err).Error(err)
-				return err
-			}
+		default:
+			err = fmt.Errorf("getDepositInfo failed: %v", err)
+			log.WithError(err).Error(err)
+			return err
+		}
+	}); err != nil {
+		return DepositInfo{}, false, err
+	}
 
-			log = log.WithField("boundAddr", boundAddr)
+	return finalDepositInfo, created, nil
 
-			// Sanity check the boundAddr data against the deposit value data
-			if boundAddr.CoinType != dv.CoinType {
-				err := fmt.Errorf("boundAddr.CoinType != dv.CoinType")
-				log.WithError(err).Error()
-				return err
-			}
-			if boundAddr.Address != dv.Address {
-				err := fmt.Errorf("boundAddr.Address != dv.Address")
-				log.WithError(err).Error()
-				return err
-			}
+}
 
-			di := DepositInfo{
-				CoinType:       dv.CoinType,
-				DepositAddress: dv.Address,
-				MDLAddress:     boundAddr.MDLAddress,
-				BuyMethod:      boundAddr.BuyMethod,
-				DepositID:      dv.ID(),
-				Status:         StatusWaitDecide,
-				DepositValue:   dv.Value,
-				// Save the rate at the time this deposit was noticed
-				ConversionRate: rate,
-				Deposit:        dv,
-			}
+// createDepositInfoTx records a new DepositInfo for a deposit to a bound address, with StatusWaitDecide.
+// Returns ErrNoBoundAddress if the deposit address is not bound
+func (s *Store) createDepositInfoTx(tx *bolt.Tx, log logrus.FieldLogger, dv scanner.Deposit, rate string, imported bool) (DepositInfo, error) {
+	boundAddr, err := s.getBindAddressTx(tx, dv.Address, dv.CoinType)
+	if err != nil {
+		err = fmt.Errorf("GetBindAddress failed: %v", err)
+		log.WithError(err).Error(err)
+		return DepositInfo{}, err
+	}
+
+	if boundAddr == nil {
+		err = ErrNoBoundAddress
+		log.WithError(err).Error(err)
+		return DepositInfo{}, err
+	}
+
+	log = log.WithField("boundAddr", boundAddr)
+
+	// Sanity check the boundAddr data against the deposit value data
+	if boundAddr.CoinType != dv.CoinType {
+		err := fmt.Errorf("boundAddr.CoinType != dv.CoinType")
+		log.WithError(err).Error()
+		return DepositInfo{}, err
+	}
+	if boundAddr.Address != dv.Address {
+		err := fmt.Errorf("boundAddr.Address != dv.Address")
+		log.WithError(err).Error()
+		return DepositInfo{}, err
+	}
 
-			log = log.WithField("depositInfo", di)
+	di := DepositInfo{
+		CoinType:       dv.CoinType,
+		DepositAddress: dv.Address,
+		MDLAddress:     boundAddr.MDLAddress,
+		BuyMethod:      boundAddr.BuyMethod,
+		Reference:      boundAddr.Reference,
+		Label:          boundAddr.Label,
+		ExpectedAmount: boundAddr.ExpectedAmount,
+		ContactEmail:   boundAddr.ContactEmail,
+		DepositID:      dv.ID(),
+		Status:         StatusWaitDecide,
+		DepositValue:   dv.Value,
+		// Save the rate at the time this deposit was noticed
+		ConversionRate: rate,
+		Imported:       imported,
+		Deposit:        dv,
+		Timestamps: DepositTimestamps{
+			BoundAt:    boundAddr.CreatedAt,
+			DetectedAt: time.Now().UTC().Unix(),
+		},
+	}
+
+	log = log.WithField("depositInfo", di)
+
+	updatedDi, err := s.addDepositInfoTx(tx, di)
+	if err != nil {
+		err = fmt.Errorf("addDepositInfoTx failed: %v", err)
+		log.WithError(err).Error(err)
+		return DepositInfo{}, err
+	}
 
-			updatedDi, err := s.addDepositInfoTx(tx, di)
-			if err != nil {
-				err = fmt.Errorf("addDepositInfoTx failed: %v", err)
-				log.WithError(err).Error(err)
+	return updatedDi, nil
+}
+
+// AddImportedDepositInfo records a deposit the scanner missed, imported by an admin, with StatusWaitDecide.
+// Returns ErrDepositExists if a deposit of the same coin type and txid is already recorded, whatever its output index,
+// and ErrNoBoundAddress if the deposit address is not bound
+func (s *Store) AddImportedDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, error) {
+	log := s.log.WithField("deposit", dv)
+	log = log.WithField("rate", rate)
+
+	var finalDepositInfo DepositInfo
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
+			var di DepositInfo
+			if err := dbutil.UnmarshalValue(v, &di); err != nil {
 				return err
 			}
 
-			finalDepositInfo = updatedDi
+			if di.CoinType == dv.CoinType && di.Deposit.Tx == dv.Tx {
+				log.WithField("depositInfo", di).Warn("Imported deposit is already recorded")
+				return ErrDepositExists
+			}
 
 			return nil
-
-		default:
-			err = fmt.Errorf("getDepositInfo failed: %v", err)
-			log.WithError(err).Error(err)
+		}); err != nil {
 			return err
 		}
+
+		var err error
+		finalDepositInfo, err = s.createDepositInfoTx(tx, log, dv, rate, true)
+		return err
 	}); err != nil {
 		return DepositInfo{}, err
 	}
 
 	return finalDepositInfo, nil
+}
+
+// GetOrCreateUnboundDepositInfo records a deposit to an address that is not bound to a mdl address with StatusUnbound,
+// so that it can be handled manually. Returns the DepositInfo already recorded for the deposit, if any.
+// Returns true if the DepositInfo was created
+func (s *Store) GetOrCreateUnboundDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, bool, error) {
+	log := s.log.WithField("deposit", dv)
+
+	var finalDepositInfo DepositInfo
+	var created bool
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		di, err := s.getDepositInfoTx(tx, dv.ID())
+		switch err.(type) {
+		case nil:
+			finalDepositInfo = di
+			return nil
+		case dbutil.ObjectNotExistErr:
+		default:
+			return fmt.Errorf("getDepositInfo failed: %v", err)
+		}
 
+		finalDepositInfo, err = s.addDepositInfoTx(tx, DepositInfo{
+			CoinType:       dv.CoinType,
+			DepositAddress: dv.Address,
+			DepositID:      dv.ID(),
+			Status:         StatusUnbound,
+			DepositValue:   dv.Value,
+			ConversionRate: rate,
+			Error:          ErrNoBoundAddress.Error(),
+			Deposit:        dv,
+			Timestamps: DepositTimestamps{
+				DetectedAt: time.Now().UTC().Unix(),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("addDepositInfoTx failed: %v", err)
+		}
+
+		created = true
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("GetOrCreateUnboundDepositInfo failed")
+		return DepositInfo{}, false, err
+	}
+
+	return finalDepositInfo, created, nil
 }
 
 // addDepositInfo adds deposit info into storage, return seq or error
@@ -342,8 +583,14 @@ func (s *Store) addDepositInfoTx(tx *bolt.Tx, di DepositInfo) (DepositInfo, erro
 		return di, err
 	}
 
+	version, err := nextVersionTx(tx)
+	if err != nil {
+		return di, err
+	}
+
 	updatedDi := di
 	updatedDi.Seq = seq
+	updatedDi.Version = version
 	updatedDi.UpdatedAt = time.Now().UTC().Unix()
 
 	if err := updatedDi.ValidateForStatus(); err != nil {
@@ -351,7 +598,7 @@ func (s *Store) addDepositInfoTx(tx *bolt.Tx, di DepositInfo) (DepositInfo, erro
 		return di, err
 	}
 
-	if err := dbutil.PutBucketValue(tx, DepositInfoBkt, updatedDi.DepositID, updatedDi); err != nil {
+	if err := s.putRecordTx(tx, DepositInfoBkt, updatedDi.DepositID, updatedDi); err != nil {
 		return di, err
 	}
 
@@ -404,7 +651,7 @@ func (s *Store) GetDepositInfoArray(flt DepositFilter) ([]DepositInfo, error) {
 	if err := s.db.View(func(tx *bolt.Tx) error {
 		return dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
 			var dpi DepositInfo
-			if err := json.Unmarshal(v, &dpi); err != nil {
+			if err := dbutil.UnmarshalValue(v, &dpi); err != nil {
 				return err
 			}
 
@@ -452,7 +699,15 @@ func (s *Store) GetDepositInfoOfMDLAddress(mdlAddr string) ([]DepositInfo, error
 					DepositAddress: boundAddr.Address,
 					MDLAddress:     mdlAddr,
 					UpdatedAt:      time.Now().UTC().Unix(),
+					Version:        boundAddr.Version,
 					CoinType:       boundAddr.CoinType,
+					Reference:      boundAddr.Reference,
+					Label:          boundAddr.Label,
+					ExpectedAmount: boundAddr.ExpectedAmount,
+					ContactEmail:   boundAddr.ContactEmail,
+					Timestamps: DepositTimestamps{
+						BoundAt: boundAddr.CreatedAt,
+					},
 				})
 			}
 
@@ -471,9 +726,10 @@ func (s *Store) GetDepositInfoOfMDLAddress(mdlAddr string) ([]DepositInfo, error
 		return nil, err
 	}
 
-	// sort the dpis by update time
-	sort.Slice(dpis, func(i, j int) bool {
-		return dpis[i].UpdatedAt < dpis[j].UpdatedAt
+	// Deposits to all the bound addresses, of any coin type, are listed in the order they were made.
+	// The sort is stable so that ties keep the binding order
+	sort.SliceStable(dpis, func(i, j int) bool {
+		return dpis[i].startedAt() < dpis[j].startedAt()
 	})
 
 	// renumber the seqs in the dpis
@@ -484,6 +740,44 @@ func (s *Store) GetDepositInfoOfMDLAddress(mdlAddr string) ([]DepositInfo, error
 	return dpis, nil
 }
 
+// GetDepositInfoOfDepositAddress returns the deposit info of the deposits to a deposit address
+// of the given coin type, in the order they were recorded
+func (s *Store) GetDepositInfoOfDepositAddress(depositAddr, coinType string) ([]DepositInfo, error) {
+	var dpis []DepositInfo
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		var txns []string
+		if err := dbutil.GetBucketObject(tx, BtcTxsBkt, depositAddr, &txns); err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		for _, txn := range txns {
+			var dpi DepositInfo
+			if err := dbutil.GetBucketObject(tx, DepositInfoBkt, txn, &dpi); err != nil {
+				return err
+			}
+
+			// WAVES and WAVES_MDL deposits can be made to the same address
+			if dpi.CoinType != coinType {
+				continue
+			}
+
+			dpis = append(dpis, dpi)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return dpis, nil
+}
+
 // UpdateDepositInfo updates deposit info. The update func takes a DepositInfo
 // and returns a modified copy of it.
 func (s *Store) UpdateDepositInfo(btcTx string, update func(DepositInfo) DepositInfo) (DepositInfo, error) {
@@ -511,10 +805,17 @@ func (s *Store) UpdateDepositInfoCallback(btcTx string, update func(DepositInfo)
 			return err
 		}
 
+		version, err := nextVersionTx(tx)
+		if err != nil {
+			return err
+		}
+
 		dpi = update(dpi)
+		dpi.Version = version
 		dpi.UpdatedAt = time.Now().UTC().Unix()
+		dpi.Timestamps.stamp(dpi.Status, dpi.UpdatedAt)
 
-		if err := dbutil.PutBucketValue(tx, DepositInfoBkt, btcTx, dpi); err != nil {
+		if err := s.putRecordTx(tx, DepositInfoBkt, btcTx, dpi); err != nil {
 			return err
 		}
 
@@ -567,7 +868,7 @@ func (s *Store) GetDepositStats() (stats *DepositStats, err error) {
 	if err := s.db.View(func(tx *bolt.Tx) error {
 		return dbutil.ForEach(tx, DepositInfoBkt, func(k, v []byte) error {
 			var dpi DepositInfo
-			if err := json.Unmarshal(v, &dpi); err != nil {
+			if err := dbutil.UnmarshalValue(v, &dpi); err != nil {
 				return err
 			}
 
@@ -594,3 +895,193 @@ func (s *Store) GetDepositStats() (stats *DepositStats, err error) {
 
 	return stats, nil
 }
+
+// GetSendsPaused returns true if sends were paused with SetSendsPaused
+func (s *Store) GetSendsPaused() (bool, error) {
+	var paused bool
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		err := dbutil.GetBucketObject(tx, ExchangeMetaBkt, sendsPausedKey, &paused)
+		switch err.(type) {
+		case nil, dbutil.ObjectNotExistErr:
+			return nil
+		default:
+			return err
+		}
+	}); err != nil {
+		return false, err
+	}
+
+	return paused, nil
+}
+
+// SetSendsPaused records whether sends are paused
+func (s *Store) SetSendsPaused(paused bool) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return dbutil.PutBucketValue(tx, ExchangeMetaBkt, sendsPausedKey, paused)
+	})
+}
+
+func getCoinDeprecationsTx(tx *bolt.Tx) (map[string]int64, error) {
+	deprecations := make(map[string]int64)
+
+	err := dbutil.GetBucketObject(tx, ExchangeMetaBkt, coinDeprecationsKey, &deprecations)
+	switch err.(type) {
+	case nil, dbutil.ObjectNotExistErr:
+		return deprecations, nil
+	default:
+		return nil, err
+	}
+}
+
+// GetCoinDeprecations returns the unix time each coin type deprecated with DeprecateCoin was deprecated
+func (s *Store) GetCoinDeprecations() (map[string]int64, error) {
+	var deprecations map[string]int64
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		deprecations, err = getCoinDeprecationsTx(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return deprecations, nil
+}
+
+// DeprecateCoin records that a coin type was deprecated at deprecatedAt, a unix time.
+// If the coin type is already deprecated, the time it was first deprecated is kept and returned
+func (s *Store) DeprecateCoin(coinType string, deprecatedAt int64) (int64, error) {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		deprecations, err := getCoinDeprecationsTx(tx)
+		if err != nil {
+			return err
+		}
+
+		if at, ok := deprecations[coinType]; ok {
+			deprecatedAt = at
+			return nil
+		}
+
+		deprecations[coinType] = deprecatedAt
+
+		return dbutil.PutBucketValue(tx, ExchangeMetaBkt, coinDeprecationsKey, deprecations)
+	}); err != nil {
+		return 0, err
+	}
+
+	return deprecatedAt, nil
+}
+
+// RestoreCoin removes the deprecation of a coin type
+func (s *Store) RestoreCoin(coinType string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		deprecations, err := getCoinDeprecationsTx(tx)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := deprecations[coinType]; !ok {
+			return nil
+		}
+
+		delete(deprecations, coinType)
+
+		return dbutil.PutBucketValue(tx, ExchangeMetaBkt, coinDeprecationsKey, deprecations)
+	})
+}
+
+func getContactOptOutsTx(tx *bolt.Tx) (map[string]int64, error) {
+	optOuts := make(map[string]int64)
+
+	err := dbutil.GetBucketObject(tx, ExchangeMetaBkt, contactOptOutsKey, &optOuts)
+	switch err.(type) {
+	case nil, dbutil.ObjectNotExistErr:
+		return optOuts, nil
+	default:
+		return nil, err
+	}
+}
+
+// OptOutContactEmail records that a contact email opted out of notifications at optedOutAt, a unix time.
+// Emails are compared case-insensitively. If the email already opted out, the time it first opted out is kept
+func (s *Store) OptOutContactEmail(email string, optedOutAt int64) error {
+	email = strings.ToLower(email)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		optOuts, err := getContactOptOutsTx(tx)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := optOuts[email]; ok {
+			return nil
+		}
+
+		optOuts[email] = optedOutAt
+
+		return dbutil.PutBucketValue(tx, ExchangeMetaBkt, contactOptOutsKey, optOuts)
+	})
+}
+
+// IsContactEmailOptedOut returns true if the contact email opted out of notifications with OptOutContactEmail
+func (s *Store) IsContactEmailOptedOut(email string) (bool, error) {
+	var optedOut bool
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		optOuts, err := getContactOptOutsTx(tx)
+		if err != nil {
+			return err
+		}
+
+		_, optedOut = optOuts[strings.ToLower(email)]
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	return optedOut, nil
+}
+
+// RecordRate records the rate, rate tiers and spread configured for a coin type at recordedAt, a unix time.
+// If they differ from the recorded ones, the recorded ones are kept as the previous rate
+// and recordedAt as the time the rate changed. Returns the recorded RateChange
+func (s *Store) RecordRate(coinType, rate string, tiers []config.RateTier, spread string, recordedAt int64) (RateChange, error) {
+	var rc RateChange
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		changes := make(map[string]RateChange)
+		err := dbutil.GetBucketObject(tx, ExchangeMetaBkt, rateChangesKey, &changes)
+		switch err.(type) {
+		case nil, dbutil.ObjectNotExistErr:
+		default:
+			return err
+		}
+
+		prev, ok := changes[coinType]
+		if ok && prev.Rate == rate && rateTiersEqual(prev.Tiers, tiers) && prev.Spread == spread {
+			rc = prev
+			return nil
+		}
+
+		rc = RateChange{
+			Rate:   rate,
+			Tiers:  tiers,
+			Spread: spread,
+		}
+		if ok {
+			rc.PreviousRate = prev.Rate
+			rc.PreviousTiers = prev.Tiers
+			rc.PreviousSpread = prev.Spread
+			rc.ChangedAt = recordedAt
+		}
+
+		changes[coinType] = rc
+
+		return dbutil.PutBucketValue(tx, ExchangeMetaBkt, rateChangesKey, changes)
+	}); err != nil {
+		return RateChange{}, err
+	}
+
+	return rc, nil
+}
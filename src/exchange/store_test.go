@@ -1,7 +1,10 @@
 package exchange
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/stretchr/testify/mock"
@@ -28,8 +31,8 @@ func (m *MockStore) GetBindAddress(btcAddr, coinType string) (*BoundAddress, err
 	return ba.(*BoundAddress), args.Error(1)
 }
 
-func (m *MockStore) BindAddress(mdlAddr, btcAddr, coinType, buyMethod string) (*BoundAddress, error) {
-	args := m.Called(mdlAddr, btcAddr, coinType, buyMethod)
+func (m *MockStore) BindAddress(ctx context.Context, mdlAddr, btcAddr, coinType, buyMethod string, opts BindOptions) (*BoundAddress, error) {
+	args := m.Called(mdlAddr, btcAddr, coinType, buyMethod, opts)
 
 	ba := args.Get(0)
 	if ba == nil {
@@ -39,7 +42,17 @@ func (m *MockStore) BindAddress(mdlAddr, btcAddr, coinType, buyMethod string) (*
 	return ba.(*BoundAddress), args.Error(1)
 }
 
-func (m *MockStore) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, error) {
+func (m *MockStore) GetOrCreateDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, bool, error) {
+	args := m.Called(dv, rate)
+	return args.Get(0).(DepositInfo), args.Bool(1), args.Error(2)
+}
+
+func (m *MockStore) GetOrCreateUnboundDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, bool, error) {
+	args := m.Called(dv, rate)
+	return args.Get(0).(DepositInfo), args.Bool(1), args.Error(2)
+}
+
+func (m *MockStore) AddImportedDepositInfo(dv scanner.Deposit, rate string) (DepositInfo, error) {
 	args := m.Called(dv, rate)
 	return args.Get(0).(DepositInfo), args.Error(1)
 }
@@ -66,6 +79,17 @@ func (m *MockStore) GetDepositInfoOfMDLAddress(mdlAddr string) ([]DepositInfo, e
 	return dis.([]DepositInfo), args.Error(1)
 }
 
+func (m *MockStore) GetDepositInfoOfDepositAddress(depositAddr, coinType string) ([]DepositInfo, error) {
+	args := m.Called(depositAddr, coinType)
+
+	dis := args.Get(0)
+	if dis == nil {
+		return nil, args.Error(1)
+	}
+
+	return dis.([]DepositInfo), args.Error(1)
+}
+
 func (m *MockStore) UpdateDepositInfo(btcTx string, f func(DepositInfo) DepositInfo) (DepositInfo, error) {
 	args := m.Called(btcTx, f)
 	return args.Get(0).(DepositInfo), args.Error(1)
@@ -92,6 +116,46 @@ func (m *MockStore) GetDepositStats() (*DepositStats, error) {
 	return args.Get(0).(*DepositStats), args.Error(2)
 }
 
+func (m *MockStore) GetSendsPaused() (bool, error) {
+	args := m.Called()
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) SetSendsPaused(paused bool) error {
+	args := m.Called(paused)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetCoinDeprecations() (map[string]int64, error) {
+	args := m.Called()
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *MockStore) DeprecateCoin(coinType string, deprecatedAt int64) (int64, error) {
+	args := m.Called(coinType, deprecatedAt)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStore) RestoreCoin(coinType string) error {
+	args := m.Called(coinType)
+	return args.Error(0)
+}
+
+func (m *MockStore) RecordRate(coinType, rate string, tiers []config.RateTier, spread string, recordedAt int64) (RateChange, error) {
+	args := m.Called(coinType, rate, tiers, spread, recordedAt)
+	return args.Get(0).(RateChange), args.Error(1)
+}
+
+func (m *MockStore) OptOutContactEmail(email string, optedOutAt int64) error {
+	args := m.Called(email, optedOutAt)
+	return args.Error(0)
+}
+
+func (m *MockStore) IsContactEmailOptedOut(email string) (bool, error) {
+	args := m.Called(email)
+	return args.Bool(0), args.Error(1)
+}
+
 func newTestStore(t *testing.T) (*Store, func()) {
 	db, shutdown := testutil.PrepareDB(t)
 
@@ -194,43 +258,47 @@ func TestStoreAddDepositInfo(t *testing.T) {
 }
 
 func mustBindAddress(t *testing.T, s Storer, mdlAddr, addr string) {
-	boundAddr, err := s.BindAddress(mdlAddr, addr, scanner.CoinTypeBTC, config.BuyMethodDirect)
+	boundAddr, err := s.BindAddress(context.Background(), mdlAddr, addr, scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
 	require.NoError(t, err)
 	require.NotNil(t, boundAddr)
 	require.Equal(t, mdlAddr, boundAddr.MDLAddress)
 	require.Equal(t, addr, boundAddr.Address)
 	require.Equal(t, scanner.CoinTypeBTC, boundAddr.CoinType)
 	require.Equal(t, config.BuyMethodDirect, boundAddr.BuyMethod)
+	require.NotEmpty(t, boundAddr.CreatedAt)
 }
 
 func mustBindAddressSky(t *testing.T, s Storer, mdlAddr, addr string) {
-	boundAddr, err := s.BindAddress(mdlAddr, addr, scanner.CoinTypeSKY, config.BuyMethodDirect)
+	boundAddr, err := s.BindAddress(context.Background(), mdlAddr, addr, scanner.CoinTypeSKY, config.BuyMethodDirect, BindOptions{})
 	require.NoError(t, err)
 	require.NotNil(t, boundAddr)
 	require.Equal(t, mdlAddr, boundAddr.MDLAddress)
 	require.Equal(t, addr, boundAddr.Address)
 	require.Equal(t, scanner.CoinTypeSKY, boundAddr.CoinType)
 	require.Equal(t, config.BuyMethodDirect, boundAddr.BuyMethod)
+	require.NotEmpty(t, boundAddr.CreatedAt)
 }
 
 func mustBindAddressWaves(t *testing.T, s Storer, mdlAddr, addr string) {
-	boundAddr, err := s.BindAddress(mdlAddr, addr, scanner.CoinTypeWAVES, config.BuyMethodDirect)
+	boundAddr, err := s.BindAddress(context.Background(), mdlAddr, addr, scanner.CoinTypeWAVES, config.BuyMethodDirect, BindOptions{})
 	require.NoError(t, err)
 	require.NotNil(t, boundAddr)
 	require.Equal(t, mdlAddr, boundAddr.MDLAddress)
 	require.Equal(t, addr, boundAddr.Address)
 	require.Equal(t, scanner.CoinTypeWAVES, boundAddr.CoinType)
 	require.Equal(t, config.BuyMethodDirect, boundAddr.BuyMethod)
+	require.NotEmpty(t, boundAddr.CreatedAt)
 }
 
 func mustBindAddressWavesMDL(t *testing.T, s Storer, mdlAddr, addr string) {
-	boundAddr, err := s.BindAddress(mdlAddr, addr, scanner.CoinTypeWAVESMDL, config.BuyMethodDirect)
+	boundAddr, err := s.BindAddress(context.Background(), mdlAddr, addr, scanner.CoinTypeWAVESMDL, config.BuyMethodDirect, BindOptions{})
 	require.NoError(t, err)
 	require.NotNil(t, boundAddr)
 	require.Equal(t, mdlAddr, boundAddr.MDLAddress)
 	require.Equal(t, addr, boundAddr.Address)
 	require.Equal(t, scanner.CoinTypeWAVESMDL, boundAddr.CoinType)
 	require.Equal(t, config.BuyMethodDirect, boundAddr.BuyMethod)
+	require.NotEmpty(t, boundAddr.CreatedAt)
 }
 
 func TestStoreBindAddress(t *testing.T) {
@@ -250,6 +318,8 @@ func TestStoreBindAddress(t *testing.T) {
 			Address:    "ba1",
 			CoinType:   scanner.CoinTypeBTC,
 			BuyMethod:  config.BuyMethodDirect,
+			CreatedAt:  ba.CreatedAt,
+			Version:    ba.Version,
 		}, ba)
 
 		var addrs []BoundAddress
@@ -260,6 +330,8 @@ func TestStoreBindAddress(t *testing.T) {
 			Address:    "ba1",
 			CoinType:   scanner.CoinTypeBTC,
 			BuyMethod:  config.BuyMethodDirect,
+			CreatedAt:  addrs[0].CreatedAt,
+			Version:    addrs[0].Version,
 		}, addrs[0])
 
 		return nil
@@ -287,6 +359,8 @@ func TestStoreSkyBindAddress(t *testing.T) {
 			Address:    "ba12",
 			CoinType:   scanner.CoinTypeSKY,
 			BuyMethod:  config.BuyMethodDirect,
+			CreatedAt:  ba.CreatedAt,
+			Version:    ba.Version,
 		}, ba)
 
 		var addrs []BoundAddress
@@ -297,6 +371,8 @@ func TestStoreSkyBindAddress(t *testing.T) {
 			Address:    "ba12",
 			CoinType:   scanner.CoinTypeSKY,
 			BuyMethod:  config.BuyMethodDirect,
+			CreatedAt:  addrs[0].CreatedAt,
+			Version:    addrs[0].Version,
 		}, addrs[0])
 
 		return nil
@@ -324,6 +400,8 @@ func TestStoreWavesBindAddress(t *testing.T) {
 			Address:    "ba12",
 			CoinType:   scanner.CoinTypeWAVES,
 			BuyMethod:  config.BuyMethodDirect,
+			CreatedAt:  ba.CreatedAt,
+			Version:    ba.Version,
 		}, ba)
 
 		var addrs []BoundAddress
@@ -334,6 +412,8 @@ func TestStoreWavesBindAddress(t *testing.T) {
 			Address:    "ba12",
 			CoinType:   scanner.CoinTypeWAVES,
 			BuyMethod:  config.BuyMethodDirect,
+			CreatedAt:  addrs[0].CreatedAt,
+			Version:    addrs[0].Version,
 		}, addrs[0])
 
 		return nil
@@ -361,6 +441,8 @@ func TestStoreWavesMDLBindAddress(t *testing.T) {
 			Address:    "ba12MDL",
 			CoinType:   scanner.CoinTypeWAVESMDL,
 			BuyMethod:  config.BuyMethodDirect,
+			CreatedAt:  ba.CreatedAt,
+			Version:    ba.Version,
 		}, ba)
 
 		var addrs []BoundAddress
@@ -371,6 +453,8 @@ func TestStoreWavesMDLBindAddress(t *testing.T) {
 			Address:    "ba12MDL",
 			CoinType:   scanner.CoinTypeWAVESMDL,
 			BuyMethod:  config.BuyMethodDirect,
+			CreatedAt:  addrs[0].CreatedAt,
+			Version:    addrs[0].Version,
 		}, addrs[0])
 
 		return nil
@@ -387,17 +471,99 @@ func TestStoreBindAddressTwiceFails(t *testing.T) {
 
 	mustBindAddress(t, s, "a", "b")
 
-	boundAddr, err := s.BindAddress("a", "b", scanner.CoinTypeBTC, config.BuyMethodDirect)
+	boundAddr, err := s.BindAddress(context.Background(), "a", "b", scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
 	require.Error(t, err)
 	require.Equal(t, ErrAddressAlreadyBound, err)
 	require.Nil(t, boundAddr)
 
-	boundAddr, err = s.BindAddress("c", "b", scanner.CoinTypeBTC, config.BuyMethodDirect)
+	boundAddr, err = s.BindAddress(context.Background(), "c", "b", scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
 	require.Error(t, err)
 	require.Equal(t, ErrAddressAlreadyBound, err)
 	require.Nil(t, boundAddr)
 }
 
+func TestStoreBindAddressContextDone(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	// The bind request timed out, the address is not bound
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	boundAddr, err := s.BindAddress(ctx, "a", "b", scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
+	require.Equal(t, context.Canceled, err)
+	require.Nil(t, boundAddr)
+
+	boundAddr, err = s.GetBindAddress("b", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Nil(t, boundAddr)
+}
+
+func TestStoreBindAddressCreatedAt(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	before := time.Now().UTC().Unix()
+	boundAddr, err := s.BindAddress(context.Background(), testMDLAddr, "btcaddr1", scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
+	require.NoError(t, err)
+	after := time.Now().UTC().Unix()
+
+	createdAt := boundAddr.CreatedAt
+	require.True(t, createdAt >= before)
+	require.True(t, createdAt <= after)
+
+	// The creation time is not changed later
+	time.Sleep(time.Second)
+
+	ba, err := s.GetBindAddress("btcaddr1", scanner.CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, createdAt, ba.CreatedAt)
+
+	mustBindAddress(t, s, testMDLAddr, "btcaddr2")
+
+	bas, err := s.GetMDLBindAddresses(testMDLAddr)
+	require.NoError(t, err)
+	require.Len(t, bas, 2)
+	require.Equal(t, createdAt, bas[0].CreatedAt)
+	require.True(t, bas[1].CreatedAt > createdAt)
+
+	// It is returned with the status of the bound address before any deposit is seen
+	dis, err := s.GetDepositInfoOfMDLAddress(testMDLAddr)
+	require.NoError(t, err)
+	require.Len(t, dis, 2)
+	for _, di := range dis {
+		if di.DepositAddress == "btcaddr1" {
+			require.Equal(t, createdAt, di.Timestamps.BoundAt)
+		} else {
+			require.Equal(t, bas[1].CreatedAt, di.Timestamps.BoundAt)
+		}
+	}
+
+	// It is copied to deposits to the bound address
+	di, _, err := s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr1",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "btx1",
+		N:        1,
+	}, testMDLBtcRate)
+	require.NoError(t, err)
+	require.Equal(t, createdAt, di.Timestamps.BoundAt)
+	require.True(t, di.Timestamps.DetectedAt > createdAt)
+
+	di, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+	require.Equal(t, createdAt, di.Timestamps.BoundAt)
+
+	di, err = s.getDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, createdAt, di.Timestamps.BoundAt)
+}
+
 func TestStoreGetBindAddress(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
@@ -564,6 +730,8 @@ func TestStoreGetBindAddress(t *testing.T) {
 					Address:    tc.coinAddr,
 					CoinType:   tc.coinType,
 					BuyMethod:  config.BuyMethodDirect,
+					CreatedAt:  addr.CreatedAt,
+					Version:    addr.Version,
 				}, *addr)
 			} else {
 				require.Nil(t, addr)
@@ -677,6 +845,80 @@ func TestStoreUpdateDepositInfo(t *testing.T) {
 	// TODO: test no exist deposit info
 }
 
+func TestStoreDepositTimestamps(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	mustBindAddress(t, s, testMDLAddr, "btcaddr1")
+
+	dv := scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr1",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "btx1",
+		N:        1,
+	}
+
+	// A new deposit is stamped as detected
+	di, _, err := s.GetOrCreateDepositInfo(dv, testMDLBtcRate)
+	require.NoError(t, err)
+	require.Equal(t, StatusWaitSend, di.Status)
+	require.NotEmpty(t, di.Timestamps.DetectedAt)
+	require.Empty(t, di.Timestamps.ConfirmedAt)
+	require.Empty(t, di.Timestamps.SendStartedAt)
+	require.Empty(t, di.Timestamps.SendCompletedAt)
+
+	// Each status change stamps its own timestamp
+	di, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+	require.Equal(t, di.UpdatedAt, di.Timestamps.ConfirmedAt)
+	require.True(t, di.Timestamps.ConfirmedAt >= di.Timestamps.DetectedAt)
+	require.Empty(t, di.Timestamps.SendStartedAt)
+	confirmedAt := di.Timestamps.ConfirmedAt
+
+	di, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitConfirm
+		di.Txid = "mdl-tx-1"
+		di.MDLSent = 100e6
+		return di
+	})
+	require.NoError(t, err)
+	require.Equal(t, confirmedAt, di.Timestamps.ConfirmedAt)
+	require.Equal(t, di.UpdatedAt, di.Timestamps.SendStartedAt)
+	require.True(t, di.Timestamps.SendStartedAt >= di.Timestamps.ConfirmedAt)
+	require.Empty(t, di.Timestamps.SendCompletedAt)
+	sendStartedAt := di.Timestamps.SendStartedAt
+
+	di, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+	require.Equal(t, sendStartedAt, di.Timestamps.SendStartedAt)
+	require.Equal(t, di.UpdatedAt, di.Timestamps.SendCompletedAt)
+	require.True(t, di.Timestamps.SendCompletedAt >= di.Timestamps.SendStartedAt)
+
+	// Updating a deposit in the same status does not overwrite its timestamp
+	expected := di.Timestamps
+	time.Sleep(time.Second)
+	di, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusDone
+		return di
+	})
+	require.NoError(t, err)
+	require.True(t, di.UpdatedAt > expected.SendCompletedAt)
+	require.Equal(t, expected, di.Timestamps)
+
+	// The timestamps are persisted
+	di2, err := s.getDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, expected, di2.Timestamps)
+}
+
 func TestStoreGetDepositInfoOfMDLAddress(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
@@ -738,6 +980,129 @@ func TestStoreGetDepositInfoOfMDLAddress(t *testing.T) {
 	require.Equal(t, di4, dpis[1])
 }
 
+func TestStoreDepositVersions(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	ba1, err := s.BindAddress(context.Background(), "mdladdr1", "btcaddr1", scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
+	require.NoError(t, err)
+	ba2, err := s.BindAddress(context.Background(), "mdladdr1", "btcaddr2", scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
+	require.NoError(t, err)
+	require.NotEmpty(t, ba1.Version)
+	require.True(t, ba2.Version > ba1.Version)
+
+	di1, _, err := s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "btcaddr1",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "btx1",
+		N:        1,
+	}, testMDLBtcRate)
+	require.NoError(t, err)
+	require.True(t, di1.Version > ba2.Version)
+
+	dpis, err := s.GetDepositInfoOfMDLAddress("mdladdr1")
+	require.NoError(t, err)
+	require.Len(t, dpis, 2)
+
+	var cursor uint64
+	for _, di := range dpis {
+		if di.Version > cursor {
+			cursor = di.Version
+		}
+
+		// The address waiting for a deposit has the version of its binding
+		if di.DepositAddress == "btcaddr2" {
+			require.Equal(t, StatusWaitDeposit, di.Status)
+			require.Equal(t, ba2.Version, di.Version)
+		}
+	}
+	require.Equal(t, di1.Version, cursor)
+
+	// Only the updated deposit is newer than the cursor
+	di1, err = s.UpdateDepositInfo(di1.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+	require.True(t, di1.Version > cursor)
+
+	dpis, err = s.GetDepositInfoOfMDLAddress("mdladdr1")
+	require.NoError(t, err)
+
+	var changed []DepositInfo
+	for _, di := range dpis {
+		if di.Version > cursor {
+			changed = append(changed, di)
+		}
+	}
+
+	require.Len(t, changed, 1)
+	require.Equal(t, di1.DepositID, changed[0].DepositID)
+	require.Equal(t, StatusWaitSend, changed[0].Status)
+}
+
+func TestStoreGetDepositInfoOfMDLAddressAcrossCoinTypes(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	mustBindAddress(t, s, "mdladdr1", "btcaddr1")
+	_, err := s.BindAddress(context.Background(), "mdladdr1", "ethaddr1", scanner.CoinTypeETH, config.BuyMethodDirect, BindOptions{})
+	require.NoError(t, err)
+	mustBindAddressSky(t, s, "mdladdr1", "skyaddr1")
+
+	// BTC and ETH deposits, interleaved in time.
+	// The records are read per bound address, so both BTC deposits are read before the ETH deposits
+	deposits := []struct {
+		coinType   string
+		addr       string
+		depositID  string
+		detectedAt int64
+	}{
+		{scanner.CoinTypeBTC, "btcaddr1", "btctx:1", 100},
+		{scanner.CoinTypeETH, "ethaddr1", "ethtx:1", 200},
+		{scanner.CoinTypeBTC, "btcaddr1", "btctx:2", 300},
+		{scanner.CoinTypeETH, "ethaddr1", "ethtx:2", 400},
+	}
+
+	// Added out of order, all with the same UpdatedAt
+	for _, i := range []int{3, 0, 2, 1} {
+		d := deposits[i]
+		_, err := s.addDepositInfo(DepositInfo{
+			CoinType:       d.coinType,
+			MDLAddress:     "mdladdr1",
+			DepositAddress: d.addr,
+			DepositID:      d.depositID,
+			DepositValue:   1e6,
+			ConversionRate: testMDLBtcRate,
+			Status:         StatusWaitSend,
+			BuyMethod:      config.BuyMethodDirect,
+			Timestamps: DepositTimestamps{
+				DetectedAt: d.detectedAt,
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	dpis, err := s.GetDepositInfoOfMDLAddress("mdladdr1")
+	require.NoError(t, err)
+	require.Len(t, dpis, 5)
+
+	for i, d := range deposits {
+		require.Equal(t, uint64(i), dpis[i].Seq)
+		require.Equal(t, d.coinType, dpis[i].CoinType)
+		require.Equal(t, d.depositID, dpis[i].DepositID)
+		require.Equal(t, d.detectedAt, dpis[i].Timestamps.DetectedAt)
+	}
+
+	// The SKY address has no deposit yet, it was bound after the deposits were detected
+	require.Equal(t, uint64(4), dpis[4].Seq)
+	require.Equal(t, scanner.CoinTypeSKY, dpis[4].CoinType)
+	require.Equal(t, "skyaddr1", dpis[4].DepositAddress)
+	require.Equal(t, StatusWaitDeposit, dpis[4].Status)
+}
+
 func TestStoreGetDepositInfoArray(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
@@ -867,12 +1232,14 @@ func TestStoreGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 	// Check the saved deposit info
 	foundDi, err := s.getDepositInfo(di.DepositID)
 	require.NoError(t, err)
-	// Seq and UpdatedAt should be set by addDepositInfo
+	// Seq, Version and UpdatedAt should be set by addDepositInfo
 	require.Equal(t, uint64(1), foundDi.Seq)
+	require.NotEmpty(t, foundDi.Version)
 	require.NotEmpty(t, foundDi.UpdatedAt)
 
 	// Other fields should be unchanged
 	di.Seq = foundDi.Seq
+	di.Version = foundDi.Version
 	di.UpdatedAt = foundDi.UpdatedAt
 	require.Equal(t, di, foundDi)
 
@@ -889,8 +1256,9 @@ func TestStoreGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 
 	differentRate := "112233"
 	require.NotEqual(t, differentRate, di.ConversionRate)
-	existsDi, err := s.GetOrCreateDepositInfo(dv, differentRate)
+	existsDi, created, err := s.GetOrCreateDepositInfo(dv, differentRate)
 	require.NoError(t, err)
+	require.False(t, created)
 
 	// di.Deposit won't be changed
 	require.Equal(t, di, existsDi)
@@ -925,12 +1293,14 @@ func TestStoreSkyGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 	// Check the saved deposit info
 	foundDi, err := s.getDepositInfo(di.DepositID)
 	require.NoError(t, err)
-	// Seq and UpdatedAt should be set by addDepositInfo
+	// Seq, Version and UpdatedAt should be set by addDepositInfo
 	require.Equal(t, uint64(1), foundDi.Seq)
+	require.NotEmpty(t, foundDi.Version)
 	require.NotEmpty(t, foundDi.UpdatedAt)
 
 	// Other fields should be unchanged
 	di.Seq = foundDi.Seq
+	di.Version = foundDi.Version
 	di.UpdatedAt = foundDi.UpdatedAt
 	require.Equal(t, di, foundDi)
 
@@ -947,7 +1317,7 @@ func TestStoreSkyGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 
 	differentRate := "112233"
 	require.NotEqual(t, differentRate, di.ConversionRate)
-	existsDi, err := s.GetOrCreateDepositInfo(dv, differentRate)
+	existsDi, _, err := s.GetOrCreateDepositInfo(dv, differentRate)
 	require.NoError(t, err)
 
 	// di.Deposit won't be changed
@@ -983,12 +1353,14 @@ func TestStoreWavesGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 	// Check the saved deposit info
 	foundDi, err := s.getDepositInfo(di.DepositID)
 	require.NoError(t, err)
-	// Seq and UpdatedAt should be set by addDepositInfo
+	// Seq, Version and UpdatedAt should be set by addDepositInfo
 	require.Equal(t, uint64(1), foundDi.Seq)
+	require.NotEmpty(t, foundDi.Version)
 	require.NotEmpty(t, foundDi.UpdatedAt)
 
 	// Other fields should be unchanged
 	di.Seq = foundDi.Seq
+	di.Version = foundDi.Version
 	di.UpdatedAt = foundDi.UpdatedAt
 	require.Equal(t, di, foundDi)
 
@@ -1005,7 +1377,7 @@ func TestStoreWavesGetOrCreateDepositInfoAlreadyExists(t *testing.T) {
 
 	differentRate := "112233"
 	require.NotEqual(t, differentRate, di.ConversionRate)
-	existsDi, err := s.GetOrCreateDepositInfo(dv, differentRate)
+	existsDi, _, err := s.GetOrCreateDepositInfo(dv, differentRate)
 	require.NoError(t, err)
 
 	// di.Deposit won't be changed
@@ -1022,7 +1394,7 @@ func TestStoreGetOrCreateDepositInfoNoBoundMDLAddr(t *testing.T) {
 	}
 
 	rate := "100"
-	_, err := s.GetOrCreateDepositInfo(dv, rate)
+	_, _, err := s.GetOrCreateDepositInfo(dv, rate)
 	require.Error(t, err)
 	require.Equal(t, err, ErrNoBoundAddress)
 
@@ -1031,7 +1403,7 @@ func TestStoreGetOrCreateDepositInfoNoBoundMDLAddr(t *testing.T) {
 		CoinType: scanner.CoinTypeSKY,
 	}
 
-	_, err = s.GetOrCreateDepositInfo(dv, rate)
+	_, _, err = s.GetOrCreateDepositInfo(dv, rate)
 	require.Error(t, err)
 	require.Equal(t, err, ErrNoBoundAddress)
 
@@ -1040,11 +1412,44 @@ func TestStoreGetOrCreateDepositInfoNoBoundMDLAddr(t *testing.T) {
 		CoinType: scanner.CoinTypeWAVES,
 	}
 
-	_, err = s.GetOrCreateDepositInfo(dv, rate)
+	_, _, err = s.GetOrCreateDepositInfo(dv, rate)
 	require.Error(t, err)
 	require.Equal(t, err, ErrNoBoundAddress)
 }
 
+func TestStoreGetOrCreateUnboundDepositInfo(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	dv := scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "foo-btc-addr",
+		Value:    1e8,
+		Height:   20,
+		Tx:       "foo-tx",
+		N:        2,
+	}
+
+	rate := "100"
+	di, created, err := s.GetOrCreateUnboundDepositInfo(dv, rate)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, StatusUnbound, di.Status)
+	require.Equal(t, uint64(1), di.Seq)
+	require.Equal(t, dv.ID(), di.DepositID)
+	require.Equal(t, dv.Address, di.DepositAddress)
+	require.Empty(t, di.MDLAddress)
+	require.Equal(t, ErrNoBoundAddress.Error(), di.Error)
+	require.Equal(t, rate, di.ConversionRate)
+	require.NotEmpty(t, di.Timestamps.DetectedAt)
+
+	// The existing deposit info is returned
+	existsDi, created, err := s.GetOrCreateUnboundDepositInfo(dv, "200")
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, di, existsDi)
+}
+
 func TestStoreGetMDLBindAddresses(t *testing.T) {
 	s, shutdown := newTestStore(t)
 	defer shutdown()
@@ -1065,6 +1470,8 @@ func TestStoreGetMDLBindAddresses(t *testing.T) {
 		MDLAddress: mdlAddr,
 		BuyMethod:  config.BuyMethodDirect,
 		CoinType:   scanner.CoinTypeBTC,
+		CreatedAt:  addrs[0].CreatedAt,
+		Version:    addrs[0].Version,
 	})
 
 	btcAddr2 := "btcaddr2"
@@ -1084,12 +1491,16 @@ func TestStoreGetMDLBindAddresses(t *testing.T) {
 		MDLAddress: mdlAddr,
 		BuyMethod:  config.BuyMethodDirect,
 		CoinType:   scanner.CoinTypeBTC,
+		CreatedAt:  addrs[0].CreatedAt,
+		Version:    addrs[0].Version,
 	})
 	require.Equal(t, addrs[1], BoundAddress{
 		Address:    btcAddr2,
 		MDLAddress: mdlAddr,
 		BuyMethod:  config.BuyMethodDirect,
 		CoinType:   scanner.CoinTypeBTC,
+		CreatedAt:  addrs[1].CreatedAt,
+		Version:    addrs[1].Version,
 	})
 
 	require.Equal(t, addrs[2], BoundAddress{
@@ -1097,6 +1508,8 @@ func TestStoreGetMDLBindAddresses(t *testing.T) {
 		MDLAddress: mdlAddr,
 		BuyMethod:  config.BuyMethodDirect,
 		CoinType:   scanner.CoinTypeSKY,
+		CreatedAt:  addrs[2].CreatedAt,
+		Version:    addrs[2].Version,
 	})
 
 	require.Equal(t, addrs[3], BoundAddress{
@@ -1104,6 +1517,303 @@ func TestStoreGetMDLBindAddresses(t *testing.T) {
 		MDLAddress: mdlAddr,
 		BuyMethod:  config.BuyMethodDirect,
 		CoinType:   scanner.CoinTypeWAVES,
+		CreatedAt:  addrs[3].CreatedAt,
+		Version:    addrs[3].Version,
+	})
+
+}
+
+func TestStoreSendsPaused(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	paused, err := s.GetSendsPaused()
+	require.NoError(t, err)
+	require.False(t, paused)
+
+	err = s.SetSendsPaused(true)
+	require.NoError(t, err)
+
+	paused, err = s.GetSendsPaused()
+	require.NoError(t, err)
+	require.True(t, paused)
+
+	err = s.SetSendsPaused(false)
+	require.NoError(t, err)
+
+	paused, err = s.GetSendsPaused()
+	require.NoError(t, err)
+	require.False(t, paused)
+}
+
+func TestStoreMigrateOldSchema(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	// Write records the way a db without a schema version stored them,
+	// before DepositInfo.Reference and DepositInfo.Timestamps existed
+	boundAddr := BoundAddress{
+		MDLAddress: "a1",
+		Address:    "b1",
+		CoinType:   scanner.CoinTypeBTC,
+		BuyMethod:  config.BuyMethodDirect,
+		Reference:  "order-1",
+		CreatedAt:  1500000000,
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, bkt := range [][]byte{DepositInfoBkt, MustGetBindAddressBkt(scanner.CoinTypeBTC)} {
+			if _, err := tx.CreateBucketIfNotExists(bkt); err != nil {
+				return err
+			}
+		}
+
+		if err := dbutil.PutBucketValue(tx, MustGetBindAddressBkt(scanner.CoinTypeBTC), "b1", boundAddr); err != nil {
+			return err
+		}
+
+		// A record saved by a store with compression enabled
+		if err := dbutil.PutBucketCompressedValue(tx, DepositInfoBkt, "t1:0", DepositInfo{
+			DepositID:      "t1:0",
+			DepositAddress: "b1",
+			MDLAddress:     "a1",
+			CoinType:       scanner.CoinTypeBTC,
+			Status:         StatusDone,
+		}); err != nil {
+			return err
+		}
+
+		for _, di := range []DepositInfo{
+			{
+				DepositID:      "t3:0",
+				DepositAddress: "b1",
+				MDLAddress:     "a1",
+				CoinType:       scanner.CoinTypeBTC,
+				Status:         StatusDone,
+			},
+			{
+				// No binding to copy from, left unchanged
+				DepositID:      "t2:0",
+				DepositAddress: "b2",
+				MDLAddress:     "a2",
+				CoinType:       scanner.CoinTypeBTC,
+				Status:         StatusDone,
+			},
+		} {
+			if err := dbutil.PutBucketValue(tx, DepositInfoBkt, di.DepositID, di); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	s, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	di, err := s.getDepositInfo("t1:0")
+	require.NoError(t, err)
+	require.Equal(t, "order-1", di.Reference)
+	require.Equal(t, int64(1500000000), di.Timestamps.BoundAt)
+	require.Equal(t, StatusDone, di.Status)
+
+	di, err = s.getDepositInfo("t3:0")
+	require.NoError(t, err)
+	require.Equal(t, "order-1", di.Reference)
+	require.Equal(t, int64(1500000000), di.Timestamps.BoundAt)
+
+	di, err = s.getDepositInfo("t2:0")
+	require.NoError(t, err)
+	require.Empty(t, di.Reference)
+	require.Equal(t, int64(0), di.Timestamps.BoundAt)
+
+	// The backfilled records are saved compressed only if they were
+	err = db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(DepositInfoBkt)
+		require.True(t, dbutil.IsCompressed(bkt.Get([]byte("t1:0"))))
+		require.False(t, dbutil.IsCompressed(bkt.Get([]byte("t3:0"))))
+		return nil
 	})
+	require.NoError(t, err)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		version, err := dbutil.GetSchemaVersion(tx, schemaComponent)
+		require.NoError(t, err)
+		require.Equal(t, len(migrations), version)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Opening the migrated db again is a no-op
+	_, err = NewStore(log, db)
+	require.NoError(t, err)
+}
 
+func TestStoreRejectsNewerSchema(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(dbutil.SchemaVersionsBkt); err != nil {
+			return err
+		}
+		return dbutil.PutBucketValue(tx, dbutil.SchemaVersionsBkt, schemaComponent, fmt.Sprint(len(migrations)+1))
+	})
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+	_, err = NewStore(log, db)
+	require.Equal(t, dbutil.SchemaTooNewErr{
+		Component: schemaComponent,
+		Version:   len(migrations) + 1,
+		Supported: len(migrations),
+	}, err)
+}
+
+func TestStoreCompression(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	bkts := [][]byte{
+		DepositInfoBkt,
+		MDLDepositSeqsIndexBkt,
+		MustGetBindAddressBkt(scanner.CoinTypeBTC),
+	}
+
+	// countCompressed returns the number of compressed and uncompressed values in bkts
+	countCompressed := func() (int, int) {
+		var compressed, uncompressed int
+		err := s.db.View(func(tx *bolt.Tx) error {
+			for _, bkt := range bkts {
+				if err := dbutil.ForEach(tx, bkt, func(k, v []byte) error {
+					if dbutil.IsCompressed(v) {
+						compressed++
+					} else {
+						uncompressed++
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return compressed, uncompressed
+	}
+
+	// Records saved uncompressed
+	_, err := s.BindAddress(context.Background(), "a1", "b1", scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{Reference: "order-1"})
+	require.NoError(t, err)
+	_, _, err = s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "b1",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "t1",
+		N:        1,
+	}, testMDLBtcRate)
+	require.NoError(t, err)
+
+	compressed, uncompressed := countCompressed()
+	require.Equal(t, 0, compressed)
+	require.Equal(t, 3, uncompressed)
+
+	before, err := s.Export()
+	require.NoError(t, err)
+
+	// Enabling compression compresses the existing records, which read back identically
+	require.NoError(t, s.EnableCompression())
+
+	compressed, uncompressed = countCompressed()
+	require.Equal(t, 3, compressed)
+	require.Equal(t, 0, uncompressed)
+
+	after, err := s.Export()
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+
+	// Records saved with compression enabled read back like uncompressed records
+	_, err = s.BindAddress(context.Background(), "a1", "b2", scanner.CoinTypeBTC, config.BuyMethodDirect, BindOptions{})
+	require.NoError(t, err)
+	di, _, err := s.GetOrCreateDepositInfo(scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "b2",
+		Value:    2e6,
+		Height:   21,
+		Tx:       "t2",
+		N:        0,
+	}, testMDLBtcRate)
+	require.NoError(t, err)
+
+	compressed, uncompressed = countCompressed()
+	require.Equal(t, 5, compressed)
+	require.Equal(t, 0, uncompressed)
+
+	di2, err := s.getDepositInfo(di.DepositID)
+	require.NoError(t, err)
+	require.Equal(t, di, di2)
+
+	boundAddrs, err := s.GetMDLBindAddresses("a1")
+	require.NoError(t, err)
+	require.Len(t, boundAddrs, 2)
+
+	// With compression disabled again, new records are saved uncompressed, and all records are still read
+	s.compress = false
+	di, err = s.UpdateDepositInfo(di.DepositID, func(di DepositInfo) DepositInfo {
+		di.Status = StatusWaitSend
+		return di
+	})
+	require.NoError(t, err)
+
+	compressed, uncompressed = countCompressed()
+	require.Equal(t, 4, compressed)
+	require.Equal(t, 1, uncompressed)
+
+	dis, err := s.GetDepositInfoOfMDLAddress("a1")
+	require.NoError(t, err)
+	require.Len(t, dis, 2)
+
+	for _, d := range dis {
+		if d.DepositID == di.DepositID {
+			require.Equal(t, di, d)
+		}
+	}
+}
+
+func TestStoreContactOptOut(t *testing.T) {
+	s, shutdown := newTestStore(t)
+	defer shutdown()
+
+	optedOut, err := s.IsContactEmailOptedOut("user@example.com")
+	require.NoError(t, err)
+	require.False(t, optedOut)
+
+	err = s.OptOutContactEmail("User@Example.com", 1000)
+	require.NoError(t, err)
+
+	// Compared case-insensitively
+	for _, email := range []string{"user@example.com", "USER@EXAMPLE.COM", "User@Example.com"} {
+		optedOut, err = s.IsContactEmailOptedOut(email)
+		require.NoError(t, err)
+		require.True(t, optedOut, email)
+	}
+
+	optedOut, err = s.IsContactEmailOptedOut("other@example.com")
+	require.NoError(t, err)
+	require.False(t, optedOut)
+
+	// Opting out again keeps the first time
+	err = s.OptOutContactEmail("user@example.com", 2000)
+	require.NoError(t, err)
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		optOuts, err := getContactOptOutsTx(tx)
+		require.NoError(t, err)
+		require.Equal(t, map[string]int64{"user@example.com": 1000}, optOuts)
+		return nil
+	})
+	require.NoError(t, err)
 }
@@ -0,0 +1,17 @@
+package i18n
+
+var en = Bundle{
+	Coins: map[string]string{
+		"Bitcoin":              "Bitcoin",
+		"Ethereum":             "Ethereum",
+		"Skycoin":              "Skycoin",
+		"Waves (Experimental)": "Waves (Experimental)",
+		"MDL.life - pre-MDL token on Waves (Testing)": "MDL.life - pre-MDL token on Waves (Testing)",
+	},
+	Statuses: map[string]string{
+		"waiting_deposit": "[tx-{id} {updated}] Waiting for deposit.",
+		"waiting_send":    "[tx-{id} {updated}] Deposit confirmed. Transaction is queued.",
+		"waiting_confirm": "[tx-{id} {updated}] MDL transaction sent.  Waiting to confirm.",
+		"done":            "[tx-{id} {updated}] Completed. Check your MDL wallet.",
+	},
+}
@@ -0,0 +1,81 @@
+// Package i18n bundles the translations of coin labels and deposit status messages served to the frontend
+package i18n
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultLang is the language used when a requested language or translation is not bundled
+const DefaultLang = "en"
+
+// Bundle is the translations of one language
+type Bundle struct {
+	// Coins maps the label of a supported coin, as configured by the mdl_*_exchange_label options, to its translation
+	Coins map[string]string `json:"coins"`
+	// Statuses maps a deposit status to its status message. {id} and {updated} are
+	// replaced by the frontend with the deposit's seq and update time
+	Statuses map[string]string `json:"statuses"`
+}
+
+var bundles = map[string]Bundle{
+	"en": en,
+	"ru": ru,
+	"zh": zh,
+}
+
+// Langs returns the bundled languages
+func Langs() []string {
+	langs := make([]string, 0, len(bundles))
+	for l := range bundles {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// NormalizeLang converts a language tag such as "ru-RU" to a bundled language.
+// If no bundle exists for the language, DefaultLang is returned.
+func NormalizeLang(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+
+	if _, ok := bundles[lang]; !ok {
+		return DefaultLang
+	}
+
+	return lang
+}
+
+// Lookup returns the bundle of a language, and the bundled language that was used.
+// Strings missing from the language's bundle fall back to DefaultLang.
+func Lookup(lang string) (string, Bundle) {
+	lang = NormalizeLang(lang)
+
+	b := Bundle{
+		Coins:    make(map[string]string),
+		Statuses: make(map[string]string),
+	}
+
+	for _, l := range []string{DefaultLang, lang} {
+		for k, v := range bundles[l].Coins {
+			b.Coins[k] = v
+		}
+		for k, v := range bundles[l].Statuses {
+			b.Statuses[k] = v
+		}
+	}
+
+	return lang, b
+}
+
+// CoinLabel returns the translation of a coin label in b.
+// Labels without a translation are returned unchanged.
+func (b Bundle) CoinLabel(label string) string {
+	if v, ok := b.Coins[label]; ok {
+		return v
+	}
+	return label
+}
@@ -0,0 +1,67 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeLang(t *testing.T) {
+	tt := []struct {
+		lang   string
+		expect string
+	}{
+		{"", DefaultLang},
+		{"en", "en"},
+		{"ru", "ru"},
+		{"RU", "ru"},
+		{"ru-RU", "ru"},
+		{"zh_CN", "zh"},
+		{"fr", DefaultLang},
+		{"xx-YY", DefaultLang},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.lang, func(t *testing.T) {
+			require.Equal(t, tc.expect, NormalizeLang(tc.lang))
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	lang, b := Lookup("ru")
+	require.Equal(t, "ru", lang)
+	require.Equal(t, "Биткоин", b.CoinLabel("Bitcoin"))
+	require.Equal(t, ru.Statuses["done"], b.Statuses["done"])
+
+	// Unsupported languages fall back to English
+	lang, b = Lookup("fr")
+	require.Equal(t, DefaultLang, lang)
+	require.Equal(t, en.Coins, b.Coins)
+	require.Equal(t, en.Statuses, b.Statuses)
+
+	// Strings missing from a bundle fall back to English
+	_, ok := zh.Coins["MDL.life - pre-MDL token on Waves (Testing)"]
+	require.False(t, ok)
+	lang, b = Lookup("zh")
+	require.Equal(t, "zh", lang)
+	require.Equal(t, "比特币", b.CoinLabel("Bitcoin"))
+	require.Equal(t, "MDL.life - pre-MDL token on Waves (Testing)", b.CoinLabel("MDL.life - pre-MDL token on Waves (Testing)"))
+
+	// Labels without any translation are returned unchanged
+	require.Equal(t, "Dogecoin", b.CoinLabel("Dogecoin"))
+}
+
+func TestBundlesComplete(t *testing.T) {
+	// Every bundle translates only strings that exist in the English bundle
+	for _, lang := range Langs() {
+		for k := range bundles[lang].Coins {
+			_, ok := en.Coins[k]
+			require.True(t, ok, "%s coin label %q is not in the %s bundle", lang, k, DefaultLang)
+		}
+		for k := range bundles[lang].Statuses {
+			_, ok := en.Statuses[k]
+			require.True(t, ok, "%s status %q is not in the %s bundle", lang, k, DefaultLang)
+		}
+	}
+}
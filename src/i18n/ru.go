@@ -0,0 +1,17 @@
+package i18n
+
+var ru = Bundle{
+	Coins: map[string]string{
+		"Bitcoin":              "Биткоин",
+		"Ethereum":             "Эфириум",
+		"Skycoin":              "Скайкоин",
+		"Waves (Experimental)": "Waves (Экспериментально)",
+		"MDL.life - pre-MDL token on Waves (Testing)": "MDL.life - pre-MDL токен на Waves (Тестирование)",
+	},
+	Statuses: map[string]string{
+		"waiting_deposit": "[tx-{id} {updated}] Ожидаем депозит.",
+		"waiting_send":    "[tx-{id} {updated}] Депозит подтверждён. MDL транзакция поставлена в очередь.",
+		"waiting_confirm": "[tx-{id} {updated}] MDL транзакция отправлена. Ожидаем подтверждение.",
+		"done":            "[tx-{id} {updated}] Завершена. Проверьте ваш MDL кошелёк.",
+	},
+}
@@ -0,0 +1,16 @@
+package i18n
+
+var zh = Bundle{
+	Coins: map[string]string{
+		"Bitcoin":              "比特币",
+		"Ethereum":             "以太坊",
+		"Skycoin":              "天空币",
+		"Waves (Experimental)": "Waves (实验)",
+	},
+	Statuses: map[string]string{
+		"done":            "交易 {id}: MDL已经发送并确认(更新于{updated}).",
+		"waiting_deposit": "交易 {id}: 等待存入(更新于 {updated}).",
+		"waiting_send":    "交易 {id}: 存入已确认; MDL发送在队列中 (更新于 {updated}).",
+		"waiting_confirm": "交易 {id}: MDL已发送,等待交易确认 (更新于 {updated}).",
+	},
+}
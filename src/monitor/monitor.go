@@ -4,14 +4,21 @@ package monitor
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/MDLlife/teller/src/exchange"
+	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/sweep"
 	"github.com/MDLlife/teller/src/util/httputil"
 	"github.com/MDLlife/teller/src/util/logger"
 	"github.com/MDLlife/teller/src/util/mathutil"
@@ -29,6 +36,9 @@ const (
 	serverIdleTimeout  = time.Second * 120
 
 	cryptocompareFrequency = time.Minute * 5
+
+	// How often the scanners of retired coin types are checked to be stopped
+	retireCheckPeriod = time.Minute
 	//ethApiFrequency        = time.Minute * 5
 	//ethApiUrl              = "https://api.etherscan.io/api?module=account&action=balance&address=0x930E227b4E46412BB33717e480c3fbd3e0ce325c&tag=latest"
 )
@@ -49,6 +59,54 @@ type ScanAddressGetter interface {
 	GetScanAddresses() ([]string, error)
 }
 
+// Sweeper sweeps the confirmed deposits of a coin to a cold wallet address
+type Sweeper interface {
+	Sweep() (*sweep.Result, error)
+}
+
+// ScanController pauses a coin's scanner and changes the height it scans from
+type ScanController interface {
+	Pause()
+	Resume()
+	Paused() bool
+	StoredScanHeight() (int64, error)
+	SetStoredScanHeight(int64) (int64, error)
+}
+
+// BlockReplayer replays a block of a coin's blockchain through the deposit matching, without recording deposits
+type BlockReplayer interface {
+	ScanSingleBlock(height int64) (*scanner.BlockReplay, error)
+}
+
+// PendingDepositLister lists the deposits a coin's scanner holds back until they have enough confirmations
+type PendingDepositLister interface {
+	PendingDeposits() []scanner.PendingDeposit
+}
+
+// SendPauser pauses and resumes sending coins for all coin types
+type SendPauser interface {
+	SendsPaused() bool
+	SetSendsPaused(bool) error
+}
+
+// CoinDeprecator deprecates coin types, see exchange.Exchange.DeprecateCoin
+type CoinDeprecator interface {
+	DeprecateCoin(coinType string) (*exchange.CoinDeprecation, error)
+	RestoreCoin(coinType string) error
+	GetCoinDeprecations() (map[string]exchange.CoinDeprecation, error)
+}
+
+// DepositImporter records deposits the scanners missed, see exchange.Exchange.ImportDeposit
+type DepositImporter interface {
+	ImportDeposit(dv scanner.Deposit) (*exchange.DepositInfo, error)
+}
+
+// BalanceReporter reports the last comparison of the deposit address balances to the recorded deposits,
+// see scanner.BalanceReconciler
+type BalanceReporter interface {
+	Report() *scanner.BalanceReport
+}
+
 // WebReadyStats deposit struct for api
 type WebReadyStats struct {
 	TotalBTCReceived      string `json:"btc"`
@@ -93,7 +151,7 @@ var ethAPIValue = decimal.New(0, 0)
 
 // Config configuration info for monitor service
 type Config struct {
-	Addr             string
+	Addrs            []string // Addresses the admin panel listens on. The admin panel is disabled if empty
 	FixBtcValue      int64
 	FixEthValue      int64
 	FixSkyValue      int64
@@ -102,6 +160,9 @@ type Config struct {
 	FixMdlValue      int64
 	FixUsdValue      decimal.Decimal
 	FixTxValue       int64
+	AllowedIPs       []*net.IPNet // Requests from other sources are rejected. All sources are allowed if empty
+	BehindProxy      bool         // Read the source IP from the X-Forwarded-For or X-Real-IP header
+	AuthToken        string       // Bearer token of the endpoints that change state, which are refused if empty
 }
 
 // Monitor monitor service struct
@@ -114,9 +175,35 @@ type Monitor struct {
 	WavesMDLAddrManager AddrManager
 	DepositStatusGetter
 	ScanAddressGetter
-	cfg  Config
-	ln   *http.Server
-	quit chan struct{}
+
+	// Sweepers maps coin types to the Sweeper of their deposits, for the coins that have a cold address configured
+	Sweepers map[string]Sweeper
+
+	// Scanners maps coin types to the ScanController of their scanner, for the coins that are scanned
+	Scanners map[string]ScanController
+
+	// BlockReplayers maps coin types to the BlockReplayer of their scanner, for the coins that are scanned
+	BlockReplayers map[string]BlockReplayer
+
+	// Pending maps coin types to the PendingDepositLister of their scanner, for the coins that are scanned
+	Pending map[string]PendingDepositLister
+
+	// Sends pauses and resumes the exchange's sending of coins
+	Sends SendPauser
+
+	// Deprecations deprecates coin types. The scanners of retired coin types are paused
+	Deprecations CoinDeprecator
+
+	// Imports records deposits the scanners missed
+	Imports DepositImporter
+
+	// Balances reports the deposit addresses whose balance exceeds their recorded deposits
+	Balances BalanceReporter
+
+	cfg    Config
+	lnLock sync.Mutex
+	lns    []*http.Server // one per address of cfg.Addrs
+	quit   chan struct{}
 }
 
 // New creates monitor service
@@ -137,24 +224,65 @@ func New(log logrus.FieldLogger, cfg Config, addrManager, ethAddrManager AddrMan
 
 // Run starts the monitor service
 func (m *Monitor) Run() error {
-	log := m.log.WithField("config", m.cfg)
+	cfg := m.cfg
+	if cfg.AuthToken != "" {
+		cfg.AuthToken = "<redacted>"
+	}
+	log := m.log.WithField("config", cfg)
 	log.Info("Start monitor service...")
 	defer log.Info("Monitor Service closed")
 
 	mux := m.setupMux()
 
-	m.ln = &http.Server{
-		Addr:         m.cfg.Addr,
-		Handler:      mux,
-		ReadTimeout:  serverReadTimeout,
-		WriteTimeout: serverWriteTimeout,
-		IdleTimeout:  serverIdleTimeout,
+	if m.Deprecations != nil {
+		go m.runRetirements()
 	}
 
-	if err := m.ln.ListenAndServe(); err != nil {
+	if len(m.cfg.Addrs) == 0 {
+		log.Info("Admin panel is disabled, no address to listen on")
+		<-m.quit
+		return nil
+	}
+
+	if m.cfg.AuthToken == "" {
+		log.Warn("admin_panel.auth_token is not set, the admin panel endpoints that change state are disabled")
+	}
+
+	handler := m.allowedIPsHandler(mux)
+
+	m.lnLock.Lock()
+	select {
+	case <-m.quit:
+		m.lnLock.Unlock()
+		return nil
+	default:
+	}
+	for _, addr := range m.cfg.Addrs {
+		m.lns = append(m.lns, &http.Server{
+			Addr:         addr,
+			Handler:      handler,
+			ReadTimeout:  serverReadTimeout,
+			WriteTimeout: serverWriteTimeout,
+			IdleTimeout:  serverIdleTimeout,
+		})
+	}
+	lns := m.lns
+	m.lnLock.Unlock()
+
+	errC := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func(ln *http.Server) {
+			log.WithField("addr", ln.Addr).Info("Admin panel listening")
+			errC <- ln.ListenAndServe()
+		}(ln)
+	}
+
+	// Every listener returns an error once it is shut down. Any other error,
+	// e.g. an address already in use, stops the service
+	for range lns {
+		err := <-errC
 		select {
 		case <-m.quit:
-			return nil
 		default:
 			return err
 		}
@@ -170,21 +298,94 @@ func (m *Monitor) setupMux() *http.ServeMux {
 	mux.Handle("/api/stats", httputil.LogHandler(m.log, m.statsHandler()))
 	mux.Handle("/api/web-stats", httputil.LogHandler(m.log, m.webStatsHandler()))
 	mux.Handle("/api/eth-total-stats", httputil.LogHandler(m.log, m.ethTotalStatsHandler()))
+	mux.Handle("/api/sweep", httputil.LogHandler(m.log, m.authHandler(m.sweepHandler())))
+	mux.Handle("/api/scan-height", httputil.LogHandler(m.log, m.authHandler(m.scanHeightHandler())))
+	mux.Handle("/api/scan-pause", httputil.LogHandler(m.log, m.authHandler(m.scanPauseHandler(true))))
+	mux.Handle("/api/scan-resume", httputil.LogHandler(m.log, m.authHandler(m.scanPauseHandler(false))))
+	mux.Handle("/api/scan-replay", httputil.LogHandler(m.log, m.scanReplayHandler()))
+	mux.Handle("/api/pending-deposits", httputil.LogHandler(m.log, m.pendingDepositsHandler()))
+	mux.Handle("/api/sends-paused", httputil.LogHandler(m.log, m.sendsPausedHandler()))
+	mux.Handle("/api/send-pause", httputil.LogHandler(m.log, m.authHandler(m.sendPauseHandler(true))))
+	mux.Handle("/api/send-resume", httputil.LogHandler(m.log, m.authHandler(m.sendPauseHandler(false))))
+	mux.Handle("/api/coin-deprecations", httputil.LogHandler(m.log, m.coinDeprecationsHandler()))
+	mux.Handle("/api/coin-deprecate", httputil.LogHandler(m.log, m.authHandler(m.coinDeprecateHandler())))
+	mux.Handle("/api/coin-restore", httputil.LogHandler(m.log, m.authHandler(m.coinRestoreHandler())))
+	mux.Handle("/api/deposit-import", httputil.LogHandler(m.log, m.authHandler(m.depositImportHandler())))
+	mux.Handle("/api/balance-reconciliation", httputil.LogHandler(m.log, m.balanceReconciliationHandler()))
 	return mux
 }
 
+// authHandler responds with 401 Unauthorized to requests without cfg.AuthToken as a bearer token,
+// or with 403 Forbidden to all requests if cfg.AuthToken is empty.
+// Browsers don't send an Authorization header cross-site without a CORS preflight, which the admin panel
+// never allows, so the endpoints behind it can't be called by a page the operator has open
+func (m *Monitor) authHandler(hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.cfg.AuthToken == "" {
+			httputil.ErrResponse(w, http.StatusForbidden, "admin_panel.auth_token is not set")
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(m.cfg.AuthToken)) != 1 {
+			m.log.WithFields(logrus.Fields{
+				"remoteIP": httputil.RemoteIP(r, m.cfg.BehindProxy),
+				"url":      r.URL.String(),
+			}).Warn("Rejected admin panel request without a valid admin_panel.auth_token")
+			httputil.ErrResponse(w, http.StatusUnauthorized)
+			return
+		}
+
+		hd.ServeHTTP(w, r)
+	})
+}
+
+// allowedIPsHandler responds with 403 Forbidden to requests whose source IP is not in cfg.AllowedIPs.
+// If cfg.AllowedIPs is empty, hd is returned unchanged
+func (m *Monitor) allowedIPsHandler(hd http.Handler) http.Handler {
+	if len(m.cfg.AllowedIPs) == 0 {
+		return hd
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteIP := httputil.RemoteIP(r, m.cfg.BehindProxy)
+
+		if ip := net.ParseIP(remoteIP); ip != nil {
+			for _, n := range m.cfg.AllowedIPs {
+				if n.Contains(ip) {
+					hd.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		m.log.WithFields(logrus.Fields{
+			"remoteIP": remoteIP,
+			"url":      r.URL.String(),
+		}).Warn("Rejected admin panel request from a source not in admin_panel.allowed_ips")
+		httputil.ErrResponse(w, http.StatusForbidden)
+	})
+}
+
 // Shutdown close the monitor service
 func (m *Monitor) Shutdown() {
 	log := m.log.WithField("timeout", shutdownTimeout)
 	defer log.Info("Shutdown monitor service")
 
+	m.lnLock.Lock()
+	defer m.lnLock.Unlock()
+
 	close(m.quit)
-	if m.ln != nil {
-		log.Info("Shutting down monitor service")
-		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-		defer cancel()
-		if err := m.ln.Shutdown(ctx); err != nil {
-			log.WithError(err).Error("Monitor service shutdown failed")
+	if len(m.lns) == 0 {
+		return
+	}
+
+	log.Info("Shutting down monitor service")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, ln := range m.lns {
+		if err := ln.Shutdown(ctx); err != nil {
+			log.WithError(err).WithField("addr", ln.Addr).Error("Monitor service shutdown failed")
 		}
 	}
 }
@@ -231,7 +432,7 @@ func (m *Monitor) addressHandler() http.HandlerFunc {
 // Method: GET
 // URI: /api/deposit_status
 // Args:
-//     - status # available value("waiting_deposit", "waiting_send", "waiting_confirm", "done")
+//     - status # available value("waiting_deposit", "waiting_send", "waiting_confirm", "done", "waiting_review")
 func (m *Monitor) depositStatus() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -314,6 +515,332 @@ func (m *Monitor) statsHandler() http.HandlerFunc {
 	}
 }
 
+// sweepHandler sends the confirmed deposits of a coin to its cold wallet address
+// Method: POST
+// URI: /api/sweep
+// Args:
+//     - coin_type # the coin type to sweep, only BTC is supported
+func (m *Monitor) sweepHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		coinType := r.FormValue("coin_type")
+		s, ok := m.Sweepers[coinType]
+		if !ok {
+			err := fmt.Sprintf("sweeping is not configured for coin type %q", coinType)
+			httputil.ErrResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		log = log.WithField("coinType", coinType)
+
+		res, err := s.Sweep()
+		switch err {
+		case nil:
+		case sweep.ErrNothingToSweep:
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		default:
+			log.WithError(err).Error("Sweep failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, res); err != nil {
+			log.WithError(err).Error("Write json response failed")
+			return
+		}
+	}
+}
+
+type scanHeightResponse struct {
+	CoinType           string `json:"coin_type"`
+	ScanHeight         int64  `json:"scan_height"`
+	Paused             bool   `json:"paused"`
+	PreviousScanHeight *int64 `json:"previous_scan_height,omitempty"`
+	Warning            string `json:"warning,omitempty"`
+}
+
+// scanController returns the ScanController of the coin_type request arg.
+// If there is none, an error response is written and false is returned
+func (m *Monitor) scanController(w http.ResponseWriter, r *http.Request) (string, ScanController, bool) {
+	coinType := r.FormValue("coin_type")
+	sc, ok := m.Scanners[coinType]
+	if !ok {
+		err := fmt.Sprintf("coin type %q is not scanned", coinType)
+		httputil.ErrResponse(w, http.StatusBadRequest, err)
+		return "", nil, false
+	}
+
+	return coinType, sc, true
+}
+
+// scanHeightHandler returns or changes the height a coin's scanner scans from.
+// Scanning resumes from the block at the scan height, which is scanned again.
+// The scan height can only be changed while the scanner is paused, see /api/scan-pause.
+// Moving the scan height backward scans the blocks again, deposits already recorded are not sent again.
+// Method: GET, POST
+// URI: /api/scan-height
+// Args:
+//     - coin_type # the coin type of the scanner
+//     - height # [POST] the new scan height
+func (m *Monitor) scanHeightHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", fmt.Sprintf("%s, %s", http.MethodGet, http.MethodPost))
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		coinType, sc, ok := m.scanController(w, r)
+		if !ok {
+			return
+		}
+
+		log = log.WithField("coinType", coinType)
+
+		if r.Method == http.MethodGet {
+			height, err := sc.StoredScanHeight()
+			if err != nil {
+				log.WithError(err).Error("StoredScanHeight failed")
+				httputil.ErrResponse(w, http.StatusInternalServerError)
+				return
+			}
+
+			if err := httputil.JSONResponse(w, scanHeightResponse{
+				CoinType:   coinType,
+				ScanHeight: height,
+				Paused:     sc.Paused(),
+			}); err != nil {
+				log.WithError(err).Error("Write json response failed")
+			}
+			return
+		}
+
+		height, err := strconv.ParseInt(r.FormValue("height"), 10, 64)
+		if err != nil || height < 0 {
+			httputil.ErrResponse(w, http.StatusBadRequest, "height must be a non-negative integer")
+			return
+		}
+
+		prevHeight, err := sc.SetStoredScanHeight(height)
+		switch err {
+		case nil:
+		case scanner.ErrScannerNotPaused:
+			httputil.ErrResponse(w, http.StatusConflict, err.Error())
+			return
+		default:
+			log.WithError(err).Error("SetStoredScanHeight failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		resp := scanHeightResponse{
+			CoinType:           coinType,
+			ScanHeight:         height,
+			Paused:             sc.Paused(),
+			PreviousScanHeight: &prevHeight,
+		}
+
+		log = log.WithFields(logrus.Fields{
+			"scanHeight":         height,
+			"previousScanHeight": prevHeight,
+		})
+
+		if height < prevHeight {
+			resp.Warning = fmt.Sprintf("The scan height moved backward by %d blocks, these blocks will be scanned again", prevHeight-height)
+			log.Warn("Scan height moved backward by an admin")
+		} else {
+			log.Info("Scan height changed by an admin")
+		}
+
+		if err := httputil.JSONResponse(w, resp); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// scanReplayHandler fetches one block and runs it through the deposit matching of the coin's scanner,
+// to debug why a deposit was missed. Every output compared to the scan addresses is logged at debug level.
+// Nothing is recorded and no deposit is sent to the exchange
+// Method: GET
+// URI: /api/scan-replay
+// Args:
+//     - coin_type # the coin type of the scanner
+//     - height # the height of the block to replay
+func (m *Monitor) scanReplayHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		coinType := r.FormValue("coin_type")
+		br, ok := m.BlockReplayers[coinType]
+		if !ok {
+			err := fmt.Sprintf("coin type %q is not scanned", coinType)
+			httputil.ErrResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		height, err := strconv.ParseInt(r.FormValue("height"), 10, 64)
+		if err != nil || height < 0 {
+			httputil.ErrResponse(w, http.StatusBadRequest, "height must be a non-negative integer")
+			return
+		}
+
+		log = log.WithFields(logrus.Fields{
+			"coinType": coinType,
+			"height":   height,
+		})
+
+		replay, err := br.ScanSingleBlock(height)
+		if err != nil {
+			log.WithError(err).Error("ScanSingleBlock failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err := httputil.JSONResponse(w, replay); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// scanPauseHandler pauses or resumes a coin's scanner
+// Method: POST
+// URI: /api/scan-pause, /api/scan-resume
+// Args:
+//     - coin_type # the coin type of the scanner
+func (m *Monitor) scanPauseHandler(pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		coinType, sc, ok := m.scanController(w, r)
+		if !ok {
+			return
+		}
+
+		log = log.WithField("coinType", coinType)
+
+		if pause {
+			sc.Pause()
+			log.Warn("Scanner paused by an admin")
+		} else {
+			sc.Resume()
+			log.Info("Scanner resumed by an admin")
+		}
+
+		height, err := sc.StoredScanHeight()
+		if err != nil {
+			log.WithError(err).Error("StoredScanHeight failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, scanHeightResponse{
+			CoinType:   coinType,
+			ScanHeight: height,
+			Paused:     sc.Paused(),
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+type sendsPausedResponse struct {
+	SendsPaused bool `json:"sends_paused"`
+}
+
+// sendsPausedHandler returns whether sending coins is paused
+// Method: GET
+// URI: /api/sends-paused
+func (m *Monitor) sendsPausedHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if m.Sends == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "sending is not available")
+			return
+		}
+
+		if err := httputil.JSONResponse(w, sendsPausedResponse{
+			SendsPaused: m.Sends.SendsPaused(),
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// sendPauseHandler pauses or resumes sending coins for all coin types.
+// While paused, confirmed deposits are queued, and they are sent once resumed.
+// The setting persists across restarts
+// Method: POST
+// URI: /api/send-pause, /api/send-resume
+func (m *Monitor) sendPauseHandler(pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if m.Sends == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "sending is not available")
+			return
+		}
+
+		if err := m.Sends.SetSendsPaused(pause); err != nil {
+			log.WithError(err).Error("SetSendsPaused failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if pause {
+			log.Warn("Sends paused by an admin")
+		} else {
+			log.Info("Sends resumed by an admin")
+		}
+
+		if err := httputil.JSONResponse(w, sendsPausedResponse{
+			SendsPaused: m.Sends.SendsPaused(),
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
 var updateEthToUSDCourse = func(log logrus.FieldLogger) {
 	if cryptocompareUpdateTime.After(time.Now().Add(-cryptocompareFrequency)) {
 		return
@@ -476,3 +1003,397 @@ func (m *Monitor) ethTotalStatsHandler() http.HandlerFunc {
 		}
 	}
 }
+
+// runRetirements pauses the scanners of retired coin types, every retireCheckPeriod until shutdown
+func (m *Monitor) runRetirements() {
+	ticker := time.NewTicker(retireCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		if err := m.pauseRetiredScanners(); err != nil {
+			m.log.WithError(err).Error("pauseRetiredScanners failed")
+		}
+
+		select {
+		case <-m.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pauseRetiredScanners pauses the scanners of the coin types whose deprecation window has passed.
+// The deposits already scanned are still processed
+func (m *Monitor) pauseRetiredScanners() error {
+	deprecations, err := m.Deprecations.GetCoinDeprecations()
+	if err != nil {
+		return err
+	}
+
+	for coinType, d := range deprecations {
+		if d.Stage != exchange.CoinStageRetired {
+			continue
+		}
+
+		sc, ok := m.Scanners[coinType]
+		if !ok || sc.Paused() {
+			continue
+		}
+
+		sc.Pause()
+		m.log.WithField("coinDeprecation", d).Warn("Scanner of retired coin type paused")
+	}
+
+	return nil
+}
+
+type coinDeprecationsResponse struct {
+	Deprecations map[string]exchange.CoinDeprecation `json:"deprecations"`
+}
+
+// coinDeprecationsHandler returns the deprecation states of the deprecated coin types
+// Method: GET
+// URI: /api/coin-deprecations
+func (m *Monitor) coinDeprecationsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if m.Deprecations == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "coin deprecation is not available")
+			return
+		}
+
+		deprecations, err := m.Deprecations.GetCoinDeprecations()
+		if err != nil {
+			log.WithError(err).Error("GetCoinDeprecations failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, coinDeprecationsResponse{
+			Deprecations: deprecations,
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// coinDeprecateHandler deprecates a coin type. New deposit addresses of the coin type can't be bound,
+// and the deposits to the bound addresses are scanned and processed until mdl_exchanger.coin_deprecation_window
+// has passed. The coin type is then retired and its scanner is paused.
+// Deprecating a coin type that is already deprecated leaves it unchanged
+// Method: POST
+// URI: /api/coin-deprecate
+// Args:
+//     - coin_type # the coin type to deprecate
+func (m *Monitor) coinDeprecateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if m.Deprecations == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "coin deprecation is not available")
+			return
+		}
+
+		coinType := r.FormValue("coin_type")
+		log = log.WithField("coinType", coinType)
+
+		d, err := m.Deprecations.DeprecateCoin(coinType)
+		switch err {
+		case nil:
+		case scanner.ErrUnsupportedCoinType:
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		default:
+			log.WithError(err).Error("DeprecateCoin failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		log.WithField("coinDeprecation", d).Warn("Coin type deprecated by an admin")
+
+		if err := m.pauseRetiredScanners(); err != nil {
+			log.WithError(err).Error("pauseRetiredScanners failed")
+		}
+
+		if err := httputil.JSONResponse(w, d); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// coinRestoreHandler cancels the deprecation of a coin type, allowing binds again.
+// If the coin type was retired, its scanner is resumed
+// Method: POST
+// URI: /api/coin-restore
+// Args:
+//     - coin_type # the deprecated coin type
+func (m *Monitor) coinRestoreHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if m.Deprecations == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "coin deprecation is not available")
+			return
+		}
+
+		coinType := r.FormValue("coin_type")
+		log = log.WithField("coinType", coinType)
+
+		deprecations, err := m.Deprecations.GetCoinDeprecations()
+		if err != nil {
+			log.WithError(err).Error("GetCoinDeprecations failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		d, ok := deprecations[coinType]
+		if !ok {
+			err := fmt.Sprintf("coin type %q is not deprecated", coinType)
+			httputil.ErrResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := m.Deprecations.RestoreCoin(coinType); err != nil {
+			log.WithError(err).Error("RestoreCoin failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		if sc, ok := m.Scanners[coinType]; ok && d.Stage == exchange.CoinStageRetired {
+			sc.Resume()
+			log.Info("Scanner of restored coin type resumed")
+		}
+
+		log.Info("Coin type restored by an admin")
+
+		if err := httputil.JSONResponse(w, exchange.CoinDeprecation{
+			CoinType: coinType,
+			Stage:    exchange.CoinStageActive,
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+// depositImportHandler records a deposit the scanner missed, e.g. one observed manually on a block explorer.
+// The deposit address must be bound, and the deposit is checked against the coin's node before it is recorded;
+// it is then paid like a scanned deposit.
+// Responds with 400 Bad Request if the deposit's block doesn't have the confirmations the scanner requires yet,
+// or with 409 Conflict if a deposit with the same txid is already recorded
+// Method: POST
+// URI: /api/deposit-import
+// Args:
+//     - coin_type # the coin type of the deposit
+//     - txid # the deposit transaction id
+//     - n # [optional] the index of the output paying the deposit address, defaults to 0
+//     - address # the deposit address
+//     - value # the deposit amount, in the unit the coin's scanner records deposit values in (satoshis for BTC, Gwei for ETH)
+//     - height # the height of the block including the deposit transaction
+func (m *Monitor) depositImportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if m.Imports == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "deposit import is not available")
+			return
+		}
+
+		dv := scanner.Deposit{
+			CoinType: r.FormValue("coin_type"),
+			Tx:       r.FormValue("txid"),
+			Address:  r.FormValue("address"),
+		}
+
+		if dv.Tx == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "txid is required")
+			return
+		}
+
+		if dv.Address == "" {
+			httputil.ErrResponse(w, http.StatusBadRequest, "address is required")
+			return
+		}
+
+		if n := r.FormValue("n"); n != "" {
+			v, err := strconv.ParseUint(n, 10, 32)
+			if err != nil {
+				httputil.ErrResponse(w, http.StatusBadRequest, "n must be a non-negative integer")
+				return
+			}
+			dv.N = uint32(v)
+		}
+
+		value, err := strconv.ParseInt(r.FormValue("value"), 10, 64)
+		if err != nil || value <= 0 {
+			httputil.ErrResponse(w, http.StatusBadRequest, "value must be a positive integer")
+			return
+		}
+		dv.Value = value
+
+		dv.Height, err = strconv.ParseInt(r.FormValue("height"), 10, 64)
+		if err != nil || dv.Height < 0 {
+			httputil.ErrResponse(w, http.StatusBadRequest, "height must be a non-negative integer")
+			return
+		}
+
+		log = log.WithField("deposit", dv)
+
+		di, err := m.Imports.ImportDeposit(dv)
+		if mismatchErr, ok := err.(scanner.DepositMismatchError); ok {
+			httputil.ErrResponse(w, http.StatusBadRequest, mismatchErr.Error())
+			return
+		}
+
+		switch err {
+		case nil:
+		case scanner.ErrUnsupportedCoinType, scanner.ErrDepositUnverifiable, scanner.ErrDepositUnconfirmed,
+			exchange.ErrNoBoundAddress, exchange.ErrRateNotSet:
+			httputil.ErrResponse(w, http.StatusBadRequest, err.Error())
+			return
+		case exchange.ErrDepositExists:
+			httputil.ErrResponse(w, http.StatusConflict, err.Error())
+			return
+		default:
+			log.WithError(err).Error("ImportDeposit failed")
+			httputil.ErrResponse(w, http.StatusInternalServerError)
+			return
+		}
+
+		log.WithField("depositInfo", di).Warn("Deposit imported by an admin")
+
+		if err := httputil.JSONResponse(w, di); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+type pendingDeposit struct {
+	Address               string `json:"address"`
+	Txid                  string `json:"txid"`
+	N                     uint32 `json:"n"`
+	Value                 int64  `json:"value"`
+	Height                int64  `json:"height"`
+	FirstSeen             int64  `json:"first_seen"`
+	Confirmations         int64  `json:"confirmations"`
+	RequiredConfirmations int64  `json:"required_confirmations"`
+}
+
+type pendingDepositsResponse struct {
+	Deposits map[string][]pendingDeposit `json:"deposits"`
+}
+
+// pendingDepositsHandler returns the deposits the scanners detected that are waiting for more confirmations
+// before they are sent to the exchange, keyed by coin type. Deposits in blocks that don't have
+// the coin's confirmations_required yet are not scanned, so they are not listed
+// Method: GET
+// URI: /api/pending-deposits
+// Args:
+//     - coin_type # [optional] only list the deposits of this coin type
+func (m *Monitor) pendingDepositsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		listers := m.Pending
+		if coinType := r.FormValue("coin_type"); coinType != "" {
+			pl, ok := m.Pending[coinType]
+			if !ok {
+				err := fmt.Sprintf("coin type %q is not scanned", coinType)
+				httputil.ErrResponse(w, http.StatusBadRequest, err)
+				return
+			}
+			listers = map[string]PendingDepositLister{coinType: pl}
+		}
+
+		resp := pendingDepositsResponse{
+			Deposits: make(map[string][]pendingDeposit, len(listers)),
+		}
+		for coinType, pl := range listers {
+			deposits := []pendingDeposit{}
+			for _, pd := range pl.PendingDeposits() {
+				deposits = append(deposits, pendingDeposit{
+					Address:               pd.Address,
+					Txid:                  pd.Tx,
+					N:                     pd.N,
+					Value:                 pd.Value,
+					Height:                pd.Height,
+					FirstSeen:             pd.FirstSeen,
+					Confirmations:         pd.Confirmations,
+					RequiredConfirmations: pd.RequiredConfirmations,
+				})
+			}
+			resp.Deposits[coinType] = deposits
+		}
+
+		if err := httputil.JSONResponse(w, resp); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
+
+type balanceReconciliationResponse struct {
+	Report *scanner.BalanceReport `json:"report"`
+}
+
+// balanceReconciliationHandler returns the report of the last balance reconciliation,
+// the report is null if none has run yet
+// Method: GET
+// URI: /api/balance-reconciliation
+func (m *Monitor) balanceReconciliationHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		if m.Balances == nil {
+			httputil.ErrResponse(w, http.StatusNotFound, "balance reconciliation is not enabled")
+			return
+		}
+
+		if err := httputil.JSONResponse(w, balanceReconciliationResponse{
+			Report: m.Balances.Report(),
+		}); err != nil {
+			log.WithError(err).Error("Write json response failed")
+		}
+	}
+}
@@ -2,8 +2,11 @@ package monitor
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 
 	"github.com/MDLlife/teller/src/exchange"
 	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/sweep"
 	"github.com/MDLlife/teller/src/util/testutil"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
@@ -153,9 +157,13 @@ var statsDpis = []exchange.DepositInfo{
 		Status:       exchange.StatusDone,
 	},
 }
+
+const testAuthToken = "s3cr3t"
+
 var statsCfg = Config{
-	"localhost:1234",
+	[]string{"localhost:1234"},
 	10, 11, 12, 13, 14, 15, decimal.NewFromFloat(10.5), 10,
+	nil, false, testAuthToken,
 }
 
 func TestRunMonitor(t *testing.T) {
@@ -195,7 +203,7 @@ func TestRunMonitor(t *testing.T) {
 	err := setupTestServer(t, m)
 	require.NoError(t, err)
 
-	targetServer := fmt.Sprintf("http://%s/api/address", statsCfg.Addr)
+	targetServer := fmt.Sprintf("http://%s/api/address", statsCfg.Addrs[0])
 	rsp, err := http.Get(targetServer)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, rsp.StatusCode)
@@ -247,7 +255,7 @@ func TestRunMonitor(t *testing.T) {
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
 
-			targetServer := fmt.Sprintf("http://%s/api/deposit_status?status=%s", statsCfg.Addr, tc.status)
+			targetServer := fmt.Sprintf("http://%s/api/deposit_status?status=%s", statsCfg.Addrs[0], tc.status)
 			rsp, err := http.Get(targetServer)
 			require.NoError(t, err)
 			defer testutil.CheckError(t, rsp.Body.Close)
@@ -281,6 +289,73 @@ func TestRunMonitor(t *testing.T) {
 	}()
 }
 
+func TestRunMonitorDisabled(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	cfg := statsCfg
+	cfg.Addrs = nil
+	m := New(log, cfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{}, &dummyWavesMDLAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Run()
+	}()
+
+	// With no address, no admin listener is started but the service keeps running until shut down
+	select {
+	case err := <-done:
+		t.Fatalf("m.Run() returned early: %v", err)
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	m.lnLock.Lock()
+	require.Empty(t, m.lns)
+	m.lnLock.Unlock()
+
+	m.Shutdown()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("m.Run() did not return after m.Shutdown()")
+	}
+}
+
+func TestRunMonitorMultipleAddrs(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	cfg := statsCfg
+	cfg.Addrs = []string{"localhost:1235", "localhost:1236"}
+	m := New(log, cfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{}, &dummyWavesMDLAddrMgr{}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Run()
+	}()
+	time.Sleep(time.Millisecond * 200)
+
+	// The admin panel is served on every address
+	for _, addr := range cfg.Addrs {
+		rsp, err := http.Get(fmt.Sprintf("http://%s/api/address", addr))
+		require.NoError(t, err, addr)
+		require.Equal(t, http.StatusOK, rsp.StatusCode, addr)
+		testutil.CheckError(t, rsp.Body.Close)
+	}
+
+	m.Shutdown()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("m.Run() did not return after m.Shutdown()")
+	}
+
+	for _, addr := range cfg.Addrs {
+		_, err := http.Get(fmt.Sprintf("http://%s/api/address", addr))
+		require.Error(t, err, addr)
+	}
+}
+
 func TestMonitorDepositStats(t *testing.T) {
 	dummyDps := dummyDepositStatusGetter{dpis: statsDpis}
 
@@ -289,7 +364,7 @@ func TestMonitorDepositStats(t *testing.T) {
 	err := setupTestServer(t, m)
 	require.NoError(t, err)
 
-	targetServer := fmt.Sprintf("http://%s/api/stats", statsCfg.Addr)
+	targetServer := fmt.Sprintf("http://%s/api/stats", statsCfg.Addrs[0])
 	rsp, err := http.Get(targetServer)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, rsp.StatusCode)
@@ -325,7 +400,7 @@ func TestMonitorWebReadyDepositStats(t *testing.T) {
 
 	require.NoError(t, err)
 
-	targetServer := fmt.Sprintf("http://%s/api/web-stats", statsCfg.Addr)
+	targetServer := fmt.Sprintf("http://%s/api/web-stats", statsCfg.Addrs[0])
 	rsp, err := http.Get(targetServer)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, rsp.StatusCode)
@@ -387,7 +462,7 @@ func TestMonitorEthTotalStatsHandler(t *testing.T) {
 
 	require.NoError(t, err)
 
-	targetServer := fmt.Sprintf("http://%s/api/eth-total-stats", statsCfg.Addr)
+	targetServer := fmt.Sprintf("http://%s/api/eth-total-stats", statsCfg.Addrs[0])
 	rsp, err := http.Get(targetServer)
 
 	require.NoError(t, err)
@@ -407,17 +482,498 @@ func TestMonitorEthTotalStatsHandler(t *testing.T) {
 	}()
 }
 
-func setupTestServer(t *testing.T, m *Monitor) error {
-	mux := m.setupMux()
+type dummySweeper struct {
+	res *sweep.Result
+	err error
+}
+
+func (s dummySweeper) Sweep() (*sweep.Result, error) {
+	return s.res, s.err
+}
+
+func TestMonitorSweepHandler(t *testing.T) {
+	res := &sweep.Result{
+		CoinType:    scanner.CoinTypeBTC,
+		Txid:        "t1",
+		ColdAddress: "c1",
+		Inputs:      2,
+		Amount:      74996600,
+		Fee:         3400,
+	}
+
+	tt := []struct {
+		name     string
+		method   string
+		coinType string
+		sweeper  Sweeper
+		code     int
+		res      *sweep.Result
+	}{
+		{
+			name:     "method not allowed",
+			method:   http.MethodGet,
+			coinType: scanner.CoinTypeBTC,
+			sweeper:  dummySweeper{res: res},
+			code:     http.StatusMethodNotAllowed,
+		},
+		{
+			name:     "coin type not configured",
+			method:   http.MethodPost,
+			coinType: scanner.CoinTypeETH,
+			sweeper:  dummySweeper{res: res},
+			code:     http.StatusBadRequest,
+		},
+		{
+			name:     "nothing to sweep",
+			method:   http.MethodPost,
+			coinType: scanner.CoinTypeBTC,
+			sweeper:  dummySweeper{err: sweep.ErrNothingToSweep},
+			code:     http.StatusBadRequest,
+		},
+		{
+			name:     "sweep failed",
+			method:   http.MethodPost,
+			coinType: scanner.CoinTypeBTC,
+			sweeper:  dummySweeper{err: errors.New("wallet locked")},
+			code:     http.StatusInternalServerError,
+		},
+		{
+			name:     "swept",
+			method:   http.MethodPost,
+			coinType: scanner.CoinTypeBTC,
+			sweeper:  dummySweeper{res: res},
+			code:     http.StatusOK,
+			res:      res,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+			m := New(log, statsCfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+			m.Sweepers = map[string]Sweeper{
+				scanner.CoinTypeBTC: tc.sweeper,
+			}
+
+			req := httptest.NewRequest(tc.method, "/api/sweep?coin_type="+tc.coinType, nil)
+			req.Header.Set("Authorization", "Bearer "+testAuthToken)
+			rr := httptest.NewRecorder()
+			m.setupMux().ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code, rr.Body.String())
+
+			if tc.res != nil {
+				var got sweep.Result
+				err := json.NewDecoder(rr.Body).Decode(&got)
+				require.NoError(t, err)
+				require.Equal(t, *tc.res, got)
+			}
+		})
+	}
+}
+
+func TestMonitorAuthHandler(t *testing.T) {
+	tt := []struct {
+		name      string
+		authToken string
+		auth      string
+		code      int
+	}{
+		{
+			name:      "valid token",
+			authToken: testAuthToken,
+			auth:      "Bearer " + testAuthToken,
+			code:      http.StatusOK,
+		},
+		{
+			name:      "no token",
+			authToken: testAuthToken,
+			code:      http.StatusUnauthorized,
+		},
+		{
+			name:      "wrong token",
+			authToken: testAuthToken,
+			auth:      "Bearer wrong",
+			code:      http.StatusUnauthorized,
+		},
+		{
+			name:      "not a bearer token",
+			authToken: testAuthToken,
+			auth:      "Basic " + testAuthToken,
+			code:      http.StatusUnauthorized,
+		},
+		{
+			name: "auth token not configured",
+			auth: "Bearer ",
+			code: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+			cfg := statsCfg
+			cfg.AuthToken = tc.authToken
+			m := &Monitor{
+				log: log,
+				cfg: cfg,
+			}
+
+			var served bool
+			hd := m.authHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/sweep", nil)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rr := httptest.NewRecorder()
+			hd.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code, rr.Body.String())
+			require.Equal(t, tc.code == http.StatusOK, served)
+		})
+	}
+}
+
+type dummyScanController struct {
+	paused bool
+	height int64
+}
+
+func (s *dummyScanController) Pause() {
+	s.paused = true
+}
+
+func (s *dummyScanController) Resume() {
+	s.paused = false
+}
+
+func (s *dummyScanController) Paused() bool {
+	return s.paused
+}
+
+func (s *dummyScanController) StoredScanHeight() (int64, error) {
+	return s.height, nil
+}
+
+func (s *dummyScanController) SetStoredScanHeight(height int64) (int64, error) {
+	if !s.paused {
+		return 0, scanner.ErrScannerNotPaused
+	}
+
+	prevHeight := s.height
+	s.height = height
+	return prevHeight, nil
+}
+
+type dummyBlockReplayer struct {
+	replay *scanner.BlockReplay
+	err    error
+}
+
+func (r *dummyBlockReplayer) ScanSingleBlock(height int64) (*scanner.BlockReplay, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	replay := *r.replay
+	replay.Height = height
+	return &replay, nil
+}
+
+func TestMonitorScanReplayHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, statsCfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	br := &dummyBlockReplayer{
+		replay: &scanner.BlockReplay{
+			CoinType:      scanner.CoinTypeBTC,
+			Hash:          "block-hash",
+			ScanAddresses: 1,
+			Matches: []scanner.VoutReplay{
+				{
+					Txid:      "tx1",
+					Addresses: []string{"1LEWwJkDj8xriE87ALzQYcHjTmD8aqDj1f"},
+					Value:     1e8,
+					Matched:   true,
+				},
+			},
+		},
+	}
+	m.BlockReplayers = map[string]BlockReplayer{
+		scanner.CoinTypeBTC: br,
+	}
+
+	do := func(method, uri string, code int) scanner.BlockReplay {
+		req := httptest.NewRequest(method, uri, nil)
+		rr := httptest.NewRecorder()
+		m.setupMux().ServeHTTP(rr, req)
+
+		require.Equal(t, code, rr.Code, rr.Body.String())
+
+		var resp scanner.BlockReplay
+		if code == http.StatusOK {
+			err := json.NewDecoder(rr.Body).Decode(&resp)
+			require.NoError(t, err)
+		}
+		return resp
+	}
+
+	resp := do(http.MethodGet, "/api/scan-replay?coin_type=BTC&height=514300", http.StatusOK)
+	expected := *br.replay
+	expected.Height = 514300
+	require.Equal(t, expected, resp)
+
+	do(http.MethodPost, "/api/scan-replay?coin_type=BTC&height=514300", http.StatusMethodNotAllowed)
+	do(http.MethodGet, "/api/scan-replay?coin_type=ETH&height=514300", http.StatusBadRequest)
+	do(http.MethodGet, "/api/scan-replay?coin_type=BTC", http.StatusBadRequest)
+	do(http.MethodGet, "/api/scan-replay?coin_type=BTC&height=-1", http.StatusBadRequest)
+
+	br.err = errors.New("block not found")
+	do(http.MethodGet, "/api/scan-replay?coin_type=BTC&height=514300", http.StatusInternalServerError)
+}
+
+func TestMonitorScanHeightHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, statsCfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+	sc := &dummyScanController{height: 514300}
+	m.Scanners = map[string]ScanController{
+		scanner.CoinTypeBTC: sc,
+	}
+
+	do := func(method, uri string, code int) scanHeightResponse {
+		req := httptest.NewRequest(method, uri, nil)
+		req.Header.Set("Authorization", "Bearer "+testAuthToken)
+		rr := httptest.NewRecorder()
+		m.setupMux().ServeHTTP(rr, req)
+
+		require.Equal(t, code, rr.Code, rr.Body.String())
+
+		var resp scanHeightResponse
+		if code == http.StatusOK {
+			err := json.NewDecoder(rr.Body).Decode(&resp)
+			require.NoError(t, err)
+		}
+		return resp
+	}
+
+	ptr := func(n int64) *int64 {
+		return &n
+	}
+
+	// Read
+	resp := do(http.MethodGet, "/api/scan-height?coin_type=BTC", http.StatusOK)
+	require.Equal(t, scanHeightResponse{
+		CoinType:   scanner.CoinTypeBTC,
+		ScanHeight: 514300,
+	}, resp)
+
+	do(http.MethodPut, "/api/scan-height?coin_type=BTC", http.StatusMethodNotAllowed)
+	do(http.MethodGet, "/api/scan-height?coin_type=ETH", http.StatusBadRequest)
+	do(http.MethodGet, "/api/scan-pause?coin_type=BTC", http.StatusMethodNotAllowed)
+
+	// The scanner must be paused
+	do(http.MethodPost, "/api/scan-height?coin_type=BTC&height=514400", http.StatusConflict)
+	require.Equal(t, int64(514300), sc.height)
+
+	resp = do(http.MethodPost, "/api/scan-pause?coin_type=BTC", http.StatusOK)
+	require.True(t, resp.Paused)
+	require.True(t, sc.paused)
+
+	do(http.MethodPost, "/api/scan-height?coin_type=BTC", http.StatusBadRequest)
+	do(http.MethodPost, "/api/scan-height?coin_type=BTC&height=foo", http.StatusBadRequest)
+	do(http.MethodPost, "/api/scan-height?coin_type=BTC&height=-1", http.StatusBadRequest)
+
+	// Advance
+	resp = do(http.MethodPost, "/api/scan-height?coin_type=BTC&height=514400", http.StatusOK)
+	require.Equal(t, scanHeightResponse{
+		CoinType:           scanner.CoinTypeBTC,
+		ScanHeight:         514400,
+		Paused:             true,
+		PreviousScanHeight: ptr(514300),
+	}, resp)
+	require.Equal(t, int64(514400), sc.height)
+
+	// Rewind
+	resp = do(http.MethodPost, "/api/scan-height?coin_type=BTC&height=514000", http.StatusOK)
+	require.Equal(t, scanHeightResponse{
+		CoinType:           scanner.CoinTypeBTC,
+		ScanHeight:         514000,
+		Paused:             true,
+		PreviousScanHeight: ptr(514400),
+		Warning:            "The scan height moved backward by 400 blocks, these blocks will be scanned again",
+	}, resp)
+	require.Equal(t, int64(514000), sc.height)
+
+	resp = do(http.MethodPost, "/api/scan-resume?coin_type=BTC", http.StatusOK)
+	require.Equal(t, scanHeightResponse{
+		CoinType:   scanner.CoinTypeBTC,
+		ScanHeight: 514000,
+	}, resp)
+	require.False(t, sc.paused)
+}
+
+type dummySendPauser struct {
+	paused bool
+	err    error
+}
+
+func (s *dummySendPauser) SendsPaused() bool {
+	return s.paused
+}
+
+func (s *dummySendPauser) SetSendsPaused(paused bool) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.paused = paused
+	return nil
+}
+
+func TestMonitorSendPauseHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, statsCfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	do := func(method, uri string, code int) sendsPausedResponse {
+		req := httptest.NewRequest(method, uri, nil)
+		req.Header.Set("Authorization", "Bearer "+testAuthToken)
+		rr := httptest.NewRecorder()
+		m.setupMux().ServeHTTP(rr, req)
+
+		require.Equal(t, code, rr.Code, rr.Body.String())
+
+		var resp sendsPausedResponse
+		if code == http.StatusOK {
+			err := json.NewDecoder(rr.Body).Decode(&resp)
+			require.NoError(t, err)
+		}
+		return resp
+	}
+
+	// No exchange
+	do(http.MethodGet, "/api/sends-paused", http.StatusNotFound)
+	do(http.MethodPost, "/api/send-pause", http.StatusNotFound)
+
+	sp := &dummySendPauser{}
+	m.Sends = sp
+
+	resp := do(http.MethodGet, "/api/sends-paused", http.StatusOK)
+	require.False(t, resp.SendsPaused)
+
+	do(http.MethodPost, "/api/sends-paused", http.StatusMethodNotAllowed)
+	do(http.MethodGet, "/api/send-pause", http.StatusMethodNotAllowed)
+	do(http.MethodGet, "/api/send-resume", http.StatusMethodNotAllowed)
+
+	resp = do(http.MethodPost, "/api/send-pause", http.StatusOK)
+	require.True(t, resp.SendsPaused)
+	require.True(t, sp.paused)
+
+	resp = do(http.MethodGet, "/api/sends-paused", http.StatusOK)
+	require.True(t, resp.SendsPaused)
+
+	resp = do(http.MethodPost, "/api/send-resume", http.StatusOK)
+	require.False(t, resp.SendsPaused)
+	require.False(t, sp.paused)
+
+	// The setting could not be saved
+	sp.err = errors.New("db closed")
+	do(http.MethodPost, "/api/send-pause", http.StatusInternalServerError)
+	require.False(t, sp.paused)
+}
 
-	m.ln = &http.Server{
-		Addr:         m.cfg.Addr,
-		Handler:      mux,
-		ReadTimeout:  serverReadTimeout,
-		WriteTimeout: serverWriteTimeout,
-		IdleTimeout:  serverIdleTimeout,
+func TestMonitorAllowedIPsHandler(t *testing.T) {
+	mustParseCIDR := func(cidr string) *net.IPNet {
+		_, n, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		return n
 	}
 
+	cases := []struct {
+		name        string
+		allowedIPs  []*net.IPNet
+		behindProxy bool
+		remoteAddr  string
+		forwarded   string
+		code        int
+	}{
+		{
+			name:       "no allowlist",
+			remoteAddr: "203.0.113.5:1234",
+			code:       http.StatusOK,
+		},
+		{
+			name:       "allowed",
+			allowedIPs: []*net.IPNet{mustParseCIDR("127.0.0.1/32"), mustParseCIDR("10.0.0.0/8")},
+			remoteAddr: "10.1.2.3:1234",
+			code:       http.StatusOK,
+		},
+		{
+			name:       "disallowed",
+			allowedIPs: []*net.IPNet{mustParseCIDR("127.0.0.1/32"), mustParseCIDR("10.0.0.0/8")},
+			remoteAddr: "203.0.113.5:1234",
+			code:       http.StatusForbidden,
+		},
+		{
+			name:       "forwarded header ignored when not behind a proxy",
+			allowedIPs: []*net.IPNet{mustParseCIDR("10.0.0.0/8")},
+			remoteAddr: "203.0.113.5:1234",
+			forwarded:  "10.1.2.3",
+			code:       http.StatusForbidden,
+		},
+		{
+			name:        "proxied allowed",
+			allowedIPs:  []*net.IPNet{mustParseCIDR("10.0.0.0/8")},
+			behindProxy: true,
+			remoteAddr:  "127.0.0.1:1234",
+			forwarded:   "10.1.2.3",
+			code:        http.StatusOK,
+		},
+		{
+			name:        "proxied spoofed forwarded header",
+			allowedIPs:  []*net.IPNet{mustParseCIDR("10.0.0.0/8")},
+			behindProxy: true,
+			remoteAddr:  "127.0.0.1:1234",
+			forwarded:   "10.1.2.3, 203.0.113.5",
+			code:        http.StatusForbidden,
+		},
+		{
+			name:        "proxied disallowed",
+			allowedIPs:  []*net.IPNet{mustParseCIDR("127.0.0.1/32")},
+			behindProxy: true,
+			remoteAddr:  "127.0.0.1:1234",
+			forwarded:   "203.0.113.5",
+			code:        http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+			cfg := statsCfg
+			cfg.AllowedIPs = tc.allowedIPs
+			cfg.BehindProxy = tc.behindProxy
+
+			m := New(log, cfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+			m.Sends = &dummySendPauser{}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/sends-paused", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+
+			rr := httptest.NewRecorder()
+			m.allowedIPsHandler(m.setupMux()).ServeHTTP(rr, req)
+
+			require.Equal(t, tc.code, rr.Code, rr.Body.String())
+		})
+	}
+}
+
+func setupTestServer(t *testing.T, m *Monitor) error {
 	go func() {
 		if err := m.Run(); err != nil {
 			t.Logf("m.Run(), %v", err)
@@ -431,3 +987,352 @@ func setupTestServer(t *testing.T, m *Monitor) error {
 	return nil
 
 }
+
+type dummyCoinDeprecator struct {
+	window       time.Duration
+	deprecatedAt map[string]time.Time
+}
+
+func (d *dummyCoinDeprecator) DeprecateCoin(coinType string) (*exchange.CoinDeprecation, error) {
+	if _, err := scanner.NormalizeCoinType(coinType, nil); err != nil {
+		return nil, err
+	}
+
+	if _, ok := d.deprecatedAt[coinType]; !ok {
+		d.deprecatedAt[coinType] = time.Now()
+	}
+
+	dp := exchange.NewCoinDeprecation(coinType, d.deprecatedAt[coinType], d.window, time.Now())
+	return &dp, nil
+}
+
+func (d *dummyCoinDeprecator) RestoreCoin(coinType string) error {
+	delete(d.deprecatedAt, coinType)
+	return nil
+}
+
+func (d *dummyCoinDeprecator) GetCoinDeprecations() (map[string]exchange.CoinDeprecation, error) {
+	deprecations := make(map[string]exchange.CoinDeprecation)
+	for coinType, at := range d.deprecatedAt {
+		deprecations[coinType] = exchange.NewCoinDeprecation(coinType, at, d.window, time.Now())
+	}
+	return deprecations, nil
+}
+
+func TestMonitorCoinDeprecation(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, statsCfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	do := func(method, uri string, code int, resp interface{}) {
+		req := httptest.NewRequest(method, uri, nil)
+		req.Header.Set("Authorization", "Bearer "+testAuthToken)
+		rr := httptest.NewRecorder()
+		m.setupMux().ServeHTTP(rr, req)
+
+		require.Equal(t, code, rr.Code, rr.Body.String())
+
+		if code == http.StatusOK {
+			err := json.NewDecoder(rr.Body).Decode(resp)
+			require.NoError(t, err)
+		}
+	}
+
+	// No exchange
+	do(http.MethodGet, "/api/coin-deprecations", http.StatusNotFound, nil)
+	do(http.MethodPost, "/api/coin-deprecate?coin_type=BTC", http.StatusNotFound, nil)
+
+	dd := &dummyCoinDeprecator{
+		window:       time.Hour,
+		deprecatedAt: make(map[string]time.Time),
+	}
+	m.Deprecations = dd
+
+	btcScanner := &dummyScanController{}
+	m.Scanners = map[string]ScanController{
+		scanner.CoinTypeBTC: btcScanner,
+	}
+
+	do(http.MethodGet, "/api/coin-deprecate?coin_type=BTC", http.StatusMethodNotAllowed, nil)
+	do(http.MethodPost, "/api/coin-deprecations", http.StatusMethodNotAllowed, nil)
+	do(http.MethodPost, "/api/coin-deprecate?coin_type=foo", http.StatusBadRequest, nil)
+	do(http.MethodPost, "/api/coin-restore?coin_type=BTC", http.StatusBadRequest, nil)
+
+	// Active
+	var list coinDeprecationsResponse
+	do(http.MethodGet, "/api/coin-deprecations", http.StatusOK, &list)
+	require.Empty(t, list.Deprecations)
+
+	// Deprecated, the scanner keeps running during the window
+	var d exchange.CoinDeprecation
+	do(http.MethodPost, "/api/coin-deprecate?coin_type=BTC", http.StatusOK, &d)
+	require.Equal(t, scanner.CoinTypeBTC, d.CoinType)
+	require.Equal(t, exchange.CoinStageDeprecated, d.Stage)
+	require.False(t, btcScanner.paused)
+
+	do(http.MethodGet, "/api/coin-deprecations", http.StatusOK, &list)
+	require.Equal(t, map[string]exchange.CoinDeprecation{
+		scanner.CoinTypeBTC: d,
+	}, list.Deprecations)
+
+	require.NoError(t, m.pauseRetiredScanners())
+	require.False(t, btcScanner.paused)
+
+	// Retired once the window has passed, the scanner is paused
+	dd.deprecatedAt[scanner.CoinTypeBTC] = time.Now().Add(-time.Hour * 2)
+	require.NoError(t, m.pauseRetiredScanners())
+	require.True(t, btcScanner.paused)
+
+	do(http.MethodGet, "/api/coin-deprecations", http.StatusOK, &list)
+	require.Equal(t, exchange.CoinStageRetired, list.Deprecations[scanner.CoinTypeBTC].Stage)
+
+	// Restored, the scanner is resumed
+	do(http.MethodPost, "/api/coin-restore?coin_type=BTC", http.StatusOK, &d)
+	require.Equal(t, exchange.CoinStageActive, d.Stage)
+	require.False(t, btcScanner.paused)
+
+	list = coinDeprecationsResponse{}
+	do(http.MethodGet, "/api/coin-deprecations", http.StatusOK, &list)
+	require.Empty(t, list.Deprecations)
+}
+
+type dummyDepositImporter struct {
+	deposits map[string]exchange.DepositInfo
+}
+
+func (d *dummyDepositImporter) ImportDeposit(dv scanner.Deposit) (*exchange.DepositInfo, error) {
+	if dv.CoinType != scanner.CoinTypeBTC {
+		return nil, scanner.ErrUnsupportedCoinType
+	}
+
+	if dv.Address != "foo-btc-addr" {
+		return nil, exchange.ErrNoBoundAddress
+	}
+
+	if dv.Value != 1e8 {
+		return nil, scanner.DepositMismatchError{Reason: "output 1 of transaction foo-tx pays 100000000"}
+	}
+
+	for _, di := range d.deposits {
+		if di.Deposit.Tx == dv.Tx {
+			return nil, exchange.ErrDepositExists
+		}
+	}
+
+	di := exchange.DepositInfo{
+		CoinType:       dv.CoinType,
+		DepositAddress: dv.Address,
+		DepositID:      dv.ID(),
+		DepositValue:   dv.Value,
+		Status:         exchange.StatusWaitDecide,
+		Imported:       true,
+		Deposit:        dv,
+	}
+	d.deposits[di.DepositID] = di
+
+	return &di, nil
+}
+
+func TestMonitorDepositImportHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, statsCfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	do := func(method, uri string, code int) exchange.DepositInfo {
+		req := httptest.NewRequest(method, uri, nil)
+		req.Header.Set("Authorization", "Bearer "+testAuthToken)
+		rr := httptest.NewRecorder()
+		m.setupMux().ServeHTTP(rr, req)
+
+		require.Equal(t, code, rr.Code, rr.Body.String())
+
+		var di exchange.DepositInfo
+		if code == http.StatusOK {
+			err := json.NewDecoder(rr.Body).Decode(&di)
+			require.NoError(t, err)
+		}
+		return di
+	}
+
+	uri := "/api/deposit-import?coin_type=BTC&txid=foo-tx&n=1&address=foo-btc-addr&value=100000000&height=20"
+
+	// No exchange
+	do(http.MethodPost, uri, http.StatusNotFound)
+
+	di := &dummyDepositImporter{
+		deposits: make(map[string]exchange.DepositInfo),
+	}
+	m.Imports = di
+
+	do(http.MethodGet, uri, http.StatusMethodNotAllowed)
+
+	// Invalid args
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&address=foo-btc-addr&value=1&height=20", http.StatusBadRequest)
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&value=1&height=20", http.StatusBadRequest)
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&address=foo-btc-addr&height=20", http.StatusBadRequest)
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&address=foo-btc-addr&value=0&height=20", http.StatusBadRequest)
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&address=foo-btc-addr&value=1&n=-1&height=20", http.StatusBadRequest)
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&address=foo-btc-addr&value=1", http.StatusBadRequest)
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&address=foo-btc-addr&value=1&height=x", http.StatusBadRequest)
+	do(http.MethodPost, "/api/deposit-import?coin_type=foo&txid=foo-tx&address=foo-btc-addr&value=1&height=20", http.StatusBadRequest)
+
+	// Not bound
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&address=bar-btc-addr&value=1&height=20", http.StatusBadRequest)
+	require.Empty(t, di.deposits)
+
+	// Not on the blockchain as described
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&n=1&address=foo-btc-addr&value=1000000000&height=20", http.StatusBadRequest)
+	require.Empty(t, di.deposits)
+
+	d := do(http.MethodPost, uri, http.StatusOK)
+	require.True(t, d.Imported)
+	require.Equal(t, "foo-tx:1", d.DepositID)
+	require.Equal(t, scanner.Deposit{
+		CoinType: scanner.CoinTypeBTC,
+		Address:  "foo-btc-addr",
+		Value:    1e8,
+		Height:   20,
+		Tx:       "foo-tx",
+		N:        1,
+	}, d.Deposit)
+
+	// Duplicate txid
+	do(http.MethodPost, uri, http.StatusConflict)
+	do(http.MethodPost, "/api/deposit-import?coin_type=BTC&txid=foo-tx&address=foo-btc-addr&value=1", http.StatusConflict)
+	require.Len(t, di.deposits, 1)
+}
+
+type dummyBalanceReporter struct {
+	report *scanner.BalanceReport
+}
+
+func (r *dummyBalanceReporter) Report() *scanner.BalanceReport {
+	return r.report
+}
+
+func TestMonitorBalanceReconciliationHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, statsCfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	do := func(method string, code int) *scanner.BalanceReport {
+		req := httptest.NewRequest(method, "/api/balance-reconciliation", nil)
+		rr := httptest.NewRecorder()
+		m.setupMux().ServeHTTP(rr, req)
+
+		require.Equal(t, code, rr.Code, rr.Body.String())
+
+		var rsp balanceReconciliationResponse
+		if code == http.StatusOK {
+			err := json.NewDecoder(rr.Body).Decode(&rsp)
+			require.NoError(t, err)
+		}
+		return rsp.Report
+	}
+
+	// Balance reconciliation is disabled
+	do(http.MethodGet, http.StatusNotFound)
+
+	br := &dummyBalanceReporter{}
+	m.Balances = br
+
+	do(http.MethodPost, http.StatusMethodNotAllowed)
+
+	// No reconciliation has run yet
+	require.Nil(t, do(http.MethodGet, http.StatusOK))
+
+	br.report = &scanner.BalanceReport{
+		CheckedAt: 1500000000,
+		Addresses: 2,
+		Discrepancies: []scanner.BalanceDiscrepancy{
+			{
+				CoinType:        scanner.CoinTypeETH,
+				Address:         "foo-eth-addr",
+				ChainBalance:    2e9,
+				RecordedBalance: 1e9,
+			},
+		},
+	}
+	require.Equal(t, br.report, do(http.MethodGet, http.StatusOK))
+}
+
+type dummyPendingDepositLister struct {
+	pending []scanner.PendingDeposit
+}
+
+func (l *dummyPendingDepositLister) PendingDeposits() []scanner.PendingDeposit {
+	return l.pending
+}
+
+func TestMonitorPendingDepositsHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := New(log, statsCfg, &dummyBtcAddrMgr{10}, &dummyEthAddrMgr{10}, &dummySkyAddrMgr{10}, &dummyWavesAddrMgr{10}, &dummyWavesMDLAddrMgr{10}, &dummyDepositStatusGetter{}, &dummyScanAddrs{})
+
+	btc := &dummyPendingDepositLister{
+		pending: []scanner.PendingDeposit{
+			{
+				Deposit: scanner.Deposit{
+					CoinType:  scanner.CoinTypeBTC,
+					Address:   "1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+					Value:     5e8,
+					Height:    514300,
+					Tx:        "large-tx",
+					N:         1,
+					FirstSeen: 1501128063,
+				},
+				Confirmations:         2,
+				RequiredConfirmations: 6,
+			},
+		},
+	}
+	m.Pending = map[string]PendingDepositLister{
+		scanner.CoinTypeBTC: btc,
+		scanner.CoinTypeETH: &dummyPendingDepositLister{},
+	}
+
+	do := func(method, uri string, code int) pendingDepositsResponse {
+		req := httptest.NewRequest(method, uri, nil)
+		rr := httptest.NewRecorder()
+		m.setupMux().ServeHTTP(rr, req)
+
+		require.Equal(t, code, rr.Code, rr.Body.String())
+
+		var resp pendingDepositsResponse
+		if code == http.StatusOK {
+			err := json.NewDecoder(rr.Body).Decode(&resp)
+			require.NoError(t, err)
+		}
+		return resp
+	}
+
+	expectedBTC := []pendingDeposit{
+		{
+			Address:               "1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+			Txid:                  "large-tx",
+			N:                     1,
+			Value:                 5e8,
+			Height:                514300,
+			FirstSeen:             1501128063,
+			Confirmations:         2,
+			RequiredConfirmations: 6,
+		},
+	}
+
+	resp := do(http.MethodGet, "/api/pending-deposits", http.StatusOK)
+	require.Equal(t, map[string][]pendingDeposit{
+		scanner.CoinTypeBTC: expectedBTC,
+		scanner.CoinTypeETH: {},
+	}, resp.Deposits)
+
+	resp = do(http.MethodGet, "/api/pending-deposits?coin_type=BTC", http.StatusOK)
+	require.Equal(t, map[string][]pendingDeposit{
+		scanner.CoinTypeBTC: expectedBTC,
+	}, resp.Deposits)
+
+	do(http.MethodPost, "/api/pending-deposits", http.StatusMethodNotAllowed)
+	do(http.MethodGet, "/api/pending-deposits?coin_type=SKY", http.StatusBadRequest)
+
+	// A deposit is no longer listed once it is confirmed
+	btc.pending = nil
+	resp = do(http.MethodGet, "/api/pending-deposits?coin_type=BTC", http.StatusOK)
+	require.Equal(t, map[string][]pendingDeposit{
+		scanner.CoinTypeBTC: {},
+	}, resp.Deposits)
+}
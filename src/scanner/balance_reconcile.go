@@ -0,0 +1,170 @@
+package scanner
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// balanceDiscrepancies is, per coin type, the number of deposit addresses flagged by the last balance reconciliation
+var balanceDiscrepancies = expvar.NewMap("balance_reconcile_discrepancies")
+
+// BalanceDiscrepancy is a deposit address whose balance on the blockchain exceeds the sum of its recorded deposits
+type BalanceDiscrepancy struct {
+	CoinType        string `json:"coin_type"`
+	Address         string `json:"address"`
+	ChainBalance    int64  `json:"chain_balance"`
+	RecordedBalance int64  `json:"recorded_balance"`
+}
+
+// BalanceReport is the result of a balance reconciliation
+type BalanceReport struct {
+	CheckedAt     int64                `json:"checked_at"` // unix time
+	Addresses     int                  `json:"addresses"`  // number of deposit addresses whose balance was compared
+	Errors        int                  `json:"errors"`     // number of deposit addresses whose balance couldn't be read
+	Discrepancies []BalanceDiscrepancy `json:"discrepancies"`
+}
+
+// BalanceReconciler periodically compares the balance of each deposit address on the blockchain
+// to the sum of the deposits the scanners recorded for it, for the coins whose scanner is an AddressBalancer.
+// Only a balance exceeding the records is flagged, it means deposits were missed. A lower balance
+// is expected once the deposits have been moved out of the address, e.g. swept to a cold wallet
+type BalanceReconciler struct {
+	log         logrus.FieldLogger
+	store       Storer
+	multiplexer *Multiplexer
+	interval    time.Duration
+	quit        chan struct{}
+
+	sync.RWMutex
+	report *BalanceReport
+}
+
+// NewBalanceReconciler creates a BalanceReconciler checking the balances every interval
+func NewBalanceReconciler(log logrus.FieldLogger, store Storer, multiplexer *Multiplexer, interval time.Duration) *BalanceReconciler {
+	return &BalanceReconciler{
+		log:         log.WithField("prefix", "scanner.balance"),
+		store:       store,
+		multiplexer: multiplexer,
+		interval:    interval,
+		quit:        make(chan struct{}),
+	}
+}
+
+// Run reconciles the balances every interval until Shutdown is called
+func (r *BalanceReconciler) Run() error {
+	log := r.log.WithField("interval", r.interval)
+	log.Info("Start balance reconciler")
+	defer log.Info("Balance reconciler closed")
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.quit:
+			return nil
+		case <-ticker.C:
+			if _, err := r.Reconcile(); err != nil {
+				log.WithError(err).Error("Reconcile failed")
+			}
+		}
+	}
+}
+
+// Shutdown stops Run
+func (r *BalanceReconciler) Shutdown() {
+	close(r.quit)
+}
+
+// Report returns the report of the last reconciliation, or nil if none has run yet
+func (r *BalanceReconciler) Report() *BalanceReport {
+	r.RLock()
+	defer r.RUnlock()
+	return r.report
+}
+
+// Reconcile compares the balances of the deposit addresses to their recorded deposits and saves the report.
+// An address whose balance can't be read is counted in BalanceReport.Errors and skipped
+func (r *BalanceReconciler) Reconcile() (*BalanceReport, error) {
+	balancers := r.multiplexer.AddressBalancers()
+
+	report := &BalanceReport{
+		CheckedAt:     time.Now().UTC().Unix(),
+		Discrepancies: []BalanceDiscrepancy{},
+	}
+
+	for _, coinType := range GetCoinTypes() {
+		ab, ok := balancers[coinType]
+		if !ok {
+			continue
+		}
+
+		nDiscrepancies, err := r.reconcileCoin(coinType, ab, report)
+		if err != nil {
+			return nil, err
+		}
+
+		n := new(expvar.Int)
+		n.Set(int64(nDiscrepancies))
+		balanceDiscrepancies.Set(coinType, n)
+	}
+
+	r.Lock()
+	r.report = report
+	r.Unlock()
+
+	return report, nil
+}
+
+// reconcileCoin compares the balances of the deposit addresses of a coin type and adds the results to report.
+// Returns the number of discrepancies found
+func (r *BalanceReconciler) reconcileCoin(coinType string, ab AddressBalancer, report *BalanceReport) (int, error) {
+	log := r.log.WithField("coinType", coinType)
+
+	addrs, err := r.store.GetScanAddresses(coinType)
+	if err != nil {
+		return 0, err
+	}
+
+	totals, err := r.store.GetDepositTotals(coinType)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, addr := range addrs {
+		balance, err := ab.AddressBalance(context.Background(), addr)
+		switch err {
+		case nil:
+		case ErrAddressBalanceUnavailable:
+			log.Debug("Address balances are unavailable")
+			return n, nil
+		default:
+			log.WithError(err).WithField("addr", addr).Error("AddressBalance failed")
+			report.Errors++
+			continue
+		}
+
+		report.Addresses++
+
+		if balance <= totals[addr] {
+			continue
+		}
+
+		d := BalanceDiscrepancy{
+			CoinType:        coinType,
+			Address:         addr,
+			ChainBalance:    balance,
+			RecordedBalance: totals[addr],
+		}
+		log.WithField("discrepancy", d).Warn("Deposit address balance exceeds its recorded deposits")
+		report.Discrepancies = append(report.Discrepancies, d)
+		n++
+	}
+
+	return n, nil
+}
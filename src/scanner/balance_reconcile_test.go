@@ -0,0 +1,147 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+// balanceEthrpcclient is an ethereum client that reads address balances
+type balanceEthrpcclient struct {
+	*dummyEthrpcclient
+	balances map[string]*big.Int
+}
+
+func (c *balanceEthrpcclient) BalanceAt(ctx context.Context, addr string, height int64) (*big.Int, error) {
+	b, ok := c.balances[addr]
+	if !ok {
+		return nil, errors.New("geth unavailable")
+	}
+	return b, nil
+}
+
+func pushTestDeposits(t *testing.T, store *Store, dvs ...Deposit) {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		for _, dv := range dvs {
+			if err := store.pushDepositTx(tx, dv); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestBalanceReconcilerReconcile(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	require.NoError(t, store.AddSupportedCoin(CoinTypeETH))
+
+	matchedAddr := "0x2cf014d432e92685ef1cf7bc7967a4e4debca092"
+	exceededAddr := "0x87b127ee022abcf9881b9bad6bb6aac25229dff0"
+	emptyAddr := "0xbfc39b6f805a9e40e77291aff27aee3c96915bdd"
+	unreadableAddr := "0x930e227b4e46412bb33717e480c3fbd3e0ce325c"
+	for _, addr := range []string{matchedAddr, exceededAddr, emptyAddr, unreadableAddr} {
+		require.NoError(t, store.AddScanAddress(addr, CoinTypeETH))
+	}
+
+	// ETH deposit values are recorded in Gwei
+	pushTestDeposits(t, store, Deposit{
+		CoinType: CoinTypeETH,
+		Address:  matchedAddr,
+		Value:    1e9,
+		Height:   10,
+		Tx:       "foo-tx",
+	}, Deposit{
+		CoinType: CoinTypeETH,
+		Address:  matchedAddr,
+		Value:    5e8,
+		Height:   11,
+		Tx:       "bar-tx",
+	}, Deposit{
+		CoinType: CoinTypeETH,
+		Address:  exceededAddr,
+		Value:    1e9,
+		Height:   11,
+		Tx:       "baz-tx",
+	})
+
+	client := &balanceEthrpcclient{
+		dummyEthrpcclient: &dummyEthrpcclient{},
+		balances: map[string]*big.Int{
+			matchedAddr:  big.NewInt(15e17),
+			exceededAddr: big.NewInt(2e18),
+			emptyAddr:    big.NewInt(0),
+		},
+	}
+
+	scr, err := NewETHScanner(log, store, client, Config{})
+	require.NoError(t, err)
+
+	m := NewMultiplexer(log)
+	require.NoError(t, m.AddScanner(scr, CoinTypeETH))
+
+	// Scanners that can't read balances are skipped
+	require.NoError(t, m.AddScanner(NewDummyScanner(log), CoinTypeBTC))
+
+	r := NewBalanceReconciler(log, store, m, time.Hour)
+	require.Nil(t, r.Report())
+
+	// The balance exceeding the recorded deposits is flagged
+	report, err := r.Reconcile()
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Addresses)
+	require.Equal(t, 1, report.Errors)
+	require.Equal(t, []BalanceDiscrepancy{
+		{
+			CoinType:        CoinTypeETH,
+			Address:         exceededAddr,
+			ChainBalance:    2e9,
+			RecordedBalance: 1e9,
+		},
+	}, report.Discrepancies)
+	require.Equal(t, report, r.Report())
+	require.Equal(t, "1", balanceDiscrepancies.Get(CoinTypeETH).String())
+
+	// Once the missed deposit is recorded the balances match, nothing is flagged
+	pushTestDeposits(t, store, Deposit{
+		CoinType: CoinTypeETH,
+		Address:  exceededAddr,
+		Value:    1e9,
+		Height:   12,
+		Tx:       "qux-tx",
+	})
+
+	report, err = r.Reconcile()
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Addresses)
+	require.Empty(t, report.Discrepancies)
+	require.Equal(t, "0", balanceDiscrepancies.Get(CoinTypeETH).String())
+
+	// A balance below the recorded deposits, e.g. after a sweep, is not flagged
+	client.balances[matchedAddr] = big.NewInt(0)
+
+	report, err = r.Reconcile()
+	require.NoError(t, err)
+	require.Empty(t, report.Discrepancies)
+
+	// The client can't read balances
+	scr.ethClient = &dummyEthrpcclient{}
+
+	report, err = r.Reconcile()
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Addresses)
+	require.Equal(t, 0, report.Errors)
+	require.Empty(t, report.Discrepancies)
+}
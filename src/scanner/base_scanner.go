@@ -1,24 +1,50 @@
 package scanner
 
 import (
+	"errors"
+	"expvar"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
+
+	"github.com/MDLlife/teller/src/util/mathutil"
 )
 
 const (
-	blockScanPeriod   = time.Second * 5
-	depositBufferSize = 100
+	blockScanPeriod      = time.Second * 5
+	depositBufferSize    = 100
+	shutdownDrainTimeout = time.Second * 10
+)
+
+var (
+	// ErrScannerNotPaused is returned if the scan height is changed while the scanner is running
+	ErrScannerNotPaused = errors.New("The scanner must be paused to change the scan height")
+
+	// scannerStalls counts, per coin type, how many times a scanner's watchdog fired
+	scannerStalls = expvar.NewMap("scanner_stalls")
 )
 
 // CommonScanner defines the interface a scanner should implement
 type CommonScanner interface {
 	GetScanPeriod() time.Duration
 	GetStorer() Storer
+	ScanBlock(*CommonBlock) ([]Deposit, error)
+	ReplayBlock(*CommonBlock) (*BlockReplay, error)
 	GetDeposit() <-chan DepositNote
 	GetQuitChan() <-chan struct{}
 	GetScannedDepositChan() chan<- Deposit
+	Healthy() bool
+	ScannedHeight() int64
+	Pause()
+	Resume()
+	Paused() bool
+	StoredScanHeight() (int64, error)
+	SetStoredScanHeight(int64) (int64, error)
+	PendingDeposits() []PendingDeposit
+	CheckDepositDepth(Deposit, int64) error
 	Shutdown()
 	Run(
 		getBlockCount func() (int64, error),
@@ -39,6 +65,36 @@ type BaseScanner struct {
 	quit            chan struct{}
 	done            chan struct{}
 	CoinType        string
+
+	// Watchdog state, see runWatchdog
+	healthLock      sync.RWMutex
+	healthy         bool
+	bestHeight      int64
+	heightUpdatedAt time.Time
+
+	// Height of the last block scanned, see ScannedHeight
+	scannedHeight int64
+
+	// Pause state, see Pause and SetStoredScanHeight.
+	// scanLock is held while a block is scanned
+	scanLock sync.Mutex
+	paused   bool
+	seeking  bool
+	seekTo   int64
+
+	// Reports whether the deposit's transaction is confirmed, replacing the ConfirmationsRequired depth.
+	// Set by the scanners that support Config.ConfirmByTxStatus
+	txConfirmed func(Deposit) (bool, error)
+
+	// Heights of the scanned deposits the exchange has not recorded yet, by deposit ID, see Cfg.MaxBlockLookback.
+	// pendingDone is signalled when one of them is recorded
+	pendingLock sync.Mutex
+	pending     map[string]int64
+	pendingDone chan struct{}
+
+	// Deposits held back by the deposit pipe until they have their required confirmations, see PendingDeposits
+	heldLock sync.Mutex
+	held     []Deposit
 }
 
 // CommonVout common transaction output info
@@ -71,6 +127,11 @@ func NewBaseScanner(store Storer, log logrus.FieldLogger, coinType string, cfg C
 	if cfg.DepositBufferSize == 0 {
 		cfg.DepositBufferSize = depositBufferSize
 	}
+
+	if cfg.ShutdownDrainTimeout == 0 {
+		cfg.ShutdownDrainTimeout = shutdownDrainTimeout
+	}
+
 	return &BaseScanner{
 		log:             log,
 		store:           store,
@@ -80,6 +141,9 @@ func NewBaseScanner(store Storer, log logrus.FieldLogger, coinType string, cfg C
 		done:            make(chan struct{}),
 		Cfg:             cfg,
 		CoinType:        coinType,
+		healthy:         true,
+		pending:         make(map[string]int64),
+		pendingDone:     make(chan struct{}, 1),
 	}
 }
 
@@ -110,21 +174,21 @@ func (s *BaseScanner) loadUnprocessedDeposits() error {
 // processDeposit sends a deposit to depositC, which is read by exchange.Exchange.
 // Exchange will reply with an error or nil on the DepositNote's ErrC channel.
 // If no error is reported, the deposit will be marked as "processed".
-// If this exits early, or the exchange reported an error, the deposit will
-// not be marked as processed. When restarted, unprocessed deposits will be
-// sent to the exchange for processing again.
-func (s *BaseScanner) processDeposit(dv Deposit) error {
+// If this exits early because abort was closed, or the exchange reported an error,
+// the deposit will not be marked as processed. When restarted, unprocessed
+// deposits will be sent to the exchange for processing again.
+func (s *BaseScanner) processDeposit(dv Deposit, abort <-chan struct{}) error {
 	log := s.log.WithField("deposit", dv)
 	log.Info("Sending deposit to depositC")
 
 	dn := NewDepositNote(dv)
 
 	select {
-	case <-s.quit:
+	case <-abort:
 		return errQuit
 	case s.depositC <- dn:
 		select {
-		case <-s.quit:
+		case <-abort:
 			return errQuit
 		case err, ok := <-dn.ErrC:
 			if err == nil {
@@ -147,6 +211,173 @@ func (s *BaseScanner) processDeposit(dv Deposit) error {
 	return nil
 }
 
+// requiredConfirmations returns the number of confirmations the deposit's block needs
+// before the deposit is sent to the exchange
+func (s *BaseScanner) requiredConfirmations(dv Deposit) int64 {
+	confirmations := s.Cfg.ConfirmationsRequired
+	if s.Cfg.LargeDepositValue > 0 && dv.Value >= s.Cfg.LargeDepositValue && s.Cfg.LargeDepositConfirmations > s.Cfg.ConfirmationsRequired {
+		confirmations = s.Cfg.LargeDepositConfirmations
+	}
+
+	if weighted := s.weightedConfirmations(dv); weighted > confirmations {
+		confirmations = weighted
+	}
+
+	return confirmations
+}
+
+// weightedConfirmations returns the confirmations required for the USD value of the deposit,
+// see Config.ConfirmationsUSDPerBlock. Returns ConfirmationsRequired if disabled.
+// If the USD value can't be computed, the deposit waits for MaxConfirmations
+func (s *BaseScanner) weightedConfirmations(dv Deposit) int64 {
+	if s.Cfg.ConfirmationsUSDPerBlock == "" {
+		return s.Cfg.ConfirmationsRequired
+	}
+
+	log := s.log.WithField("deposit", dv)
+
+	usdPerBlock, err := decimal.NewFromString(s.Cfg.ConfirmationsUSDPerBlock)
+	if err != nil {
+		log.WithError(err).Error("Invalid ConfirmationsUSDPerBlock, waiting for MaxConfirmations")
+		return s.Cfg.MaxConfirmations
+	}
+
+	usdRate, err := decimal.NewFromString(s.Cfg.USDRate)
+	if err != nil {
+		log.WithError(err).Error("Invalid USDRate, waiting for MaxConfirmations")
+		return s.Cfg.MaxConfirmations
+	}
+
+	amount, err := depositAmount(s.CoinType, dv.Value)
+	if err != nil {
+		log.WithError(err).Error("depositAmount failed, waiting for MaxConfirmations")
+		return s.Cfg.MaxConfirmations
+	}
+
+	return amountWeightedConfirmations(s.Cfg.ConfirmationsRequired, amount.Mul(usdRate), usdPerBlock, s.Cfg.MaxConfirmations)
+}
+
+// amountWeightedConfirmations returns base plus one confirmation per usdPerBlock of amountUSD, rounded up,
+// capped at max
+func amountWeightedConfirmations(base int64, amountUSD, usdPerBlock decimal.Decimal, max int64) int64 {
+	if max <= base {
+		return base
+	}
+
+	if usdPerBlock.Sign() <= 0 {
+		return max
+	}
+
+	extra := amountUSD.Div(usdPerBlock).Ceil()
+	if extra.GreaterThanOrEqual(decimal.New(max-base, 0)) {
+		return max
+	}
+
+	if extra.Sign() <= 0 {
+		return base
+	}
+
+	return base + extra.IntPart()
+}
+
+// depositAmount converts the value of a deposit, in the unit recorded by the coin's scanner, to an amount of the coin
+func depositAmount(coinType string, value int64) (decimal.Decimal, error) {
+	switch coinType {
+	case CoinTypeBTC:
+		return mathutil.IntToBTC(value), nil
+	case CoinTypeETH:
+		return mathutil.IntToETH(value), nil
+	case CoinTypeSKY:
+		return mathutil.IntToSKY(value), nil
+	case CoinTypeWAVES, CoinTypeWAVESMDL:
+		return mathutil.IntToWAV(value), nil
+	default:
+		return decimal.Decimal{}, ErrUnsupportedCoinType
+	}
+}
+
+// depositConfirmed returns true if the deposit's block has the confirmations required for the deposit's value.
+// With txConfirmed set, its transaction must be confirmed instead of having Cfg.ConfirmationsRequired,
+// larger deposits still wait for their extra confirmations
+func (s *BaseScanner) depositConfirmed(dv Deposit) bool {
+	if s.txConfirmed != nil {
+		confirmed, err := s.txConfirmed(dv)
+		if err != nil {
+			s.log.WithError(err).WithField("deposit", dv).Warn("Checking the deposit transaction status failed")
+			return false
+		}
+		if !confirmed {
+			return false
+		}
+	}
+
+	confirmations := s.requiredConfirmations(dv)
+
+	// Blocks are only scanned once they have Cfg.ConfirmationsRequired
+	if confirmations <= s.Cfg.ConfirmationsRequired {
+		return true
+	}
+
+	s.healthLock.RLock()
+	defer s.healthLock.RUnlock()
+	return dv.Height+confirmations <= s.bestHeight
+}
+
+// CheckDepositDepth returns ErrDepositUnconfirmed unless the deposit's block has the confirmations
+// required for the deposit's value at bestHeight, see requiredConfirmations
+func (s *BaseScanner) CheckDepositDepth(dv Deposit, bestHeight int64) error {
+	if dv.Height+s.requiredConfirmations(dv) > bestHeight {
+		return ErrDepositUnconfirmed
+	}
+
+	return nil
+}
+
+// setHeld records the deposits the deposit pipe holds back, see PendingDeposits
+func (s *BaseScanner) setHeld(held []Deposit) {
+	s.heldLock.Lock()
+	defer s.heldLock.Unlock()
+	s.held = append([]Deposit(nil), held...)
+}
+
+// PendingDeposits returns the scanned deposits that are waiting for more confirmations before they are sent
+// to the exchange, with their current and required confirmations. Deposits in blocks that don't have
+// Cfg.ConfirmationsRequired yet are not scanned, so they are not known to the scanner and are not returned
+func (s *BaseScanner) PendingDeposits() []PendingDeposit {
+	s.heldLock.Lock()
+	held := append([]Deposit(nil), s.held...)
+	s.heldLock.Unlock()
+
+	s.healthLock.RLock()
+	bestHeight := s.bestHeight
+	s.healthLock.RUnlock()
+
+	pending := make([]PendingDeposit, 0, len(held))
+	for _, dv := range held {
+		confirmations := bestHeight - dv.Height
+		if confirmations < 0 {
+			confirmations = 0
+		}
+
+		pending = append(pending, PendingDeposit{
+			Deposit:               dv,
+			Confirmations:         confirmations,
+			RequiredConfirmations: s.requiredConfirmations(dv),
+		})
+	}
+
+	return pending
+}
+
+// scanDepth returns the confirmations a block needs before it is scanned.
+// It is 0 if deposits are confirmed by the status of their transaction instead
+func (s *BaseScanner) scanDepth() int64 {
+	if s.txConfirmed != nil {
+		return 0
+	}
+	return s.Cfg.ConfirmationsRequired
+}
+
 // GetScanPeriod returns scan period
 func (s *BaseScanner) GetScanPeriod() time.Duration {
 	return s.Cfg.ScanPeriod
@@ -157,6 +388,82 @@ func (s *BaseScanner) GetStorer() Storer {
 	return s.store
 }
 
+// ScanBlock scans a block for deposits to the scan addresses and records them.
+// Deposits with a value below Cfg.DustValue are ignored, they are neither recorded nor sent to the exchange
+func (s *BaseScanner) ScanBlock(block *CommonBlock) ([]Deposit, error) {
+	dvs, err := s.store.ScanBlock(block, s.CoinType, s.Cfg.DustValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Cfg.MaxBlockLookback > 0 {
+		s.pendingLock.Lock()
+		for _, dv := range dvs {
+			s.pending[dv.ID()] = dv.Height
+		}
+		s.pendingLock.Unlock()
+	}
+
+	return dvs, nil
+}
+
+// removePending forgets a deposit once the exchange has recorded it or failed to.
+// A deposit that failed is sent again on restart, it no longer holds back the scanner until then
+func (s *BaseScanner) removePending(dv Deposit) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	if _, ok := s.pending[dv.ID()]; !ok {
+		return
+	}
+
+	delete(s.pending, dv.ID())
+
+	select {
+	case s.pendingDone <- struct{}{}:
+	default:
+	}
+}
+
+// oldestPendingHeight returns the lowest block height of the scanned deposits the exchange has not recorded yet.
+// Returns false if there are none
+func (s *BaseScanner) oldestPendingHeight() (int64, bool) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	var oldest int64
+	found := false
+	for _, height := range s.pending {
+		if !found || height < oldest {
+			oldest = height
+			found = true
+		}
+	}
+
+	return oldest, found
+}
+
+// lookbackExceeded returns true if scanning the block at height would get the scanner more than
+// Cfg.MaxBlockLookback blocks ahead of the oldest deposit the exchange has not recorded yet,
+// along with the height of that deposit
+func (s *BaseScanner) lookbackExceeded(height int64) (int64, bool) {
+	if s.Cfg.MaxBlockLookback <= 0 {
+		return 0, false
+	}
+
+	oldest, ok := s.oldestPendingHeight()
+	if !ok {
+		return 0, false
+	}
+
+	return oldest, height-oldest > s.Cfg.MaxBlockLookback
+}
+
+// ReplayBlock runs a block through the deposit matching of ScanBlock without recording anything, see Store.ReplayBlock
+func (s *BaseScanner) ReplayBlock(block *CommonBlock) (*BlockReplay, error) {
+	return s.store.ReplayBlock(block, s.CoinType, s.Cfg.DustValue)
+}
+
 // GetDeposit returns channel of depositnote
 func (s *BaseScanner) GetDeposit() <-chan DepositNote {
 	return s.depositC
@@ -172,6 +479,176 @@ func (s *BaseScanner) GetScannedDepositChan() chan<- Deposit {
 	return s.scannedDeposits
 }
 
+// Healthy returns false if the watchdog detected that the best block height stopped advancing
+func (s *BaseScanner) Healthy() bool {
+	s.healthLock.RLock()
+	defer s.healthLock.RUnlock()
+	return s.healthy
+}
+
+// ScannedHeight returns the height of the last block that was scanned.
+// It only advances once every block below it has been scanned.
+func (s *BaseScanner) ScannedHeight() int64 {
+	return atomic.LoadInt64(&s.scannedHeight)
+}
+
+// setScannedHeight records the height of the last block scanned
+func (s *BaseScanner) setScannedHeight(height int64) {
+	atomic.StoreInt64(&s.scannedHeight, height)
+}
+
+// Pause stops the scanner from scanning blocks until Resume is called.
+// If a block is being scanned, Pause returns once it has been scanned.
+// Deposits that were already scanned are still sent to the exchange while paused.
+func (s *BaseScanner) Pause() {
+	s.scanLock.Lock()
+	defer s.scanLock.Unlock()
+
+	if !s.paused {
+		s.paused = true
+		s.log.Warnf("%s scanner paused", s.CoinType)
+	}
+}
+
+// Resume resumes scanning after Pause. If the scan height was changed while paused,
+// scanning continues from the new scan height
+func (s *BaseScanner) Resume() {
+	s.scanLock.Lock()
+	defer s.scanLock.Unlock()
+
+	if s.paused {
+		s.paused = false
+		s.log.Infof("%s scanner resumed", s.CoinType)
+	}
+}
+
+// Paused returns true if the scanner is paused
+func (s *BaseScanner) Paused() bool {
+	s.scanLock.Lock()
+	defer s.scanLock.Unlock()
+	return s.paused
+}
+
+// StoredScanHeight returns the height scanning resumes from when the scanner is restarted.
+// This is the height of the last block scanned, which is scanned again on restart.
+// If no block has been scanned yet, it is Cfg.InitialScanHeight
+func (s *BaseScanner) StoredScanHeight() (int64, error) {
+	height, ok, err := s.store.GetScanHeight(s.CoinType)
+	if err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		return s.Cfg.InitialScanHeight, nil
+	}
+
+	return height, nil
+}
+
+// SetStoredScanHeight changes the height scanning resumes from, to skip blocks or to scan them again.
+// Deposits already recorded are not sent to the exchange again when their block is scanned again.
+// The scanner must be paused, otherwise ErrScannerNotPaused is returned.
+// Returns the previous scan height
+func (s *BaseScanner) SetStoredScanHeight(height int64) (int64, error) {
+	if height < 0 {
+		return 0, errors.New("scan height must not be negative")
+	}
+
+	s.scanLock.Lock()
+	defer s.scanLock.Unlock()
+
+	if !s.paused {
+		return 0, ErrScannerNotPaused
+	}
+
+	prevHeight, err := s.StoredScanHeight()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.store.SetScanHeight(s.CoinType, height); err != nil {
+		return 0, err
+	}
+
+	log := s.log.WithFields(logrus.Fields{
+		"scanHeight":         height,
+		"previousScanHeight": prevHeight,
+	})
+	if height < prevHeight {
+		log.Warnf("%s scan height moved backward, blocks will be scanned again", s.CoinType)
+	} else {
+		log.Infof("%s scan height changed", s.CoinType)
+	}
+
+	s.seeking = true
+	s.seekTo = height
+
+	return prevHeight, nil
+}
+
+// storeScanHeight records the height of the last block scanned in the store, to resume from it on restart
+func (s *BaseScanner) storeScanHeight(log logrus.FieldLogger, height int64) {
+	if err := s.store.SetScanHeight(s.CoinType, height); err != nil {
+		log.WithError(err).Error("store.SetScanHeight failed, scanning will resume from an earlier block on restart")
+	}
+}
+
+// observeHeight records the best block height reported by the node
+func (s *BaseScanner) observeHeight(log logrus.FieldLogger, height int64) {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+
+	if height <= s.bestHeight {
+		return
+	}
+
+	s.bestHeight = height
+	s.heightUpdatedAt = time.Now()
+
+	if !s.healthy {
+		s.healthy = true
+		log.Infof("%s best height advanced, scanner is healthy again", s.CoinType)
+	}
+}
+
+// checkStalled marks the scanner unhealthy if the best height has not advanced within Cfg.StallTimeout.
+// Returns true if the scanner is stalled.
+func (s *BaseScanner) checkStalled(log logrus.FieldLogger, now time.Time) bool {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+
+	stalledFor := now.Sub(s.heightUpdatedAt)
+	if stalledFor <= s.Cfg.StallTimeout {
+		return false
+	}
+
+	if s.healthy {
+		s.healthy = false
+		scannerStalls.Add(s.CoinType, 1)
+		log.WithFields(logrus.Fields{
+			"bestHeight": s.bestHeight,
+			"stalledFor": stalledFor,
+		}).Errorf("%s best height has not advanced within stall_timeout, the node may be stuck", s.CoinType)
+	}
+
+	return true
+}
+
+// runWatchdog periodically checks that the best block height is advancing
+func (s *BaseScanner) runWatchdog(log logrus.FieldLogger) {
+	ticker := time.NewTicker(s.Cfg.StallTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case now := <-ticker.C:
+			s.checkStalled(log, now)
+		}
+	}
+}
+
 // Shutdown shutdown base scanner
 func (s *BaseScanner) Shutdown() {
 	close(s.quit)
@@ -195,6 +672,20 @@ func (s *BaseScanner) Run(
 
 	var wg sync.WaitGroup
 
+	s.healthLock.Lock()
+	s.heightUpdatedAt = time.Now()
+	s.healthLock.Unlock()
+
+	if s.Cfg.StallTimeout > 0 {
+		log.Info("Launching watchdog goroutine")
+		wg.Add(1)
+		go func(log logrus.FieldLogger) {
+			defer wg.Done()
+			defer log.Info("Watchdog goroutine exited")
+			s.runWatchdog(log)
+		}(log)
+	}
+
 	// Load unprocessed deposits
 	log.Info("Loading unprocessed deposits")
 	if err := s.loadUnprocessedDeposits(); err != nil {
@@ -206,9 +697,16 @@ func (s *BaseScanner) Run(
 		return err
 	}
 
-	// Load the initial scan block
+	// Load the initial scan block. Scanning resumes from the last block scanned before
+	// a restart, or from Cfg.InitialScanHeight if no block has been scanned yet
 	log.Info("Loading the initial scan block")
-	initialBlock, err := getBlockAtHeight(s.Cfg.InitialScanHeight)
+	startHeight, err := s.StoredScanHeight()
+	if err != nil {
+		log.WithError(err).Error("StoredScanHeight failed")
+		return err
+	}
+
+	initialBlock, err := getBlockAtHeight(startHeight)
 	if err != nil {
 		log.WithError(err).Error("getBlockAtHeight failed")
 		return err
@@ -240,6 +738,9 @@ func (s *BaseScanner) Run(
 			}
 		}
 
+		// Blocks fetched ahead of the current block by fetchBlockWindow, in height order
+		var pending []*CommonBlock
+
 		deposits := 0
 		for {
 			select {
@@ -248,6 +749,39 @@ func (s *BaseScanner) Run(
 			default:
 			}
 
+			// While paused, no blocks are scanned. If the scan height was changed,
+			// scanning continues from the block at the new scan height
+			s.scanLock.Lock()
+			paused, seeking, seekTo := s.paused, s.seeking, s.seekTo
+			s.scanLock.Unlock()
+
+			if paused {
+				if wait() != nil {
+					return
+				}
+				continue
+			}
+
+			if seeking {
+				seekBlock, err := getBlockAtHeight(seekTo)
+				if err != nil {
+					log.WithError(err).WithField("scanHeight", seekTo).Error("getBlockAtHeight of the new scan height failed")
+					if wait() != nil {
+						return
+					}
+					continue
+				}
+
+				s.scanLock.Lock()
+				if s.seekTo == seekTo {
+					s.seeking = false
+				}
+				s.scanLock.Unlock()
+
+				block = seekBlock
+				pending = nil
+			}
+
 			blockHash, blockHeight := getBlockHashAndHeight(block)
 			log = log.WithFields(logrus.Fields{
 				"height": blockHeight,
@@ -266,9 +800,10 @@ func (s *BaseScanner) Run(
 			}
 
 			log = log.WithField("bestHeight", bestHeight)
+			s.observeHeight(log, bestHeight)
 
 			// If not enough confirmations exist for this block, wait
-			if blockHeight+s.Cfg.ConfirmationsRequired > bestHeight {
+			if blockHeight+s.scanDepth() > bestHeight {
 				log.Info("Not enough confirmations, waiting")
 				if wait() != nil {
 					return
@@ -276,8 +811,36 @@ func (s *BaseScanner) Run(
 				continue
 			}
 
-			// Scan the block for deposits
+			// While catching up, don't get too far ahead of the exchange, so that the scanned deposits
+			// it has not recorded yet don't pile up in memory. Wait until it records the oldest one
+			if oldest, exceeded := s.lookbackExceeded(blockHeight); exceeded {
+				log.WithFields(logrus.Fields{
+					"oldestPendingHeight": oldest,
+					"maxBlockLookback":    s.Cfg.MaxBlockLookback,
+				}).Info("Too far ahead of the deposits the exchange has not recorded yet, waiting")
+				select {
+				case <-s.quit:
+					return
+				case <-s.pendingDone:
+				case <-time.After(s.Cfg.ScanPeriod):
+				}
+				continue
+			}
+
+			// Scan the block for deposits, unless the scanner was paused in the meantime
+			s.scanLock.Lock()
+			if s.paused || s.seeking {
+				s.scanLock.Unlock()
+				continue
+			}
+
 			n, err := scanBlock(block)
+			if err == nil {
+				s.setScannedHeight(blockHeight)
+				s.storeScanHeight(log, blockHeight)
+			}
+			s.scanLock.Unlock()
+
 			if err != nil {
 				if err == errQuit {
 					return
@@ -298,6 +861,24 @@ func (s *BaseScanner) Run(
 				"coinType":             s.CoinType,
 			}).Infof("Scanned %d deposits from block", n)
 
+			// While catching up, fetch the next window of confirmed blocks concurrently.
+			// The blocks are still scanned one at a time in height order.
+			if len(pending) == 0 && s.Cfg.BlockWindow > 1 {
+				last := bestHeight - s.scanDepth()
+				if windowEnd := blockHeight + int64(s.Cfg.BlockWindow); last > windowEnd {
+					last = windowEnd
+				}
+				if last > blockHeight {
+					pending = s.fetchBlockWindow(log, getBlockAtHeight, blockHeight+1, last)
+				}
+			}
+
+			if len(pending) > 0 {
+				block = pending[0]
+				pending = pending[1:]
+				continue
+			}
+
 			// Wait for the next block
 			block, err = waitForNextBlock(block)
 			if err != nil {
@@ -314,27 +895,94 @@ func (s *BaseScanner) Run(
 		}
 	}(log, initialBlock)
 
+	// abort is closed once Cfg.ShutdownDrainTimeout has elapsed after quit,
+	// to stop waiting on an exchange that is no longer reading deposits
+	abort := make(chan struct{})
+	pipeDone := make(chan struct{})
+	go func() {
+		defer close(abort)
+		select {
+		case <-s.quit:
+		case <-pipeDone:
+			return
+		}
+		select {
+		case <-time.After(s.Cfg.ShutdownDrainTimeout):
+		case <-pipeDone:
+		}
+	}()
+
 	// This loop gets the head deposit value (from an array saved in the db)
 	// It sends each head to depositC, which is processed by Exchange.
-	// The loop blocks until the Exchange writes to the ErrC channel
+	// The loop blocks until the Exchange writes to the ErrC channel.
+	// Large deposits that need more confirmations than their block had when it was scanned
+	// are held back, and rechecked every ScanPeriod.
+	// On quit, deposits still buffered in scannedDeposits are drained to the
+	// Exchange before exiting, so that they are recorded without waiting for a restart.
 	log.Info("Launching deposit pipe goroutine")
 	wg.Add(1)
 	go func(log logrus.FieldLogger) {
 		defer wg.Done()
+		defer close(pipeDone)
 		defer log.Info("Deposit pipe goroutine exited")
+
+		// Returns errQuit if the deposit pipe should exit
+		process := func(dv Deposit) error {
+			if err := s.processDeposit(dv, abort); err != nil {
+				if err == errQuit {
+					return err
+				}
+
+				msg := "processDeposit failed. This deposit will be reprocessed the next time the scanner is run."
+				s.log.WithField("deposit", dv).WithError(err).Error(msg)
+			}
+			s.removePending(dv)
+			return nil
+		}
+
+		var held []Deposit
 		for {
+			var recheck <-chan time.Time
+			if len(held) > 0 {
+				recheck = time.After(s.Cfg.ScanPeriod)
+			}
+
 			select {
 			case <-s.quit:
+				s.drainScannedDeposits(log, abort)
 				return
 			case dv := <-s.scannedDeposits:
-				if err := s.processDeposit(dv); err != nil {
-					if err == errQuit {
-						return
+				if !s.depositConfirmed(dv) {
+					msg := "Large deposit, waiting for more confirmations"
+					if s.txConfirmed != nil {
+						msg = "Deposit not confirmed yet, waiting for its transaction to be confirmed"
+					}
+					log.WithFields(logrus.Fields{
+						"deposit":               dv,
+						"requiredConfirmations": s.requiredConfirmations(dv),
+					}).Info(msg)
+					held = append(held, dv)
+					s.setHeld(held)
+					continue
+				}
+
+				if process(dv) == errQuit {
+					return
+				}
+			case <-recheck:
+				var stillHeld []Deposit
+				for _, dv := range held {
+					if !s.depositConfirmed(dv) {
+						stillHeld = append(stillHeld, dv)
+						continue
 					}
 
-					msg := "processDeposit failed. This deposit will be reprocessed the next time the scanner is run."
-					s.log.WithField("deposit", dv).WithError(err).Error(msg)
+					if process(dv) == errQuit {
+						return
+					}
 				}
+				held = stillHeld
+				s.setHeld(held)
 			}
 		}
 	}(log)
@@ -345,6 +993,67 @@ func (s *BaseScanner) Run(
 
 }
 
+// drainScannedDeposits sends any deposits remaining in scannedDeposits to the exchange.
+// It is called on shutdown, and stops early if abort is closed.
+func (s *BaseScanner) drainScannedDeposits(log logrus.FieldLogger, abort <-chan struct{}) {
+	log.WithField("depositsLen", len(s.scannedDeposits)).Info("Draining scanned deposits")
+
+	for {
+		select {
+		case dv := <-s.scannedDeposits:
+			// Large deposits without enough confirmations remain unprocessed, to be resent on restart
+			if !s.depositConfirmed(dv) {
+				continue
+			}
+
+			if err := s.processDeposit(dv, abort); err != nil {
+				if err == errQuit {
+					log.WithField("depositsLen", len(s.scannedDeposits)+1).Warn("Drain timed out. Remaining deposits will be reprocessed the next time the scanner is run.")
+					return
+				}
+
+				msg := "processDeposit failed. This deposit will be reprocessed the next time the scanner is run."
+				log.WithField("deposit", dv).WithError(err).Error(msg)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// fetchBlockWindow fetches the blocks from start to end height, inclusive, concurrently.
+// The blocks are returned in height order. If a block cannot be fetched, only the blocks
+// below it are returned, so that the caller never skips an unscanned block.
+func (s *BaseScanner) fetchBlockWindow(log logrus.FieldLogger, getBlockAtHeight func(int64) (*CommonBlock, error), start, end int64) []*CommonBlock {
+	blocks := make([]*CommonBlock, end-start+1)
+	errs := make([]error, len(blocks))
+
+	var wg sync.WaitGroup
+	for i := range blocks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			blocks[i], errs[i] = getBlockAtHeight(start + int64(i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, b := range blocks {
+		height := start + int64(i)
+		if errs[i] != nil || b == nil || b.Height != height {
+			log.WithError(errs[i]).WithField("windowHeight", height).Debug("Fetching block window stopped")
+			return blocks[:i]
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"windowStart": start,
+		"windowEnd":   end,
+	}).Debug("Fetched block window")
+
+	return blocks
+}
+
 func getBlockHashAndHeight(block *CommonBlock) (string, int64) {
 	return block.Hash, block.Height
 }
@@ -0,0 +1,1234 @@
+package scanner
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+var errNoNewBlock = errors.New("no new block")
+
+// scannerRPC are the calls to the node a BaseScanner runs with, see BaseScanner.Run
+type scannerRPC struct {
+	getBlockCount    func() (int64, error)
+	getBlockAtHeight func(int64) (*CommonBlock, error)
+	waitForNextBlock func(*CommonBlock) (*CommonBlock, error)
+	scanBlock        func(*CommonBlock) (int, error)
+}
+
+// runTestScanner runs a BTC BaseScanner with cfg in a goroutine. Its store scans addrs and holds deposits
+// as unprocessed deposits, which the scanner sends on startup. newRPC returns the calls to the node,
+// it is given the scanner so that they can use it.
+// The error returned by Run is sent on the returned channel, which the test must read after shutting the scanner down.
+// The returned function closes the db
+func runTestScanner(t *testing.T, cfg Config, deposits []Deposit, addrs []string, newRPC func(*BaseScanner) scannerRPC) (*BaseScanner, *Store, <-chan error, func()) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	require.NoError(t, store.AddSupportedCoin(CoinTypeBTC))
+
+	for _, a := range addrs {
+		require.NoError(t, store.AddScanAddress(a, CoinTypeBTC))
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, dv := range deposits {
+			if err := store.pushDepositTx(tx, dv); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	s := NewBaseScanner(store, log, CoinTypeBTC, cfg)
+	rpc := newRPC(s)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(rpc.getBlockCount, rpc.getBlockAtHeight, rpc.waitForNextBlock, rpc.scanBlock)
+	}()
+
+	return s, store, runErr, shutdownDB
+}
+
+// noBlockScanned is the scanBlock of a scanner whose blocks have no deposits
+func noBlockScanned(*CommonBlock) (int, error) {
+	return 0, nil
+}
+
+// runWatchdogScanner runs a BaseScanner whose best height is read from height.
+// It returns the scanner and a function that shuts it down.
+func runWatchdogScanner(t *testing.T, height *int64) (*BaseScanner, func()) {
+	s, _, runErr, shutdownDB := runTestScanner(t, Config{
+		ScanPeriod:        time.Millisecond * 10,
+		InitialScanHeight: 1,
+		StallTimeout:      time.Millisecond * 200,
+	}, nil, nil, func(*BaseScanner) scannerRPC {
+		return scannerRPC{
+			getBlockCount: func() (int64, error) {
+				return atomic.LoadInt64(height), nil
+			},
+			getBlockAtHeight: func(h int64) (*CommonBlock, error) {
+				return &CommonBlock{Height: h}, nil
+			},
+			waitForNextBlock: func(*CommonBlock) (*CommonBlock, error) {
+				return nil, errNoNewBlock
+			},
+			scanBlock: noBlockScanned,
+		}
+	})
+
+	return s, func() {
+		s.Shutdown()
+		require.NoError(t, <-runErr)
+		shutdownDB()
+	}
+}
+
+func stallCount() int64 {
+	v := scannerStalls.Get(CoinTypeBTC)
+	if v == nil {
+		return 0
+	}
+	return v.(*expvar.Int).Value()
+}
+
+func waitForHealthy(t *testing.T, s *BaseScanner, healthy bool) {
+	timeout := time.After(time.Second * 3)
+	for s.Healthy() != healthy {
+		select {
+		case <-timeout:
+			t.Fatalf("Waiting for Healthy() == %v timed out", healthy)
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestBaseScannerWatchdogFires(t *testing.T) {
+	height := int64(10)
+	s, shutdown := runWatchdogScanner(t, &height)
+	defer shutdown()
+
+	stalls := stallCount()
+	require.True(t, s.Healthy())
+
+	// The height never advances past 10
+	waitForHealthy(t, s, false)
+	require.Equal(t, stalls+1, stallCount())
+
+	// The metric is incremented once per stall, not on every check
+	time.Sleep(time.Millisecond * 300)
+	require.False(t, s.Healthy())
+	require.Equal(t, stalls+1, stallCount())
+
+	// The scanner recovers once the height advances
+	atomic.StoreInt64(&height, 11)
+	waitForHealthy(t, s, true)
+}
+
+func TestBaseScannerWatchdogAdvancing(t *testing.T) {
+	height := int64(10)
+	s, shutdown := runWatchdogScanner(t, &height)
+	defer shutdown()
+
+	stalls := stallCount()
+
+	// Advance the height faster than the stall timeout
+	for i := 0; i < 10; i++ {
+		atomic.AddInt64(&height, 1)
+		time.Sleep(time.Millisecond * 50)
+		require.True(t, s.Healthy())
+	}
+
+	require.Equal(t, stalls, stallCount())
+}
+
+func TestBaseScannerCheckStalled(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	s := NewBaseScanner(nil, log, CoinTypeBTC, Config{
+		StallTimeout: time.Minute,
+	})
+
+	now := time.Now()
+	s.observeHeight(log, 100)
+
+	require.False(t, s.checkStalled(log, now.Add(time.Second*30)))
+	require.True(t, s.Healthy())
+
+	require.True(t, s.checkStalled(log, now.Add(time.Minute*2)))
+	require.False(t, s.Healthy())
+
+	// Same height does not reset the watchdog
+	s.observeHeight(log, 100)
+	require.False(t, s.Healthy())
+
+	s.observeHeight(log, 101)
+	require.True(t, s.Healthy())
+}
+
+// runDrainScanner runs a BaseScanner which loads deposits as unprocessed deposits on startup.
+// Nothing reads from GetDeposit() until the caller does so.
+func runDrainScanner(t *testing.T, deposits []Deposit, drainTimeout time.Duration) (*BaseScanner, *Store, <-chan error, func()) {
+	return runTestScanner(t, Config{
+		ScanPeriod:           time.Millisecond * 10,
+		InitialScanHeight:    1,
+		ShutdownDrainTimeout: drainTimeout,
+	}, deposits, nil, func(*BaseScanner) scannerRPC {
+		return scannerRPC{
+			getBlockCount: func() (int64, error) {
+				return 1, nil
+			},
+			getBlockAtHeight: func(h int64) (*CommonBlock, error) {
+				return &CommonBlock{Height: h}, nil
+			},
+			waitForNextBlock: func(*CommonBlock) (*CommonBlock, error) {
+				return nil, errNoNewBlock
+			},
+			scanBlock: noBlockScanned,
+		}
+	})
+}
+
+func drainTestDeposits() []Deposit {
+	var dvs []Deposit
+	for i := 0; i < 3; i++ {
+		dvs = append(dvs, Deposit{
+			CoinType: CoinTypeBTC,
+			Address:  "1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+			Value:    1e8,
+			Height:   1,
+			Tx:       "drain-tx",
+			N:        uint32(i),
+		})
+	}
+	return dvs
+}
+
+func TestBaseScannerShutdownDrainsDeposits(t *testing.T) {
+	deposits := drainTestDeposits()
+	s, store, runErr, shutdownDB := runDrainScanner(t, deposits, time.Second*3)
+	defer shutdownDB()
+
+	// Wait for the unprocessed deposits to be loaded into the channel.
+	// The first is held by the deposit pipe, the others sit in the channel.
+	time.Sleep(time.Millisecond * 200)
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		s.Shutdown()
+	}()
+
+	// The exchange acknowledges the deposits after shutdown began
+	var received []DepositNote
+	for dn := range s.GetDeposit() {
+		received = append(received, dn)
+		dn.ErrC <- nil
+	}
+
+	<-shutdownDone
+	require.NoError(t, <-runErr)
+
+	require.Len(t, received, len(deposits))
+
+	dvs, err := store.GetUnprocessedDeposits(CoinTypeBTC)
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+}
+
+func TestBaseScannerShutdownDrainTimeout(t *testing.T) {
+	deposits := drainTestDeposits()
+	s, store, runErr, shutdownDB := runDrainScanner(t, deposits, time.Millisecond*100)
+	defer shutdownDB()
+
+	time.Sleep(time.Millisecond * 200)
+
+	// Nothing reads the deposits, shutdown gives up after the drain timeout
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		s.Shutdown()
+	}()
+
+	select {
+	case <-shutdownDone:
+	case <-time.After(time.Second * 3):
+		t.Fatal("Shutdown did not finish after the drain timeout")
+	}
+	require.NoError(t, <-runErr)
+
+	// The deposits remain unprocessed, to be resent on restart
+	dvs, err := store.GetUnprocessedDeposits(CoinTypeBTC)
+	require.NoError(t, err)
+	require.Len(t, dvs, len(deposits))
+}
+
+const windowTestChainHeight = 20
+
+// windowTestChain returns blocks at heights 1 to windowTestChainHeight,
+// with deposits to windowTestAddrs in some of them
+func windowTestChain() map[int64]*CommonBlock {
+	blocks := make(map[int64]*CommonBlock, windowTestChainHeight)
+	for h := int64(1); h <= windowTestChainHeight; h++ {
+		b := &CommonBlock{
+			Height: h,
+			Hash:   fmt.Sprintf("block-%d", h),
+		}
+
+		for i := int64(0); i < h%3; i++ {
+			b.RawTx = append(b.RawTx, CommonTx{
+				Txid: fmt.Sprintf("tx-%d-%d", h, i),
+				Vout: []CommonVout{
+					{
+						N:         0,
+						Value:     h*1e6 + i,
+						Addresses: []string{windowTestAddrs[(h+i)%2]},
+					},
+				},
+			})
+		}
+
+		blocks[h] = b
+	}
+	return blocks
+}
+
+var windowTestAddrs = []string{"window-addr-1", "window-addr-2"}
+
+// runWindowScanner scans windowTestChain with the given BlockWindow.
+// fetchFailures is the number of times fetching a block at a given height fails before it succeeds.
+// It returns the deposits received and the heights of the scanned blocks, in order.
+func runWindowScanner(t *testing.T, blockWindow int, fetchFailures map[int64]int) ([]Deposit, []int64) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+	defer shutdownDB()
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	err = store.AddSupportedCoin(CoinTypeSKY)
+	require.NoError(t, err)
+	for _, a := range windowTestAddrs {
+		err = store.AddScanAddress(a, CoinTypeSKY)
+		require.NoError(t, err)
+	}
+
+	s := NewBaseScanner(store, log, CoinTypeSKY, Config{
+		ScanPeriod:        time.Millisecond * 10,
+		InitialScanHeight: 1,
+		BlockWindow:       blockWindow,
+	})
+
+	chain := windowTestChain()
+	expectedDeposits := 0
+	for _, b := range chain {
+		expectedDeposits += len(b.RawTx)
+	}
+
+	var fetchLock sync.Mutex
+	getBlockAtHeight := func(h int64) (*CommonBlock, error) {
+		fetchLock.Lock()
+		defer fetchLock.Unlock()
+		if fetchFailures[h] > 0 {
+			fetchFailures[h]--
+			return nil, fmt.Errorf("fetch block %d failed", h)
+		}
+		b, ok := chain[h]
+		if !ok {
+			return nil, errNoNewBlock
+		}
+		return b, nil
+	}
+
+	waitForNextBlock := func(b *CommonBlock) (*CommonBlock, error) {
+		for {
+			next, err := getBlockAtHeight(b.Height + 1)
+			if err == nil {
+				return next, nil
+			}
+			select {
+			case <-s.GetQuitChan():
+				return nil, errQuit
+			case <-time.After(s.GetScanPeriod()):
+			}
+		}
+	}
+
+	var scannedHeights []int64
+	scanBlock := func(b *CommonBlock) (int, error) {
+		scannedHeights = append(scannedHeights, b.Height)
+
+		dvs, err := store.ScanBlock(b, CoinTypeSKY, 0)
+		if err != nil {
+			return 0, err
+		}
+
+		for i, dv := range dvs {
+			select {
+			case s.GetScannedDepositChan() <- dv:
+			case <-s.GetQuitChan():
+				return i, errQuit
+			}
+		}
+		return len(dvs), nil
+	}
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(func() (int64, error) {
+			return windowTestChainHeight, nil
+		}, getBlockAtHeight, waitForNextBlock, scanBlock)
+	}()
+
+	var dvs []Deposit
+	timeout := time.After(time.Second * 5)
+	for len(dvs) < expectedDeposits {
+		select {
+		case dn := <-s.GetDeposit():
+			dvs = append(dvs, dn.Deposit)
+			dn.ErrC <- nil
+		case <-timeout:
+			t.Fatal("Waiting for deposits timed out")
+		}
+	}
+
+	for s.ScannedHeight() != windowTestChainHeight {
+		select {
+		case <-timeout:
+			t.Fatalf("Waiting for the scanned height timed out, scanned height is %d", s.ScannedHeight())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	s.Shutdown()
+	require.NoError(t, <-runErr)
+
+	return dvs, scannedHeights
+}
+
+func TestBaseScannerBlockWindow(t *testing.T) {
+	sequentialDeposits, sequentialHeights := runWindowScanner(t, 0, nil)
+	require.Len(t, sequentialHeights, windowTestChainHeight)
+	for i, h := range sequentialHeights {
+		require.Equal(t, int64(i+1), h)
+	}
+
+	for _, window := range []int{2, 5, windowTestChainHeight * 2} {
+		t.Run(fmt.Sprintf("window=%d", window), func(t *testing.T) {
+			dvs, heights := runWindowScanner(t, window, nil)
+			require.Equal(t, sequentialDeposits, dvs)
+			require.Equal(t, sequentialHeights, heights)
+		})
+	}
+}
+
+func TestBaseScannerBlockWindowFetchFailure(t *testing.T) {
+	sequentialDeposits, sequentialHeights := runWindowScanner(t, 0, nil)
+
+	// Blocks inside the window fail to fetch. The blocks after them are
+	// not scanned until the failed blocks have been fetched and scanned.
+	dvs, heights := runWindowScanner(t, 5, map[int64]int{
+		3:  2,
+		4:  1,
+		12: 3,
+	})
+	require.Equal(t, sequentialDeposits, dvs)
+	require.Equal(t, sequentialHeights, heights)
+}
+
+// runLargeDepositScanner runs a BaseScanner which loads deposits as unprocessed deposits on startup.
+// The best block height reported by the node is read from bestHeight.
+func runLargeDepositScanner(t *testing.T, deposits []Deposit, bestHeight *int64) (*BaseScanner, *Store, <-chan error, func()) {
+	return runTestScanner(t, Config{
+		ScanPeriod:                time.Millisecond * 10,
+		InitialScanHeight:         1,
+		ConfirmationsRequired:     1,
+		LargeDepositValue:         5e7,
+		LargeDepositConfirmations: 3,
+		ShutdownDrainTimeout:      time.Millisecond * 100,
+	}, deposits, nil, func(s *BaseScanner) scannerRPC {
+		return scannerRPC{
+			getBlockCount: func() (int64, error) {
+				return atomic.LoadInt64(bestHeight), nil
+			},
+			getBlockAtHeight: func(h int64) (*CommonBlock, error) {
+				return &CommonBlock{Height: h}, nil
+			},
+			waitForNextBlock: func(b *CommonBlock) (*CommonBlock, error) {
+				for atomic.LoadInt64(bestHeight) <= b.Height {
+					select {
+					case <-s.GetQuitChan():
+						return nil, errQuit
+					case <-time.After(s.GetScanPeriod()):
+					}
+				}
+				return &CommonBlock{Height: b.Height + 1}, nil
+			},
+			scanBlock: noBlockScanned,
+		}
+	})
+}
+
+func largeDepositTestDeposits() (Deposit, Deposit) {
+	small := Deposit{
+		CoinType: CoinTypeBTC,
+		Address:  "1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+		Value:    1e7,
+		Height:   1,
+		Tx:       "small-tx",
+	}
+	large := Deposit{
+		CoinType: CoinTypeBTC,
+		Address:  "1LEkderht5M5yWj82M87bEd4XDBsczLkp9",
+		Value:    5e7,
+		Height:   1,
+		Tx:       "large-tx",
+	}
+	return small, large
+}
+
+func TestBaseScannerLargeDepositConfirmations(t *testing.T) {
+	small, large := largeDepositTestDeposits()
+
+	// The block of the deposits has 1 confirmation
+	bestHeight := int64(2)
+	s, store, runErr, shutdownDB := runLargeDepositScanner(t, []Deposit{large, small}, &bestHeight)
+	defer shutdownDB()
+
+	receive := func() Deposit {
+		select {
+		case dn := <-s.GetDeposit():
+			dn.ErrC <- nil
+			return dn.Deposit
+		case <-time.After(time.Second * 3):
+			t.Fatal("Waiting for deposit timed out")
+			return Deposit{}
+		}
+	}
+
+	noDeposit := func() {
+		select {
+		case dn := <-s.GetDeposit():
+			t.Fatalf("Unexpected deposit %v", dn.Deposit)
+		case <-time.After(time.Millisecond * 200):
+		}
+	}
+
+	// The small deposit uses the base confirmations, the large deposit is held back
+	require.Equal(t, small, receive())
+	noDeposit()
+
+	// 2 confirmations are not enough for the large deposit
+	atomic.StoreInt64(&bestHeight, 3)
+	noDeposit()
+
+	// With 3 confirmations the large deposit is sent
+	atomic.StoreInt64(&bestHeight, 4)
+	require.Equal(t, large, receive())
+
+	s.Shutdown()
+	require.NoError(t, <-runErr)
+
+	dvs, err := store.GetUnprocessedDeposits(CoinTypeBTC)
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+}
+
+func TestBaseScannerPendingDeposits(t *testing.T) {
+	small, large := largeDepositTestDeposits()
+
+	// The block of the deposits has 1 confirmation
+	bestHeight := int64(2)
+	s, _, runErr, shutdownDB := runLargeDepositScanner(t, []Deposit{large, small}, &bestHeight)
+	defer shutdownDB()
+
+	receive := func() Deposit {
+		select {
+		case dn := <-s.GetDeposit():
+			dn.ErrC <- nil
+			return dn.Deposit
+		case <-time.After(time.Second * 3):
+			t.Fatal("Waiting for deposit timed out")
+			return Deposit{}
+		}
+	}
+
+	// waitPending waits for the pending deposits to have the expected confirmations
+	waitPending := func(expected []PendingDeposit) {
+		timeout := time.After(time.Second * 3)
+		for {
+			pending := s.PendingDeposits()
+			if reflect.DeepEqual(expected, pending) {
+				return
+			}
+
+			select {
+			case <-timeout:
+				require.Equal(t, expected, pending)
+				return
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+
+	// The small deposit is sent, the recently detected large deposit is pending
+	require.Equal(t, small, receive())
+	waitPending([]PendingDeposit{
+		{
+			Deposit:               large,
+			Confirmations:         1,
+			RequiredConfirmations: 3,
+		},
+	})
+
+	atomic.StoreInt64(&bestHeight, 3)
+	waitPending([]PendingDeposit{
+		{
+			Deposit:               large,
+			Confirmations:         2,
+			RequiredConfirmations: 3,
+		},
+	})
+
+	// Once confirmed, the large deposit is sent and no longer pending
+	atomic.StoreInt64(&bestHeight, 4)
+	require.Equal(t, large, receive())
+	waitPending([]PendingDeposit{})
+
+	s.Shutdown()
+	require.NoError(t, <-runErr)
+}
+
+func TestBaseScannerLargeDepositShutdown(t *testing.T) {
+	small, large := largeDepositTestDeposits()
+
+	bestHeight := int64(2)
+	s, store, runErr, shutdownDB := runLargeDepositScanner(t, []Deposit{large, small}, &bestHeight)
+	defer shutdownDB()
+
+	select {
+	case dn := <-s.GetDeposit():
+		require.Equal(t, small, dn.Deposit)
+		dn.ErrC <- nil
+	case <-time.After(time.Second * 3):
+		t.Fatal("Waiting for deposit timed out")
+	}
+
+	s.Shutdown()
+	require.NoError(t, <-runErr)
+
+	// The held back large deposit remains unprocessed, to be resent on restart
+	dvs, err := store.GetUnprocessedDeposits(CoinTypeBTC)
+	require.NoError(t, err)
+	require.Len(t, dvs, 1)
+	require.Equal(t, large.ID(), dvs[0].ID())
+}
+
+func TestBaseScannerRequiredConfirmations(t *testing.T) {
+	s := &BaseScanner{
+		Cfg: Config{
+			ConfirmationsRequired:     2,
+			LargeDepositValue:         100,
+			LargeDepositConfirmations: 6,
+		},
+	}
+
+	require.Equal(t, int64(2), s.requiredConfirmations(Deposit{Value: 99}))
+	require.Equal(t, int64(6), s.requiredConfirmations(Deposit{Value: 100}))
+	require.Equal(t, int64(6), s.requiredConfirmations(Deposit{Value: 1000}))
+
+	// Disabled
+	s.Cfg.LargeDepositValue = 0
+	require.Equal(t, int64(2), s.requiredConfirmations(Deposit{Value: 1000}))
+}
+
+func TestAmountWeightedConfirmations(t *testing.T) {
+	usdPerBlock := decimal.New(10000, 0)
+
+	tt := []struct {
+		amountUSD     string
+		confirmations int64
+	}{
+		{"0", 2},
+		{"0.01", 3},
+		{"9999.99", 3},
+		{"10000", 3},
+		{"10000.01", 4},
+		{"25000", 5},
+		{"40000", 6},
+		{"40000.01", 7},
+		{"80000", 10},
+		{"80000.01", 10},
+		{"1000000000", 10},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.amountUSD, func(t *testing.T) {
+			amountUSD, err := decimal.NewFromString(tc.amountUSD)
+			require.NoError(t, err)
+			require.Equal(t, tc.confirmations, amountWeightedConfirmations(2, amountUSD, usdPerBlock, 10))
+		})
+	}
+
+	// The max is never below the base
+	require.Equal(t, int64(2), amountWeightedConfirmations(2, decimal.New(1e6, 0), usdPerBlock, 0))
+}
+
+func TestBaseScannerWeightedConfirmations(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	s := &BaseScanner{
+		log:      log,
+		CoinType: CoinTypeBTC,
+		Cfg: Config{
+			ConfirmationsRequired:    1,
+			ConfirmationsUSDPerBlock: "10000",
+			MaxConfirmations:         6,
+			USDRate:                  "8000",
+		},
+	}
+
+	tt := []struct {
+		satoshis      int64
+		confirmations int64
+	}{
+		{0, 1},
+		{1e5, 2},       // $8
+		{125e6, 2},     // $10000
+		{125e6 + 1, 3}, // $10000.00008
+		{5e8, 5},       // $40000
+		{10e8, 6},      // $80000, capped
+		{1000e8, 6},    // $8000000, capped
+	}
+
+	for _, tc := range tt {
+		t.Run(fmt.Sprint(tc.satoshis), func(t *testing.T) {
+			require.Equal(t, tc.confirmations, s.requiredConfirmations(Deposit{
+				CoinType: CoinTypeBTC,
+				Value:    tc.satoshis,
+			}))
+		})
+	}
+
+	// Large deposits wait for the larger of both
+	s.Cfg.LargeDepositValue = 1e8
+	s.Cfg.LargeDepositConfirmations = 4
+	require.Equal(t, int64(4), s.requiredConfirmations(Deposit{Value: 1e8}))
+	require.Equal(t, int64(5), s.requiredConfirmations(Deposit{Value: 5e8}))
+
+	// A deposit whose USD value can't be computed waits for the max
+	s.Cfg.USDRate = ""
+	require.Equal(t, int64(6), s.requiredConfirmations(Deposit{Value: 1}))
+
+	// Disabled
+	s.Cfg.ConfirmationsUSDPerBlock = ""
+	s.Cfg.LargeDepositValue = 0
+	require.Equal(t, int64(1), s.requiredConfirmations(Deposit{Value: 1000e8}))
+}
+
+func TestBaseScannerScanBlockDust(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+	defer shutdownDB()
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	require.NoError(t, store.AddSupportedCoin(CoinTypeBTC))
+
+	addr := "1LEWwJkDj8xriE87ALzQYcHjTmD8aqDj1f"
+	require.NoError(t, store.AddScanAddress(addr, CoinTypeBTC))
+
+	s := NewBaseScanner(store, log, CoinTypeBTC, Config{
+		DustValue: 546,
+	})
+
+	block := &CommonBlock{
+		Height: 10,
+		Hash:   "block-10",
+	}
+	for i, value := range []int64{1, 545, 546, 1e8} {
+		block.RawTx = append(block.RawTx, CommonTx{
+			Txid: fmt.Sprintf("tx-%d", i),
+			Vout: []CommonVout{
+				{
+					Value:     value,
+					N:         0,
+					Addresses: []string{addr},
+				},
+			},
+		})
+	}
+
+	// Outputs below the dust value are not emitted, outputs at the dust value are
+	dvs, err := s.ScanBlock(block)
+	require.NoError(t, err)
+	require.Len(t, dvs, 2)
+	require.Equal(t, "tx-2", dvs[0].Tx)
+	require.Equal(t, int64(546), dvs[0].Value)
+	require.Equal(t, "tx-3", dvs[1].Tx)
+	require.Equal(t, int64(1e8), dvs[1].Value)
+
+	// The dust outputs are not recorded, they won't be sent to the exchange after a restart
+	unprocessed, err := store.GetUnprocessedDeposits(CoinTypeBTC)
+	require.NoError(t, err)
+	require.Equal(t, dvs, unprocessed)
+
+	// Disabled, all outputs are emitted
+	s.Cfg.DustValue = 0
+	block.Height = 11
+	for i := range block.RawTx {
+		block.RawTx[i].Txid = fmt.Sprintf("tx-11-%d", i)
+	}
+
+	dvs, err = s.ScanBlock(block)
+	require.NoError(t, err)
+	require.Len(t, dvs, 4)
+}
+
+// runLookbackScanner runs a BaseScanner catching up to bestHeight, with a deposit to a scan address in every block.
+// Nothing reads the deposits until the test does, like a slow exchange
+func runLookbackScanner(t *testing.T, maxBlockLookback int64, bestHeight int64) (*BaseScanner, func()) {
+	addr := "1LEWwJkDj8xriE87ALzQYcHjTmD8aqDj1f"
+
+	getBlockAtHeight := func(h int64) (*CommonBlock, error) {
+		return &CommonBlock{
+			Height: h,
+			Hash:   fmt.Sprintf("block-%d", h),
+			RawTx: []CommonTx{
+				{
+					Txid: fmt.Sprintf("tx-%d", h),
+					Vout: []CommonVout{
+						{
+							Value:     1e8,
+							Addresses: []string{addr},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	s, _, runErr, shutdownDB := runTestScanner(t, Config{
+		ScanPeriod:           time.Millisecond * 10,
+		InitialScanHeight:    1,
+		DepositBufferSize:    20,
+		ShutdownDrainTimeout: time.Millisecond * 100,
+		MaxBlockLookback:     maxBlockLookback,
+	}, nil, []string{addr}, func(s *BaseScanner) scannerRPC {
+		return scannerRPC{
+			getBlockCount: func() (int64, error) {
+				return bestHeight, nil
+			},
+			getBlockAtHeight: getBlockAtHeight,
+			waitForNextBlock: func(b *CommonBlock) (*CommonBlock, error) {
+				if b.Height >= bestHeight {
+					<-s.GetQuitChan()
+					return nil, errQuit
+				}
+				return getBlockAtHeight(b.Height + 1)
+			},
+			scanBlock: func(b *CommonBlock) (int, error) {
+				dvs, err := s.ScanBlock(b)
+				if err != nil {
+					return 0, err
+				}
+
+				for _, dv := range dvs {
+					select {
+					case s.GetScannedDepositChan() <- dv:
+					case <-s.GetQuitChan():
+						return 0, errQuit
+					}
+				}
+				return len(dvs), nil
+			},
+		}
+	})
+
+	return s, func() {
+		s.Shutdown()
+		require.NoError(t, <-runErr)
+		shutdownDB()
+	}
+}
+
+func TestBaseScannerMaxBlockLookback(t *testing.T) {
+	s, shutdown := runLookbackScanner(t, 3, 100)
+	defer shutdown()
+
+	waitForScannedHeight := func(height int64) {
+		timeout := time.After(time.Second * 3)
+		for s.ScannedHeight() != height {
+			select {
+			case <-timeout:
+				t.Fatalf("Waiting for ScannedHeight() == %d timed out, got %d", height, s.ScannedHeight())
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+
+	receive := func() Deposit {
+		select {
+		case dn := <-s.GetDeposit():
+			dn.ErrC <- nil
+			return dn.Deposit
+		case <-time.After(time.Second * 3):
+			t.Fatal("Waiting for deposit timed out")
+			return Deposit{}
+		}
+	}
+
+	// The exchange doesn't read the deposit of block 1, the scanner stops 3 blocks ahead of it
+	// instead of filling the deposit buffer
+	waitForScannedHeight(4)
+	time.Sleep(time.Millisecond * 200)
+	require.Equal(t, int64(4), s.ScannedHeight())
+
+	// Once the exchange records the oldest deposit, the scanner moves on by one block
+	require.Equal(t, int64(1), receive().Height)
+	waitForScannedHeight(5)
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, int64(5), s.ScannedHeight())
+
+	// Once the exchange keeps up, the scanner catches up to the best height
+	for i := int64(2); i <= 100; i++ {
+		require.Equal(t, i, receive().Height)
+	}
+	waitForScannedHeight(100)
+}
+
+func TestBaseScannerMaxBlockLookbackDisabled(t *testing.T) {
+	s, shutdown := runLookbackScanner(t, 0, 100)
+	defer shutdown()
+
+	// Without a lookback, the scanner gets ahead of the exchange until the deposit buffer is full
+	timeout := time.After(time.Second * 3)
+	for s.ScannedHeight() < 20 {
+		select {
+		case <-timeout:
+			t.Fatalf("Waiting for the scanner to get ahead timed out, got %d", s.ScannedHeight())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestBaseScannerSetStoredScanHeight(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+	defer shutdownDB()
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	err = store.AddSupportedCoin(CoinTypeSKY)
+	require.NoError(t, err)
+	for _, a := range windowTestAddrs {
+		err = store.AddScanAddress(a, CoinTypeSKY)
+		require.NoError(t, err)
+	}
+
+	s := NewBaseScanner(store, log, CoinTypeSKY, Config{
+		ScanPeriod:        time.Millisecond * 10,
+		InitialScanHeight: 1,
+	})
+
+	// Nothing scanned yet
+	height, err := s.StoredScanHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), height)
+
+	chain := windowTestChain()
+	bestHeight := int64(10)
+
+	getBlockAtHeight := func(h int64) (*CommonBlock, error) {
+		if h > atomic.LoadInt64(&bestHeight) {
+			return nil, errNoNewBlock
+		}
+		return chain[h], nil
+	}
+
+	waitForNextBlock := func(b *CommonBlock) (*CommonBlock, error) {
+		for {
+			next, err := getBlockAtHeight(b.Height + 1)
+			if err == nil {
+				return next, nil
+			}
+			select {
+			case <-s.GetQuitChan():
+				return nil, errQuit
+			case <-time.After(s.GetScanPeriod()):
+			}
+		}
+	}
+
+	var scannedLock sync.Mutex
+	var scannedHeights []int64
+	scanBlock := func(b *CommonBlock) (int, error) {
+		scannedLock.Lock()
+		scannedHeights = append(scannedHeights, b.Height)
+		scannedLock.Unlock()
+
+		dvs, err := store.ScanBlock(b, CoinTypeSKY, 0)
+		if err != nil {
+			return 0, err
+		}
+
+		for i, dv := range dvs {
+			select {
+			case s.GetScannedDepositChan() <- dv:
+			case <-s.GetQuitChan():
+				return i, errQuit
+			}
+		}
+		return len(dvs), nil
+	}
+
+	// Deposits are acked as they arrive. A rescanned block must not produce them again
+	var depositsLock sync.Mutex
+	deposits := make(map[string]int)
+	go func() {
+		for dn := range s.GetDeposit() {
+			depositsLock.Lock()
+			deposits[dn.ID()]++
+			depositsLock.Unlock()
+			dn.ErrC <- nil
+		}
+	}()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(func() (int64, error) {
+			return atomic.LoadInt64(&bestHeight), nil
+		}, getBlockAtHeight, waitForNextBlock, scanBlock)
+	}()
+
+	// waitForScanned waits until the heights scanned after the first n scans are expected
+	waitForScanned := func(n int, expected []int64) {
+		timeout := time.After(time.Second * 5)
+		for {
+			scannedLock.Lock()
+			var heights []int64
+			if len(scannedHeights) > n {
+				heights = append(heights, scannedHeights[n:]...)
+			}
+			scannedLock.Unlock()
+
+			if len(heights) >= len(expected) {
+				require.Equal(t, expected, heights[:len(expected)])
+				return
+			}
+
+			select {
+			case <-timeout:
+				t.Fatalf("Waiting for scanned heights %v timed out, scanned %v", expected, heights)
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+
+	heightRange := func(start, end int64) []int64 {
+		var heights []int64
+		for h := start; h <= end; h++ {
+			heights = append(heights, h)
+		}
+		return heights
+	}
+
+	scannedCount := func() int {
+		scannedLock.Lock()
+		defer scannedLock.Unlock()
+		return len(scannedHeights)
+	}
+
+	// Read: the stored scan height follows the scanned blocks
+	waitForScanned(0, heightRange(1, 10))
+	for s.ScannedHeight() != 10 {
+		time.Sleep(time.Millisecond * 10)
+	}
+	height, err = s.StoredScanHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(10), height)
+
+	// The scan height can only be changed while paused
+	_, err = s.SetStoredScanHeight(5)
+	require.Equal(t, ErrScannerNotPaused, err)
+
+	s.Pause()
+	require.True(t, s.Paused())
+
+	_, err = s.SetStoredScanHeight(-1)
+	require.Error(t, err)
+
+	// Advance: blocks 11 to 14 are skipped
+	prevHeight, err := s.SetStoredScanHeight(15)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), prevHeight)
+
+	height, err = s.StoredScanHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(15), height)
+
+	n := scannedCount()
+	atomic.StoreInt64(&bestHeight, windowTestChainHeight)
+
+	// Nothing is scanned while paused
+	time.Sleep(s.GetScanPeriod() * 5)
+	require.Equal(t, n, scannedCount())
+
+	s.Resume()
+	require.False(t, s.Paused())
+	waitForScanned(n, heightRange(15, windowTestChainHeight))
+
+	// The deposits of the skipped blocks were not sent to the exchange
+	depositsLock.Lock()
+	for h := int64(11); h < 15; h++ {
+		for _, tx := range chain[h].RawTx {
+			id := Deposit{Tx: tx.Txid}.ID()
+			require.Equal(t, 0, deposits[id], id)
+		}
+	}
+	depositsLock.Unlock()
+
+	// Rewind: blocks 3 to 20 are scanned again
+	s.Pause()
+	prevHeight, err = s.SetStoredScanHeight(3)
+	require.NoError(t, err)
+	require.Equal(t, int64(windowTestChainHeight), prevHeight)
+
+	n = scannedCount()
+	s.Resume()
+	waitForScanned(n, heightRange(3, windowTestChainHeight))
+
+	s.Shutdown()
+	require.NoError(t, <-runErr)
+
+	height, err = s.StoredScanHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(windowTestChainHeight), height)
+
+	// Every deposit was sent to the exchange once, including the deposits
+	// of the skipped blocks, which were scanned after rewinding
+	depositsLock.Lock()
+	defer depositsLock.Unlock()
+	for _, b := range chain {
+		for _, tx := range b.RawTx {
+			id := Deposit{Tx: tx.Txid}.ID()
+			require.Equal(t, 1, deposits[id], id)
+		}
+	}
+}
+
+func TestBaseScannerPauseResume(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdownDB := testutil.PrepareDB(t)
+	defer shutdownDB()
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	err = store.AddSupportedCoin(CoinTypeSKY)
+	require.NoError(t, err)
+
+	s := NewBaseScanner(store, log, CoinTypeSKY, Config{
+		ScanPeriod:        time.Millisecond * 10,
+		InitialScanHeight: 1,
+	})
+
+	chain := windowTestChain()
+	bestHeight := int64(5)
+
+	getBlockAtHeight := func(h int64) (*CommonBlock, error) {
+		if h > atomic.LoadInt64(&bestHeight) {
+			return nil, errNoNewBlock
+		}
+		return chain[h], nil
+	}
+
+	waitForNextBlock := func(b *CommonBlock) (*CommonBlock, error) {
+		for {
+			next, err := getBlockAtHeight(b.Height + 1)
+			if err == nil {
+				return next, nil
+			}
+			select {
+			case <-s.GetQuitChan():
+				return nil, errQuit
+			case <-time.After(s.GetScanPeriod()):
+			}
+		}
+	}
+
+	var scannedLock sync.Mutex
+	var scannedHeights []int64
+	scanBlock := func(b *CommonBlock) (int, error) {
+		scannedLock.Lock()
+		defer scannedLock.Unlock()
+		scannedHeights = append(scannedHeights, b.Height)
+		return 0, nil
+	}
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(func() (int64, error) {
+			return atomic.LoadInt64(&bestHeight), nil
+		}, getBlockAtHeight, waitForNextBlock, scanBlock)
+	}()
+
+	waitForScannedHeight := func(height int64) {
+		timeout := time.After(time.Second * 5)
+		for s.ScannedHeight() != height {
+			select {
+			case <-timeout:
+				t.Fatalf("Waiting for scanned height %d timed out, scanned %d", height, s.ScannedHeight())
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+
+	waitForScannedHeight(5)
+
+	s.Pause()
+	require.True(t, s.Paused())
+
+	// The scanner stops advancing while new blocks arrive
+	atomic.StoreInt64(&bestHeight, windowTestChainHeight)
+	time.Sleep(s.GetScanPeriod() * 5)
+	require.Equal(t, int64(5), s.ScannedHeight())
+
+	height, err := s.StoredScanHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(5), height)
+
+	// Pausing twice has no effect. Once resumed, scanning continues from the block after the last one scanned
+	s.Pause()
+	s.Resume()
+	require.False(t, s.Paused())
+	waitForScannedHeight(windowTestChainHeight)
+
+	s.Shutdown()
+	require.NoError(t, <-runErr)
+
+	// Every block was scanned once, in order
+	var expected []int64
+	for h := int64(1); h <= windowTestChainHeight; h++ {
+		expected = append(expected, h)
+	}
+
+	scannedLock.Lock()
+	defer scannedLock.Unlock()
+	require.Equal(t, expected, scannedHeights)
+
+	height, err = s.StoredScanHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(windowTestChainHeight), height)
+}
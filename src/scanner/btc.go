@@ -13,6 +13,7 @@ import (
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcutil"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,12 +27,43 @@ var (
 	ErrEmptyBlock = errors.New("empty block")
 )
 
+// btcFeeEstimateBlocks is the number of blocks within which a deposit should confirm at the estimated fee
+const btcFeeEstimateBlocks = 6
+
+// btcFeeEstimator is implemented by the btcd clients that support estimatefee
+type btcFeeEstimator interface {
+	EstimateFee(numBlocks int64) (float64, error)
+}
+
 // Config scanner config info
 type Config struct {
 	ScanPeriod            time.Duration // scan period in seconds
 	DepositBufferSize     int           // size of GetDeposit() channel
 	InitialScanHeight     int64         // what blockchain height to begin scanning from
 	ConfirmationsRequired int64         // how many confirmations to wait for block
+	StallTimeout          time.Duration // mark the scanner unhealthy if the best height does not advance within this duration, 0 disables
+	ShutdownDrainTimeout  time.Duration // how long to wait for the exchange to record buffered deposits on shutdown
+	BlockWindow           int           // how many confirmed blocks to fetch concurrently while catching up, 0 or 1 fetches one block at a time
+	DustValue             int64         // deposits with a value below this, in the coin's smallest unit, are ignored. 0 disables
+	MaxBlockLookback      int64         // how many blocks the scanner may get ahead of the oldest deposit the exchange has not recorded yet. 0 disables
+
+	// Deposits with a value of at least LargeDepositValue wait for LargeDepositConfirmations
+	// before they are sent to the exchange. 0 disables
+	LargeDepositValue         int64
+	LargeDepositConfirmations int64
+
+	// Deposits wait for one more confirmation than ConfirmationsRequired per ConfirmationsUSDPerBlock of
+	// their USD value, rounded up, up to MaxConfirmations. The USD value of a deposit is its amount
+	// times USDRate, the USD price of one coin. Empty disables
+	ConfirmationsUSDPerBlock string
+	MaxConfirmations         int64
+	USDRate                  string
+
+	// Deposits are confirmed once the node reports their transaction as confirmed, instead of once their block
+	// has ConfirmationsRequired. Blocks are scanned as soon as they are seen. Only supported by the SKY scanner
+	// for which a transaction is confirmed once it is in a block, so deposits wait no longer than with
+	// ConfirmationsRequired 0. It only checks that the node still has the transaction, with one request per deposit
+	ConfirmByTxStatus bool
 }
 
 // BTCScanner blockchain scanner to check if there're deposit coins
@@ -76,9 +108,9 @@ func (s *BTCScanner) scanBlock(block *CommonBlock) (int, error) {
 
 	log.Debug("Scanning block")
 
-	dvs, err := s.Base.GetStorer().ScanBlock(block, CoinTypeBTC)
+	dvs, err := s.Base.ScanBlock(block)
 	if err != nil {
-		log.WithError(err).Error("store.ScanBlock failed")
+		log.WithError(err).Error("Base.ScanBlock failed")
 		return 0, err
 	}
 
@@ -103,6 +135,78 @@ func (s *BTCScanner) GetBlockCount() (int64, error) {
 	return s.btcClient.GetBlockCount()
 }
 
+// Heights returns the height of the last block scanned and the best block height of the node
+func (s *BTCScanner) Heights() (Heights, error) {
+	tip, err := s.GetBlockCount()
+	if err != nil {
+		return Heights{
+			ScannedHeight: s.Base.ScannedHeight(),
+			Healthy:       s.Base.Healthy(),
+		}, err
+	}
+
+	return Heights{
+		ScannedHeight:  s.Base.ScannedHeight(),
+		ChainTipHeight: tip,
+		Healthy:        s.Base.Healthy(),
+	}, nil
+}
+
+// EstimateFee returns the fee rate estimated by btcd for a transaction to confirm within btcFeeEstimateBlocks blocks, in BTC per kB.
+// Returns ErrFeeEstimateUnavailable if the client doesn't support estimatefee, or btcd has not seen enough transactions yet
+func (s *BTCScanner) EstimateFee() (FeeEstimate, error) {
+	fe, ok := s.btcClient.(btcFeeEstimator)
+	if !ok {
+		return FeeEstimate{}, ErrFeeEstimateUnavailable
+	}
+
+	fee, err := fe.EstimateFee(btcFeeEstimateBlocks)
+	if err != nil {
+		return FeeEstimate{}, err
+	}
+
+	// btcd returns -1 until it has enough data to estimate fees
+	if fee <= 0 {
+		return FeeEstimate{}, ErrFeeEstimateUnavailable
+	}
+
+	return FeeEstimate{
+		Fee:  decimal.NewFromFloat(fee).String(),
+		Unit: "BTC/kB",
+	}, nil
+}
+
+// ScanSingleBlock fetches the block at height and replays it through the deposit matching, for debugging missed deposits.
+// Nothing is recorded, see BaseScanner.ReplayBlock
+func (s *BTCScanner) ScanSingleBlock(height int64) (*BlockReplay, error) {
+	block, err := s.getBlockAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Base.ReplayBlock(block)
+}
+
+// VerifyDeposit fetches the block at dv.Height and checks that it includes the deposit
+// and has the confirmations required for it, see DepositVerifier
+func (s *BTCScanner) VerifyDeposit(dv Deposit) error {
+	block, err := s.getBlockAtHeight(dv.Height)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyBlockDeposit(block, dv); err != nil {
+		return err
+	}
+
+	bestHeight, err := s.GetBlockCount()
+	if err != nil {
+		return err
+	}
+
+	return s.Base.CheckDepositDepth(dv, bestHeight)
+}
+
 // getBlockAtHeight returns that block at a specific height
 func (s *BTCScanner) getBlockAtHeight(height int64) (*CommonBlock, error) {
 	log := s.log.WithField("blockHeight", height)
@@ -570,3 +570,48 @@ func TestBtcScanner(t *testing.T) {
 		})
 	})
 }
+
+// feeBtcrpcclient is a btcd client that supports estimatefee
+type feeBtcrpcclient struct {
+	*dummyBtcrpcclient
+	fee       float64
+	err       error
+	numBlocks int64
+}
+
+func (c *feeBtcrpcclient) EstimateFee(numBlocks int64) (float64, error) {
+	c.numBlocks = numBlocks
+	return c.fee, c.err
+}
+
+func TestBTCScannerEstimateFee(t *testing.T) {
+	// The client doesn't support estimatefee
+	scr := &BTCScanner{
+		btcClient: newDummyBtcrpcclient(nil),
+	}
+	_, err := scr.EstimateFee()
+	require.Equal(t, ErrFeeEstimateUnavailable, err)
+
+	client := &feeBtcrpcclient{
+		dummyBtcrpcclient: newDummyBtcrpcclient(nil),
+		fee:               0.00012,
+	}
+	scr.btcClient = client
+
+	fee, err := scr.EstimateFee()
+	require.NoError(t, err)
+	require.Equal(t, FeeEstimate{
+		Fee:  "0.00012",
+		Unit: "BTC/kB",
+	}, fee)
+	require.Equal(t, int64(btcFeeEstimateBlocks), client.numBlocks)
+
+	// btcd doesn't have enough data yet
+	client.fee = -1
+	_, err = scr.EstimateFee()
+	require.Equal(t, ErrFeeEstimateUnavailable, err)
+
+	client.err = errors.New("btcd unavailable")
+	_, err = scr.EstimateFee()
+	require.Equal(t, client.err, err)
+}
@@ -1,19 +1,27 @@
 package scanner
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 
 	"github.com/MDLlife/MDL/src/cipher"
 
 	"github.com/MDLlife/teller/src/util/httputil"
+	"github.com/MDLlife/teller/src/util/mathutil"
 )
 
+// DepositAddressFunc returns the deposit address of a coin type bound to a mdl address
+type DepositAddressFunc func(mdlAddr, coinType string) (string, error)
+
 // DummyScanner implements the Scanner interface to provide simulated scanning
 type DummyScanner struct {
 	addrs     []string
@@ -22,6 +30,11 @@ type DummyScanner struct {
 	coinTypes map[string]struct{}
 	log       logrus.FieldLogger
 	sync.RWMutex
+
+	// Test deposits, see EnableTestDeposits
+	testDepositToken string
+	depositAddress   DepositAddressFunc
+	testDepositSeq   uint64
 }
 
 // NewDummyScanner creates a DummyScanner
@@ -76,11 +89,22 @@ func (s *DummyScanner) GetDeposit() <-chan DepositNote {
 	return s.deposits
 }
 
+// EnableTestDeposits enables /dummy/scanner/test-deposit, which deposits to the address bound to a mdl address.
+// depositAddress finds the bound address. If token is not empty, requests must send it as a bearer token
+func (s *DummyScanner) EnableTestDeposits(token string, depositAddress DepositAddressFunc) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.testDepositToken = token
+	s.depositAddress = depositAddress
+}
+
 // HTTP Interface
 
 // BindHandlers binds dummy scanner HTTP handlers
 func (s *DummyScanner) BindHandlers(mux *http.ServeMux) {
 	mux.Handle("/dummy/scanner/deposit", http.HandlerFunc(s.addDepositHandler))
+	mux.Handle("/dummy/scanner/test-deposit", http.HandlerFunc(s.testDepositHandler))
 }
 
 func (s *DummyScanner) addDepositHandler(w http.ResponseWriter, r *http.Request) {
@@ -161,3 +185,146 @@ func (s *DummyScanner) addDepositHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 }
+
+// TestDepositResponse is the response of /dummy/scanner/test-deposit
+type TestDepositResponse struct {
+	DepositAddress string `json:"deposit_address"`
+	CoinType       string `json:"coin_type"`
+	Value          int64  `json:"value"`
+	Tx             string `json:"tx"`
+	N              uint32 `json:"n"`
+}
+
+// testDepositHandler deposits an amount of a coin to the address bound to a mdl address, and waits
+// until the exchange has recorded the deposit. The deposit is then processed like a scanned deposit
+func (s *DummyScanner) testDepositHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httputil.ErrResponse(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.RLock()
+	token, depositAddress := s.testDepositToken, s.depositAddress
+	s.RUnlock()
+
+	if depositAddress == nil {
+		httputil.ErrResponse(w, http.StatusServiceUnavailable, "test deposits are not enabled")
+		return
+	}
+
+	if token != "" {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			httputil.ErrResponse(w, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	mdlAddr := r.FormValue("mdladdr")
+	if mdlAddr == "" {
+		httputil.ErrResponse(w, http.StatusBadRequest, "mdladdr required")
+		return
+	}
+
+	coinType := r.FormValue("coin")
+	if coinType == "" {
+		coinType = CoinTypeBTC
+	}
+
+	s.RLock()
+	_, ok := s.coinTypes[coinType]
+	s.RUnlock()
+	if !ok {
+		httputil.ErrResponse(w, http.StatusBadRequest, "invalid coin")
+		return
+	}
+
+	amountStr := r.FormValue("amount")
+	if amountStr == "" {
+		httputil.ErrResponse(w, http.StatusBadRequest, "amount required")
+		return
+	}
+
+	amount, err := mathutil.DecimalFromString(amountStr)
+	if err != nil {
+		httputil.ErrResponse(w, http.StatusBadRequest, "invalid amount")
+		return
+	}
+
+	value, err := depositValue(coinType, amount)
+	if err != nil {
+		httputil.ErrResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid amount: %v", err))
+		return
+	}
+
+	addr, err := depositAddress(mdlAddr, coinType)
+	if err != nil {
+		httputil.ErrResponse(w, http.StatusNotFound, fmt.Sprintf("no %s address bound to mdladdr: %v", coinType, err))
+		return
+	}
+
+	s.Lock()
+	s.testDepositSeq++
+	seq := s.testDepositSeq
+	s.Unlock()
+
+	dn := NewDepositNote(Deposit{
+		CoinType:  coinType,
+		Address:   addr,
+		Value:     value,
+		Tx:        fmt.Sprintf("test-deposit-%d-%d", time.Now().UnixNano(), seq),
+		FirstSeen: time.Now().UTC().Unix(),
+	})
+
+	log := s.log.WithField("deposit", dn.Deposit)
+
+	select {
+	case s.deposits <- dn:
+	default:
+		httputil.ErrResponse(w, http.StatusServiceUnavailable, "deposits channel is full")
+		return
+	}
+
+	select {
+	case err := <-dn.ErrC:
+		if err != nil {
+			log.WithError(err).Error("Test deposit was not recorded")
+			httputil.ErrResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case <-r.Context().Done():
+		return
+	}
+
+	log.Info("Test deposit recorded")
+
+	if err := httputil.JSONResponse(w, TestDepositResponse{
+		DepositAddress: addr,
+		CoinType:       coinType,
+		Value:          value,
+		Tx:             dn.Deposit.Tx,
+		N:              dn.Deposit.N,
+	}); err != nil {
+		log.WithError(err).Error(err)
+	}
+}
+
+// depositValue converts an amount of the coin to a deposit value, measured in the unit recorded by the coin's scanner.
+// It is the inverse of depositAmount
+func depositValue(coinType string, amount decimal.Decimal) (int64, error) {
+	unit, err := depositAmount(coinType, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	value := amount.Div(unit)
+	if !value.Equal(value.Truncate(0)) {
+		return 0, fmt.Errorf("%s has at most %d decimal places", coinType, -unit.Exponent())
+	}
+
+	if value.Sign() <= 0 || value.GreaterThan(decimal.New(math.MaxInt64, 0)) {
+		return 0, fmt.Errorf("must be positive")
+	}
+
+	return value.IntPart(), nil
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 
 	"github.com/MDLlife/teller/src/util/mathutil"
@@ -44,6 +45,68 @@ func (s *ETHScanner) Run() error {
 	return s.Base.Run(s.ethClient.GetBlockCount, s.getBlockAtHeight, s.waitForNextBlock, s.scanBlock)
 }
 
+// Heights returns the height of the last block scanned and the best block height of the node
+func (s *ETHScanner) Heights() (Heights, error) {
+	tip, err := s.ethClient.GetBlockCount()
+	if err != nil {
+		return Heights{
+			ScannedHeight: s.Base.ScannedHeight(),
+			Healthy:       s.Base.Healthy(),
+		}, err
+	}
+
+	return Heights{
+		ScannedHeight:  s.Base.ScannedHeight(),
+		ChainTipHeight: tip,
+		Healthy:        s.Base.Healthy(),
+	}, nil
+}
+
+// ethGasPricer is implemented by the ethereum clients that can suggest a gas price
+type ethGasPricer interface {
+	GasPrice() (*big.Int, error)
+}
+
+// EstimateFee returns the gas price suggested by the ethereum node, in Gwei.
+// Returns ErrFeeEstimateUnavailable if the client can't suggest a gas price, e.g. a block explorer client
+func (s *ETHScanner) EstimateFee() (FeeEstimate, error) {
+	gp, ok := s.ethClient.(ethGasPricer)
+	if !ok {
+		return FeeEstimate{}, ErrFeeEstimateUnavailable
+	}
+
+	price, err := gp.GasPrice()
+	if err != nil {
+		return FeeEstimate{}, err
+	}
+
+	return FeeEstimate{
+		Fee:  decimal.NewFromBigInt(price, -9).String(),
+		Unit: "Gwei",
+	}, nil
+}
+
+// ethBalancer is implemented by the ethereum clients that can read an address's balance at a block height
+type ethBalancer interface {
+	BalanceAt(ctx context.Context, addr string, height int64) (*big.Int, error)
+}
+
+// AddressBalance returns the balance of addr in Gwei, at the last scanned block so that the deposits
+// not scanned yet are not counted. Returns ErrAddressBalanceUnavailable if the client can't read balances
+func (s *ETHScanner) AddressBalance(ctx context.Context, addr string) (int64, error) {
+	eb, ok := s.ethClient.(ethBalancer)
+	if !ok {
+		return 0, ErrAddressBalanceUnavailable
+	}
+
+	balance, err := eb.BalanceAt(ctx, addr, s.Base.ScannedHeight())
+	if err != nil {
+		return 0, err
+	}
+
+	return mathutil.Wei2Gwei(balance), nil
+}
+
 // Shutdown shutdown the scanner
 func (s *ETHScanner) Shutdown() {
 	s.log.Info("Closing ETH scanner")
@@ -62,9 +125,9 @@ func (s *ETHScanner) scanBlock(block *CommonBlock) (int, error) {
 
 	log.Debug("Scanning block")
 
-	dvs, err := s.Base.GetStorer().ScanBlock(block, CoinTypeETH)
+	dvs, err := s.Base.ScanBlock(block)
 	if err != nil {
-		log.WithError(err).Error("store.ScanBlock failed")
+		log.WithError(err).Error("Base.ScanBlock failed")
 		return 0, err
 	}
 
@@ -84,22 +147,45 @@ func (s *ETHScanner) scanBlock(block *CommonBlock) (int, error) {
 	return n, nil
 }
 
-// getBlockAtHeight returns that block at a specific height
-func (s *ETHScanner) getBlockAtHeight(seq int64) (*CommonBlock, error) {
-	b, err := s.ethClient.GetBlockVerboseTx(uint64(seq))
+// ScanSingleBlock fetches the block at height and replays it through the deposit matching, for debugging missed deposits.
+// Nothing is recorded, see BaseScanner.ReplayBlock
+func (s *ETHScanner) ScanSingleBlock(height int64) (*BlockReplay, error) {
+	block, err := s.getBlockAtHeight(height)
 	if err != nil {
 		return nil, err
 	}
-	return ethBlock2CommonBlock(b)
+
+	return s.Base.ReplayBlock(block)
 }
 
-// getNextBlock returns the next block of given hash, return nil if next block does not exist
-func (s *ETHScanner) getNextBlock(seq uint64) (*CommonBlock, error) {
-	b, err := s.ethClient.GetBlockVerboseTx(seq + 1)
+// VerifyDeposit fetches the block at dv.Height and checks that it includes the deposit
+// and has the confirmations required for it, see DepositVerifier
+func (s *ETHScanner) VerifyDeposit(dv Deposit) error {
+	block, err := s.getBlockAtHeight(dv.Height)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return ethBlock2CommonBlock(b)
+
+	if err := verifyBlockDeposit(block, dv); err != nil {
+		return err
+	}
+
+	bestHeight, err := s.ethClient.GetBlockCount()
+	if err != nil {
+		return err
+	}
+
+	return s.Base.CheckDepositDepth(dv, bestHeight)
+}
+
+// getBlockAtHeight returns that block at a specific height
+func (s *ETHScanner) getBlockAtHeight(seq int64) (*CommonBlock, error) {
+	return s.ethClient.GetBlock(uint64(seq))
+}
+
+// getNextBlock returns the next block of given hash, return nil if next block does not exist
+func (s *ETHScanner) getNextBlock(seq uint64) (*CommonBlock, error) {
+	return s.ethClient.GetBlock(seq + 1)
 }
 
 // waitForNextBlock scans for the next block until it is available
@@ -217,6 +303,20 @@ func (ec *EthClient) GetBlockCount() (int64, error) {
 	return blockNum, nil
 }
 
+// GasPrice returns the gas price suggested by the ethereum node, in wei
+func (ec *EthClient) GasPrice() (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return ethclient.NewClient(ec.c).SuggestGasPrice(ctx)
+}
+
+// BalanceAt returns the balance of addr at the block height, in wei
+func (ec *EthClient) BalanceAt(ctx context.Context, addr string, height int64) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return ethclient.NewClient(ec.c).BalanceAt(ctx, common.HexToAddress(addr), big.NewInt(height))
+}
+
 // Shutdown close rpc connection
 func (ec *EthClient) Shutdown() {
 	ec.c.Close()
@@ -234,6 +334,15 @@ func (ec *EthClient) GetBlockVerboseTx(seq uint64) (*types.Block, error) {
 	return block, nil
 }
 
+// GetBlock returns the ethereum block at seq
+func (ec *EthClient) GetBlock(seq uint64) (*CommonBlock, error) {
+	b, err := ec.GetBlockVerboseTx(seq)
+	if err != nil {
+		return nil, err
+	}
+	return ethBlock2CommonBlock(b)
+}
+
 //GetTransaction returns transaction by txhash
 func (ec *EthClient) GetTransaction(txhash common.Hash) (*types.Transaction, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -0,0 +1,196 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/MDLlife/teller/src/util/mathutil"
+)
+
+const ethExplorerTimeout = 5 * time.Second
+
+// EthExplorerClient implements EthRPCClient with an etherscan-like block explorer HTTP API,
+// so that a full geth node is not required. It uses the explorer's proxy module, which
+// mirrors the geth JSON-RPC calls over GET requests
+type EthExplorerClient struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewEthExplorerClient creates an EthExplorerClient for the API at apiURL, e.g. "https://api.etherscan.io/api".
+// apiKey is optional. The connections to the API are tuned with tc
+func NewEthExplorerClient(apiURL, apiKey string, tc TransportConfig) *EthExplorerClient {
+	return &EthExplorerClient{
+		url:    apiURL,
+		apiKey: apiKey,
+		client: &http.Client{
+			Transport: NewHTTPTransport(tc),
+			Timeout:   ethExplorerTimeout,
+		},
+	}
+}
+
+// ethExplorerResponse is the envelope of an explorer API response.
+// Proxy calls respond like JSON-RPC, with the value in result or an error.
+// Failed requests, e.g. an invalid API key or a rate limit, respond with status "0" and the reason in result
+type ethExplorerResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type ethExplorerBlock struct {
+	Hash         string                   `json:"hash"`
+	Number       string                   `json:"number"`
+	Transactions []ethExplorerTransaction `json:"transactions"`
+}
+
+type ethExplorerTransaction struct {
+	Hash  string  `json:"hash"`
+	To    *string `json:"to"`
+	Value string  `json:"value"`
+}
+
+// GetBlockCount returns ethereum block count
+func (c *EthExplorerClient) GetBlockCount() (int64, error) {
+	var bn string
+	if err := c.call("eth_blockNumber", nil, &bn); err != nil {
+		return 0, err
+	}
+
+	blockNum, err := hexutil.DecodeUint64(bn)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid block number %q: %v", bn, err)
+	}
+
+	return int64(blockNum), nil
+}
+
+// GetBlock returns the ethereum block at seq
+func (c *EthExplorerClient) GetBlock(seq uint64) (*CommonBlock, error) {
+	var b *ethExplorerBlock
+	if err := c.call("eth_getBlockByNumber", url.Values{
+		"tag":     []string{hexutil.EncodeUint64(seq)},
+		"boolean": []string{"true"},
+	}, &b); err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		return nil, ErrEmptyBlock
+	}
+
+	return ethExplorerBlock2CommonBlock(b)
+}
+
+// Shutdown does nothing, there is no connection to close
+func (c *EthExplorerClient) Shutdown() {}
+
+// call calls a proxy module action of the explorer API and decodes its result into v
+func (c *EthExplorerClient) call(action string, params url.Values, v interface{}) error {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return err
+	}
+
+	q := u.Query()
+	for k, vs := range params {
+		q[k] = vs
+	}
+	q.Set("module", "proxy")
+	q.Set("action", action)
+	if c.apiKey != "" {
+		q.Set("apikey", c.apiKey)
+	}
+	u.RawQuery = q.Encode()
+
+	rsp, err := c.client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: explorer API responded with %s", action, rsp.Status)
+	}
+
+	var r ethExplorerResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: invalid explorer API response: %v", action, err)
+	}
+
+	if r.Error != nil {
+		return fmt.Errorf("%s: explorer API error %d: %s", action, r.Error.Code, r.Error.Message)
+	}
+
+	if r.Status == "0" {
+		var reason string
+		if err := json.Unmarshal(r.Result, &reason); err != nil || reason == "" {
+			reason = r.Message
+		}
+		return fmt.Errorf("%s: explorer API error: %s", action, reason)
+	}
+
+	if len(r.Result) == 0 {
+		return fmt.Errorf("%s: explorer API response has no result", action)
+	}
+
+	if err := json.Unmarshal(r.Result, v); err != nil {
+		return fmt.Errorf("%s: invalid explorer API result: %v", action, err)
+	}
+
+	return nil
+}
+
+// ethExplorerBlock2CommonBlock converts an explorer block to a common block, the same as ethBlock2CommonBlock
+func ethExplorerBlock2CommonBlock(block *ethExplorerBlock) (*CommonBlock, error) {
+	height, err := hexutil.DecodeUint64(block.Number)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid block number %q: %v", block.Number, err)
+	}
+
+	if block.Hash == "" {
+		return nil, errors.New("Block hash missing")
+	}
+
+	cb := CommonBlock{}
+	cb.Hash = common.HexToHash(block.Hash).String()
+	cb.Height = int64(height)
+	cb.RawTx = make([]CommonTx, 0, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		if tx.To == nil {
+			//this is a contract transcation
+			continue
+		}
+
+		wei, err := hexutil.DecodeBig(tx.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value %q of transaction %s: %v", tx.Value, tx.Hash, err)
+		}
+
+		cbTx := CommonTx{}
+		cbTx.Txid = common.HexToHash(tx.Hash).String()
+		cbTx.Vout = []CommonVout{
+			{
+				N:         uint32(i),
+				Value:     mathutil.Wei2Gwei(wei),
+				Addresses: []string{common.HexToAddress(*tx.To).String()},
+			},
+		}
+		cb.RawTx = append(cb.RawTx, cbTx)
+	}
+
+	return &cb, nil
+}
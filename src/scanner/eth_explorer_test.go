@@ -0,0 +1,266 @@
+package scanner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+const (
+	testExplorerAPIKey      = "test-api-key"
+	testExplorerDepositAddr = "0x87b127ee022abcf9881b9bad6bb6aac25229dff0"
+)
+
+// fakeEthExplorer serves the proxy module of an etherscan-like API from a fixed set of blocks
+type fakeEthExplorer struct {
+	blockNumber string
+	blocks      map[string]interface{}
+	failAction  string
+	failRsp     interface{}
+	failStatus  int
+}
+
+func (e *fakeEthExplorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("module") != "proxy" || q.Get("apikey") != testExplorerAPIKey {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	action := q.Get("action")
+	if action == e.failAction {
+		if e.failStatus != 0 {
+			w.WriteHeader(e.failStatus)
+			return
+		}
+		json.NewEncoder(w).Encode(e.failRsp) // nolint: errcheck
+		return
+	}
+
+	var result interface{}
+	switch action {
+	case "eth_blockNumber":
+		result = e.blockNumber
+	case "eth_getBlockByNumber":
+		if q.Get("boolean") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		result = e.blocks[q.Get("tag")]
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck
+		"jsonrpc": "2.0",
+		"id":      1,
+		"result":  result,
+	})
+}
+
+func explorerBlock(number, hash string, txs ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"number":       number,
+		"hash":         hash,
+		"parentHash":   "0x0000000000000000000000000000000000000000000000000000000000000000",
+		"transactions": txs,
+	}
+}
+
+func explorerTx(hash string, to interface{}, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"hash":  hash,
+		"from":  "0x2cf014d432e92685ef1cf7bc7967a4e4debca092",
+		"to":    to,
+		"value": value,
+	}
+}
+
+func newFakeEthExplorer() *fakeEthExplorer {
+	return &fakeEthExplorer{
+		blockNumber: "0x65",
+		blocks: map[string]interface{}{
+			"0x64": explorerBlock("0x64", "0x3fcbb2d5f6c8b7da3e2e3f5d7a4a4ebc0ab6f1a5a2d4d2cc2a9c7d1ba6e1a001",
+				// 1 ETH
+				explorerTx("0x8d1f0a2f4d6b58b3b7a6e0d3d0c2c8f5e1f9a9b3a7d7c6e5f4a3b2c1d0e0f001", testExplorerDepositAddr, "0xde0b6b3a7640000"),
+				// A contract creation has no recipient
+				explorerTx("0x8d1f0a2f4d6b58b3b7a6e0d3d0c2c8f5e1f9a9b3a7d7c6e5f4a3b2c1d0e0f002", nil, "0x0"),
+				explorerTx("0x8d1f0a2f4d6b58b3b7a6e0d3d0c2c8f5e1f9a9b3a7d7c6e5f4a3b2c1d0e0f003", "0x2cf014d432e92685ef1cf7bc7967a4e4debca092", "0x1"),
+			),
+			"0x65": explorerBlock("0x65", "0x3fcbb2d5f6c8b7da3e2e3f5d7a4a4ebc0ab6f1a5a2d4d2cc2a9c7d1ba6e1a002",
+				// 0.5 ETH
+				explorerTx("0x8d1f0a2f4d6b58b3b7a6e0d3d0c2c8f5e1f9a9b3a7d7c6e5f4a3b2c1d0e0f004", testExplorerDepositAddr, "0x6f05b59d3b20000"),
+			),
+		},
+	}
+}
+
+func TestEthExplorerClient(t *testing.T) {
+	explorer := newFakeEthExplorer()
+	srv := httptest.NewServer(explorer)
+	defer srv.Close()
+
+	c := NewEthExplorerClient(srv.URL+"/api", testExplorerAPIKey, TransportConfig{})
+
+	n, err := c.GetBlockCount()
+	require.NoError(t, err)
+	require.Equal(t, int64(101), n)
+
+	b, err := c.GetBlock(100)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), b.Height)
+	require.Equal(t, "0x3fcbb2d5f6c8b7da3e2e3f5d7a4a4ebc0ab6f1a5a2d4d2cc2a9c7d1ba6e1a001", b.Hash)
+
+	// The contract creation is skipped, N is the index of the transaction in the block
+	require.Len(t, b.RawTx, 2)
+	require.Equal(t, "0x8d1f0a2f4d6b58b3b7a6e0d3d0c2c8f5e1f9a9b3a7d7c6e5f4a3b2c1d0e0f001", b.RawTx[0].Txid)
+	// Values are in Gwei, and addresses are formatted the same as for a geth node
+	require.Equal(t, []CommonVout{
+		{
+			N:         0,
+			Value:     1e9,
+			Addresses: []string{common.HexToAddress(testExplorerDepositAddr).String()},
+		},
+	}, b.RawTx[0].Vout)
+	require.Equal(t, uint32(2), b.RawTx[1].Vout[0].N)
+	require.Equal(t, int64(0), b.RawTx[1].Vout[0].Value)
+
+	// A block that has not been mined yet
+	_, err = c.GetBlock(102)
+	require.Equal(t, ErrEmptyBlock, err)
+
+	// Explorer API errors
+	tt := []struct {
+		name   string
+		rsp    interface{}
+		status int
+		err    string
+	}{
+		{
+			name: "rate limited",
+			rsp: map[string]interface{}{
+				"status":  "0",
+				"message": "NOTOK",
+				"result":  "Max rate limit reached",
+			},
+			err: "eth_blockNumber: explorer API error: Max rate limit reached",
+		},
+		{
+			name: "json-rpc error",
+			rsp: map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      1,
+				"error": map[string]interface{}{
+					"code":    -32602,
+					"message": "invalid argument",
+				},
+			},
+			err: "eth_blockNumber: explorer API error -32602: invalid argument",
+		},
+		{
+			name:   "http error",
+			status: http.StatusBadGateway,
+			err:    "eth_blockNumber: explorer API responded with 502 Bad Gateway",
+		},
+		{
+			name: "no result",
+			rsp: map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      1,
+			},
+			err: "eth_blockNumber: explorer API response has no result",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			explorer.failAction = "eth_blockNumber"
+			explorer.failRsp = tc.rsp
+			explorer.failStatus = tc.status
+			defer func() {
+				explorer.failAction = ""
+			}()
+
+			_, err := c.GetBlockCount()
+			require.Error(t, err)
+			require.Equal(t, tc.err, err.Error())
+		})
+	}
+}
+
+func TestEthExplorerScanner(t *testing.T) {
+	srv := httptest.NewServer(newFakeEthExplorer())
+	defer srv.Close()
+
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	err = store.AddSupportedCoin(CoinTypeETH)
+	require.NoError(t, err)
+
+	c := NewEthExplorerClient(srv.URL+"/api", testExplorerAPIKey, TransportConfig{})
+	addr := common.HexToAddress(testExplorerDepositAddr).String()
+
+	scr, err := NewETHScanner(log, store, c, Config{
+		ScanPeriod:            time.Millisecond * 10,
+		DepositBufferSize:     5,
+		InitialScanHeight:     100,
+		ConfirmationsRequired: 0,
+	})
+	require.NoError(t, err)
+
+	err = scr.AddScanAddress(addr, CoinTypeETH)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	var dvs []Deposit
+	go func() {
+		defer close(done)
+		for dv := range scr.GetDeposit() {
+			d := dv.Deposit
+			d.Processed = false
+			require.NotZero(t, d.FirstSeen)
+			d.FirstSeen = 0
+			dvs = append(dvs, d)
+			dv.ErrC <- nil
+		}
+	}()
+
+	time.AfterFunc(minShutdownWait, func() {
+		scr.Shutdown()
+	})
+
+	err = scr.Run()
+	require.NoError(t, err)
+	<-done
+
+	require.Len(t, dvs, 2)
+	require.Equal(t, Deposit{
+		CoinType: CoinTypeETH,
+		Address:  addr,
+		Value:    1e9,
+		Height:   100,
+		Tx:       "0x8d1f0a2f4d6b58b3b7a6e0d3d0c2c8f5e1f9a9b3a7d7c6e5f4a3b2c1d0e0f001",
+		N:        0,
+	}, dvs[0])
+	require.Equal(t, Deposit{
+		CoinType: CoinTypeETH,
+		Address:  addr,
+		Value:    5e8,
+		Height:   101,
+		Tx:       "0x8d1f0a2f4d6b58b3b7a6e0d3d0c2c8f5e1f9a9b3a7d7c6e5f4a3b2c1d0e0f004",
+		N:        0,
+	}, dvs[1])
+}
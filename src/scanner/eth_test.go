@@ -3,6 +3,7 @@ package scanner
 import (
 	"encoding/json"
 	"errors"
+	"math/big"
 	"testing"
 	"time"
 
@@ -111,6 +112,14 @@ func (dec *dummyEthrpcclient) GetBlockVerboseTx(seq uint64) (*types.Block, error
 	return block, nil
 }
 
+func (dec *dummyEthrpcclient) GetBlock(seq uint64) (*CommonBlock, error) {
+	b, err := dec.GetBlockVerboseTx(seq)
+	if err != nil {
+		return nil, err
+	}
+	return ethBlock2CommonBlock(b)
+}
+
 func (dec *dummyEthrpcclient) GetBlockCount() (int64, error) {
 	if dec.blockCountError != nil {
 		// blockCountError is only returned once
@@ -581,3 +590,40 @@ func TestEthScanner(t *testing.T) {
 		})
 	})
 }
+
+// gasPriceEthrpcclient is an ethereum client that suggests a gas price
+type gasPriceEthrpcclient struct {
+	*dummyEthrpcclient
+	price *big.Int
+	err   error
+}
+
+func (c *gasPriceEthrpcclient) GasPrice() (*big.Int, error) {
+	return c.price, c.err
+}
+
+func TestETHScannerEstimateFee(t *testing.T) {
+	// The client can't suggest a gas price
+	scr := &ETHScanner{
+		ethClient: &dummyEthrpcclient{},
+	}
+	_, err := scr.EstimateFee()
+	require.Equal(t, ErrFeeEstimateUnavailable, err)
+
+	client := &gasPriceEthrpcclient{
+		dummyEthrpcclient: &dummyEthrpcclient{},
+		price:             big.NewInt(21500000000),
+	}
+	scr.ethClient = client
+
+	fee, err := scr.EstimateFee()
+	require.NoError(t, err)
+	require.Equal(t, FeeEstimate{
+		Fee:  "21.5",
+		Unit: "Gwei",
+	}, fee)
+
+	client.err = errors.New("geth unavailable")
+	_, err = scr.EstimateFee()
+	require.Equal(t, client.err, err)
+}
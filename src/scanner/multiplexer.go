@@ -1,13 +1,23 @@
 package scanner
 
 import (
+	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	// ErrUnknownCoinType is replied to a deposit whose coin type is not the coin type of the scanner that sent it
+	ErrUnknownCoinType = errors.New("Deposit coin type does not match a registered scanner")
+
+	// unknownCoinTypeDeposits counts, per coin type, the deposits dropped by the multiplexer because of their coin type
+	unknownCoinTypeDeposits = expvar.NewMap("multiplexer_unknown_coin_type_deposits")
+)
+
 // Multiplexer manager of scanner
 type Multiplexer struct {
 	scannerMap   map[string]Scanner
@@ -17,6 +27,11 @@ type Multiplexer struct {
 	done         chan struct{}
 	log          logrus.FieldLogger
 	sync.RWMutex
+
+	// DiscardUnknownCoinTypes acknowledges the deposits dropped because of their coin type as processed,
+	// so that they are not sent again. Otherwise they are acknowledged with ErrUnknownCoinType,
+	// and stay unprocessed in the scanner's db until teller is restarted
+	DiscardUnknownCoinTypes bool
 }
 
 // NewMultiplexer create multiplexer instance
@@ -95,7 +110,19 @@ func (m *Multiplexer) Multiplex() error {
 						log.WithField("name", name).Info("sub-scanner closed")
 						return
 					}
-					m.outChan <- dv
+
+					if dv.CoinType != name {
+						m.dropUnknownCoinType(name, dv)
+						continue
+					}
+
+					select {
+					case m.outChan <- dv:
+					case <-m.quit:
+						// The scanner did not receive an ack for this deposit,
+						// so it remains unprocessed and is resent on restart
+						return
+					}
 				case <-m.quit:
 					return
 				}
@@ -107,13 +134,159 @@ func (m *Multiplexer) Multiplex() error {
 	return nil
 }
 
-// Shutdown shutdown the multiplexer
+// dropUnknownCoinType drops a deposit sent by the scanner of coinType with a different coin type,
+// instead of forwarding it to the exchange which would process it as a deposit of the wrong coin
+func (m *Multiplexer) dropUnknownCoinType(coinType string, dv DepositNote) {
+	unknownCoinTypeDeposits.Add(dv.CoinType, 1)
+
+	log := m.log.WithFields(logrus.Fields{
+		"scannerCoinType": coinType,
+		"deposit":         dv.Deposit,
+	})
+
+	if m.DiscardUnknownCoinTypes {
+		log.Error("Discarding deposit of unknown coin type, it will not be sent again")
+		dv.ErrC <- nil
+		return
+	}
+
+	log.Error("Dropping deposit of unknown coin type, it will be sent again when the scanner restarts")
+	dv.ErrC <- ErrUnknownCoinType
+}
+
+// Shutdown shutdown the multiplexer.
+// The scanners should be shutdown first, so that their buffered deposits
+// are forwarded to the exchange before the multiplexer stops.
+// The output channel is closed after all forwarding goroutines have exited.
 func (m *Multiplexer) Shutdown() {
 	m.log.Info("Closing Multiplexer")
 	close(m.quit)
-	close(m.outChan)
 	m.log.Info("Waiting for Multiplexer to stop")
 	<-m.done
+	close(m.outChan)
+}
+
+// CoinHeights is the Heights of a coin's scanner, or the error fetching them
+type CoinHeights struct {
+	CoinType string
+	Heights
+	Err error
+}
+
+// Heights returns the Heights of the scanners that report them, in the order of GetCoinTypes()
+func (m *Multiplexer) Heights() []CoinHeights {
+	// Don't hold the lock while querying the nodes
+	reporters := make(map[string]HeightsReporter)
+	m.RWMutex.RLock()
+	for coinType, scan := range m.scannerMap {
+		if hr, ok := scan.(HeightsReporter); ok {
+			reporters[coinType] = hr
+		}
+	}
+	m.RWMutex.RUnlock()
+
+	var heights []CoinHeights
+	for _, coinType := range GetCoinTypes() {
+		hr, ok := reporters[coinType]
+		if !ok {
+			continue
+		}
+
+		h, err := hr.Heights()
+		if err != nil {
+			m.log.WithError(err).WithField("coinType", coinType).Error("Heights failed")
+		}
+
+		heights = append(heights, CoinHeights{
+			CoinType: coinType,
+			Heights:  h,
+			Err:      err,
+		})
+	}
+
+	return heights
+}
+
+// FeeEstimates returns the network fees suggested by the scanners that can estimate them, keyed by coin type.
+// Coins whose fee can't be estimated are left out
+func (m *Multiplexer) FeeEstimates() map[string]FeeEstimate {
+	// Don't hold the lock while querying the nodes
+	estimators := make(map[string]FeeEstimator)
+	m.RWMutex.RLock()
+	for coinType, scan := range m.scannerMap {
+		if fe, ok := scan.(FeeEstimator); ok {
+			estimators[coinType] = fe
+		}
+	}
+	m.RWMutex.RUnlock()
+
+	fees := make(map[string]FeeEstimate, len(estimators))
+	for coinType, fe := range estimators {
+		fee, err := fe.EstimateFee()
+		switch err {
+		case nil:
+			fees[coinType] = fee
+		case ErrFeeEstimateUnavailable:
+			m.log.WithField("coinType", coinType).Debug("Network fee estimate unavailable")
+		default:
+			m.log.WithError(err).WithField("coinType", coinType).Error("EstimateFee failed")
+		}
+	}
+
+	return fees
+}
+
+// AddressBalancers returns the scanners that can read deposit address balances, keyed by coin type
+func (m *Multiplexer) AddressBalancers() map[string]AddressBalancer {
+	m.RWMutex.RLock()
+	defer m.RWMutex.RUnlock()
+
+	balancers := make(map[string]AddressBalancer)
+	for coinType, scan := range m.scannerMap {
+		if ab, ok := scan.(AddressBalancer); ok {
+			balancers[coinType] = ab
+		}
+	}
+
+	return balancers
+}
+
+// AddressBalance returns the balance of a deposit address read by the scanner of coinType, see AddressBalancer.
+// Returns ErrAddressBalanceUnavailable if the scanner can't read balances
+func (m *Multiplexer) AddressBalance(ctx context.Context, coinType, addr string) (int64, error) {
+	m.RWMutex.RLock()
+	scan, ok := m.scannerMap[coinType]
+	m.RWMutex.RUnlock()
+
+	if !ok {
+		return 0, fmt.Errorf("unknown cointype \"%s\"", coinType)
+	}
+
+	ab, ok := scan.(AddressBalancer)
+	if !ok {
+		return 0, ErrAddressBalanceUnavailable
+	}
+
+	return ab.AddressBalance(ctx, addr)
+}
+
+// VerifyDeposit checks a deposit against the node of the scanner of its coin type, see DepositVerifier.
+// Returns ErrDepositUnverifiable if the scanner can't verify deposits
+func (m *Multiplexer) VerifyDeposit(dv Deposit) error {
+	m.RWMutex.RLock()
+	scan, ok := m.scannerMap[dv.CoinType]
+	m.RWMutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("unknown cointype \"%s\"", dv.CoinType)
+	}
+
+	dvr, ok := scan.(DepositVerifier)
+	if !ok {
+		return ErrDepositUnverifiable
+	}
+
+	return dvr.VerifyDeposit(dv)
 }
 
 // GetDeposit returns deposit values channel.
@@ -2,6 +2,7 @@ package scanner
 
 import (
 	"errors"
+	"expvar"
 	"fmt"
 	"testing"
 	"time"
@@ -414,3 +415,198 @@ func TestMultiplexerForAll(t *testing.T) {
 	}()
 	<-done
 }
+
+type fakeHeightsScanner struct {
+	heights Heights
+	err     error
+}
+
+func (s *fakeHeightsScanner) AddScanAddress(addr, coinType string) error {
+	return nil
+}
+
+func (s *fakeHeightsScanner) GetDeposit() <-chan DepositNote {
+	return nil
+}
+
+func (s *fakeHeightsScanner) Heights() (Heights, error) {
+	return s.heights, s.err
+}
+
+func TestMultiplexerHeights(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := NewMultiplexer(log)
+
+	require.Empty(t, m.Heights())
+
+	tipErr := errors.New("node unavailable")
+
+	err := m.AddScanner(&fakeHeightsScanner{
+		heights: Heights{
+			ScannedHeight:  20,
+			ChainTipHeight: 25,
+		},
+	}, CoinTypeSKY)
+	require.NoError(t, err)
+
+	err = m.AddScanner(&fakeHeightsScanner{
+		heights: Heights{
+			ScannedHeight:  10,
+			ChainTipHeight: 12,
+		},
+	}, CoinTypeBTC)
+	require.NoError(t, err)
+
+	err = m.AddScanner(&fakeHeightsScanner{
+		heights: Heights{
+			ScannedHeight: 30,
+		},
+		err: tipErr,
+	}, CoinTypeWAVES)
+	require.NoError(t, err)
+
+	// Scanners that don't report heights are skipped
+	err = m.AddScanner(NewDummyScanner(log), CoinTypeETH)
+	require.NoError(t, err)
+
+	require.Equal(t, []CoinHeights{
+		{
+			CoinType: CoinTypeBTC,
+			Heights: Heights{
+				ScannedHeight:  10,
+				ChainTipHeight: 12,
+			},
+		},
+		{
+			CoinType: CoinTypeSKY,
+			Heights: Heights{
+				ScannedHeight:  20,
+				ChainTipHeight: 25,
+			},
+		},
+		{
+			CoinType: CoinTypeWAVES,
+			Heights: Heights{
+				ScannedHeight: 30,
+			},
+			Err: tipErr,
+		},
+	}, m.Heights())
+}
+
+func TestMultiplexerUnknownCoinType(t *testing.T) {
+	for _, discard := range []bool{false, true} {
+		t.Run(fmt.Sprintf("discard=%v", discard), func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+			m := NewMultiplexer(log)
+			m.DiscardUnknownCoinTypes = discard
+
+			ds := NewDummyScanner(log)
+			err := m.AddScanner(ds, CoinTypeBTC)
+			require.NoError(t, err)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				require.NoError(t, m.Multiplex())
+			}()
+
+			before := int64(0)
+			if v, ok := unknownCoinTypeDeposits.Get("DOGE").(*expvar.Int); ok {
+				before = v.Value()
+			}
+
+			// A deposit of a coin type with no registered scanner is dropped
+			dv := NewDepositNote(Deposit{
+				CoinType: "DOGE",
+				Address:  "DH5yaieqoZN36fDVciNyRueRGvGLR3mr7L",
+				Value:    1e8,
+				Height:   10,
+				Tx:       "doge-tx",
+			})
+			ds.deposits <- dv
+
+			select {
+			case err := <-dv.ErrC:
+				if discard {
+					require.NoError(t, err)
+				} else {
+					require.Equal(t, ErrUnknownCoinType, err)
+				}
+			case <-time.After(time.Second * 3):
+				t.Fatal("Waiting for the dropped deposit to be acknowledged timed out")
+			}
+
+			require.Equal(t, before+1, unknownCoinTypeDeposits.Get("DOGE").(*expvar.Int).Value())
+
+			// A deposit of the scanner's coin type is forwarded
+			dv = NewDepositNote(Deposit{
+				CoinType: CoinTypeBTC,
+				Address:  "1LEWwJkDj8xriE87ALzQYcHjTmD8aqDj1f",
+				Value:    1e8,
+				Height:   10,
+				Tx:       "btc-tx",
+			})
+			ds.deposits <- dv
+
+			select {
+			case fdv := <-m.GetDeposit():
+				require.Equal(t, dv.Deposit, fdv.Deposit)
+			case <-time.After(time.Second * 3):
+				t.Fatal("Waiting for the deposit to be forwarded timed out")
+			}
+
+			// The dropped deposit was not forwarded
+			select {
+			case fdv := <-m.GetDeposit():
+				t.Fatalf("Unexpected deposit forwarded: %+v", fdv.Deposit)
+			default:
+			}
+
+			close(ds.deposits)
+			m.Shutdown()
+			<-done
+		})
+	}
+}
+
+type fakeFeeScanner struct {
+	fakeHeightsScanner
+	fee FeeEstimate
+	err error
+}
+
+func (s *fakeFeeScanner) EstimateFee() (FeeEstimate, error) {
+	return s.fee, s.err
+}
+
+func TestMultiplexerFeeEstimates(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	m := NewMultiplexer(log)
+
+	require.Empty(t, m.FeeEstimates())
+
+	err := m.AddScanner(&fakeFeeScanner{
+		fee: FeeEstimate{Fee: "0.00012", Unit: "BTC/kB"},
+	}, CoinTypeBTC)
+	require.NoError(t, err)
+
+	// Coins whose fee can't be estimated are left out
+	err = m.AddScanner(&fakeFeeScanner{
+		err: ErrFeeEstimateUnavailable,
+	}, CoinTypeETH)
+	require.NoError(t, err)
+
+	err = m.AddScanner(&fakeFeeScanner{
+		err: errors.New("node unavailable"),
+	}, CoinTypeWAVES)
+	require.NoError(t, err)
+
+	// Scanners that can't estimate fees are skipped
+	err = m.AddScanner(NewDummyScanner(log), CoinTypeSKY)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]FeeEstimate{
+		CoinTypeBTC: {Fee: "0.00012", Unit: "BTC/kB"},
+	}, m.FeeEstimates())
+}
@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+
+	"github.com/MDLlife/teller/src/util/dbutil"
+)
+
+// VoutReplay records how an output of a replayed block compared to the scan addresses
+type VoutReplay struct {
+	Txid      string   `json:"txid"`
+	N         uint32   `json:"n"`
+	Addresses []string `json:"addresses"`
+	Value     int64    `json:"value"`
+	// Matched is true if the output is a deposit the scanner records
+	Matched bool `json:"matched"`
+	// Recorded is true if the deposit was already recorded in the db
+	Recorded bool `json:"recorded,omitempty"`
+	// Reason explains why an output that nearly matched a scan address is not a deposit
+	Reason string `json:"reason,omitempty"`
+}
+
+// BlockReplay is the result of running a single block through the deposit matching logic, see Store.ReplayBlock
+type BlockReplay struct {
+	CoinType      string       `json:"coin_type"`
+	Height        int64        `json:"height"`
+	Hash          string       `json:"hash"`
+	ScanAddresses int          `json:"scan_addresses"`
+	Matches       []VoutReplay `json:"matches"`
+	NearMisses    []VoutReplay `json:"near_misses"`
+}
+
+// ReplayBlock runs a block through the same matching as ScanBlock, logging every output compared to the scan addresses.
+// Nothing is written to the db. Outputs that are deposits are returned in Matches, and outputs to a scan address
+// that are not deposits, e.g. because they are below dustValue, are returned in NearMisses with the reason
+func (s *Store) ReplayBlock(block *CommonBlock, coinType string, dustValue int64) (*BlockReplay, error) {
+	log := s.log.WithFields(logrus.Fields{
+		"coinType": coinType,
+		"height":   block.Height,
+		"hash":     block.Hash,
+	})
+
+	replay := &BlockReplay{
+		CoinType: coinType,
+		Height:   block.Height,
+		Hash:     block.Hash,
+	}
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		addrs, err := s.getScanAddressesTx(tx, coinType)
+		if err != nil {
+			return err
+		}
+
+		replay.ScanAddresses = len(addrs)
+
+		addrMap := make(map[string]struct{}, len(addrs))
+		foldedAddrs := make(map[string]string, len(addrs))
+		for _, a := range addrs {
+			addrMap[a] = struct{}{}
+			foldedAddrs[strings.ToLower(a)] = a
+		}
+
+		for _, t := range block.RawTx {
+			for i, v := range t.Vout {
+				vr := VoutReplay{
+					Txid:      t.Txid,
+					N:         v.N,
+					Addresses: v.Addresses,
+					Value:     v.Value,
+				}
+
+				replayVout(&vr, i, addrMap, foldedAddrs, dustValue)
+
+				if vr.Matched {
+					hasKey, err := dbutil.BucketHasKey(tx, DepositBkt, Deposit{Tx: vr.Txid, N: vr.N}.ID())
+					if err != nil {
+						return err
+					}
+					vr.Recorded = hasKey
+				}
+
+				log.WithField("vout", vr).Debug("Replayed output")
+
+				switch {
+				case vr.Matched:
+					replay.Matches = append(replay.Matches, vr)
+				case vr.Reason != "":
+					replay.NearMisses = append(replay.NearMisses, vr)
+				}
+			}
+		}
+
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("ReplayBlock failed")
+		return nil, err
+	}
+
+	log.WithFields(logrus.Fields{
+		"matches":    len(replay.Matches),
+		"nearMisses": len(replay.NearMisses),
+	}).Info("Replayed block")
+
+	return replay, nil
+}
+
+// replayVout compares the i-th output of a transaction to the scan addresses the way scanSpecifiedBlock does.
+// foldedAddrs maps the lowercased scan addresses to the scan addresses
+func replayVout(vr *VoutReplay, i int, addrMap map[string]struct{}, foldedAddrs map[string]string, dustValue int64) {
+	for j, a := range vr.Addresses {
+		if _, ok := addrMap[a]; ok {
+			switch {
+			case i != 0:
+				vr.Reason = fmt.Sprintf("Output pays scan address %s, but only the first output of a transaction is scanned", a)
+			case j != 0:
+				vr.Reason = fmt.Sprintf("Output pays scan address %s, but only the first address of an output is scanned", a)
+			case vr.Value < dustValue:
+				vr.Reason = fmt.Sprintf("Output pays scan address %s, but its value is below the dust value %d", a, dustValue)
+			default:
+				vr.Matched = true
+			}
+			return
+		}
+
+		if scanAddr, ok := foldedAddrs[strings.ToLower(strings.TrimSpace(a))]; ok {
+			vr.Reason = fmt.Sprintf("Output address %q differs from scan address %s only by case or whitespace", a, scanAddr)
+			return
+		}
+	}
+}
+
+// verifyBlockDeposit returns a DepositMismatchError unless output dv.N of transaction dv.Tx in block
+// pays exactly dv.Value to dv.Address. Unlike the deposit matching, any output and any address of it is accepted
+func verifyBlockDeposit(block *CommonBlock, dv Deposit) error {
+	for _, t := range block.RawTx {
+		if t.Txid != dv.Tx {
+			continue
+		}
+
+		for _, v := range t.Vout {
+			if v.N != dv.N {
+				continue
+			}
+
+			paysAddress := false
+			for _, a := range v.Addresses {
+				if a == dv.Address {
+					paysAddress = true
+					break
+				}
+			}
+
+			switch {
+			case !paysAddress:
+				return DepositMismatchError{fmt.Sprintf("output %d of transaction %s does not pay %s", dv.N, dv.Tx, dv.Address)}
+			case v.Value != dv.Value:
+				return DepositMismatchError{fmt.Sprintf("output %d of transaction %s pays %d, not %d", dv.N, dv.Tx, v.Value, dv.Value)}
+			default:
+				return nil
+			}
+		}
+
+		return DepositMismatchError{fmt.Sprintf("transaction %s has no output %d", dv.Tx, dv.N)}
+	}
+
+	return DepositMismatchError{fmt.Sprintf("transaction %s is not in the block at height %d", dv.Tx, block.Height)}
+}
@@ -0,0 +1,296 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/MDLlife/MDL/src/readable"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+// fakeSkyRPCClient serves a single block, and the transactions of txs
+type fakeSkyRPCClient struct {
+	block readable.Block
+	txs   map[string]*readable.TransactionWithStatus
+}
+
+func (c *fakeSkyRPCClient) GetTransaction(txid string) (*readable.TransactionWithStatus, error) {
+	if tx, ok := c.txs[txid]; ok {
+		return tx, nil
+	}
+	return nil, fmt.Errorf("transaction %s not found", txid)
+}
+
+func (c *fakeSkyRPCClient) GetBlocks(start, end uint64) (*readable.Blocks, error) {
+	return &readable.Blocks{
+		Blocks: []readable.Block{c.block},
+	}, nil
+}
+
+func (c *fakeSkyRPCClient) GetBlocksBySeq(seq uint64) (*readable.Block, error) {
+	if seq != c.block.Head.BkSeq {
+		return nil, fmt.Errorf("block %d not found", seq)
+	}
+	return &c.block, nil
+}
+
+func (c *fakeSkyRPCClient) GetLastBlocks() (*readable.Block, error) {
+	return &c.block, nil
+}
+
+func (c *fakeSkyRPCClient) Shutdown() {}
+
+func TestStoreReplayBlock(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	s, err := NewStore(log, db)
+	require.NoError(t, err)
+	require.NoError(t, s.AddSupportedCoin(CoinTypeBTC))
+
+	addr := "1LEWwJkDj8xriE87ALzQYcHjTmD8aqDj1f"
+	require.NoError(t, s.AddScanAddress(addr, CoinTypeBTC))
+
+	block := &CommonBlock{
+		Height: 10,
+		Hash:   "block-10",
+		RawTx: []CommonTx{
+			{
+				Txid: "match",
+				Vout: []CommonVout{
+					{Value: 1e8, N: 0, Addresses: []string{addr}},
+				},
+			},
+			{
+				Txid: "dust",
+				Vout: []CommonVout{
+					{Value: 100, N: 0, Addresses: []string{addr}},
+				},
+			},
+			{
+				Txid: "second-output",
+				Vout: []CommonVout{
+					{Value: 1e8, N: 0, Addresses: []string{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}},
+					{Value: 2e8, N: 1, Addresses: []string{addr}},
+				},
+			},
+			{
+				Txid: "other",
+				Vout: []CommonVout{
+					{Value: 1e8, N: 0, Addresses: []string{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}},
+				},
+			},
+		},
+	}
+
+	replay, err := s.ReplayBlock(block, CoinTypeBTC, 546)
+	require.NoError(t, err)
+	require.Equal(t, CoinTypeBTC, replay.CoinType)
+	require.Equal(t, int64(10), replay.Height)
+	require.Equal(t, 1, replay.ScanAddresses)
+
+	require.Equal(t, []VoutReplay{
+		{
+			Txid:      "match",
+			N:         0,
+			Addresses: []string{addr},
+			Value:     1e8,
+			Matched:   true,
+		},
+	}, replay.Matches)
+
+	require.Len(t, replay.NearMisses, 2)
+	require.Equal(t, "dust", replay.NearMisses[0].Txid)
+	require.Contains(t, replay.NearMisses[0].Reason, "below the dust value 546")
+	require.Equal(t, "second-output", replay.NearMisses[1].Txid)
+	require.Equal(t, uint32(1), replay.NearMisses[1].N)
+	require.Contains(t, replay.NearMisses[1].Reason, "only the first output of a transaction is scanned")
+
+	// Nothing is recorded
+	dvs, err := s.GetUnprocessedDeposits(CoinTypeBTC)
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+
+	// Once scanned, the match is reported as recorded
+	dvs, err = s.ScanBlock(block, CoinTypeBTC, 546)
+	require.NoError(t, err)
+	require.Len(t, dvs, 1)
+
+	replay, err = s.ReplayBlock(block, CoinTypeBTC, 546)
+	require.NoError(t, err)
+	require.Len(t, replay.Matches, 1)
+	require.True(t, replay.Matches[0].Recorded)
+}
+
+func TestSKYScannerScanSingleBlock(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	require.NoError(t, store.AddSupportedCoin(CoinTypeSKY))
+
+	addr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	require.NoError(t, store.AddScanAddress(addr, CoinTypeSKY))
+
+	client := &fakeSkyRPCClient{}
+	client.block.Head.BkSeq = 20
+	client.block.Head.Hash = "block-20"
+	client.block.Body.Transactions = []readable.Transaction{
+		{
+			Hash: "match",
+			Out: []readable.TransactionOutput{
+				{Address: addr, Coins: "2.5"},
+			},
+		},
+		{
+			// A near-miss, the address was copied with the wrong case
+			Hash: "near-miss",
+			Out: []readable.TransactionOutput{
+				{Address: strings.ToLower(addr), Coins: "1"},
+			},
+		},
+	}
+
+	scr, err := NewSkycoinScanner(log, store, client, Config{})
+	require.NoError(t, err)
+
+	replay, err := scr.ScanSingleBlock(20)
+	require.NoError(t, err)
+	require.Equal(t, "block-20", replay.Hash)
+
+	require.Len(t, replay.Matches, 1)
+	require.Equal(t, "match", replay.Matches[0].Txid)
+	require.Equal(t, int64(2500000), replay.Matches[0].Value)
+	require.False(t, replay.Matches[0].Recorded)
+
+	require.Len(t, replay.NearMisses, 1)
+	require.Equal(t, "near-miss", replay.NearMisses[0].Txid)
+	require.Contains(t, replay.NearMisses[0].Reason, "only by case or whitespace")
+
+	// Nothing is recorded
+	dvs, err := store.GetUnprocessedDeposits(CoinTypeSKY)
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+
+	_, err = scr.ScanSingleBlock(21)
+	require.Error(t, err)
+}
+
+func TestVerifyBlockDeposit(t *testing.T) {
+	addr := "1LEWwJkDj8xriE87ALzQYcHjTmD8aqDj1f"
+	block := &CommonBlock{
+		Height: 10,
+		Hash:   "block-10",
+		RawTx: []CommonTx{
+			{
+				Txid: "tx-1",
+				Vout: []CommonVout{
+					{Value: 1e8, N: 0, Addresses: []string{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}},
+					{Value: 2e8, N: 1, Addresses: []string{addr}},
+				},
+			},
+		},
+	}
+
+	tt := []struct {
+		name string
+		dv   Deposit
+		err  string
+	}{
+		{
+			name: "second output",
+			dv:   Deposit{Tx: "tx-1", N: 1, Address: addr, Value: 2e8, Height: 10},
+		},
+		{
+			name: "not in block",
+			dv:   Deposit{Tx: "tx-2", N: 1, Address: addr, Value: 2e8, Height: 10},
+			err:  "transaction tx-2 is not in the block at height 10",
+		},
+		{
+			name: "no such output",
+			dv:   Deposit{Tx: "tx-1", N: 2, Address: addr, Value: 2e8, Height: 10},
+			err:  "transaction tx-1 has no output 2",
+		},
+		{
+			name: "other address",
+			dv:   Deposit{Tx: "tx-1", N: 0, Address: addr, Value: 1e8, Height: 10},
+			err:  "output 0 of transaction tx-1 does not pay " + addr,
+		},
+		{
+			name: "other value",
+			dv:   Deposit{Tx: "tx-1", N: 1, Address: addr, Value: 3e8, Height: 10},
+			err:  "output 1 of transaction tx-1 pays 200000000, not 300000000",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyBlockDeposit(block, tc.dv)
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Equal(t, DepositMismatchError{tc.err}, err)
+		})
+	}
+}
+
+func TestSKYScannerVerifyDeposit(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	require.NoError(t, store.AddSupportedCoin(CoinTypeSKY))
+
+	addr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	client := &fakeSkyRPCClient{}
+	client.block.Head.BkSeq = 20
+	client.block.Head.Hash = "block-20"
+	client.block.Body.Transactions = []readable.Transaction{
+		{
+			Hash: "deposit",
+			Out: []readable.TransactionOutput{
+				{Address: addr, Coins: "2.5"},
+			},
+		},
+	}
+
+	scr, err := NewSkycoinScanner(log, store, client, Config{})
+	require.NoError(t, err)
+
+	dv := Deposit{
+		CoinType: CoinTypeSKY,
+		Address:  addr,
+		Value:    2500000,
+		Height:   20,
+		Tx:       "deposit",
+	}
+	require.NoError(t, scr.VerifyDeposit(dv))
+
+	forged := dv
+	forged.Value = 25000000
+	err = scr.VerifyDeposit(forged)
+	require.IsType(t, DepositMismatchError{}, err)
+
+	// The block can't be fetched
+	wrongHeight := dv
+	wrongHeight.Height = 21
+	err = scr.VerifyDeposit(wrongHeight)
+	require.Error(t, err)
+	_, isMismatch := err.(DepositMismatchError)
+	require.False(t, isMismatch)
+
+	// The block doesn't have the required confirmations yet
+	scr.Base.(*BaseScanner).Cfg.ConfirmationsRequired = 1
+	require.Equal(t, ErrDepositUnconfirmed, scr.VerifyDeposit(dv))
+}
@@ -1,11 +1,12 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/modeneis/waves-go-client/model"
 	//"github.com/skycoin/skycoin/src/api"
 	"github.com/MDLlife/MDL/src/readable"
@@ -44,13 +45,71 @@ type WavesRPCClient interface {
 	Shutdown()
 }
 
-// EthRPCClient rpcclient interface
+// EthRPCClient is the interface the ETHScanner reads the ethereum blockchain with.
+// It is implemented by EthClient for a geth node and by EthExplorerClient for an etherscan-like HTTP API.
+// GetBlock returns ErrEmptyBlock if there is no block at seq yet
 type EthRPCClient interface {
-	GetBlockVerboseTx(seq uint64) (*types.Block, error)
+	GetBlock(seq uint64) (*CommonBlock, error)
 	GetBlockCount() (int64, error)
 	Shutdown()
 }
 
+// Heights is a scanner's view of its blockchain
+type Heights struct {
+	ScannedHeight  int64 // height of the last block scanned
+	ChainTipHeight int64 // best block height reported by the node
+	Healthy        bool  // false if the best block height stopped advancing within the scanner's stall timeout
+}
+
+// HeightsReporter is implemented by scanners that report their Heights
+type HeightsReporter interface {
+	Heights() (Heights, error)
+}
+
+// FeeEstimate is a node's suggested network fee for a transaction
+type FeeEstimate struct {
+	Fee  string // decimal amount, in Unit
+	Unit string // e.g. "BTC/kB" for a fee rate, "Gwei" for a gas price
+}
+
+// FeeEstimator is implemented by scanners that can suggest a network fee for deposits
+type FeeEstimator interface {
+	// EstimateFee returns ErrFeeEstimateUnavailable if the node can't estimate fees
+	EstimateFee() (FeeEstimate, error)
+}
+
+// AddressBalancer is implemented by scanners that can read a deposit address's balance from their node
+type AddressBalancer interface {
+	// AddressBalance returns the balance of addr in the unit the scanner records deposit values in, e.g. Gwei for ETH.
+	// Returns ErrAddressBalanceUnavailable if the node can't report address balances.
+	// The request to the node is abandoned when ctx is done
+	AddressBalance(ctx context.Context, addr string) (int64, error)
+}
+
+// DepositVerifier is implemented by scanners that can check a deposit against their node
+type DepositVerifier interface {
+	// VerifyDeposit returns a DepositMismatchError if output dv.N of transaction dv.Tx,
+	// in the block at dv.Height, doesn't pay exactly dv.Value to dv.Address.
+	// Returns ErrDepositUnconfirmed if the block doesn't have the confirmations the scanner requires for the deposit
+	VerifyDeposit(dv Deposit) error
+}
+
+// DepositMismatchError is returned by DepositVerifier.VerifyDeposit if a deposit is not on the blockchain as described
+type DepositMismatchError struct {
+	Reason string
+}
+
+func (e DepositMismatchError) Error() string {
+	return "The deposit does not match the blockchain: " + e.Reason
+}
+
+// PendingDeposit is a scanned deposit that is waiting for more confirmations before it is sent to the exchange
+type PendingDeposit struct {
+	Deposit
+	Confirmations         int64 // confirmations of the deposit's block at the best block height last seen
+	RequiredConfirmations int64 // confirmations the deposit needs, see Config.LargeDepositConfirmations
+}
+
 // DepositNote wraps a Deposit with an ack channel
 type DepositNote struct {
 	Deposit
@@ -74,6 +133,7 @@ type Deposit struct {
 	Tx        string // the transaction id
 	N         uint32 // the index of vout in the tx [BTC]
 	Processed bool   // whether this was received by the exchange and saved
+	FirstSeen int64  // unix time the scanner first saw the deposit, 0 if it was saved before this was recorded
 }
 
 // ID returns $tx:$n formatted ID string
@@ -85,3 +145,57 @@ func (d Deposit) ID() string {
 func GetCoinTypes() []string {
 	return []string{CoinTypeBTC, CoinTypeETH, CoinTypeSKY, CoinTypeWAVES, CoinTypeWAVESMDL}
 }
+
+// PaymentURIScheme returns the URI scheme that wallets deep-link payments of coinType with, e.g. "bitcoin" for BTC.
+// Returns an empty string if the coin type has no payment URI scheme
+func PaymentURIScheme(coinType string) string {
+	switch coinType {
+	case CoinTypeBTC:
+		return "bitcoin"
+	case CoinTypeETH:
+		return "ethereum"
+	case CoinTypeSKY:
+		return "skycoin"
+	default:
+		return ""
+	}
+}
+
+// NormalizeCoinType resolves a client supplied coin type to one of the supported coin types.
+// Coin types are matched case-insensitively, e.g. "btc" resolves to CoinTypeBTC.
+// aliases maps alternative names to coin types, e.g. "bitcoin" to "BTC", and is also matched case-insensitively.
+// Returns ErrUnsupportedCoinType if the coin type is not recognized.
+func NormalizeCoinType(coinType string, aliases map[string]string) (string, error) {
+	coinType = strings.TrimSpace(coinType)
+
+	for _, ct := range GetCoinTypes() {
+		if strings.EqualFold(coinType, ct) {
+			return ct, nil
+		}
+	}
+
+	for alias, target := range aliases {
+		if !strings.EqualFold(coinType, alias) {
+			continue
+		}
+
+		for _, ct := range GetCoinTypes() {
+			if strings.EqualFold(target, ct) {
+				return ct, nil
+			}
+		}
+	}
+
+	return "", ErrUnsupportedCoinType
+}
+
+// ValidateCoinTypeAliases returns an error if an alias maps to an unsupported coin type
+func ValidateCoinTypeAliases(aliases map[string]string) error {
+	for alias, target := range aliases {
+		if _, err := NormalizeCoinType(target, nil); err != nil {
+			return fmt.Errorf("coin type alias %q maps to unsupported coin type %q", alias, target)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCoinType(t *testing.T) {
+	aliases := map[string]string{
+		"bitcoin":  "BTC",
+		"Ethereum": "eth",
+		"broken":   "DOGE",
+	}
+
+	tt := []struct {
+		coinType string
+		expected string
+		err      error
+	}{
+		{"BTC", CoinTypeBTC, nil},
+		{"btc", CoinTypeBTC, nil},
+		{"Btc", CoinTypeBTC, nil},
+		{" sky ", CoinTypeSKY, nil},
+		{"waves", CoinTypeWAVES, nil},
+		{"mdl.LIFE", CoinTypeWAVESMDL, nil},
+		{"bitcoin", CoinTypeBTC, nil},
+		{"BITCOIN", CoinTypeBTC, nil},
+		{"ethereum", CoinTypeETH, nil},
+		{"broken", "", ErrUnsupportedCoinType},
+		{"DOGE", "", ErrUnsupportedCoinType},
+		{"", "", ErrUnsupportedCoinType},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.coinType, func(t *testing.T) {
+			ct, err := NormalizeCoinType(tc.coinType, aliases)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.expected, ct)
+		})
+	}
+}
+
+func TestValidateCoinTypeAliases(t *testing.T) {
+	require.NoError(t, ValidateCoinTypeAliases(nil))
+	require.NoError(t, ValidateCoinTypeAliases(map[string]string{
+		"bitcoin": "btc",
+	}))
+	require.Error(t, ValidateCoinTypeAliases(map[string]string{
+		"dogecoin": "DOGE",
+	}))
+}
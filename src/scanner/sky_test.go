@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/MDLlife/MDL/src/readable"
 	"github.com/boltdb/bolt"
 	"github.com/stretchr/testify/require"
 
@@ -769,3 +770,114 @@ var blockString = `{
         }
     ]
 }`
+
+func TestSkyBlock2CommonBlockZeroValueOutputs(t *testing.T) {
+	block := &readable.Block{}
+	block.Head.BkSeq = 20
+	block.Head.Hash = "block-20"
+	block.Body.Transactions = []readable.Transaction{
+		{
+			Hash: "mixed",
+			Out: []readable.TransactionOutput{
+				{Address: "zero", Coins: "0.000000"},
+				{Address: "positive", Coins: "2.5"},
+				{Address: "invalid", Coins: "foo"},
+				{Address: "positive-2", Coins: "1"},
+			},
+		},
+		{
+			Hash: "only-zero",
+			Out: []readable.TransactionOutput{
+				{Address: "zero", Coins: "0"},
+			},
+		},
+	}
+
+	cb, err := skyBlock2CommonBlock(block)
+	require.NoError(t, err)
+	require.Equal(t, int64(20), cb.Height)
+	require.Equal(t, "block-20", cb.Hash)
+
+	// Zero-value outputs are skipped, positive outputs are kept with their index
+	require.Equal(t, []CommonTx{
+		{
+			Txid: "mixed",
+			Vout: []CommonVout{
+				{Value: 2500000, N: 1, Addresses: []string{"positive"}},
+				{Value: 1000000, N: 3, Addresses: []string{"positive-2"}},
+			},
+		},
+	}, cb.RawTx)
+}
+
+func TestSKYScannerConfirmByTxStatus(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	confirmed := &readable.TransactionWithStatus{}
+	confirmed.Status.Confirmed = true
+	unconfirmed := &readable.TransactionWithStatus{}
+
+	client := &fakeSkyRPCClient{
+		txs: map[string]*readable.TransactionWithStatus{
+			"confirmed-tx":   confirmed,
+			"unconfirmed-tx": unconfirmed,
+		},
+	}
+
+	scr, err := NewSkycoinScanner(log, store, client, Config{
+		ConfirmationsRequired: 3,
+		ConfirmByTxStatus:     true,
+	})
+	require.NoError(t, err)
+	base := scr.Base.(*BaseScanner)
+
+	// Blocks are scanned without waiting for confirmations
+	require.Equal(t, int64(0), base.scanDepth())
+
+	dv := Deposit{
+		CoinType: CoinTypeSKY,
+		Address:  "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT",
+		Value:    1e6,
+		Height:   20,
+		Tx:       "confirmed-tx",
+	}
+
+	// The block of the deposit has no confirmation, the transaction status decides
+	require.True(t, base.depositConfirmed(dv))
+
+	dv.Tx = "unconfirmed-tx"
+	require.False(t, base.depositConfirmed(dv))
+
+	// The deposit is held back until the node can tell its status
+	dv.Tx = "unknown-tx"
+	require.False(t, base.depositConfirmed(dv))
+
+	// Once confirmed, the deposit is sent
+	unconfirmed.Status.Confirmed = true
+	dv.Tx = "unconfirmed-tx"
+	require.True(t, base.depositConfirmed(dv))
+
+	// Large deposits still wait for their extra confirmations
+	base.Cfg.LargeDepositValue = 1e6
+	base.Cfg.LargeDepositConfirmations = 6
+	require.False(t, base.depositConfirmed(dv))
+	base.observeHeight(log, 26)
+	require.True(t, base.depositConfirmed(dv))
+
+	// Disabled, the depth of the block decides
+	scr, err = NewSkycoinScanner(log, store, client, Config{
+		ConfirmationsRequired: 3,
+	})
+	require.NoError(t, err)
+	base = scr.Base.(*BaseScanner)
+	require.Nil(t, base.txConfirmed)
+	require.Equal(t, int64(3), base.scanDepth())
+
+	dv.Tx = "unknown-tx"
+	require.True(t, base.depositConfirmed(dv))
+}
@@ -7,6 +7,8 @@
 package scanner
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"strconv"
@@ -27,11 +29,33 @@ type SKYScanner struct {
 func NewSkycoinScanner(log logrus.FieldLogger, store Storer, client SkyRPCClient, cfg Config) (*SKYScanner, error) {
 	bs := NewBaseScanner(store, log.WithField("prefix", "scanner.sky"), CoinTypeSKY, cfg)
 
-	return &SKYScanner{
+	s := &SKYScanner{
 		skyRPCClient: client,
 		log:          log.WithField("prefix", "scanner.sky"),
 		Base:         bs,
-	}, nil
+	}
+
+	if cfg.ConfirmByTxStatus {
+		bs.txConfirmed = s.txConfirmed
+	}
+
+	return s, nil
+}
+
+// txConfirmed returns true if the node reports the deposit's transaction as confirmed, see Config.ConfirmByTxStatus.
+// The skycoin node reports a transaction as confirmed once it is in a block, so a deposit of a scanned block
+// is confirmed unless the node no longer has its transaction
+func (s *SKYScanner) txConfirmed(dv Deposit) (bool, error) {
+	tx, err := s.skyRPCClient.GetTransaction(dv.Tx)
+	if err != nil {
+		return false, err
+	}
+
+	if tx == nil {
+		return false, fmt.Errorf("Transaction %s not found", dv.Tx)
+	}
+
+	return tx.Status.Confirmed, nil
 }
 
 // Run starts the scanner
@@ -57,9 +81,9 @@ func (s *SKYScanner) scanBlock(block *CommonBlock) (int, error) {
 
 	log.Debug("Scanning block")
 
-	dvs, err := s.Base.GetStorer().ScanBlock(block, CoinTypeSKY)
+	dvs, err := s.Base.ScanBlock(block)
 	if err != nil {
-		log.WithError(err).Error("store.ScanBlock failed")
+		log.WithError(err).Error("Base.ScanBlock failed")
 		return 0, err
 	}
 
@@ -79,7 +103,8 @@ func (s *SKYScanner) scanBlock(block *CommonBlock) (int, error) {
 	return n, nil
 }
 
-// skyBlock2CommonBlock convert skycoin block to common block
+// skyBlock2CommonBlock convert skycoin block to common block.
+// Outputs whose coins can't be parsed or are zero are skipped, the other outputs keep their index as N
 func skyBlock2CommonBlock(block *readable.Block) (*CommonBlock, error) {
 	if block == nil {
 		return nil, ErrEmptyBlock
@@ -100,9 +125,17 @@ func skyBlock2CommonBlock(block *readable.Block) (*CommonBlock, error) {
 			cv := CommonVout{}
 			cv.N = uint32(i)
 			cv.Value = int64(amt * 1e6)
+			// Zero-value outputs can't be deposits
+			if cv.Value <= 0 {
+				continue
+			}
 			cv.Addresses = []string{v.Address}
 			cbTx.Vout = append(cbTx.Vout, cv)
 		}
+		// The scanner reads the first output, a transaction without outputs left is skipped
+		if len(cbTx.Vout) == 0 {
+			continue
+		}
 		cb.RawTx = append(cb.RawTx, cbTx)
 	}
 
@@ -119,6 +152,49 @@ func (s *SKYScanner) GetBlockCount() (int64, error) {
 	return int64(rb.Head.BkSeq), nil
 }
 
+// Heights returns the height of the last block scanned and the best block height of the node
+func (s *SKYScanner) Heights() (Heights, error) {
+	tip, err := s.GetBlockCount()
+	if err != nil {
+		return Heights{
+			ScannedHeight: s.Base.ScannedHeight(),
+			Healthy:       s.Base.Healthy(),
+		}, err
+	}
+
+	return Heights{
+		ScannedHeight:  s.Base.ScannedHeight(),
+		ChainTipHeight: tip,
+		Healthy:        s.Base.Healthy(),
+	}, nil
+}
+
+// skyBalancer is implemented by the skycoin clients that can read an address's balance
+type skyBalancer interface {
+	ConfirmedBalance(addr string) (uint64, error)
+}
+
+// AddressBalance returns the confirmed balance of addr in droplets. Deposits in blocks not scanned yet are counted.
+// Returns ErrAddressBalanceUnavailable if the client can't read balances.
+// The skycoin client doesn't take a context, so ctx is only checked before the request
+func (s *SKYScanner) AddressBalance(ctx context.Context, addr string) (int64, error) {
+	sb, ok := s.skyRPCClient.(skyBalancer)
+	if !ok {
+		return 0, ErrAddressBalanceUnavailable
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	balance, err := sb.ConfirmedBalance(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(balance), nil
+}
+
 // getBlock returns block of given hash
 func (s *SKYScanner) getBlock(seq int64) (*CommonBlock, error) {
 	rb, err := s.skyRPCClient.GetBlocksBySeq(uint64(seq))
@@ -129,6 +205,37 @@ func (s *SKYScanner) getBlock(seq int64) (*CommonBlock, error) {
 	return skyBlock2CommonBlock(rb)
 }
 
+// ScanSingleBlock fetches the block at height and replays it through the deposit matching, for debugging missed deposits.
+// Nothing is recorded, see BaseScanner.ReplayBlock
+func (s *SKYScanner) ScanSingleBlock(height int64) (*BlockReplay, error) {
+	block, err := s.getBlockAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Base.ReplayBlock(block)
+}
+
+// VerifyDeposit fetches the block at dv.Height and checks that it includes the deposit
+// and has the confirmations required for it, see DepositVerifier
+func (s *SKYScanner) VerifyDeposit(dv Deposit) error {
+	block, err := s.getBlockAtHeight(dv.Height)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyBlockDeposit(block, dv); err != nil {
+		return err
+	}
+
+	bestHeight, err := s.GetBlockCount()
+	if err != nil {
+		return err
+	}
+
+	return s.Base.CheckDepositDepth(dv, bestHeight)
+}
+
 // getBlockAtHeight returns that block at a specific height
 func (s *SKYScanner) getBlockAtHeight(seq int64) (*CommonBlock, error) {
 	b, err := s.getBlock(seq)
@@ -202,9 +309,12 @@ type SkyClient struct {
 	skyRPCClient *api.Client
 }
 
-// NewSkyClient creates RPC instance
-func NewSkyClient(server, port string) *SkyClient {
+// NewSkyClient creates RPC instance. The connections to the node are tuned with tc, if set
+func NewSkyClient(server, port string, tc TransportConfig) *SkyClient {
 	rpcClient := api.NewClient("http://" + server + ":" + port)
+	if !tc.IsZero() {
+		rpcClient.HTTPClient.Transport = NewHTTPTransport(tc)
+	}
 
 	return &SkyClient{
 		skyRPCClient: rpcClient,
@@ -240,6 +350,16 @@ func (c *SkyClient) GetLastBlocks() (*readable.Block, error) {
 	return &blocks.Blocks[0], nil
 }
 
+// ConfirmedBalance returns the confirmed balance of addr, in droplets
+func (c *SkyClient) ConfirmedBalance(addr string) (uint64, error) {
+	b, err := c.skyRPCClient.Balance([]string{addr})
+	if err != nil {
+		return 0, err
+	}
+
+	return b.Confirmed.Coins, nil
+}
+
 // Shutdown the node
 func (c *SkyClient) Shutdown() {
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/sirupsen/logrus"
@@ -31,8 +32,24 @@ var (
 	// deposit address bucket
 	depositAddressesKey = "deposit_addresses"
 
+	// scan height key in the scan meta bucket
+	scanHeightKey = "scan_height"
+
 	// ErrUnsupportedCoinType unsupported coin type
 	ErrUnsupportedCoinType = errors.New("unsupported coin type")
+
+	// ErrFeeEstimateUnavailable is returned by FeeEstimator.EstimateFee if the node can't estimate fees
+	ErrFeeEstimateUnavailable = errors.New("network fee estimate is unavailable")
+
+	// ErrAddressBalanceUnavailable is returned by AddressBalancer.AddressBalance if the node can't report address balances
+	ErrAddressBalanceUnavailable = errors.New("address balance is unavailable")
+
+	// ErrDepositUnverifiable is returned by Multiplexer.VerifyDeposit if the scanner can't check deposits against its node
+	ErrDepositUnverifiable = errors.New("deposits of this coin type can't be verified against the blockchain")
+
+	// ErrDepositUnconfirmed is returned by DepositVerifier.VerifyDeposit if the deposit's block doesn't have
+	// the confirmations the scanner requires for the deposit yet
+	ErrDepositUnconfirmed = errors.New("the deposit does not have the required confirmations yet")
 )
 
 const scanMetaBktPrefix = "scan_meta"
@@ -117,7 +134,11 @@ type Storer interface {
 	AddScanAddress(string, string) error
 	SetDepositProcessed(string) error
 	GetUnprocessedDeposits(string) ([]Deposit, error)
-	ScanBlock(*CommonBlock, string) ([]Deposit, error)
+	GetDepositTotals(string) (map[string]int64, error)
+	ScanBlock(*CommonBlock, string, int64) ([]Deposit, error)
+	ReplayBlock(*CommonBlock, string, int64) (*BlockReplay, error)
+	GetScanHeight(string) (int64, bool, error)
+	SetScanHeight(string, int64) error
 }
 
 // Store records scanner meta info for BTC deposits
@@ -221,6 +242,51 @@ func (s *Store) AddScanAddress(addr, coinType string) error {
 	})
 }
 
+// GetScanHeight returns the stored scan height of a coin type, the height scanning resumes from.
+// Returns false if no scan height is stored, i.e. no block of the coin has been scanned yet
+func (s *Store) GetScanHeight(coinType string) (int64, bool, error) {
+	scanBktFullName, err := GetScanMetaBkt(coinType)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var height int64
+	var ok bool
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		if err := dbutil.GetBucketObject(tx, scanBktFullName, scanHeightKey, &height); err != nil {
+			switch err.(type) {
+			case dbutil.ObjectNotExistErr, dbutil.BucketNotExistErr:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		ok = true
+		return nil
+	}); err != nil {
+		return 0, false, err
+	}
+
+	return height, ok, nil
+}
+
+// SetScanHeight stores the scan height of a coin type
+func (s *Store) SetScanHeight(coinType string, height int64) error {
+	scanBktFullName, err := GetScanMetaBkt(coinType)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(scanBktFullName); err != nil {
+			return dbutil.NewCreateBucketFailedErr(scanBktFullName, err)
+		}
+
+		return dbutil.PutBucketValue(tx, scanBktFullName, scanHeightKey, height)
+	})
+}
+
 // SetDepositProcessed marks a Deposit as processed
 func (s *Store) SetDepositProcessed(dvKey string) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
@@ -263,6 +329,30 @@ func (s *Store) GetUnprocessedDeposits(coinType string) ([]Deposit, error) {
 	return dvs, nil
 }
 
+// GetDepositTotals returns the sum of the values of the recorded Deposits of a coin type, keyed by deposit address
+func (s *Store) GetDepositTotals(coinType string) (map[string]int64, error) {
+	totals := make(map[string]int64)
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dbutil.ForEach(tx, DepositBkt, func(k, v []byte) error {
+			var dv Deposit
+			if err := json.Unmarshal(v, &dv); err != nil {
+				return err
+			}
+
+			if dv.CoinType == coinType {
+				totals[dv.Address] += dv.Value
+			}
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return totals, nil
+}
+
 // pushDepositTx adds an Deposit in a bolt.Tx
 // Returns DepositExistsErr if the deposit already exists
 func (s *Store) pushDepositTx(tx *bolt.Tx, dv Deposit) error {
@@ -280,16 +370,17 @@ func (s *Store) pushDepositTx(tx *bolt.Tx, dv Deposit) error {
 }
 
 // ScanBlock scans a coin block for deposits and adds them
-// If the deposit already exists, the result is omitted from the returned list
-func (s *Store) ScanBlock(block *CommonBlock, coinType string) ([]Deposit, error) {
-	return s.scanBlock(block, coinType)
+// If the deposit already exists, the result is omitted from the returned list.
+// Deposits with a value below dustValue are ignored, they are not added
+func (s *Store) ScanBlock(block *CommonBlock, coinType string, dustValue int64) ([]Deposit, error) {
+	return s.scanBlock(block, coinType, dustValue)
 }
 
 // scanBlock scans a coin block for deposits and adds them
 // 1. get deposit address by coinType
 // 2. call callback function to get deposit
 // 3. push deposit into db, finished at one transaction
-func (s *Store) scanBlock(block *CommonBlock, coinType string) ([]Deposit, error) {
+func (s *Store) scanBlock(block *CommonBlock, coinType string, dustValue int64) ([]Deposit, error) {
 	var dvs []Deposit
 
 	if err := s.db.Update(func(tx *bolt.Tx) error {
@@ -305,7 +396,19 @@ func (s *Store) scanBlock(block *CommonBlock, coinType string) ([]Deposit, error
 			return err
 		}
 
+		firstSeen := time.Now().UTC().Unix()
+
 		for _, dv := range deposits {
+			if dv.Value < dustValue {
+				s.log.WithFields(logrus.Fields{
+					"deposit":   dv,
+					"dustValue": dustValue,
+				}).Debug("Ignoring dust deposit")
+				continue
+			}
+
+			dv.FirstSeen = firstSeen
+
 			if err := s.pushDepositTx(tx, dv); err != nil {
 				log := s.log.WithField("deposit", dv)
 				switch err.(type) {
@@ -44,6 +44,48 @@ func TestNewStore(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestScanHeight(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	s, err := NewStore(log, db)
+	require.NoError(t, err)
+
+	// Not stored, and the scan meta bucket does not exist yet
+	_, ok, err := s.GetScanHeight(CoinTypeBTC)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	err = s.SetScanHeight(CoinTypeBTC, 514300)
+	require.NoError(t, err)
+
+	height, ok, err := s.GetScanHeight(CoinTypeBTC)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(514300), height)
+
+	// Scan heights are stored per coin type
+	_, ok, err = s.GetScanHeight(CoinTypeETH)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Rewind
+	err = s.SetScanHeight(CoinTypeBTC, 514000)
+	require.NoError(t, err)
+
+	height, ok, err = s.GetScanHeight(CoinTypeBTC)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(514000), height)
+
+	_, _, err = s.GetScanHeight("foo")
+	require.Equal(t, ErrUnsupportedCoinType, err)
+	err = s.SetScanHeight("foo", 1)
+	require.Equal(t, ErrUnsupportedCoinType, err)
+}
+
 func TestGetDepositAddresses(t *testing.T) {
 	db, shutdown := testutil.PrepareDB(t)
 	defer shutdown()
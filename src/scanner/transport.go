@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// dialTimeout is the connect timeout of the transports returned by NewHTTPTransport, the same as Go's default
+const dialTimeout = time.Second * 30
+
+// TransportConfig tunes the HTTP connections of an RPC client to its node. Zero values keep Go's defaults
+type TransportConfig struct {
+	MaxIdleConns        int           // maximum number of idle connections kept open
+	MaxIdleConnsPerHost int           // maximum number of idle connections kept open to each host
+	IdleConnTimeout     time.Duration // how long an idle connection is kept open
+	KeepAlive           time.Duration // period of the TCP keep-alive probes, negative disables them
+}
+
+// IsZero returns true if no option is set
+func (tc TransportConfig) IsZero() bool {
+	return tc == TransportConfig{}
+}
+
+// NewHTTPTransport returns a copy of http.DefaultTransport with the options of tc applied
+func NewHTTPTransport(tc TransportConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if tc.MaxIdleConns != 0 {
+		t.MaxIdleConns = tc.MaxIdleConns
+	}
+
+	if tc.MaxIdleConnsPerHost != 0 {
+		t.MaxIdleConnsPerHost = tc.MaxIdleConnsPerHost
+	}
+
+	if tc.IdleConnTimeout != 0 {
+		t.IdleConnTimeout = tc.IdleConnTimeout
+	}
+
+	if tc.KeepAlive != 0 {
+		t.DialContext = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: tc.KeepAlive,
+		}).DialContext
+	}
+
+	return t
+}
@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPTransport(t *testing.T) {
+	defaults := http.DefaultTransport.(*http.Transport)
+
+	// Zero options keep Go's defaults
+	tr := NewHTTPTransport(TransportConfig{})
+	require.Equal(t, defaults.MaxIdleConns, tr.MaxIdleConns)
+	require.Equal(t, defaults.MaxIdleConnsPerHost, tr.MaxIdleConnsPerHost)
+	require.Equal(t, defaults.IdleConnTimeout, tr.IdleConnTimeout)
+	require.NotNil(t, tr.DialContext)
+
+	tr = NewHTTPTransport(TransportConfig{
+		MaxIdleConns:        20,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     time.Second * 15,
+		KeepAlive:           time.Second * 5,
+	})
+	require.Equal(t, 20, tr.MaxIdleConns)
+	require.Equal(t, 10, tr.MaxIdleConnsPerHost)
+	require.Equal(t, time.Second*15, tr.IdleConnTimeout)
+	require.NotNil(t, tr.DialContext)
+
+	// The default transport is copied, not changed
+	require.NotEqual(t, defaults, tr)
+	require.NotEqual(t, 20, defaults.MaxIdleConns)
+}
+
+func TestRPCClientTransport(t *testing.T) {
+	tc := TransportConfig{
+		MaxIdleConns:        8,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     time.Second * 30,
+	}
+
+	ec := NewEthExplorerClient("https://api.etherscan.io/api", "", tc)
+	tr, ok := ec.client.Transport.(*http.Transport)
+	require.True(t, ok)
+	require.Equal(t, 8, tr.MaxIdleConns)
+	require.Equal(t, 4, tr.MaxIdleConnsPerHost)
+	require.Equal(t, time.Second*30, tr.IdleConnTimeout)
+
+	sc := NewSkyClient("127.0.0.1", "6420", tc)
+	tr, ok = sc.skyRPCClient.HTTPClient.Transport.(*http.Transport)
+	require.True(t, ok)
+	require.Equal(t, 8, tr.MaxIdleConns)
+	require.Equal(t, 4, tr.MaxIdleConnsPerHost)
+	require.Equal(t, time.Second*30, tr.IdleConnTimeout)
+
+	wc := NewWavesClient("http://127.0.0.1:6869", tc)
+	tr, ok = wc.httpClient.Transport.(*http.Transport)
+	require.True(t, ok)
+	require.Equal(t, 8, tr.MaxIdleConns)
+	require.Equal(t, 4, tr.MaxIdleConnsPerHost)
+	require.Equal(t, time.Second*30, tr.IdleConnTimeout)
+
+	// Zero options keep the default transport, which is not modified
+	wc = NewWavesClient("http://127.0.0.1:6869", TransportConfig{})
+	require.Nil(t, wc.httpClient.Transport)
+}
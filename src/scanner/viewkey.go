@@ -0,0 +1,266 @@
+package scanner
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrViewKeyMissing is returned if a ViewKeyScanner is created without a view key
+var ErrViewKeyMissing = errors.New("view key missing")
+
+// ViewKeyOutput is a transaction output of a privacy coin such as Monero.
+// The receiving address and amount cannot be read from the output directly,
+// they are recovered with the recipient's private view key
+type ViewKeyOutput struct {
+	N         uint32 // the index of the output in the transaction
+	TxPubKey  string // the transaction public key
+	OutputKey string // the one-time output public key
+	Amount    string // the encrypted amount
+}
+
+// ViewKeyTx is a privacy coin transaction
+type ViewKeyTx struct {
+	Txid    string
+	Outputs []ViewKeyOutput
+}
+
+// ViewKeyBlock is a privacy coin block
+type ViewKeyBlock struct {
+	Hash   string
+	Height int64
+	Txs    []ViewKeyTx
+}
+
+// ViewKeyRPCClient rpcclient interface for privacy coins that match deposits with a view key
+type ViewKeyRPCClient interface {
+	GetBlockCount() (int64, error)
+	GetBlockAtHeight(height int64) (*ViewKeyBlock, error)
+	// DecodeOutput uses the private view key to check if out was received by one of subaddresses.
+	// If it was, it returns the receiving subaddress and the decrypted amount, otherwise ok is false
+	DecodeOutput(viewKey string, subaddresses []string, out ViewKeyOutput) (subaddress string, amount int64, ok bool, err error)
+	Shutdown()
+}
+
+// ViewKeyScanner blockchain scanner for privacy coins, where deposits to subaddresses
+// can only be identified with a private view key. Matching outputs are emitted as
+// DepositNotes, the same as the other scanners
+type ViewKeyScanner struct {
+	log       logrus.FieldLogger
+	Base      CommonScanner
+	coinType  string
+	viewKey   string
+	rpcClient ViewKeyRPCClient
+}
+
+// NewViewKeyScanner creates scanner instance
+func NewViewKeyScanner(log logrus.FieldLogger, store Storer, client ViewKeyRPCClient, coinType, viewKey string, cfg Config) (*ViewKeyScanner, error) {
+	if viewKey == "" {
+		return nil, ErrViewKeyMissing
+	}
+
+	bs := NewBaseScanner(store, log.WithField("prefix", "scanner.viewkey"), coinType, cfg)
+
+	return &ViewKeyScanner{
+		log:       log.WithField("prefix", "scanner.viewkey"),
+		Base:      bs,
+		coinType:  coinType,
+		viewKey:   viewKey,
+		rpcClient: client,
+	}, nil
+}
+
+// Run starts the scanner
+func (s *ViewKeyScanner) Run() error {
+	return s.Base.Run(s.rpcClient.GetBlockCount, s.getBlockAtHeight, s.waitForNextBlock, s.scanBlock)
+}
+
+// Heights returns the height of the last block scanned and the best block height of the node
+func (s *ViewKeyScanner) Heights() (Heights, error) {
+	tip, err := s.rpcClient.GetBlockCount()
+	if err != nil {
+		return Heights{
+			ScannedHeight: s.Base.ScannedHeight(),
+			Healthy:       s.Base.Healthy(),
+		}, err
+	}
+
+	return Heights{
+		ScannedHeight:  s.Base.ScannedHeight(),
+		ChainTipHeight: tip,
+		Healthy:        s.Base.Healthy(),
+	}, nil
+}
+
+// Shutdown shutdown the scanner
+func (s *ViewKeyScanner) Shutdown() {
+	s.log.Info("Closing view key scanner")
+	s.rpcClient.Shutdown()
+	s.Base.Shutdown()
+	s.log.Info("View key scanner stopped")
+}
+
+// scanBlock scans a block, already decoded with the view key, for deposits to our scanning subaddresses.
+// Matching deposits are saved to the DB and sent to the scanned deposits channel.
+func (s *ViewKeyScanner) scanBlock(block *CommonBlock) (int, error) {
+	log := s.log.WithField("hash", block.Hash)
+	log = log.WithField("height", block.Height)
+
+	log.Debug("Scanning block")
+
+	dvs, err := s.Base.ScanBlock(block)
+	if err != nil {
+		log.WithError(err).Error("Base.ScanBlock failed")
+		return 0, err
+	}
+
+	log = log.WithField("scannedDeposits", len(dvs))
+	log.Infof("Counted %d deposits from block", len(dvs))
+
+	n := 0
+	for _, dv := range dvs {
+		select {
+		case s.Base.GetScannedDepositChan() <- dv:
+			n++
+		case <-s.Base.GetQuitChan():
+			return n, errQuit
+		}
+	}
+
+	return n, nil
+}
+
+// viewKeyBlock2CommonBlock converts a privacy coin block to a common block.
+// Only outputs received by one of subaddresses are kept. Each matching output is
+// placed in its own CommonTx, so that multiple deposits in one transaction are all scanned
+func (s *ViewKeyScanner) viewKeyBlock2CommonBlock(block *ViewKeyBlock, subaddresses []string) (*CommonBlock, error) {
+	if block == nil {
+		return nil, ErrEmptyBlock
+	}
+
+	cb := CommonBlock{
+		Hash:   block.Hash,
+		Height: block.Height,
+	}
+
+	if len(subaddresses) == 0 {
+		return &cb, nil
+	}
+
+	for _, tx := range block.Txs {
+		for _, out := range tx.Outputs {
+			subaddr, amount, ok, err := s.rpcClient.DecodeOutput(s.viewKey, subaddresses, out)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			cb.RawTx = append(cb.RawTx, CommonTx{
+				Txid: tx.Txid,
+				Vout: []CommonVout{
+					{
+						N:         out.N,
+						Value:     amount,
+						Addresses: []string{subaddr},
+					},
+				},
+			})
+		}
+	}
+
+	return &cb, nil
+}
+
+// ScanSingleBlock fetches the block at height and replays it through the deposit matching, for debugging missed deposits.
+// Nothing is recorded, see BaseScanner.ReplayBlock
+func (s *ViewKeyScanner) ScanSingleBlock(height int64) (*BlockReplay, error) {
+	block, err := s.getBlockAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Base.ReplayBlock(block)
+}
+
+// VerifyDeposit fetches the block at dv.Height and checks that it includes the deposit
+// and has the confirmations required for it, see DepositVerifier
+func (s *ViewKeyScanner) VerifyDeposit(dv Deposit) error {
+	block, err := s.getBlockAtHeight(dv.Height)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyBlockDeposit(block, dv); err != nil {
+		return err
+	}
+
+	bestHeight, err := s.rpcClient.GetBlockCount()
+	if err != nil {
+		return err
+	}
+
+	return s.Base.CheckDepositDepth(dv, bestHeight)
+}
+
+// getBlockAtHeight returns the block at a specific height, decoded with the view key
+func (s *ViewKeyScanner) getBlockAtHeight(height int64) (*CommonBlock, error) {
+	vb, err := s.rpcClient.GetBlockAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	subaddresses, err := s.GetScanAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.viewKeyBlock2CommonBlock(vb, subaddresses)
+}
+
+// waitForNextBlock scans for the next block until it is available
+func (s *ViewKeyScanner) waitForNextBlock(block *CommonBlock) (*CommonBlock, error) {
+	log := s.log.WithField("blockHash", block.Hash)
+	log = log.WithField("blockHeight", block.Height)
+	log.Debug("Waiting for the next block")
+
+	for {
+		nextBlock, err := s.getBlockAtHeight(block.Height + 1)
+		if err != nil {
+			log.WithError(err).Debug("getBlockAtHeight failed")
+		}
+		if err != nil || nextBlock == nil {
+			select {
+			case <-s.Base.GetQuitChan():
+				return nil, errQuit
+			case <-time.After(s.Base.GetScanPeriod()):
+				continue
+			}
+		}
+
+		log.WithFields(logrus.Fields{
+			"hash":   nextBlock.Hash,
+			"height": nextBlock.Height,
+		}).Debug("Found nextBlock")
+
+		return nextBlock, nil
+	}
+}
+
+// AddScanAddress adds new scan subaddress
+func (s *ViewKeyScanner) AddScanAddress(addr, coinType string) error {
+	return s.Base.GetStorer().AddScanAddress(addr, coinType)
+}
+
+// GetScanAddresses returns the deposit subaddresses that need to scan
+func (s *ViewKeyScanner) GetScanAddresses() ([]string, error) {
+	return s.Base.GetStorer().GetScanAddresses(s.coinType)
+}
+
+// GetDeposit returns deposit value channel.
+func (s *ViewKeyScanner) GetDeposit() <-chan DepositNote {
+	return s.Base.GetDeposit()
+}
@@ -0,0 +1,317 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+const testViewKey = "view-key"
+
+// No privacy coin type is supported by the store yet, so the view key scanner
+// is tested under an existing coin type
+const testViewKeyCoinType = CoinTypeSKY
+
+// viewKeyRecipient is the hidden recipient of a ViewKeyOutput
+type viewKeyRecipient struct {
+	subaddress string
+	amount     int64
+}
+
+// dummyViewKeyRPCClient serves fixed blocks. Output keys are "decrypted" with
+// the recipients map, which can only be read with testViewKey
+type dummyViewKeyRPCClient struct {
+	sync.RWMutex
+	blocks     map[int64]*ViewKeyBlock
+	blockCount int64
+	recipients map[string]viewKeyRecipient
+}
+
+func newDummyViewKeyRPCClient() *dummyViewKeyRPCClient {
+	return &dummyViewKeyRPCClient{
+		blocks:     make(map[int64]*ViewKeyBlock),
+		recipients: make(map[string]viewKeyRecipient),
+	}
+}
+
+func (c *dummyViewKeyRPCClient) addBlock(b *ViewKeyBlock) {
+	c.Lock()
+	defer c.Unlock()
+	c.blocks[b.Height] = b
+	if b.Height > c.blockCount {
+		c.blockCount = b.Height
+	}
+}
+
+// addOutput creates an output received by subaddress
+func (c *dummyViewKeyRPCClient) addOutput(n uint32, subaddress string, amount int64) ViewKeyOutput {
+	c.Lock()
+	defer c.Unlock()
+	key := fmt.Sprintf("output-key-%d", len(c.recipients))
+	c.recipients[key] = viewKeyRecipient{
+		subaddress: subaddress,
+		amount:     amount,
+	}
+	return ViewKeyOutput{
+		N:         n,
+		TxPubKey:  "tx-pub-key",
+		OutputKey: key,
+		Amount:    "encrypted",
+	}
+}
+
+func (c *dummyViewKeyRPCClient) GetBlockCount() (int64, error) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.blockCount, nil
+}
+
+func (c *dummyViewKeyRPCClient) GetBlockAtHeight(height int64) (*ViewKeyBlock, error) {
+	c.RLock()
+	defer c.RUnlock()
+	b, ok := c.blocks[height]
+	if !ok {
+		return nil, fmt.Errorf("Block %d not found", height)
+	}
+	return b, nil
+}
+
+func (c *dummyViewKeyRPCClient) DecodeOutput(viewKey string, subaddresses []string, out ViewKeyOutput) (string, int64, bool, error) {
+	if viewKey != testViewKey {
+		return "", 0, false, nil
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	r, ok := c.recipients[out.OutputKey]
+	if !ok {
+		return "", 0, false, nil
+	}
+
+	for _, a := range subaddresses {
+		if a == r.subaddress {
+			return r.subaddress, r.amount, true, nil
+		}
+	}
+
+	return "", 0, false, nil
+}
+
+func (c *dummyViewKeyRPCClient) Shutdown() {}
+
+func TestNewViewKeyScannerMissingViewKey(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+	_, err := NewViewKeyScanner(log, nil, newDummyViewKeyRPCClient(), testViewKeyCoinType, "", Config{})
+	require.Equal(t, ErrViewKeyMissing, err)
+}
+
+func TestViewKeyScannerRun(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	err = store.AddSupportedCoin(testViewKeyCoinType)
+	require.NoError(t, err)
+
+	rpc := newDummyViewKeyRPCClient()
+
+	scr, err := NewViewKeyScanner(log, store, rpc, testViewKeyCoinType, testViewKey, Config{
+		ScanPeriod:        time.Millisecond * 10,
+		DepositBufferSize: 5,
+		InitialScanHeight: 1,
+	})
+	require.NoError(t, err)
+
+	err = scr.AddScanAddress("subaddr-1", testViewKeyCoinType)
+	require.NoError(t, err)
+	err = scr.AddScanAddress("subaddr-2", testViewKeyCoinType)
+	require.NoError(t, err)
+
+	rpc.addBlock(&ViewKeyBlock{
+		Hash:   "block-1",
+		Height: 1,
+		Txs: []ViewKeyTx{
+			{
+				Txid: "tx-1",
+				Outputs: []ViewKeyOutput{
+					// Change output to an unknown recipient
+					{N: 0, TxPubKey: "tx-pub-key", OutputKey: "unknown", Amount: "encrypted"},
+					rpc.addOutput(1, "subaddr-1", 1e12),
+				},
+			},
+		},
+	})
+	rpc.addBlock(&ViewKeyBlock{
+		Hash:   "block-2",
+		Height: 2,
+		Txs: []ViewKeyTx{
+			{
+				// Two deposits in the same transaction
+				Txid: "tx-2",
+				Outputs: []ViewKeyOutput{
+					rpc.addOutput(0, "subaddr-2", 2e12),
+					rpc.addOutput(1, "subaddr-1", 3e12),
+				},
+			},
+			{
+				// A subaddress of the wallet that is not being scanned
+				Txid: "tx-3",
+				Outputs: []ViewKeyOutput{
+					rpc.addOutput(0, "subaddr-3", 4e12),
+				},
+			},
+		},
+	})
+	rpc.addBlock(&ViewKeyBlock{
+		Hash:   "block-3",
+		Height: 3,
+	})
+
+	expected := []Deposit{
+		{
+			CoinType: testViewKeyCoinType,
+			Address:  "subaddr-1",
+			Value:    1e12,
+			Height:   1,
+			Tx:       "tx-1",
+			N:        1,
+		},
+		{
+			CoinType: testViewKeyCoinType,
+			Address:  "subaddr-2",
+			Value:    2e12,
+			Height:   2,
+			Tx:       "tx-2",
+			N:        0,
+		},
+		{
+			CoinType: testViewKeyCoinType,
+			Address:  "subaddr-1",
+			Value:    3e12,
+			Height:   2,
+			Tx:       "tx-2",
+			N:        1,
+		},
+	}
+
+	var dvs []Deposit
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for dn := range scr.GetDeposit() {
+			dvs = append(dvs, dn.Deposit)
+			dn.ErrC <- nil
+
+			if len(dvs) == len(expected) {
+				return
+			}
+		}
+	}()
+
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		err := scr.Run()
+		require.NoError(t, err)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Waiting for view key deposits timed out")
+	}
+
+	scr.Shutdown()
+	<-runDone
+
+	// FirstSeen is the time of the scan
+	for i := range dvs {
+		require.NotZero(t, dvs[i].FirstSeen)
+		dvs[i].FirstSeen = 0
+	}
+	require.Equal(t, expected, dvs)
+}
+
+func TestViewKeyScannerWrongViewKey(t *testing.T) {
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	store, err := NewStore(log, db)
+	require.NoError(t, err)
+	err = store.AddSupportedCoin(testViewKeyCoinType)
+	require.NoError(t, err)
+
+	rpc := newDummyViewKeyRPCClient()
+
+	scr, err := NewViewKeyScanner(log, store, rpc, testViewKeyCoinType, "other-view-key", Config{})
+	require.NoError(t, err)
+
+	err = scr.AddScanAddress("subaddr-1", testViewKeyCoinType)
+	require.NoError(t, err)
+
+	rpc.addBlock(&ViewKeyBlock{
+		Hash:   "block-1",
+		Height: 1,
+		Txs: []ViewKeyTx{
+			{
+				Txid: "tx-1",
+				Outputs: []ViewKeyOutput{
+					rpc.addOutput(0, "subaddr-1", 1e12),
+				},
+			},
+		},
+	})
+
+	// Outputs cannot be matched without the right view key
+	block, err := scr.getBlockAtHeight(1)
+	require.NoError(t, err)
+	require.Empty(t, block.RawTx)
+
+	dvs, err := store.ScanBlock(block, testViewKeyCoinType, 0)
+	require.NoError(t, err)
+	require.Empty(t, dvs)
+}
+
+func TestViewKeyScannerDecodeError(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	scr, err := NewViewKeyScanner(log, nil, failingViewKeyRPCClient{newDummyViewKeyRPCClient()}, testViewKeyCoinType, testViewKey, Config{})
+	require.NoError(t, err)
+
+	_, err = scr.viewKeyBlock2CommonBlock(&ViewKeyBlock{
+		Hash:   "block-1",
+		Height: 1,
+		Txs: []ViewKeyTx{
+			{
+				Txid:    "tx-1",
+				Outputs: []ViewKeyOutput{{N: 0}},
+			},
+		},
+	}, []string{"subaddr-1"})
+	require.Equal(t, errDecodeOutput, err)
+
+	_, err = scr.viewKeyBlock2CommonBlock(nil, []string{"subaddr-1"})
+	require.Equal(t, ErrEmptyBlock, err)
+}
+
+var errDecodeOutput = errors.New("decode output failed")
+
+type failingViewKeyRPCClient struct {
+	*dummyViewKeyRPCClient
+}
+
+func (c failingViewKeyRPCClient) DecodeOutput(viewKey string, subaddresses []string, out ViewKeyOutput) (string, int64, bool, error) {
+	return "", 0, false, errDecodeOutput
+}
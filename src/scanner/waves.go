@@ -5,11 +5,16 @@
 package scanner
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
-	"github.com/modeneis/waves-go-client/client"
 	"github.com/modeneis/waves-go-client/model"
 )
 
@@ -54,9 +59,9 @@ func (s *WAVESScanner) scanBlock(block *CommonBlock) (int, error) {
 
 	log.Debug("Scanning block")
 
-	dvs, err := s.Base.GetStorer().ScanBlock(block, CoinTypeWAVES)
+	dvs, err := s.Base.ScanBlock(block)
 	if err != nil {
-		log.WithError(err).Error("store.ScanBlock failed")
+		log.WithError(err).Error("Base.ScanBlock failed")
 		return 0, err
 	}
 
@@ -116,6 +121,23 @@ func (s *WAVESScanner) GetBlockCount() (int64, error) {
 	return rb.Height, nil
 }
 
+// Heights returns the height of the last block scanned and the best block height of the node
+func (s *WAVESScanner) Heights() (Heights, error) {
+	tip, err := s.GetBlockCount()
+	if err != nil {
+		return Heights{
+			ScannedHeight: s.Base.ScannedHeight(),
+			Healthy:       s.Base.Healthy(),
+		}, err
+	}
+
+	return Heights{
+		ScannedHeight:  s.Base.ScannedHeight(),
+		ChainTipHeight: tip,
+		Healthy:        s.Base.Healthy(),
+	}, nil
+}
+
 // getBlock returns block of given hash
 func (s *WAVESScanner) getBlock(seq int64) (*CommonBlock, error) {
 	rb, err := s.wavesRPCClient.GetBlocksBySeq(seq)
@@ -126,6 +148,37 @@ func (s *WAVESScanner) getBlock(seq int64) (*CommonBlock, error) {
 	return wavesBlock2CommonBlock(rb)
 }
 
+// ScanSingleBlock fetches the block at height and replays it through the deposit matching, for debugging missed deposits.
+// Nothing is recorded, see BaseScanner.ReplayBlock
+func (s *WAVESScanner) ScanSingleBlock(height int64) (*BlockReplay, error) {
+	block, err := s.getBlockAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Base.ReplayBlock(block)
+}
+
+// VerifyDeposit fetches the block at dv.Height and checks that it includes the deposit
+// and has the confirmations required for it, see DepositVerifier
+func (s *WAVESScanner) VerifyDeposit(dv Deposit) error {
+	block, err := s.getBlockAtHeight(dv.Height)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyBlockDeposit(block, dv); err != nil {
+		return err
+	}
+
+	bestHeight, err := s.GetBlockCount()
+	if err != nil {
+		return err
+	}
+
+	return s.Base.CheckDepositDepth(dv, bestHeight)
+}
+
 // getBlockAtHeight returns that block at a specific height
 func (s *WAVESScanner) getBlockAtHeight(seq int64) (*CommonBlock, error) {
 	b, err := s.getBlock(seq)
@@ -192,43 +245,131 @@ func (s *WAVESScanner) GetDeposit() <-chan DepositNote {
 	return s.Base.GetDeposit()
 }
 
+// wavesMainNetURL is the node of a WavesClient created without a url
+const wavesMainNetURL = "https://nodes.wavesnodes.com"
+
 // WavesClient provides methods for sending coins
 type WavesClient struct {
-	MainNET string // defaults to "https://nodes.wavesnodes.com"
+	MainNET    string // defaults to "https://nodes.wavesnodes.com"
+	httpClient *http.Client
+}
+
+// NewWavesClient create waves rpc client. The connections to the node are tuned with tc, if set
+func NewWavesClient(url string, tc TransportConfig) *WavesClient {
+	if url == "" {
+		url = wavesMainNetURL
+	}
+
+	httpClient := &http.Client{}
+	if !tc.IsZero() {
+		httpClient.Transport = NewHTTPTransport(tc)
+	}
+
+	return &WavesClient{
+		MainNET:    url,
+		httpClient: httpClient,
+	}
 }
 
-// NewWavesClient create waves rpc client
-func NewWavesClient(url string) (wc *WavesClient) {
-	if url != "" {
-		wc = &WavesClient{MainNET: url}
-	} else {
-		wc = &WavesClient{}
+// NewWavesClientWithFallback creates a waves rpc client for the node at server:port, whose connections are tuned with tc.
+// The node is tried with protocol first, and with the other of "http" and "https" if it can't be reached.
+// If protocol is empty, "https" is tried first. If the node can't be reached with either protocol,
+// the client uses the protocol that was tried first.
+// Returns the client and the protocol it uses.
+func NewWavesClientWithFallback(log logrus.FieldLogger, server, port, protocol string, tc TransportConfig) (*WavesClient, string) {
+	return newWavesClientWithFallback(log, server, port, protocol, tc, probeWavesNode)
+}
+
+func newWavesClientWithFallback(log logrus.FieldLogger, server, port, protocol string, tc TransportConfig, probe func(c *WavesClient) error) (*WavesClient, string) {
+	protocols := []string{"https", "http"}
+	if protocol == "http" {
+		protocols = []string{"http", "https"}
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"server": server,
+		"port":   port,
+	})
+
+	for _, p := range protocols {
+		c := NewWavesClient(wavesNodeURL(p, server, port), tc)
+		if err := probe(c); err != nil {
+			log.WithError(err).WithField("protocol", p).Warning("Waves node can't be reached")
+			continue
+		}
+
+		if protocol != "" && p != protocol {
+			log.Warningf("Waves node can't be reached with the configured protocol %s, using %s", protocol, p)
+		} else {
+			log.Infof("Waves node reached with protocol %s", p)
+		}
+
+		return c, p
+	}
+
+	log.Errorf("Waves node can't be reached with either protocol, using %s", protocols[0])
+	return NewWavesClient(wavesNodeURL(protocols[0], server, port), tc), protocols[0]
+}
+
+func wavesNodeURL(protocol, server, port string) string {
+	return fmt.Sprintf("%s://%s:%s", protocol, server, port)
+}
+
+func probeWavesNode(c *WavesClient) error {
+	_, err := c.GetLastBlocks()
+	return err
+}
+
+// get decodes the JSON response of the node to a GET request of path into v
+func (c *WavesClient) get(path string, v interface{}) error {
+	rsp, err := c.httpClient.Get(strings.TrimSuffix(c.MainNET, "/") + path)
+	if err != nil {
+		return err
 	}
-	return wc
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("waves node returned %s: %s", rsp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(rsp.Body).Decode(v)
 }
 
 // GetTransaction returns transaction by txid
 func (c *WavesClient) GetTransaction(txid string) (*model.Transactions, error) {
-	transaction, _, err := client.NewTransactionsService(c.MainNET).GetTransactionsInfoID(txid)
-	return transaction, err
+	var transaction model.Transactions
+	if err := c.get("/transactions/info/"+txid, &transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
 }
 
 // GetBlocks get blocks from RPC
-func (c *WavesClient) GetBlocks(start, end int64) (blocks *[]model.Blocks, err error) {
-	blocks, _, err = client.NewBlocksService(c.MainNET).GetBlocksSeqFromTo(start, end)
-	return blocks, err
+func (c *WavesClient) GetBlocks(start, end int64) (*[]model.Blocks, error) {
+	var blocks []model.Blocks
+	if err := c.get(fmt.Sprintf("/blocks/seq/%d/%d", start, end), &blocks); err != nil {
+		return nil, err
+	}
+	return &blocks, nil
 }
 
 // GetBlocksBySeq get blocks by seq
-func (c *WavesClient) GetBlocksBySeq(seq int64) (block *model.Blocks, err error) {
-	block, _, err = client.NewBlocksService(c.MainNET).GetBlocksAtHeight(seq)
-	return block, err
+func (c *WavesClient) GetBlocksBySeq(seq int64) (*model.Blocks, error) {
+	var block model.Blocks
+	if err := c.get(fmt.Sprintf("/blocks/at/%d", seq), &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
 }
 
 // GetLastBlocks get last blocks
-func (c *WavesClient) GetLastBlocks() (blocks *model.Blocks, err error) {
-	blocks, _, err = client.NewBlocksService(c.MainNET).GetBlocksLast()
-	return blocks, err
+func (c *WavesClient) GetLastBlocks() (*model.Blocks, error) {
+	var block model.Blocks
+	if err := c.get("/blocks/last", &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
 }
 
 // Shutdown the node
@@ -53,7 +53,7 @@ func (s *WAVESMDLScanner) scanBlock(block *CommonBlock) (int, error) {
 
 	log.Debug("WAVESMDLScanner, Scanning block")
 
-	dvs, err := s.Base.GetStorer().ScanBlock(block, CoinTypeWAVESMDL)
+	dvs, err := s.Base.ScanBlock(block)
 	if err != nil {
 		log.WithError(err).Error("WAVESMDLScanner.ScanBlock failed")
 		return 0, err
@@ -115,6 +115,23 @@ func (s *WAVESMDLScanner) GetBlockCount() (int64, error) {
 	return rb.Height, nil
 }
 
+// Heights returns the height of the last block scanned and the best block height of the node
+func (s *WAVESMDLScanner) Heights() (Heights, error) {
+	tip, err := s.GetBlockCount()
+	if err != nil {
+		return Heights{
+			ScannedHeight: s.Base.ScannedHeight(),
+			Healthy:       s.Base.Healthy(),
+		}, err
+	}
+
+	return Heights{
+		ScannedHeight:  s.Base.ScannedHeight(),
+		ChainTipHeight: tip,
+		Healthy:        s.Base.Healthy(),
+	}, nil
+}
+
 // getBlock returns block of given hash
 func (s *WAVESMDLScanner) getBlock(seq int64) (*CommonBlock, error) {
 	rb, err := s.wavesRPCClient.GetBlocksBySeq(seq)
@@ -125,6 +142,37 @@ func (s *WAVESMDLScanner) getBlock(seq int64) (*CommonBlock, error) {
 	return wavesMDLBlock2CommonBlock(rb)
 }
 
+// ScanSingleBlock fetches the block at height and replays it through the deposit matching, for debugging missed deposits.
+// Nothing is recorded, see BaseScanner.ReplayBlock
+func (s *WAVESMDLScanner) ScanSingleBlock(height int64) (*BlockReplay, error) {
+	block, err := s.getBlockAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Base.ReplayBlock(block)
+}
+
+// VerifyDeposit fetches the block at dv.Height and checks that it includes the deposit
+// and has the confirmations required for it, see DepositVerifier
+func (s *WAVESMDLScanner) VerifyDeposit(dv Deposit) error {
+	block, err := s.getBlockAtHeight(dv.Height)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyBlockDeposit(block, dv); err != nil {
+		return err
+	}
+
+	bestHeight, err := s.GetBlockCount()
+	if err != nil {
+		return err
+	}
+
+	return s.Base.CheckDepositDepth(dv, bestHeight)
+}
+
 // getBlockAtHeight returns that block at a specific height
 func (s *WAVESMDLScanner) getBlockAtHeight(seq int64) (*CommonBlock, error) {
 	b, err := s.getBlock(seq)
@@ -2,6 +2,8 @@ package scanner
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -948,3 +950,115 @@ var blockStringWaves = `{
   ],
   "height": 924610
 }`
+
+func TestNewWavesClientWithFallback(t *testing.T) {
+	tt := []struct {
+		name      string
+		protocol  string
+		up        map[string]bool
+		effective string
+		probes    []string
+	}{
+		{
+			name:      "configured https succeeds",
+			protocol:  "https",
+			up:        map[string]bool{"https": true, "http": true},
+			effective: "https",
+			probes:    []string{"https://node:443"},
+		},
+		{
+			name:      "configured http fails, https succeeds",
+			protocol:  "http",
+			up:        map[string]bool{"https": true},
+			effective: "https",
+			probes:    []string{"http://node:443", "https://node:443"},
+		},
+		{
+			name:      "configured https fails, http succeeds",
+			protocol:  "https",
+			up:        map[string]bool{"http": true},
+			effective: "http",
+			probes:    []string{"https://node:443", "http://node:443"},
+		},
+		{
+			name:      "unset tries https first",
+			up:        map[string]bool{"https": true, "http": true},
+			effective: "https",
+			probes:    []string{"https://node:443"},
+		},
+		{
+			name:      "unset falls back to http",
+			up:        map[string]bool{"http": true},
+			effective: "http",
+			probes:    []string{"https://node:443", "http://node:443"},
+		},
+		{
+			name:      "both fail uses the configured protocol",
+			protocol:  "http",
+			effective: "http",
+			probes:    []string{"http://node:443", "https://node:443"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+
+			var probes []string
+			probe := func(c *WavesClient) error {
+				probes = append(probes, c.MainNET)
+				for protocol, up := range tc.up {
+					if up && c.MainNET == protocol+"://node:443" {
+						return nil
+					}
+				}
+				return errors.New("connection refused")
+			}
+
+			c, protocol := newWavesClientWithFallback(log, "node", "443", tc.protocol, TransportConfig{}, probe)
+			require.Equal(t, tc.effective, protocol)
+			require.Equal(t, tc.effective+"://node:443", c.MainNET)
+			require.Equal(t, tc.probes, probes)
+		})
+	}
+}
+
+func TestWavesClient(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/blocks/last", "/blocks/at/924610":
+			fmt.Fprint(w, blockStringWaves)
+		case "/blocks/seq/924610/924611":
+			fmt.Fprintf(w, "[%s,%s]", blockStringWaves, blockStringWaves)
+		default:
+			http.Error(w, "block does not exist", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewWavesClient(srv.URL, TransportConfig{
+		MaxIdleConnsPerHost: 4,
+	})
+
+	expected := decodeBlockWaves(blockStringWaves)
+
+	block, err := c.GetLastBlocks()
+	require.NoError(t, err)
+	require.Equal(t, expected, block)
+
+	block, err = c.GetBlocksBySeq(924610)
+	require.NoError(t, err)
+	require.Equal(t, expected, block)
+
+	blocks, err := c.GetBlocks(924610, 924611)
+	require.NoError(t, err)
+	require.Equal(t, []model.Blocks{*expected, *expected}, *blocks)
+
+	_, err = c.GetBlocksBySeq(924612)
+	require.Error(t, err)
+	require.Equal(t, "waves node returned 404 Not Found: block does not exist", err.Error())
+
+	require.Equal(t, []string{"/blocks/last", "/blocks/at/924610", "/blocks/seq/924610/924611", "/blocks/at/924612"}, paths)
+}
@@ -23,12 +23,14 @@ func NewAPIError(err error) APIError {
 // RPC provides methods for sending coins
 type API struct {
 	walletFile string
+	password   string
 	changeAddr string
 	apiClient  *api.Client
 }
 
 // NewRPC creates RPC instance
-func NewAPI(wltFile, apiAddr string) (*API, error) {
+// password is sent with each transaction request if the wallet is encrypted, otherwise it is empty
+func NewAPI(wltFile, apiAddr, password string) (*API, error) {
 	wlt, err := wallet.Load(wltFile)
 	if err != nil {
 		return nil, err
@@ -45,6 +47,7 @@ func NewAPI(wltFile, apiAddr string) (*API, error) {
 
 	return &API{
 		walletFile: wltFileName,
+		password:   password,
 		changeAddr: wlt.GetAddresses()[0].String(),
 		apiClient:  apiClient,
 	}, nil
@@ -64,6 +67,7 @@ func (c *API) CreateTransaction(recvAddr string, amount uint64) (*api.CreateTran
 
 	to := api.Receiver{Address: recvAddr, Coins: strCoins}
 	req := api.WalletCreateTransactionRequest{ WalletID: c.walletFile }
+	req.Password = c.password
 	req.To = []api.Receiver{to}
 	req.HoursSelection = api.HoursSelection{Type: "auto", Mode: "share", ShareFactor: "0.1"}
 
@@ -0,0 +1,154 @@
+package sender
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/MDLlife/MDL/src/api"
+)
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState string
+
+const (
+	// BreakerClosed payouts are attempted
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen payouts are not attempted until the cooldown has passed
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen the cooldown has passed, the next payout tests whether the mdl node has recovered
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+var (
+	// ErrBreakerOpen is returned instead of creating a transaction while the circuit breaker is open.
+	// It is an APIError, so the payout is retried later like any other temporary mdl node error
+	ErrBreakerOpen = NewAPIError(errors.New("MDL node is unavailable, payouts are paused"))
+
+	breakerMetrics     = expvar.NewMap("sender_circuit_breaker")
+	breakerStateMetric = new(expvar.String)
+)
+
+func init() {
+	breakerMetrics.Set("state", breakerStateMetric)
+}
+
+// CircuitBreaker stops payouts from being attempted while the mdl node is failing.
+// After threshold consecutive failed payouts it opens for cooldown. Once the cooldown has passed it half-opens,
+// letting the next payout through. If that payout succeeds it closes, otherwise it opens again.
+// Only CreateTransaction is guarded, since it is the first call to the mdl node made for a payout
+type CircuitBreaker struct {
+	Sender
+	log       logrus.FieldLogger
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	lock     sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// NewCircuitBreaker creates a CircuitBreaker in front of s
+func NewCircuitBreaker(log logrus.FieldLogger, s Sender, threshold int, cooldown time.Duration) *CircuitBreaker {
+	breakerStateMetric.Set(string(BreakerClosed))
+
+	return &CircuitBreaker{
+		Sender:    s,
+		log:       log.WithField("prefix", "sender.breaker"),
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     BreakerClosed,
+	}
+}
+
+// CreateTransaction creates a transaction, unless the circuit breaker is open
+func (b *CircuitBreaker) CreateTransaction(recvAddr string, coins uint64) (*api.CreateTransactionResponse, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	tx, err := b.Sender.CreateTransaction(recvAddr, coins)
+	b.record(err)
+	return tx, err
+}
+
+// State returns the state of the circuit breaker
+func (b *CircuitBreaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == BreakerOpen && !b.now().Before(b.openedAt.Add(b.cooldown)) {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
+
+func (b *CircuitBreaker) allow() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Before(b.openedAt.Add(b.cooldown)) {
+			return ErrBreakerOpen
+		}
+
+		b.log.Info("Circuit breaker cooldown passed, testing the mdl node")
+		b.setState(BreakerHalfOpen)
+		b.trial = true
+		return nil
+
+	case BreakerHalfOpen:
+		// Only one payout tests the mdl node at a time
+		if b.trial {
+			return ErrBreakerOpen
+		}
+		b.trial = true
+		return nil
+
+	default:
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.trial = false
+
+	// Only errors from the mdl node count as failures
+	if _, ok := err.(APIError); !ok {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.log.Info("Circuit breaker closed, the mdl node has recovered")
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.log.WithError(err).WithFields(logrus.Fields{
+			"failures": b.failures,
+			"cooldown": b.cooldown,
+		}).Error("Circuit breaker opened, payouts are paused")
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+		breakerMetrics.Add("opened", 1)
+	}
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	b.state = state
+	breakerStateMetric.Set(string(state))
+}
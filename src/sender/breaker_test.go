@@ -0,0 +1,150 @@
+package sender
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/MDL/src/api"
+	"github.com/MDLlife/MDL/src/readable"
+
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+type fakeBreakerSender struct {
+	err   error
+	calls int
+}
+
+func (s *fakeBreakerSender) CreateTransaction(recvAddr string, coins uint64) (*api.CreateTransactionResponse, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &api.CreateTransactionResponse{}, nil
+}
+
+func (s *fakeBreakerSender) BroadcastTransaction(tx string) *BroadcastTxResponse {
+	return &BroadcastTxResponse{}
+}
+
+func (s *fakeBreakerSender) IsTxConfirmed(txid string) *ConfirmResponse {
+	return &ConfirmResponse{Confirmed: true}
+}
+
+func (s *fakeBreakerSender) Balance() (*readable.BalancePair, error) {
+	return &readable.BalancePair{}, nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	s := &fakeBreakerSender{}
+	b := NewCircuitBreaker(log, s, 3, time.Minute)
+
+	now := time.Now()
+	b.now = func() time.Time {
+		return now
+	}
+
+	addr := "2VZu3rZozQ6nN37YSdj3EZJV7wSFVuLSm2X"
+	nodeErr := NewAPIError(errors.New("mdl node unavailable"))
+
+	// Closed, successful payouts are sent
+	_, err := b.CreateTransaction(addr, 100)
+	require.NoError(t, err)
+	require.Equal(t, BreakerClosed, b.State())
+
+	// Failures below the threshold keep the breaker closed
+	s.err = nodeErr
+	for i := 0; i < 2; i++ {
+		_, err = b.CreateTransaction(addr, 100)
+		require.Equal(t, nodeErr, err)
+		require.Equal(t, BreakerClosed, b.State())
+	}
+
+	// A success resets the consecutive failures
+	s.err = nil
+	_, err = b.CreateTransaction(addr, 100)
+	require.NoError(t, err)
+
+	// Errors that are not from the mdl node are not failures
+	s.err = errors.New("invalid amount")
+	for i := 0; i < 3; i++ {
+		_, err = b.CreateTransaction(addr, 100)
+		require.Equal(t, s.err, err)
+		require.Equal(t, BreakerClosed, b.State())
+	}
+
+	// The threshold opens the breaker
+	s.err = nodeErr
+	for i := 0; i < 3; i++ {
+		_, err = b.CreateTransaction(addr, 100)
+		require.Equal(t, nodeErr, err)
+	}
+	require.Equal(t, BreakerOpen, b.State())
+	require.Equal(t, 10, s.calls)
+
+	// While open, payouts are not attempted
+	now = now.Add(time.Minute - time.Second)
+	_, err = b.CreateTransaction(addr, 100)
+	require.Equal(t, ErrBreakerOpen, err)
+	require.IsType(t, APIError{}, err)
+	require.Equal(t, 10, s.calls)
+	require.Equal(t, BreakerOpen, b.State())
+
+	// After the cooldown it half-opens, a failed test payout opens it again
+	now = now.Add(time.Second)
+	require.Equal(t, BreakerHalfOpen, b.State())
+	_, err = b.CreateTransaction(addr, 100)
+	require.Equal(t, nodeErr, err)
+	require.Equal(t, 11, s.calls)
+	require.Equal(t, BreakerOpen, b.State())
+
+	_, err = b.CreateTransaction(addr, 100)
+	require.Equal(t, ErrBreakerOpen, err)
+	require.Equal(t, 11, s.calls)
+
+	// A successful test payout closes it
+	now = now.Add(time.Minute)
+	require.Equal(t, BreakerHalfOpen, b.State())
+	s.err = nil
+	_, err = b.CreateTransaction(addr, 100)
+	require.NoError(t, err)
+	require.Equal(t, 12, s.calls)
+	require.Equal(t, BreakerClosed, b.State())
+
+	// Closed again, a single failure does not open it
+	s.err = nodeErr
+	_, err = b.CreateTransaction(addr, 100)
+	require.Equal(t, nodeErr, err)
+	require.Equal(t, BreakerClosed, b.State())
+}
+
+func TestCircuitBreakerHalfOpenSingleTrial(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	s := &fakeBreakerSender{}
+	b := NewCircuitBreaker(log, s, 1, time.Minute)
+
+	now := time.Now()
+	b.now = func() time.Time {
+		return now
+	}
+
+	require.NoError(t, b.allow())
+	b.record(NewAPIError(errors.New("mdl node unavailable")))
+	require.Equal(t, BreakerOpen, b.State())
+
+	// Only one payout at a time may test the mdl node
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow())
+	require.Equal(t, BreakerHalfOpen, b.State())
+	require.Equal(t, ErrBreakerOpen, b.allow())
+
+	b.record(nil)
+	require.Equal(t, BreakerClosed, b.State())
+	require.NoError(t, b.allow())
+}
@@ -0,0 +1,92 @@
+package sender
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MDLlife/MDL/src/readable"
+)
+
+// NodeVersioner returns the build info of the mdl node
+type NodeVersioner interface {
+	Version() (*readable.BuildInfo, error)
+}
+
+// ErrNodeVersionTooOld is returned by CheckNodeVersion if the mdl node is older than the minimum version
+type ErrNodeVersionTooOld struct {
+	Version    string
+	MinVersion string
+}
+
+func (e ErrNodeVersionTooOld) Error() string {
+	return fmt.Sprintf("mdl node version %s is older than the minimum required version %s", e.Version, e.MinVersion)
+}
+
+// Version returns the build info of the mdl node
+func (c *API) Version() (*readable.BuildInfo, error) {
+	info, err := c.apiClient.Version()
+	if err != nil {
+		return nil, APIError{err}
+	}
+
+	return info, nil
+}
+
+// CheckNodeVersion returns ErrNodeVersionTooOld if the mdl node's version is older than minVersion.
+// Versions are compared as major.minor.patch, a "v" prefix and a pre-release suffix such as "-rc1" are ignored
+func CheckNodeVersion(node NodeVersioner, minVersion string) error {
+	min, err := parseVersion(minVersion)
+	if err != nil {
+		return fmt.Errorf("Invalid minimum mdl node version: %v", err)
+	}
+
+	info, err := node.Version()
+	if err != nil {
+		return err
+	}
+
+	v, err := parseVersion(info.Version)
+	if err != nil {
+		return fmt.Errorf("Invalid mdl node version: %v", err)
+	}
+
+	for i := range v {
+		if v[i] > min[i] {
+			return nil
+		}
+		if v[i] < min[i] {
+			return ErrNodeVersionTooOld{
+				Version:    info.Version,
+				MinVersion: minVersion,
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseVersion parses a major.minor.patch version string. The minor and patch numbers may be omitted
+func parseVersion(s string) ([3]int, error) {
+	var v [3]int
+
+	version := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(version, "-+"); i != -1 {
+		version = version[:i]
+	}
+
+	pts := strings.Split(version, ".")
+	if len(pts) > len(v) {
+		return v, fmt.Errorf("%q is not a major.minor.patch version", s)
+	}
+
+	for i, p := range pts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("%q is not a major.minor.patch version", s)
+		}
+		v[i] = n
+	}
+
+	return v, nil
+}
@@ -0,0 +1,116 @@
+package sender
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/MDL/src/readable"
+)
+
+type fakeNodeVersioner struct {
+	version string
+	err     error
+}
+
+func (n fakeNodeVersioner) Version() (*readable.BuildInfo, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	return &readable.BuildInfo{
+		Version: n.version,
+	}, nil
+}
+
+func TestCheckNodeVersion(t *testing.T) {
+	tt := []struct {
+		name       string
+		version    string
+		minVersion string
+		nodeErr    error
+		err        error
+		errStr     string
+	}{
+		{
+			name:       "same version",
+			version:    "0.25.0",
+			minVersion: "0.25.0",
+		},
+		{
+			name:       "newer patch",
+			version:    "0.25.1",
+			minVersion: "0.25.0",
+		},
+		{
+			name:       "newer minor, older patch",
+			version:    "0.26.0",
+			minVersion: "0.25.3",
+		},
+		{
+			name:       "newer major",
+			version:    "1.0.0",
+			minVersion: "0.25.0",
+		},
+		{
+			name:       "prefix and pre-release suffix",
+			version:    "v0.25.0-rc1",
+			minVersion: "0.25",
+		},
+		{
+			name:       "older minor",
+			version:    "0.24.1",
+			minVersion: "0.25.0",
+			err: ErrNodeVersionTooOld{
+				Version:    "0.24.1",
+				MinVersion: "0.25.0",
+			},
+		},
+		{
+			name:       "older patch, compared numerically",
+			version:    "0.25.9",
+			minVersion: "0.25.10",
+			err: ErrNodeVersionTooOld{
+				Version:    "0.25.9",
+				MinVersion: "0.25.10",
+			},
+		},
+		{
+			name:       "invalid node version",
+			version:    "dev",
+			minVersion: "0.25.0",
+			errStr:     "Invalid mdl node version",
+		},
+		{
+			name:       "invalid minimum version",
+			version:    "0.25.0",
+			minVersion: "0.25.0.1",
+			errStr:     "Invalid minimum mdl node version",
+		},
+		{
+			name:       "node unavailable",
+			minVersion: "0.25.0",
+			nodeErr:    errors.New("connection refused"),
+			err:        errors.New("connection refused"),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckNodeVersion(fakeNodeVersioner{
+				version: tc.version,
+				err:     tc.nodeErr,
+			}, tc.minVersion)
+
+			switch {
+			case tc.err != nil:
+				require.Equal(t, tc.err, err)
+			case tc.errStr != "":
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errStr)
+			default:
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package sweep
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/MDLlife/teller/src/scanner"
+)
+
+const (
+	// maxBtcSweepInputs limits the size of a sweep transaction, it must stay below the 100kB standard transaction size.
+	// Deposits left over are swept by the next sweep
+	maxBtcSweepInputs = 500
+
+	// Size estimate of a transaction spending P2PKH inputs to P2PKH outputs
+	btcTxOverheadSize = 10
+	btcTxInputSize    = 148
+	btcTxOutputSize   = 34
+
+	// Outputs smaller than this are rejected as dust by the btc network
+	btcDustLimit = 546
+)
+
+// BtcRPCClient is the part of the btcwallet RPC API used to sweep BTC deposits.
+// The wallet must hold the keys of the deposit addresses
+type BtcRPCClient interface {
+	ListUnspentMinMaxAddresses(minConf, maxConf int, addrs []btcutil.Address) ([]btcjson.ListUnspentResult, error)
+	CreateRawTransaction(inputs []btcjson.TransactionInput, amounts map[btcutil.Address]btcutil.Amount, lockTime *int64) (*wire.MsgTx, error)
+	SignRawTransaction(tx *wire.MsgTx) (*wire.MsgTx, bool, error)
+	SendRawTransaction(tx *wire.MsgTx, allowHighFees bool) (*chainhash.Hash, error)
+}
+
+// BtcConfig configures a BtcSweeper
+type BtcConfig struct {
+	ColdAddress      string
+	MinConfirmations int
+	FeePerByte       int64 // satoshis
+}
+
+// BtcSweeper sweeps confirmed BTC deposits to a cold wallet address in a single transaction,
+// built and signed by the btcwallet that holds the keys of the deposit addresses
+type BtcSweeper struct {
+	log      logrus.FieldLogger
+	client   BtcRPCClient
+	addrs    AddressGetter
+	cfg      BtcConfig
+	coldAddr btcutil.Address
+
+	// Only one sweep at a time, so that a deposit is not spent twice
+	lock sync.Mutex
+}
+
+// NewBtcSweeper creates a BtcSweeper of the deposit addresses returned by addrs
+func NewBtcSweeper(log logrus.FieldLogger, client BtcRPCClient, addrs AddressGetter, cfg BtcConfig) (*BtcSweeper, error) {
+	coldAddr, err := btcutil.DecodeAddress(cfg.ColdAddress, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cold address %q: %v", cfg.ColdAddress, err)
+	}
+
+	if cfg.MinConfirmations < 1 {
+		return nil, errors.New("MinConfirmations must be at least 1")
+	}
+
+	if cfg.FeePerByte <= 0 {
+		return nil, errors.New("FeePerByte must be positive")
+	}
+
+	return &BtcSweeper{
+		log:      log.WithField("prefix", "sweep.btc"),
+		client:   client,
+		addrs:    addrs,
+		cfg:      cfg,
+		coldAddr: coldAddr,
+	}, nil
+}
+
+// Sweep sends the confirmed deposits of the deposit addresses to the cold address, less the fee.
+// Returns ErrNothingToSweep if there is nothing to send
+func (s *BtcSweeper) Sweep() (*Result, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	depositAddrs, err := s.addrs.GetScanAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(depositAddrs) == 0 {
+		return nil, ErrNothingToSweep
+	}
+
+	addrs := make([]btcutil.Address, 0, len(depositAddrs))
+	for _, a := range depositAddrs {
+		addr, err := btcutil.DecodeAddress(a, &chaincfg.MainNetParams)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid deposit address %q: %v", a, err)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	unspents, err := s.client.ListUnspentMinMaxAddresses(s.cfg.MinConfirmations, 9999999, addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []btcjson.TransactionInput
+	var total btcutil.Amount
+	for _, u := range unspents {
+		// Outputs the wallet can't sign for are left alone
+		if !u.Spendable {
+			continue
+		}
+
+		amt, err := btcutil.NewAmount(u.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid amount of unspent output %s:%d: %v", u.TxID, u.Vout, err)
+		}
+
+		inputs = append(inputs, btcjson.TransactionInput{
+			Txid: u.TxID,
+			Vout: u.Vout,
+		})
+		total += amt
+
+		if len(inputs) == maxBtcSweepInputs {
+			break
+		}
+	}
+
+	if len(inputs) == 0 {
+		return nil, ErrNothingToSweep
+	}
+
+	size := btcTxOverheadSize + btcTxInputSize*len(inputs) + btcTxOutputSize
+	fee := btcutil.Amount(int64(size) * s.cfg.FeePerByte)
+	amount := total - fee
+	if amount < btcDustLimit {
+		return nil, ErrNothingToSweep
+	}
+
+	log := s.log.WithFields(logrus.Fields{
+		"inputs":      len(inputs),
+		"amount":      int64(amount),
+		"fee":         int64(fee),
+		"coldAddress": s.cfg.ColdAddress,
+	})
+
+	tx, err := s.client.CreateRawTransaction(inputs, map[btcutil.Address]btcutil.Amount{
+		s.coldAddr: amount,
+	}, nil)
+	if err != nil {
+		log.WithError(err).Error("CreateRawTransaction failed")
+		return nil, err
+	}
+
+	signedTx, complete, err := s.client.SignRawTransaction(tx)
+	if err != nil {
+		log.WithError(err).Error("SignRawTransaction failed")
+		return nil, err
+	}
+
+	if !complete {
+		err := errors.New("The wallet could not sign every input of the sweep transaction")
+		log.WithError(err).Error()
+		return nil, err
+	}
+
+	txid, err := s.client.SendRawTransaction(signedTx, false)
+	if err != nil {
+		log.WithError(err).Error("SendRawTransaction failed")
+		return nil, err
+	}
+
+	log.WithField("txid", txid.String()).Info("Swept deposits to the cold address")
+
+	return &Result{
+		CoinType:    scanner.CoinTypeBTC,
+		Txid:        txid.String(),
+		ColdAddress: s.cfg.ColdAddress,
+		Inputs:      len(inputs),
+		Amount:      int64(amount),
+		Fee:         int64(fee),
+	}, nil
+}
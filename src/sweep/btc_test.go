@@ -0,0 +1,271 @@
+package sweep
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MDLlife/teller/src/scanner"
+	"github.com/MDLlife/teller/src/util/testutil"
+)
+
+const (
+	testColdAddr = "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp"
+	testTxid     = "7b92a35f1a1de2cd4e9e7bb4d7c2e3ef7a3b0c1b0e4e9c4f4a2d5b8d1c6e9f00"
+)
+
+var testDepositAddrs = []string{
+	"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+	"1LEWwJkDj8xriE87ALzQYcHjTmD8aqDj1f",
+}
+
+type fakeAddressGetter struct {
+	addrs []string
+	err   error
+}
+
+func (f fakeAddressGetter) GetScanAddresses() ([]string, error) {
+	return f.addrs, f.err
+}
+
+type fakeBtcRPCClient struct {
+	unspents   []btcjson.ListUnspentResult
+	incomplete bool
+	sendErr    error
+
+	minConf int
+	addrs   []btcutil.Address
+	inputs  []btcjson.TransactionInput
+	amounts map[btcutil.Address]btcutil.Amount
+	sent    bool
+}
+
+func (f *fakeBtcRPCClient) ListUnspentMinMaxAddresses(minConf, maxConf int, addrs []btcutil.Address) ([]btcjson.ListUnspentResult, error) {
+	f.minConf = minConf
+	f.addrs = addrs
+	return f.unspents, nil
+}
+
+func (f *fakeBtcRPCClient) CreateRawTransaction(inputs []btcjson.TransactionInput, amounts map[btcutil.Address]btcutil.Amount, lockTime *int64) (*wire.MsgTx, error) {
+	f.inputs = inputs
+	f.amounts = amounts
+	return wire.NewMsgTx(wire.TxVersion), nil
+}
+
+func (f *fakeBtcRPCClient) SignRawTransaction(tx *wire.MsgTx) (*wire.MsgTx, bool, error) {
+	return tx, !f.incomplete, nil
+}
+
+func (f *fakeBtcRPCClient) SendRawTransaction(tx *wire.MsgTx, allowHighFees bool) (*chainhash.Hash, error) {
+	if f.sendErr != nil {
+		return nil, f.sendErr
+	}
+
+	f.sent = true
+	return chainhash.NewHashFromStr(testTxid)
+}
+
+func newTestBtcSweeper(t *testing.T, client *fakeBtcRPCClient, addrs AddressGetter) *BtcSweeper {
+	log, _ := testutil.NewLogger(t)
+
+	s, err := NewBtcSweeper(log, client, addrs, BtcConfig{
+		ColdAddress:      testColdAddr,
+		MinConfirmations: 6,
+		FeePerByte:       10,
+	})
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestNewBtcSweeper(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	_, err := NewBtcSweeper(log, &fakeBtcRPCClient{}, fakeAddressGetter{}, BtcConfig{
+		ColdAddress:      "foo",
+		MinConfirmations: 1,
+		FeePerByte:       1,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid cold address")
+
+	_, err = NewBtcSweeper(log, &fakeBtcRPCClient{}, fakeAddressGetter{}, BtcConfig{
+		ColdAddress: testColdAddr,
+		FeePerByte:  1,
+	})
+	require.Error(t, err)
+
+	_, err = NewBtcSweeper(log, &fakeBtcRPCClient{}, fakeAddressGetter{}, BtcConfig{
+		ColdAddress:      testColdAddr,
+		MinConfirmations: 1,
+	})
+	require.Error(t, err)
+}
+
+func TestBtcSweep(t *testing.T) {
+	client := &fakeBtcRPCClient{
+		unspents: []btcjson.ListUnspentResult{
+			{
+				TxID:      "a1",
+				Vout:      0,
+				Address:   testDepositAddrs[0],
+				Amount:    0.5,
+				Spendable: true,
+			},
+			{
+				TxID:      "a2",
+				Vout:      3,
+				Address:   testDepositAddrs[1],
+				Amount:    0.25,
+				Spendable: true,
+			},
+			{
+				// Not spendable by the wallet, skipped
+				TxID:    "a3",
+				Vout:    1,
+				Address: testDepositAddrs[1],
+				Amount:  1,
+			},
+		},
+	}
+
+	s := newTestBtcSweeper(t, client, fakeAddressGetter{addrs: testDepositAddrs})
+
+	res, err := s.Sweep()
+	require.NoError(t, err)
+
+	// Only confirmed outputs of the deposit addresses are requested
+	require.Equal(t, 6, client.minConf)
+	require.Len(t, client.addrs, 2)
+	require.Equal(t, testDepositAddrs[0], client.addrs[0].EncodeAddress())
+	require.Equal(t, testDepositAddrs[1], client.addrs[1].EncodeAddress())
+
+	require.Equal(t, []btcjson.TransactionInput{
+		{Txid: "a1", Vout: 0},
+		{Txid: "a2", Vout: 3},
+	}, client.inputs)
+
+	// 2 inputs and 1 output at 10 satoshis per byte
+	fee := int64((10 + 148*2 + 34) * 10)
+	amount := int64(75000000) - fee
+
+	require.Len(t, client.amounts, 1)
+	for addr, amt := range client.amounts {
+		require.Equal(t, testColdAddr, addr.EncodeAddress())
+		require.Equal(t, btcutil.Amount(amount), amt)
+	}
+
+	require.True(t, client.sent)
+	require.Equal(t, &Result{
+		CoinType:    scanner.CoinTypeBTC,
+		Txid:        testTxid,
+		ColdAddress: testColdAddr,
+		Inputs:      2,
+		Amount:      amount,
+		Fee:         fee,
+	}, res)
+}
+
+func TestBtcSweepMaxInputs(t *testing.T) {
+	client := &fakeBtcRPCClient{}
+	for i := 0; i < maxBtcSweepInputs+10; i++ {
+		client.unspents = append(client.unspents, btcjson.ListUnspentResult{
+			TxID:      "a",
+			Vout:      uint32(i),
+			Amount:    0.01,
+			Spendable: true,
+		})
+	}
+
+	s := newTestBtcSweeper(t, client, fakeAddressGetter{addrs: testDepositAddrs})
+
+	res, err := s.Sweep()
+	require.NoError(t, err)
+	require.Len(t, client.inputs, maxBtcSweepInputs)
+	require.Equal(t, maxBtcSweepInputs, res.Inputs)
+}
+
+func TestBtcSweepErrors(t *testing.T) {
+	t.Run("no deposit addresses", func(t *testing.T) {
+		client := &fakeBtcRPCClient{}
+		s := newTestBtcSweeper(t, client, fakeAddressGetter{})
+
+		_, err := s.Sweep()
+		require.Equal(t, ErrNothingToSweep, err)
+		require.False(t, client.sent)
+	})
+
+	t.Run("address getter error", func(t *testing.T) {
+		client := &fakeBtcRPCClient{}
+		s := newTestBtcSweeper(t, client, fakeAddressGetter{err: errors.New("db closed")})
+
+		_, err := s.Sweep()
+		require.EqualError(t, err, "db closed")
+	})
+
+	t.Run("no unspent outputs", func(t *testing.T) {
+		client := &fakeBtcRPCClient{}
+		s := newTestBtcSweeper(t, client, fakeAddressGetter{addrs: testDepositAddrs})
+
+		_, err := s.Sweep()
+		require.Equal(t, ErrNothingToSweep, err)
+		require.False(t, client.sent)
+	})
+
+	t.Run("deposits don't cover the fee", func(t *testing.T) {
+		client := &fakeBtcRPCClient{
+			unspents: []btcjson.ListUnspentResult{
+				{
+					TxID:      "a1",
+					Amount:    0.00002,
+					Spendable: true,
+				},
+			},
+		}
+		s := newTestBtcSweeper(t, client, fakeAddressGetter{addrs: testDepositAddrs})
+
+		_, err := s.Sweep()
+		require.Equal(t, ErrNothingToSweep, err)
+		require.False(t, client.sent)
+	})
+
+	t.Run("incomplete signature", func(t *testing.T) {
+		client := &fakeBtcRPCClient{
+			unspents: []btcjson.ListUnspentResult{
+				{
+					TxID:      "a1",
+					Amount:    1,
+					Spendable: true,
+				},
+			},
+			incomplete: true,
+		}
+		s := newTestBtcSweeper(t, client, fakeAddressGetter{addrs: testDepositAddrs})
+
+		_, err := s.Sweep()
+		require.Error(t, err)
+		require.False(t, client.sent)
+	})
+
+	t.Run("send error", func(t *testing.T) {
+		client := &fakeBtcRPCClient{
+			unspents: []btcjson.ListUnspentResult{
+				{
+					TxID:      "a1",
+					Amount:    1,
+					Spendable: true,
+				},
+			},
+			sendErr: errors.New("txn-mempool-conflict"),
+		}
+		s := newTestBtcSweeper(t, client, fakeAddressGetter{addrs: testDepositAddrs})
+
+		_, err := s.Sweep()
+		require.EqualError(t, err, "txn-mempool-conflict")
+	})
+}
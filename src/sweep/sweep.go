@@ -0,0 +1,23 @@
+// Package sweep moves confirmed deposits from the deposit addresses to a cold wallet address
+package sweep
+
+import "errors"
+
+// ErrNothingToSweep is returned if there are no confirmed deposits to sweep, or they don't cover the fee
+var ErrNothingToSweep = errors.New("No confirmed deposits to sweep")
+
+// AddressGetter returns the deposit addresses to sweep
+type AddressGetter interface {
+	GetScanAddresses() ([]string, error)
+}
+
+// Result describes a broadcast sweep transaction.
+// Amounts are measured in the coin's smallest unit, e.g. satoshis for BTC
+type Result struct {
+	CoinType    string `json:"coin_type"`
+	Txid        string `json:"txid"`
+	ColdAddress string `json:"cold_address"`
+	Inputs      int    `json:"inputs"`
+	Amount      int64  `json:"amount"`
+	Fee         int64  `json:"fee"`
+}
@@ -0,0 +1,97 @@
+package teller
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MDLlife/MDL/src/cipher"
+)
+
+// AddressList is a set of MDL addresses read from a file, with one address per line.
+// Blank lines and lines starting with # are ignored.
+// The file is read on first use, and read again whenever its modification time changes,
+// so that it can be updated without restarting teller
+type AddressList struct {
+	path string
+
+	lock    sync.Mutex
+	modTime time.Time
+	addrs   map[string]struct{}
+}
+
+// NewAddressList creates an AddressList for the file at path
+func NewAddressList(path string) *AddressList {
+	return &AddressList{
+		path: path,
+	}
+}
+
+// Contains returns true if addr is in the list.
+// If the file can't be read, the error is returned and the list is not changed
+func (l *AddressList) Contains(addr string) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if err := l.refresh(); err != nil {
+		return false, err
+	}
+
+	_, ok := l.addrs[addr]
+	return ok, nil
+}
+
+// refresh reads the file if it was modified since it was last read
+func (l *AddressList) refresh() error {
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+
+	if l.addrs != nil && fi.ModTime().Equal(l.modTime) {
+		return nil
+	}
+
+	addrs, err := readAddressList(l.path)
+	if err != nil {
+		return err
+	}
+
+	l.addrs = addrs
+	l.modTime = fi.ModTime()
+
+	return nil
+}
+
+func readAddressList(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	addrs := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if _, err := cipher.DecodeBase58Address(line); err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid mdl address %q: %v", path, n, line, err)
+		}
+
+		addrs[line] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return addrs, nil
+}
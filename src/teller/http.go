@@ -8,6 +8,10 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -16,34 +20,44 @@ import (
 	"github.com/NYTimes/gziphandler"
 	"github.com/gz-c/tollbooth"
 	"github.com/rs/cors"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 	"github.com/unrolled/secure"
 	"golang.org/x/crypto/acme/autocert"
 
 	"github.com/MDLlife/MDL/src/cipher"
-	"github.com/MDLlife/MDL/src/util/droplet"
 
 	"github.com/MDLlife/teller/src/addrs"
 	"github.com/MDLlife/teller/src/config"
 	"github.com/MDLlife/teller/src/exchange"
+	"github.com/MDLlife/teller/src/i18n"
 	"github.com/MDLlife/teller/src/scanner"
 	"github.com/MDLlife/teller/src/sender"
 	"github.com/MDLlife/teller/src/util/httputil"
 	"github.com/MDLlife/teller/src/util/logger"
+	"github.com/MDLlife/teller/src/util/mathutil"
+	"github.com/MDLlife/teller/web"
 )
 
 const (
 	shutdownTimeout = time.Second * 5
 
-	// https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
-	// The timeout configuration is necessary for public servers, or else
-	// connections will be used up
-	serverReadTimeout  = time.Second * 10
-	serverWriteTimeout = time.Second * 60
-	serverIdleTimeout  = time.Second * 120
-
 	// Directory where cached SSL certs from Let's Encrypt are stored
 	tlsAutoCertCache = "cert-cache"
+
+	// Maximum request body size if web.max_request_bytes is not set
+	defaultMaxRequestBytes = 64 * 1024
+
+	// Maximum length of the optional bind reference
+	maxBindReferenceLength = 128
+	// Maximum length of the optional bind label
+	maxBindLabelLength = 128
+	// Maximum length of an email address, see RFC 5321
+	maxEmailLength = 254
+
+	// How long /api/heights reuses the heights fetched from the nodes
+	heightsCacheTTL = time.Second * 5
+	feesCacheTTL    = time.Minute
 )
 
 var (
@@ -56,6 +70,12 @@ type HTTPServer struct {
 	exchanger     exchange.Exchanger
 	log           logrus.FieldLogger
 	service       *Service
+	heights       *heightsCache
+	usdRates      USDRateFeed     // nil if there is no USD rate feed
+	fees          *feesCache      // nil if no network fees are suggested
+	events        DepositEvents   // nil if web.event_stream_enabled is not set
+	scanners      RunningScanners // nil if binds are not checked for a running scanner
+	mdlAddrFormat *regexp.Regexp  // nil if teller.address_formats has no MDL format
 	httpListener  *http.Server
 	httpsListener *http.Server
 	quit          chan struct{}
@@ -63,7 +83,7 @@ type HTTPServer struct {
 }
 
 // NewHTTPServer creates an HTTPServer
-func NewHTTPServer(log logrus.FieldLogger, cfg config.Config, service *Service, exchanger exchange.Exchanger) *HTTPServer {
+func NewHTTPServer(log logrus.FieldLogger, cfg config.Config, service *Service, exchanger exchange.Exchanger, heights ScannerHeights) *HTTPServer {
 	return &HTTPServer{
 		cfg: cfg.Redacted(),
 		log: log.WithFields(logrus.Fields{
@@ -71,6 +91,7 @@ func NewHTTPServer(log logrus.FieldLogger, cfg config.Config, service *Service,
 		}),
 		service:   service,
 		exchanger: exchanger,
+		heights:   newHeightsCache(heights, heightsCacheTTL),
 		quit:      make(chan struct{}),
 		done:      make(chan struct{}),
 	}
@@ -111,11 +132,14 @@ func (s *HTTPServer) Run() error {
 
 	log.Info("Configured")
 
-	secureMiddleware := configureSecureMiddleware(sslHost, allowedHosts)
+	secureMiddleware := configureSecureMiddleware(sslHost, allowedHosts, s.cfg.Web)
 	mux = secureMiddleware.Handler(mux)
 
+	// Applied last, so that the configured headers replace those set by the secure middleware and the handlers
+	mux = httputil.HeadersHandler(mux, s.cfg.Web.ResponseHeaders)
+
 	if s.cfg.Web.HTTPAddr != "" {
-		s.httpListener = setupHTTPListener(s.cfg.Web.HTTPAddr, mux)
+		s.httpListener = s.newHTTPListener(mux)
 	}
 
 	handleListenErr := func(f func() error) error {
@@ -142,7 +166,7 @@ func (s *HTTPServer) Run() error {
 	if s.cfg.Web.HTTPSAddr != "" {
 		log.Info("Using TLS")
 
-		s.httpsListener = setupHTTPListener(s.cfg.Web.HTTPSAddr, mux)
+		s.httpsListener = s.newHTTPSListener(mux)
 
 		tlsCert = s.cfg.Web.TLSCert
 		tlsKey = s.cfg.Web.TLSKey
@@ -212,7 +236,7 @@ func (s *HTTPServer) Run() error {
 	})
 }
 
-func configureSecureMiddleware(sslHost string, allowedHosts []string) *secure.Secure {
+func configureSecureMiddleware(sslHost string, allowedHosts []string, web config.Web) *secure.Secure {
 	sslRedirect := true
 	if sslHost == "" {
 		sslRedirect = false
@@ -227,11 +251,11 @@ func configureSecureMiddleware(sslHost string, allowedHosts []string) *secure.Se
 		// FIXME: Web frontend code has inline styles, CSP doesn't work yet
 		// ContentSecurityPolicy: "default-src 'self'",
 
-		// Set HSTS to one year, for this domain only, do not add to chrome preload list
+		// Set HSTS from web.sts_*, by default to one year, for this domain only, not added to chrome preload list
 		// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Strict-Transport-Security
-		STSSeconds:           31536000, // 1 year
-		STSIncludeSubdomains: false,
-		STSPreload:           false,
+		STSSeconds:           web.STSSeconds,
+		STSIncludeSubdomains: web.STSIncludeSubdomains,
+		STSPreload:           web.STSPreload,
 
 		// Deny use in iframes
 		// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/X-Frame-Options
@@ -250,13 +274,25 @@ func configureSecureMiddleware(sslHost string, allowedHosts []string) *secure.Se
 	})
 }
 
-func setupHTTPListener(addr string, handler http.Handler) *http.Server {
+// newHTTPListener creates the listener of web.http_addr, with the web.http_*_timeout timeouts
+func (s *HTTPServer) newHTTPListener(handler http.Handler) *http.Server {
+	return setupHTTPListener(s.cfg.Web.HTTPAddr, handler, s.cfg.Web.HTTPTimeouts())
+}
+
+// newHTTPSListener creates the listener of web.https_addr, with the web.https_*_timeout timeouts
+func (s *HTTPServer) newHTTPSListener(handler http.Handler) *http.Server {
+	return setupHTTPListener(s.cfg.Web.HTTPSAddr, handler, s.cfg.Web.HTTPSTimeouts())
+}
+
+// setupHTTPListener creates a listener. The timeouts are necessary for public servers, or else connections will be used up,
+// see https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
+func setupHTTPListener(addr string, handler http.Handler, timeouts config.ListenerTimeouts) *http.Server {
 	return &http.Server{
 		Addr:         addr,
 		Handler:      handler,
-		ReadTimeout:  serverReadTimeout,
-		WriteTimeout: serverWriteTimeout,
-		IdleTimeout:  serverIdleTimeout,
+		ReadTimeout:  timeouts.Read,
+		WriteTimeout: timeouts.Write,
+		IdleTimeout:  timeouts.Idle,
 	}
 }
 
@@ -271,30 +307,101 @@ func (s *HTTPServer) setupMux() *http.ServeMux {
 		return tollbooth.LimitHandler(limiter, h)
 	}
 
-	handleAPI := func(path string, h http.Handler) {
+	// Limit the number of in-flight API requests per IP, shared by all API endpoints
+	concurrencyLimiter := httputil.NewConcurrencyLimiter(s.cfg.Web.MaxConcurrentPerIP, s.cfg.Web.BehindProxy)
+
+	// handleUnlimitedAPI is handleAPI without the concurrency limit
+	handleUnlimitedAPI := func(path string, h http.Handler) {
+		// Reject timestamped requests that are stale or future-dated, so that they can't be replayed
+		h = httputil.TimestampHandler(h, s.cfg.Web.MaxClockSkew)
+
 		// Allow requests from a local mdl wallet
 		h = cors.New(cors.Options{
 			//AllowedOrigins: []string{"http://127.0.0.1:8320"},
 			AllowedOrigins: []string{"*"},
+			AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", httputil.TimestampHeader},
 		}).Handler(h)
 
 		h = gziphandler.GzipHandler(h)
 
+		// A panicking handler responds with 500 instead of dropping the connection
+		h = httputil.RecoverHandler(s.log, h)
+
+		// Return errors with 200 OK to legacy clients that ask for it, or to all clients if configured
+		h = httputil.ErrorsAsOKHandler(h, s.cfg.Web.ErrorsAsOK)
+
+		mux.Handle(path, h)
+	}
+
+	handleAPI := func(path string, h http.Handler) {
+		handleUnlimitedAPI(path, concurrencyLimiter.Handler(h))
+	}
+
+	// handleStreamAPI is handleAPI for streamed responses, which are written as they happen and can't be gzipped
+	handleStreamAPI := func(path string, h http.Handler) {
+		h = concurrencyLimiter.Handler(h)
+		h = httputil.TimestampHandler(h, s.cfg.Web.MaxClockSkew)
+		h = cors.New(cors.Options{
+			AllowedOrigins: []string{"*"},
+			AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "Last-Event-ID", httputil.TimestampHeader},
+		}).Handler(h)
+		h = httputil.RecoverHandler(s.log, h)
+		h = httputil.ErrorsAsOKHandler(h, s.cfg.Web.ErrorsAsOK)
 		mux.Handle(path, h)
 	}
 
+	// Cancel the request context and respond with 503 if the handler takes too long
+	timeout := func(h http.Handler) http.Handler {
+		return httputil.TimeoutHandler(h, s.cfg.Web.HandlerTimeout)
+	}
+
+	// Log 1 in web.log_sample_rate of the successful requests, and every failed request
+	logged := func(h http.Handler) http.Handler {
+		return httputil.SampledLogHandler(s.log, s.cfg.Web.LogSampleRate, h)
+	}
+
 	// API Methods
-	handleAPI("/api/bind", ratelimit(httputil.LogHandler(s.log, BindHandler(s))))
-	handleAPI("/api/status", ratelimit(httputil.LogHandler(s.log, StatusHandler(s))))
-	handleAPI("/api/config", httputil.LogHandler(s.log, ConfigHandler(s)))
-	handleAPI("/api/exchange-status", httputil.LogHandler(s.log, ExchangeStatusHandler(s)))
+	handleAPI("/api/bind", ratelimit(logged(timeout(BindHandler(s)))))
+	handleAPI("/api/status", ratelimit(logged(timeout(StatusHandler(s)))))
+	handleAPI("/api/config", logged(timeout(ConfigHandler(s))))
+	handleAPI("/api/exchange-status", logged(timeout(ExchangeStatusHandler(s))))
+	handleAPI("/api/labels", logged(timeout(LabelsHandler(s))))
+	handleAPI("/api/heights", logged(timeout(HeightsHandler(s))))
+	handleAPI("/api/supported", logged(timeout(SupportedHandler(s))))
+
+	// The event stream outlives web.handler_timeout, it ends by itself before the server's write timeout
+	handleStreamAPI("/api/events", ratelimit(logged(EventsHandler(s))))
+
+	if s.cfg.Email.UserNotifications {
+		handleAPI("/api/notifications/opt-out", ratelimit(logged(timeout(NotificationsOptOutHandler(s)))))
+	}
+
+	// Connectivity checks are neither rate limited nor concurrency limited
+	handleUnlimitedAPI("/api/ping", logged(PingHandler(s)))
 
 	// Static files
-	mux.Handle("/", gziphandler.GzipHandler(http.FileServer(http.Dir(s.cfg.Web.StaticDir))))
+	staticFS := s.staticFS()
+	static, err := httputil.GzipHandler(http.FileServer(staticFS), s.cfg.Web.GzipLevel, s.cfg.Web.GzipContentTypes)
+	if err != nil {
+		// web.gzip_level is checked by config.Web.Validate
+		s.log.WithError(err).Error("Invalid web.gzip_level, using the default gzip settings for static files")
+		static = gziphandler.GzipHandler(http.FileServer(staticFS))
+	}
+	mux.Handle("/", httputil.RecoverHandler(s.log, static))
 
 	return mux
 }
 
+// staticFS returns the static files served by the HTTPServer: the files in web.static_dir if it is set,
+// otherwise the frontend build embedded in the binary
+func (s *HTTPServer) staticFS() http.FileSystem {
+	if s.cfg.Web.StaticDir != "" {
+		return http.Dir(s.cfg.Web.StaticDir)
+	}
+
+	return http.FS(web.Build())
+}
+
 // Shutdown stops the HTTPServer
 func (s *HTTPServer) Shutdown() {
 	s.log.Info("Shutting down HTTP server(s)")
@@ -337,11 +444,34 @@ type BindResponse struct {
 	DepositAddress string `json:"deposit_address,omitempty"`
 	CoinType       string `json:"coin_type,omitempty"`
 	BuyMethod      string `json:"buy_method"`
+	// PayoutsEnabled is false if the address was prebound while sending is disabled.
+	// Deposits are recorded but MDL is not sent until sending is enabled.
+	PayoutsEnabled bool `json:"payouts_enabled"`
+
+	// PaymentURI deep-links the deposit to a wallet, e.g. "bitcoin:<addr>?amount=0.1".
+	// It is omitted for coin types without a payment URI scheme
+	PaymentURI string `json:"payment_uri,omitempty"`
+
+	// BoundAt is when the address was bound, as a unix timestamp
+	BoundAt int64 `json:"bound_at"`
+
+	// Label is the label of the bind request, if any
+	Label string `json:"label,omitempty"`
+
+	// ExpectedAmount is the expected amount of the bind request, if any
+	ExpectedAmount string `json:"expected_amount,omitempty"`
 }
 
 type bindRequest struct {
-	MDLAddr  string `json:"mdladdr"`
-	CoinType string `json:"coin_type"`
+	MDLAddr   string `json:"mdladdr"`
+	CoinType  string `json:"coin_type"`
+	Reference string `json:"reference,omitempty"`
+	Label     string `json:"label,omitempty"`
+
+	Amount         string `json:"amount,omitempty"`
+	ExpectedAmount string `json:"expected_amount,omitempty"`
+
+	Email string `json:"email,omitempty"`
 }
 
 // BindHandler binds mdl address with another coin address
@@ -349,7 +479,14 @@ type bindRequest struct {
 // Accept: application/json
 // URI: /api/bind
 // Args:
-//    {"mdladdr": "...", "coin_type": "BTC"}
+//    {"mdladdr": "...", "coin_type": "BTC", "reference": "...", "label": "...", "amount": "0.1", "expected_amount": "0.1", "email": "..."}
+//    reference is optional and is echoed back in /api/status
+//    label is optional, the deposit address with this label in the address file is bound if it is available,
+//    otherwise the next address. It is stored with the binding and echoed back in /api/status
+//    amount is optional, it is the suggested deposit amount in payment_uri
+//    expected_amount is optional, deposits that don't match it are held for review. It is the default amount
+//    in payment_uri
+//    email is optional, it is emailed when the payout of a deposit is done. Requires email.user_notifications
 func BindHandler(s *HTTPServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -361,16 +498,24 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
+		if s.cfg.ReadOnly {
+			errorResponse(ctx, w, http.StatusServiceUnavailable, ErrReadOnly)
+			return
+		}
+
 		if r.Header.Get("Content-Type") != "application/json" {
 			errorResponse(ctx, w, http.StatusUnsupportedMediaType, errors.New("Invalid content type"))
 			return
 		}
 
+		maxRequestBytes := s.cfg.Web.MaxRequestBytes
+		if maxRequestBytes <= 0 {
+			maxRequestBytes = defaultMaxRequestBytes
+		}
+
 		bindReq := &bindRequest{}
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&bindReq); err != nil {
-			err = fmt.Errorf("Invalid json request body: %v", err)
-			errorResponse(ctx, w, http.StatusBadRequest, err)
+		if code, err := httputil.DecodeJSONBody(w, r, maxRequestBytes, bindReq); err != nil {
+			errorResponse(ctx, w, code, err)
 			return
 		}
 		defer func(log logrus.FieldLogger) {
@@ -381,6 +526,11 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 
 		// Remove extraneous whitespace
 		bindReq.MDLAddr = strings.Trim(bindReq.MDLAddr, "\n\t ")
+		bindReq.Reference = strings.Trim(bindReq.Reference, "\n\t ")
+		bindReq.Label = strings.Trim(bindReq.Label, "\n\t ")
+		bindReq.Amount = strings.Trim(bindReq.Amount, "\n\t ")
+		bindReq.ExpectedAmount = strings.Trim(bindReq.ExpectedAmount, "\n\t ")
+		bindReq.Email = strings.Trim(bindReq.Email, "\n\t ")
 
 		log = log.WithField("bindReq", bindReq)
 		ctx = logger.WithContext(ctx, log)
@@ -390,30 +540,81 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
+		if len(bindReq.Reference) > maxBindReferenceLength {
+			errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("Reference too long, must be at most %d bytes", maxBindReferenceLength))
+			return
+		}
+
+		if len(bindReq.Label) > maxBindLabelLength {
+			errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("Label too long, must be at most %d bytes", maxBindLabelLength))
+			return
+		}
+
+		var amount decimal.Decimal
+		if bindReq.Amount != "" {
+			var err error
+			amount, err = mathutil.DecimalFromString(bindReq.Amount)
+			if err != nil || amount.LessThanOrEqual(decimal.New(0, 0)) {
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New("Invalid amount, must be a positive decimal number"))
+				return
+			}
+		}
+
+		if bindReq.ExpectedAmount != "" {
+			expectedAmount, err := mathutil.DecimalFromString(bindReq.ExpectedAmount)
+			if err != nil || expectedAmount.LessThanOrEqual(decimal.New(0, 0)) {
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New("Invalid expected_amount, must be a positive decimal number"))
+				return
+			}
+
+			// Store the amount in a canonical format, and suggest it in payment_uri unless another amount was requested
+			bindReq.ExpectedAmount = expectedAmount.String()
+			if bindReq.Amount == "" {
+				amount = expectedAmount
+			}
+		}
+
+		if bindReq.Email != "" {
+			if !s.cfg.Email.UserNotifications {
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New("Email notifications are not enabled"))
+				return
+			}
+
+			if !validEmail(bindReq.Email) {
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New("Invalid email address"))
+				return
+			}
+		}
+
+		// Accept coin types in any case, and configured aliases such as "bitcoin"
+		if coinType, err := scanner.NormalizeCoinType(bindReq.CoinType, s.cfg.Teller.CoinTypeAliases); err == nil {
+			bindReq.CoinType = coinType
+		}
+
 		switch bindReq.CoinType {
 		case scanner.CoinTypeBTC:
 			if !s.cfg.BtcRPC.Enabled {
-				errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("Oops, there seems to be an issue. The selected coin type %s is not enabled. We are working on a fix, please try again in a couple of hours", scanner.CoinTypeBTC))
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New(s.cfg.Teller.FormatCoinDisabledMessage(bindReq.CoinType)))
 				return
 			}
 		case scanner.CoinTypeETH:
 			if !s.cfg.EthRPC.Enabled {
-				errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("Oops, there seems to be an issue. The selected coin type %s is not enabled. We are working on a fix, please try again in a couple of hours", scanner.CoinTypeETH))
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New(s.cfg.Teller.FormatCoinDisabledMessage(bindReq.CoinType)))
 				return
 			}
 		case scanner.CoinTypeSKY:
 			if !s.cfg.SkyRPC.Enabled {
-				errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("Oops, there seems to be an issue. The selected coin type %s is not enabled. We are working on a fix, please try again in a couple of hours", scanner.CoinTypeSKY))
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New(s.cfg.Teller.FormatCoinDisabledMessage(bindReq.CoinType)))
 				return
 			}
 		case scanner.CoinTypeWAVES:
 			if !s.cfg.WavesRPC.Enabled {
-				errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("Oops, there seems to be an issue. The selected coin type %s is not enabled. We are working on a fix, please try again in a couple of hours", scanner.CoinTypeWAVES))
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New(s.cfg.Teller.FormatCoinDisabledMessage(bindReq.CoinType)))
 				return
 			}
 		case scanner.CoinTypeWAVESMDL:
 			if !s.cfg.WavesMDLRPC.Enabled {
-				errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("Oops, there seems to be an issue. The selected coin type %s is not enabled. We are working on a fix, please try again in a couple of hours", scanner.CoinTypeWAVES))
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New(s.cfg.Teller.FormatCoinDisabledMessage(bindReq.CoinType)))
 				return
 			}
 		case "":
@@ -424,20 +625,55 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
+		if err := s.checkScannerRunning(bindReq.CoinType); err != nil {
+			log.WithError(err).Error("No scanner is running for the coin type")
+			errorResponse(ctx, w, http.StatusServiceUnavailable, errors.New(s.cfg.Teller.FormatNoScannerMessage(bindReq.CoinType)))
+			return
+		}
+
 		log.Info()
 
-		if !verifyMDLAddress(ctx, w, bindReq.MDLAddr) {
+		if !s.verifyMDLAddress(ctx, w, bindReq.MDLAddr) {
+			return
+		}
+
+		if err := s.service.CheckMDLAddress(bindReq.MDLAddr); err != nil {
+			switch err {
+			case ErrMDLAddressBlocked, ErrMDLAddressNotAllowed:
+				errorResponse(ctx, w, http.StatusForbidden, err)
+			default:
+				log.WithError(err).Error("service.CheckMDLAddress failed")
+				errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			}
 			return
 		}
 
 		log.Info("Calling service.BindAddress")
 
-		boundAddr, err := s.service.BindAddress(bindReq.MDLAddr, bindReq.CoinType)
+		boundAddr, err := s.service.BindAddress(ctx, bindReq.MDLAddr, bindReq.CoinType, exchange.BindOptions{
+			Reference:      bindReq.Reference,
+			Label:          bindReq.Label,
+			ExpectedAmount: bindReq.ExpectedAmount,
+			ContactEmail:   bindReq.Email,
+		})
 		if err != nil {
+			if cooldownErr, ok := err.(BindCooldownError); ok {
+				// Round up, so that a retry after the advertised delay is allowed
+				retryAfter := (cooldownErr.RetryAfter + time.Second - 1) / time.Second
+				w.Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter), 10))
+				errorResponse(ctx, w, http.StatusTooManyRequests, err)
+				return
+			}
+
 			log.WithError(err).Error("service.BindAddress failed")
 			switch err {
-			case ErrBindDisabled:
+			case ErrBindDisabled, ErrPayoutsDisabled, exchange.ErrCoinDeprecated:
 				errorResponse(ctx, w, http.StatusForbidden, err)
+			case ErrLowBalance, ErrDepositAddressFunded:
+				errorResponse(ctx, w, http.StatusServiceUnavailable, err)
+			case context.DeadlineExceeded, context.Canceled:
+				// web.handler_timeout responded already, or the client is gone
+				errorResponse(ctx, w, http.StatusServiceUnavailable, errors.New("Request timed out"))
 			default:
 				switch err {
 				case addrs.ErrDepositAddressEmpty, ErrMaxBoundAddresses:
@@ -456,15 +692,44 @@ func BindHandler(s *HTTPServer) http.HandlerFunc {
 			DepositAddress: boundAddr.Address,
 			CoinType:       boundAddr.CoinType,
 			BuyMethod:      boundAddr.BuyMethod,
+			PayoutsEnabled: s.service.PayoutsEnabled(),
+			PaymentURI:     paymentURI(boundAddr.CoinType, boundAddr.Address, amount),
+			BoundAt:        boundAddr.CreatedAt,
+			Label:          boundAddr.Label,
+			ExpectedAmount: boundAddr.ExpectedAmount,
 		}); err != nil {
 			log.WithError(err).Error(err)
 		}
 	}
 }
 
+// paymentURI formats a payment URI for a deposit of amount to addr, e.g. "bitcoin:<addr>?amount=0.1".
+// A zero amount is left out of the URI. Ethereum URIs follow EIP-681, with the amount in wei.
+// Returns an empty string if the coin type has no payment URI scheme
+func paymentURI(coinType, addr string, amount decimal.Decimal) string {
+	scheme := scanner.PaymentURIScheme(coinType)
+	if scheme == "" {
+		return ""
+	}
+
+	uri := fmt.Sprintf("%s:%s", scheme, addr)
+	if amount.Sign() <= 0 {
+		return uri
+	}
+
+	switch coinType {
+	case scanner.CoinTypeETH:
+		return fmt.Sprintf("%s?value=%s", uri, amount.Mul(decimal.New(1, 18)).Truncate(0).String())
+	default:
+		return fmt.Sprintf("%s?amount=%s", uri, amount.String())
+	}
+}
+
 // StatusResponse http response for /api/status
 type StatusResponse struct {
 	Statuses []exchange.DepositStatus `json:"statuses,omitempty"`
+	// The highest version of the mdl address's statuses, pass it as since to only get the statuses changed later
+	Version uint64 `json:"version"`
 }
 
 // StatusHandler returns the deposit status of specific mdl address
@@ -472,6 +737,7 @@ type StatusResponse struct {
 // URI: /api/status
 // Args:
 //     mdladdr
+//     since [optional] # only return the statuses with a version greater than since
 func StatusHandler(s *HTTPServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -496,10 +762,20 @@ func StatusHandler(s *HTTPServer) http.HandlerFunc {
 
 		log.Info()
 
-		if !verifyMDLAddress(ctx, w, mdlAddr) {
+		if !s.verifyMDLAddress(ctx, w, mdlAddr) {
 			return
 		}
 
+		var since uint64
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			since, err = strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New("Invalid since"))
+				return
+			}
+		}
+
 		log.Info("Sending StatusRequest to teller")
 
 		depositStatuses, err := s.service.GetDepositStatuses(mdlAddr)
@@ -515,22 +791,194 @@ func StatusHandler(s *HTTPServer) http.HandlerFunc {
 		})
 		log.Info("Got depositStatuses")
 
+		version := since
+		changed := make([]exchange.DepositStatus, 0, len(depositStatuses))
+		for _, ds := range depositStatuses {
+			if ds.Version > version {
+				version = ds.Version
+			}
+			if ds.Version > since {
+				changed = append(changed, ds)
+			}
+		}
+
+		if since == 0 {
+			changed = depositStatuses
+		}
+
 		if err := httputil.JSONResponse(w, StatusResponse{
-			Statuses: depositStatuses,
+			Statuses: changed,
+			Version:  version,
 		}); err != nil {
 			log.WithError(err).Error(err)
 		}
 	}
 }
 
+const (
+	// How long an /api/events stream lasts, it must end before the listener's write timeout. EventSource clients reconnect
+	// by themselves, sending the id of the last event received as the Last-Event-ID header
+	eventStreamDuration = time.Second * 50
+	// How often a comment is written to an idle /api/events stream, so that proxies keep the connection open.
+	// Deposit statuses that changed without an event, e.g. to waiting_send, are sent at the same time
+	eventStreamKeepAlive = time.Second * 15
+)
+
+// EventsHandler streams the deposit status changes of an MDL address as Server-Sent Events.
+// Each event is a "status" event whose data is a DepositStatus and whose id is the DepositStatus version.
+// The statuses changed since the since query param or the Last-Event-ID header are sent first, all statuses if neither is set.
+// Afterwards, a status is sent whenever it changes. See StatusHandler for polling instead
+// Method: GET
+// Content-Type: text/event-stream
+// URI: /api/events
+// Args:
+//     mdladdr [required]
+//     since [optional]
+func EventsHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		if s.events == nil {
+			errorResponse(ctx, w, http.StatusNotFound, errors.New("Event stream is disabled"))
+			return
+		}
+
+		mdlAddr := strings.Trim(r.URL.Query().Get("mdladdr"), "\n\t ")
+		if mdlAddr == "" {
+			errorResponse(ctx, w, http.StatusBadRequest, errors.New("Missing mdladdr"))
+			return
+		}
+
+		log = log.WithField("mdlAddr", mdlAddr)
+		ctx = logger.WithContext(ctx, log)
+
+		if !s.verifyMDLAddress(ctx, w, mdlAddr) {
+			return
+		}
+
+		since := r.Header.Get("Last-Event-ID")
+		if v := r.URL.Query().Get("since"); v != "" {
+			since = v
+		}
+
+		var version uint64
+		if since != "" {
+			var err error
+			version, err = strconv.ParseUint(since, 10, 64)
+			if err != nil {
+				errorResponse(ctx, w, http.StatusBadRequest, errors.New("Invalid since"))
+				return
+			}
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			log.Error("http.ResponseWriter does not implement http.Flusher")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		// Subscribe before reading the statuses, so that no change is missed in between
+		evs, unsubscribe := s.events.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// Disable response buffering by nginx
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		// writeChanged writes the statuses with a version above version, oldest first.
+		// The first time, all statuses are written if no version was given
+		all := version == 0
+		writeChanged := func() error {
+			depositStatuses, err := s.service.GetDepositStatuses(mdlAddr)
+			if err != nil {
+				log.WithError(err).Error("service.GetDepositStatuses failed")
+				return err
+			}
+
+			changed := make([]exchange.DepositStatus, 0, len(depositStatuses))
+			for _, ds := range depositStatuses {
+				if all || ds.Version > version {
+					changed = append(changed, ds)
+				}
+			}
+
+			sort.Slice(changed, func(i, j int) bool {
+				return changed[i].Version < changed[j].Version
+			})
+
+			for _, ds := range changed {
+				d, err := json.Marshal(ds)
+				if err != nil {
+					return err
+				}
+
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", ds.Version, d); err != nil {
+					return err
+				}
+
+				if ds.Version > version {
+					version = ds.Version
+				}
+			}
+
+			all = false
+			flusher.Flush()
+			return nil
+		}
+
+		if err := writeChanged(); err != nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(eventStreamKeepAlive)
+		defer keepAlive.Stop()
+		end := time.After(eventStreamDuration)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.quit:
+				return
+			case <-end:
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				if err := writeChanged(); err != nil {
+					return
+				}
+			case e := <-evs:
+				if e.MDLAddress != mdlAddr {
+					continue
+				}
+				if err := writeChanged(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
 // ConfigResponse http response for /api/config
 type ConfigResponse struct {
 	Enabled                  bool                     `json:"enabled"`
 	AndroidEnabled           bool                     `json:"android_enabled"`
-	Available                float64                  `json:"available"`
+	Available                Amount                   `json:"available"`
+	BalanceAvailable         bool                     `json:"balance_available"` // false if the wallet balance couldn't be read, Available is not the balance then
 	BtcConfirmationsRequired int64                    `json:"btc_confirmations_required"`
 	EthConfirmationsRequired int64                    `json:"eth_confirmations_required"`
 	MaxBoundAddresses        int                      `json:"max_bound_addrs"`
+	MaxBoundAddressesPerCoin map[string]int           `json:"max_bound_addrs_per_coin,omitempty"`
 	MDLBtcExchangeRate       string                   `json:"mdl_btc_exchange_rate"`
 	MDLEthExchangeRate       string                   `json:"mdl_eth_exchange_rate"`
 	MDLSkyExchangeRate       string                   `json:"mdl_sky_exchange_rate"`
@@ -538,11 +986,142 @@ type ConfigResponse struct {
 	MDLWavesMDLExchangeRate  string                   `json:"mdl_waves_mdl_exchange_rate"`
 	MaxDecimals              int                      `json:"max_decimals"`
 	Supported                []config.SupportedCrypto `json:"supported"`
+
+	// Exchange rates in droplets, unaffected by the display format
+	MDLBtcExchangeRateDroplets      uint64 `json:"mdl_btc_exchange_rate_droplets,string"`
+	MDLEthExchangeRateDroplets      uint64 `json:"mdl_eth_exchange_rate_droplets,string"`
+	MDLSkyExchangeRateDroplets      uint64 `json:"mdl_sky_exchange_rate_droplets,string"`
+	MDLWavesExchangeRateDroplets    uint64 `json:"mdl_waves_exchange_rate_droplets,string"`
+	MDLWavesMDLExchangeRateDroplets uint64 `json:"mdl_waves_mdl_exchange_rate_droplets,string"`
+
+	// Exchange rates with the coin's mdl_*_spread taken off, the rates deposits are paid out at.
+	// The same as the exchange rates if there is no spread
+	MDLBtcEffectiveExchangeRate      string `json:"mdl_btc_effective_exchange_rate"`
+	MDLEthEffectiveExchangeRate      string `json:"mdl_eth_effective_exchange_rate"`
+	MDLSkyEffectiveExchangeRate      string `json:"mdl_sky_effective_exchange_rate"`
+	MDLWavesEffectiveExchangeRate    string `json:"mdl_waves_effective_exchange_rate"`
+	MDLWavesMDLEffectiveExchangeRate string `json:"mdl_waves_mdl_effective_exchange_rate"`
+
+	// The smallest deposit of each coin type that is paid out, as an amount of the coin.
+	// Smaller deposits are given 0 MDL once truncated to MaxDecimals
+	MinDepositForPayout map[string]string `json:"min_deposit_for_payout,omitempty"`
+
+	// The deprecation states of the deprecated coin types, keyed by coin type
+	CoinDeprecations map[string]exchange.CoinDeprecation `json:"coin_deprecations,omitempty"`
+
+	// The network fees suggested by the nodes for deposits, keyed by coin type.
+	// Coins whose node can't estimate fees are left out
+	SuggestedNetworkFee map[string]NetworkFee `json:"suggested_network_fee,omitempty"`
+}
+
+// NetworkFee is a suggested network fee for a deposit
+type NetworkFee struct {
+	Fee  string `json:"fee"`
+	Unit string `json:"unit"`
+}
+
+// Amount is an amount of droplets in an API response. It is rendered as a JSON string,
+// so that clients don't lose precision parsing it as a float.
+// If Number is set it is rendered as a JSON number instead, see config.Web.AvailableAsNumber.
+// If Null is set it is rendered as null, see config.Web.AvailableNullOnError
+type Amount struct {
+	Droplets uint64
+	Number   bool
+	Null     bool
+}
+
+// MarshalJSON implements json.Marshaler
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if a.Null {
+		return []byte("null"), nil
+	}
+
+	s := strconv.FormatUint(a.Droplets, 10)
+	if a.Number {
+		return []byte(s), nil
+	}
+	return []byte(strconv.Quote(s)), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting either a JSON string, a JSON number or null
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		*a = Amount{Null: true}
+		return nil
+	}
+
+	number := true
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+		number = false
+	}
+
+	droplets, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid amount %s: %v", b, err)
+	}
+
+	a.Droplets = droplets
+	a.Number = number
+	return nil
+}
+
+// formatDroplets converts droplets to a MDL balance string with precision decimal places, see mathutil.FormatDroplets.
+// With config.RateFormatTrim, trailing zeros after the decimal point are removed
+func formatDroplets(amt uint64, precision int, format string) (string, error) {
+	s, err := mathutil.FormatDroplets(amt, precision)
+	if err != nil {
+		return "", err
+	}
+
+	if format == config.RateFormatTrim && strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+
+	return s, nil
+}
+
+// rateDroplets converts an exchange rate to the droplets sent per coin with calculate, and formats them.
+// An empty rate, allowed while the coin's exchange is disabled, is returned as 0 and ""
+func rateDroplets(calculate func(rate string) (uint64, error), rate string, precision int, format string) (uint64, string, error) {
+	if rate == "" {
+		return 0, "", nil
+	}
+
+	droplets, err := calculate(rate)
+	if err != nil {
+		return 0, "", err
+	}
+
+	formatted, err := formatDroplets(droplets, precision, format)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return droplets, formatted, nil
+}
+
+// effectiveRateDroplets is rateDroplets for the exchange rate of coinType with its spread applied
+func effectiveRateDroplets(cfg config.MDLExchanger, coinType string, calculate func(rate string) (uint64, error), precision int, format string) (uint64, string, error) {
+	rate, err := exchange.EffectiveRate(cfg, coinType)
+	switch err {
+	case nil:
+	case exchange.ErrRateNotSet:
+		return 0, "", nil
+	default:
+		return 0, "", err
+	}
+
+	return rateDroplets(calculate, rate, precision, format)
 }
 
 // ConfigHandler returns the teller configuration
 // Method: GET
 // URI: /api/config
+// Args:
+//     format - Optional, "fixed" or "trim". Overrides web.rate_format
 func ConfigHandler(s *HTTPServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -552,152 +1131,759 @@ func ConfigHandler(s *HTTPServer) http.HandlerFunc {
 			return
 		}
 
-		// Convert the exchange rate to a mdl balance string
-		rate := s.cfg.MDLExchanger.MDLBtcExchangeRate
+		format := s.cfg.Web.RateFormat
+		if f := r.FormValue("format"); f != "" {
+			format = f
+		}
+		if err := config.ValidateRateFormat(format); err != nil {
+			errorResponse(ctx, w, http.StatusBadRequest, err)
+			return
+		}
+
+		// Convert the exchange rates to mdl balance strings
 		maxDecimals := s.cfg.MDLExchanger.MaxDecimals
-		dropletsPerBTC, err := exchange.CalculateBtcMDLValue(exchange.SatoshisPerBTC, rate, maxDecimals)
+		precision := s.cfg.Web.MDLDisplayPrecision()
+		calculateBTC := func(rate string) (uint64, error) {
+			return exchange.CalculateBtcMDLValue(exchange.SatoshisPerBTC, rate, maxDecimals)
+		}
+		dropletsPerBTC, mdlPerBTC, err := rateDroplets(calculateBTC, s.cfg.MDLExchanger.MDLBtcExchangeRate, precision, format)
 		if err != nil {
 			log.WithError(err).Error("exchange.CalculateBtcMDLValue failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
-
-		mdlPerBTC, err := droplet.ToString(dropletsPerBTC)
+		_, effectiveMDLPerBTC, err := effectiveRateDroplets(s.cfg.MDLExchanger, scanner.CoinTypeBTC, calculateBTC, precision, format)
 		if err != nil {
-			log.WithError(err).Error("droplet.ToString failed dropletsPerBTC")
+			log.WithError(err).Error("effectiveRateDroplets failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
-		rate = s.cfg.MDLExchanger.MDLEthExchangeRate
-		dropletsPerETH, err := exchange.CalculateEthMDLValue(big.NewInt(exchange.WeiPerETH), rate, maxDecimals)
+
+		calculateETH := func(rate string) (uint64, error) {
+			return exchange.CalculateEthMDLValue(big.NewInt(exchange.WeiPerETH), rate, maxDecimals)
+		}
+		dropletsPerETH, mdlPerETH, err := rateDroplets(calculateETH, s.cfg.MDLExchanger.MDLEthExchangeRate, precision, format)
 		if err != nil {
 			log.WithError(err).Error("exchange.CalculateEthMDLValue failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
-		mdlPerETH, err := droplet.ToString(dropletsPerETH)
+		_, effectiveMDLPerETH, err := effectiveRateDroplets(s.cfg.MDLExchanger, scanner.CoinTypeETH, calculateETH, precision, format)
 		if err != nil {
-			log.WithError(err).Error("droplet.ToString failed dropletsPerETH")
+			log.WithError(err).Error("effectiveRateDroplets failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
 
-		rate = s.cfg.MDLExchanger.MDLSkyExchangeRate
-		dropletsPerSKY, err := exchange.CalculateSkyMDLValue(exchange.DropletsPerSKY, rate, maxDecimals)
+		calculateSKY := func(rate string) (uint64, error) {
+			return exchange.CalculateSkyMDLValue(exchange.DropletsPerSKY, rate, maxDecimals)
+		}
+		dropletsPerSKY, mdlPerSKY, err := rateDroplets(calculateSKY, s.cfg.MDLExchanger.MDLSkyExchangeRate, precision, format)
 		if err != nil {
 			log.WithError(err).Error("exchange.CalculateSkyMDLValue failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
-		mdlPerSKY, err := droplet.ToString(dropletsPerSKY)
+		_, effectiveMDLPerSKY, err := effectiveRateDroplets(s.cfg.MDLExchanger, scanner.CoinTypeSKY, calculateSKY, precision, format)
 		if err != nil {
-			log.WithError(err).Error("droplet.ToString failed dropletsPerSKY")
+			log.WithError(err).Error("effectiveRateDroplets failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
 
-		rate = s.cfg.MDLExchanger.MDLWavesExchangeRate
-		dropletsPerWAVES, err := exchange.CalculateWavesMDLValue(exchange.DropletsPerWAVES, rate, maxDecimals)
+		calculateWAVES := func(rate string) (uint64, error) {
+			return exchange.CalculateWavesMDLValue(exchange.WaveletsPerWAVES, rate, maxDecimals)
+		}
+		dropletsPerWAVES, mdlPerWAVES, err := rateDroplets(calculateWAVES, s.cfg.MDLExchanger.MDLWavesExchangeRate, precision, format)
 		if err != nil {
 			log.WithError(err).Error("exchange.CalculateWavesMDLValue failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
-		mdlPerWAVES, err := droplet.ToString(dropletsPerWAVES)
+		_, effectiveMDLPerWAVES, err := effectiveRateDroplets(s.cfg.MDLExchanger, scanner.CoinTypeWAVES, calculateWAVES, precision, format)
 		if err != nil {
-			log.WithError(err).Error("droplet.ToString failed CalculateWavesMDLValue")
+			log.WithError(err).Error("effectiveRateDroplets failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
 
-		rate = s.cfg.MDLExchanger.MDLWavesMDLExchangeRate
-		dropletsPerWAVESMDL, err := exchange.CalculateWavesMDLValue(exchange.DropletsPerWAVES, rate, maxDecimals)
+		calculateWAVESMDL := func(rate string) (uint64, error) {
+			return exchange.CalculateWavesMDLValue(exchange.WaveletsPerWAVES, rate, maxDecimals)
+		}
+		dropletsPerWAVESMDL, mdlPerWAVESMDL, err := rateDroplets(calculateWAVESMDL, s.cfg.MDLExchanger.MDLWavesMDLExchangeRate, precision, format)
 		if err != nil {
 			log.WithError(err).Error("exchange.CalculateWavesMDLValue failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
-		mdlPerWAVESMDL, err := droplet.ToString(dropletsPerWAVESMDL)
+		_, effectiveMDLPerWAVESMDL, err := effectiveRateDroplets(s.cfg.MDLExchanger, scanner.CoinTypeWAVESMDL, calculateWAVESMDL, precision, format)
 		if err != nil {
-			log.WithError(err).Error("droplet.ToString failed CalculateWavesMDLValue")
+			log.WithError(err).Error("effectiveRateDroplets failed")
 			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
 			return
 		}
 
-		supportedCrypto := []config.SupportedCrypto{
-			{
+		minDeposits, err := minDepositsForPayout(s.cfg.MDLExchanger)
+		if err != nil {
+			log.WithError(err).Warn("minDepositsForPayout failed")
+		}
+
+		supportedCrypto := s.supportedCrypto()
+
+		deprecations, err := s.exchanger.GetCoinDeprecations()
+		if err != nil {
+			log.WithError(err).Warn("exchanger.GetCoinDeprecations failed")
+		}
+
+		balance := Amount{
+			Number: s.cfg.Web.AvailableAsNumber,
+		}
+		// A balance that can't be read, e.g. the node is down, is told apart from an empty wallet
+		balanceAvailable := false
+		if b, err := s.exchanger.Balance(); err != nil {
+			log.WithError(err).Warn("exchanger.Balance failed")
+			balance.Null = s.cfg.Web.AvailableNullOnError
+		} else {
+			balance.Droplets = b.Confirmed.Coins
+			balanceAvailable = true
+		}
+
+		if err := httputil.JSONResponse(w, ConfigResponse{
+			Enabled:                  s.cfg.Teller.BindEnabled && !s.cfg.ReadOnly,
+			AndroidEnabled:           s.cfg.Teller.AndroidEnabled,
+			Available:                balance,
+			BalanceAvailable:         balanceAvailable,
+			BtcConfirmationsRequired: s.cfg.BtcScanner.ConfirmationsRequired,
+			EthConfirmationsRequired: s.cfg.EthScanner.ConfirmationsRequired,
+
+			MDLBtcExchangeRate:      mdlPerBTC,
+			MDLEthExchangeRate:      mdlPerETH,
+			MDLSkyExchangeRate:      mdlPerSKY,
+			MDLWavesExchangeRate:    mdlPerWAVES,
+			MDLWavesMDLExchangeRate: mdlPerWAVESMDL,
+
+			MDLBtcExchangeRateDroplets:      dropletsPerBTC,
+			MDLEthExchangeRateDroplets:      dropletsPerETH,
+			MDLSkyExchangeRateDroplets:      dropletsPerSKY,
+			MDLWavesExchangeRateDroplets:    dropletsPerWAVES,
+			MDLWavesMDLExchangeRateDroplets: dropletsPerWAVESMDL,
+
+			MDLBtcEffectiveExchangeRate:      effectiveMDLPerBTC,
+			MDLEthEffectiveExchangeRate:      effectiveMDLPerETH,
+			MDLSkyEffectiveExchangeRate:      effectiveMDLPerSKY,
+			MDLWavesEffectiveExchangeRate:    effectiveMDLPerWAVES,
+			MDLWavesMDLEffectiveExchangeRate: effectiveMDLPerWAVESMDL,
+
+			MaxDecimals:              maxDecimals,
+			MaxBoundAddresses:        s.cfg.Teller.MaxBoundAddresses,
+			MaxBoundAddressesPerCoin: s.cfg.Teller.MaxBoundAddressesPerCoin,
+			Supported:                supportedCrypto,
+
+			MinDepositForPayout: minDeposits,
+
+			CoinDeprecations: deprecations,
+
+			SuggestedNetworkFee: s.fees.get(),
+		}); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// minDepositsForPayout returns exchange.MinDepositsForPayout as amounts of each coin
+func minDepositsForPayout(cfg config.MDLExchanger) (map[string]string, error) {
+	minDeposits, err := exchange.MinDepositsForPayout(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := make(map[string]string, len(minDeposits))
+	for coinType, minDeposit := range minDeposits {
+		amount, err := exchange.DepositValueToDecimal(coinType, minDeposit)
+		if err != nil {
+			return nil, err
+		}
+		amounts[coinType] = amount.String()
+	}
+
+	return amounts, nil
+}
+
+// supportedCrypto returns the configured coins, used to build the list of supported coins in the UI
+func (s *HTTPServer) supportedCrypto() []config.SupportedCrypto {
+	coins := []struct {
+		coinType string
+		config.SupportedCrypto
+	}{
+		{
+			scanner.CoinTypeBTC,
+			config.SupportedCrypto{
 				Name:            s.cfg.MDLExchanger.MDLBtcExchangeName,
 				ExchangeRate:    s.cfg.MDLExchanger.MDLBtcExchangeRate,
 				ExchangeRateUSD: s.cfg.MDLExchanger.MDLBtcExchangeRateUSD,
 				Label:           s.cfg.MDLExchanger.MDLBtcExchangeLabel,
 				Enabled:         s.cfg.MDLExchanger.MDLBtcExchangeEnabled,
+				RateTiers:       s.cfg.MDLExchanger.MDLBtcExchangeRateTiers,
 			},
-			{
+		},
+		{
+			scanner.CoinTypeETH,
+			config.SupportedCrypto{
 				Name:            s.cfg.MDLExchanger.MDLEthExchangeName,
 				ExchangeRate:    s.cfg.MDLExchanger.MDLEthExchangeRate,
 				ExchangeRateUSD: s.cfg.MDLExchanger.MDLEthExchangeRateUSD,
 				Label:           s.cfg.MDLExchanger.MDLEthExchangeLabel,
 				Enabled:         s.cfg.MDLExchanger.MDLEthExchangeEnabled,
+				RateTiers:       s.cfg.MDLExchanger.MDLEthExchangeRateTiers,
 			},
-			{
+		},
+		{
+			scanner.CoinTypeSKY,
+			config.SupportedCrypto{
 				Name:            s.cfg.MDLExchanger.MDLSkyExchangeName,
 				ExchangeRate:    s.cfg.MDLExchanger.MDLSkyExchangeRate,
 				ExchangeRateUSD: s.cfg.MDLExchanger.MDLSkyExchangeRateUSD,
 				Label:           s.cfg.MDLExchanger.MDLSkyExchangeLabel,
 				Enabled:         s.cfg.MDLExchanger.MDLSkyExchangeEnabled,
+				RateTiers:       s.cfg.MDLExchanger.MDLSkyExchangeRateTiers,
 			},
-			{
+		},
+		{
+			scanner.CoinTypeWAVES,
+			config.SupportedCrypto{
 				Name:            s.cfg.MDLExchanger.MDLWavesExchangeName,
 				ExchangeRate:    s.cfg.MDLExchanger.MDLWavesExchangeRate,
 				ExchangeRateUSD: s.cfg.MDLExchanger.MDLWavesExchangeRateUSD,
 				Label:           s.cfg.MDLExchanger.MDLWavesExchangeLabel,
 				Enabled:         s.cfg.MDLExchanger.MDLWavesExchangeEnabled,
+				RateTiers:       s.cfg.MDLExchanger.MDLWavesExchangeRateTiers,
 			},
-			{
+		},
+		{
+			scanner.CoinTypeWAVESMDL,
+			config.SupportedCrypto{
 				Name:            s.cfg.MDLExchanger.MDLWavesMDLExchangeName,
 				ExchangeRate:    s.cfg.MDLExchanger.MDLWavesMDLExchangeRate,
 				ExchangeRateUSD: s.cfg.MDLExchanger.MDLWavesMDLExchangeRateUSD,
 				Label:           s.cfg.MDLExchanger.MDLWavesMDLExchangeLabel,
 				Enabled:         s.cfg.MDLExchanger.MDLWavesMDLExchangeEnabled,
+				RateTiers:       s.cfg.MDLExchanger.MDLWavesMDLExchangeRateTiers,
 			},
+		},
+	}
+
+	supported := make([]config.SupportedCrypto, 0, len(coins))
+	for _, c := range coins {
+		c.ExchangeRateUSD, c.RateStale = s.usdRate(c.coinType, c.ExchangeRateUSD)
+		c.ExchangeRateDecimal = decimalRate(c.ExchangeRate)
+		supported = append(supported, c.SupportedCrypto)
+	}
+
+	return featuredFirst(supported, s.cfg.MDLExchanger.Featured)
+}
+
+// decimalRate returns an exchange rate as a decimal string, e.g. "0.5" for "1/2".
+// Returns an empty string if the rate is not set or invalid
+func decimalRate(rate string) string {
+	if rate == "" {
+		return ""
+	}
+
+	r, err := mathutil.ParseRate(rate)
+	if err != nil {
+		return ""
+	}
+
+	return r.String()
+}
+
+// usdRate returns the USD rate of coinType from the USD rate feed, if it is fresh.
+// Otherwise fallback is returned, and stale is true if the feed's rate is unavailable or too old.
+// Without a feed, fallback is the coin's USD rate and is never stale
+func (s *HTTPServer) usdRate(coinType, fallback string) (rate string, stale bool) {
+	if s.usdRates == nil {
+		return fallback, false
+	}
+
+	rate, updated, err := s.usdRates.USDRate(coinType)
+	if err != nil {
+		s.log.WithError(err).WithField("coinType", coinType).Warn("USDRate failed, using the fallback rate")
+		return fallback, true
+	}
+
+	maxAge := s.cfg.MDLExchanger.USDRateMaxAge
+	if maxAge > 0 && time.Since(updated) > maxAge {
+		return fallback, true
+	}
+
+	return rate, false
+}
+
+// featuredFirst moves the featured coins to the front of the list, in the order they are featured,
+// and flags them as featured. The other coins keep their order
+func featuredFirst(coins []config.SupportedCrypto, featured []string) []config.SupportedCrypto {
+	if len(featured) == 0 {
+		return coins
+	}
+
+	ordered := make([]config.SupportedCrypto, 0, len(coins))
+	isFeatured := make(map[string]bool, len(featured))
+	for _, name := range featured {
+		for _, c := range coins {
+			if c.Name == name && !isFeatured[name] {
+				c.Featured = true
+				ordered = append(ordered, c)
+				isFeatured[name] = true
+			}
 		}
+	}
 
-		balance := 0.0
-		if b, err := s.exchanger.Balance(); err == nil {
-			balance = float64(b.Confirmed.Coins)
+	for _, c := range coins {
+		if !isFeatured[c.Name] {
+			ordered = append(ordered, c)
 		}
-		if err := httputil.JSONResponse(w, ConfigResponse{
-			Enabled:                  s.cfg.Teller.BindEnabled,
-			AndroidEnabled:           s.cfg.Teller.AndroidEnabled,
-			Available:                balance,
-			BtcConfirmationsRequired: s.cfg.BtcScanner.ConfirmationsRequired,
-			EthConfirmationsRequired: s.cfg.EthScanner.ConfirmationsRequired,
+	}
 
-			MDLBtcExchangeRate:      mdlPerBTC,
-			MDLEthExchangeRate:      mdlPerETH,
-			MDLSkyExchangeRate:      mdlPerSKY,
-			MDLWavesExchangeRate:    mdlPerWAVES,
-			MDLWavesMDLExchangeRate: mdlPerWAVESMDL,
+	return ordered
+}
+
+// LabelsResponse http response for /api/labels
+type LabelsResponse struct {
+	Lang     string            `json:"lang"`
+	Coins    map[string]string `json:"coins"`
+	Statuses map[string]string `json:"statuses"`
+}
+
+// LabelsHandler returns the translations of the supported coin labels and the deposit status messages.
+// Coins is keyed by the labels in the supported list of /api/config.
+// Missing translations fall back to English.
+// Method: GET
+// URI: /api/labels
+// Args:
+//     lang - Optional, language code, e.g. "ru". Defaults to "en"
+func LabelsHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		lang, bundle := i18n.Lookup(r.FormValue("lang"))
+
+		coins := make(map[string]string)
+		for _, c := range s.supportedCrypto() {
+			if c.Label == "" {
+				continue
+			}
+			coins[c.Label] = bundle.CoinLabel(c.Label)
+		}
+
+		if err := httputil.JSONResponse(w, LabelsResponse{
+			Lang:     lang,
+			Coins:    coins,
+			Statuses: bundle.Statuses,
+		}); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// validEmail returns true if email is a plain email address, e.g. "user@example.com", without a display name
+func validEmail(email string) bool {
+	if len(email) > maxEmailLength {
+		return false
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return false
+	}
+
+	return addr.Name == "" && addr.Address == email
+}
+
+type notificationsOptOutRequest struct {
+	Email string `json:"email"`
+}
+
+// NotificationsOptOutResponse is the response of /api/notifications/opt-out
+type NotificationsOptOutResponse struct {
+	Email string `json:"email"`
+}
+
+// NotificationsOptOutHandler stops the notifications to an email address given when binding, for all its deposits.
+// Only served if email.user_notifications is enabled
+// Method: POST
+// Accept: application/json
+// URI: /api/notifications/opt-out
+// Args:
+//    {"email": "..."}
+func NotificationsOptOutHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		w.Header().Set("Accept", "application/json")
+
+		if !validMethod(ctx, w, r, []string{http.MethodPost}) {
+			return
+		}
+
+		if s.cfg.ReadOnly {
+			errorResponse(ctx, w, http.StatusServiceUnavailable, ErrReadOnly)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			errorResponse(ctx, w, http.StatusUnsupportedMediaType, errors.New("Invalid content type"))
+			return
+		}
+
+		maxRequestBytes := s.cfg.Web.MaxRequestBytes
+		if maxRequestBytes <= 0 {
+			maxRequestBytes = defaultMaxRequestBytes
+		}
+
+		req := &notificationsOptOutRequest{}
+		if code, err := httputil.DecodeJSONBody(w, r, maxRequestBytes, req); err != nil {
+			errorResponse(ctx, w, code, err)
+			return
+		}
+
+		req.Email = strings.Trim(req.Email, "\n\t ")
+		if !validEmail(req.Email) {
+			errorResponse(ctx, w, http.StatusBadRequest, errors.New("Invalid email address"))
+			return
+		}
+
+		if err := s.exchanger.OptOutContactEmail(req.Email); err != nil {
+			log.WithError(err).Error("exchanger.OptOutContactEmail failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		if err := httputil.JSONResponse(w, NotificationsOptOutResponse{
+			Email: req.Email,
+		}); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// heightsCache caches the scanner heights, so that /api/heights does not query the nodes on every request
+type heightsCache struct {
+	heights ScannerHeights
+	ttl     time.Duration
+	now     func() time.Time
+
+	lock      sync.Mutex
+	cached    []scanner.CoinHeights
+	fetchedAt time.Time
+}
+
+func newHeightsCache(heights ScannerHeights, ttl time.Duration) *heightsCache {
+	return &heightsCache{
+		heights: heights,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// get returns the cached heights, fetching them again if they are older than the ttl
+func (c *heightsCache) get() []scanner.CoinHeights {
+	if c == nil || c.heights == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	if c.cached == nil || now.Sub(c.fetchedAt) >= c.ttl {
+		c.cached = c.heights.Heights()
+		c.fetchedAt = now
+	}
+
+	return c.cached
+}
+
+// feesCache caches the suggested network fees, so that /api/config does not query the nodes on every request
+type feesCache struct {
+	fees NetworkFees
+	ttl  time.Duration
+	now  func() time.Time
+
+	lock      sync.Mutex
+	cached    map[string]NetworkFee
+	fetchedAt time.Time
+}
+
+func newFeesCache(fees NetworkFees, ttl time.Duration) *feesCache {
+	return &feesCache{
+		fees: fees,
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+// get returns the cached fees, fetching them again if they are older than the ttl
+func (c *feesCache) get() map[string]NetworkFee {
+	if c == nil || c.fees == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	if c.cached == nil || now.Sub(c.fetchedAt) >= c.ttl {
+		estimates := c.fees.FeeEstimates()
+		c.cached = make(map[string]NetworkFee, len(estimates))
+		for coinType, fe := range estimates {
+			c.cached[coinType] = NetworkFee{
+				Fee:  fe.Fee,
+				Unit: fe.Unit,
+			}
+		}
+		c.fetchedAt = now
+	}
+
+	return c.cached
+}
+
+// HeightsResponse http response for /api/heights
+type HeightsResponse struct {
+	Heights []CoinHeights `json:"heights"`
+}
+
+// CoinHeights is a scanner's view of its blockchain
+type CoinHeights struct {
+	CoinType       string `json:"coin_type"`
+	ScannedHeight  int64  `json:"scanned_height"`
+	ChainTipHeight int64  `json:"chain_tip_height"`
+	Healthy        bool   `json:"healthy"`
+	Error          string `json:"error,omitempty"`
+}
+
+// HeightsHandler returns the height of the last block scanned and the best block height of the node, per enabled coin,
+// and whether the scanner is healthy, i.e. its stall_timeout watchdog has not seen the best height stop advancing.
+// The heights are cached for a few seconds
+// Method: GET
+// URI: /api/heights
+func HeightsHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		heights := []CoinHeights{}
+		for _, h := range s.heights.get() {
+			ch := CoinHeights{
+				CoinType:       h.CoinType,
+				ScannedHeight:  h.ScannedHeight,
+				ChainTipHeight: h.ChainTipHeight,
+				Healthy:        h.Healthy,
+			}
+			if h.Err != nil {
+				ch.Error = h.Err.Error()
+			}
+			heights = append(heights, ch)
+		}
+
+		if err := httputil.JSONResponse(w, HeightsResponse{
+			Heights: heights,
+		}); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// maxPingNonceLen is the max length of the nonce echoed by /api/ping
+const maxPingNonceLen = 64
+
+// PingResponse http response for /api/ping
+type PingResponse struct {
+	Pong       bool   `json:"pong"`
+	ServerTime int64  `json:"server_time"`
+	Nonce      string `json:"nonce,omitempty"`
+}
+
+// PingHandler responds immediately, for clients to check that teller can be reached and measure the latency.
+// The optional nonce query param, up to 64 characters, is echoed back so that a client can match responses to requests
+// Method: GET
+// URI: /api/ping
+// Args:
+//     nonce [optional]
+func PingHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		nonce := r.URL.Query().Get("nonce")
+		if len(nonce) > maxPingNonceLen {
+			errorResponse(ctx, w, http.StatusBadRequest, fmt.Errorf("nonce is longer than %d characters", maxPingNonceLen))
+			return
+		}
 
-			MaxDecimals:       maxDecimals,
-			MaxBoundAddresses: s.cfg.Teller.MaxBoundAddresses,
-			Supported:         supportedCrypto,
+		if err := httputil.JSONResponse(w, PingResponse{
+			Pong:       true,
+			ServerTime: time.Now().UTC().Unix(),
+			Nonce:      nonce,
 		}); err != nil {
 			log.WithError(err).Error(err)
 		}
 	}
 }
 
+// SupportedResponse http response for /api/supported
+type SupportedResponse struct {
+	Coins []SupportedCoin `json:"coins"`
+}
+
+// SupportedCoin is whether a coin type can currently be bound, and if not, why
+type SupportedCoin struct {
+	CoinType    string `json:"coin_type"`
+	Bindable    bool   `json:"bindable"`
+	ReasonIfNot string `json:"reason_if_not,omitempty"`
+
+	// The deprecation state of the coin type, omitted if it is not deprecated
+	Deprecation *exchange.CoinDeprecation `json:"deprecation,omitempty"`
+}
+
+// SupportedHandler returns whether a deposit address of each coin type can currently be bound.
+// A coin type can't be bound if binding is disabled or read-only, the coin type or its exchange is disabled,
+// its node is unavailable, it is deprecated or it has no deposit addresses left
+// Method: GET
+// URI: /api/supported
+func SupportedHandler(s *HTTPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logger.FromContext(ctx)
+
+		if !validMethod(ctx, w, r, []string{http.MethodGet}) {
+			return
+		}
+
+		nodeErrs := make(map[string]error)
+		for _, h := range s.heights.get() {
+			nodeErrs[h.CoinType] = h.Err
+		}
+
+		deprecations, err := s.exchanger.GetCoinDeprecations()
+		if err != nil {
+			log.WithError(err).Error("exchanger.GetCoinDeprecations failed")
+			errorResponse(ctx, w, http.StatusInternalServerError, errInternalServerError)
+			return
+		}
+
+		coins := []SupportedCoin{}
+		for _, coinType := range scanner.GetCoinTypes() {
+			c := SupportedCoin{
+				CoinType: coinType,
+				Bindable: true,
+			}
+
+			if d, ok := deprecations[coinType]; ok {
+				c.Deprecation = &d
+			}
+
+			if err := s.checkBindable(coinType, nodeErrs[coinType]); err != nil {
+				c.Bindable = false
+				c.ReasonIfNot = err.Error()
+			}
+
+			coins = append(coins, c)
+		}
+
+		if err := httputil.JSONResponse(w, SupportedResponse{
+			Coins: coins,
+		}); err != nil {
+			log.WithError(err).Error(err)
+		}
+	}
+}
+
+// checkScannerRunning returns an error if no scanner of coinType is running.
+// Nothing is checked if no RunningScanners are attached
+func (s *HTTPServer) checkScannerRunning(coinType string) error {
+	if s.scanners == nil {
+		return nil
+	}
+
+	return s.scanners.ValidateCoinType(coinType)
+}
+
+// checkBindable returns the reason a deposit address of coinType can't currently be bound, or nil if it can.
+// nodeErr is the error of the coin type's scanner reaching its node, if any
+func (s *HTTPServer) checkBindable(coinType string, nodeErr error) error {
+	if s.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+
+	var coinEnabled, exchangeEnabled bool
+	switch coinType {
+	case scanner.CoinTypeBTC:
+		coinEnabled = s.cfg.BtcRPC.Enabled
+		exchangeEnabled = s.cfg.MDLExchanger.MDLBtcExchangeEnabled
+	case scanner.CoinTypeETH:
+		coinEnabled = s.cfg.EthRPC.Enabled
+		exchangeEnabled = s.cfg.MDLExchanger.MDLEthExchangeEnabled
+	case scanner.CoinTypeSKY:
+		coinEnabled = s.cfg.SkyRPC.Enabled
+		exchangeEnabled = s.cfg.MDLExchanger.MDLSkyExchangeEnabled
+	case scanner.CoinTypeWAVES:
+		coinEnabled = s.cfg.WavesRPC.Enabled
+		exchangeEnabled = s.cfg.MDLExchanger.MDLWavesExchangeEnabled
+	case scanner.CoinTypeWAVESMDL:
+		coinEnabled = s.cfg.WavesMDLRPC.Enabled
+		exchangeEnabled = s.cfg.MDLExchanger.MDLWavesMDLExchangeEnabled
+	default:
+		return scanner.ErrUnsupportedCoinType
+	}
+
+	if !coinEnabled {
+		return errors.New(s.cfg.Teller.FormatCoinDisabledMessage(coinType))
+	}
+
+	if err := s.checkScannerRunning(coinType); err != nil {
+		return errors.New(s.cfg.Teller.FormatNoScannerMessage(coinType))
+	}
+
+	if !exchangeEnabled {
+		return ErrExchangeDisabled
+	}
+
+	if nodeErr != nil {
+		return ErrNodeUnavailable
+	}
+
+	return s.service.CheckBindable(coinType)
+}
+
 // ExchangeStatusResponse http response for /api/exchange-status
 type ExchangeStatusResponse struct {
 	Error   string                        `json:"error"`
 	Balance ExchangeStatusResponseBalance `json:"balance"`
+
+	// State of the mdl sender's circuit breaker, omitted if it is disabled
+	SenderBreaker sender.BreakerState `json:"sender_breaker,omitempty"`
 }
 
 // ExchangeStatusResponseBalance is the balance field of ExchangeStatusResponse
 type ExchangeStatusResponseBalance struct {
 	Coins string `json:"coins"`
 	Hours string `json:"hours"`
+	// Coin hours that payouts never spend, see mdl_exchanger.min_reserved_hours
+	ReservedHours string `json:"reserved_hours"`
 }
 
 // ExchangeStatusHandler returns the status of the exchanger
@@ -725,27 +1911,34 @@ func ExchangeStatusHandler(s *HTTPServer) http.HandlerFunc {
 		case sender.APIError:
 			errorMsg = err.Error()
 		default:
+			// Payouts are queued while they would spend the reserved coin hours
+			if err == exchange.ErrHoursReserve {
+				errorMsg = err.Error()
+			}
 		}
 
 
 		// Get the wallet balance, but ignore any error. If an error occurs,
 		// return a balance of 0
+		precision := s.cfg.Web.MDLDisplayPrecision()
 		bal, err := s.exchanger.Balance()
-		coins := "0.000000"
+		coins, _ := mathutil.FormatDroplets(0, precision)
 		hours := "0"
 		if err != nil {
 			log.WithError(err).Error("s.exchange.Balance failed")
 		} else {
-			coins, _ = droplet.ToString(bal.Confirmed.Coins)
+			coins, _ = mathutil.FormatDroplets(bal.Confirmed.Coins, precision)
 			hours = fmt.Sprint(bal.Confirmed.Hours)
 		}
 
 		resp := ExchangeStatusResponse{
 			Error: errorMsg,
 			Balance: ExchangeStatusResponseBalance{
-				Coins: coins,
-				Hours: hours,
+				Coins:         coins,
+				Hours:         hours,
+				ReservedHours: fmt.Sprint(s.cfg.MDLExchanger.MinReservedHours),
 			},
+			SenderBreaker: s.exchanger.BreakerState(),
 		}
 
 		log.WithField("resp", resp).Info()
@@ -771,12 +1964,24 @@ func validMethod(ctx context.Context, w http.ResponseWriter, r *http.Request, al
 	return false
 }
 
-func verifyMDLAddress(ctx context.Context, w http.ResponseWriter, mdlAddr string) bool {
+// verifyMDLAddress responds with 400 and returns false if mdlAddr is not a valid mdl address.
+// An address not matching the MDL format of teller.address_formats is rejected before it is decoded
+func (s *HTTPServer) verifyMDLAddress(ctx context.Context, w http.ResponseWriter, mdlAddr string) bool {
 	log := logger.FromContext(ctx)
 
+	if s.mdlAddrFormat != nil && !s.mdlAddrFormat.MatchString(mdlAddr) {
+		err := addrs.ErrAddressFormat
+		httputil.ErrResponseContext(ctx, w, http.StatusBadRequest, fmt.Sprintf("Invalid mdl address: %v", err))
+		log.WithFields(logrus.Fields{
+			"status":  http.StatusBadRequest,
+			"mdlAddr": mdlAddr,
+		}).WithError(err).Info("Invalid mdl address")
+		return false
+	}
+
 	if _, err := cipher.DecodeBase58Address(mdlAddr); err != nil {
 		msg := fmt.Sprintf("Invalid mdl address: %v", err)
-		httputil.ErrResponse(w, http.StatusBadRequest, msg)
+		httputil.ErrResponseContext(ctx, w, http.StatusBadRequest, msg)
 		log.WithFields(logrus.Fields{
 			"status":  http.StatusBadRequest,
 			"mdlAddr": mdlAddr,
@@ -795,8 +2000,8 @@ func errorResponse(ctx context.Context, w http.ResponseWriter, code int, err err
 	}).WithError(err).Info()
 
 	if err != errInternalServerError {
-		httputil.ErrResponse(w, code, err.Error())
+		httputil.ErrResponseContext(ctx, w, code, err.Error())
 	} else {
-		httputil.ErrResponse(w, code)
+		httputil.ErrResponseContext(ctx, w, code)
 	}
 }
@@ -1,33 +1,51 @@
 package teller
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
 	"github.com/MDLlife/MDL/src/cli"
+	"github.com/MDLlife/MDL/src/readable"
 
 	"bytes"
 
+	"github.com/MDLlife/teller/src/addrs"
 	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/events"
 	"github.com/MDLlife/teller/src/exchange"
+	"github.com/MDLlife/teller/src/i18n"
 	"github.com/MDLlife/teller/src/scanner"
 	"github.com/MDLlife/teller/src/sender"
+	"github.com/MDLlife/teller/src/util/httputil"
 	"github.com/MDLlife/teller/src/util/testutil"
 )
 
 type fakeExchanger struct {
 	mock.Mock
+
+	breakerState sender.BreakerState
+	deprecations map[string]exchange.CoinDeprecation
 }
 
-func (e *fakeExchanger) BindAddress(mdlAddr, depositAddr, coinType string) (*exchange.BoundAddress, error) {
-	args := e.Called(mdlAddr, depositAddr, coinType)
+func (e *fakeExchanger) BindAddress(ctx context.Context, mdlAddr, depositAddr, coinType string, opts exchange.BindOptions) (*exchange.BoundAddress, error) {
+	args := e.Called(mdlAddr, depositAddr, coinType, opts)
 
 	ba := args.Get(0)
 	if ba == nil {
@@ -52,16 +70,39 @@ func (e *fakeExchanger) GetBindNum(mdlAddr string) (int, error) {
 	return args.Int(0), args.Error(1)
 }
 
+func (e *fakeExchanger) GetCoinBindNum(mdlAddr, coinType string) (int, error) {
+	args := e.Called(mdlAddr, coinType)
+	return args.Int(0), args.Error(1)
+}
+
+func (e *fakeExchanger) GetLastBindTime(mdlAddr string) (int64, error) {
+	args := e.Called(mdlAddr)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (e *fakeExchanger) GetCoinDeprecations() (map[string]exchange.CoinDeprecation, error) {
+	return e.deprecations, nil
+}
+
 func (e *fakeExchanger) GetDepositStats() (*exchange.DepositStats, error) {
 	args := e.Called()
 	return args.Get(0).(*exchange.DepositStats), args.Error(1)
 }
 
+func (e *fakeExchanger) OptOutContactEmail(email string) error {
+	args := e.Called(email)
+	return args.Error(0)
+}
+
 func (e *fakeExchanger) Status() error {
 	args := e.Called()
 	return args.Error(0)
 }
 
+func (e *fakeExchanger) BreakerState() sender.BreakerState {
+	return e.breakerState
+}
+
 func (e *fakeExchanger) Balance() (*cli.Balance, error) {
 	args := e.Called()
 
@@ -201,8 +242,9 @@ func TestExchangeStatusHandler(t *testing.T) {
 			require.Equal(t, ExchangeStatusResponse{
 				Error: tc.errorMsg,
 				Balance: ExchangeStatusResponseBalance{
-					Coins: tc.balance.Coins,
-					Hours: tc.balance.Hours,
+					Coins:         tc.balance.Coins,
+					Hours:         tc.balance.Hours,
+					ReservedHours: "0",
 				},
 			}, msg)
 		})
@@ -210,6 +252,123 @@ func TestExchangeStatusHandler(t *testing.T) {
 
 }
 
+func TestExchangeStatusHandlerHoursReserve(t *testing.T) {
+	e := &fakeExchanger{}
+	e.On("Status").Return(exchange.ErrHoursReserve)
+	e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+	req, err := http.NewRequest(http.MethodGet, "/api/exchange-status", nil)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+
+	rr := httptest.NewRecorder()
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			MDLExchanger: config.MDLExchanger{
+				MinReservedHours: 1000,
+			},
+		},
+		log:       log,
+		exchanger: e,
+	}
+	handler := httpServ.setupMux()
+
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var msg ExchangeStatusResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &msg)
+	require.NoError(t, err)
+	require.Equal(t, exchange.ErrHoursReserve.Error(), msg.Error)
+	require.Equal(t, "1000", msg.Balance.ReservedHours)
+}
+
+func TestExchangeStatusHandlerSenderBreaker(t *testing.T) {
+	for _, state := range []sender.BreakerState{"", sender.BreakerClosed, sender.BreakerOpen, sender.BreakerHalfOpen} {
+		t.Run(string(state), func(t *testing.T) {
+			e := &fakeExchanger{
+				breakerState: state,
+			}
+			e.On("Status").Return(sender.ErrBreakerOpen)
+			e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+			req, err := http.NewRequest(http.MethodGet, "/api/exchange-status", nil)
+			require.NoError(t, err)
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				log:       log,
+				exchanger: e,
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var msg ExchangeStatusResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &msg)
+			require.NoError(t, err)
+			require.Equal(t, state, msg.SenderBreaker)
+			require.Equal(t, sender.ErrBreakerOpen.Error(), msg.Error)
+
+			if state == "" {
+				require.NotContains(t, rr.Body.String(), "sender_breaker")
+			}
+		})
+	}
+}
+
+func TestRecoverHandler(t *testing.T) {
+	// The fakeExchanger panics because Status has no expectation set
+	e := &fakeExchanger{}
+
+	req, err := http.NewRequest(http.MethodGet, "/api/exchange-status", nil)
+	require.NoError(t, err)
+
+	log, hook := testutil.NewLogger(t)
+
+	rr := httptest.NewRecorder()
+	httpServ := &HTTPServer{
+		log:       log,
+		exchanger: e,
+	}
+	handler := httpServ.setupMux()
+
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.Equal(t, "Internal Server Error", strings.TrimSpace(rr.Body.String()))
+	requestID := rr.Header().Get("X-Request-ID")
+	require.NotEmpty(t, requestID)
+
+	// The panic is logged with the stack and the request ID
+	var entry *logrus.Entry
+	for _, le := range hook.AllEntries() {
+		if le.Message == "HTTP handler panicked" {
+			entry = le
+		}
+	}
+	require.NotNil(t, entry)
+	require.Equal(t, logrus.ErrorLevel, entry.Level)
+	require.Equal(t, requestID, entry.Data["requestID"])
+	require.NotEmpty(t, entry.Data["panic"])
+	require.Contains(t, entry.Data["stack"], "goroutine")
+	require.NotContains(t, rr.Body.String(), "goroutine")
+
+	// The server keeps handling requests
+	e.On("Status").Return(nil)
+	e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+}
+
 func TestExchangeBindHandler(t *testing.T) {
 
 	tt := []struct {
@@ -336,3 +495,4334 @@ func TestExchangeBindHandler(t *testing.T) {
 	}
 
 }
+
+func TestBindHandlerMaxRequestBytes(t *testing.T) {
+	tt := []struct {
+		name   string
+		body   []byte
+		status int
+		err    string
+	}{
+		{
+			"413 body larger than web.max_request_bytes",
+			[]byte(`{"mdladdr":"2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT","coin_type":"SKY","padding":"` + strings.Repeat("x", 256) + `"}`),
+			http.StatusRequestEntityTooLarge,
+			"Request body too large",
+		},
+		{
+			"403 body within web.max_request_bytes",
+			[]byte(`{"mdladdr":"2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT","coin_type":"SKY"}`),
+			http.StatusForbidden,
+			"Address binding is disabled",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(tc.body))
+			require.NoError(t, err)
+
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+					Web: config.Web{
+						MaxRequestBytes: 128,
+					},
+				},
+				log:       log,
+				exchanger: &fakeExchanger{},
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: false,
+					},
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+			require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+		})
+	}
+}
+
+func TestBindHandlerErrorsAsOK(t *testing.T) {
+	tt := []struct {
+		name       string
+		errorsAsOK bool
+		query      string
+		status     int
+		body       string
+	}{
+		{
+			name:   "403 error status code by default",
+			status: http.StatusForbidden,
+			body:   "Address binding is disabled",
+		},
+		{
+			name:   "403 query parameter false",
+			query:  "?errors_as_ok=false",
+			status: http.StatusForbidden,
+			body:   "Address binding is disabled",
+		},
+		{
+			name:   "200 query parameter",
+			query:  "?errors_as_ok=true",
+			status: http.StatusOK,
+			body:   `{"ok":false,"error":"Address binding is disabled"}`,
+		},
+		{
+			name:       "200 web.errors_as_ok",
+			errorsAsOK: true,
+			status:     http.StatusOK,
+			body:       `{"ok":false,"error":"Address binding is disabled"}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			body := []byte(`{"mdladdr":"2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT","coin_type":"SKY"}`)
+			req, err := http.NewRequest(http.MethodPost, "/api/bind"+tc.query, bytes.NewBuffer(body))
+			require.NoError(t, err)
+
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+					Web: config.Web{
+						ErrorsAsOK: tc.errorsAsOK,
+					},
+				},
+				log:       log,
+				exchanger: &fakeExchanger{},
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: false,
+					},
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.body, strings.TrimSpace(rr.Body.String()))
+				return
+			}
+
+			require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			require.JSONEq(t, tc.body, rr.Body.String())
+		})
+	}
+}
+
+func TestConfigHandlerRateFormat(t *testing.T) {
+	tt := []struct {
+		name             string
+		rateFormat       string
+		displayPrecision int
+		url              string
+		status           int
+		err              string
+		btcRate          string
+		ethRate          string
+	}{
+		{
+			name:    "200 fixed by default",
+			url:     "/api/config",
+			status:  http.StatusOK,
+			btcRate: "100.000000",
+			ethRate: "10.500000",
+		},
+		{
+			name:       "200 trim from config",
+			rateFormat: config.RateFormatTrim,
+			url:        "/api/config",
+			status:     http.StatusOK,
+			btcRate:    "100",
+			ethRate:    "10.5",
+		},
+		{
+			name:       "200 fixed query param overrides config",
+			rateFormat: config.RateFormatTrim,
+			url:        "/api/config?format=fixed",
+			status:     http.StatusOK,
+			btcRate:    "100.000000",
+			ethRate:    "10.500000",
+		},
+		{
+			name:    "200 trim query param",
+			url:     "/api/config?format=trim",
+			status:  http.StatusOK,
+			btcRate: "100",
+			ethRate: "10.5",
+		},
+		{
+			name:             "200 reduced display precision",
+			displayPrecision: 2,
+			url:              "/api/config",
+			status:           http.StatusOK,
+			btcRate:          "100.00",
+			ethRate:          "10.50",
+		},
+		{
+			name:             "200 reduced display precision trimmed",
+			displayPrecision: 2,
+			url:              "/api/config?format=trim",
+			status:           http.StatusOK,
+			btcRate:          "100",
+			ethRate:          "10.5",
+		},
+		{
+			name:             "200 one decimal place",
+			displayPrecision: 1,
+			url:              "/api/config",
+			status:           http.StatusOK,
+			btcRate:          "100.0",
+			ethRate:          "10.5",
+		},
+		{
+			name:   "400 invalid format",
+			url:    "/api/config?format=foo",
+			status: http.StatusBadRequest,
+			err:    "Invalid rate format",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			require.NoError(t, err)
+
+			log, _ := testutil.NewLogger(t)
+
+			e := &fakeExchanger{}
+			e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					MDLExchanger: config.MDLExchanger{
+						MDLBtcExchangeRate:      "100",
+						MDLEthExchangeRate:      "10.5",
+						MDLSkyExchangeRate:      "1",
+						MDLWavesExchangeRate:    "1",
+						MDLWavesMDLExchangeRate: "1",
+						MaxDecimals:             6,
+					},
+					Web: config.Web{
+						RateFormat:       tc.rateFormat,
+						DisplayPrecision: tc.displayPrecision,
+					},
+				},
+				log:       log,
+				exchanger: e,
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				return
+			}
+
+			var rsp ConfigResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.btcRate, rsp.MDLBtcExchangeRate)
+			require.Equal(t, tc.ethRate, rsp.MDLEthExchangeRate)
+
+			// Raw droplet values are not affected by the format
+			require.Equal(t, uint64(100e6), rsp.MDLBtcExchangeRateDroplets)
+			require.Equal(t, uint64(10.5e6), rsp.MDLEthExchangeRateDroplets)
+		})
+	}
+}
+
+func TestConfigHandlerAmounts(t *testing.T) {
+	monetaryFields := []string{
+		"available",
+		"mdl_btc_exchange_rate",
+		"mdl_eth_exchange_rate",
+		"mdl_sky_exchange_rate",
+		"mdl_waves_exchange_rate",
+		"mdl_waves_mdl_exchange_rate",
+		"mdl_btc_exchange_rate_droplets",
+		"mdl_eth_exchange_rate_droplets",
+		"mdl_sky_exchange_rate_droplets",
+		"mdl_waves_exchange_rate_droplets",
+		"mdl_waves_mdl_exchange_rate_droplets",
+	}
+
+	tt := []struct {
+		name              string
+		availableAsNumber bool
+	}{
+		{
+			name: "strings",
+		},
+		{
+			name:              "available as number",
+			availableAsNumber: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+
+			e := &fakeExchanger{}
+			e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					MDLExchanger: config.MDLExchanger{
+						MDLBtcExchangeRate:      "100",
+						MDLEthExchangeRate:      "10.5",
+						MDLSkyExchangeRate:      "1",
+						MDLWavesExchangeRate:    "1",
+						MDLWavesMDLExchangeRate: "1",
+						MaxDecimals:             6,
+					},
+					Web: config.Web{
+						AvailableAsNumber: tc.availableAsNumber,
+					},
+				},
+				log:       log,
+				exchanger: e,
+			}
+			handler := httpServ.setupMux()
+
+			req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var fields map[string]interface{}
+			err = json.Unmarshal(rr.Body.Bytes(), &fields)
+			require.NoError(t, err)
+
+			for _, f := range monetaryFields {
+				if f == "available" && tc.availableAsNumber {
+					require.IsType(t, float64(0), fields[f], f)
+					continue
+				}
+				require.IsType(t, "", fields[f], f)
+			}
+
+			require.Equal(t, "100000000", fields["mdl_btc_exchange_rate_droplets"])
+
+			// The response can be decoded either way
+			var rsp ConfigResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+			require.Equal(t, Amount{
+				Number: tc.availableAsNumber,
+			}, rsp.Available)
+			require.Equal(t, uint64(100e6), rsp.MDLBtcExchangeRateDroplets)
+			require.Equal(t, "0.00000001", rsp.MinDepositForPayout[scanner.CoinTypeBTC])
+
+			// 1 WAVES at a rate of 1 is 1 MDL
+			require.Equal(t, "1000000", fields["mdl_waves_exchange_rate_droplets"])
+			require.Equal(t, "1000000", fields["mdl_waves_mdl_exchange_rate_droplets"])
+		})
+	}
+}
+
+type fakeUSDRateFeed struct {
+	rates   map[string]string
+	updated time.Time
+}
+
+func (f fakeUSDRateFeed) USDRate(coinType string) (string, time.Time, error) {
+	rate, ok := f.rates[coinType]
+	if !ok {
+		return "", time.Time{}, errors.New("no rate")
+	}
+	return rate, f.updated, nil
+}
+
+func TestConfigHandlerUSDRateFeed(t *testing.T) {
+	type usdRate struct {
+		rate  string
+		stale bool
+	}
+
+	tt := []struct {
+		name  string
+		feed  USDRateFeed
+		rates map[string]usdRate
+	}{
+		{
+			name: "no feed",
+			rates: map[string]usdRate{
+				"BTC":   {rate: "0.02"},
+				"ETH":   {rate: ""},
+				"WAVES": {rate: "1.5"},
+			},
+		},
+		{
+			name: "fresh",
+			feed: fakeUSDRateFeed{
+				rates: map[string]string{
+					scanner.CoinTypeBTC:   "0.03",
+					scanner.CoinTypeETH:   "0.2",
+					scanner.CoinTypeWAVES: "2",
+				},
+				updated: time.Now(),
+			},
+			rates: map[string]usdRate{
+				"BTC":   {rate: "0.03"},
+				"ETH":   {rate: "0.2"},
+				"WAVES": {rate: "2"},
+			},
+		},
+		{
+			name: "stale with fallback",
+			feed: fakeUSDRateFeed{
+				rates: map[string]string{
+					scanner.CoinTypeBTC:   "0.03",
+					scanner.CoinTypeWAVES: "2",
+				},
+				updated: time.Now().Add(-time.Hour * 2),
+			},
+			rates: map[string]usdRate{
+				"BTC":   {rate: "0.02", stale: true},
+				"WAVES": {rate: "1.5", stale: true},
+			},
+		},
+		{
+			name: "no fallback",
+			feed: fakeUSDRateFeed{
+				rates: map[string]string{
+					scanner.CoinTypeBTC: "0.03",
+				},
+				updated: time.Now(),
+			},
+			rates: map[string]usdRate{
+				"BTC":   {rate: "0.03"},
+				"ETH":   {rate: "", stale: true},
+				"WAVES": {rate: "1.5", stale: true},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+
+			e := &fakeExchanger{}
+			e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					MDLExchanger: config.MDLExchanger{
+						MDLBtcExchangeName:      "BTC",
+						MDLBtcExchangeRate:      "100",
+						MDLBtcExchangeRateUSD:   "0.02",
+						MDLEthExchangeName:      "ETH",
+						MDLEthExchangeRate:      "10.5",
+						MDLSkyExchangeName:      "SKY",
+						MDLSkyExchangeRate:      "1",
+						MDLWavesExchangeName:    "WAVES",
+						MDLWavesExchangeRate:    "1",
+						MDLWavesExchangeRateUSD: "1.5",
+						MDLWavesMDLExchangeName: "MDL.life",
+						MDLWavesMDLExchangeRate: "1",
+						MaxDecimals:             6,
+						USDRateMaxAge:           time.Hour,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				usdRates:  tc.feed,
+			}
+			handler := httpServ.setupMux()
+
+			req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var rsp ConfigResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+
+			rates := make(map[string]usdRate, len(rsp.Supported))
+			for _, c := range rsp.Supported {
+				rates[c.Name] = usdRate{
+					rate:  c.ExchangeRateUSD,
+					stale: c.RateStale,
+				}
+			}
+
+			for name, expected := range tc.rates {
+				require.Equal(t, expected, rates[name], name)
+			}
+		})
+	}
+}
+
+func TestConfigHandlerFeatured(t *testing.T) {
+	tt := []struct {
+		name     string
+		featured []string
+		order    []string
+		flagged  []string
+	}{
+		{
+			name:  "default order",
+			order: []string{"BTC", "ETH", "SKY", "WAVES", "MDL.life"},
+		},
+		{
+			name:     "featured coins first",
+			featured: []string{"MDL.life", "SKY"},
+			order:    []string{"MDL.life", "SKY", "BTC", "ETH", "WAVES"},
+			flagged:  []string{"MDL.life", "SKY"},
+		},
+		{
+			name:     "all coins featured",
+			featured: []string{"WAVES", "ETH", "BTC", "MDL.life", "SKY"},
+			order:    []string{"WAVES", "ETH", "BTC", "MDL.life", "SKY"},
+			flagged:  []string{"WAVES", "ETH", "BTC", "MDL.life", "SKY"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+			require.NoError(t, err)
+
+			log, _ := testutil.NewLogger(t)
+
+			e := &fakeExchanger{}
+			e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					MDLExchanger: config.MDLExchanger{
+						MDLBtcExchangeName:      "BTC",
+						MDLBtcExchangeRate:      "100",
+						MDLEthExchangeName:      "ETH",
+						MDLEthExchangeRate:      "10.5",
+						MDLSkyExchangeName:      "SKY",
+						MDLSkyExchangeRate:      "1",
+						MDLWavesExchangeName:    "WAVES",
+						MDLWavesExchangeRate:    "1",
+						MDLWavesMDLExchangeName: "MDL.life",
+						MDLWavesMDLExchangeRate: "1",
+						MaxDecimals:             6,
+						Featured:                tc.featured,
+					},
+				},
+				log:       log,
+				exchanger: e,
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var rsp ConfigResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+
+			var order, flagged []string
+			for _, c := range rsp.Supported {
+				order = append(order, c.Name)
+				if c.Featured {
+					flagged = append(flagged, c.Name)
+				}
+			}
+
+			require.Equal(t, tc.order, order)
+			require.Equal(t, tc.flagged, flagged)
+		})
+	}
+}
+
+func TestConfigHandlerRateTiers(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+
+	e := &fakeExchanger{}
+	e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+	tiers := []config.RateTier{
+		{MinAmount: "1", Rate: "110"},
+		{MinAmount: "10", Rate: "125"},
+	}
+
+	rr := httptest.NewRecorder()
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			MDLExchanger: config.MDLExchanger{
+				MDLBtcExchangeName:      "BTC",
+				MDLBtcExchangeRate:      "100",
+				MDLBtcExchangeRateTiers: tiers,
+				MDLEthExchangeName:      "ETH",
+				MDLEthExchangeRate:      "10.5",
+				MaxDecimals:             6,
+			},
+		},
+		log:       log,
+		exchanger: e,
+	}
+	httpServ.setupMux().ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var rsp ConfigResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+	require.NoError(t, err)
+
+	require.Equal(t, "BTC", rsp.Supported[0].Name)
+	require.Equal(t, tiers, rsp.Supported[0].RateTiers)
+	require.Equal(t, "ETH", rsp.Supported[1].Name)
+	require.Empty(t, rsp.Supported[1].RateTiers)
+
+	require.Contains(t, rr.Body.String(), `"min_amount": "10"`)
+}
+
+func TestConfigHandlerSpread(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/api/config?format=trim", nil)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+
+	e := &fakeExchanger{}
+	e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+	rr := httptest.NewRecorder()
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			MDLExchanger: config.MDLExchanger{
+				MDLBtcExchangeName: "BTC",
+				MDLBtcExchangeRate: "100",
+				MDLBtcSpread:       "2",
+				MDLEthExchangeName: "ETH",
+				MDLEthExchangeRate: "10.5",
+				MDLEthSpread:       "0",
+				MaxDecimals:        6,
+			},
+		},
+		log:       log,
+		exchanger: e,
+	}
+	httpServ.setupMux().ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var rsp ConfigResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+	require.NoError(t, err)
+
+	// The base rates are unchanged, the effective rates have the spread taken off
+	require.Equal(t, "100", rsp.MDLBtcExchangeRate)
+	require.Equal(t, "98", rsp.MDLBtcEffectiveExchangeRate)
+	require.Equal(t, "10.5", rsp.MDLEthExchangeRate)
+	require.Equal(t, "10.5", rsp.MDLEthEffectiveExchangeRate)
+
+	// Coins without a rate have no effective rate either
+	require.Empty(t, rsp.MDLSkyEffectiveExchangeRate)
+}
+
+func TestConfigHandlerBalanceAvailable(t *testing.T) {
+	tt := []struct {
+		name                 string
+		balance              uint64
+		balanceErr           error
+		availableNullOnError bool
+		available            string
+		balanceAvailable     bool
+	}{
+		{
+			name:             "balance read",
+			balance:          12e6,
+			available:        `"12000000"`,
+			balanceAvailable: true,
+		},
+		{
+			name:             "zero balance",
+			available:        `"0"`,
+			balanceAvailable: true,
+		},
+		{
+			name:       "balance error",
+			balanceErr: errors.New("balance unavailable"),
+			available:  `"0"`,
+		},
+		{
+			name:                 "balance error, null on error",
+			balanceErr:           errors.New("balance unavailable"),
+			availableNullOnError: true,
+			available:            "null",
+		},
+		{
+			name:                 "balance read, null on error",
+			balance:              12e6,
+			availableNullOnError: true,
+			available:            `"12000000"`,
+			balanceAvailable:     true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+			require.NoError(t, err)
+
+			log, _ := testutil.NewLogger(t)
+
+			var balance *readable.BalancePair
+			if tc.balanceErr == nil {
+				balance = &readable.BalancePair{}
+				balance.Confirmed.Coins = tc.balance
+			}
+			e := &balanceExchanger{
+				fakeExchanger: &fakeExchanger{},
+				balance:       balance,
+				err:           tc.balanceErr,
+			}
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					MDLExchanger: config.MDLExchanger{
+						MDLBtcExchangeRate: "100",
+						MDLEthExchangeRate: "10.5",
+						MaxDecimals:        6,
+					},
+					Web: config.Web{
+						AvailableNullOnError: tc.availableNullOnError,
+					},
+				},
+				log:       log,
+				exchanger: e,
+			}
+			httpServ.setupMux().ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var fields map[string]json.RawMessage
+			err = json.Unmarshal(rr.Body.Bytes(), &fields)
+			require.NoError(t, err)
+			require.Equal(t, tc.available, string(fields["available"]))
+
+			var rsp ConfigResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+			require.Equal(t, tc.balanceAvailable, rsp.BalanceAvailable)
+			require.Equal(t, tc.available == "null", rsp.Available.Null)
+		})
+	}
+}
+
+func TestConfigHandlerRateDecimal(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+
+	e := &fakeExchanger{}
+	e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+	rr := httptest.NewRecorder()
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			MDLExchanger: config.MDLExchanger{
+				MDLBtcExchangeName:      "BTC",
+				MDLBtcExchangeRate:      "1/2",
+				MDLEthExchangeName:      "ETH",
+				MDLEthExchangeRate:      "0.5",
+				MDLSkyExchangeName:      "SKY",
+				MDLSkyExchangeRate:      "50%",
+				MDLWavesExchangeName:    "WAVES",
+				MDLWavesMDLExchangeName: "MDL.life",
+				MDLWavesMDLExchangeRate: "100",
+				MaxDecimals:             6,
+			},
+		},
+		log:       log,
+		exchanger: e,
+	}
+	handler := httpServ.setupMux()
+
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var rsp ConfigResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+	require.NoError(t, err)
+
+	type rate struct {
+		rate        string
+		rateDecimal string
+	}
+
+	rates := make(map[string]rate, len(rsp.Supported))
+	for _, c := range rsp.Supported {
+		rates[c.Name] = rate{
+			rate:        c.ExchangeRate,
+			rateDecimal: c.ExchangeRateDecimal,
+		}
+	}
+
+	// The configured rate is unchanged, its decimal form is added
+	require.Equal(t, map[string]rate{
+		"BTC":      {rate: "1/2", rateDecimal: "0.5"},
+		"ETH":      {rate: "0.5", rateDecimal: "0.5"},
+		"SKY":      {rate: "50%", rateDecimal: "0.5"},
+		"WAVES":    {},
+		"MDL.life": {rate: "100", rateDecimal: "100"},
+	}, rates)
+}
+
+type fakeNetworkFees struct {
+	fees  map[string]scanner.FeeEstimate
+	calls int
+}
+
+func (f *fakeNetworkFees) FeeEstimates() map[string]scanner.FeeEstimate {
+	f.calls++
+	return f.fees
+}
+
+func TestConfigHandlerSuggestedNetworkFee(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	e := &fakeExchanger{}
+	e.On("Balance").Return(nil, errors.New("balance unavailable"))
+
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			MDLExchanger: config.MDLExchanger{
+				MDLBtcExchangeName: "BTC",
+				MDLBtcExchangeRate: "100",
+				MaxDecimals:        3,
+			},
+		},
+		log:       log,
+		exchanger: e,
+	}
+	handler := httpServ.setupMux()
+
+	getConfig := func() (ConfigResponse, string) {
+		req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var rsp ConfigResponse
+		err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+		require.NoError(t, err)
+		return rsp, rr.Body.String()
+	}
+
+	// Without a fee source, the field is omitted
+	rsp, body := getConfig()
+	require.Nil(t, rsp.SuggestedNetworkFee)
+	require.NotContains(t, body, "suggested_network_fee")
+
+	// Only the coins whose fee could be estimated are listed
+	fees := &fakeNetworkFees{
+		fees: map[string]scanner.FeeEstimate{
+			scanner.CoinTypeBTC: {Fee: "0.00012", Unit: "BTC/kB"},
+			scanner.CoinTypeETH: {Fee: "21.5", Unit: "Gwei"},
+		},
+	}
+	cache := newFeesCache(fees, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time {
+		return now
+	}
+	httpServ.fees = cache
+
+	expected := map[string]NetworkFee{
+		scanner.CoinTypeBTC: {Fee: "0.00012", Unit: "BTC/kB"},
+		scanner.CoinTypeETH: {Fee: "21.5", Unit: "Gwei"},
+	}
+
+	rsp, _ = getConfig()
+	require.Equal(t, expected, rsp.SuggestedNetworkFee)
+	require.Equal(t, 1, fees.calls)
+
+	// The fees are cached
+	fees.fees = map[string]scanner.FeeEstimate{
+		scanner.CoinTypeBTC: {Fee: "0.0002", Unit: "BTC/kB"},
+	}
+	rsp, _ = getConfig()
+	require.Equal(t, expected, rsp.SuggestedNetworkFee)
+	require.Equal(t, 1, fees.calls)
+
+	now = now.Add(time.Minute)
+	rsp, _ = getConfig()
+	require.Equal(t, map[string]NetworkFee{
+		scanner.CoinTypeBTC: {Fee: "0.0002", Unit: "BTC/kB"},
+	}, rsp.SuggestedNetworkFee)
+	require.Equal(t, 2, fees.calls)
+}
+
+func TestDecimalRate(t *testing.T) {
+	require.Equal(t, "0.5", decimalRate("1/2"))
+	require.Equal(t, "0.5", decimalRate("0.5"))
+	require.Equal(t, "0.5", decimalRate("0.50"))
+	require.Equal(t, "0.25", decimalRate("2500bps"))
+	require.Equal(t, "168000", decimalRate("168000"))
+	require.Equal(t, "", decimalRate(""))
+	require.Equal(t, "", decimalRate("foo"))
+	require.Equal(t, "", decimalRate("0"))
+}
+
+func TestStaticFilesGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teller-static")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Files must be large enough to be gzipped
+	content := bytes.Repeat([]byte("<p>teller</p>\n"), 1024)
+	for _, name := range []string{"index.html", "app.js", "logo.png"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600)
+		require.NoError(t, err)
+	}
+
+	tt := []struct {
+		name         string
+		level        int
+		contentTypes []string
+		gzipped      map[string]bool
+	}{
+		{
+			name: "all files gzipped by default",
+			gzipped: map[string]bool{
+				"/":           true,
+				"/index.html": true,
+				"/app.js":     true,
+				"/logo.png":   true,
+			},
+		},
+		{
+			name:         "only allowed content types gzipped",
+			level:        9,
+			contentTypes: []string{"text/", "application/javascript"},
+			gzipped: map[string]bool{
+				"/":           true,
+				"/index.html": true,
+				"/app.js":     true,
+				"/logo.png":   false,
+			},
+		},
+		{
+			name:         "exact content type",
+			level:        1,
+			contentTypes: []string{"text/html"},
+			gzipped: map[string]bool{
+				"/":           true,
+				"/index.html": true,
+				"/app.js":     false,
+				"/logo.png":   false,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					Web: config.Web{
+						StaticDir:        dir,
+						GzipLevel:        tc.level,
+						GzipContentTypes: tc.contentTypes,
+					},
+				},
+				log:       log,
+				exchanger: &fakeExchanger{},
+			}
+			handler := httpServ.setupMux()
+
+			for url, gzipped := range tc.gzipped {
+				req, err := http.NewRequest(http.MethodGet, url, nil)
+				require.NoError(t, err)
+				req.Header.Set("Accept-Encoding", "gzip")
+
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+
+				require.Equal(t, http.StatusOK, rr.Code, url)
+				if gzipped {
+					require.Equal(t, "gzip", rr.Header().Get("Content-Encoding"), url)
+				} else {
+					require.Empty(t, rr.Header().Get("Content-Encoding"), url)
+					require.Equal(t, content, rr.Body.Bytes(), url)
+				}
+			}
+		})
+	}
+}
+
+func TestStaticFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teller-static")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>teller</p>"), 0600)
+	require.NoError(t, err)
+
+	// The embedded build is served in the same way as the build on disk
+	buildIndex, err := ioutil.ReadFile(filepath.Join("..", "..", "web", "build", "index.html"))
+	require.NoError(t, err)
+	buildManifest, err := ioutil.ReadFile(filepath.Join("..", "..", "web", "build", "asset-manifest.json"))
+	require.NoError(t, err)
+
+	tt := []struct {
+		name      string
+		staticDir string
+		files     map[string][]byte
+		notFound  []string
+	}{
+		{
+			name: "embedded",
+			files: map[string][]byte{
+				"/":                    buildIndex,
+				"/asset-manifest.json": buildManifest,
+			},
+		},
+		{
+			name:      "static_dir",
+			staticDir: dir,
+			files: map[string][]byte{
+				"/": []byte("<p>teller</p>"),
+			},
+			notFound: []string{"/asset-manifest.json"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					Web: config.Web{
+						StaticDir: tc.staticDir,
+					},
+				},
+				log:       log,
+				exchanger: &fakeExchanger{},
+			}
+			handler := httpServ.setupMux()
+
+			for url, content := range tc.files {
+				req, err := http.NewRequest(http.MethodGet, url, nil)
+				require.NoError(t, err)
+
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+
+				require.Equal(t, http.StatusOK, rr.Code, url)
+				require.Equal(t, content, rr.Body.Bytes(), url)
+			}
+
+			for _, url := range tc.notFound {
+				req, err := http.NewRequest(http.MethodGet, url, nil)
+				require.NoError(t, err)
+
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+
+				require.Equal(t, http.StatusNotFound, rr.Code, url)
+			}
+		})
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teller-static")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>teller</p>"), 0600)
+	require.NoError(t, err)
+
+	log, _ := testutil.NewLogger(t)
+
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			Web: config.Web{
+				StaticDir: dir,
+				// viper lowercases the keys of maps
+				ResponseHeaders: map[string]string{
+					"x-frame-options":  "SAMEORIGIN",
+					"cache-control":    "no-store",
+					"x-custom":         "teller",
+					"x-xss-protection": "",
+				},
+			},
+		},
+		log:       log,
+		exchanger: &fakeExchanger{},
+	}
+
+	// Assembled like HTTPServer.Run
+	handler := httputil.HeadersHandler(configureSecureMiddleware("", nil, httpServ.cfg.Web).Handler(httpServ.setupMux()), httpServ.cfg.Web.ResponseHeaders)
+
+	// A static file, an API error and a method not allowed response
+	for _, url := range []string{"/", "/api/status", "/api/bind"} {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// Added
+		require.Equal(t, "teller", rr.Header().Get("X-Custom"), url)
+		require.Equal(t, "no-store", rr.Header().Get("Cache-Control"), url)
+
+		// Overrides the secure middleware default
+		require.Equal(t, []string{"SAMEORIGIN"}, rr.Header()["X-Frame-Options"], url)
+
+		// Removed
+		_, ok := rr.Header()["X-Xss-Protection"]
+		require.False(t, ok, url)
+
+		// Other defaults are kept
+		require.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"), url)
+	}
+
+	// Without configured headers, the secure middleware defaults are sent
+	httpServ.cfg.Web.ResponseHeaders = nil
+	handler = httputil.HeadersHandler(configureSecureMiddleware("", nil, httpServ.cfg.Web).Handler(httpServ.setupMux()), httpServ.cfg.Web.ResponseHeaders)
+
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, "DENY", rr.Header().Get("X-Frame-Options"))
+	require.Equal(t, "1; mode=block", rr.Header().Get("X-XSS-Protection"))
+	require.Empty(t, rr.Header().Get("X-Custom"))
+}
+
+func TestSecureMiddlewareSTS(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	httpServ := &HTTPServer{
+		log:       log,
+		exchanger: &fakeExchanger{},
+	}
+
+	tt := []struct {
+		name   string
+		web    config.Web
+		header string
+	}{
+		{
+			name: "default",
+			web: config.Web{
+				STSSeconds: 31536000,
+			},
+			header: "max-age=31536000",
+		},
+		{
+			name: "short max-age during rollout",
+			web: config.Web{
+				STSSeconds: 300,
+			},
+			header: "max-age=300",
+		},
+		{
+			name: "subdomains",
+			web: config.Web{
+				STSSeconds:           31536000,
+				STSIncludeSubdomains: true,
+			},
+			header: "max-age=31536000; includeSubdomains",
+		},
+		{
+			name: "subdomains and preload",
+			web: config.Web{
+				STSSeconds:           63072000,
+				STSIncludeSubdomains: true,
+				STSPreload:           true,
+			},
+			header: "max-age=63072000; includeSubdomains; preload",
+		},
+		{
+			name:   "disabled",
+			web:    config.Web{},
+			header: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := configureSecureMiddleware("", nil, tc.web).Handler(httpServ.setupMux())
+
+			// Sent over HTTPS
+			req, err := http.NewRequest(http.MethodGet, "/api/bind", nil)
+			require.NoError(t, err)
+			req.TLS = &tls.ConnectionState{}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tc.header, rr.Header().Get("Strict-Transport-Security"))
+
+			// Never sent over HTTP
+			req, err = http.NewRequest(http.MethodGet, "/api/bind", nil)
+			require.NoError(t, err)
+
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Empty(t, rr.Header().Get("Strict-Transport-Security"))
+		})
+	}
+}
+
+type fakeScannerHeights struct {
+	heights []scanner.CoinHeights
+	calls   int
+}
+
+func (h *fakeScannerHeights) Heights() []scanner.CoinHeights {
+	h.calls++
+	return append([]scanner.CoinHeights(nil), h.heights...)
+}
+
+func TestHeightsHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	heights := &fakeScannerHeights{
+		heights: []scanner.CoinHeights{
+			{
+				CoinType: scanner.CoinTypeBTC,
+				Heights: scanner.Heights{
+					ScannedHeight:  500100,
+					ChainTipHeight: 500102,
+					Healthy:        true,
+				},
+			},
+			{
+				CoinType: scanner.CoinTypeSKY,
+				Heights: scanner.Heights{
+					ScannedHeight:  17000,
+					ChainTipHeight: 17000,
+				},
+			},
+			{
+				CoinType: scanner.CoinTypeWAVES,
+				Err:      errors.New("node unavailable"),
+			},
+		},
+	}
+
+	cache := newHeightsCache(heights, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time {
+		return now
+	}
+
+	httpServ := &HTTPServer{
+		log:       log,
+		exchanger: &fakeExchanger{},
+		heights:   cache,
+	}
+	handler := httpServ.setupMux()
+
+	getHeights := func() HeightsResponse {
+		req, err := http.NewRequest(http.MethodGet, "/api/heights", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var rsp HeightsResponse
+		err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+		require.NoError(t, err)
+		return rsp
+	}
+
+	expected := HeightsResponse{
+		Heights: []CoinHeights{
+			{
+				CoinType:       scanner.CoinTypeBTC,
+				ScannedHeight:  500100,
+				ChainTipHeight: 500102,
+				Healthy:        true,
+			},
+			{
+				CoinType:       scanner.CoinTypeSKY,
+				ScannedHeight:  17000,
+				ChainTipHeight: 17000,
+			},
+			{
+				CoinType: scanner.CoinTypeWAVES,
+				Error:    "node unavailable",
+			},
+		},
+	}
+
+	require.Equal(t, expected, getHeights())
+	require.Equal(t, 1, heights.calls)
+
+	// The heights are cached
+	heights.heights[0].ChainTipHeight = 500103
+	require.Equal(t, expected, getHeights())
+	require.Equal(t, 1, heights.calls)
+
+	// The heights are fetched again once the cache expires
+	now = now.Add(time.Minute)
+	expected.Heights[0].ChainTipHeight = 500103
+	require.Equal(t, expected, getHeights())
+	require.Equal(t, 2, heights.calls)
+
+	// No scanners are running
+	httpServ.heights = newHeightsCache(nil, time.Minute)
+	handler = httpServ.setupMux()
+	require.Equal(t, HeightsResponse{
+		Heights: []CoinHeights{},
+	}, getHeights())
+
+	// Only GET is allowed
+	req, err := http.NewRequest(http.MethodPost, "/api/heights", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestPingHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	httpServ := &HTTPServer{
+		log:       log,
+		exchanger: &fakeExchanger{},
+	}
+	handler := httpServ.setupMux()
+
+	ping := func(url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	before := time.Now().UTC().Unix()
+	rr := ping("/api/ping")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var rsp map[string]interface{}
+	err := json.Unmarshal(rr.Body.Bytes(), &rsp)
+	require.NoError(t, err)
+	require.Len(t, rsp, 2)
+	require.Equal(t, true, rsp["pong"])
+
+	serverTime, ok := rsp["server_time"].(float64)
+	require.True(t, ok)
+	require.True(t, int64(serverTime) >= before)
+	require.True(t, int64(serverTime) <= time.Now().UTC().Unix())
+
+	// The nonce is echoed
+	rr = ping("/api/ping?nonce=abc-123")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var pingRsp PingResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &pingRsp)
+	require.NoError(t, err)
+	require.True(t, pingRsp.Pong)
+	require.Equal(t, "abc-123", pingRsp.Nonce)
+
+	// A long nonce is rejected
+	rr = ping("/api/ping?nonce=" + strings.Repeat("a", maxPingNonceLen+1))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Only GET is allowed
+	req, err := http.NewRequest(http.MethodPost, "/api/ping", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestMaxClockSkew(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			Web: config.Web{
+				MaxClockSkew: time.Minute * 5,
+			},
+		},
+		log:       log,
+		exchanger: &fakeExchanger{},
+	}
+	handler := httpServ.setupMux()
+
+	ping := func(ts string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/api/ping", nil)
+		require.NoError(t, err)
+		if ts != "" {
+			req.Header.Set(httputil.TimestampHeader, ts)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	unix := func(t time.Time) string {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+
+	// Requests without a timestamp are not checked
+	rr := ping("")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	// In the window
+	rr = ping(unix(time.Now()))
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = ping(unix(time.Now().Add(-time.Minute * 4)))
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = ping(unix(time.Now().Add(time.Minute * 4)))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	// Too old
+	rr = ping(unix(time.Now().Add(-time.Minute * 6)))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "Request timestamp is more than 5m0s old", strings.TrimSpace(rr.Body.String()))
+
+	// Too far in the future
+	rr = ping(unix(time.Now().Add(time.Minute * 6)))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "Request timestamp is more than 5m0s in the future", strings.TrimSpace(rr.Body.String()))
+
+	// Invalid
+	rr = ping("yesterday")
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), "Invalid X-Request-Timestamp header")
+
+	// Disabled
+	httpServ.cfg.Web.MaxClockSkew = 0
+	handler = httpServ.setupMux()
+	rr = ping(unix(time.Now().Add(-time.Hour)))
+	require.Equal(t, http.StatusOK, rr.Code)
+}
+
+type fakeAddrGenerator struct {
+	addr string
+}
+
+func (g fakeAddrGenerator) NewAddress() (string, error) {
+	return g.addr, nil
+}
+
+type fakeCountingAddrGenerator struct {
+	fakeAddrGenerator
+	remaining uint64
+}
+
+func (g fakeCountingAddrGenerator) Remaining() uint64 {
+	return g.remaining
+}
+
+func TestSupportedHandler(t *testing.T) {
+	bindable := func(coinTypes ...string) []SupportedCoin {
+		coins := []SupportedCoin{}
+		for _, coinType := range coinTypes {
+			coins = append(coins, SupportedCoin{
+				CoinType: coinType,
+				Bindable: true,
+			})
+		}
+		return coins
+	}
+
+	notBindable := func(reason string, coinTypes ...string) []SupportedCoin {
+		coins := bindable(coinTypes...)
+		for i := range coins {
+			coins[i].Bindable = false
+			coins[i].ReasonIfNot = reason
+		}
+		return coins
+	}
+
+	allCoins := scanner.GetCoinTypes()
+
+	btcDeprecation := exchange.CoinDeprecation{
+		CoinType:     scanner.CoinTypeBTC,
+		Stage:        exchange.CoinStageDeprecated,
+		DeprecatedAt: 1520000000,
+		RetiresAt:    1522592000,
+	}
+	btcDeprecated := notBindable(exchange.ErrCoinDeprecated.Error(), scanner.CoinTypeBTC)
+	btcDeprecated[0].Deprecation = &btcDeprecation
+
+	tt := []struct {
+		name     string
+		modify   func(cfg *config.Config, service *Service, heights *fakeScannerHeights)
+		expected []SupportedCoin
+	}{
+		{
+			name:     "all bindable",
+			modify:   func(*config.Config, *Service, *fakeScannerHeights) {},
+			expected: bindable(allCoins...),
+		},
+		{
+			name: "read only",
+			modify: func(cfg *config.Config, _ *Service, _ *fakeScannerHeights) {
+				cfg.ReadOnly = true
+			},
+			expected: notBindable(ErrReadOnly.Error(), allCoins...),
+		},
+		{
+			name: "binding disabled",
+			modify: func(_ *config.Config, service *Service, _ *fakeScannerHeights) {
+				service.cfg.BindEnabled = false
+			},
+			expected: notBindable(ErrBindDisabled.Error(), allCoins...),
+		},
+		{
+			name: "payouts disabled",
+			modify: func(_ *config.Config, service *Service, _ *fakeScannerHeights) {
+				service.sendEnabled = false
+			},
+			expected: notBindable(ErrPayoutsDisabled.Error(), allCoins...),
+		},
+		{
+			name: "payouts disabled, prebind allowed",
+			modify: func(_ *config.Config, service *Service, _ *fakeScannerHeights) {
+				service.sendEnabled = false
+				service.cfg.AllowPrebind = true
+			},
+			expected: bindable(allCoins...),
+		},
+		{
+			name: "coin disabled",
+			modify: func(cfg *config.Config, _ *Service, _ *fakeScannerHeights) {
+				cfg.BtcRPC.Enabled = false
+			},
+			expected: append(notBindable(config.Teller{}.FormatCoinDisabledMessage(scanner.CoinTypeBTC), scanner.CoinTypeBTC),
+				bindable(scanner.CoinTypeETH, scanner.CoinTypeSKY, scanner.CoinTypeWAVES, scanner.CoinTypeWAVESMDL)...),
+		},
+		{
+			name: "exchange disabled",
+			modify: func(cfg *config.Config, _ *Service, _ *fakeScannerHeights) {
+				cfg.MDLExchanger.MDLEthExchangeEnabled = false
+			},
+			expected: append(append(bindable(scanner.CoinTypeBTC),
+				notBindable(ErrExchangeDisabled.Error(), scanner.CoinTypeETH)...),
+				bindable(scanner.CoinTypeSKY, scanner.CoinTypeWAVES, scanner.CoinTypeWAVESMDL)...),
+		},
+		{
+			name: "node unavailable",
+			modify: func(_ *config.Config, _ *Service, heights *fakeScannerHeights) {
+				heights.heights[3].Err = errors.New("node unavailable")
+			},
+			expected: append(append(bindable(scanner.CoinTypeBTC, scanner.CoinTypeETH, scanner.CoinTypeSKY),
+				notBindable(ErrNodeUnavailable.Error(), scanner.CoinTypeWAVES)...),
+				bindable(scanner.CoinTypeWAVESMDL)...),
+		},
+		{
+			name: "no deposit addresses left",
+			modify: func(_ *config.Config, service *Service, _ *fakeScannerHeights) {
+				service.addrManager.AGHolder[scanner.CoinTypeSKY] = fakeCountingAddrGenerator{}
+			},
+			expected: append(append(bindable(scanner.CoinTypeBTC, scanner.CoinTypeETH),
+				notBindable(addrs.ErrDepositAddressEmpty.Error(), scanner.CoinTypeSKY)...),
+				bindable(scanner.CoinTypeWAVES, scanner.CoinTypeWAVESMDL)...),
+		},
+		{
+			name: "coin deprecated",
+			modify: func(_ *config.Config, service *Service, _ *fakeScannerHeights) {
+				service.exchanger.(*fakeExchanger).deprecations = map[string]exchange.CoinDeprecation{
+					scanner.CoinTypeBTC: btcDeprecation,
+				}
+			},
+			expected: append(btcDeprecated,
+				bindable(scanner.CoinTypeETH, scanner.CoinTypeSKY, scanner.CoinTypeWAVES, scanner.CoinTypeWAVESMDL)...),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+
+			cfg := config.Config{
+				BtcRPC: config.BtcRPC{
+					Enabled: true,
+				},
+				EthRPC: config.EthRPC{
+					Enabled: true,
+				},
+				SkyRPC: config.SkyRPC{
+					Enabled: true,
+				},
+				WavesRPC: config.WavesRPC{
+					Enabled: true,
+				},
+				WavesMDLRPC: config.WavesMDLRPC{
+					Enabled: true,
+				},
+				MDLExchanger: config.MDLExchanger{
+					MDLBtcExchangeEnabled:      true,
+					MDLEthExchangeEnabled:      true,
+					MDLSkyExchangeEnabled:      true,
+					MDLWavesExchangeEnabled:    true,
+					MDLWavesMDLExchangeEnabled: true,
+				},
+			}
+
+			addrManager := addrs.NewAddrManager()
+			heights := &fakeScannerHeights{}
+			for _, coinType := range allCoins {
+				err := addrManager.PushGenerator(fakeCountingAddrGenerator{
+					fakeAddrGenerator: fakeAddrGenerator{"foo-" + coinType + "-addr"},
+					remaining:         1,
+				}, coinType)
+				require.NoError(t, err)
+
+				heights.heights = append(heights.heights, scanner.CoinHeights{
+					CoinType: coinType,
+				})
+			}
+
+			e := &fakeExchanger{}
+			service := &Service{
+				cfg: config.Teller{
+					BindEnabled: true,
+				},
+				sendEnabled: true,
+				exchanger:   e,
+				addrManager: addrManager,
+			}
+
+			tc.modify(&cfg, service, heights)
+
+			httpServ := &HTTPServer{
+				cfg:       cfg,
+				log:       log,
+				exchanger: e,
+				service:   service,
+				heights:   newHeightsCache(heights, time.Minute),
+			}
+			handler := httpServ.setupMux()
+
+			req, err := http.NewRequest(http.MethodGet, "/api/supported", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var rsp SupportedResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+			require.Equal(t, SupportedResponse{
+				Coins: tc.expected,
+			}, rsp)
+
+			e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestBindHandlerPrebind(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	depositAddr := "foo-sky-addr"
+
+	tt := []struct {
+		name           string
+		sendEnabled    bool
+		allowPrebind   bool
+		status         int
+		err            string
+		payoutsEnabled bool
+	}{
+		{
+			name:           "200 send enabled",
+			sendEnabled:    true,
+			status:         http.StatusOK,
+			payoutsEnabled: true,
+		},
+		{
+			name:           "200 send enabled, prebind allowed",
+			sendEnabled:    true,
+			allowPrebind:   true,
+			status:         http.StatusOK,
+			payoutsEnabled: true,
+		},
+		{
+			name:           "200 send disabled, prebind allowed",
+			allowPrebind:   true,
+			status:         http.StatusOK,
+			payoutsEnabled: false,
+		},
+		{
+			name:   "403 send disabled, prebind not allowed",
+			status: http.StatusForbidden,
+			err:    ErrPayoutsDisabled.Error(),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+				MDLAddress: mdlAddr,
+				Address:    depositAddr,
+				CoinType:   scanner.CoinTypeSKY,
+				BuyMethod:  config.BuyMethodDirect,
+				CreatedAt:  1501136950,
+			}, nil)
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{depositAddr}, scanner.CoinTypeSKY)
+			require.NoError(t, err)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  mdlAddr,
+				CoinType: scanner.CoinTypeSKY,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled:  true,
+						AllowPrebind: tc.allowPrebind,
+					},
+					sendEnabled: tc.sendEnabled,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				e.AssertNotCalled(t, "BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{})
+				return
+			}
+
+			var rsp BindResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+			require.Equal(t, BindResponse{
+				DepositAddress: depositAddr,
+				CoinType:       scanner.CoinTypeSKY,
+				BuyMethod:      config.BuyMethodDirect,
+				PayoutsEnabled: tc.payoutsEnabled,
+				PaymentURI:     "skycoin:" + depositAddr,
+				BoundAt:        1501136950,
+			}, rsp)
+		})
+	}
+}
+
+// balanceExchanger is a fakeExchanger with a fixed hot wallet balance
+type balanceExchanger struct {
+	*fakeExchanger
+	balance *readable.BalancePair
+	err     error
+}
+
+func (e *balanceExchanger) Balance() (*readable.BalancePair, error) {
+	return e.balance, e.err
+}
+
+func TestBindHandlerMinBindBalance(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	depositAddr := "foo-sky-addr"
+
+	tt := []struct {
+		name           string
+		minBindBalance string
+		balance        uint64
+		balanceErr     error
+		status         int
+		err            string
+	}{
+		{
+			name:    "200 disabled",
+			balance: 0,
+			status:  http.StatusOK,
+		},
+		{
+			name:           "200 above threshold",
+			minBindBalance: "100",
+			balance:        100e6,
+			status:         http.StatusOK,
+		},
+		{
+			name:           "503 below threshold",
+			minBindBalance: "100",
+			balance:        99999999,
+			status:         http.StatusServiceUnavailable,
+			err:            ErrLowBalance.Error(),
+		},
+		{
+			name:           "500 balance unavailable",
+			minBindBalance: "100",
+			balanceErr:     errors.New("mdl node unavailable"),
+			status:         http.StatusInternalServerError,
+			err:            errInternalServerError.Error(),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			fe := &fakeExchanger{}
+			fe.On("BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+				MDLAddress: mdlAddr,
+				Address:    depositAddr,
+				CoinType:   scanner.CoinTypeSKY,
+				BuyMethod:  config.BuyMethodDirect,
+				CreatedAt:  1501136950,
+			}, nil)
+
+			var balance *readable.BalancePair
+			if tc.balanceErr == nil {
+				balance = &readable.BalancePair{}
+				balance.Confirmed.Coins = tc.balance
+			}
+			e := &balanceExchanger{
+				fakeExchanger: fe,
+				balance:       balance,
+				err:           tc.balanceErr,
+			}
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{depositAddr}, scanner.CoinTypeSKY)
+			require.NoError(t, err)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  mdlAddr,
+				CoinType: scanner.CoinTypeSKY,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled:    true,
+						MinBindBalance: tc.minBindBalance,
+					},
+					sendEnabled: true,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				fe.AssertNotCalled(t, "BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{})
+				return
+			}
+
+			var rsp BindResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+			require.Equal(t, depositAddr, rsp.DepositAddress)
+		})
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	tt := []struct {
+		name           string
+		handlerTimeout time.Duration
+		balanceDelay   time.Duration
+		status         int
+	}{
+		{
+			name:           "503 handler exceeds web.handler_timeout",
+			handlerTimeout: time.Millisecond * 50,
+			balanceDelay:   time.Millisecond * 500,
+			status:         http.StatusServiceUnavailable,
+		},
+		{
+			name:           "200 handler within web.handler_timeout",
+			handlerTimeout: time.Second * 5,
+			balanceDelay:   time.Millisecond * 10,
+			status:         http.StatusOK,
+		},
+		{
+			name:         "200 web.handler_timeout disabled",
+			balanceDelay: time.Millisecond * 100,
+			status:       http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+			require.NoError(t, err)
+
+			log, _ := testutil.NewLogger(t)
+
+			// A slow exchanger makes ConfigHandler slow
+			e := &fakeExchanger{}
+			e.On("Balance").Return(nil, errors.New("balance unavailable")).After(tc.balanceDelay)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					MDLExchanger: config.MDLExchanger{
+						MDLBtcExchangeRate:      "1",
+						MDLEthExchangeRate:      "1",
+						MDLSkyExchangeRate:      "1",
+						MDLWavesExchangeRate:    "1",
+						MDLWavesMDLExchangeRate: "1",
+					},
+					Web: config.Web{
+						HandlerTimeout: tc.handlerTimeout,
+					},
+				},
+				log:       log,
+				exchanger: e,
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+			if tc.status == http.StatusServiceUnavailable {
+				require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				require.JSONEq(t, `{"ok":false,"error":"Request timed out"}`, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTimeoutHandlerCancelsContext(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(time.Second * 5):
+		}
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	httputil.TimeoutHandler(slow, time.Millisecond*50).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second * 3):
+		t.Fatal("Request context was not cancelled")
+	}
+}
+
+func TestBindHandlerCoinTypeAliases(t *testing.T) {
+	tt := []struct {
+		name     string
+		coinType string
+		status   int
+		err      string
+	}{
+		{
+			"lowercase",
+			"sky",
+			http.StatusForbidden,
+			"Address binding is disabled",
+		},
+		{
+			"mixed case",
+			"Sky",
+			http.StatusForbidden,
+			"Address binding is disabled",
+		},
+		{
+			"alias",
+			"skycoin",
+			http.StatusForbidden,
+			"Address binding is disabled",
+		},
+		{
+			"mixed case alias",
+			"SkyCoin",
+			http.StatusForbidden,
+			"Address binding is disabled",
+		},
+		{
+			"invalid",
+			"dogecoin",
+			http.StatusBadRequest,
+			"Invalid coin_type",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT",
+				CoinType: tc.coinType,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					Teller: config.Teller{
+						CoinTypeAliases: map[string]string{
+							"skycoin": "SKY",
+						},
+					},
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+				},
+				log:       log,
+				exchanger: &fakeExchanger{},
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: false,
+					},
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			// 403 "Address binding is disabled" is returned after the coin type is accepted
+			require.Equal(t, tc.status, rr.Code)
+			require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+		})
+	}
+}
+
+func TestBindHandlerReference(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	depositAddr := "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"
+
+	tt := []struct {
+		name      string
+		reference string
+		expected  string
+		status    int
+		err       string
+	}{
+		{
+			name:   "200 no reference",
+			status: http.StatusOK,
+		},
+		{
+			name:      "200 reference",
+			reference: " order-1234\n",
+			expected:  "order-1234",
+			status:    http.StatusOK,
+		},
+		{
+			name:      "200 max length reference",
+			reference: strings.Repeat("x", maxBindReferenceLength),
+			expected:  strings.Repeat("x", maxBindReferenceLength),
+			status:    http.StatusOK,
+		},
+		{
+			name:      "400 reference too long",
+			reference: strings.Repeat("x", maxBindReferenceLength+1),
+			status:    http.StatusBadRequest,
+			err:       "Reference too long, must be at most 128 bytes",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{Reference: tc.expected}).Return(&exchange.BoundAddress{
+				MDLAddress: mdlAddr,
+				Address:    depositAddr,
+				CoinType:   scanner.CoinTypeSKY,
+				BuyMethod:  config.BuyMethodDirect,
+				Reference:  tc.expected,
+			}, nil)
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{depositAddr}, scanner.CoinTypeSKY)
+			require.NoError(t, err)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:   mdlAddr,
+				CoinType:  scanner.CoinTypeSKY,
+				Reference: tc.reference,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: true,
+					},
+					sendEnabled: true,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			e.AssertCalled(t, "BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{Reference: tc.expected})
+		})
+	}
+}
+
+func TestBindHandlerLabel(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	tt := []struct {
+		name        string
+		label       string
+		depositAddr string
+		status      int
+		err         string
+	}{
+		{
+			name:        "200 no label",
+			depositAddr: "CDLrMvPcmpdido8cbSFNNgzQXdC97TsgEQ",
+			status:      http.StatusOK,
+		},
+		{
+			name:        "200 labeled address",
+			label:       " acct-43\n",
+			depositAddr: "2Dc7kXtwBLr8GL4TSZKFCJM3xqEwnqH6m67",
+			status:      http.StatusOK,
+		},
+		{
+			name:        "200 unknown label falls back to the next address",
+			label:       "acct-99",
+			depositAddr: "CDLrMvPcmpdido8cbSFNNgzQXdC97TsgEQ",
+			status:      http.StatusOK,
+		},
+		{
+			name:   "400 label too long",
+			label:  strings.Repeat("x", maxBindLabelLength+1),
+			status: http.StatusBadRequest,
+			err:    "Label too long, must be at most 128 bytes",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+
+			skyAddrs, err := addrs.NewSKYAddrs(log, db, strings.NewReader(`
+				CDLrMvPcmpdido8cbSFNNgzQXdC97TsgEQ
+				fyqX5YuwXMUs4GEUE3LjLyhrqvNztFHQ4B acct-42
+				2Dc7kXtwBLr8GL4TSZKFCJM3xqEwnqH6m67 acct-43`), nil)
+			require.NoError(t, err)
+
+			addrManager := addrs.NewAddrManager()
+			err = addrManager.PushGenerator(skyAddrs, scanner.CoinTypeSKY)
+			require.NoError(t, err)
+
+			label := strings.TrimSpace(tc.label)
+
+			e := &fakeExchanger{}
+			e.On("BindAddress", mdlAddr, tc.depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{Label: label}).Return(&exchange.BoundAddress{
+				MDLAddress: mdlAddr,
+				Address:    tc.depositAddr,
+				CoinType:   scanner.CoinTypeSKY,
+				BuyMethod:  config.BuyMethodDirect,
+				Label:      label,
+			}, nil)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  mdlAddr,
+				CoinType: scanner.CoinTypeSKY,
+				Label:    tc.label,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: true,
+					},
+					sendEnabled: true,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			var rsp BindResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+			require.Equal(t, tc.depositAddr, rsp.DepositAddress)
+			require.Equal(t, label, rsp.Label)
+		})
+	}
+}
+
+func TestBindHandlerBindCooldown(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	depositAddr := "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"
+
+	tt := []struct {
+		name       string
+		cooldown   time.Duration
+		lastBind   int64
+		status     int
+		retryAfter string
+	}{
+		{
+			name:     "200 cooldown disabled",
+			lastBind: time.Now().Unix(),
+			status:   http.StatusOK,
+		},
+		{
+			name:     "200 never bound",
+			cooldown: time.Minute,
+			status:   http.StatusOK,
+		},
+		{
+			name:       "429 rebind too soon",
+			cooldown:   time.Minute,
+			lastBind:   time.Now().Add(-time.Second * 30).Unix(),
+			status:     http.StatusTooManyRequests,
+			retryAfter: "30",
+		},
+		{
+			name:     "200 rebind after the cooldown",
+			cooldown: time.Minute,
+			lastBind: time.Now().Add(-time.Minute * 2).Unix(),
+			status:   http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("GetLastBindTime", mdlAddr).Return(tc.lastBind, nil)
+			e.On("BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+				MDLAddress: mdlAddr,
+				Address:    depositAddr,
+				CoinType:   scanner.CoinTypeSKY,
+				BuyMethod:  config.BuyMethodDirect,
+			}, nil)
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{depositAddr}, scanner.CoinTypeSKY)
+			require.NoError(t, err)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  mdlAddr,
+				CoinType: scanner.CoinTypeSKY,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled:  true,
+						BindCooldown: tc.cooldown,
+					},
+					sendEnabled: true,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, BindCooldownError{}.Error(), strings.TrimSpace(rr.Body.String()))
+				retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+				require.NoError(t, err)
+				expected, err := strconv.Atoi(tc.retryAfter)
+				require.NoError(t, err)
+				// A second may pass between computing the last bind time and handling the request
+				require.InDelta(t, expected, retryAfter, 1)
+				e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			require.Empty(t, rr.Header().Get("Retry-After"))
+			e.AssertCalled(t, "BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{})
+			if tc.cooldown == 0 {
+				e.AssertNotCalled(t, "GetLastBindTime", mock.Anything)
+			}
+		})
+	}
+}
+
+func TestBindHandlerPaymentURI(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	tt := []struct {
+		name        string
+		coinType    string
+		depositAddr string
+		amount      string
+		status      int
+		paymentURI  string
+		err         string
+	}{
+		{
+			name:        "btc",
+			coinType:    scanner.CoinTypeBTC,
+			depositAddr: "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp",
+			status:      http.StatusOK,
+			paymentURI:  "bitcoin:1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp",
+		},
+		{
+			name:        "btc with amount",
+			coinType:    scanner.CoinTypeBTC,
+			depositAddr: "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp",
+			amount:      "0.015",
+			status:      http.StatusOK,
+			paymentURI:  "bitcoin:1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp?amount=0.015",
+		},
+		{
+			name:        "eth with amount",
+			coinType:    scanner.CoinTypeETH,
+			depositAddr: "0x87b127ee022abcf9881b9bad6bb6aac25229dff0",
+			amount:      "1.5",
+			status:      http.StatusOK,
+			paymentURI:  "ethereum:0x87b127ee022abcf9881b9bad6bb6aac25229dff0?value=1500000000000000000",
+		},
+		{
+			name:        "sky with amount",
+			coinType:    scanner.CoinTypeSKY,
+			depositAddr: "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj",
+			amount:      "10",
+			status:      http.StatusOK,
+			paymentURI:  "skycoin:2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj?amount=10",
+		},
+		{
+			name:        "waves has no scheme",
+			coinType:    scanner.CoinTypeWAVES,
+			depositAddr: "3PEE1pAgTWCZS3ZSRAR2AZxvstvfwrDgX4h",
+			amount:      "10",
+			status:      http.StatusOK,
+		},
+		{
+			name:        "waves mdl has no scheme",
+			coinType:    scanner.CoinTypeWAVESMDL,
+			depositAddr: "3PEE1pAgTWCZS3ZSRAR2AZxvstvfwrDgX4h",
+			status:      http.StatusOK,
+		},
+		{
+			name:        "invalid amount",
+			coinType:    scanner.CoinTypeBTC,
+			depositAddr: "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp",
+			amount:      "foo",
+			status:      http.StatusBadRequest,
+			err:         "Invalid amount, must be a positive decimal number",
+		},
+		{
+			name:        "negative amount",
+			coinType:    scanner.CoinTypeBTC,
+			depositAddr: "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp",
+			amount:      "-1",
+			status:      http.StatusBadRequest,
+			err:         "Invalid amount, must be a positive decimal number",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("BindAddress", mdlAddr, tc.depositAddr, tc.coinType, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+				MDLAddress: mdlAddr,
+				Address:    tc.depositAddr,
+				CoinType:   tc.coinType,
+				BuyMethod:  config.BuyMethodDirect,
+			}, nil)
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{tc.depositAddr}, tc.coinType)
+			require.NoError(t, err)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  mdlAddr,
+				CoinType: tc.coinType,
+				Amount:   tc.amount,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					BtcRPC:      config.BtcRPC{Enabled: true},
+					EthRPC:      config.EthRPC{Enabled: true},
+					SkyRPC:      config.SkyRPC{Enabled: true},
+					WavesRPC:    config.WavesRPC{Enabled: true},
+					WavesMDLRPC: config.WavesRPC{Enabled: true},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: true,
+					},
+					sendEnabled: true,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			var rsp BindResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+			require.Equal(t, tc.depositAddr, rsp.DepositAddress)
+			require.Equal(t, tc.paymentURI, rsp.PaymentURI)
+
+			if tc.paymentURI == "" {
+				require.NotContains(t, rr.Body.String(), "payment_uri")
+			}
+		})
+	}
+}
+
+func TestBindHandlerExpectedAmount(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	depositAddr := "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp"
+
+	tt := []struct {
+		name           string
+		expectedAmount string
+		amount         string
+		expected       string
+		status         int
+		paymentURI     string
+		err            string
+	}{
+		{
+			name:       "no expected amount",
+			status:     http.StatusOK,
+			paymentURI: "bitcoin:1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp",
+		},
+		{
+			name:           "expected amount is the default amount",
+			expectedAmount: " 0.0150 ",
+			expected:       "0.015",
+			status:         http.StatusOK,
+			paymentURI:     "bitcoin:1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp?amount=0.015",
+		},
+		{
+			name:           "amount overrides the expected amount in payment_uri",
+			expectedAmount: "0.015",
+			amount:         "0.02",
+			expected:       "0.015",
+			status:         http.StatusOK,
+			paymentURI:     "bitcoin:1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp?amount=0.02",
+		},
+		{
+			name:           "invalid expected amount",
+			expectedAmount: "foo",
+			status:         http.StatusBadRequest,
+			err:            "Invalid expected_amount, must be a positive decimal number",
+		},
+		{
+			name:           "zero expected amount",
+			expectedAmount: "0",
+			status:         http.StatusBadRequest,
+			err:            "Invalid expected_amount, must be a positive decimal number",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("BindAddress", mdlAddr, depositAddr, scanner.CoinTypeBTC, exchange.BindOptions{ExpectedAmount: tc.expected}).Return(&exchange.BoundAddress{
+				MDLAddress:     mdlAddr,
+				Address:        depositAddr,
+				CoinType:       scanner.CoinTypeBTC,
+				BuyMethod:      config.BuyMethodDirect,
+				ExpectedAmount: tc.expected,
+			}, nil)
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{depositAddr}, scanner.CoinTypeBTC)
+			require.NoError(t, err)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:        mdlAddr,
+				CoinType:       scanner.CoinTypeBTC,
+				Amount:         tc.amount,
+				ExpectedAmount: tc.expectedAmount,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					BtcRPC: config.BtcRPC{Enabled: true},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: true,
+					},
+					sendEnabled: true,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			e.AssertCalled(t, "BindAddress", mdlAddr, depositAddr, scanner.CoinTypeBTC, exchange.BindOptions{ExpectedAmount: tc.expected})
+
+			var rsp BindResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, rsp.ExpectedAmount)
+			require.Equal(t, tc.paymentURI, rsp.PaymentURI)
+
+			if tc.expected == "" {
+				require.NotContains(t, rr.Body.String(), "expected_amount")
+			}
+		})
+	}
+}
+
+func TestBindHandlerEmail(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	depositAddr := "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp"
+
+	tt := []struct {
+		name              string
+		email             string
+		userNotifications bool
+		expected          string
+		status            int
+		err               string
+	}{
+		{
+			name:              "no email",
+			userNotifications: true,
+			status:            http.StatusOK,
+		},
+		{
+			name:              "email",
+			email:             " user@example.com ",
+			userNotifications: true,
+			expected:          "user@example.com",
+			status:            http.StatusOK,
+		},
+		{
+			name:   "user notifications disabled",
+			email:  "user@example.com",
+			status: http.StatusBadRequest,
+			err:    "Email notifications are not enabled",
+		},
+		{
+			name:              "invalid email",
+			email:             "user",
+			userNotifications: true,
+			status:            http.StatusBadRequest,
+			err:               "Invalid email address",
+		},
+		{
+			name:              "display name",
+			email:             "User <user@example.com>",
+			userNotifications: true,
+			status:            http.StatusBadRequest,
+			err:               "Invalid email address",
+		},
+		{
+			name:              "header injection",
+			email:             "user@example.com\r\nBcc: other@example.com",
+			userNotifications: true,
+			status:            http.StatusBadRequest,
+			err:               "Invalid email address",
+		},
+		{
+			name:              "too long",
+			email:             strings.Repeat("a", 250) + "@example.com",
+			userNotifications: true,
+			status:            http.StatusBadRequest,
+			err:               "Invalid email address",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("BindAddress", mdlAddr, depositAddr, scanner.CoinTypeBTC, exchange.BindOptions{ContactEmail: tc.expected}).Return(&exchange.BoundAddress{
+				MDLAddress:   mdlAddr,
+				Address:      depositAddr,
+				CoinType:     scanner.CoinTypeBTC,
+				BuyMethod:    config.BuyMethodDirect,
+				ContactEmail: tc.expected,
+			}, nil)
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{depositAddr}, scanner.CoinTypeBTC)
+			require.NoError(t, err)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  mdlAddr,
+				CoinType: scanner.CoinTypeBTC,
+				Email:    tc.email,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					BtcRPC: config.BtcRPC{Enabled: true},
+					Email: config.Email{
+						Enabled:           tc.userNotifications,
+						UserNotifications: tc.userNotifications,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: true,
+					},
+					sendEnabled: true,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			e.AssertCalled(t, "BindAddress", mdlAddr, depositAddr, scanner.CoinTypeBTC, exchange.BindOptions{ContactEmail: tc.expected})
+
+			// The email is not returned
+			require.NotContains(t, rr.Body.String(), "example.com")
+		})
+	}
+}
+
+func TestNotificationsOptOutHandler(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	newServer := func(e *fakeExchanger, userNotifications bool) http.Handler {
+		httpServ := &HTTPServer{
+			cfg: config.Config{
+				Email: config.Email{
+					Enabled:           userNotifications,
+					UserNotifications: userNotifications,
+				},
+			},
+			log:       log,
+			exchanger: e,
+		}
+		return httpServ.setupMux()
+	}
+
+	optOut := func(handler http.Handler, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/api/notifications/opt-out", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	e := &fakeExchanger{}
+	e.On("OptOutContactEmail", "user@example.com").Return(nil)
+	handler := newServer(e, true)
+
+	rr := optOut(handler, `{"email":" user@example.com "}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var rsp NotificationsOptOutResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &rsp)
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", rsp.Email)
+	e.AssertCalled(t, "OptOutContactEmail", "user@example.com")
+
+	rr = optOut(handler, `{"email":"user"}`)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "Invalid email address", strings.TrimSpace(rr.Body.String()))
+
+	rr = optOut(handler, `{"email":`)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Storage failures are not exposed
+	e = &fakeExchanger{}
+	e.On("OptOutContactEmail", "user@example.com").Return(errors.New("db failure"))
+	rr = optOut(newServer(e, true), `{"email":"user@example.com"}`)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.NotContains(t, rr.Body.String(), "db failure")
+
+	// Not served unless user notifications are enabled
+	e = &fakeExchanger{}
+	rr = optOut(newServer(e, false), `{"email":"user@example.com"}`)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+	e.AssertNotCalled(t, "OptOutContactEmail", mock.Anything)
+}
+
+func TestBindHandlerMDLAddressLists(t *testing.T) {
+	blockedAddr := "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW"
+	allowedAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	bothAddr := "hs1pyuNgxDLyLaZsnqzQG9U3DKdJsbzNpn"
+	unlistedAddr := "2VZu3rZozQ6nN37YSdj3EZJV7wSFVuLSm2X"
+	depositAddr := "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"
+
+	dir, err := ioutil.TempDir("", "teller-address-lists")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	blocklistPath := filepath.Join(dir, "blocklist.txt")
+	err = ioutil.WriteFile(blocklistPath, []byte("# sanctioned\n"+blockedAddr+"\n\n"+bothAddr+"\n"), 0600)
+	require.NoError(t, err)
+
+	allowlistPath := filepath.Join(dir, "allowlist.txt")
+	err = ioutil.WriteFile(allowlistPath, []byte(allowedAddr+"\n"+bothAddr+"\n"), 0600)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name      string
+		blocklist bool
+		allowlist bool
+		mdlAddr   string
+		status    int
+		err       string
+	}{
+		{
+			name:    "200 no lists",
+			mdlAddr: blockedAddr,
+			status:  http.StatusOK,
+		},
+		{
+			name:      "403 blocked",
+			blocklist: true,
+			mdlAddr:   blockedAddr,
+			status:    http.StatusForbidden,
+			err:       ErrMDLAddressBlocked.Error(),
+		},
+		{
+			name:      "200 not blocked",
+			blocklist: true,
+			mdlAddr:   unlistedAddr,
+			status:    http.StatusOK,
+		},
+		{
+			name:      "200 allowed",
+			allowlist: true,
+			mdlAddr:   allowedAddr,
+			status:    http.StatusOK,
+		},
+		{
+			name:      "403 not allowed",
+			allowlist: true,
+			mdlAddr:   unlistedAddr,
+			status:    http.StatusForbidden,
+			err:       ErrMDLAddressNotAllowed.Error(),
+		},
+		{
+			name:      "200 allowed and not blocked",
+			blocklist: true,
+			allowlist: true,
+			mdlAddr:   allowedAddr,
+			status:    http.StatusOK,
+		},
+		{
+			name:      "403 allowed but blocked",
+			blocklist: true,
+			allowlist: true,
+			mdlAddr:   bothAddr,
+			status:    http.StatusForbidden,
+			err:       ErrMDLAddressBlocked.Error(),
+		},
+		{
+			name:      "403 neither blocked nor allowed",
+			blocklist: true,
+			allowlist: true,
+			mdlAddr:   unlistedAddr,
+			status:    http.StatusForbidden,
+			err:       ErrMDLAddressNotAllowed.Error(),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("BindAddress", tc.mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+				MDLAddress: tc.mdlAddr,
+				Address:    depositAddr,
+				CoinType:   scanner.CoinTypeSKY,
+				BuyMethod:  config.BuyMethodDirect,
+			}, nil)
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{depositAddr}, scanner.CoinTypeSKY)
+			require.NoError(t, err)
+
+			cfg := config.Config{
+				SkyRPC: config.SkyRPC{
+					Enabled: true,
+				},
+				Teller: config.Teller{
+					BindEnabled: true,
+				},
+				MDLExchanger: config.MDLExchanger{
+					SendEnabled: true,
+				},
+			}
+			if tc.blocklist {
+				cfg.Teller.MDLAddressBlocklist = blocklistPath
+			}
+			if tc.allowlist {
+				cfg.Teller.MDLAddressAllowlist = allowlistPath
+			}
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  tc.mdlAddr,
+				CoinType: scanner.CoinTypeSKY,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg:       cfg,
+				log:       log,
+				exchanger: e,
+				service:   NewService(log, cfg, e, addrManager),
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			e.AssertCalled(t, "BindAddress", tc.mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{})
+		})
+	}
+}
+
+func TestAddressList(t *testing.T) {
+	addr := "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW"
+	addr2 := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	dir, err := ioutil.TempDir("", "teller-address-lists")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "list.txt")
+	l := NewAddressList(path)
+
+	// A missing file is an error
+	_, err = l.Contains(addr)
+	require.Error(t, err)
+
+	err = ioutil.WriteFile(path, []byte("  "+addr+"  \n"), 0600)
+	require.NoError(t, err)
+
+	ok, err := l.Contains(addr)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = l.Contains(addr2)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// The file is read again once it is modified
+	err = ioutil.WriteFile(path, []byte(addr2+"\n"), 0600)
+	require.NoError(t, err)
+	modTime := time.Now().Add(time.Minute)
+	err = os.Chtimes(path, modTime, modTime)
+	require.NoError(t, err)
+
+	ok, err = l.Contains(addr)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = l.Contains(addr2)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// An invalid file is an error, and the list is not changed
+	err = ioutil.WriteFile(path, []byte(addr+"\nfoo\n"), 0600)
+	require.NoError(t, err)
+	modTime = modTime.Add(time.Minute)
+	err = os.Chtimes(path, modTime, modTime)
+	require.NoError(t, err)
+
+	_, err = l.Contains(addr)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 2: invalid mdl address \"foo\"")
+
+	_, ok = l.addrs[addr2]
+	require.True(t, ok)
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	statuses := []exchange.DepositStatus{
+		{
+			Seq:       0,
+			UpdatedAt: 1501137828,
+			Status:    exchange.StatusDone.String(),
+			CoinType:  scanner.CoinTypeSKY,
+		},
+	}
+
+	e := &fakeExchanger{}
+	e.On("GetDepositStatuses", mdlAddr).Return(statuses, nil)
+
+	log, _ := testutil.NewLogger(t)
+
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			ReadOnly: true,
+			Teller: config.Teller{
+				BindEnabled: true,
+			},
+			SkyRPC: config.SkyRPC{
+				Enabled: true,
+			},
+		},
+		log:       log,
+		exchanger: e,
+		service: &Service{
+			cfg: config.Teller{
+				BindEnabled: true,
+			},
+			sendEnabled: true,
+			exchanger:   e,
+			addrManager: addrs.NewAddrManager(),
+		},
+	}
+	handler := httpServ.setupMux()
+
+	// Bind is refused
+	d, err := json.Marshal(bindRequest{
+		MDLAddr:  mdlAddr,
+		CoinType: scanner.CoinTypeSKY,
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, ErrReadOnly.Error(), strings.TrimSpace(rr.Body.String()))
+	e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Status is served
+	req, err = http.NewRequest(http.MethodGet, "/api/status?mdladdr="+mdlAddr, nil)
+	require.NoError(t, err)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var rsp StatusResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+	require.NoError(t, err)
+	require.Equal(t, statuses, rsp.Statuses)
+}
+
+func TestStatusHandlerSince(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	before := []exchange.DepositStatus{
+		{
+			Seq:      0,
+			Version:  3,
+			Status:   exchange.StatusWaitSend.String(),
+			CoinType: scanner.CoinTypeBTC,
+		},
+		{
+			Seq:      1,
+			Version:  5,
+			Status:   exchange.StatusWaitDeposit.String(),
+			CoinType: scanner.CoinTypeSKY,
+		},
+	}
+
+	// The first deposit was sent, the second address is still waiting
+	after := []exchange.DepositStatus{
+		{
+			Seq:      0,
+			Version:  8,
+			Status:   exchange.StatusWaitConfirm.String(),
+			CoinType: scanner.CoinTypeBTC,
+		},
+		before[1],
+	}
+
+	log, _ := testutil.NewLogger(t)
+
+	getStatuses := func(statuses []exchange.DepositStatus, query string) (int, StatusResponse) {
+		e := &fakeExchanger{}
+		e.On("GetDepositStatuses", mdlAddr).Return(statuses, nil)
+
+		httpServ := &HTTPServer{
+			log:       log,
+			exchanger: e,
+			service: &Service{
+				exchanger: e,
+			},
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/api/status?mdladdr="+mdlAddr+query, nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		StatusHandler(httpServ).ServeHTTP(rr, req)
+
+		var rsp StatusResponse
+		if rr.Code == http.StatusOK {
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+		}
+		return rr.Code, rsp
+	}
+
+	// Without since, all statuses are returned
+	code, rsp := getStatuses(before, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, before, rsp.Statuses)
+	require.Equal(t, uint64(5), rsp.Version)
+
+	// Nothing changed since the last poll
+	code, rsp = getStatuses(before, "&since=5")
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, rsp.Statuses)
+	require.Equal(t, uint64(5), rsp.Version)
+
+	// After a state change only the changed deposit is returned
+	code, rsp = getStatuses(after, "&since=5")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, after[:1], rsp.Statuses)
+	require.Equal(t, uint64(8), rsp.Version)
+
+	code, rsp = getStatuses(after, "&since=4")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, after, rsp.Statuses)
+
+	code, _ = getStatuses(after, "&since=foo")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestEventsHandler(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	// The address was just bound
+	bound := []exchange.DepositStatus{
+		{
+			Seq:      0,
+			Version:  5,
+			Status:   exchange.StatusWaitDeposit.String(),
+			CoinType: scanner.CoinTypeBTC,
+		},
+	}
+
+	// A deposit was received
+	received := []exchange.DepositStatus{
+		{
+			Seq:      0,
+			Version:  8,
+			Status:   exchange.StatusWaitSend.String(),
+			CoinType: scanner.CoinTypeBTC,
+		},
+	}
+
+	e := &fakeExchanger{}
+	e.On("GetDepositStatuses", mdlAddr).Return(bound, nil).Once()
+	e.On("GetDepositStatuses", mdlAddr).Return(received, nil)
+
+	log, _ := testutil.NewLogger(t)
+	broker := events.NewBroker()
+
+	httpServ := &HTTPServer{
+		log:       log,
+		exchanger: e,
+		service: &Service{
+			exchanger: e,
+		},
+		events: broker,
+	}
+	server := httptest.NewServer(httpServ.setupMux())
+	defer server.Close()
+
+	rsp, err := http.Get(server.URL + "/api/events?mdladdr=" + mdlAddr)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "text/event-stream", rsp.Header.Get("Content-Type"))
+
+	body := bufio.NewReader(rsp.Body)
+
+	// readEvent reads the next event from the stream and returns its id and status
+	readEvent := func() (string, exchange.DepositStatus) {
+		var id, event, data string
+		for {
+			line, err := body.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+
+			switch {
+			case line == "":
+				require.Equal(t, "status", event)
+				var ds exchange.DepositStatus
+				err := json.Unmarshal([]byte(data), &ds)
+				require.NoError(t, err)
+				return id, ds
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+
+	// The current status is sent first
+	id, ds := readEvent()
+	require.Equal(t, "5", id)
+	require.Equal(t, bound[0], ds)
+
+	// Events of other addresses are ignored
+	err = broker.Publish(events.Event{
+		Type:       events.DepositRecorded,
+		MDLAddress: "other",
+	})
+	require.NoError(t, err)
+
+	err = broker.Publish(events.Event{
+		Type:       events.DepositRecorded,
+		MDLAddress: mdlAddr,
+		Status:     exchange.StatusWaitSend.String(),
+	})
+	require.NoError(t, err)
+
+	id, ds = readEvent()
+	require.Equal(t, "8", id)
+	require.Equal(t, received[0], ds)
+
+	// An invalid since is rejected
+	req, err := http.NewRequest(http.MethodGet, "/api/events?mdladdr="+mdlAddr+"&since=foo", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	httpServ.setupMux().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Disabled
+	disabledServ := &HTTPServer{
+		log:       log,
+		exchanger: e,
+	}
+	req, err = http.NewRequest(http.MethodGet, "/api/events?mdladdr="+mdlAddr, nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	disabledServ.setupMux().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestBindHandlerCoinDisabledMessage(t *testing.T) {
+	tt := []struct {
+		name     string
+		coinType string
+		template string
+		err      string
+	}{
+		{
+			name:     "default message",
+			coinType: scanner.CoinTypeBTC,
+			err:      "Oops, there seems to be an issue. The selected coin type BTC is not enabled. We are working on a fix, please try again in a couple of hours",
+		},
+		{
+			name:     "default message WAVES MDL",
+			coinType: scanner.CoinTypeWAVESMDL,
+			err:      "Oops, there seems to be an issue. The selected coin type MDL.life is not enabled. We are working on a fix, please try again in a couple of hours",
+		},
+		{
+			name:     "configured message",
+			coinType: scanner.CoinTypeETH,
+			template: "Les dépôts {coin_type} sont temporairement désactivés",
+			err:      "Les dépôts ETH sont temporairement désactivés",
+		},
+		{
+			name:     "configured message without placeholder",
+			coinType: scanner.CoinTypeSKY,
+			template: "This coin is not available",
+			err:      "This coin is not available",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT",
+				CoinType: tc.coinType,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			e := &fakeExchanger{}
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					Teller: config.Teller{
+						BindEnabled:         true,
+						CoinDisabledMessage: tc.template,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: true,
+					},
+					exchanger: e,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+			e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+type fakeRunningScanners map[string]bool
+
+func (s fakeRunningScanners) ValidateCoinType(coinType string) error {
+	if !s[coinType] {
+		return errors.New("unknown cointype")
+	}
+	return nil
+}
+
+func TestBindHandlerNoScanner(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+	depositAddr := "2do3K1YLMy3Aq6EcPMdncEurP5BfAUdFPJj"
+
+	tt := []struct {
+		name     string
+		scanners RunningScanners
+		template string
+		status   int
+		err      string
+	}{
+		{
+			name:     "200 scanner running",
+			scanners: fakeRunningScanners{scanner.CoinTypeSKY: true},
+			status:   http.StatusOK,
+		},
+		{
+			name:   "200 scanners not checked",
+			status: http.StatusOK,
+		},
+		{
+			name:     "503 no scanner default message",
+			scanners: fakeRunningScanners{scanner.CoinTypeBTC: true},
+			status:   http.StatusServiceUnavailable,
+			err:      "Deposits of SKY can't be processed at the moment. We are working on a fix, please try again in a couple of hours",
+		},
+		{
+			name:     "503 no scanner configured message",
+			scanners: fakeRunningScanners{},
+			template: "{coin_type} deposits are paused",
+			status:   http.StatusServiceUnavailable,
+			err:      "SKY deposits are paused",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &fakeExchanger{}
+			e.On("BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+				MDLAddress: mdlAddr,
+				Address:    depositAddr,
+				CoinType:   scanner.CoinTypeSKY,
+				BuyMethod:  config.BuyMethodDirect,
+			}, nil)
+
+			addrManager := addrs.NewAddrManager()
+			err := addrManager.PushGenerator(fakeAddrGenerator{depositAddr}, scanner.CoinTypeSKY)
+			require.NoError(t, err)
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  mdlAddr,
+				CoinType: scanner.CoinTypeSKY,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					Teller: config.Teller{
+						NoScannerMessage: tc.template,
+					},
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+				},
+				log:       log,
+				exchanger: e,
+				scanners:  tc.scanners,
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: true,
+					},
+					sendEnabled: true,
+					exchanger:   e,
+					addrManager: addrManager,
+				},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+
+			if tc.status != http.StatusOK {
+				require.Equal(t, tc.err, strings.TrimSpace(rr.Body.String()))
+				e.AssertNotCalled(t, "BindAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			e.AssertCalled(t, "BindAddress", mdlAddr, depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{})
+		})
+	}
+}
+
+func TestLabelsHandler(t *testing.T) {
+	labels := []string{"Bitcoin", "Ethereum", "Skycoin", "Custom Coin"}
+
+	tt := []struct {
+		name   string
+		method string
+		url    string
+		status int
+		lang   string
+		coins  map[string]string
+	}{
+		{
+			name:   "405",
+			method: http.MethodPost,
+			url:    "/api/labels",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "200 default english",
+			method: http.MethodGet,
+			url:    "/api/labels",
+			status: http.StatusOK,
+			lang:   "en",
+			coins: map[string]string{
+				"Bitcoin":     "Bitcoin",
+				"Ethereum":    "Ethereum",
+				"Skycoin":     "Skycoin",
+				"Custom Coin": "Custom Coin",
+			},
+		},
+		{
+			name:   "200 supported language",
+			method: http.MethodGet,
+			url:    "/api/labels?lang=ru-RU",
+			status: http.StatusOK,
+			lang:   "ru",
+			coins: map[string]string{
+				"Bitcoin":     "Биткоин",
+				"Ethereum":    "Эфириум",
+				"Skycoin":     "Скайкоин",
+				"Custom Coin": "Custom Coin",
+			},
+		},
+		{
+			name:   "200 unsupported language falls back to english",
+			method: http.MethodGet,
+			url:    "/api/labels?lang=fr",
+			status: http.StatusOK,
+			lang:   "en",
+			coins: map[string]string{
+				"Bitcoin":     "Bitcoin",
+				"Ethereum":    "Ethereum",
+				"Skycoin":     "Skycoin",
+				"Custom Coin": "Custom Coin",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+
+			log, _ := testutil.NewLogger(t)
+
+			rr := httptest.NewRecorder()
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					MDLExchanger: config.MDLExchanger{
+						MDLBtcExchangeLabel:   labels[0],
+						MDLEthExchangeLabel:   labels[1],
+						MDLSkyExchangeLabel:   labels[2],
+						MDLWavesExchangeLabel: labels[3],
+						// An unset label is not listed
+						MDLWavesMDLExchangeLabel: "",
+					},
+				},
+				log:       log,
+				exchanger: &fakeExchanger{},
+			}
+			handler := httpServ.setupMux()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var rsp LabelsResponse
+			err = json.Unmarshal(rr.Body.Bytes(), &rsp)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.lang, rsp.Lang)
+			require.Equal(t, tc.coins, rsp.Coins)
+
+			// The coins are keyed by the configured labels
+			for _, c := range httpServ.supportedCrypto() {
+				if c.Label == "" {
+					continue
+				}
+				_, ok := rsp.Coins[c.Label]
+				require.True(t, ok)
+			}
+			require.Len(t, rsp.Coins, len(labels))
+
+			_, bundle := i18n.Lookup(tc.lang)
+			require.Equal(t, bundle.Statuses, rsp.Statuses)
+			require.NotEmpty(t, rsp.Statuses[exchange.StatusWaitDeposit.String()])
+		})
+	}
+}
+
+func TestConcurrencyLimitPerIP(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	// Balance blocks until released, keeping ConfigHandler requests in flight
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	e := &fakeExchanger{}
+	e.On("Balance").Return(nil, errors.New("balance unavailable")).Run(func(mock.Arguments) {
+		started <- struct{}{}
+		<-release
+	})
+
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			MDLExchanger: config.MDLExchanger{
+				MDLBtcExchangeRate:      "1",
+				MDLEthExchangeRate:      "1",
+				MDLSkyExchangeRate:      "1",
+				MDLWavesExchangeRate:    "1",
+				MDLWavesMDLExchangeRate: "1",
+			},
+			Web: config.Web{
+				MaxConcurrentPerIP: 2,
+			},
+		},
+		log:       log,
+		exchanger: e,
+	}
+	handler := httpServ.setupMux()
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/api/config", nil)
+		require.NoError(t, err)
+		req.RemoteAddr = remoteAddr
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	waitStarted := func() {
+		select {
+		case <-started:
+		case <-time.After(time.Second * 3):
+			t.Fatal("Waiting for request to start timed out")
+		}
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	inFlight := func(remoteAddr string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serve(remoteAddr).Code
+		}()
+		waitStarted()
+	}
+
+	// Fill the limit for one IP, from different ports
+	inFlight("1.2.3.4:1000")
+	inFlight("1.2.3.4:1001")
+
+	// Another request from the same IP is rejected
+	rr := serve("1.2.3.4:1002")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "Too many concurrent requests", strings.TrimSpace(rr.Body.String()))
+
+	// Another IP is unaffected
+	inFlight("5.6.7.8:1000")
+
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		require.Equal(t, http.StatusOK, code)
+	}
+
+	// Once the requests finish, the IP can make requests again
+	rr = serve("1.2.3.4:1003")
+	require.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestServiceBindAddressRetries(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	tt := []struct {
+		name        string
+		bindRetries int
+		err         error
+		depositAddr string
+	}{
+		{
+			name:        "no retries",
+			bindRetries: 0,
+			err:         exchange.ErrAddressAlreadyBound,
+		},
+		{
+			name:        "retried with the next address",
+			bindRetries: 1,
+			depositAddr: "addr-2",
+		},
+		{
+			name:        "pool emptied by retries",
+			bindRetries: 5,
+			err:         addrs.ErrDepositAddressEmpty,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+
+			a, err := addrs.NewAddrs(log, db, []string{"addr-1", "addr-2"}, "test_bucket")
+			require.NoError(t, err)
+
+			addrManager := addrs.NewAddrManager()
+			err = addrManager.PushGenerator(a, scanner.CoinTypeSKY)
+			require.NoError(t, err)
+
+			e := &fakeExchanger{}
+			e.On("BindAddress", mdlAddr, "addr-1", scanner.CoinTypeSKY, exchange.BindOptions{}).Return(nil, exchange.ErrAddressAlreadyBound)
+			if tc.depositAddr != "" {
+				e.On("BindAddress", mdlAddr, tc.depositAddr, scanner.CoinTypeSKY, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+					MDLAddress: mdlAddr,
+					Address:    tc.depositAddr,
+					CoinType:   scanner.CoinTypeSKY,
+				}, nil)
+			} else {
+				e.On("BindAddress", mdlAddr, "addr-2", scanner.CoinTypeSKY, exchange.BindOptions{}).Return(nil, exchange.ErrAddressAlreadyBound)
+			}
+
+			service := &Service{
+				cfg: config.Teller{
+					BindEnabled: true,
+					BindRetries: tc.bindRetries,
+				},
+				sendEnabled: true,
+				exchanger:   e,
+				addrManager: addrManager,
+			}
+
+			boundAddr, err := service.BindAddress(context.Background(), mdlAddr, scanner.CoinTypeSKY, exchange.BindOptions{})
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.depositAddr, boundAddr.Address)
+		})
+	}
+}
+
+type fakeAddressBalances struct {
+	balances map[string]int64
+	err      error
+}
+
+func (b fakeAddressBalances) AddressBalance(ctx context.Context, coinType, addr string) (int64, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.balances[addr], nil
+}
+
+func TestServiceBindAddressEthBalanceCheck(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	tt := []struct {
+		name         string
+		check        string
+		bindRetries  int
+		balances     map[string]int64
+		balancesErr  error
+		err          error
+		depositAddr  string
+		warnedFunded bool
+	}{
+		{
+			name:        "clean address",
+			check:       config.BindBalanceCheckReject,
+			depositAddr: "eth-addr-1",
+		},
+		{
+			name:        "pre-funded address not checked",
+			balances:    map[string]int64{"eth-addr-1": 1e9},
+			depositAddr: "eth-addr-1",
+		},
+		{
+			name:         "pre-funded address warned",
+			check:        config.BindBalanceCheckWarn,
+			balances:     map[string]int64{"eth-addr-1": 1e9},
+			depositAddr:  "eth-addr-1",
+			warnedFunded: true,
+		},
+		{
+			name:     "pre-funded address rejected",
+			check:    config.BindBalanceCheckReject,
+			balances: map[string]int64{"eth-addr-1": 1e9},
+			err:      ErrDepositAddressFunded,
+		},
+		{
+			name:        "pre-funded address skipped for the next address",
+			check:       config.BindBalanceCheckReject,
+			bindRetries: 1,
+			balances:    map[string]int64{"eth-addr-1": 1e9},
+			depositAddr: "eth-addr-2",
+		},
+		{
+			name:        "balance unavailable rejected",
+			check:       config.BindBalanceCheckReject,
+			balancesErr: errors.New("geth unavailable"),
+			err:         errors.New("geth unavailable"),
+		},
+		{
+			name:        "balance unavailable warned",
+			check:       config.BindBalanceCheckWarn,
+			balancesErr: errors.New("geth unavailable"),
+			depositAddr: "eth-addr-1",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, hook := testutil.NewLogger(t)
+
+			a, err := addrs.NewAddrs(log, db, []string{"eth-addr-1", "eth-addr-2"}, "test_bucket")
+			require.NoError(t, err)
+
+			addrManager := addrs.NewAddrManager()
+			err = addrManager.PushGenerator(a, scanner.CoinTypeETH)
+			require.NoError(t, err)
+
+			e := &fakeExchanger{}
+			if tc.depositAddr != "" {
+				e.On("BindAddress", mdlAddr, tc.depositAddr, scanner.CoinTypeETH, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+					MDLAddress: mdlAddr,
+					Address:    tc.depositAddr,
+					CoinType:   scanner.CoinTypeETH,
+				}, nil)
+			}
+
+			service := &Service{
+				log: log,
+				cfg: config.Teller{
+					BindEnabled:         true,
+					BindRetries:         tc.bindRetries,
+					EthBindBalanceCheck: tc.check,
+				},
+				sendEnabled: true,
+				exchanger:   e,
+				addrManager: addrManager,
+				balances: fakeAddressBalances{
+					balances: tc.balances,
+					err:      tc.balancesErr,
+				},
+			}
+
+			boundAddr, err := service.BindAddress(context.Background(), mdlAddr, scanner.CoinTypeETH, exchange.BindOptions{})
+
+			warnedFunded := false
+			for _, entry := range hook.AllEntries() {
+				if entry.Message == "Deposit address already holds funds" {
+					warnedFunded = true
+				}
+			}
+			require.Equal(t, tc.warnedFunded, warnedFunded)
+
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				e.AssertNotCalled(t, "BindAddress", mdlAddr, "eth-addr-1", scanner.CoinTypeETH, exchange.BindOptions{})
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.depositAddr, boundAddr.Address)
+		})
+	}
+}
+
+func TestServiceBindAddressMaxBoundPerCoin(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	tt := []struct {
+		name     string
+		coinType string
+		boundNum int
+		err      error
+	}{
+		{
+			name:     "btc below its limit",
+			coinType: scanner.CoinTypeBTC,
+			boundNum: 1,
+		},
+		{
+			name:     "btc at its limit",
+			coinType: scanner.CoinTypeBTC,
+			boundNum: 2,
+			err:      ErrMaxBoundAddresses,
+		},
+		{
+			name:     "eth below its limit, above the btc limit",
+			coinType: scanner.CoinTypeETH,
+			boundNum: 4,
+		},
+		{
+			name:     "eth at its limit",
+			coinType: scanner.CoinTypeETH,
+			boundNum: 5,
+			err:      ErrMaxBoundAddresses,
+		},
+		{
+			name:     "sky unlimited",
+			coinType: scanner.CoinTypeSKY,
+			boundNum: 100,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, shutdown := testutil.PrepareDB(t)
+			defer shutdown()
+
+			log, _ := testutil.NewLogger(t)
+
+			a, err := addrs.NewAddrs(log, db, []string{"addr-1"}, "test_bucket")
+			require.NoError(t, err)
+
+			addrManager := addrs.NewAddrManager()
+			err = addrManager.PushGenerator(a, tc.coinType)
+			require.NoError(t, err)
+
+			e := &fakeExchanger{}
+			e.On("GetCoinBindNum", mdlAddr, tc.coinType).Return(tc.boundNum, nil)
+			e.On("BindAddress", mdlAddr, "addr-1", tc.coinType, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+				MDLAddress: mdlAddr,
+				Address:    "addr-1",
+				CoinType:   tc.coinType,
+			}, nil)
+
+			service := &Service{
+				cfg: config.Teller{
+					BindEnabled: true,
+					// The per-coin limits override the global limit
+					MaxBoundAddresses: 1,
+					MaxBoundAddressesPerCoin: map[string]int{
+						scanner.CoinTypeBTC: 2,
+						scanner.CoinTypeETH: 5,
+						scanner.CoinTypeSKY: 0,
+					},
+				},
+				sendEnabled: true,
+				exchanger:   e,
+				addrManager: addrManager,
+			}
+
+			boundAddr, err := service.BindAddress(context.Background(), mdlAddr, tc.coinType, exchange.BindOptions{})
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, "addr-1", boundAddr.Address)
+			e.AssertNotCalled(t, "GetBindNum", mdlAddr)
+		})
+	}
+}
+
+// boundCountingExchanger counts the addresses bound by BindAddress in GetBindNum
+type boundCountingExchanger struct {
+	fakeExchanger
+
+	mu    sync.Mutex
+	bound int
+}
+
+func (e *boundCountingExchanger) BindAddress(ctx context.Context, mdlAddr, depositAddr, coinType string, opts exchange.BindOptions) (*exchange.BoundAddress, error) {
+	// Leave time for a concurrent bind to pass the max bound addresses check
+	time.Sleep(10 * time.Millisecond)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bound++
+
+	return &exchange.BoundAddress{
+		MDLAddress: mdlAddr,
+		Address:    depositAddr,
+		CoinType:   coinType,
+	}, nil
+}
+
+func (e *boundCountingExchanger) GetBindNum(mdlAddr string) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.bound, nil
+}
+
+func TestServiceBindAddressConcurrentMaxBound(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	addrManager := addrs.NewAddrManager()
+	err := addrManager.PushGenerator(fakeAddrGenerator{"addr-1"}, scanner.CoinTypeBTC)
+	require.NoError(t, err)
+
+	e := &boundCountingExchanger{}
+	service := &Service{
+		cfg: config.Teller{
+			BindEnabled:       true,
+			MaxBoundAddresses: 1,
+		},
+		sendEnabled: true,
+		exchanger:   e,
+		addrManager: addrManager,
+	}
+
+	n := 10
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.BindAddress(context.Background(), mdlAddr, scanner.CoinTypeBTC, exchange.BindOptions{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var bound int
+	for err := range errs {
+		if err == nil {
+			bound++
+			continue
+		}
+		require.Equal(t, ErrMaxBoundAddresses, err)
+	}
+
+	require.Equal(t, 1, bound)
+	require.Equal(t, 1, e.bound)
+
+	// The locks of finished binds are removed
+	require.Empty(t, service.bindLocks.locks)
+}
+
+func TestServiceBindAddressBindLockContextDone(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	var l bindLocks
+	unlock, err := l.lock(context.Background(), mdlAddr)
+	require.NoError(t, err)
+
+	// A bind waiting for the lock gives up once its request is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.lock(ctx, mdlAddr)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// Other mdl addresses aren't locked
+	unlock2, err := l.lock(context.Background(), "2Wbi4wvxC4fkTYMsS2f6HaFfW4pafDjXcQW")
+	require.NoError(t, err)
+	unlock2()
+
+	unlock()
+	require.Empty(t, l.locks)
+
+	unlock, err = l.lock(context.Background(), mdlAddr)
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestServiceBindAddressCoinDeprecated(t *testing.T) {
+	mdlAddr := "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT"
+
+	db, shutdown := testutil.PrepareDB(t)
+	defer shutdown()
+
+	log, _ := testutil.NewLogger(t)
+
+	addrManager := addrs.NewAddrManager()
+	for _, coinType := range []string{scanner.CoinTypeBTC, scanner.CoinTypeSKY} {
+		a, err := addrs.NewAddrs(log, db, []string{"addr-" + coinType}, "test_bucket_"+coinType)
+		require.NoError(t, err)
+		err = addrManager.PushGenerator(a, coinType)
+		require.NoError(t, err)
+	}
+
+	e := &fakeExchanger{
+		deprecations: map[string]exchange.CoinDeprecation{
+			scanner.CoinTypeBTC: {
+				CoinType: scanner.CoinTypeBTC,
+				Stage:    exchange.CoinStageDeprecated,
+			},
+		},
+	}
+	e.On("BindAddress", mdlAddr, "addr-"+scanner.CoinTypeSKY, scanner.CoinTypeSKY, exchange.BindOptions{}).Return(&exchange.BoundAddress{
+		MDLAddress: mdlAddr,
+		Address:    "addr-" + scanner.CoinTypeSKY,
+		CoinType:   scanner.CoinTypeSKY,
+	}, nil)
+
+	service := &Service{
+		cfg: config.Teller{
+			BindEnabled: true,
+		},
+		sendEnabled: true,
+		exchanger:   e,
+		addrManager: addrManager,
+	}
+
+	_, err := service.BindAddress(context.Background(), mdlAddr, scanner.CoinTypeBTC, exchange.BindOptions{})
+	require.Equal(t, exchange.ErrCoinDeprecated, err)
+	require.Equal(t, exchange.ErrCoinDeprecated, service.CheckBindable(scanner.CoinTypeBTC))
+
+	// Other coin types are unaffected
+	boundAddr, err := service.BindAddress(context.Background(), mdlAddr, scanner.CoinTypeSKY, exchange.BindOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "addr-"+scanner.CoinTypeSKY, boundAddr.Address)
+	require.NoError(t, service.CheckBindable(scanner.CoinTypeSKY))
+
+	// Binds are allowed again once the deprecation is cancelled
+	e.deprecations = nil
+	require.NoError(t, service.CheckBindable(scanner.CoinTypeBTC))
+}
+
+func TestLogSampleRate(t *testing.T) {
+	log, hook := testutil.NewLogger(t)
+
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			Web: config.Web{
+				LogSampleRate: 3,
+			},
+		},
+		log:       log,
+		exchanger: &fakeExchanger{},
+	}
+	handler := httpServ.setupMux()
+
+	ping := func(method string, n int) {
+		for i := 0; i < n; i++ {
+			req, err := http.NewRequest(method, "/api/ping", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+		}
+	}
+
+	loggedRequests := func() []int {
+		var statuses []int
+		for _, e := range hook.AllEntries() {
+			if e.Message == "HTTP Request" {
+				statuses = append(statuses, e.Data["status"].(int))
+			}
+		}
+		hook.Reset()
+		return statuses
+	}
+
+	// 1 in 3 successful requests is logged, starting with the first
+	ping(http.MethodGet, 7)
+	require.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusOK}, loggedRequests())
+
+	// Failed requests are always logged
+	ping(http.MethodPost, 4)
+	require.Equal(t, []int{
+		http.StatusMethodNotAllowed,
+		http.StatusMethodNotAllowed,
+		http.StatusMethodNotAllowed,
+		http.StatusMethodNotAllowed,
+	}, loggedRequests())
+
+	// Every request is logged without sampling
+	httpServ.cfg.Web.LogSampleRate = 0
+	handler = httpServ.setupMux()
+	ping(http.MethodGet, 2)
+	require.Equal(t, []int{http.StatusOK, http.StatusOK}, loggedRequests())
+}
+
+func TestListenerTimeouts(t *testing.T) {
+	log, _ := testutil.NewLogger(t)
+
+	httpServ := &HTTPServer{
+		cfg: config.Config{
+			Web: config.Web{
+				HTTPAddr:          "127.0.0.1:7071",
+				HTTPSAddr:         "127.0.0.1:7443",
+				HTTPReadTimeout:   time.Second * 5,
+				HTTPWriteTimeout:  time.Second * 55,
+				HTTPIdleTimeout:   time.Second * 90,
+				HTTPSReadTimeout:  time.Second * 15,
+				HTTPSWriteTimeout: time.Second * 75,
+				HTTPSIdleTimeout:  time.Second * 180,
+			},
+		},
+		log:       log,
+		exchanger: &fakeExchanger{},
+	}
+	mux := httpServ.setupMux()
+
+	httpListener := httpServ.newHTTPListener(mux)
+	require.Equal(t, "127.0.0.1:7071", httpListener.Addr)
+	require.Equal(t, time.Second*5, httpListener.ReadTimeout)
+	require.Equal(t, time.Second*55, httpListener.WriteTimeout)
+	require.Equal(t, time.Second*90, httpListener.IdleTimeout)
+
+	httpsListener := httpServ.newHTTPSListener(mux)
+	require.Equal(t, "127.0.0.1:7443", httpsListener.Addr)
+	require.Equal(t, time.Second*15, httpsListener.ReadTimeout)
+	require.Equal(t, time.Second*75, httpsListener.WriteTimeout)
+	require.Equal(t, time.Second*180, httpsListener.IdleTimeout)
+}
+
+func TestBindHandlerMDLAddressFormat(t *testing.T) {
+	formats, err := addrs.NewFormats(map[string]string{
+		addrs.FormatMDL: "[1-9A-HJ-NP-Za-km-z]{25,35}",
+	})
+	require.NoError(t, err)
+
+	tt := []struct {
+		name   string
+		addr   string
+		status int
+		err    string
+	}{
+		{
+			name:   "garbage rejected by the format",
+			addr:   "not an address!",
+			status: http.StatusBadRequest,
+			err:    "Invalid mdl address: address does not match the expected format",
+		},
+		{
+			name:   "matching the format but not an mdl address",
+			addr:   "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoX",
+			status: http.StatusBadRequest,
+			err:    "Invalid mdl address: ",
+		},
+		{
+			name:   "valid address passes through to the bind",
+			addr:   "2fFvHziBN2DKCnJRF1sjJ81z2kAJK8idSoT",
+			status: http.StatusForbidden,
+			err:    "Address binding is disabled",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			log, _ := testutil.NewLogger(t)
+
+			httpServ := &HTTPServer{
+				cfg: config.Config{
+					SkyRPC: config.SkyRPC{
+						Enabled: true,
+					},
+				},
+				log:       log,
+				exchanger: &fakeExchanger{},
+				service: &Service{
+					cfg: config.Teller{
+						BindEnabled: false,
+					},
+				},
+				mdlAddrFormat: formats[addrs.FormatMDL],
+			}
+			handler := httpServ.setupMux()
+
+			d, err := json.Marshal(bindRequest{
+				MDLAddr:  tc.addr,
+				CoinType: scanner.CoinTypeSKY,
+			})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, "/api/bind", bytes.NewBuffer(d))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.status, rr.Code)
+			body := strings.TrimSpace(rr.Body.String())
+			require.True(t, strings.HasPrefix(body, tc.err), body)
+
+			// An address matching the format is fully decoded
+			if tc.addr != "not an address!" {
+				require.NotContains(t, body, addrs.ErrAddressFormat.Error())
+			}
+		})
+	}
+}
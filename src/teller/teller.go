@@ -1,13 +1,18 @@
 package teller
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/MDLlife/teller/src/addrs"
 	"github.com/MDLlife/teller/src/config"
+	"github.com/MDLlife/teller/src/events"
 	"github.com/MDLlife/teller/src/exchange"
+	"github.com/MDLlife/teller/src/scanner"
 )
 
 var (
@@ -15,8 +20,34 @@ var (
 	ErrMaxBoundAddresses = errors.New("The maximum number of addresses have been assigned to this MDL address")
 	// ErrBindDisabled is returned if address binding is disabled
 	ErrBindDisabled = errors.New("Address binding is disabled")
+	// ErrPayoutsDisabled is returned if sending is disabled and prebinding is not allowed
+	ErrPayoutsDisabled = errors.New("Address binding is unavailable until payouts are enabled")
+	// ErrReadOnly is returned if teller is running in read-only mode
+	ErrReadOnly = errors.New("Address binding is unavailable, teller is running in read-only mode")
+	// ErrExchangeDisabled is returned if the exchange of a coin type is disabled in the UI
+	ErrExchangeDisabled = errors.New("The exchange of this coin type is disabled")
+	// ErrNodeUnavailable is returned if the scanner of a coin type can't reach its node
+	ErrNodeUnavailable = errors.New("The node of this coin type is unavailable")
+	// ErrMDLAddressBlocked is returned if the mdl address is in the teller.mdl_address_blocklist
+	ErrMDLAddressBlocked = errors.New("This MDL address is blocked from binding")
+	// ErrMDLAddressNotAllowed is returned if a teller.mdl_address_allowlist is configured and the mdl address is not in it
+	ErrMDLAddressNotAllowed = errors.New("This MDL address is not allowed to bind")
+	// ErrLowBalance is returned if the MDL hot wallet balance is below teller.min_bind_balance
+	ErrLowBalance = errors.New("Address binding is temporarily unavailable, please try again later")
+	// ErrDepositAddressFunded is returned if the deposit addresses drawn for a bind already hold funds
+	// and teller.eth_bind_balance_check is config.BindBalanceCheckReject
+	ErrDepositAddressFunded = errors.New("No unused deposit address is available, please try again later")
 )
 
+// BindCooldownError is returned if the mdl address bound an address less than teller.bind_cooldown ago
+type BindCooldownError struct {
+	RetryAfter time.Duration // How long until the mdl address can bind again
+}
+
+func (e BindCooldownError) Error() string {
+	return "An address was bound to this MDL address too recently, please try again later"
+}
+
 // Teller provides the HTTP and teller service
 type Teller struct {
 	cfg      config.Teller
@@ -26,21 +57,89 @@ type Teller struct {
 	done     chan struct{}
 }
 
-// New creates a Teller
-func New(log logrus.FieldLogger, exchanger exchange.Exchanger, addrManager *addrs.AddrManager, cfg config.Config) *Teller {
+// ScannerHeights reports the heights of the enabled scanners
+type ScannerHeights interface {
+	Heights() []scanner.CoinHeights
+}
+
+// USDRateFeed provides live USD exchange rates of the supported coins, shown in /api/config
+type USDRateFeed interface {
+	// USDRate returns the USD rate of coinType and when it was fetched
+	USDRate(coinType string) (string, time.Time, error)
+}
+
+// NetworkFees suggests network fees for deposits, shown in /api/config
+type NetworkFees interface {
+	// FeeEstimates returns the suggested network fees, keyed by coin type. Coins without an estimate are left out
+	FeeEstimates() map[string]scanner.FeeEstimate
+}
+
+// AddressBalances reads the balance of deposit addresses, for teller.eth_bind_balance_check
+type AddressBalances interface {
+	// AddressBalance returns scanner.ErrAddressBalanceUnavailable if the balances of coinType can't be read
+	AddressBalance(ctx context.Context, coinType, addr string) (int64, error)
+}
+
+// RunningScanners reports which coin types have a running scanner
+type RunningScanners interface {
+	// ValidateCoinType returns an error if no scanner of coinType is running
+	ValidateCoinType(coinType string) error
+}
+
+// DepositEvents streams the deposit events that /api/events reacts to
+type DepositEvents interface {
+	Subscribe() (<-chan events.Event, func())
+}
+
+// New creates a Teller. heights may be nil if no scanners are running
+func New(log logrus.FieldLogger, exchanger exchange.Exchanger, addrManager *addrs.AddrManager, heights ScannerHeights, cfg config.Config) *Teller {
 	return &Teller{
-		cfg:  cfg.Teller,
-		log:  log.WithField("prefix", "teller"),
-		quit: make(chan struct{}),
-		done: make(chan struct{}),
-		httpServ: NewHTTPServer(log, cfg.Redacted(), &Service{
-			cfg:         cfg.Teller,
-			exchanger:   exchanger,
-			addrManager: addrManager,
-		}, exchanger),
+		cfg:      cfg.Teller,
+		log:      log.WithField("prefix", "teller"),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		httpServ: NewHTTPServer(log, cfg.Redacted(), NewService(log, cfg, exchanger, addrManager), exchanger, heights),
 	}
 }
 
+// SetUSDRateFeed attaches a live USD rate feed. The configured mdl_*_exchange_rate_usd rates become the fallback
+// for rates the feed can't provide, or that are older than mdl_exchanger.usd_rate_max_age.
+// Must be called before Run
+func (s *Teller) SetUSDRateFeed(feed USDRateFeed) {
+	s.httpServ.usdRates = feed
+}
+
+// SetNetworkFees attaches the source of the suggested network fees shown in /api/config.
+// Must be called before Run
+func (s *Teller) SetNetworkFees(fees NetworkFees) {
+	s.httpServ.fees = newFeesCache(fees, feesCacheTTL)
+}
+
+// SetDepositEvents attaches the deposit events streamed by /api/events.
+// Must be called before Run
+func (s *Teller) SetDepositEvents(evs DepositEvents) {
+	s.httpServ.events = evs
+}
+
+// SetRunningScanners attaches the scanners that binds are checked against, so that an enabled coin type
+// whose scanner is not running is rejected with teller.no_scanner_message.
+// Must be called before Run
+func (s *Teller) SetRunningScanners(scanners RunningScanners) {
+	s.httpServ.scanners = scanners
+}
+
+// SetAddressBalances attaches the source of the deposit address balances checked by teller.eth_bind_balance_check.
+// Must be called before Run
+func (s *Teller) SetAddressBalances(balances AddressBalances) {
+	s.httpServ.service.balances = balances
+}
+
+// SetAddressFormats attaches the address formats of teller.address_formats, the MDL format is checked before
+// an mdl address is decoded. Must be called before Run
+func (s *Teller) SetAddressFormats(formats addrs.Formats) {
+	s.httpServ.mdlAddrFormat = formats[addrs.FormatMDL]
+}
+
 // Run starts the Teller
 func (s *Teller) Run() error {
 	log := s.log.WithField("config", s.cfg)
@@ -73,19 +172,126 @@ func (s *Teller) Shutdown() {
 
 // Service combines Exchanger and AddrGenerator
 type Service struct {
+	log         logrus.FieldLogger
 	cfg         config.Teller
+	sendEnabled bool               // whether MDL payouts are live
 	exchanger   exchange.Exchanger // exchange Teller client
 	addrManager *addrs.AddrManager // address manager
+	balances    AddressBalances    // deposit address balances, nil if not set
+
+	blocklist *AddressList // mdl addresses that can't bind, nil if not configured
+	allowlist *AddressList // mdl addresses that can bind, nil if not configured
+
+	bindLocks bindLocks // serializes the binds of each mdl address
+}
+
+// bindLocks holds a lock for each mdl address that is binding
+type bindLocks struct {
+	sync.Mutex
+	locks map[string]*bindLock
+}
+
+type bindLock struct {
+	c    chan struct{}
+	refs int
+}
+
+// lock waits until no other bind of mdlAddr is in progress, or until ctx is done.
+// It returns a function that releases the lock
+func (l *bindLocks) lock(ctx context.Context, mdlAddr string) (func(), error) {
+	l.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*bindLock)
+	}
+	bl, ok := l.locks[mdlAddr]
+	if !ok {
+		bl = &bindLock{
+			c: make(chan struct{}, 1),
+		}
+		l.locks[mdlAddr] = bl
+	}
+	bl.refs++
+	l.Unlock()
+
+	deref := func() {
+		l.Lock()
+		defer l.Unlock()
+		bl.refs--
+		if bl.refs == 0 {
+			delete(l.locks, mdlAddr)
+		}
+	}
+
+	select {
+	case bl.c <- struct{}{}:
+		return func() {
+			<-bl.c
+			deref()
+		}, nil
+	case <-ctx.Done():
+		deref()
+		return nil, ctx.Err()
+	}
+}
+
+// NewService creates a Service
+func NewService(log logrus.FieldLogger, cfg config.Config, exchanger exchange.Exchanger, addrManager *addrs.AddrManager) *Service {
+	s := &Service{
+		log:         log.WithField("prefix", "teller.service"),
+		cfg:         cfg.Teller,
+		sendEnabled: cfg.MDLExchanger.SendEnabled,
+		exchanger:   exchanger,
+		addrManager: addrManager,
+	}
+
+	if cfg.Teller.MDLAddressBlocklist != "" {
+		s.blocklist = NewAddressList(cfg.Teller.MDLAddressBlocklist)
+	}
+
+	if cfg.Teller.MDLAddressAllowlist != "" {
+		s.allowlist = NewAddressList(cfg.Teller.MDLAddressAllowlist)
+	}
+
+	return s
 }
 
 // BindAddress binds mdl address with a deposit address according to coinType
-// return deposit address
-func (s *Service) BindAddress(mdlAddr, coinType string) (*exchange.BoundAddress, error) {
-	if !s.cfg.BindEnabled {
-		return nil, ErrBindDisabled
+// return deposit address. If opts.Label is set, the deposit address with this label is bound
+// if it is still available, otherwise the next one, see exchange.BindOptions.
+// Returns ctx.Err() if ctx is done before the address is bound, e.g. the bind request timed out
+func (s *Service) BindAddress(ctx context.Context, mdlAddr, coinType string, opts exchange.BindOptions) (*exchange.BoundAddress, error) {
+	if err := s.bindAllowed(); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkCoinActive(coinType); err != nil {
+		return nil, err
 	}
 
-	if s.cfg.MaxBoundAddresses > 0 {
+	// The cooldown and max bound addresses checks are only valid until the bind is saved,
+	// so concurrent binds of the same mdl address wait for each other
+	unlock, err := s.bindLocks.lock(ctx, mdlAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := s.checkBindCooldown(mdlAddr, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if maxCoinBound, ok := s.cfg.MaxBoundAddressesPerCoin[coinType]; ok {
+		if maxCoinBound > 0 {
+			num, err := s.exchanger.GetCoinBindNum(mdlAddr, coinType)
+			if err != nil {
+				return nil, err
+			}
+
+			if num >= maxCoinBound {
+				return nil, ErrMaxBoundAddresses
+			}
+		}
+	} else if s.cfg.MaxBoundAddresses > 0 {
 		num, err := s.exchanger.GetBindNum(mdlAddr)
 		if err != nil {
 			return nil, err
@@ -96,12 +302,196 @@ func (s *Service) BindAddress(mdlAddr, coinType string) (*exchange.BoundAddress,
 		}
 	}
 
-	depositAddr, err := s.addrManager.NewAddress(coinType)
+	// An issued deposit address may be bound already, e.g. if it was bound before the used address pool
+	// was lost or restored from an older db. Each attempt draws a new address from the pool,
+	// until the pool is empty and ErrDepositAddressEmpty is returned
+	for i := 0; ; i++ {
+		// Don't use up an address of the pool for a request that is done
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		depositAddr, err := s.addrManager.NewLabeledAddress(coinType, opts.Label)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.checkDepositAddressBalance(ctx, coinType, depositAddr); err != nil {
+			if err == ErrDepositAddressFunded && i < s.cfg.BindRetries {
+				continue
+			}
+			return nil, err
+		}
+
+		boundAddr, err := s.exchanger.BindAddress(ctx, mdlAddr, depositAddr, coinType, opts)
+		if err == exchange.ErrAddressAlreadyBound && i < s.cfg.BindRetries {
+			continue
+		}
+
+		return boundAddr, err
+	}
+}
+
+// CheckMDLAddress returns ErrMDLAddressBlocked if mdlAddr is in the blocklist,
+// or ErrMDLAddressNotAllowed if there is an allowlist and mdlAddr is not in it.
+// The blocklist takes precedence over the allowlist
+func (s *Service) CheckMDLAddress(mdlAddr string) error {
+	if s.blocklist != nil {
+		blocked, err := s.blocklist.Contains(mdlAddr)
+		if err != nil {
+			return err
+		}
+
+		if blocked {
+			return ErrMDLAddressBlocked
+		}
+	}
+
+	if s.allowlist != nil {
+		allowed, err := s.allowlist.Contains(mdlAddr)
+		if err != nil {
+			return err
+		}
+
+		if !allowed {
+			return ErrMDLAddressNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// CheckBindable returns the reason a deposit address of coinType can't currently be bound, or nil if it can.
+// It makes the checks of BindAddress that don't depend on the mdl address
+func (s *Service) CheckBindable(coinType string) error {
+	if err := s.bindAllowed(); err != nil {
+		return err
+	}
+
+	if err := s.checkCoinActive(coinType); err != nil {
+		return err
+	}
+
+	available, err := s.addrManager.Available(coinType)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if !available {
+		return addrs.ErrDepositAddressEmpty
+	}
+
+	return nil
+}
+
+func (s *Service) bindAllowed() error {
+	if !s.cfg.BindEnabled {
+		return ErrBindDisabled
+	}
+
+	if !s.sendEnabled && !s.cfg.AllowPrebind {
+		return ErrPayoutsDisabled
+	}
+
+	return s.checkBalance()
+}
+
+// checkBindCooldown returns a BindCooldownError if mdlAddr bound an address less than teller.bind_cooldown before now.
+// The time of the last bind is that of the most recent binding of mdlAddr, which is saved with the binding
+func (s *Service) checkBindCooldown(mdlAddr string, now time.Time) error {
+	if s.cfg.BindCooldown <= 0 {
+		return nil
+	}
+
+	lastBind, err := s.exchanger.GetLastBindTime(mdlAddr)
+	if err != nil || lastBind == 0 {
+		return err
 	}
 
-	return s.exchanger.BindAddress(mdlAddr, depositAddr, coinType)
+	if wait := time.Unix(lastBind, 0).Add(s.cfg.BindCooldown).Sub(now); wait > 0 {
+		return BindCooldownError{
+			RetryAfter: wait,
+		}
+	}
+
+	return nil
+}
+
+// checkBalance returns ErrLowBalance if the confirmed MDL hot wallet balance is below teller.min_bind_balance,
+// so that no deposit is taken that can't be paid out
+func (s *Service) checkBalance() error {
+	minBalance, err := s.cfg.MinBindBalanceDroplets()
+	if err != nil || minBalance == 0 {
+		return err
+	}
+
+	balance, err := s.exchanger.Balance()
+	if err != nil {
+		return err
+	}
+
+	if balance.Confirmed.Coins < minBalance {
+		return ErrLowBalance
+	}
+
+	return nil
+}
+
+// checkDepositAddressBalance checks with teller.eth_bind_balance_check that an ETH deposit address drawn from the pool
+// holds no funds, since a funded address has likely been used before, e.g. derived twice from a hardware wallet.
+// A funded address is logged. With config.BindBalanceCheckReject, ErrDepositAddressFunded is returned and the address
+// is not bound, and an address whose balance can't be read is not bound either
+func (s *Service) checkDepositAddressBalance(ctx context.Context, coinType, addr string) error {
+	if coinType != scanner.CoinTypeETH || s.cfg.EthBindBalanceCheck == "" || s.balances == nil {
+		return nil
+	}
+
+	reject := s.cfg.EthBindBalanceCheck == config.BindBalanceCheckReject
+	log := s.log.WithFields(logrus.Fields{
+		"coinType":    coinType,
+		"depositAddr": addr,
+	})
+
+	balance, err := s.balances.AddressBalance(ctx, coinType, addr)
+	if err != nil {
+		if reject {
+			return err
+		}
+		log.WithError(err).Warn("Deposit address balance check failed")
+		return nil
+	}
+
+	if balance == 0 {
+		return nil
+	}
+
+	log = log.WithField("balance", balance)
+	if reject {
+		log.Error("Deposit address already holds funds, it is not bound")
+		return ErrDepositAddressFunded
+	}
+
+	log.Warn("Deposit address already holds funds")
+	return nil
+}
+
+// checkCoinActive returns exchange.ErrCoinDeprecated if coinType was deprecated by an admin
+func (s *Service) checkCoinActive(coinType string) error {
+	deprecations, err := s.exchanger.GetCoinDeprecations()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := deprecations[coinType]; ok {
+		return exchange.ErrCoinDeprecated
+	}
+
+	return nil
+}
+
+// PayoutsEnabled returns true if deposits to bound addresses are paid out in MDL
+func (s *Service) PayoutsEnabled() bool {
+	return s.sendEnabled
 }
 
 // GetDepositStatuses returns deposit status of given mdl address
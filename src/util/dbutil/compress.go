@@ -0,0 +1,75 @@
+package dbutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/boltdb/bolt"
+)
+
+// gzipMagic are the first bytes of a gzip stream. A JSON value never starts with them,
+// so compressed and uncompressed values can be told apart and stored side by side
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsCompressed returns true if a value was compressed by CompressValue
+func IsCompressed(v []byte) bool {
+	return bytes.HasPrefix(v, gzipMagic)
+}
+
+// CompressValue gzips a value
+func CompressValue(v []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(v); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// DecompressValue returns a value compressed by CompressValue decompressed, and any other value as it is
+func DecompressValue(v []byte) ([]byte, error) {
+	if !IsCompressed(v) {
+		return v, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(v))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// UnmarshalValue unmarshals a JSON value, decompressing it first if it is compressed
+func UnmarshalValue(v []byte, obj interface{}) error {
+	v, err := DecompressValue(v)
+	if err != nil {
+		return fmt.Errorf("decompress value failed: %v", err)
+	}
+
+	return json.Unmarshal(v, obj)
+}
+
+// PutBucketCompressedValue marshals a value to JSON and stores it compressed in a bucket under key.
+// It is read back with GetBucketObject, like a value stored with PutBucketValue
+func PutBucketCompressedValue(tx *bolt.Tx, bktName []byte, key string, obj interface{}) error {
+	v, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("encode value failed: %v", err)
+	}
+
+	cv, err := CompressValue(v)
+	if err != nil {
+		return fmt.Errorf("compress value failed: %v", err)
+	}
+
+	return PutBucketValue(tx, bktName, key, cv)
+}
@@ -60,13 +60,14 @@ func NewObjectNotExistErr(bucket, key []byte) error {
 }
 
 // GetBucketObject returns a JSON value from a bucket, unmarshaled to an object.
+// Values stored with PutBucketCompressedValue are decompressed transparently
 func GetBucketObject(tx *bolt.Tx, bktName []byte, key string, obj interface{}) error {
 	v, err := getBucketValue(tx, bktName, key)
 	if err != nil {
 		return err
 	}
 
-	if err := json.Unmarshal(v, obj); err != nil {
+	if err := UnmarshalValue(v, obj); err != nil {
 		return fmt.Errorf("decode value failed: %v", err)
 	}
 
@@ -0,0 +1,112 @@
+package dbutil
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+)
+
+// SchemaVersionsBkt maps the name of each component storing data in the db to the version of its schema.
+// Components are versioned independently, so that each can evolve its own buckets
+var SchemaVersionsBkt = []byte("schema_versions")
+
+// Migration upgrades the buckets of a component by one schema version
+type Migration struct {
+	Name    string
+	Migrate func(tx *bolt.Tx) error
+}
+
+// SchemaTooNewErr is returned if the db was written by a newer version of teller
+type SchemaTooNewErr struct {
+	Component string
+	Version   int
+	Supported int
+}
+
+func (e SchemaTooNewErr) Error() string {
+	return fmt.Sprintf("The %s schema version of the db is %d, but this version of teller only supports up to %d. Upgrade teller to open this db",
+		e.Component, e.Version, e.Supported)
+}
+
+// GetSchemaVersion returns the schema version of a component. A db without a recorded version is at version 0
+func GetSchemaVersion(tx *bolt.Tx, component string) (int, error) {
+	v, err := GetBucketString(tx, SchemaVersionsBkt, component)
+	switch err.(type) {
+	case nil:
+	case BucketNotExistErr, ObjectNotExistErr:
+		return 0, nil
+	default:
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s schema version %q: %v", component, v, err)
+	}
+
+	return version, nil
+}
+
+// CheckSchemaVersion returns SchemaTooNewErr if the db is at a schema version newer than len(migrations).
+// Used when the db is opened read-only and cannot be migrated
+func CheckSchemaVersion(db *bolt.DB, component string, migrations []Migration) error {
+	return db.View(func(tx *bolt.Tx) error {
+		_, err := checkSchemaVersionTx(tx, component, migrations)
+		return err
+	})
+}
+
+func checkSchemaVersionTx(tx *bolt.Tx, component string, migrations []Migration) (int, error) {
+	version, err := GetSchemaVersion(tx, component)
+	if err != nil {
+		return 0, err
+	}
+
+	if version > len(migrations) {
+		return 0, SchemaTooNewErr{
+			Component: component,
+			Version:   version,
+			Supported: len(migrations),
+		}
+	}
+
+	return version, nil
+}
+
+// Migrate upgrades the buckets of a component to the latest schema version.
+// migrations[i] upgrades the schema from version i to version i+1; the migrations not applied yet
+// run in order, in a single transaction, so that a failed migration leaves the db untouched.
+// Returns SchemaTooNewErr if the db is at a schema version newer than len(migrations)
+func Migrate(log logrus.FieldLogger, db *bolt.DB, component string, migrations []Migration) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		version, err := checkSchemaVersionTx(tx, component, migrations)
+		if err != nil {
+			return err
+		}
+
+		if version == len(migrations) {
+			return nil
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(SchemaVersionsBkt); err != nil {
+			return NewCreateBucketFailedErr(SchemaVersionsBkt, err)
+		}
+
+		for i := version; i < len(migrations); i++ {
+			m := migrations[i]
+			log.WithFields(logrus.Fields{
+				"component": component,
+				"version":   i + 1,
+				"migration": m.Name,
+			}).Info("Migrating db schema")
+
+			if err := m.Migrate(tx); err != nil {
+				return fmt.Errorf("Migrating the %s schema to version %d (%s) failed: %v", component, i+1, m.Name, err)
+			}
+		}
+
+		return PutBucketValue(tx, SchemaVersionsBkt, component, strconv.Itoa(len(migrations)))
+	})
+}
@@ -1,12 +1,25 @@
 package httputil
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
+	"net"
 	"net/http"
+	"path"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/NYTimes/gziphandler"
 	"github.com/sirupsen/logrus"
 
 	"github.com/MDLlife/teller/src/util/logger"
@@ -21,6 +34,65 @@ func ErrResponse(w http.ResponseWriter, code int, errMsg ...string) {
 	}
 }
 
+// ErrorsAsOKParam is the query parameter that makes ErrorsAsOKHandler return the errors of a request
+// with 200 OK, for clients that can't handle error status codes
+const ErrorsAsOKParam = "errors_as_ok"
+
+type ctxKey int
+
+const errorsAsOKCtxKey ctxKey = iota
+
+// ErrorsAsOKResponse is the response body of an error returned with 200 OK
+type ErrorsAsOKResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// ErrorsAsOKHandler returns a handler that makes ErrResponseContext respond to the requests with 200 OK
+// and an ErrorsAsOKResponse instead of an error status code. If always is false, only requests with
+// a true ErrorsAsOKParam query parameter are answered this way.
+func ErrorsAsOKHandler(hd http.Handler, always bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enabled := always
+		if !enabled {
+			enabled, _ = strconv.ParseBool(r.URL.Query().Get(ErrorsAsOKParam))
+		}
+
+		if enabled {
+			r = r.WithContext(context.WithValue(r.Context(), errorsAsOKCtxKey, true))
+		}
+
+		hd.ServeHTTP(w, r)
+	})
+}
+
+// ErrorsAsOK returns true if the errors of the request with context ctx are returned with 200 OK
+func ErrorsAsOK(ctx context.Context) bool {
+	ok, _ := ctx.Value(errorsAsOKCtxKey).(bool)
+	return ok
+}
+
+// ErrResponseContext is ErrResponse, unless ErrorsAsOKHandler enabled 200 OK errors for the request.
+// Then the error is written as an ErrorsAsOKResponse with 200 OK
+func ErrResponseContext(ctx context.Context, w http.ResponseWriter, code int, errMsg ...string) {
+	if !ErrorsAsOK(ctx) {
+		ErrResponse(w, code, errMsg...)
+		return
+	}
+
+	msg := http.StatusText(code)
+	if len(errMsg) > 0 {
+		msg = strings.Join(errMsg, " ")
+	}
+
+	// Like http.Error, a failed write is not reported, the client is gone
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	JSONResponse(w, ErrorsAsOKResponse{ // nolint: errcheck
+		OK:    false,
+		Error: msg,
+	})
+}
+
 // JSONResponse marshal data into json and write response
 func JSONResponse(w http.ResponseWriter, data interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
@@ -33,11 +105,355 @@ func JSONResponse(w http.ResponseWriter, data interface{}) error {
 	return err
 }
 
+// errRequestBodyTooLarge is the error of a http.MaxBytesReader read past its limit, which is not exported
+const errRequestBodyTooLarge = "http: request body too large"
+
+// DecodeJSONBody decodes the json request body into v, reading at most maxBytes of it.
+// On failure it returns the status code to respond with: http.StatusRequestEntityTooLarge
+// if the body is larger than maxBytes, otherwise http.StatusBadRequest
+func DecodeJSONBody(w http.ResponseWriter, r *http.Request, maxBytes int64, v interface{}) (int, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		if err.Error() == errRequestBodyTooLarge {
+			return http.StatusRequestEntityTooLarge, errors.New("Request body too large")
+		}
+
+		return http.StatusBadRequest, fmt.Errorf("Invalid json request body: %v", err)
+	}
+
+	return http.StatusOK, nil
+}
+
+// timeoutBody is the response body of TimeoutHandler to the requests that timed out, an ErrorsAsOKResponse
+const timeoutBody = `{"ok":false,"error":"Request timed out"}`
+
+// TimeoutHandler returns a handler that cancels the request context and responds with
+// 503 Service Unavailable and a JSON error if hd does not finish within timeout.
+// If timeout is <= 0, hd is returned unchanged.
+func TimeoutHandler(hd http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return hd
+	}
+
+	th := http.TimeoutHandler(hd, timeout, timeoutBody)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		th.ServeHTTP(&timeoutResponseWriter{w}, r)
+	})
+}
+
+// timeoutResponseWriter sets the JSON content type of the response of http.TimeoutHandler to a request
+// that timed out, which is written without a content type
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *timeoutResponseWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// TimestampHeader is the request header holding the unix time a request was made at, checked by TimestampHandler
+const TimestampHeader = "X-Request-Timestamp"
+
+// TimestampHandler returns a handler that responds with 400 Bad Request to requests whose TimestampHeader
+// is invalid, or differs from the server time by more than maxSkew. This protects timestamped requests
+// from being replayed later. Requests without the header are passed to hd.
+// If maxSkew is <= 0, hd is returned unchanged.
+func TimestampHandler(hd http.Handler, maxSkew time.Duration) http.Handler {
+	if maxSkew <= 0 {
+		return hd
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts := r.Header.Get(TimestampHeader)
+		if ts == "" {
+			hd.ServeHTTP(w, r)
+			return
+		}
+
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			ErrResponseContext(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("Invalid %s header, must be a unix time", TimestampHeader))
+			return
+		}
+
+		skew := time.Since(time.Unix(unix, 0))
+		switch {
+		case skew > maxSkew:
+			ErrResponseContext(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("Request timestamp is more than %s old", maxSkew))
+			return
+		case skew < -maxSkew:
+			ErrResponseContext(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("Request timestamp is more than %s in the future", maxSkew))
+			return
+		}
+
+		hd.ServeHTTP(w, r)
+	})
+}
+
+// ConcurrencyLimiter limits the number of requests from one IP address that are handled at the same time.
+// Each IP has a counting semaphore of size max, acquired without blocking for the duration of a request.
+type ConcurrencyLimiter struct {
+	sync.Mutex
+	max         int
+	behindProxy bool
+	inFlight    map[string]int
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter allowing max concurrent requests per IP.
+// If behindProxy is true, the IP is read from the X-Forwarded-For or X-Real-IP header when present.
+func NewConcurrencyLimiter(max int, behindProxy bool) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		max:         max,
+		behindProxy: behindProxy,
+		inFlight:    make(map[string]int),
+	}
+}
+
+func (l *ConcurrencyLimiter) acquire(ip string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.inFlight[ip] >= l.max {
+		return false
+	}
+
+	l.inFlight[ip]++
+	return true
+}
+
+func (l *ConcurrencyLimiter) release(ip string) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.inFlight[ip]--
+	if l.inFlight[ip] <= 0 {
+		delete(l.inFlight, ip)
+	}
+}
+
+// Handler returns a handler that responds with 429 Too Many Requests if the client
+// already has the maximum number of requests in flight.
+// If the limiter's max is <= 0, hd is returned unchanged.
+func (l *ConcurrencyLimiter) Handler(hd http.Handler) http.Handler {
+	if l.max <= 0 {
+		return hd
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := RemoteIP(r, l.behindProxy)
+		if !l.acquire(ip) {
+			ErrResponseContext(r.Context(), w, http.StatusTooManyRequests, "Too many concurrent requests")
+			return
+		}
+		defer l.release(ip)
+
+		hd.ServeHTTP(w, r)
+	})
+}
+
+// RemoteIP returns the IP address of the client that made the request.
+// If behindProxy is true, the last address in X-Forwarded-For, or else X-Real-IP, is used when present.
+// The last address is the one appended by the proxy, the addresses before it are sent by the client and can be spoofed.
+func RemoteIP(r *http.Request, behindProxy bool) string {
+	if behindProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			hops := strings.Split(fwd, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// GzipHandler gzips the responses of hd at the given compression level, 0 uses the default level.
+// If contentTypes is not empty, only files with one of the content types are gzipped.
+// The content type is found from the extension of the request path, and an entry ending in "/", e.g. "text/",
+// matches all of its subtypes. Files with an unknown content type are not gzipped
+func GzipHandler(hd http.Handler, level int, contentTypes []string) (http.Handler, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	wrap, err := gziphandler.NewGzipLevelHandler(level)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := wrap(hd)
+	if len(contentTypes) == 0 {
+		return gz, nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gzipContentType(r.URL.Path, contentTypes) {
+			gz.ServeHTTP(w, r)
+		} else {
+			hd.ServeHTTP(w, r)
+		}
+	}), nil
+}
+
+func gzipContentType(name string, contentTypes []string) bool {
+	// http.FileServer serves index.html for directories
+	if strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+
+	mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+	if err != nil {
+		return false
+	}
+
+	for _, ct := range contentTypes {
+		ct = strings.ToLower(ct)
+		if ct == mediaType || (strings.HasSuffix(ct, "/") && strings.HasPrefix(mediaType, ct)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidHeaderName returns true if name is a valid HTTP header field name, a non-empty RFC 7230 token
+func ValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// HeadersHandler sets headers on every response of hd, replacing the values set by hd.
+// A header with an empty value is removed from the responses.
+// If headers is empty, hd is returned unchanged.
+func HeadersHandler(hd http.Handler, headers map[string]string) http.Handler {
+	if len(headers) == 0 {
+		return hd
+	}
+
+	canonical := make(map[string]string, len(headers))
+	for k, v := range headers {
+		canonical[http.CanonicalHeaderKey(k)] = v
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hd.ServeHTTP(&headersResponseWriter{
+			ResponseWriter: w,
+			headers:        canonical,
+		}, r)
+	})
+}
+
+// Applies headers before the response header is written
+type headersResponseWriter struct {
+	http.ResponseWriter
+	headers     map[string]string
+	wroteHeader bool
+}
+
+func (hrw *headersResponseWriter) WriteHeader(code int) {
+	if !hrw.wroteHeader {
+		hrw.wroteHeader = true
+
+		h := hrw.ResponseWriter.Header()
+		for k, v := range hrw.headers {
+			if v == "" {
+				h.Del(k)
+			} else {
+				h.Set(k, v)
+			}
+		}
+	}
+
+	hrw.ResponseWriter.WriteHeader(code)
+}
+
+func (hrw *headersResponseWriter) Write(b []byte) (int, error) {
+	if !hrw.wroteHeader {
+		hrw.WriteHeader(http.StatusOK)
+	}
+
+	return hrw.ResponseWriter.Write(b)
+}
+
+// RecoverHandler recovers from a panic in hd and responds with 500 Internal Server Error.
+// The panic is logged with its stack and a request ID, which is returned in the X-Request-ID header
+// so that the client can report it. Neither the panic nor the stack is sent to the client
+func RecoverHandler(log logrus.FieldLogger, hd http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+
+			// http.ErrAbortHandler aborts the response on purpose, the http.Server handles it
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			requestID := newRequestID()
+
+			log.WithFields(logrus.Fields{
+				"requestID":  requestID,
+				"method":     r.Method,
+				"remoteAddr": r.RemoteAddr,
+				"url":        r.URL.String(),
+				"panic":      fmt.Sprint(p),
+				"stack":      string(debug.Stack()),
+			}).Error("HTTP handler panicked")
+
+			w.Header().Set("X-Request-ID", requestID)
+			ErrResponseContext(r.Context(), w, http.StatusInternalServerError)
+		}()
+
+		hd.ServeHTTP(w, r)
+	})
+}
+
+// newRequestID returns a random ID for a request
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprint(time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
 // LogHandler log middleware
 func LogHandler(log logrus.FieldLogger, hd http.Handler) http.Handler {
+	return SampledLogHandler(log, 1, hd)
+}
+
+// SampledLogHandler is LogHandler logging only 1 in sampleRate of the successful requests.
+// Requests that fail, with a 4xx or 5xx status, are always logged. A sampleRate of 0 or 1 logs every request
+func SampledLogHandler(log logrus.FieldLogger, sampleRate int, hd http.Handler) http.Handler {
+	var n uint64
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
-		log = log.WithFields(logrus.Fields{
+		log := log.WithFields(logrus.Fields{
 			"method":     r.Method,
 			"remoteAddr": r.RemoteAddr,
 			"url":        r.URL.String(),
@@ -51,6 +467,12 @@ func LogHandler(log logrus.FieldLogger, hd http.Handler) http.Handler {
 
 		hd.ServeHTTP(lrw, r)
 
+		if lrw.statusCode < http.StatusBadRequest && sampleRate > 1 {
+			if atomic.AddUint64(&n, 1)%uint64(sampleRate) != 1 {
+				return
+			}
+		}
+
 		log.WithFields(logrus.Fields{
 			"duration":   fmt.Sprintf("%dms", time.Since(t)/time.Millisecond),
 			"status":     lrw.statusCode,
@@ -65,6 +487,13 @@ type loggingResponseWriter struct {
 	statusCode int
 }
 
+// Flush flushes the wrapped http.ResponseWriter if it is a http.Flusher, for streamed responses
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func newLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
 	return &loggingResponseWriter{
 		ResponseWriter: w,
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path"
@@ -12,6 +13,13 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// FormatText logs human readable lines. This is the default
+	FormatText = "text"
+	// FormatJSON logs one JSON object per line, with the entry's fields as keys, for log aggregators
+	FormatJSON = "json"
+)
+
 type ctxKey int
 
 const loggerCtxKey ctxKey = iota
@@ -35,7 +43,18 @@ func WithContext(ctx context.Context, lg logrus.FieldLogger) context.Context {
 // If debug is true, the log level is logrus.DebugLevel, otherwise logrus.InfoLevel.
 // If logFilename is not the empty string, logs will also be written to that file,
 // in addition to os.Stdout.
-func NewLogger(logFilename string, debug bool) (*logrus.Logger, error) {
+// format is FormatText or FormatJSON, and applies to both os.Stdout and the file.
+// An empty format is FormatText.
+func NewLogger(logFilename string, debug bool, format string) (*logrus.Logger, error) {
+	var jsonFormatter *logrus.JSONFormatter
+	switch format {
+	case "", FormatText:
+	case FormatJSON:
+		jsonFormatter = &logrus.JSONFormatter{}
+	default:
+		return nil, fmt.Errorf("Invalid log format %q", format)
+	}
+
 	log := logrus.New()
 	log.Out = os.Stdout
 	log.Formatter = &prefixed.TextFormatter{
@@ -44,6 +63,9 @@ func NewLogger(logFilename string, debug bool) (*logrus.Logger, error) {
 		QuoteEmptyFields:   true,
 		ForceFormatting:    true,
 	}
+	if jsonFormatter != nil {
+		log.Formatter = jsonFormatter
+	}
 	log.Level = logrus.InfoLevel
 
 	if debug {
@@ -56,6 +78,10 @@ func NewLogger(logFilename string, debug bool) (*logrus.Logger, error) {
 			return nil, err
 		}
 
+		if jsonFormatter != nil {
+			hook.formatter = jsonFormatter
+		}
+
 		log.Hooks.Add(hook)
 	}
 
@@ -1,14 +1,19 @@
 package logger
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"testing"
 
+	prefixed "github.com/gz-c/logrus-prefixed-formatter"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
 
 func TestContext(t *testing.T) {
-	log, err := NewLogger("", true)
+	log, err := NewLogger("", true, FormatText)
 	require.NoError(t, err)
 
 	ctx := context.Background()
@@ -17,3 +22,41 @@ func TestContext(t *testing.T) {
 	ctx = WithContext(ctx, log)
 	require.NotNil(t, FromContext(ctx))
 }
+
+func TestNewLoggerFormat(t *testing.T) {
+	log, err := NewLogger("", false, "")
+	require.NoError(t, err)
+	require.IsType(t, &prefixed.TextFormatter{}, log.Formatter)
+
+	log, err = NewLogger("", false, FormatText)
+	require.NoError(t, err)
+	require.IsType(t, &prefixed.TextFormatter{}, log.Formatter)
+
+	_, err = NewLogger("", false, "xml")
+	require.Error(t, err)
+
+	log, err = NewLogger("", false, FormatJSON)
+	require.NoError(t, err)
+	require.IsType(t, &logrus.JSONFormatter{}, log.Formatter)
+
+	var buf bytes.Buffer
+	log.Out = &buf
+
+	log.WithField("prefix", "teller").WithFields(logrus.Fields{
+		"depositAddr": "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp",
+		"amount":      100,
+	}).WithError(errors.New("send failed")).Error("Send MDL failed")
+
+	var entry map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	require.NoError(t, err, buf.String())
+
+	require.Equal(t, "Send MDL failed", entry["msg"])
+	require.Equal(t, "error", entry["level"])
+	require.Equal(t, "teller", entry["prefix"])
+	require.Equal(t, "1Bmp9Kv9vcbjNKfdxCrmL1Ve5n7gvkDoNp", entry["depositAddr"])
+	require.Equal(t, float64(100), entry["amount"])
+	require.Equal(t, "send failed", entry["error"])
+	require.NotEmpty(t, entry["time"])
+	require.NotEmpty(t, entry["file"])
+}
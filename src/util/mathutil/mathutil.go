@@ -2,14 +2,42 @@ package mathutil
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/shopspring/decimal"
 )
 
 // DecimalFromString parses a string into a decimal.Decimal.
 // It supports int, float and rational fraction strings.
+// A "%" suffix makes the number a percentage and a "bps" suffix makes it basis points,
+// both are fractions of one: "50%" is 0.5, "0.5%" is 0.005 and "25bps" is 0.0025.
 func DecimalFromString(s string) (decimal.Decimal, error) {
+	for _, u := range []struct {
+		suffix string
+		exp    int32
+	}{
+		{"%", -2},
+		{"bps", -4},
+	} {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+
+		d, err := decimalFromString(strings.TrimSpace(strings.TrimSuffix(s, u.suffix)))
+		if err != nil {
+			return decimal.Decimal{}, fmt.Errorf("can't convert %s to decimal", s)
+		}
+
+		return d.Mul(decimal.New(1, u.exp)), nil
+	}
+
+	return decimalFromString(s)
+}
+
+// decimalFromString parses an int, float or rational fraction string into a decimal.Decimal
+func decimalFromString(s string) (decimal.Decimal, error) {
 	// shopspring.Decimal does not parse rational fraction strings
 	// Use math/big.Rat to parse these
 
@@ -45,7 +73,8 @@ func Gwei2Wei(gwei int64) *big.Int {
 	return big.NewInt(1).Mul(big.NewInt(gwei), big.NewInt(1e9))
 }
 
-// ParseRate parses an exchange rate string and validates it
+// ParseRate parses an exchange rate string and validates it.
+// See DecimalFromString for the accepted formats, including percentages such as "50%"
 func ParseRate(rate string) (decimal.Decimal, error) {
 	r, err := DecimalFromString(rate)
 	if err != nil {
@@ -79,7 +108,22 @@ func IntToSKY(i int64) decimal.Decimal {
 	return decimal.New(i, -int32(6))
 }
 
+// MDLDropletPrecision is the number of decimal places of a MDL amount in droplets
+const MDLDropletPrecision = 6
+
 // IntToMDL decimal
 func IntToMDL(i int64) decimal.Decimal {
-	return decimal.New(i, -int32(6))
+	return decimal.New(i, -int32(MDLDropletPrecision))
+}
+
+// FormatDroplets renders droplets as a MDL amount with precision decimal places, e.g. "1.50" for 1500000 droplets
+// and a precision of 2. The digits beyond the precision are truncated, so that an amount is never shown larger than it is.
+// A precision of MDLDropletPrecision renders the amount like droplet.ToString
+func FormatDroplets(droplets uint64, precision int) (string, error) {
+	if precision < 0 || precision > MDLDropletPrecision {
+		return "", fmt.Errorf("precision must be between 0 and %d", MDLDropletPrecision)
+	}
+
+	d := decimal.NewFromBigInt(new(big.Int).SetUint64(droplets), -MDLDropletPrecision)
+	return d.Truncate(int32(precision)).StringFixed(int32(precision)), nil
 }
@@ -45,17 +45,123 @@ func TestDecimalFromString(t *testing.T) {
 			s:      "1/10",
 			result: decimal.New(1, -1),
 		},
+
+		{
+			s:      "1/2",
+			result: decimal.New(5, -1),
+		},
+
+		{
+			s:      "50%",
+			result: decimal.New(5, -1),
+		},
+
+		{
+			s:      "100%",
+			result: decimal.New(1, 0),
+		},
+
+		{
+			s:      "0.5%",
+			result: decimal.New(5, -3),
+		},
+
+		{
+			s:      "150 %",
+			result: decimal.New(15, -1),
+		},
+
+		{
+			s:      "1/2%",
+			result: decimal.New(5, -3),
+		},
+
+		{
+			s:      "25bps",
+			result: decimal.New(25, -4),
+		},
+
+		{
+			s:      "10000bps",
+			result: decimal.New(1, 0),
+		},
+
+		{
+			s:   "%",
+			err: errors.New("can't convert % to decimal"),
+		},
+
+		{
+			s:   "50%%",
+			err: errors.New("can't convert 50%% to decimal"),
+		},
+
+		{
+			s:   "bad%",
+			err: errors.New("can't convert bad% to decimal"),
+		},
+
+		{
+			s:   "%50",
+			err: errors.New("can't convert %50 to decimal"),
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.s, func(t *testing.T) {
 			d, err := DecimalFromString(tc.s)
-			require.True(t, tc.result.Equal(d))
+			require.True(t, tc.result.Equal(d), "%s != %s", tc.result, d)
 			require.Equal(t, tc.err, err)
 		})
 	}
 }
 
+func TestParseRate(t *testing.T) {
+	cases := []struct {
+		s      string
+		result decimal.Decimal
+		err    string
+	}{
+		{
+			s:      "500",
+			result: decimal.New(500, 0),
+		},
+		{
+			s:      "1/2",
+			result: decimal.New(5, -1),
+		},
+		{
+			s:      "50%",
+			result: decimal.New(5, -1),
+		},
+		{
+			s:      "0.5%",
+			result: decimal.New(5, -3),
+		},
+		{
+			s:   "0%",
+			err: "rate must be greater than zero",
+		},
+		{
+			s:   "-1%",
+			err: "rate must be greater than zero",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.s, func(t *testing.T) {
+			r, err := ParseRate(tc.s)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.True(t, tc.result.Equal(r), "%s != %s", tc.result, r)
+		})
+	}
+}
+
 func TestWei2Gwei(t *testing.T) {
 	cases := []struct {
 		wei  *big.Int
@@ -219,3 +325,77 @@ func TestIntToMDL(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatDroplets(t *testing.T) {
+	cases := []struct {
+		droplets  uint64
+		precision int
+		result    string
+		err       error
+	}{
+		{
+			droplets:  100e6,
+			precision: MDLDropletPrecision,
+			result:    "100.000000",
+		},
+		{
+			droplets:  1234567,
+			precision: MDLDropletPrecision,
+			result:    "1.234567",
+		},
+		{
+			droplets:  1,
+			precision: MDLDropletPrecision,
+			result:    "0.000001",
+		},
+		{
+			droplets:  100e6,
+			precision: 2,
+			result:    "100.00",
+		},
+		{
+			// Digits beyond the precision are truncated, not rounded
+			droplets:  1239999,
+			precision: 2,
+			result:    "1.23",
+		},
+		{
+			droplets:  1,
+			precision: 2,
+			result:    "0.00",
+		},
+		{
+			droplets:  1999999,
+			precision: 0,
+			result:    "1",
+		},
+		{
+			droplets:  18446744073709551615,
+			precision: MDLDropletPrecision,
+			result:    "18446744073709.551615",
+		},
+		{
+			droplets:  1,
+			precision: MDLDropletPrecision + 1,
+			err:       errors.New("precision must be between 0 and 6"),
+		},
+		{
+			droplets:  1,
+			precision: -1,
+			err:       errors.New("precision must be between 0 and 6"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%d:%d", tc.droplets, tc.precision), func(t *testing.T) {
+			s, err := FormatDroplets(tc.droplets, tc.precision)
+			if tc.err != nil {
+				require.Equal(t, tc.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.result, s)
+		})
+	}
+}
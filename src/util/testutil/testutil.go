@@ -38,7 +38,7 @@ func CheckError(t *testing.T, f func() error) {
 
 // NewLogger returns a logger that only writes to stdout and with debug level
 func NewLogger(t *testing.T) (*logrus.Logger, *logrus_test.Hook) {
-	log, err := logger.NewLogger("", true)
+	log, err := logger.NewLogger("", true, logger.FormatText)
 	require.NoError(t, err)
 
 	// Attach a log recorder for test inspection
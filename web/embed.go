@@ -0,0 +1,21 @@
+// Package web embeds the frontend build in the teller binary
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed build
+var build embed.FS
+
+// Build returns the files of the frontend build, rooted at the build directory.
+// It is served when web.static_dir is not set
+func Build() fs.FS {
+	b, err := fs.Sub(build, "build")
+	if err != nil {
+		// fs.Sub only fails for an invalid path
+		panic(err)
+	}
+	return b
+}